@@ -0,0 +1,505 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "crypto/tls"
+    "encoding/hex"
+    "flag"
+    "fmt"
+    "net"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const usage = `usage: loadtest [flags]
+
+Connects synthetic clients to a running server. Each registers (unless
+-register=false), logs in, joins one of -channels channels and then sends
+PRIVMSGs to it at -rate per second for -duration. Every other client in the
+channel should receive each message; the report gives login, join and
+delivery latency percentiles and how many deliveries never arrived.
+
+Point it at a test server: it creates accounts and channels, and the
+server's rate limits (flood, join throttle, reconnect throttle) apply to it
+like any other client, showing up as errors.
+
+Flags:
+`
+
+type options struct {
+    addr          string
+    useTLS        bool
+    insecure      bool
+    clients       int
+    channels      int
+    channelPrefix string
+    userPrefix    string
+    password      string
+    register      bool
+    connectRate   float64
+    rate          float64
+    duration      time.Duration
+    drain         time.Duration
+    timeout       time.Duration
+}
+
+func main() {
+    var opts options
+    flag.StringVar(&opts.addr, "addr", "127.0.0.1:6667", "Server address")
+    flag.BoolVar(&opts.useTLS, "tls", false, "Connect with TLS")
+    flag.BoolVar(&opts.insecure, "insecure", false, "Skip TLS certificate verification")
+    flag.IntVar(&opts.clients, "clients", 100, "Number of synthetic clients")
+    flag.IntVar(&opts.channels, "channels", 10, "Number of channels the clients are spread across")
+    flag.StringVar(&opts.channelPrefix, "channel-prefix", "#loadtest", "Channel names are this prefix plus a number")
+    flag.StringVar(&opts.userPrefix, "user-prefix", "loadtest", "Usernames are this prefix plus a number")
+    flag.StringVar(&opts.password, "password", "loadtest", "Password of every synthetic account")
+    flag.BoolVar(&opts.register, "register", true, "REGISTER each account before logging in (an existing account is not an error)")
+    flag.Float64Var(&opts.connectRate, "connect-rate", 20, "Logins started per second (0 = all at once)")
+    flag.Float64Var(&opts.rate, "rate", 1, "PRIVMSGs per second per client")
+    flag.DurationVar(&opts.duration, "duration", 30*time.Second, "How long clients send messages")
+    flag.DurationVar(&opts.drain, "drain", 5*time.Second, "How long to wait for deliveries after the last message")
+    flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "How long to wait for each login and join reply")
+    maxP99 := flag.Duration("max-p99", 0, "Fail if p99 delivery latency exceeds this (0 = no limit)")
+    maxDrops := flag.Float64("max-drops", -1, "Fail if more than this percentage of deliveries is lost (-1 = no limit)")
+    flag.Usage = func() {
+        fmt.Fprint(os.Stderr, usage)
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if opts.clients < 1 || opts.channels < 1 || opts.rate <= 0 || opts.duration <= 0 {
+        fmt.Fprintln(os.Stderr, "loadtest: -clients, -channels, -rate and -duration must be positive")
+        os.Exit(2)
+    }
+
+    report := run(opts)
+    fmt.Print(report)
+
+    if *maxP99 > 0 && report.deliveryP99 > *maxP99 {
+        fmt.Printf("FAIL: p99 delivery latency %s exceeds %s\n", report.deliveryP99, *maxP99)
+        os.Exit(1)
+    }
+    if *maxDrops >= 0 && report.dropPercent() > *maxDrops {
+        fmt.Printf("FAIL: %.2f%% of deliveries lost, more than %.2f%%\n", report.dropPercent(), *maxDrops)
+        os.Exit(1)
+    }
+}
+
+// loadClient is one synthetic connection. Its reader hands replies to the
+// login and join steps through replies and counts message deliveries
+// itself.
+type loadClient struct {
+    id       int
+    username string
+    channel  string
+    conn     net.Conn
+    writeMu  sync.Mutex
+    replies  chan string
+    stats    *stats
+    sending  int32
+}
+
+type stats struct {
+    mu         sync.Mutex
+    logins     []time.Duration
+    joins      []time.Duration
+    deliveries []time.Duration
+    failures   map[string]int
+    errors     map[string]int
+    sent       int64
+    received   int64
+}
+
+func (s *stats) fail(step string, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.failures[fmt.Sprintf("%s: %v", step, err)]++
+}
+
+func (s *stats) record(samples *[]time.Duration, d time.Duration) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    *samples = append(*samples, d)
+}
+
+func run(opts options) *report {
+    st := &stats{failures: make(map[string]int), errors: make(map[string]int)}
+    passwordHash := sha256.Sum256([]byte(opts.password))
+    hash := hex.EncodeToString(passwordHash[:])
+
+    var interval time.Duration
+    if opts.connectRate > 0 {
+        interval = time.Duration(float64(time.Second) / opts.connectRate)
+    }
+
+    // Every client is connected and in its channel before any sends, so
+    // each message has a known number of recipients.
+    var ready sync.WaitGroup
+    members := make([]int64, opts.channels)
+    joined := make([]*loadClient, opts.clients)
+
+    connectStart := time.Now()
+    for i := 0; i < opts.clients; i++ {
+        ready.Add(1)
+        go func(i int) {
+            defer ready.Done()
+            c, err := connect(opts, i, hash, st)
+            if err != nil {
+                return
+            }
+            atomic.AddInt64(&members[i%opts.channels], 1)
+            joined[i] = c
+        }(i)
+        if interval > 0 {
+            time.Sleep(interval)
+        }
+    }
+    ready.Wait()
+    connectTime := time.Since(connectStart)
+
+    var clients []*loadClient
+    for _, c := range joined {
+        if c != nil {
+            clients = append(clients, c)
+        }
+    }
+
+    var expected int64
+    var senders sync.WaitGroup
+    sendInterval := time.Duration(float64(time.Second) / opts.rate)
+    sendStart := time.Now()
+    deadline := sendStart.Add(opts.duration)
+
+    for _, c := range clients {
+        c := c
+        recipients := members[c.id%opts.channels] - 1
+        senders.Add(1)
+        go func() {
+            defer senders.Done()
+            // Spread the first messages over one interval so clients do
+            // not all send in lockstep.
+            time.Sleep(time.Duration(c.id) * sendInterval / time.Duration(len(joined)))
+            ticker := time.NewTicker(sendInterval)
+            defer ticker.Stop()
+
+            for seq := 0; time.Now().Before(deadline); seq++ {
+                if err := c.send(fmt.Sprintf("PRIVMSG %s :lt %d %d %d", c.channel, time.Now().UnixNano(), c.id, seq)); err != nil {
+                    st.fail("send", err)
+                    return
+                }
+                atomic.AddInt64(&st.sent, 1)
+                atomic.AddInt64(&expected, recipients)
+                <-ticker.C
+            }
+        }()
+    }
+    senders.Wait()
+    sendTime := time.Since(sendStart)
+
+    // Stop early once everything expected has arrived.
+    drainUntil := time.Now().Add(opts.drain)
+    for time.Now().Before(drainUntil) && atomic.LoadInt64(&st.received) < atomic.LoadInt64(&expected) {
+        time.Sleep(50 * time.Millisecond)
+    }
+
+    for _, c := range clients {
+        atomic.StoreInt32(&c.sending, 0)
+        c.send("QUIT :load test finished")
+        c.conn.Close()
+    }
+
+    st.mu.Lock()
+    defer st.mu.Unlock()
+
+    r := &report{
+        clients:     opts.clients,
+        joined:      len(clients),
+        connectTime: connectTime,
+        sendTime:    sendTime,
+        sent:        atomic.LoadInt64(&st.sent),
+        expected:    atomic.LoadInt64(&expected),
+        received:    atomic.LoadInt64(&st.received),
+        failures:    st.failures,
+        errors:      st.errors,
+    }
+    r.loginP50, r.loginP99, _ = percentiles(st.logins)
+    r.joinP50, r.joinP99, _ = percentiles(st.joins)
+    r.deliveryP50, r.deliveryP99, r.deliveryMax = percentiles(st.deliveries)
+    return r
+}
+
+// connect dials, registers, logs in and joins the client's channel.
+func connect(opts options, i int, passwordHash string, st *stats) (*loadClient, error) {
+    c := &loadClient{
+        id:       i,
+        username: fmt.Sprintf("%s%d", opts.userPrefix, i),
+        channel:  fmt.Sprintf("%s%d", opts.channelPrefix, i%opts.channels),
+        replies:  make(chan string, 64),
+        stats:    st,
+    }
+
+    dialer := &net.Dialer{Timeout: opts.timeout}
+    var err error
+    if opts.useTLS {
+        c.conn, err = tls.DialWithDialer(dialer, "tcp", opts.addr, &tls.Config{InsecureSkipVerify: opts.insecure})
+    } else {
+        c.conn, err = dialer.Dial("tcp", opts.addr)
+    }
+    if err != nil {
+        st.fail("connect", err)
+        return nil, err
+    }
+    go c.read()
+
+    fail := func(step string, err error) (*loadClient, error) {
+        st.fail(step, err)
+        c.conn.Close()
+        return nil, err
+    }
+
+    if opts.register {
+        if err := c.send(fmt.Sprintf("REGISTER %s %s", c.username, passwordHash)); err != nil {
+            return fail("register", err)
+        }
+        // A failure here is usually an account left from an earlier run;
+        // LOGIN reports anything that matters.
+        c.await(opts.timeout, func(line string) (bool, error) {
+            return strings.Contains(line, "Registration successful") || isError(line), nil
+        })
+    }
+
+    started := time.Now()
+    if err := c.send(fmt.Sprintf("LOGIN %s %s", c.username, passwordHash)); err != nil {
+        return fail("login", err)
+    }
+    if err := c.await(opts.timeout, func(line string) (bool, error) {
+        if isError(line) {
+            return true, fmt.Errorf("%s", replyText(line))
+        }
+        return strings.Contains(line, "Login successful"), nil
+    }); err != nil {
+        return fail("login", err)
+    }
+    st.record(&st.logins, time.Since(started))
+
+    started = time.Now()
+    if err := c.send("JOIN " + c.channel); err != nil {
+        return fail("join", err)
+    }
+    if err := c.await(opts.timeout, func(line string) (bool, error) {
+        if isError(line) {
+            return true, fmt.Errorf("%s", replyText(line))
+        }
+        prefix, command, params := splitLine(line)
+        return command == "JOIN" && strings.HasPrefix(prefix, c.username+"!") && strings.EqualFold(strings.TrimPrefix(params, ":"), c.channel), nil
+    }); err != nil {
+        return fail("join", err)
+    }
+    st.record(&st.joins, time.Since(started))
+
+    atomic.StoreInt32(&c.sending, 1)
+    return c, nil
+}
+
+func (c *loadClient) send(line string) error {
+    c.writeMu.Lock()
+    defer c.writeMu.Unlock()
+
+    _, err := c.conn.Write([]byte(line + "\r\n"))
+    return err
+}
+
+// await passes replies to done until it reports true, returning its error,
+// or until timeout.
+func (c *loadClient) await(timeout time.Duration, done func(line string) (bool, error)) error {
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+
+    for {
+        select {
+        case line, ok := <-c.replies:
+            if !ok {
+                return fmt.Errorf("connection closed")
+            }
+            if finished, err := done(line); finished {
+                return err
+            }
+        case <-timer.C:
+            return fmt.Errorf("no reply within %s", timeout)
+        }
+    }
+}
+
+func (c *loadClient) read() {
+    defer close(c.replies)
+
+    scanner := bufio.NewScanner(c.conn)
+    scanner.Buffer(make([]byte, 0, 4096), 64*1024)
+    for scanner.Scan() {
+        line := scanner.Text()
+        if strings.HasPrefix(line, "@") {
+            if i := strings.IndexByte(line, ' '); i >= 0 {
+                line = line[i+1:]
+            }
+        }
+
+        _, command, params := splitLine(line)
+        switch {
+        case command == "PING":
+            c.send("PONG " + params)
+            continue
+        case command == "PRIVMSG":
+            if sentAt, ok := loadStamp(params); ok {
+                c.stats.record(&c.stats.deliveries, time.Since(sentAt))
+                atomic.AddInt64(&c.stats.received, 1)
+                continue
+            }
+        }
+
+        if atomic.LoadInt32(&c.sending) == 1 {
+            if isError(line) {
+                c.stats.mu.Lock()
+                c.stats.errors[replyText(line)]++
+                c.stats.mu.Unlock()
+            }
+            continue
+        }
+
+        select {
+        case c.replies <- line:
+        default:
+        }
+    }
+}
+
+// splitLine returns a line's source (without the colon), command and the
+// rest.
+func splitLine(line string) (prefix, command, params string) {
+    if strings.HasPrefix(line, ":") {
+        prefix, line, _ = strings.Cut(line[1:], " ")
+    }
+    command, params, _ = strings.Cut(line, " ")
+    return prefix, strings.ToUpper(command), params
+}
+
+// isError reports ERROR lines and 4xx/5xx numeric replies.
+func isError(line string) bool {
+    _, command, _ := splitLine(line)
+    if command == "ERROR" {
+        return true
+    }
+    return len(command) == 3 && (command[0] == '4' || command[0] == '5') && command[1] >= '0' && command[1] <= '9'
+}
+
+func replyText(line string) string {
+    if i := strings.Index(line, " :"); i >= 0 {
+        return line[i+2:]
+    }
+    if strings.HasPrefix(line, "ERROR :") {
+        return line[len("ERROR :"):]
+    }
+    return line
+}
+
+// loadStamp reads the send time from a load test message:
+// "<target> :lt <unix nanos> <client> <seq>".
+func loadStamp(params string) (time.Time, bool) {
+    i := strings.Index(params, " :lt ")
+    if i < 0 {
+        return time.Time{}, false
+    }
+
+    fields := strings.Fields(params[i+len(" :lt "):])
+    if len(fields) == 0 {
+        return time.Time{}, false
+    }
+
+    nanos, err := strconv.ParseInt(fields[0], 10, 64)
+    if err != nil {
+        return time.Time{}, false
+    }
+    return time.Unix(0, nanos), true
+}
+
+type report struct {
+    clients     int
+    joined      int
+    connectTime time.Duration
+    sendTime    time.Duration
+    sent        int64
+    expected    int64
+    received    int64
+    loginP50    time.Duration
+    loginP99    time.Duration
+    joinP50     time.Duration
+    joinP99     time.Duration
+    deliveryP50 time.Duration
+    deliveryP99 time.Duration
+    deliveryMax time.Duration
+    failures    map[string]int
+    errors      map[string]int
+}
+
+// dropPercent is the share of expected deliveries that never arrived.
+func (r *report) dropPercent() float64 {
+    if r.expected == 0 {
+        return 0
+    }
+    dropped := r.expected - r.received
+    if dropped < 0 {
+        dropped = 0
+    }
+    return float64(dropped) * 100 / float64(r.expected)
+}
+
+func (r *report) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "clients joined:    %d/%d in %s\n", r.joined, r.clients, r.connectTime.Round(time.Millisecond))
+    fmt.Fprintf(&b, "login latency:     p50 %s  p99 %s\n", r.loginP50, r.loginP99)
+    fmt.Fprintf(&b, "join latency:      p50 %s  p99 %s\n", r.joinP50, r.joinP99)
+    fmt.Fprintf(&b, "messages sent:     %d in %s\n", r.sent, r.sendTime.Round(time.Millisecond))
+    fmt.Fprintf(&b, "deliveries:        %d of %d expected\n", r.received, r.expected)
+    fmt.Fprintf(&b, "dropped:           %.2f%%\n", r.dropPercent())
+    if r.sendTime > 0 {
+        fmt.Fprintf(&b, "deliveries/sec:    %.0f\n", float64(r.received)/r.sendTime.Seconds())
+    }
+    fmt.Fprintf(&b, "delivery latency:  p50 %s  p99 %s  max %s\n", r.deliveryP50, r.deliveryP99, r.deliveryMax)
+    writeCounts(&b, "failed clients", r.failures)
+    writeCounts(&b, "server errors", r.errors)
+    return b.String()
+}
+
+func writeCounts(b *strings.Builder, title string, counts map[string]int) {
+    if len(counts) == 0 {
+        return
+    }
+
+    reasons := make([]string, 0, len(counts))
+    for reason := range counts {
+        reasons = append(reasons, reason)
+    }
+    sort.Slice(reasons, func(i, j int) bool { return counts[reasons[i]] > counts[reasons[j]] })
+
+    fmt.Fprintf(b, "%s:\n", title)
+    for _, reason := range reasons {
+        fmt.Fprintf(b, "  %6d  %s\n", counts[reason], reason)
+    }
+}
+
+func percentiles(samples []time.Duration) (p50, p99, max time.Duration) {
+    if len(samples) == 0 {
+        return 0, 0, 0
+    }
+
+    sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+    at := func(p float64) time.Duration {
+        return samples[int(float64(len(samples)-1)*p)]
+    }
+    return at(0.50), at(0.99), samples[len(samples)-1]
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "sort"
+    "strings"
+    "time"
+)
+
+const usage = `usage: onyxctl [flags] <command> [args]
+
+Commands:
+  stats                              Show server statistics
+  config                             Show the server configuration
+  config list                        Show runtime-tunable settings
+  config get <key>                   Show one runtime-tunable setting
+  config set <key> <value>           Change a runtime-tunable setting
+  ban <username> <duration> <reason> Ban an account (0 = permanent)
+  unban <username>                   Remove an account ban
+  kick <username> [reason]           Disconnect a user
+  unlock <username>                  Reset an account's IP suspicion
+  broadcast <message>                Send a notice to every user
+
+Flags:
+`
+
+type client struct {
+    baseURL string
+    apiKey  string
+    raw     bool
+    http    *http.Client
+}
+
+func main() {
+    apiURL := flag.String("url", envOr("ONYXCTL_URL", "http://127.0.0.1:8082"), "Admin API base URL (env ONYXCTL_URL)")
+    apiKey := flag.String("key", os.Getenv("ONYXCTL_API_KEY"), "Admin API key (env ONYXCTL_API_KEY)")
+    raw := flag.Bool("json", false, "Print the API's JSON response instead of text")
+    timeout := flag.Duration("timeout", 10*time.Second, "Request timeout")
+    flag.Usage = func() {
+        fmt.Fprint(os.Stderr, usage)
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if flag.NArg() == 0 {
+        flag.Usage()
+        os.Exit(2)
+    }
+
+    if *apiKey == "" {
+        fmt.Fprintln(os.Stderr, "onyxctl: no API key; set -key or ONYXCTL_API_KEY")
+        os.Exit(2)
+    }
+
+    c := &client{
+        baseURL: strings.TrimRight(*apiURL, "/"),
+        apiKey:  *apiKey,
+        raw:     *raw,
+        http:    &http.Client{Timeout: *timeout},
+    }
+
+    if err := c.run(flag.Args()); err != nil {
+        fmt.Fprintf(os.Stderr, "onyxctl: %v\n", err)
+        if _, ok := err.(usageError); ok {
+            os.Exit(2)
+        }
+        os.Exit(1)
+    }
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+    return "usage: onyxctl " + string(e)
+}
+
+func (c *client) run(args []string) error {
+    switch args[0] {
+    case "stats":
+        return c.stats()
+    case "config":
+        return c.config(args[1:])
+    case "ban":
+        if len(args) < 4 {
+            return usageError("ban <username> <duration> <reason>")
+        }
+        return c.userAction(args[1], "ban", map[string]string{
+            "duration": args[2],
+            "reason":   strings.Join(args[3:], " "),
+        })
+    case "unban", "unlock":
+        if len(args) != 2 {
+            return usageError(args[0] + " <username>")
+        }
+        return c.userAction(args[1], args[0], nil)
+    case "kick":
+        if len(args) < 2 {
+            return usageError("kick <username> [reason]")
+        }
+        return c.userAction(args[1], "kick", map[string]string{"reason": strings.Join(args[2:], " ")})
+    case "broadcast":
+        if len(args) < 2 {
+            return usageError("broadcast <message>")
+        }
+        return c.action(http.MethodPost, "/api/v1/broadcast", map[string]string{"message": strings.Join(args[1:], " ")})
+    default:
+        return fmt.Errorf("unknown command %q (run onyxctl -h for a list)", args[0])
+    }
+}
+
+func (c *client) stats() error {
+    var stats map[string]interface{}
+    if err := c.do(http.MethodGet, "/api/v1/stats", nil, &stats); err != nil || c.raw {
+        return err
+    }
+
+    printSorted(stats)
+    return nil
+}
+
+func (c *client) config(args []string) error {
+    if len(args) == 0 {
+        var cfg map[string]interface{}
+        if err := c.do(http.MethodGet, "/api/v1/config", nil, &cfg); err != nil || c.raw {
+            return err
+        }
+
+        out, err := json.MarshalIndent(cfg, "", "  ")
+        if err != nil {
+            return err
+        }
+        fmt.Println(string(out))
+        return nil
+    }
+
+    switch args[0] {
+    case "list", "get":
+        if args[0] == "get" && len(args) != 2 {
+            return usageError("config get <key>")
+        }
+
+        var resp struct {
+            Tunables map[string]string `json:"tunables"`
+        }
+        if err := c.do(http.MethodGet, "/api/v1/tunables", nil, &resp); err != nil || c.raw {
+            return err
+        }
+
+        if args[0] == "get" {
+            value, ok := resp.Tunables[args[1]]
+            if !ok {
+                return fmt.Errorf("%s is not a runtime-tunable setting", args[1])
+            }
+            fmt.Println(value)
+            return nil
+        }
+
+        values := make(map[string]interface{}, len(resp.Tunables))
+        for name, value := range resp.Tunables {
+            values[name] = fmt.Sprintf("%q", value)
+        }
+        printSorted(values)
+        return nil
+    case "set":
+        if len(args) < 3 {
+            return usageError("config set <key> <value>")
+        }
+        return c.action(http.MethodPost, "/api/v1/tunables/"+url.PathEscape(args[1]),
+            map[string]string{"value": strings.Join(args[2:], " ")})
+    default:
+        return usageError("config [list|get <key>|set <key> <value>]")
+    }
+}
+
+func (c *client) userAction(username, action string, body interface{}) error {
+    return c.action(http.MethodPost, "/api/v1/users/"+url.PathEscape(username)+"/"+action, body)
+}
+
+// action performs a request that changes state and prints "ok" on success.
+func (c *client) action(method, path string, body interface{}) error {
+    if err := c.do(method, path, body, nil); err != nil || c.raw {
+        return err
+    }
+
+    fmt.Println("ok")
+    return nil
+}
+
+// do sends an authenticated request and decodes the response into out. With
+// -json the response body is copied to stdout instead. Errors carry the
+// message from the API's error field when it has one.
+func (c *client) do(method, path string, body interface{}, out interface{}) error {
+    var reader io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return fmt.Errorf("failed to encode request: %w", err)
+        }
+        reader = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequest(method, c.baseURL+path, reader)
+    if err != nil {
+        return fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("X-API-Key", c.apiKey)
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return fmt.Errorf("request failed: %w", err)
+    }
+    defer resp.Body.Close()
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return fmt.Errorf("failed to read response: %w", err)
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        var apiErr struct {
+            Error string `json:"error"`
+        }
+        if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+            return fmt.Errorf("%s", apiErr.Error)
+        }
+        return fmt.Errorf("server returned %s", resp.Status)
+    }
+
+    if c.raw {
+        _, err := os.Stdout.Write(data)
+        return err
+    }
+
+    if out != nil {
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.UseNumber()
+        if err := decoder.Decode(out); err != nil {
+            return fmt.Errorf("failed to decode response: %w", err)
+        }
+    }
+
+    return nil
+}
+
+func printSorted(values map[string]interface{}) {
+    keys := make([]string, 0, len(values))
+    width := 0
+    for key := range values {
+        keys = append(keys, key)
+        if len(key) > width {
+            width = len(key)
+        }
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        fmt.Printf("%-*s  %v\n", width, key, values[key])
+    }
+}
+
+func envOr(name, fallback string) string {
+    if value := os.Getenv(name); value != "" {
+        return value
+    }
+    return fallback
+}
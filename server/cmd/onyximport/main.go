@@ -0,0 +1,126 @@
+package main
+
+import (
+    "encoding/csv"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/importer"
+)
+
+func main() {
+    configPath := flag.String("config", "configs/server.yaml", "Path to configuration file")
+    format := flag.String("format", "json", "Input format: atheme, anope, csv or json")
+    input := flag.String("input", "", "Path to the services database or export file")
+    tokensPath := flag.String("tokens", "reset_tokens.csv", "Where to write username,reset_token pairs for imported accounts")
+    resetTTL := flag.Duration("reset-ttl", 30*24*time.Hour, "Validity of generated password reset tokens (0 = never expire)")
+    dryRun := flag.Bool("dry-run", false, "Parse and validate without writing to the database")
+    var overrides config.OverrideFlag
+    flag.Var(&overrides, "set", "Override a config field as path=value, e.g. -set database.host=db (repeatable)")
+    flag.Parse()
+
+    if err := config.SetOverrides(overrides); err != nil {
+        log.Fatalf("Failed to load configuration: %v", err)
+    }
+
+    if *input == "" {
+        log.Fatalf("-input is required")
+    }
+
+    file, err := os.Open(*input)
+    if err != nil {
+        log.Fatalf("Failed to open input: %v", err)
+    }
+    defer file.Close()
+
+    dataset, err := importer.Parse(*format, file)
+    if err != nil {
+        log.Fatalf("Failed to parse input: %v", err)
+    }
+
+    log.Printf("Parsed %d users and %d channels from %s", len(dataset.Users), len(dataset.Channels), *input)
+
+    cfg, err := config.Load(*configPath)
+    if err != nil {
+        log.Fatalf("Failed to load configuration: %v", err)
+    }
+
+    db, err := database.NewConnection(cfg.Database)
+    if err != nil {
+        log.Fatalf("Failed to connect to database: %v", err)
+    }
+    defer db.Close()
+
+    if *dryRun {
+        // A dry run writes nothing, migrations included, so it can only
+        // check against a schema that is already current.
+        current, latest, dirty, err := database.SchemaVersion(db)
+        switch {
+        case err != nil:
+            log.Fatalf("Failed to read schema version: %v", err)
+        case dirty > 0:
+            log.Fatalf("Schema migration %d did not finish; repair it before importing", dirty)
+        case current != latest:
+            log.Fatalf("Schema is at version %d, this tool expects %d; apply the migrations first with the server's -migrate up", current, latest)
+        }
+    } else if err := database.RunMigrations(db); err != nil {
+        log.Fatalf("Failed to run migrations: %v", err)
+    }
+
+    authService := auth.NewAuthService(
+        database.NewUserRepository(db),
+        database.NewSecurityRepository(db),
+        database.NewPasswordResetRepository(db),
+        database.NewBotKeyRepository(db),
+        database.NewEmailTokenRepository(db),
+        cfg.Security.PasswordMinLength,
+        cfg.Security.PasswordRequireSpecial,
+    )
+
+    var ttl *time.Duration
+    if *resetTTL > 0 {
+        ttl = resetTTL
+    }
+
+    result, err := importer.NewImporter(db, authService, ttl, *dryRun).Run(dataset)
+    if err != nil {
+        log.Fatalf("Import failed: %v", err)
+    }
+
+    if len(result.ResetTokens) > 0 {
+        if err := writeTokens(*tokensPath, result.ResetTokens); err != nil {
+            log.Fatalf("Failed to write reset tokens: %v", err)
+        }
+        log.Printf("Password reset tokens written to %s", *tokensPath)
+    }
+
+    fmt.Printf("Users:    %d created, %d skipped\n", result.UsersCreated, result.UsersSkipped)
+    fmt.Printf("Channels: %d created, %d skipped\n", result.ChannelsCreated, result.ChannelsSkipped)
+    fmt.Printf("Members:  %d added\n", result.MembersAdded)
+    if *dryRun {
+        fmt.Println("Dry run: no changes were written")
+    }
+}
+
+func writeTokens(path string, tokens []importer.ResetToken) error {
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    writer := csv.NewWriter(file)
+    writer.Write([]string{"username", "reset_token"})
+    for _, token := range tokens {
+        writer.Write([]string{token.Username, token.Token})
+    }
+    writer.Flush()
+
+    return writer.Error()
+}
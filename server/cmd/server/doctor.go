@@ -0,0 +1,288 @@
+package main
+
+import (
+    "crypto/tls"
+    "fmt"
+    "net"
+    "os"
+    "path/filepath"
+    "runtime"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+)
+
+// doctor collects the results of -doctor. Every check runs even after a
+// failure, so one pass lists everything a new deployment needs to fix.
+type doctor struct {
+    failures int
+    warnings int
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+    fmt.Printf("ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(hint, format string, args ...interface{}) {
+    d.warnings++
+    fmt.Printf("WARN  %s\n", fmt.Sprintf(format, args...))
+    if hint != "" {
+        fmt.Printf("      -> %s\n", hint)
+    }
+}
+
+func (d *doctor) fail(hint, format string, args ...interface{}) {
+    d.failures++
+    fmt.Printf("FAIL  %s\n", fmt.Sprintf(format, args...))
+    if hint != "" {
+        fmt.Printf("      -> %s\n", hint)
+    }
+}
+
+// runDoctor checks that the server could start with the configuration at
+// configPath: the config itself, the database and its schema, the key files
+// and the ports it would listen on. It changes nothing; keys that would be
+// generated at startup are reported rather than created. It returns false
+// if any check failed.
+func runDoctor(configPath string) bool {
+    d := &doctor{}
+
+    cfg, err := config.Load(configPath)
+    if err != nil {
+        d.fail("fix the file and run -doctor again; the remaining checks need a valid config", "%v", err)
+        return d.summary()
+    }
+    if cfg.Profile != "" {
+        d.ok("configuration %s is valid with profile %s", configPath, cfg.Profile)
+    } else {
+        d.ok("configuration %s is valid", configPath)
+    }
+
+    d.checkDatabase(cfg)
+    d.checkKeys(cfg)
+    d.checkPorts(cfg)
+
+    return d.summary()
+}
+
+func (d *doctor) summary() bool {
+    fmt.Printf("%d failed, %d warnings\n", d.failures, d.warnings)
+    return d.failures == 0
+}
+
+func (d *doctor) checkDatabase(cfg *config.Config) {
+    // Connect with storage encryption off so a missing key file is not
+    // generated; checkKeys looks at the keys.
+    dbConfig := cfg.Database
+    dbConfig.EncryptionKey, dbConfig.EncryptionKeyPath = "", ""
+    dbConfig.PreviousEncryptionKey, dbConfig.PreviousEncryptionKeyPath = "", ""
+
+    db, err := database.NewConnection(dbConfig)
+    if err != nil {
+        d.fail(databaseHint(cfg.Database), "database: %v", err)
+        return
+    }
+    defer db.Close()
+    d.ok("connected to %s database", db.Dialect())
+
+    if stats := db.ReplicaStats(); stats.Configured > 0 {
+        if stats.Healthy < stats.Configured {
+            d.warn("check the read_replicas DSNs and that the replicas accept connections; reads use the primary meanwhile",
+                "%d of %d read replicas reachable", stats.Healthy, stats.Configured)
+        } else {
+            d.ok("%d read replicas reachable", stats.Configured)
+        }
+    }
+
+    current, latest, dirty, err := database.SchemaVersion(db)
+    switch {
+    case err != nil:
+        d.warn("a new database has no schema yet; it is created at first start or with -migrate up", "schema: %v", err)
+    case dirty > 0:
+        d.fail(fmt.Sprintf("repair the schema by hand, then run -migrate force %d (or %d if its changes were undone)", dirty, dirty-1),
+            "schema: migration %d did not finish", dirty)
+    case current > latest:
+        d.fail("upgrade this server binary to the version that migrated the database",
+            "schema is at version %d, newer than this server's %d", current, latest)
+    case current < latest:
+        d.warn("pending migrations are applied at startup; see -migrate status",
+            "schema is at version %d of %d", current, latest)
+    default:
+        d.ok("schema is at version %d", current)
+    }
+}
+
+func databaseHint(cfg config.DatabaseConfig) string {
+    switch cfg.Driver {
+    case "sqlite", "sqlite3":
+        return "check that the directory of database.path exists and is writable, and that the binary was built with -tags sqlite"
+    default:
+        return fmt.Sprintf("check that the database server is running at %s:%d and that user %s can log in to %s",
+            cfg.Host, cfg.Port, cfg.User, cfg.Name)
+    }
+}
+
+func (d *doctor) checkKeys(cfg *config.Config) {
+    sec := cfg.Security
+
+    if d.keyFile("RSA private key", sec.RSAPrivateKeyPath, true) {
+        if _, err := auth.LoadPrivateKeyFromFile(sec.RSAPrivateKeyPath); err != nil {
+            d.fail("the server would replace it with a new key pair at startup; restore it from a backup or delete both key files",
+                "RSA private key %s: %v", sec.RSAPrivateKeyPath, err)
+        } else if _, err := auth.LoadPublicKeyFromFile(sec.RSAPublicKeyPath); err != nil {
+            d.fail("restore the public key that belongs to the private key, or delete both to generate a new pair",
+                "RSA public key %s: %v", sec.RSAPublicKeyPath, err)
+        } else {
+            d.ok("RSA key pair %s parses", sec.RSAPrivateKeyPath)
+        }
+    }
+
+    if sec.MessageSigningKeyPath != "" && d.keyFile("message signing key", sec.MessageSigningKeyPath, true) {
+        if _, err := auth.LoadMessageSigner(sec.MessageSigningKeyPath); err != nil {
+            d.fail("restore the key from a backup; transcripts signed with it cannot be verified against a new one",
+                "message signing key %s: %v", sec.MessageSigningKeyPath, err)
+        } else {
+            d.ok("message signing key %s parses", sec.MessageSigningKeyPath)
+        }
+    }
+
+    if sec.IdentityKeyPath != "" && d.keyFile("identity key", sec.IdentityKeyPath, true) {
+        if _, err := auth.LoadIdentity(sec.IdentityKeyPath); err != nil {
+            d.fail("restore the key from a backup; clients that pinned it will warn about a changed key",
+                "identity key %s: %v", sec.IdentityKeyPath, err)
+        } else {
+            d.ok("identity key %s parses", sec.IdentityKeyPath)
+        }
+    }
+
+    if sec.PreviousIdentityKeyPath != "" && d.keyFile("previous identity key", sec.PreviousIdentityKeyPath, false) {
+        if _, err := auth.LoadIdentity(sec.PreviousIdentityKeyPath); err != nil {
+            d.fail("point previous_identity_key_path at the retired identity key", "previous identity key %s: %v", sec.PreviousIdentityKeyPath, err)
+        } else {
+            d.ok("previous identity key %s parses", sec.PreviousIdentityKeyPath)
+        }
+    }
+
+    dbConfig := cfg.Database
+    if dbConfig.EncryptionKeyPath != "" {
+        d.keyFile("storage key", dbConfig.EncryptionKeyPath, true)
+    }
+    if dbConfig.PreviousEncryptionKeyPath != "" {
+        d.keyFile("previous storage key", dbConfig.PreviousEncryptionKeyPath, false)
+    }
+    if dbConfig.EncryptionKey != "" || dbConfig.EncryptionKeyPath != "" {
+        if _, err := database.CheckStorageKeys(dbConfig); err != nil {
+            d.fail("a storage key is 32 random bytes, base64-encoded; without the right key stored messages cannot be read",
+                "storage key: %v", err)
+        } else {
+            d.ok("storage keys parse")
+        }
+    }
+
+    for _, listener := range listeners(cfg) {
+        if !listener.TLS {
+            continue
+        }
+        d.keyFile(fmt.Sprintf("TLS key of listener %s", listener.Name), listener.TLSKey, false)
+        if _, err := tls.LoadX509KeyPair(listener.TLSCert, listener.TLSKey); err != nil {
+            d.fail("tls_cert must be a PEM certificate chain and tls_key its PEM private key",
+                "TLS certificate of listener %s: %v", listener.Name, err)
+        } else {
+            d.ok("TLS certificate of listener %s loads", listener.Name)
+        }
+    }
+}
+
+// keyFile checks that a private key file exists and is readable only by its
+// owner. It reports whether the file is there to be parsed; a missing key
+// the server generates at startup is only a warning if its directory is
+// writable.
+func (d *doctor) keyFile(name, path string, generated bool) bool {
+    info, err := os.Stat(path)
+    if os.IsNotExist(err) {
+        if !generated {
+            d.fail("check the path in the config", "%s %s does not exist", name, path)
+            return false
+        }
+        if dirErr := writableDir(filepath.Dir(path)); dirErr != nil {
+            d.fail("create the directory or make it writable by the server user", "%s %s cannot be generated: %v", name, path, dirErr)
+        } else {
+            d.warn("", "%s %s does not exist and will be generated at startup", name, path)
+        }
+        return false
+    }
+    if err != nil {
+        d.fail("check the path and its permissions", "%s %s: %v", name, path, err)
+        return false
+    }
+
+    if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+        d.warn(fmt.Sprintf("run chmod 600 %s", path), "%s %s is readable by other users (mode %04o)", name, path, info.Mode().Perm())
+    }
+    return true
+}
+
+func writableDir(dir string) error {
+    info, err := os.Stat(dir)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("%s is not a directory", dir)
+    }
+
+    file, err := os.CreateTemp(dir, ".onyx-doctor-*")
+    if err != nil {
+        return err
+    }
+    file.Close()
+    os.Remove(file.Name())
+    return nil
+}
+
+// listeners returns the IRC listeners of the base network and every tenant.
+func listeners(cfg *config.Config) []config.ListenerConfig {
+    all := append([]config.ListenerConfig{}, cfg.Server.ListenerConfigs()...)
+    for _, tenant := range cfg.Tenants {
+        all = append(all, tenant.Listeners...)
+    }
+    return all
+}
+
+func (d *doctor) checkPorts(cfg *config.Config) {
+    for _, listener := range listeners(cfg) {
+        d.port(fmt.Sprintf("listener %s", listener.Name), listener.Address())
+    }
+    if len(cfg.Links.Peers) > 0 && cfg.Links.Listen.Port > 0 {
+        d.port("links listener", cfg.Links.Listen.Address())
+    }
+    if cfg.API.Listen != "" {
+        d.port("API", cfg.API.Listen)
+    }
+    if cfg.Export.HTTPListen != "" {
+        d.port("export HTTP", cfg.Export.HTTPListen)
+    }
+
+    if path := cfg.Server.AdminSocket; path != "" {
+        if conn, err := net.Dial("unix", path); err == nil {
+            conn.Close()
+            d.fail("stop the running server first", "admin socket %s is in use by a running server", path)
+        } else if err := writableDir(filepath.Dir(path)); err != nil {
+            d.fail("create the directory or make it writable by the server user", "admin socket %s cannot be created: %v", path, err)
+        } else {
+            d.ok("admin socket %s is available", path)
+        }
+    }
+}
+
+func (d *doctor) port(name, address string) {
+    listener, err := net.Listen("tcp", address)
+    if err != nil {
+        d.fail("stop whatever is using the port or change it in the config; ports below 1024 need root or CAP_NET_BIND_SERVICE",
+            "%s cannot listen on %s: %v", name, address, err)
+        return
+    }
+    listener.Close()
+    d.ok("%s can listen on %s", name, address)
+}
@@ -9,50 +9,225 @@ import (
     "syscall"
 
     "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/console"
     "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
     "github.com/onyxirc/server/internal/server"
 )
 
 func main() {
     
     configPath := flag.String("config", "configs/server.yaml", "Path to configuration file")
+    reindex := flag.Bool("reindex", false, "Rebuild the message search index from the database and exit")
+    consoleEnabled := flag.Bool("console", true, "Read admin commands from stdin when it is a terminal")
+    benchmark := flag.Bool("benchmark", false, "Run the fan-out throughput benchmark (no database, no crypto) and exit")
+    benchClients := flag.Int("bench-clients", 500, "Benchmark: number of synthetic clients")
+    benchChannels := flag.Int("bench-channels", 10, "Benchmark: number of channels clients are spread across")
+    benchSenders := flag.Int("bench-senders", 10, "Benchmark: number of concurrent senders")
+    benchMessages := flag.Int("bench-messages", 10000, "Benchmark: total messages to send")
+    benchMaxP99 := flag.Duration("bench-max-p99", 0, "Benchmark: fail if p99 delivery latency exceeds this (0 = no limit)")
+    benchMinRate := flag.Float64("bench-min-rate", 0, "Benchmark: fail if deliveries/sec falls below this (0 = no limit)")
+    verifyTranscript := flag.String("verify-transcript", "", "Check the message signatures of a JSON export and exit")
+    signingKey := flag.String("signing-key", "", "Public signing key for -verify-transcript (default: the key in the transcript)")
+    migrate := flag.String("migrate", "", "Manage the database schema and exit: status, up [version], down [version] or force <version>")
+    reencrypt := flag.Bool("reencrypt-storage", false, "Re-encrypt stored message content with the current storage key and exit")
+    var overrides config.OverrideFlag
+    flag.Var(&overrides, "set", "Override a config field as path=value, e.g. -set server.port=6697 (repeatable; wins over ONYX_* variables and the file)")
+    profile := flag.String("profile", "", "Config profile to overlay on the base settings, e.g. prod (default: ONYX_PROFILE or the profile key in the file)")
+    doctorMode := flag.Bool("doctor", false, "Check the configuration, database, key files and ports without starting the server, and exit")
     flag.Parse()
 
+    if *profile != "" {
+        overrides = append(overrides, "profile="+*profile)
+    }
+    if err := config.SetOverrides(overrides); err != nil {
+        log.Fatalf("Failed to load configuration: %v", err)
+    }
+
+    if *doctorMode {
+        if !runDoctor(*configPath) {
+            os.Exit(1)
+        }
+        return
+    }
+
+    if *verifyTranscript != "" {
+        file, err := os.Open(*verifyTranscript)
+        if err != nil {
+            log.Fatalf("Failed to open transcript: %v", err)
+        }
+        defer file.Close()
+
+        report, err := export.Verify(file, *signingKey)
+        if err != nil {
+            log.Fatalf("Verification failed: %v", err)
+        }
+
+        fmt.Printf("%d verified, %d unsigned, %d failed\n", report.Verified, report.Unsigned, len(report.Failed))
+        for _, seq := range report.Failed {
+            fmt.Printf("FAIL: message seq %d\n", seq)
+        }
+        if len(report.Failed) > 0 {
+            os.Exit(1)
+        }
+        return
+    }
+
     cfg, err := config.Load(*configPath)
     if err != nil {
         log.Fatalf("Failed to load configuration: %v", err)
     }
 
+    if *benchmark {
+        report, err := server.RunBenchmark(cfg, server.BenchmarkOptions{
+            Clients:  *benchClients,
+            Channels: *benchChannels,
+            Senders:  *benchSenders,
+            Messages: *benchMessages,
+        })
+        if err != nil {
+            log.Fatalf("Benchmark failed: %v", err)
+        }
+
+        fmt.Print(report)
+
+        if *benchMaxP99 > 0 && report.P99Latency > *benchMaxP99 {
+            fmt.Printf("FAIL: p99 latency %s exceeds %s\n", report.P99Latency, *benchMaxP99)
+            os.Exit(1)
+        }
+        if *benchMinRate > 0 && report.DeliveriesPerSec < *benchMinRate {
+            fmt.Printf("FAIL: %.0f deliveries/sec below %.0f\n", report.DeliveriesPerSec, *benchMinRate)
+            os.Exit(1)
+        }
+        return
+    }
+
     db, err := database.NewConnection(cfg.Database)
     if err != nil {
         log.Fatalf("Failed to connect to database: %v", err)
     }
     defer db.Close()
 
+    if *migrate != "" {
+        if err := runMigrate(db, *migrate, flag.Args()); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+        return
+    }
+
     if err := database.RunMigrations(db); err != nil {
         log.Fatalf("Failed to run migrations: %v", err)
     }
 
+    if storage := db.StorageCipher(); storage != nil {
+        log.Printf("Storage encryption enabled with key %s", storage.KeyID())
+    }
+
+    if *reencrypt {
+        results, err := database.ReencryptStorage(db)
+        for _, result := range results {
+            fmt.Printf("%s: %d rows, %d re-encrypted with key %s\n", result.Table, result.Scanned, result.Rewritten, db.StorageCipher().KeyID())
+        }
+        if err != nil {
+            log.Fatalf("Re-encryption failed: %v", err)
+        }
+        return
+    }
+
     ircServer, err := server.New(cfg, db)
     if err != nil {
         log.Fatalf("Failed to create server: %v", err)
     }
 
-    go func() {
-        log.Printf("Starting OnyxIRC server on %s:%d", cfg.Server.Host, cfg.Server.Port)
-        if err := ircServer.Start(); err != nil {
-            log.Fatalf("Server error: %v", err)
+    tenants := map[string]*server.Server{database.DefaultTenant: ircServer}
+    tenantIDs := []string{database.DefaultTenant}
+    for _, tenant := range cfg.Tenants {
+        tenantCfg, err := cfg.ForTenant(tenant)
+        if err != nil {
+            log.Fatalf("Failed to load configuration: %v", err)
+        }
+
+        tenantServer, err := server.New(tenantCfg, db.ForTenant(tenant.ID))
+        if err != nil {
+            log.Fatalf("Failed to create server for tenant %s: %v", tenant.ID, err)
+        }
+
+        tenants[tenant.ID] = tenantServer
+        tenantIDs = append(tenantIDs, tenant.ID)
+    }
+
+    if *reindex {
+        for _, id := range tenantIDs {
+            indexed, err := tenants[id].RebuildSearchIndex()
+            if err != nil {
+                log.Fatalf("Failed to rebuild search index for tenant %s: %v", id, err)
+            }
+            if err := tenants[id].CloseSearchIndex(); err != nil {
+                log.Fatalf("Failed to close search index for tenant %s: %v", id, err)
+            }
+            fmt.Printf("Indexed %d messages for tenant %s\n", indexed, id)
         }
-    }()
+        return
+    }
+
+    for _, id := range tenantIDs {
+        id, tenantServer := id, tenants[id]
+        go func() {
+            log.Printf("Starting OnyxIRC server for tenant %s", id)
+            if err := tenantServer.Start(); err != nil {
+                log.Fatalf("Server error (tenant %s): %v", id, err)
+            }
+        }()
+    }
 
     quit := make(chan os.Signal, 1)
     signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-    <-quit
+
+    stop := func() {
+        select {
+        case quit <- syscall.SIGTERM:
+        default:
+        }
+    }
+
+    var serverConsole *server.Console
+    if *consoleEnabled && console.IsTerminal(os.Stdin) {
+        serverConsole = server.NewConsole(ircServer, os.Stdin, os.Stdout, *configPath, stop)
+        go serverConsole.Run()
+    }
+
+    var adminSocket *server.AdminSocket
+    if cfg.Server.AdminSocket != "" {
+        mode, _ := cfg.Server.AdminSocketPerm()
+        adminSocket, err = server.NewAdminSocket(ircServer, cfg.Server.AdminSocket, mode, *configPath, stop)
+        if err != nil {
+            log.Fatalf("Failed to start admin socket: %v", err)
+        }
+        adminSocket.Start()
+    }
+
+    exitCode := server.ExitShutdown
+    select {
+    case <-quit:
+    case exitCode = <-ircServer.StopRequests():
+    }
 
     log.Println("Shutting down server...")
-    if err := ircServer.Shutdown(); err != nil {
-        log.Printf("Error during shutdown: %v", err)
+    for i := len(tenantIDs) - 1; i >= 0; i-- {
+        id := tenantIDs[i]
+        if err := tenants[id].Shutdown(); err != nil {
+            log.Printf("Error during shutdown of tenant %s: %v", id, err)
+        }
+    }
+
+    if serverConsole != nil {
+        serverConsole.Close()
+    }
+
+    if adminSocket != nil {
+        adminSocket.Close()
     }
 
     fmt.Println("Server stopped successfully")
+    os.Exit(exitCode)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+// runMigrate carries out -migrate: status lists the migrations, up applies
+// pending ones (up to a version, if given), down reverts to a version (by
+// default, the last migration only) and force records a version as cleanly
+// applied after a failed migration has been repaired by hand.
+func runMigrate(db *database.DB, command string, args []string) error {
+    version := -1
+    if len(args) > 0 {
+        v, err := strconv.Atoi(args[0])
+        if err != nil || v < 0 {
+            return fmt.Errorf("invalid migration version: %s", args[0])
+        }
+        version = v
+    }
+
+    switch command {
+    case "status":
+        return printMigrationStatus(db)
+    case "up":
+        if version < 0 {
+            version = 0
+        }
+        applied, err := database.MigrateUp(db, version)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("Applied %d migrations\n", applied)
+    case "down":
+        if version < 0 {
+            states, err := database.MigrationStatus(db)
+            if err != nil {
+                return err
+            }
+            version = currentVersion(states) - 1
+        }
+        reverted, err := database.MigrateDown(db, version)
+        if err != nil {
+            return err
+        }
+        fmt.Printf("Reverted %d migrations\n", reverted)
+    case "force":
+        if version < 0 {
+            return fmt.Errorf("usage: -migrate force <version>")
+        }
+        if err := database.ForceVersion(db, version); err != nil {
+            return err
+        }
+        fmt.Printf("Schema recorded at version %d\n", version)
+    default:
+        return fmt.Errorf("unknown -migrate command %q; use status, up [version], down [version] or force <version>", command)
+    }
+
+    return nil
+}
+
+func printMigrationStatus(db *database.DB) error {
+    states, err := database.MigrationStatus(db)
+    if err != nil {
+        return err
+    }
+
+    for _, state := range states {
+        status := "pending"
+        applied := ""
+        if state.Applied {
+            status = "applied"
+            if state.AppliedAt != nil {
+                applied = state.AppliedAt.Format(time.RFC3339)
+            }
+        }
+        if state.Dirty {
+            status = "DIRTY"
+        }
+
+        note := ""
+        if !state.Reversible() {
+            note = " (irreversible)"
+        }
+
+        fmt.Printf("%4d  %-8s %-25s %s%s\n", state.Version, status, applied, state.Description, note)
+    }
+
+    fmt.Printf("Schema version %d of %d\n", currentVersion(states), len(states))
+    return nil
+}
+
+func currentVersion(states []database.MigrationState) int {
+    current := 0
+    for _, state := range states {
+        if state.Applied {
+            current = state.Version
+        }
+    }
+    return current
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/models"
+)
+
+// Bot is a bot account as listed by ADMIN bot list.
+type Bot struct {
+    *models.User
+    KeyLastUsed *time.Time
+}
+
+// CreateBot creates a bot account and returns it with its first API key.
+// The key is only ever shown here and by RotateBotKey.
+func (s *AdminService) CreateBot(adminID int64, username string) (*models.User, string, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, "", err
+    }
+
+    if err := auth.ValidateUsername(username); err != nil {
+        return nil, "", err
+    }
+
+    exists, err := s.userRepo.UsernameExists(username)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to check username: %w", err)
+    }
+    if exists {
+        return nil, "", auth.ErrUsernameTaken
+    }
+
+    user, err := s.userRepo.CreateBot(username)
+    if err != nil {
+        return nil, "", err
+    }
+
+    key, err := s.issueBotKey(adminID, user)
+    if err != nil {
+        return nil, "", err
+    }
+
+    s.logAction(adminID, "bot_create", &user.UserID, nil, fmt.Sprintf("Created bot %s", username))
+
+    return user, key, nil
+}
+
+// RotateBotKey replaces a bot's API key. The old key stops working at
+// once, though sessions it already opened stay up.
+func (s *AdminService) RotateBotKey(adminID int64, username string) (*models.User, string, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, "", err
+    }
+
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, "", fmt.Errorf("user not found: %s", username)
+    }
+    if !user.IsBot {
+        return nil, "", fmt.Errorf("%s is not a bot", username)
+    }
+
+    key, err := s.issueBotKey(adminID, user)
+    if err != nil {
+        return nil, "", err
+    }
+
+    s.logAction(adminID, "bot_key", &user.UserID, nil, fmt.Sprintf("Issued a new API key for bot %s", username))
+
+    return user, key, nil
+}
+
+func (s *AdminService) issueBotKey(adminID int64, user *models.User) (string, error) {
+    key, keyHash, err := auth.GenerateBotKey()
+    if err != nil {
+        return "", err
+    }
+
+    if err := s.botKeyRepo.Replace(user.UserID, keyHash, adminID); err != nil {
+        return "", err
+    }
+
+    return key, nil
+}
+
+func (s *AdminService) ListBots(adminID int64) ([]*Bot, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    users, err := s.userRepo.ListBots()
+    if err != nil {
+        return nil, err
+    }
+
+    bots := make([]*Bot, 0, len(users))
+    for _, user := range users {
+        lastUsed, err := s.botKeyRepo.LastUsed(user.UserID)
+        if err != nil {
+            return nil, err
+        }
+        bots = append(bots, &Bot{User: user, KeyLastUsed: lastUsed})
+    }
+
+    return bots, nil
+}
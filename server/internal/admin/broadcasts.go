@@ -0,0 +1,87 @@
+package admin
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+// MinBroadcastInterval keeps a repeating broadcast from flooding users.
+const MinBroadcastInterval = 5 * time.Minute
+
+// ScheduleBroadcast stores a broadcast to go out at runAt and, if interval
+// is not zero, every interval after that.
+func (s *AdminService) ScheduleBroadcast(adminID int64, message string, runAt time.Time, interval time.Duration) (int64, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return 0, err
+    }
+
+    if !runAt.After(time.Now()) {
+        return 0, fmt.Errorf("broadcast time %s is in the past", runAt.Format(time.RFC3339))
+    }
+    if interval != 0 && interval < MinBroadcastInterval {
+        return 0, fmt.Errorf("broadcast interval must be at least %s", MinBroadcastInterval)
+    }
+
+    broadcastID, err := s.broadcastRepo.Create(adminID, message, runAt, interval)
+    if err != nil {
+        return 0, err
+    }
+
+    details := fmt.Sprintf("Scheduled broadcast %d for %s", broadcastID, runAt.Format(time.RFC3339))
+    if interval > 0 {
+        details += fmt.Sprintf(", every %s", FormatDuration(int(interval/time.Second)))
+    }
+    s.logAction(adminID, "broadcast_schedule", nil, nil, details+": "+message)
+
+    return broadcastID, nil
+}
+
+func (s *AdminService) ListScheduledBroadcasts(adminID int64) ([]*models.ScheduledBroadcast, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.broadcastRepo.List(time.Time{})
+}
+
+func (s *AdminService) CancelScheduledBroadcast(adminID, broadcastID int64) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    deleted, err := s.broadcastRepo.Delete(broadcastID)
+    if err != nil {
+        return err
+    }
+    if !deleted {
+        return fmt.Errorf("no scheduled broadcast %d", broadcastID)
+    }
+
+    s.logAction(adminID, "broadcast_cancel", nil, nil, fmt.Sprintf("Cancelled scheduled broadcast %d", broadcastID))
+
+    return nil
+}
+
+// DueBroadcasts returns the scheduled broadcasts whose time has come. It is
+// for the server's scheduler and needs no admin.
+func (s *AdminService) DueBroadcasts() ([]*models.ScheduledBroadcast, error) {
+    return s.broadcastRepo.List(time.Now())
+}
+
+// ClaimBroadcast takes the current run of a due broadcast, so that only one
+// node of a cluster sends it, and schedules the next run of a repeating
+// one. Runs missed while no server was up are skipped, not sent late in a
+// burst.
+func (s *AdminService) ClaimBroadcast(broadcast *models.ScheduledBroadcast) (bool, error) {
+    next := broadcast.NextRunAt
+    if broadcast.Interval > 0 {
+        now := time.Now()
+        for !next.After(now) {
+            next = next.Add(broadcast.Interval)
+        }
+    }
+
+    return s.broadcastRepo.Claim(broadcast, next)
+}
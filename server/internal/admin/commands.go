@@ -2,24 +2,76 @@ package admin
 
 import (
     "fmt"
+    "log"
+    "math"
     "strconv"
+    "strings"
     "time"
 
     "github.com/onyxirc/server/internal/database"
     "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/security"
+    "github.com/onyxirc/server/internal/threadpool"
 )
 
 type AdminService struct {
     userRepo     *database.UserRepository
     adminRepo    *database.AdminRepository
     securityRepo *database.SecurityRepository
+    channelRepo  *database.ChannelRepository
+    killRepo     *database.KillRepository
+    ipBanRepo    *database.IPBanRepository
+    evasionRepo  *database.EvasionRepository
+    observerRepo *database.ObserverRepository
+    twoFactorRepo *database.TwoFactorRepository
+    botKeyRepo   *database.BotKeyRepository
+    filterRepo   *database.FilterRepository
+    reportRepo   *database.ReportRepository
+    broadcastRepo *database.BroadcastRepository
+    executor     Executor
 }
 
-func NewAdminService(userRepo *database.UserRepository, adminRepo *database.AdminRepository, securityRepo *database.SecurityRepository) *AdminService {
+// Executor runs background work such as admin log writes;
+// *threadpool.WorkerPool satisfies it.
+type Executor interface {
+    SubmitPriority(id string, priority int, task func() error) error
+}
+
+func NewAdminService(userRepo *database.UserRepository, adminRepo *database.AdminRepository, securityRepo *database.SecurityRepository, channelRepo *database.ChannelRepository, killRepo *database.KillRepository, ipBanRepo *database.IPBanRepository, evasionRepo *database.EvasionRepository, observerRepo *database.ObserverRepository, twoFactorRepo *database.TwoFactorRepository, botKeyRepo *database.BotKeyRepository, filterRepo *database.FilterRepository, reportRepo *database.ReportRepository, broadcastRepo *database.BroadcastRepository) *AdminService {
     return &AdminService{
         userRepo:     userRepo,
         adminRepo:    adminRepo,
         securityRepo: securityRepo,
+        channelRepo:  channelRepo,
+        killRepo:     killRepo,
+        ipBanRepo:    ipBanRepo,
+        evasionRepo:  evasionRepo,
+        observerRepo: observerRepo,
+        twoFactorRepo: twoFactorRepo,
+        botKeyRepo:   botKeyRepo,
+        filterRepo:   filterRepo,
+        reportRepo:   reportRepo,
+        broadcastRepo: broadcastRepo,
+    }
+}
+
+func (s *AdminService) SetExecutor(executor Executor) {
+    s.executor = executor
+}
+
+// logAction writes to the admin action log off the caller's goroutine when an
+// executor is set, falling back to a direct write if it cannot take the job.
+func (s *AdminService) logAction(adminID int64, actionType string, targetUserID, targetChannelID *int64, details string) {
+    task := func() error {
+        return s.adminRepo.LogAction(adminID, actionType, targetUserID, targetChannelID, details)
+    }
+
+    if s.executor != nil && s.executor.SubmitPriority("admin-log-"+actionType, threadpool.PriorityHigh, task) == nil {
+        return
+    }
+
+    if err := task(); err != nil {
+        log.Printf("Warning: %v", err)
     }
 }
 
@@ -47,12 +99,16 @@ func (s *AdminService) MakeAdmin(adminID, targetUserID int64) error {
         return err
     }
 
+    if target, err := s.userRepo.GetByID(targetUserID); err == nil && target.IsBot {
+        return fmt.Errorf("%s is a bot and cannot be an admin", target.Username)
+    }
+
     if err := s.userRepo.SetAdminStatus(targetUserID, true); err != nil {
         return fmt.Errorf("failed to grant admin privileges: %w", err)
     }
 
     details := fmt.Sprintf("Granted admin privileges to user ID %d", targetUserID)
-    s.adminRepo.LogAction(adminID, "makeadmin", &targetUserID, nil, details)
+    s.logAction(adminID, "makeadmin", &targetUserID, nil, details)
 
     return nil
 }
@@ -71,7 +127,7 @@ func (s *AdminService) RemoveAdmin(adminID, targetUserID int64) error {
     }
 
     details := fmt.Sprintf("Revoked admin privileges from user ID %d", targetUserID)
-    s.adminRepo.LogAction(adminID, "removeadmin", &targetUserID, nil, details)
+    s.logAction(adminID, "removeadmin", &targetUserID, nil, details)
 
     return nil
 }
@@ -97,15 +153,11 @@ func (s *AdminService) BanUser(adminID int64, username, reason string, durationS
     }
 
     if err := s.adminRepo.BanUser(targetUser.UserID, adminID, reason, duration); err != nil {
-        return fmt.Errorf("failed to ban user: %w", err)
-    }
-
-    if err := s.userRepo.SetActiveStatus(targetUser.UserID, false); err != nil {
-        return fmt.Errorf("failed to deactivate user: %w", err)
+        return err
     }
 
     details := fmt.Sprintf("Banned user %s (ID %d): %s", username, targetUser.UserID, reason)
-    s.adminRepo.LogAction(adminID, "ban", &targetUser.UserID, nil, details)
+    s.logAction(adminID, "ban", &targetUser.UserID, nil, details)
 
     return nil
 }
@@ -121,19 +173,344 @@ func (s *AdminService) UnbanUser(adminID int64, username string) error {
     }
 
     if err := s.adminRepo.UnbanUser(targetUser.UserID); err != nil {
-        return fmt.Errorf("failed to unban user: %w", err)
+        return err
+    }
+
+    details := fmt.Sprintf("Unbanned user %s (ID %d)", username, targetUser.UserID)
+    s.logAction(adminID, "unban", &targetUser.UserID, nil, details)
+
+    return nil
+}
+
+// ListBans returns the bans still in force, leaving out temporary ones that
+// have run out but not yet been cleared by maintenance.
+func (s *AdminService) ListBans(adminID int64) ([]*models.UserBan, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
     }
 
-    if err := s.userRepo.SetActiveStatus(targetUser.UserID, true); err != nil {
-        return fmt.Errorf("failed to reactivate user: %w", err)
+    bans, err := s.adminRepo.GetActiveBans()
+    if err != nil {
+        return nil, err
     }
 
-    details := fmt.Sprintf("Unbanned user %s (ID %d)", username, targetUser.UserID)
-    s.adminRepo.LogAction(adminID, "unban", &targetUser.UserID, nil, details)
+    now := time.Now()
+    active := bans[:0]
+    for _, ban := range bans {
+        if ban.ExpiresAt == nil || ban.ExpiresAt.After(now) {
+            active = append(active, ban)
+        }
+    }
+
+    return active, nil
+}
+
+func (s *AdminService) BanHistory(adminID int64, username string) (*models.User, []*models.UserBan, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, nil, err
+    }
+
+    targetUser, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, nil, fmt.Errorf("user not found: %w", err)
+    }
+
+    bans, err := s.adminRepo.GetUserBans(targetUser.UserID)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return targetUser, bans, nil
+}
+
+func (s *AdminService) BanIP(adminID int64, cidr, reason string, durationSeconds int) (string, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return "", err
+    }
+
+    network, err := security.ParseCIDR(cidr)
+    if err != nil {
+        return "", err
+    }
+    cidr = network.String()
+
+    var expiresAt *time.Time
+    if durationSeconds > 0 {
+        expiry := time.Now().Add(time.Duration(durationSeconds) * time.Second)
+        expiresAt = &expiry
+    }
+
+    if err := s.ipBanRepo.Create(cidr, adminID, reason, expiresAt); err != nil {
+        return "", err
+    }
+
+    details := fmt.Sprintf("Banned address %s: %s", cidr, reason)
+    s.logAction(adminID, "ipban", nil, nil, details)
+
+    return cidr, nil
+}
+
+func (s *AdminService) UnbanIP(adminID int64, cidr string) (string, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return "", err
+    }
+
+    network, err := security.ParseCIDR(cidr)
+    if err != nil {
+        return "", err
+    }
+    cidr = network.String()
+
+    removed, err := s.ipBanRepo.Deactivate(cidr)
+    if err != nil {
+        return "", err
+    }
+    if removed == 0 {
+        return "", fmt.Errorf("no active ban for %s", cidr)
+    }
+
+    details := fmt.Sprintf("Unbanned address %s", cidr)
+    s.logAction(adminID, "ipunban", nil, nil, details)
+
+    return cidr, nil
+}
+
+func (s *AdminService) ListIPBans(adminID int64) ([]*models.IPBan, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.ipBanRepo.ListActive()
+}
+
+func (s *AdminService) GetLockdown() (string, error) {
+    return s.adminRepo.GetLockdown()
+}
+
+// SetLockdown stores the serialised lockdown state ("" lifts it) and
+// records the change in the admin action log.
+func (s *AdminService) SetLockdown(adminID int64, state, details string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    if err := s.adminRepo.SetLockdown(state, adminID); err != nil {
+        return err
+    }
+
+    actionType := "lockdown"
+    if state == "" {
+        actionType = "unlockdown"
+    }
+    s.logAction(adminID, actionType, nil, nil, details)
 
     return nil
 }
 
+// GetServerConfig reads a raw server_config entry.
+func (s *AdminService) GetServerConfig(adminID int64, key string) (string, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return "", err
+    }
+    return s.adminRepo.GetServerConfig(key)
+}
+
+func (s *AdminService) GetTunables() (map[string]string, error) {
+    return s.adminRepo.GetTunables()
+}
+
+// SetTunable stores a runtime config override and records the change in the
+// admin action log.
+func (s *AdminService) SetTunable(adminID int64, name, value, details string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    if err := s.adminRepo.SetTunable(name, value, adminID); err != nil {
+        return err
+    }
+    s.logAction(adminID, "config_set", nil, nil, details)
+
+    return nil
+}
+
+// EvasionReport lists unreviewed ban evasion flags, or every flag of one
+// account when username is given.
+func (s *AdminService) EvasionReport(adminID int64, username string, limit int) ([]*models.EvasionFlag, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    var userID int64
+    if username != "" {
+        user, err := s.userRepo.GetByUsername(username)
+        if err != nil {
+            return nil, fmt.Errorf("user not found: %s", username)
+        }
+        userID = user.UserID
+    }
+
+    return s.evasionRepo.List(userID, limit)
+}
+
+// ClearEvasion marks the open flags of an account as reviewed, which also
+// lifts an automatic restriction.
+func (s *AdminService) ClearEvasion(adminID int64, username string) (*models.User, int64, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, 0, err
+    }
+
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, 0, fmt.Errorf("user not found: %s", username)
+    }
+
+    cleared, err := s.evasionRepo.Review(user.UserID, adminID)
+    if err != nil {
+        return nil, 0, err
+    }
+    if cleared == 0 {
+        return nil, 0, fmt.Errorf("no open evasion flags for %s", username)
+    }
+
+    s.logAction(adminID, "evasion_clear", &user.UserID, nil, fmt.Sprintf("Cleared %d ban evasion flags for %s", cleared, username))
+
+    return user, cleared, nil
+}
+
+// DisableTwoFactor removes a user's TOTP secret so they can log in with
+// their password alone, e.g. after losing their authenticator.
+func (s *AdminService) DisableTwoFactor(adminID int64, username string) (*models.User, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, fmt.Errorf("user not found: %s", username)
+    }
+
+    removed, err := s.twoFactorRepo.Delete(user.UserID)
+    if err != nil {
+        return nil, err
+    }
+    if !removed {
+        return nil, fmt.Errorf("%s does not have two-factor authentication", username)
+    }
+
+    s.logAction(adminID, "disable_2fa", &user.UserID, nil, fmt.Sprintf("Disabled two-factor authentication for %s", username))
+
+    return user, nil
+}
+
+// AddObserver turns an account into a listen-only observer. Admins and
+// accounts that are channel members cannot be observers.
+func (s *AdminService) AddObserver(adminID int64, username string) (*models.User, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, fmt.Errorf("user not found: %s", username)
+    }
+    if user.IsAdmin {
+        return nil, fmt.Errorf("%s is an admin and cannot be an observer", username)
+    }
+
+    isObserver, err := s.observerRepo.IsObserver(user.UserID)
+    if err != nil {
+        return nil, err
+    }
+    if isObserver {
+        return nil, fmt.Errorf("%s is already an observer", username)
+    }
+
+    channels, err := s.channelRepo.GetUserChannels(user.UserID)
+    if err != nil {
+        return nil, err
+    }
+    if len(channels) > 0 {
+        return nil, fmt.Errorf("%s is a member of %d channels and would stay visible in them", username, len(channels))
+    }
+
+    if err := s.observerRepo.Add(user.UserID, adminID); err != nil {
+        return nil, err
+    }
+
+    s.logAction(adminID, "observer_create", &user.UserID, nil, fmt.Sprintf("Made %s an observer", username))
+
+    return user, nil
+}
+
+func (s *AdminService) AttachObserver(adminID int64, username, channelName string) (*models.User, *models.Channel, error) {
+    user, channel, err := s.observerTarget(adminID, username, channelName)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err := s.observerRepo.Attach(user.UserID, channel.ChannelID, adminID); err != nil {
+        return nil, nil, err
+    }
+
+    s.logAction(adminID, "observer_attach", &user.UserID, &channel.ChannelID, fmt.Sprintf("Attached observer %s to %s", username, channel.ChannelName))
+
+    return user, channel, nil
+}
+
+func (s *AdminService) DetachObserver(adminID int64, username, channelName string) (*models.User, *models.Channel, error) {
+    user, channel, err := s.observerTarget(adminID, username, channelName)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    detached, err := s.observerRepo.Detach(user.UserID, channel.ChannelID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !detached {
+        return nil, nil, fmt.Errorf("%s is not observing %s", username, channel.ChannelName)
+    }
+
+    s.logAction(adminID, "observer_detach", &user.UserID, &channel.ChannelID, fmt.Sprintf("Detached observer %s from %s", username, channel.ChannelName))
+
+    return user, channel, nil
+}
+
+func (s *AdminService) observerTarget(adminID int64, username, channelName string) (*models.User, *models.Channel, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, nil, err
+    }
+
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, nil, fmt.Errorf("user not found: %s", username)
+    }
+
+    isObserver, err := s.observerRepo.IsObserver(user.UserID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !isObserver {
+        return nil, nil, fmt.Errorf("%s is not an observer", username)
+    }
+
+    channel, err := s.channelRepo.GetByName(channelName)
+    if err != nil {
+        return nil, nil, fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    return user, channel, nil
+}
+
+func (s *AdminService) ListObservers(adminID int64) ([]*models.Observer, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.observerRepo.List()
+}
+
 func (s *AdminService) UnlockAccount(adminID int64, username string) error {
     if err := s.RequireAdmin(adminID); err != nil {
         return err
@@ -149,7 +526,78 @@ func (s *AdminService) UnlockAccount(adminID int64, username string) error {
     }
 
     details := fmt.Sprintf("Unlocked account for user %s (ID %d)", username, targetUser.UserID)
-    s.adminRepo.LogAction(adminID, "unlock", &targetUser.UserID, nil, details)
+    s.logAction(adminID, "unlock", &targetUser.UserID, nil, details)
+    if err := s.securityRepo.RecordEvent(models.SecurityEventUnlock, &targetUser.UserID, &adminID, "", ""); err != nil {
+        log.Printf("Warning: %v", err)
+    }
+
+    return nil
+}
+
+func (s *AdminService) ReactivateUser(adminID int64, username string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    targetUser, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return fmt.Errorf("user not found: %w", err)
+    }
+
+    if err := s.userRepo.Reactivate(targetUser.UserID); err != nil {
+        return err
+    }
+
+    details := fmt.Sprintf("Reactivated user %s (ID %d)", username, targetUser.UserID)
+    s.logAction(adminID, "reactivate", &targetUser.UserID, nil, details)
+
+    return nil
+}
+
+func (s *AdminService) ArchiveChannel(adminID int64, channelName string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    channel, err := s.channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %w", err)
+    }
+
+    if channel.IsArchived {
+        return fmt.Errorf("channel %s is already archived", channelName)
+    }
+
+    if err := s.channelRepo.Archive(channel.ChannelID); err != nil {
+        return err
+    }
+
+    details := fmt.Sprintf("Archived channel %s (ID %d)", channelName, channel.ChannelID)
+    s.logAction(adminID, "archivechannel", nil, &channel.ChannelID, details)
+
+    return nil
+}
+
+func (s *AdminService) RestoreChannel(adminID int64, channelName string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    channel, err := s.channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %w", err)
+    }
+
+    if !channel.IsArchived {
+        return fmt.Errorf("channel %s is not archived", channelName)
+    }
+
+    if err := s.channelRepo.Restore(channel.ChannelID); err != nil {
+        return err
+    }
+
+    details := fmt.Sprintf("Restored archived channel %s (ID %d)", channelName, channel.ChannelID)
+    s.logAction(adminID, "restorechannel", nil, &channel.ChannelID, details)
 
     return nil
 }
@@ -169,16 +617,69 @@ func (s *AdminService) KickUser(adminID int64, username, reason string) error {
     }
 
     details := fmt.Sprintf("Kicked user %s (ID %d): %s", username, targetUser.UserID, reason)
-    s.adminRepo.LogAction(adminID, "kick", &targetUser.UserID, nil, details)
+    s.logAction(adminID, "kick", &targetUser.UserID, nil, details)
 
     return nil
 }
 
+// KillSession checks and logs the termination of a single session of
+// target. Sessions of other admins cannot be terminated.
+func (s *AdminService) KillSession(adminID int64, target *models.User, sessionRef string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    if target.IsAdmin && target.UserID != adminID {
+        return fmt.Errorf("cannot terminate another admin's session")
+    }
+
+    details := fmt.Sprintf("Terminated session %s of user %s (ID %d)", sessionRef, target.Username, target.UserID)
+    s.logAction(adminID, "killsession", &target.UserID, nil, details)
+
+    return nil
+}
+
+func (s *AdminService) KillUser(adminID int64, username, reason, ipAddress string) (*models.User, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    targetUser, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, fmt.Errorf("user not found: %w", err)
+    }
+
+    if targetUser.IsAdmin {
+        return nil, fmt.Errorf("cannot kill admin users")
+    }
+
+    if err := s.killRepo.Create(targetUser.UserID, adminID, reason, ipAddress); err != nil {
+        return nil, err
+    }
+
+    details := fmt.Sprintf("Killed user %s (ID %d): %s", username, targetUser.UserID, reason)
+    s.logAction(adminID, "kill", &targetUser.UserID, nil, details)
+
+    return targetUser, nil
+}
+
+func (s *AdminService) RecentKill(userID int64, ipAddress string, cooldown time.Duration) (*models.Kill, error) {
+    if cooldown <= 0 {
+        return nil, nil
+    }
+
+    return s.killRepo.GetRecent(userID, ipAddress, time.Now().Add(-cooldown))
+}
+
 func (s *AdminService) GetServerStats(adminID int64) (map[string]interface{}, error) {
     if err := s.RequireAdmin(adminID); err != nil {
         return nil, err
     }
 
+    return s.Stats(), nil
+}
+
+func (s *AdminService) Stats() map[string]interface{} {
     stats := make(map[string]interface{})
 
     users, err := s.userRepo.List(10000, 0) 
@@ -214,7 +715,15 @@ func (s *AdminService) GetServerStats(adminID int64) (map[string]interface{}, er
         stats["max_ip_suspicion"] = maxSuspicion
     }
 
-    return stats, nil
+    return stats
+}
+
+func (s *AdminService) ListUsers(adminID int64, limit, offset int) ([]*models.User, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.userRepo.List(limit, offset)
 }
 
 func (s *AdminService) GetAdminLog(adminID int64, limit, offset int) ([]*models.AdminActionLog, error) {
@@ -225,31 +734,129 @@ func (s *AdminService) GetAdminLog(adminID int64, limit, offset int) ([]*models.
     return s.adminRepo.GetAdminActionLog(limit, offset)
 }
 
-func (s *AdminService) BroadcastMessage(adminID int64, message string) error {
+func (s *AdminService) SearchAdminLog(adminID int64, filter database.AdminLogFilter) ([]*models.AdminActionLog, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.adminRepo.SearchAdminActionLog(filter)
+}
+
+// RecordAction logs an action carried out outside the admin service, such
+// as by a plugin, after checking that adminID is an admin.
+func (s *AdminService) RecordAction(adminID int64, actionType, details string) error {
     if err := s.RequireAdmin(adminID); err != nil {
         return err
     }
 
-    details := fmt.Sprintf("Broadcast message: %s", message)
-    s.adminRepo.LogAction(adminID, "broadcast", nil, nil, details)
+    s.logAction(adminID, actionType, nil, nil, details)
+
+    return nil
+}
+
+func (s *AdminService) RequestStop(adminID int64, restart bool, delaySeconds int) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    action := "shutdown"
+    if restart {
+        action = "restart"
+    }
+
+    details := fmt.Sprintf("Scheduled %s in %d seconds", action, delaySeconds)
+    s.logAction(adminID, action, nil, nil, details)
 
     return nil
 }
 
+var durationUnits = []struct {
+    suffix  string
+    seconds int
+}{
+    // mo before m, so "1mo" is not read as one minute and a stray "o".
+    {"mo", 30 * 24 * 60 * 60},
+    {"w", 7 * 24 * 60 * 60},
+    {"d", 24 * 60 * 60},
+    {"h", 60 * 60},
+    {"m", 60},
+    {"s", 1},
+}
+
+// ParseDuration reads a duration as plain seconds or as a run of numbers
+// with s, m, h, d, w or mo (30 days) suffixes, such as "1w2d" or "90m".
+// An empty string or "0" means no duration.
 func ParseDuration(durationStr string) (int, error) {
     if durationStr == "" || durationStr == "0" {
-        return 0, nil 
+        return 0, nil
     }
 
     seconds, err := strconv.Atoi(durationStr)
     if err == nil {
+        if seconds < 0 {
+            return 0, fmt.Errorf("invalid duration format: %s", durationStr)
+        }
         return seconds, nil
     }
 
-    duration, err := time.ParseDuration(durationStr)
-    if err != nil {
-        return 0, fmt.Errorf("invalid duration format: %s", durationStr)
+    // Go's own forms, such as "1.5h", are still accepted.
+    if duration, err := time.ParseDuration(durationStr); err == nil && duration >= 0 {
+        return int(duration.Seconds()), nil
+    }
+
+    total := 0
+    rest := durationStr
+    for rest != "" {
+        digits := 0
+        for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+            digits++
+        }
+        if digits == 0 {
+            return 0, fmt.Errorf("invalid duration format: %s", durationStr)
+        }
+        n, err := strconv.Atoi(rest[:digits])
+        if err != nil {
+            return 0, fmt.Errorf("invalid duration format: %s", durationStr)
+        }
+        rest = rest[digits:]
+
+        unit := 0
+        for _, u := range durationUnits {
+            if strings.HasPrefix(rest, u.suffix) {
+                unit = u.seconds
+                rest = rest[len(u.suffix):]
+                break
+            }
+        }
+        if unit == 0 {
+            return 0, fmt.Errorf("invalid duration format: %s", durationStr)
+        }
+        if n > (math.MaxInt32-total)/unit {
+            return 0, fmt.Errorf("duration too long: %s", durationStr)
+        }
+        total += n * unit
+    }
+
+    return total, nil
+}
+
+// FormatDuration is the inverse of ParseDuration, for display: it writes
+// seconds with the largest units first, such as "1w2d3h". Months are left
+// out, as they are not a whole number of weeks.
+func FormatDuration(seconds int) string {
+    if seconds <= 0 {
+        return "0s"
     }
 
-    return int(duration.Seconds()), nil
+    var b strings.Builder
+    for _, u := range durationUnits {
+        if u.suffix == "mo" {
+            continue
+        }
+        if n := seconds / u.seconds; n > 0 {
+            fmt.Fprintf(&b, "%d%s", n, u.suffix)
+            seconds -= n * u.seconds
+        }
+    }
+    return b.String()
 }
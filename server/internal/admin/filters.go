@@ -0,0 +1,67 @@
+package admin
+
+import (
+    "fmt"
+
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/moderation"
+)
+
+// AddFilterRule stores a content filter rule. channelName is empty for a
+// rule that applies to every channel and to direct messages.
+func (s *AdminService) AddFilterRule(adminID int64, channelName string, rule *models.FilterRule) (int64, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return 0, err
+    }
+
+    if err := moderation.Validate(rule); err != nil {
+        return 0, err
+    }
+
+    scope := "global"
+    if channelName != "" {
+        channel, err := s.channelRepo.GetByName(channelName)
+        if err != nil {
+            return 0, fmt.Errorf("channel not found: %s", channelName)
+        }
+        rule.ChannelID = &channel.ChannelID
+        scope = channel.ChannelName
+    }
+    rule.CreatedBy = &adminID
+
+    ruleID, err := s.filterRepo.Create(rule)
+    if err != nil {
+        return 0, err
+    }
+
+    details := fmt.Sprintf("Added %s filter rule %d (%s %s): %s", scope, ruleID, rule.Action, rule.Kind, rule.Pattern)
+    s.logAction(adminID, "filter_add", nil, rule.ChannelID, details)
+
+    return ruleID, nil
+}
+
+func (s *AdminService) DeleteFilterRule(adminID, ruleID int64) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    deleted, err := s.filterRepo.Delete(ruleID)
+    if err != nil {
+        return err
+    }
+    if !deleted {
+        return fmt.Errorf("no filter rule %d", ruleID)
+    }
+
+    s.logAction(adminID, "filter_del", nil, nil, fmt.Sprintf("Deleted filter rule %d", ruleID))
+
+    return nil
+}
+
+func (s *AdminService) ListFilterRules(adminID int64) ([]*models.FilterRule, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    return s.filterRepo.List()
+}
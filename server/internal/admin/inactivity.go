@@ -0,0 +1,151 @@
+package admin
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+)
+
+type InactivityPolicy struct {
+    userRepo    *database.UserRepository
+    channelRepo *database.ChannelRepository
+    config      config.InactivityConfig
+}
+
+type InactivityReport struct {
+    ChannelsNotified    int
+    ChannelsArchived    int
+    AccountsNotified    int
+    AccountsDeactivated int
+}
+
+func NewInactivityPolicy(userRepo *database.UserRepository, channelRepo *database.ChannelRepository, cfg config.InactivityConfig) *InactivityPolicy {
+    return &InactivityPolicy{
+        userRepo:    userRepo,
+        channelRepo: channelRepo,
+        config:      cfg,
+    }
+}
+
+// Sweep archives and deactivates what was warned about a grace period ago,
+// then warns about newly idle channels and accounts. notify returns an error
+// unless the warning was queued where an offline user will still see it;
+// only then does the grace period start.
+func (p *InactivityPolicy) Sweep(notify func(userID int64, message string) error) (*InactivityReport, error) {
+    report := &InactivityReport{}
+    now := time.Now()
+
+    if p.config.ChannelIdleDays > 0 {
+        if err := p.sweepChannels(now, notify, report); err != nil {
+            return report, err
+        }
+    }
+
+    if p.config.AccountIdleMonths > 0 {
+        if err := p.sweepAccounts(now, notify, report); err != nil {
+            return report, err
+        }
+    }
+
+    return report, nil
+}
+
+func (p *InactivityPolicy) sweepChannels(now time.Time, notify func(userID int64, message string) error, report *InactivityReport) error {
+    grace := time.Duration(p.config.ChannelGraceDays) * 24 * time.Hour
+
+    pending, err := p.channelRepo.GetChannelsPendingArchive(now.Add(-grace))
+    if err != nil {
+        return fmt.Errorf("failed to load channels pending archive: %w", err)
+    }
+
+    for _, channel := range pending {
+        if err := p.channelRepo.Archive(channel.ChannelID); err != nil {
+            log.Printf("Failed to archive idle channel %s: %v", channel.ChannelName, err)
+            continue
+        }
+        report.ChannelsArchived++
+        log.Printf("Archived idle channel %s", channel.ChannelName)
+    }
+
+    idle, err := p.channelRepo.GetIdleChannels(now.AddDate(0, 0, -p.config.ChannelIdleDays))
+    if err != nil {
+        return fmt.Errorf("failed to load idle channels: %w", err)
+    }
+
+    for _, channel := range idle {
+        members, err := p.channelRepo.GetMembers(channel.ChannelID)
+        if err != nil {
+            log.Printf("Failed to load owners of idle channel %s: %v", channel.ChannelName, err)
+            continue
+        }
+
+        message := fmt.Sprintf("Channel %s has had no activity for %d days and will be archived in %d days unless it is used",
+            channel.ChannelName, p.config.ChannelIdleDays, p.config.ChannelGraceDays)
+        warned := true
+        for _, member := range members {
+            if member.Role != "owner" {
+                continue
+            }
+            if err := notify(member.UserID, message); err != nil {
+                log.Printf("Failed to warn owner %d of idle channel %s: %v", member.UserID, channel.ChannelName, err)
+                warned = false
+            }
+        }
+        // Left unflagged, the channel is warned about again by the next
+        // sweep rather than archived without every owner having been told.
+        if !warned {
+            continue
+        }
+
+        if err := p.channelRepo.MarkIdleNotified(channel.ChannelID); err != nil {
+            log.Printf("Failed to flag idle channel %s: %v", channel.ChannelName, err)
+            continue
+        }
+        report.ChannelsNotified++
+    }
+
+    return nil
+}
+
+func (p *InactivityPolicy) sweepAccounts(now time.Time, notify func(userID int64, message string) error, report *InactivityReport) error {
+    grace := time.Duration(p.config.AccountGraceDays) * 24 * time.Hour
+
+    pending, err := p.userRepo.GetUsersPendingDeactivation(now.Add(-grace))
+    if err != nil {
+        return fmt.Errorf("failed to load accounts pending deactivation: %w", err)
+    }
+
+    for _, user := range pending {
+        if err := p.userRepo.DeactivateForInactivity(user.UserID); err != nil {
+            log.Printf("Failed to deactivate idle account %s: %v", user.Username, err)
+            continue
+        }
+        report.AccountsDeactivated++
+        log.Printf("Deactivated idle account %s", user.Username)
+    }
+
+    idle, err := p.userRepo.GetIdleUsers(now.AddDate(0, -p.config.AccountIdleMonths, 0))
+    if err != nil {
+        return fmt.Errorf("failed to load idle accounts: %w", err)
+    }
+
+    for _, user := range idle {
+        err := notify(user.UserID, fmt.Sprintf("Your account has not logged in for %d months and will be deactivated in %d days unless you log in",
+            p.config.AccountIdleMonths, p.config.AccountGraceDays))
+        if err != nil {
+            log.Printf("Failed to warn idle account %s: %v", user.Username, err)
+            continue
+        }
+
+        if err := p.userRepo.MarkIdleNotified(user.UserID); err != nil {
+            log.Printf("Failed to flag idle account %s: %v", user.Username, err)
+            continue
+        }
+        report.AccountsNotified++
+    }
+
+    return nil
+}
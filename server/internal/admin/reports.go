@@ -0,0 +1,62 @@
+package admin
+
+import (
+    "fmt"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+// Report statuses.
+const (
+    ReportOpen      = "open"
+    ReportResolved  = "resolved"
+    ReportDismissed = "dismissed"
+)
+
+// ListReports returns reports with status, or all of them when status is
+// empty.
+func (s *AdminService) ListReports(adminID int64, status string, limit int) ([]*models.Report, error) {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return nil, err
+    }
+
+    switch status {
+    case "", ReportOpen, ReportResolved, ReportDismissed:
+    default:
+        return nil, fmt.Errorf("unknown report status: %s", status)
+    }
+
+    return s.reportRepo.List(status, limit)
+}
+
+// CloseReport marks an open report resolved or dismissed. The note, if
+// any, goes to the admin action log with it.
+func (s *AdminService) CloseReport(adminID, reportID int64, status, note string) error {
+    if err := s.RequireAdmin(adminID); err != nil {
+        return err
+    }
+
+    if status != ReportResolved && status != ReportDismissed {
+        return fmt.Errorf("unknown report status: %s", status)
+    }
+
+    closed, err := s.reportRepo.Close(reportID, status, adminID)
+    if err != nil {
+        return err
+    }
+    if !closed {
+        return fmt.Errorf("no open report %d", reportID)
+    }
+
+    details := fmt.Sprintf("Marked report %d %s", reportID, status)
+    if note != "" {
+        details += ": " + note
+    }
+    actionType := "report_resolve"
+    if status == ReportDismissed {
+        actionType = "report_dismiss"
+    }
+    s.logAction(adminID, actionType, nil, nil, details)
+
+    return nil
+}
@@ -0,0 +1,27 @@
+package admin
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+// RecordAutoAction writes an action the server took on its own to the
+// admin action log, where it is listed with the "auto" actor.
+func (s *AdminService) RecordAutoAction(actionType string, targetUserID int64, details string) {
+    s.logAction(database.AutoActor, actionType, &targetUserID, nil, details)
+}
+
+// AutoBan bans a user for duration without an admin, as the last step of
+// the spam penalties.
+func (s *AdminService) AutoBan(userID int64, username, reason string, duration time.Duration) error {
+    if err := s.adminRepo.BanUser(userID, database.AutoActor, reason, &duration); err != nil {
+        return err
+    }
+
+    details := fmt.Sprintf("Banned user %s (ID %d) for %s: %s", username, userID, duration, reason)
+    s.logAction(database.AutoActor, "ban", &userID, nil, details)
+
+    return nil
+}
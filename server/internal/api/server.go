@@ -0,0 +1,428 @@
+package api
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/security"
+)
+
+type Controller interface {
+    EnforceKick(username, reason string)
+    EnforceBan(adminID int64, username, reason string, durationSeconds int)
+    DeliverBroadcast(username, message string)
+    Tunables() map[string]string
+    SetTunable(adminID int64, name, value string) (string, error)
+    ActiveConnections() int
+    Metrics() map[string]int64
+}
+
+type Server struct {
+    config         *config.Config
+    adminService   *admin.AdminService
+    authService    *auth.AuthService
+    sessionManager *security.SessionManager
+    controller     Controller
+    httpServer     *http.Server
+}
+
+func NewServer(cfg *config.Config, adminService *admin.AdminService, authService *auth.AuthService, sessionManager *security.SessionManager, controller Controller) *Server {
+    s := &Server{
+        config:         cfg,
+        adminService:   adminService,
+        authService:    authService,
+        sessionManager: sessionManager,
+        controller:     controller,
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/api/v1/stats", s.withAdmin(http.MethodGet, s.handleStats))
+    mux.HandleFunc("/api/v1/log", s.withAdmin(http.MethodGet, s.handleLog))
+    mux.HandleFunc("/api/v1/config", s.withAdmin(http.MethodGet, s.handleConfig))
+    mux.HandleFunc("/api/v1/users", s.withAdmin(http.MethodGet, s.handleListUsers))
+    mux.HandleFunc("/api/v1/users/", s.withAdmin(http.MethodPost, s.handleUserAction))
+    mux.HandleFunc("/api/v1/broadcast", s.withAdmin(http.MethodPost, s.handleBroadcast))
+    mux.HandleFunc("/api/v1/tunables", s.withAdmin(http.MethodGet, s.handleTunables))
+    mux.HandleFunc("/api/v1/tunables/", s.withAdmin(http.MethodPost, s.handleSetTunable))
+
+    s.httpServer = &http.Server{
+        Addr:         cfg.API.Listen,
+        Handler:      mux,
+        ReadTimeout:  cfg.Server.ReadTimeout,
+        WriteTimeout: cfg.Server.WriteTimeout,
+    }
+
+    return s
+}
+
+func (s *Server) Start() {
+    go func() {
+        log.Printf("Admin API listening on %s", s.config.API.Listen)
+        if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Printf("Admin API error: %v", err)
+        }
+    }()
+}
+
+func (s *Server) Close() error {
+    return s.httpServer.Close()
+}
+
+func (s *Server) withAdmin(method string, handler func(w http.ResponseWriter, r *http.Request, user *models.User)) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != method {
+            writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+            return
+        }
+
+        user, err := s.authenticate(r)
+        if err != nil {
+            writeError(w, http.StatusUnauthorized, err)
+            return
+        }
+
+        if err := s.adminService.RequireAdmin(user.UserID); err != nil {
+            writeError(w, http.StatusForbidden, err)
+            return
+        }
+
+        handler(w, r, user)
+    }
+}
+
+func (s *Server) authenticate(r *http.Request) (*models.User, error) {
+    if key := r.Header.Get("X-API-Key"); key != "" {
+        keyHash := auth.HashSHA256(key)
+        for _, apiKey := range s.config.API.Keys {
+            if subtle.ConstantTimeCompare([]byte(keyHash), []byte(strings.ToLower(apiKey.KeyHash))) == 1 {
+                return s.authService.GetUserByUsername(apiKey.Username)
+            }
+        }
+        return nil, fmt.Errorf("invalid API key")
+    }
+
+    header := r.Header.Get("Authorization")
+    if !strings.HasPrefix(header, "Bearer ") {
+        return nil, fmt.Errorf("missing API key or bearer token")
+    }
+
+    session, err := s.sessionManager.GetSession(strings.TrimPrefix(header, "Bearer "))
+    if err != nil {
+        return nil, err
+    }
+
+    return s.authService.GetUserByID(session.UserID)
+}
+
+// GET /api/v1/stats
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request, user *models.User) {
+    stats, err := s.adminService.GetServerStats(user.UserID)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    stats["active_connections"] = s.controller.ActiveConnections()
+    stats["active_sessions"] = s.sessionManager.GetActiveSessionCount()
+
+    for key, value := range s.controller.Metrics() {
+        stats[key] = value
+    }
+
+    writeJSON(w, http.StatusOK, stats)
+}
+
+// GET /api/v1/log?limit=50&offset=0&admin=&action=&target=&from=&to=&format=json|csv
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request, user *models.User) {
+    filter, err := s.logFilter(r)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    format := export.FormatJSON
+    if value := r.URL.Query().Get("format"); value != "" {
+        if format, err = export.ParseAuditFormat(value); err != nil {
+            writeError(w, http.StatusBadRequest, err)
+            return
+        }
+    }
+
+    entries, err := s.adminService.SearchAdminLog(user.UserID, filter)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if format == export.FormatCSV {
+        w.Header().Set("Content-Type", "text/csv")
+        w.Header().Set("Content-Disposition", `attachment; filename="admin-log.csv"`)
+        export.WriteAudit(w, entries, format)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func (s *Server) logFilter(r *http.Request) (database.AdminLogFilter, error) {
+    query := r.URL.Query()
+    filter := database.AdminLogFilter{ActionType: query.Get("action")}
+    filter.Limit, filter.Offset = pagination(r)
+
+    if strings.EqualFold(query.Get("admin"), "auto") {
+        filter.Automatic = true
+        query.Del("admin")
+    }
+
+    for param, id := range map[string]*int64{"admin": &filter.AdminID, "target": &filter.TargetUserID} {
+        if username := query.Get(param); username != "" {
+            target, err := s.authService.GetUserByUsername(username)
+            if err != nil {
+                return filter, fmt.Errorf("user not found: %s", username)
+            }
+            *id = target.UserID
+        }
+    }
+
+    for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+        if value := query.Get(param); value != "" {
+            parsed, err := export.ParseTime(value)
+            if err != nil {
+                return filter, err
+            }
+            *t = parsed
+        }
+    }
+
+    return filter, nil
+}
+
+// GET /api/v1/users?limit=50&offset=0
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request, user *models.User) {
+    limit, offset := pagination(r)
+
+    users, err := s.adminService.ListUsers(user.UserID, limit, offset)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+type userActionRequest struct {
+    Reason   string `json:"reason"`
+    Duration string `json:"duration"`
+}
+
+// POST /api/v1/users/<username>/{ban,unban,kick,unlock}
+func (s *Server) handleUserAction(w http.ResponseWriter, r *http.Request, user *models.User) {
+    parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/users/"), "/")
+    if len(parts) != 2 || parts[0] == "" {
+        writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+        return
+    }
+
+    username, action := parts[0], parts[1]
+
+    var req userActionRequest
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+            return
+        }
+    }
+
+    var err error
+    switch action {
+    case "ban":
+        if req.Reason == "" {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("reason is required"))
+            return
+        }
+
+        durationSeconds, parseErr := admin.ParseDuration(req.Duration)
+        if parseErr != nil {
+            writeError(w, http.StatusBadRequest, parseErr)
+            return
+        }
+
+        if err = s.adminService.BanUser(user.UserID, username, req.Reason, durationSeconds); err == nil {
+            s.controller.EnforceBan(user.UserID, username, req.Reason, durationSeconds)
+        }
+    case "unban":
+        err = s.adminService.UnbanUser(user.UserID, username)
+    case "unlock":
+        err = s.adminService.UnlockAccount(user.UserID, username)
+    case "kick":
+        if req.Reason == "" {
+            req.Reason = "Kicked by admin"
+        }
+
+        if err = s.adminService.KickUser(user.UserID, username, req.Reason); err == nil {
+            s.controller.EnforceKick(username, req.Reason)
+        }
+    default:
+        writeError(w, http.StatusNotFound, fmt.Errorf("unknown action: %s", action))
+        return
+    }
+
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    log.Printf("Admin %s performed %s on %s via API", user.Username, action, username)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "action": action, "username": username})
+}
+
+type broadcastRequest struct {
+    Message string `json:"message"`
+}
+
+// POST /api/v1/broadcast
+func (s *Server) handleBroadcast(w http.ResponseWriter, r *http.Request, user *models.User) {
+    var req broadcastRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+        return
+    }
+
+    message := strings.TrimSpace(req.Message)
+    if message == "" {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("message is required"))
+        return
+    }
+
+    if err := s.adminService.RecordAction(user.UserID, "broadcast", fmt.Sprintf("Broadcast message: %s", message)); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    s.controller.DeliverBroadcast(user.Username, message)
+
+    log.Printf("Admin %s broadcast message via API: %s", user.Username, message)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "action": "broadcast"})
+}
+
+// GET /api/v1/tunables
+func (s *Server) handleTunables(w http.ResponseWriter, r *http.Request, user *models.User) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{"tunables": s.controller.Tunables()})
+}
+
+type tunableRequest struct {
+    Value *string `json:"value"`
+}
+
+// POST /api/v1/tunables/<key>
+func (s *Server) handleSetTunable(w http.ResponseWriter, r *http.Request, user *models.User) {
+    name := strings.TrimPrefix(r.URL.Path, "/api/v1/tunables/")
+    if name == "" || strings.Contains(name, "/") {
+        writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+        return
+    }
+
+    var req tunableRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+        return
+    }
+    if req.Value == nil {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("value is required"))
+        return
+    }
+
+    previous, err := s.controller.SetTunable(user.UserID, name, *req.Value)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    log.Printf("Admin %s set %s from %q to %q via API", user.Username, name, previous, *req.Value)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "name": name, "previous": previous, "value": *req.Value})
+}
+
+// GET /api/v1/config
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request, user *models.User) {
+    cfg := s.config
+
+    var listeners []map[string]interface{}
+    for _, listener := range cfg.Server.ListenerConfigs() {
+        listeners = append(listeners, map[string]interface{}{
+            "name":       listener.Name,
+            "address":    listener.Address(),
+            "tls":        listener.TLS,
+            "websocket":  listener.WebSocket,
+            "admin_only": listener.AdminOnly,
+        })
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "server": map[string]interface{}{
+            "server_name":     cfg.Server.ServerName,
+            "max_connections": cfg.Server.MaxConnections,
+            "read_timeout":    cfg.Server.ReadTimeout.String(),
+            "write_timeout":   cfg.Server.WriteTimeout.String(),
+            "listeners":       listeners,
+        },
+        "security": map[string]interface{}{
+            "session_timeout":          cfg.Security.SessionTimeout,
+            "max_ip_suspicion":         cfg.Security.MaxIPSuspicion,
+            "enable_ip_tracking":       cfg.Security.EnableIPTracking,
+            "password_min_length":      cfg.Security.PasswordMinLength,
+            "password_require_special": cfg.Security.PasswordRequireSpecial,
+            "max_login_attempts":       cfg.Security.MaxLoginAttempts,
+        },
+        "features": map[string]interface{}{
+            "enable_message_history":  cfg.Features.EnableMessageHistory,
+            "max_message_history":     cfg.Features.MaxMessageHistory,
+            "enable_direct_messages":  cfg.Features.EnableDirectMessages,
+            "enable_file_transfer":    cfg.Features.EnableFileTransfer,
+            "enable_receipts":         cfg.Features.EnableReceipts,
+            "max_channel_name_length": cfg.Features.MaxChannelNameLength,
+            "max_channels_per_user":   cfg.Features.MaxChannelsPerUser,
+            "channel_alias_days":      cfg.Features.ChannelAliasDays,
+        },
+        "threadpool": map[string]interface{}{
+            "worker_count": cfg.ThreadPool.WorkerCount,
+            "queue_size":   cfg.ThreadPool.QueueSize,
+            "max_workers":  cfg.ThreadPool.MaxWorkers,
+        },
+    })
+}
+
+func pagination(r *http.Request) (int, int) {
+    limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+    if err != nil || limit <= 0 || limit > 500 {
+        limit = 50
+    }
+
+    offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+    if err != nil || offset < 0 {
+        offset = 0
+    }
+
+    return limit, offset
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+    writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -1,23 +1,59 @@
 package auth
 
 import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
     "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
 
     "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/mail"
     "github.com/onyxirc/server/internal/models"
 )
 
 type AuthService struct {
     userRepo     *database.UserRepository
     securityRepo *database.SecurityRepository
+    resetRepo    *database.PasswordResetRepository
+    botKeyRepo   *database.BotKeyRepository
+    emailTokenRepo *database.EmailTokenRepository
     minPasswordLength int
     requireSpecial    bool
+    loginLimitsMu     sync.RWMutex
+    maxLoginAttempts  int
+    maxIPAttempts     int
+    loginWindow       time.Duration
 }
 
-func NewAuthService(userRepo *database.UserRepository, securityRepo *database.SecurityRepository, minPasswordLength int, requireSpecial bool) *AuthService {
+var (
+    ErrInvalidCredentials = errors.New("invalid username or password")
+    ErrUsernameTaken      = errors.New("username already exists")
+)
+
+// LockoutError is returned by Login while an account or address has too many
+// recent failed attempts. Started is set on the attempt that hit the limit.
+type LockoutError struct {
+    Scope   string
+    Target  string
+    Window  time.Duration
+    Started bool
+}
+
+func (e *LockoutError) Error() string {
+    return fmt.Sprintf("too many failed login attempts for this %s; try again within %s", e.Scope, e.Window)
+}
+
+func NewAuthService(userRepo *database.UserRepository, securityRepo *database.SecurityRepository, resetRepo *database.PasswordResetRepository, botKeyRepo *database.BotKeyRepository, emailTokenRepo *database.EmailTokenRepository, minPasswordLength int, requireSpecial bool) *AuthService {
     return &AuthService{
         userRepo:          userRepo,
         securityRepo:      securityRepo,
+        resetRepo:         resetRepo,
+        botKeyRepo:        botKeyRepo,
+        emailTokenRepo:    emailTokenRepo,
         minPasswordLength: minPasswordLength,
         requireSpecial:    requireSpecial,
     }
@@ -34,7 +70,7 @@ func (s *AuthService) Register(username, password string) (*models.User, error)
         return nil, fmt.Errorf("failed to check username: %w", err)
     }
     if exists {
-        return nil, fmt.Errorf("username already exists")
+        return nil, ErrUsernameTaken
     }
 
     if err := ValidatePasswordStrength(password, s.minPasswordLength, s.requireSpecial); err != nil {
@@ -56,13 +92,79 @@ func (s *AuthService) Register(username, password string) (*models.User, error)
     return user, nil
 }
 
+// SetLoginLimits configures lockouts after maxAttempts failed logins for one
+// account, or maxIPAttempts from one address, within window. Zero disables.
+func (s *AuthService) SetLoginLimits(maxAttempts, maxIPAttempts int, window time.Duration) {
+    s.loginLimitsMu.Lock()
+    defer s.loginLimitsMu.Unlock()
+
+    s.maxLoginAttempts = maxAttempts
+    s.maxIPAttempts = maxIPAttempts
+    s.loginWindow = window
+}
+
+func (s *AuthService) loginLimits() (int, int, time.Duration) {
+    s.loginLimitsMu.RLock()
+    defer s.loginLimitsMu.RUnlock()
+
+    return s.maxLoginAttempts, s.maxIPAttempts, s.loginWindow
+}
+
+// lockout records a lockout in the security event log when it starts.
+func (s *AuthService) lockout(err *LockoutError, userID *int64, ipAddress string) error {
+    if err.Started {
+        details := fmt.Sprintf("Locked out %s %s for %s after repeated failed logins", err.Scope, err.Target, err.Window)
+        if recordErr := s.securityRepo.RecordEvent(models.SecurityEventLoginLockout, userID, nil, ipAddress, details); recordErr != nil {
+            log.Printf("Warning: %v", recordErr)
+        }
+    }
+    return err
+}
+
+func (s *AuthService) checkLockout(userID int64, username, ipAddress string, afterFailure bool) error {
+    maxAttempts, maxIPAttempts, window := s.loginLimits()
+    if window <= 0 {
+        return nil
+    }
+    since := time.Now().Add(-window)
+
+    if maxIPAttempts > 0 {
+        failures, err := s.securityRepo.CountFailedLoginsFromIP(ipAddress, since)
+        if err != nil {
+            log.Printf("Warning: %v", err)
+        } else if failures >= maxIPAttempts {
+            return s.lockout(&LockoutError{Scope: "address", Target: ipAddress, Window: window, Started: afterFailure && failures == maxIPAttempts}, nil, ipAddress)
+        }
+    }
+
+    if maxAttempts > 0 && userID != 0 {
+        failures, err := s.securityRepo.CountFailedLogins(userID, since)
+        if err != nil {
+            log.Printf("Warning: %v", err)
+        } else if failures >= maxAttempts {
+            return s.lockout(&LockoutError{Scope: "account", Target: username, Window: window, Started: afterFailure && failures == maxAttempts}, &userID, ipAddress)
+        }
+    }
+
+    return nil
+}
+
 func (s *AuthService) Login(username, password, ipAddress string) (*models.User, error) {
     
     user, err := s.userRepo.GetByUsername(username)
     if err != nil {
-        
+        if err := s.checkLockout(0, username, ipAddress, false); err != nil {
+            return nil, err
+        }
         s.securityRepo.RecordLoginAttempt(0, ipAddress, false, nil)
-        return nil, fmt.Errorf("invalid username or password")
+        if err := s.checkLockout(0, username, ipAddress, true); err != nil {
+            return nil, err
+        }
+        return nil, ErrInvalidCredentials
+    }
+
+    if err := s.checkLockout(user.UserID, user.Username, ipAddress, false); err != nil {
+        return nil, err
     }
 
     if !user.IsActive {
@@ -70,9 +172,17 @@ func (s *AuthService) Login(username, password, ipAddress string) (*models.User,
         return nil, fmt.Errorf("account is inactive")
     }
 
-    if !VerifyPassword(password, user.PasswordSalt, user.PasswordHash) {
+    if pending, err := s.resetRepo.IsPending(user.UserID); err == nil && pending {
         s.securityRepo.RecordLoginAttempt(user.UserID, ipAddress, false, nil)
-        return nil, fmt.Errorf("invalid username or password")
+        return nil, fmt.Errorf("password reset required: use RESETPASS with the token provided by an administrator")
+    }
+
+    if !s.verifyCredential(user, password) {
+        s.securityRepo.RecordLoginAttempt(user.UserID, ipAddress, false, nil)
+        if err := s.checkLockout(user.UserID, user.Username, ipAddress, true); err != nil {
+            return nil, err
+        }
+        return nil, ErrInvalidCredentials
     }
 
     s.securityRepo.RecordLoginAttempt(user.UserID, ipAddress, true, nil)
@@ -85,6 +195,28 @@ func (s *AuthService) Login(username, password, ipAddress string) (*models.User,
     return user, nil
 }
 
+// verifyCredential checks the password of a user, or the API key of a bot;
+// bots have no password.
+func (s *AuthService) verifyCredential(user *models.User, credential string) bool {
+    if !user.IsBot {
+        return VerifyPassword(credential, user.PasswordSalt, user.PasswordHash)
+    }
+
+    valid, err := s.botKeyRepo.Use(user.UserID, HashSHA256(credential))
+    if err != nil {
+        fmt.Printf("Warning: failed to check bot key: %v\n", err)
+        return false
+    }
+    return valid
+}
+
+// RecordSecondFactorFailure counts a wrong TOTP code as a failed login, so it
+// is subject to the same lockouts as a wrong password.
+func (s *AuthService) RecordSecondFactorFailure(user *models.User, ipAddress string) error {
+    s.securityRepo.RecordLoginAttempt(user.UserID, ipAddress, false, nil)
+    return s.checkLockout(user.UserID, user.Username, ipAddress, true)
+}
+
 func ValidateUsername(username string) error {
     if len(username) < 3 {
         return fmt.Errorf("username must be at least 3 characters long")
@@ -139,6 +271,205 @@ func (s *AuthService) ChangePassword(userID int64, oldPassword, newPassword stri
     return fmt.Errorf("password update not yet implemented")
 }
 
+func (s *AuthService) ChangeUsername(userID int64, currentUsername, newUsername string) error {
+    if err := ValidateUsername(newUsername); err != nil {
+        return err
+    }
+
+    if newUsername == currentUsername {
+        return fmt.Errorf("username unchanged")
+    }
+
+    if !strings.EqualFold(newUsername, currentUsername) {
+        exists, err := s.userRepo.UsernameExists(newUsername)
+        if err != nil {
+            return fmt.Errorf("failed to check username: %w", err)
+        }
+        if exists {
+            return ErrUsernameTaken
+        }
+    }
+
+    if err := s.userRepo.UpdateUsername(userID, newUsername); err != nil {
+        return err
+    }
+
+    return nil
+}
+
+func generateToken() (string, error) {
+    tokenBytes := make([]byte, 16)
+    if _, err := rand.Read(tokenBytes); err != nil {
+        return "", fmt.Errorf("failed to generate token: %w", err)
+    }
+    return hex.EncodeToString(tokenBytes), nil
+}
+
+func (s *AuthService) CreatePasswordReset(userID int64, ttl *time.Duration) (string, error) {
+    token, err := generateToken()
+    if err != nil {
+        return "", err
+    }
+
+    if err := s.resetRepo.Create(userID, HashSHA256(token), ttl); err != nil {
+        return "", err
+    }
+
+    return token, nil
+}
+
+func (s *AuthService) ResetPassword(username, token, newPassword string) error {
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return fmt.Errorf("invalid username or reset token")
+    }
+
+    if err := ValidatePasswordStrength(newPassword, s.minPasswordLength, s.requireSpecial); err != nil {
+        return err
+    }
+
+    // The token is either one an admin issued or one sent by email.
+    consumed, err := s.resetRepo.Consume(user.UserID, HashSHA256(token))
+    if err != nil {
+        return err
+    }
+    if !consumed {
+        email, err := s.emailTokenRepo.Consume(user.UserID, database.EmailTokenReset, HashSHA256(token))
+        if err != nil {
+            return err
+        }
+        if email == "" {
+            return fmt.Errorf("invalid username or reset token")
+        }
+        if err := s.resetRepo.Delete(user.UserID); err != nil {
+            return err
+        }
+    }
+
+    salt, err := GenerateSalt()
+    if err != nil {
+        return fmt.Errorf("failed to generate salt: %w", err)
+    }
+
+    if err := s.userRepo.UpdatePassword(user.UserID, HashPassword(newPassword, salt), salt); err != nil {
+        return err
+    }
+
+    return nil
+}
+
+// SetEmail replaces the user's email address, which then needs verifying,
+// and returns the verification code to send to it. An empty address
+// removes it.
+func (s *AuthService) SetEmail(userID int64, email string, ttl time.Duration) (string, error) {
+    if email != "" {
+        if err := mail.ValidateAddress(email); err != nil {
+            return "", err
+        }
+    }
+
+    if err := s.userRepo.SetEmail(userID, email); err != nil {
+        return "", err
+    }
+    if email == "" {
+        return "", nil
+    }
+
+    token, err := generateToken()
+    if err != nil {
+        return "", err
+    }
+
+    if err := s.emailTokenRepo.Create(userID, database.EmailTokenVerify, HashSHA256(token), email, ttl); err != nil {
+        return "", err
+    }
+
+    return token, nil
+}
+
+// VerifyEmail confirms the user's address with the code sent to it.
+func (s *AuthService) VerifyEmail(userID int64, token string) (string, error) {
+    email, err := s.emailTokenRepo.Consume(userID, database.EmailTokenVerify, HashSHA256(token))
+    if err != nil {
+        return "", err
+    }
+    if email == "" {
+        return "", fmt.Errorf("invalid or expired verification code")
+    }
+
+    verified, err := s.userRepo.MarkEmailVerified(userID, email)
+    if err != nil {
+        return "", err
+    }
+    if !verified {
+        return "", fmt.Errorf("your email address has changed since that code was sent")
+    }
+
+    return email, nil
+}
+
+// VerifiedEmail returns the user's email address if it has been verified,
+// or an empty string.
+func (s *AuthService) VerifiedEmail(userID int64) (string, error) {
+    email, verified, err := s.userRepo.GetEmail(userID)
+    if err != nil || !verified {
+        return "", err
+    }
+    return email, nil
+}
+
+// CreateEmailReset issues a password reset code for a user with a verified
+// email address, returning the address to send it to. Unlike an admin
+// reset it does not block logins, so requesting one for someone else does
+// not lock them out.
+func (s *AuthService) CreateEmailReset(username string, ttl time.Duration) (*models.User, string, string, error) {
+    user, err := s.userRepo.GetByUsername(username)
+    if err != nil {
+        return nil, "", "", fmt.Errorf("user not found: %s", username)
+    }
+    if user.IsBot {
+        return nil, "", "", fmt.Errorf("bots have no password")
+    }
+
+    email, verified, err := s.userRepo.GetEmail(user.UserID)
+    if err != nil {
+        return nil, "", "", err
+    }
+    if email == "" || !verified {
+        return nil, "", "", fmt.Errorf("%s has no verified email address", username)
+    }
+
+    token, err := generateToken()
+    if err != nil {
+        return nil, "", "", err
+    }
+
+    if err := s.emailTokenRepo.Create(user.UserID, database.EmailTokenReset, HashSHA256(token), email, ttl); err != nil {
+        return nil, "", "", err
+    }
+
+    return user, email, token, nil
+}
+
+// DeleteAccount deactivates userID and marks it deleted after confirming
+// its password. Administrators must give up admin privileges first.
+func (s *AuthService) DeleteAccount(userID int64, password string) error {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        return fmt.Errorf("user not found: %w", err)
+    }
+
+    if !VerifyPassword(password, user.PasswordSalt, user.PasswordHash) {
+        return fmt.Errorf("incorrect password")
+    }
+
+    if user.IsAdmin {
+        return fmt.Errorf("administrators cannot delete their account; remove admin privileges first")
+    }
+
+    return s.userRepo.MarkDeleted(userID)
+}
+
 func (s *AuthService) GetUserByID(userID int64) (*models.User, error) {
     return s.userRepo.GetByID(userID)
 }
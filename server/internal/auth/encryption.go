@@ -1,23 +1,54 @@
 package auth
 
 import (
+    "crypto"
+    "crypto/ecdh"
+    "crypto/hmac"
+    "crypto/rand"
     "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
     "encoding/base64"
     "fmt"
+    "time"
 )
 
+// ecdhContext labels keys derived from an X25519 exchange and the
+// transcript the server signs for it.
+const ecdhContext = "onyxirc-ecdh-v1"
+
+// frameMACLabel derives the key CBC envelopes are authenticated with from
+// the session secret on protocol versions 1 and 2.
+const frameMACLabel = "onyxirc-frame-mac"
+
+// ECDHExchange is the server's half of a completed X25519 key exchange.
+// The public keys and Signature are base64-encoded as in the signed
+// transcript.
+type ECDHExchange struct {
+    SessionKey   []byte
+    ClientPublic string
+    ServerPublic string
+    Signature    string
+}
+
 type CryptoManager struct {
     rsaKeyPair *RSAKeyPair
     aesMode    string 
+    stats      *CryptoStats
 }
 
 func NewCryptoManager(rsaKeyPair *RSAKeyPair, aesMode string) *CryptoManager {
     return &CryptoManager{
         rsaKeyPair: rsaKeyPair,
         aesMode:    aesMode,
+        stats:      NewCryptoStats(),
     }
 }
 
+func (cm *CryptoManager) Stats() *CryptoStats {
+    return cm.stats
+}
+
 func (cm *CryptoManager) GetPublicKey() *rsa.PublicKey {
     return cm.rsaKeyPair.PublicKey
 }
@@ -27,6 +58,13 @@ func (cm *CryptoManager) GetPublicKeyPEM() ([]byte, error) {
 }
 
 func (cm *CryptoManager) EncryptMessage(sessionKey []byte, message string) (string, error) {
+    started := time.Now()
+    encrypted, err := cm.encryptMessage(sessionKey, message)
+    cm.stats.Observe(OpAESEncrypt, started, err)
+    return encrypted, err
+}
+
+func (cm *CryptoManager) encryptMessage(sessionKey []byte, message string) (string, error) {
     var ciphertext []byte
     var err error
 
@@ -49,6 +87,13 @@ func (cm *CryptoManager) EncryptMessage(sessionKey []byte, message string) (stri
 }
 
 func (cm *CryptoManager) DecryptMessage(sessionKey []byte, encryptedMessage string) (string, error) {
+    started := time.Now()
+    message, err := cm.decryptMessage(sessionKey, encryptedMessage)
+    cm.stats.Observe(OpAESDecrypt, started, err)
+    return message, err
+}
+
+func (cm *CryptoManager) decryptMessage(sessionKey []byte, encryptedMessage string) (string, error) {
     
     ciphertext, err := base64.StdEncoding.DecodeString(encryptedMessage)
     if err != nil {
@@ -73,8 +118,97 @@ func (cm *CryptoManager) DecryptMessage(sessionKey []byte, encryptedMessage stri
     return string(plaintext), nil
 }
 
+// SealFrame encrypts a line for an ENCRYPTED envelope with the session's
+// encryption key. GCM authenticates the ciphertext itself; in CBC mode an
+// HMAC-SHA256 of the IV and ciphertext under the MAC key is appended, so a
+// tampered envelope is rejected before it is decrypted.
+func (cm *CryptoManager) SealFrame(keys *SessionKeys, line string) (string, error) {
+    if keys == nil {
+        return "", fmt.Errorf("no session key")
+    }
+
+    encryptionKey, macKey := keys.Encryption.Bytes(), keys.MAC.Bytes()
+    if encryptionKey == nil {
+        return "", fmt.Errorf("session key is no longer available")
+    }
+
+    if cm.aesMode != "CBC" {
+        return cm.EncryptMessage(encryptionKey, line)
+    }
+
+    started := time.Now()
+    frame, err := sealCBCFrame(encryptionKey, macKey, line)
+    cm.stats.Observe(OpAESEncrypt, started, err)
+    return frame, err
+}
+
+// OpenFrame reverses SealFrame.
+func (cm *CryptoManager) OpenFrame(keys *SessionKeys, frame string) (string, error) {
+    if keys == nil {
+        return "", fmt.Errorf("no session key")
+    }
+
+    encryptionKey, macKey := keys.Encryption.Bytes(), keys.MAC.Bytes()
+    if encryptionKey == nil {
+        return "", fmt.Errorf("session key is no longer available")
+    }
+
+    if cm.aesMode != "CBC" {
+        return cm.DecryptMessage(encryptionKey, frame)
+    }
+
+    started := time.Now()
+    line, err := openCBCFrame(encryptionKey, macKey, frame)
+    cm.stats.Observe(OpAESDecrypt, started, err)
+    return line, err
+}
+
+func sealCBCFrame(encryptionKey, macKey []byte, line string) (string, error) {
+    ciphertext, err := EncryptAESCBC(encryptionKey, []byte(line))
+    if err != nil {
+        return "", fmt.Errorf("encryption failed: %w", err)
+    }
+
+    mac := hmac.New(sha256.New, macKey)
+    mac.Write(ciphertext)
+    return base64.StdEncoding.EncodeToString(mac.Sum(ciphertext)), nil
+}
+
+func openCBCFrame(encryptionKey, macKey []byte, frame string) (string, error) {
+    sealed, err := base64.StdEncoding.DecodeString(frame)
+    if err != nil {
+        return "", fmt.Errorf("base64 decode failed: %w", err)
+    }
+    if len(sealed) < sha256.Size {
+        return "", fmt.Errorf("envelope is too short")
+    }
+
+    ciphertext, tag := sealed[:len(sealed)-sha256.Size], sealed[len(sealed)-sha256.Size:]
+    mac := hmac.New(sha256.New, macKey)
+    mac.Write(ciphertext)
+    if !hmac.Equal(mac.Sum(nil), tag) {
+        return "", fmt.Errorf("envelope failed its integrity check")
+    }
+
+    plaintext, err := DecryptAESCBC(encryptionKey, ciphertext)
+    if err != nil {
+        return "", fmt.Errorf("decryption failed: %w", err)
+    }
+
+    return string(plaintext), nil
+}
+
+// DeriveServerKey derives a secret for label from the server's RSA private
+// key, for MACs that have to verify across restarts without a key file of
+// their own.
+func (cm *CryptoManager) DeriveServerKey(label string) []byte {
+    return DeriveKey(x509.MarshalPKCS1PrivateKey(cm.rsaKeyPair.PrivateKey), label)
+}
+
 func (cm *CryptoManager) EncryptSessionKey(publicKey *rsa.PublicKey, sessionKey []byte) (string, error) {
+    started := time.Now()
     encryptedKey, err := EncryptRSA(publicKey, sessionKey)
+    cm.stats.Observe(OpRSAEncrypt, started, err)
     if err != nil {
         return "", fmt.Errorf("failed to encrypt session key: %w", err)
     }
@@ -83,18 +217,86 @@ func (cm *CryptoManager) EncryptSessionKey(publicKey *rsa.PublicKey, sessionKey
 }
 
 func (cm *CryptoManager) DecryptSessionKey(encryptedKey string) ([]byte, error) {
-    
-    ciphertext, err := base64.StdEncoding.DecodeString(encryptedKey)
+    sessionKey, err := cm.DecryptWithPrivateKey(encryptedKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt session key: %w", err)
+    }
+
+    return sessionKey, nil
+}
+
+// ECDHSessionKey answers a client's ephemeral X25519 public key with one of
+// the server's own and derives the session key from the shared secret. The
+// server's ephemeral key is dropped on return, so a later leak of the RSA
+// key does not reveal the session key: RSA only signs the transcript
+// "onyxirc-ecdh-v1\n<client public>\n<server public>" (RSA-PSS, SHA-256)
+// so the client knows it is talking to this server. The session secret is
+// HKDF-SHA256 of the shared secret, salted with rekeyKey (empty on the
+// first exchange) and both public keys, expanded with the context as info
+// to keySize bits.
+func (cm *CryptoManager) ECDHSessionKey(clientPublic string, keySize int, rekeyKey []byte) (*ECDHExchange, error) {
+    started := time.Now()
+    exchange, err := cm.ecdhSessionKey(clientPublic, keySize, rekeyKey)
+    cm.stats.Observe(OpECDH, started, err)
+    return exchange, err
+}
+
+func (cm *CryptoManager) ecdhSessionKey(clientPublic string, keySize int, rekeyKey []byte) (*ECDHExchange, error) {
+    if keySize != 128 && keySize != 192 && keySize != 256 {
+        return nil, fmt.Errorf("invalid AES key size: must be 128, 192, or 256 bits")
+    }
+
+    clientBytes, err := base64.StdEncoding.DecodeString(clientPublic)
     if err != nil {
         return nil, fmt.Errorf("base64 decode failed: %w", err)
     }
 
-    sessionKey, err := DecryptRSA(cm.rsaKeyPair.PrivateKey, ciphertext)
+    curve := ecdh.X25519()
+    peerKey, err := curve.NewPublicKey(clientBytes)
     if err != nil {
-        return nil, fmt.Errorf("failed to decrypt session key: %w", err)
+        return nil, fmt.Errorf("invalid X25519 public key: %w", err)
     }
 
-    return sessionKey, nil
+    privateKey, err := curve.GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate X25519 key: %w", err)
+    }
+
+    shared, err := privateKey.ECDH(peerKey)
+    if err != nil {
+        return nil, fmt.Errorf("X25519 exchange failed: %w", err)
+    }
+    defer Zero(shared)
+
+    serverBytes := privateKey.PublicKey().Bytes()
+
+    salt := make([]byte, 0, len(rekeyKey)+len(clientBytes)+len(serverBytes))
+    salt = append(salt, rekeyKey...)
+    salt = append(salt, clientBytes...)
+    salt = append(salt, serverBytes...)
+    prk := HKDFExtract(salt, shared)
+    Zero(salt)
+    sessionKey, err := HKDFExpand(prk, ecdhContext, keySize/8)
+    Zero(prk)
+    if err != nil {
+        return nil, err
+    }
+
+    clientPublic = base64.StdEncoding.EncodeToString(clientBytes)
+    serverPublic := base64.StdEncoding.EncodeToString(serverBytes)
+    transcript := sha256.Sum256([]byte(ecdhContext + "\n" + clientPublic + "\n" + serverPublic))
+    signature, err := rsa.SignPSS(rand.Reader, cm.rsaKeyPair.PrivateKey, crypto.SHA256, transcript[:], nil)
+    if err != nil {
+        Zero(sessionKey)
+        return nil, fmt.Errorf("failed to sign key exchange: %w", err)
+    }
+
+    return &ECDHExchange{
+        SessionKey:   sessionKey,
+        ClientPublic: clientPublic,
+        ServerPublic: serverPublic,
+        Signature:    base64.StdEncoding.EncodeToString(signature),
+    }, nil
 }
 
 func (cm *CryptoManager) GenerateSessionKey(keySize int) ([]byte, error) {
@@ -110,10 +312,15 @@ func EncryptWithPublicKey(publicKey *rsa.PublicKey, data []byte) (string, error)
 }
 
 func (cm *CryptoManager) DecryptWithPrivateKey(encryptedData string) ([]byte, error) {
+    started := time.Now()
+
     ciphertext, err := base64.StdEncoding.DecodeString(encryptedData)
     if err != nil {
+        cm.stats.Observe(OpRSADecrypt, started, err)
         return nil, fmt.Errorf("base64 decode failed: %w", err)
     }
 
-    return DecryptRSA(cm.rsaKeyPair.PrivateKey, ciphertext)
+    plaintext, err := DecryptRSA(cm.rsaKeyPair.PrivateKey, ciphertext)
+    cm.stats.Observe(OpRSADecrypt, started, err)
+    return plaintext, err
 }
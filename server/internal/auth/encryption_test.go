@@ -0,0 +1,145 @@
+package auth
+
+import (
+    "bytes"
+    "crypto"
+    "crypto/ecdh"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "testing"
+)
+
+func newTestCryptoManager(t *testing.T) *CryptoManager {
+    t.Helper()
+    keyPair, err := GenerateRSAKeyPair(2048)
+    if err != nil {
+        t.Fatalf("GenerateRSAKeyPair: %v", err)
+    }
+    return NewCryptoManager(keyPair, "GCM")
+}
+
+// clientSessionKey derives the session key the way a client does once it
+// has the server's public key: HKDF-SHA256 of the shared secret, salted with
+// rekeyKey and both public keys, expanded with the ECDH context.
+func clientSessionKey(t *testing.T, clientKey *ecdh.PrivateKey, serverPublic string, keySize int, rekeyKey []byte) []byte {
+    t.Helper()
+    serverBytes, err := base64.StdEncoding.DecodeString(serverPublic)
+    if err != nil {
+        t.Fatalf("server public key is not base64: %v", err)
+    }
+    peer, err := ecdh.X25519().NewPublicKey(serverBytes)
+    if err != nil {
+        t.Fatalf("server public key is not X25519: %v", err)
+    }
+    shared, err := clientKey.ECDH(peer)
+    if err != nil {
+        t.Fatalf("client ECDH: %v", err)
+    }
+
+    var salt []byte
+    salt = append(salt, rekeyKey...)
+    salt = append(salt, clientKey.PublicKey().Bytes()...)
+    salt = append(salt, serverBytes...)
+    key, err := HKDFExpand(HKDFExtract(salt, shared), ecdhContext, keySize/8)
+    if err != nil {
+        t.Fatalf("HKDFExpand: %v", err)
+    }
+    return key
+}
+
+// TestECDHSessionKey runs the client side of the exchange against
+// ECDHSessionKey and checks the signed transcript and the derived key.
+func TestECDHSessionKey(t *testing.T) {
+    cm := newTestCryptoManager(t)
+
+    tests := []struct {
+        name     string
+        keySize  int
+        rekeyKey []byte
+    }{
+        {name: "first exchange", keySize: 256},
+        {name: "first exchange, 128-bit", keySize: 128},
+        {name: "rekey", keySize: 256, rekeyKey: bytes.Repeat([]byte{0x5a}, 32)},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clientKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+            if err != nil {
+                t.Fatalf("GenerateKey: %v", err)
+            }
+            clientPublic := base64.StdEncoding.EncodeToString(clientKey.PublicKey().Bytes())
+
+            exchange, err := cm.ECDHSessionKey(clientPublic, tt.keySize, tt.rekeyKey)
+            if err != nil {
+                t.Fatalf("ECDHSessionKey: %v", err)
+            }
+            if exchange.ClientPublic != clientPublic {
+                t.Fatalf("ClientPublic = %q, want %q", exchange.ClientPublic, clientPublic)
+            }
+
+            signature, err := base64.StdEncoding.DecodeString(exchange.Signature)
+            if err != nil {
+                t.Fatalf("signature is not base64: %v", err)
+            }
+            transcript := sha256.Sum256([]byte("onyxirc-ecdh-v1\n" + clientPublic + "\n" + exchange.ServerPublic))
+            if err := rsa.VerifyPSS(cm.GetPublicKey(), crypto.SHA256, transcript[:], signature, nil); err != nil {
+                t.Fatalf("transcript signature does not verify: %v", err)
+            }
+
+            want := clientSessionKey(t, clientKey, exchange.ServerPublic, tt.keySize, tt.rekeyKey)
+            if len(exchange.SessionKey) != tt.keySize/8 {
+                t.Fatalf("session key is %d bytes, want %d", len(exchange.SessionKey), tt.keySize/8)
+            }
+            if !bytes.Equal(exchange.SessionKey, want) {
+                t.Fatalf("session key = %x, client derived %x", exchange.SessionKey, want)
+            }
+
+            // The salt must bind rekeyKey: deriving with the other choice
+            // gives a different key.
+            other := []byte("previous session key")
+            if tt.rekeyKey != nil {
+                other = nil
+            }
+            if bytes.Equal(exchange.SessionKey, clientSessionKey(t, clientKey, exchange.ServerPublic, tt.keySize, other)) {
+                t.Fatal("session key does not depend on the rekey salt")
+            }
+        })
+    }
+}
+
+func TestECDHSessionKeyRejectsBadInput(t *testing.T) {
+    cm := newTestCryptoManager(t)
+
+    valid, err := ecdh.X25519().GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+
+    // u = 0 and u = 1 are low-order points: the shared secret is all
+    // zeros whatever the server's key.
+    lowOrderOne := make([]byte, 32)
+    lowOrderOne[0] = 1
+
+    tests := []struct {
+        name    string
+        public  string
+        keySize int
+    }{
+        {name: "not base64", public: "not base64!", keySize: 256},
+        {name: "short key", public: base64.StdEncoding.EncodeToString(make([]byte, 31)), keySize: 256},
+        {name: "low-order zero point", public: base64.StdEncoding.EncodeToString(make([]byte, 32)), keySize: 256},
+        {name: "low-order point one", public: base64.StdEncoding.EncodeToString(lowOrderOne), keySize: 256},
+        {name: "bad key size", public: base64.StdEncoding.EncodeToString(valid.PublicKey().Bytes()), keySize: 100},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if exchange, err := cm.ECDHSessionKey(tt.public, tt.keySize, nil); err == nil {
+                t.Fatalf("ECDHSessionKey accepted %q: %+v", tt.public, exchange)
+            }
+        })
+    }
+}
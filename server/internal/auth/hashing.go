@@ -1,13 +1,20 @@
 package auth
 
 import (
+    "crypto/hmac"
     "crypto/rand"
     "crypto/sha256"
     "crypto/subtle"
+    "encoding/base64"
     "encoding/hex"
     "fmt"
+    "strings"
 )
 
+// messageMACPrefix marks a stored message hash that is an HMAC-SHA256, as
+// opposed to the bare SHA-256 hex written by older servers.
+const messageMACPrefix = "hmac:"
+
 func HashSHA256(data string) string {
     hash := sha256.Sum256([]byte(data))
     return hex.EncodeToString(hash[:])
@@ -18,6 +25,17 @@ func HashSHA256Bytes(data []byte) []byte {
     return hash[:]
 }
 
+// GenerateBotKey returns a new bot API key and the hash stored for it.
+func GenerateBotKey() (string, string, error) {
+    keyBytes := make([]byte, 32)
+    if _, err := rand.Read(keyBytes); err != nil {
+        return "", "", fmt.Errorf("failed to generate bot key: %w", err)
+    }
+
+    key := "onyxbot_" + hex.EncodeToString(keyBytes)
+    return key, HashSHA256(key), nil
+}
+
 func GenerateSalt() (string, error) {
     salt := make([]byte, 16) 
     if _, err := rand.Read(salt); err != nil {
@@ -48,6 +66,40 @@ func VerifyMessageHash(message, expectedHash string) bool {
     return subtle.ConstantTimeCompare([]byte(computedHash), []byte(expectedHash)) == 1
 }
 
+// DeriveKey derives a key for one purpose from key, so the same secret is
+// never used directly for two things.
+func DeriveKey(key []byte, label string) []byte {
+    derive := hmac.New(sha256.New, key)
+    derive.Write([]byte(label))
+    return derive.Sum(nil)
+}
+
+// MACMessage authenticates message with key, in the form stored in
+// message_hash. Unlike HashMessage, it cannot be recomputed by someone who
+// only has the database.
+func MACMessage(key []byte, message string) string {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(message))
+    return messageMACPrefix + base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyMessageMAC checks message against a stored message_hash. A bare
+// SHA-256 hash, as written before MACs were introduced, never passes:
+// anyone who can edit the row can recompute one.
+func VerifyMessageMAC(key []byte, message, stored string) bool {
+    stored = strings.TrimSpace(stored)
+    if !IsMessageMAC(stored) {
+        return false
+    }
+    return hmac.Equal([]byte(MACMessage(key, message)), []byte(stored))
+}
+
+// IsMessageMAC reports whether a stored message_hash is a MAC rather than a
+// bare SHA-256 hash.
+func IsMessageMAC(stored string) bool {
+    return strings.HasPrefix(strings.TrimSpace(stored), messageMACPrefix)
+}
+
 func ValidatePasswordStrength(password string, minLength int, requireSpecial bool) error {
     if len(password) < minLength {
         return fmt.Errorf("password must be at least %d characters long", minLength)
@@ -0,0 +1,105 @@
+package auth
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "fmt"
+)
+
+// sessionKeyContext prefixes the HKDF labels of the keys derived from a
+// session secret.
+const sessionKeyContext = "onyxirc-session-v1"
+
+// HKDFExtract is the extract step of HKDF-SHA256 (RFC 5869). A nil salt is
+// treated as a block of zeros.
+func HKDFExtract(salt, secret []byte) []byte {
+    if salt == nil {
+        salt = make([]byte, sha256.Size)
+    }
+
+    extract := hmac.New(sha256.New, salt)
+    extract.Write(secret)
+    return extract.Sum(nil)
+}
+
+// HKDFExpand is the expand step of HKDF-SHA256, producing size bytes bound
+// to info.
+func HKDFExpand(prk []byte, info string, size int) ([]byte, error) {
+    if size <= 0 || size > 255*sha256.Size {
+        return nil, fmt.Errorf("invalid HKDF output size: %d", size)
+    }
+
+    out := make([]byte, 0, size+sha256.Size)
+    var block []byte
+    for counter := byte(1); len(out) < size; counter++ {
+        expand := hmac.New(sha256.New, prk)
+        expand.Write(block)
+        expand.Write([]byte(info))
+        expand.Write([]byte{counter})
+        block = expand.Sum(nil)
+        out = append(out, block...)
+    }
+
+    Zero(out[size:])
+    return out[:size], nil
+}
+
+// SessionKeys are the keys a session actually uses, each derived from the
+// exchanged session secret under its own label, so a key is never used
+// for more than one purpose: Encryption seals ENCRYPTED envelopes, MAC
+// authenticates them in CBC mode and Rekey is mixed into the next X25519
+// exchange, so a new key also depends on the session it replaces.
+type SessionKeys struct {
+    Encryption *KeyBuffer
+    MAC        *KeyBuffer
+    Rekey      *KeyBuffer
+}
+
+// DeriveSessionKeys expands secret into SessionKeys with HKDF-SHA256. The
+// encryption key has the secret's length; the others are 32 bytes.
+func DeriveSessionKeys(secret []byte, lock bool) (*SessionKeys, error) {
+    prk := HKDFExtract(nil, secret)
+    defer Zero(prk)
+
+    keys := &SessionKeys{}
+    for _, derived := range []struct {
+        label string
+        size  int
+        dest  **KeyBuffer
+    }{
+        {"encryption", len(secret), &keys.Encryption},
+        {"mac", sha256.Size, &keys.MAC},
+        {"rekey", sha256.Size, &keys.Rekey},
+    } {
+        key, err := HKDFExpand(prk, sessionKeyContext+" "+derived.label, derived.size)
+        if err != nil {
+            keys.Destroy()
+            return nil, fmt.Errorf("failed to derive %s key: %w", derived.label, err)
+        }
+        *derived.dest = NewKeyBuffer(key, lock)
+    }
+
+    return keys, nil
+}
+
+// LegacySessionKeys are the keys of clients on protocol versions 1 and 2,
+// which encrypt with the session secret itself. They have no rekey key.
+func LegacySessionKeys(secret []byte, lock bool) *SessionKeys {
+    encryption := make([]byte, len(secret))
+    copy(encryption, secret)
+
+    return &SessionKeys{
+        Encryption: NewKeyBuffer(encryption, lock),
+        MAC:        NewKeyBuffer(DeriveKey(secret, frameMACLabel), lock),
+    }
+}
+
+func (k *SessionKeys) Destroy() {
+    if k == nil {
+        return
+    }
+
+    k.Encryption.Destroy()
+    k.MAC.Destroy()
+    k.Rekey.Destroy()
+}
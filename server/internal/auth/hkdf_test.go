@@ -0,0 +1,107 @@
+package auth
+
+import (
+    "bytes"
+    "encoding/hex"
+    "testing"
+)
+
+// byteRange returns the bytes from through to, inclusive, as the RFC 5869
+// test vectors write their inputs.
+func byteRange(from, to byte) []byte {
+    out := make([]byte, 0, int(to)-int(from)+1)
+    for b := int(from); b <= int(to); b++ {
+        out = append(out, byte(b))
+    }
+    return out
+}
+
+func mustHex(t *testing.T, s string) []byte {
+    t.Helper()
+    b, err := hex.DecodeString(s)
+    if err != nil {
+        t.Fatalf("bad hex %q: %v", s, err)
+    }
+    return b
+}
+
+// TestHKDFRFC5869 checks HKDFExtract and HKDFExpand against the SHA-256
+// test cases of RFC 5869, appendix A.
+func TestHKDFRFC5869(t *testing.T) {
+    tests := []struct {
+        name string
+        ikm  []byte
+        salt []byte
+        info []byte
+        size int
+        prk  string
+        okm  string
+    }{
+        {
+            name: "basic",
+            ikm:  bytes.Repeat([]byte{0x0b}, 22),
+            salt: byteRange(0x00, 0x0c),
+            info: byteRange(0xf0, 0xf9),
+            size: 42,
+            prk:  "077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5",
+            okm:  "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+        },
+        {
+            name: "longer inputs and outputs",
+            ikm:  byteRange(0x00, 0x4f),
+            salt: byteRange(0x60, 0xaf),
+            info: byteRange(0xb0, 0xff),
+            size: 82,
+            prk:  "06a6b88c5853361a06104c9ceb35b45cef760014904671014a193f40c15fc244",
+            okm: "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c" +
+                "59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71" +
+                "cc30c58179ec3e87c14c01d5c1f3434f1d87",
+        },
+        {
+            name: "zero-length salt and info",
+            ikm:  bytes.Repeat([]byte{0x0b}, 22),
+            salt: []byte{},
+            info: nil,
+            size: 42,
+            prk:  "19ef24a32c717b167f33a91d6f648bdf96596776afdb6377ac434c1c293ccb04",
+            okm:  "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+        },
+        {
+            // HMAC pads a short key with zeros, so a missing salt gives the
+            // same result as the zero-length one.
+            name: "nil salt",
+            ikm:  bytes.Repeat([]byte{0x0b}, 22),
+            salt: nil,
+            info: nil,
+            size: 42,
+            prk:  "19ef24a32c717b167f33a91d6f648bdf96596776afdb6377ac434c1c293ccb04",
+            okm:  "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            prk := HKDFExtract(tt.salt, tt.ikm)
+            if want := mustHex(t, tt.prk); !bytes.Equal(prk, want) {
+                t.Fatalf("PRK = %x, want %x", prk, want)
+            }
+
+            okm, err := HKDFExpand(prk, string(tt.info), tt.size)
+            if err != nil {
+                t.Fatalf("HKDFExpand: %v", err)
+            }
+            if want := mustHex(t, tt.okm); !bytes.Equal(okm, want) {
+                t.Errorf("OKM = %x, want %x", okm, want)
+            }
+        })
+    }
+}
+
+func TestHKDFExpandRejectsBadSizes(t *testing.T) {
+    prk := HKDFExtract(nil, []byte("secret"))
+    for _, size := range []int{-1, 0, 255*32 + 1} {
+        if _, err := HKDFExpand(prk, "info", size); err == nil {
+            t.Errorf("HKDFExpand with size %d succeeded, want an error", size)
+        }
+    }
+}
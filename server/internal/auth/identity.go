@@ -0,0 +1,75 @@
+package auth
+
+import (
+    "crypto/ed25519"
+    "encoding/base64"
+    "encoding/hex"
+    "strings"
+)
+
+// Purposes an identity signature can cover. The purpose is part of the
+// signed payload, so a signature for one kind of key cannot be replayed as
+// another.
+const (
+    IdentityPurposeRSA      = "rsa"
+    IdentityPurposeECDH     = "ecdh"
+    IdentityPurposeRotation = "rotation"
+)
+
+// ServerIdentity is the server's long-term Ed25519 identity key. It signs
+// the server's other public key material, so clients can pin a single
+// fingerprint and notice when any key they are handed was substituted.
+type ServerIdentity struct {
+    privateKey ed25519.PrivateKey
+    publicKey  ed25519.PublicKey
+}
+
+// LoadOrCreateIdentity loads the identity key at path, generating and
+// saving a new one if the file does not exist.
+func LoadOrCreateIdentity(path string) (*ServerIdentity, bool, error) {
+    privateKey, created, err := loadOrCreateEd25519Key(path)
+    if err != nil {
+        return nil, false, err
+    }
+    return newServerIdentity(privateKey), created, nil
+}
+
+// LoadIdentity loads an existing identity key, such as a retired one kept to
+// vouch for its successor.
+func LoadIdentity(path string) (*ServerIdentity, error) {
+    privateKey, err := loadEd25519Key(path)
+    if err != nil {
+        return nil, err
+    }
+    return newServerIdentity(privateKey), nil
+}
+
+func newServerIdentity(privateKey ed25519.PrivateKey) *ServerIdentity {
+    return &ServerIdentity{
+        privateKey: privateKey,
+        publicKey:  privateKey.Public().(ed25519.PublicKey),
+    }
+}
+
+// PublicKey returns the raw public key as base64url.
+func (id *ServerIdentity) PublicKey() string {
+    return base64.RawURLEncoding.EncodeToString(id.publicKey)
+}
+
+// Fingerprint is the hex SHA-256 of the raw public key, the value clients
+// pin.
+func (id *ServerIdentity) Fingerprint() string {
+    return hex.EncodeToString(HashSHA256Bytes(id.publicKey))
+}
+
+// IdentityPayload is the byte string an identity signature covers:
+// "onyxirc-identity-v1\n<server name>\n<purpose>\n<material>...", with one
+// line per piece of key material.
+func IdentityPayload(serverName, purpose string, material ...string) []byte {
+    return []byte(strings.Join(append([]string{"onyxirc-identity-v1", serverName, purpose}, material...), "\n"))
+}
+
+// Sign returns the base64url signature over IdentityPayload.
+func (id *ServerIdentity) Sign(serverName, purpose string, material ...string) string {
+    return base64.RawURLEncoding.EncodeToString(ed25519.Sign(id.privateKey, IdentityPayload(serverName, purpose, material...)))
+}
@@ -0,0 +1,74 @@
+package auth
+
+import "sync"
+
+// Zero overwrites b in place so key material does not linger in memory.
+func Zero(b []byte) {
+    for i := range b {
+        b[i] = 0
+    }
+}
+
+// KeyBuffer owns a copy of a secret key. The copy is wiped on Destroy and,
+// when locking is requested and the platform supports it, kept out of swap.
+// Its String form never includes the key, so a buffer passed to a log or
+// error format by mistake prints as redacted.
+type KeyBuffer struct {
+    mu     sync.Mutex
+    data   []byte
+    locked bool
+}
+
+// NewKeyBuffer copies key into a buffer of its own and zeroes key.
+func NewKeyBuffer(key []byte, lock bool) *KeyBuffer {
+    buf := &KeyBuffer{data: make([]byte, len(key))}
+    copy(buf.data, key)
+    Zero(key)
+
+    if lock && len(buf.data) > 0 {
+        buf.locked = lockMemory(buf.data) == nil
+    }
+
+    return buf
+}
+
+// Bytes returns the key, or nil once the buffer has been destroyed. Callers
+// must not keep the slice beyond the call that needs it.
+func (k *KeyBuffer) Bytes() []byte {
+    if k == nil {
+        return nil
+    }
+
+    k.mu.Lock()
+    defer k.mu.Unlock()
+
+    return k.data
+}
+
+func (k *KeyBuffer) Destroy() {
+    if k == nil {
+        return
+    }
+
+    k.mu.Lock()
+    defer k.mu.Unlock()
+
+    if k.data == nil {
+        return
+    }
+
+    Zero(k.data)
+    if k.locked {
+        unlockMemory(k.data)
+        k.locked = false
+    }
+    k.data = nil
+}
+
+func (k *KeyBuffer) String() string {
+    return "[REDACTED]"
+}
+
+func (k *KeyBuffer) GoString() string {
+    return "auth.KeyBuffer{[REDACTED]}"
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package auth
+
+import "syscall"
+
+func lockMemory(b []byte) error {
+    return syscall.Mlock(b)
+}
+
+func unlockMemory(b []byte) {
+    syscall.Munlock(b)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package auth
+
+import "errors"
+
+func lockMemory(b []byte) error {
+    return errors.New("memory locking is not supported on this platform")
+}
+
+func unlockMemory(b []byte) {}
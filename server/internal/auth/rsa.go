@@ -5,6 +5,8 @@ import (
     "crypto/rsa"
     "crypto/sha256"
     "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
     "encoding/pem"
     "fmt"
     "os"
@@ -165,3 +167,48 @@ func (kp *RSAKeyPair) GetPublicKeyPEM() ([]byte, error) {
 
     return publicKeyPEM, nil
 }
+
+func ParsePublicKey(encoded string) (*rsa.PublicKey, error) {
+    data, err := base64.StdEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, fmt.Errorf("base64 decode failed: %w", err)
+    }
+
+    if block, _ := pem.Decode(data); block != nil {
+        data = block.Bytes
+    }
+
+    publicKeyInterface, err := x509.ParsePKIXPublicKey(data)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse public key: %w", err)
+    }
+
+    publicKey, ok := publicKeyInterface.(*rsa.PublicKey)
+    if !ok {
+        return nil, fmt.Errorf("not an RSA public key")
+    }
+
+    if publicKey.N.BitLen() < 2048 {
+        return nil, fmt.Errorf("RSA public key must be at least 2048 bits")
+    }
+
+    return publicKey, nil
+}
+
+func EncodePublicKey(publicKey *rsa.PublicKey) (string, error) {
+    publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to marshal public key: %w", err)
+    }
+
+    return base64.StdEncoding.EncodeToString(publicKeyBytes), nil
+}
+
+func PublicKeyFingerprint(publicKey *rsa.PublicKey) (string, error) {
+    publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to marshal public key: %w", err)
+    }
+
+    return hex.EncodeToString(HashSHA256Bytes(publicKeyBytes)), nil
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+)
+
+// Stamp is the provenance of a relayed channel message. The server signs
+// its canonical form so transcripts and bridged copies can be checked
+// against the server's public signing key.
+type Stamp struct {
+    MsgID       string
+    Channel     string
+    Author      string
+    Timestamp   time.Time
+    ContentHash string
+}
+
+// Payload is the canonical byte string that is signed:
+// "onyxirc-msg-v1\n<msgid>\n<channel>\n<author>\n<unix seconds>\n<content hash>".
+func (st Stamp) Payload() []byte {
+    return []byte(strings.Join([]string{
+        "onyxirc-msg-v1",
+        st.MsgID,
+        strings.ToLower(st.Channel),
+        st.Author,
+        fmt.Sprintf("%d", st.Timestamp.Unix()),
+        st.ContentHash,
+    }, "\n"))
+}
+
+// EventStamp covers one line of an observer's event stream. Seq numbers the
+// lines sent to that observer, so gaps and reordering are detectable.
+type EventStamp struct {
+    Observer  string
+    Seq       int64
+    Timestamp time.Time
+    LineHash  string
+}
+
+// Payload is "onyxirc-event-v1\n<observer>\n<seq>\n<unix seconds>\n<line hash>".
+func (ev EventStamp) Payload() []byte {
+    return []byte(strings.Join([]string{
+        "onyxirc-event-v1",
+        ev.Observer,
+        fmt.Sprintf("%d", ev.Seq),
+        fmt.Sprintf("%d", ev.Timestamp.Unix()),
+        ev.LineHash,
+    }, "\n"))
+}
+
+// Signable is anything with a canonical form to sign.
+type Signable interface {
+    Payload() []byte
+}
+
+type MessageSigner struct {
+    privateKey ed25519.PrivateKey
+    publicKey  ed25519.PublicKey
+}
+
+// LoadOrCreateMessageSigner loads the Ed25519 signing key at path,
+// generating and saving a new one if the file does not exist.
+func LoadOrCreateMessageSigner(path string) (*MessageSigner, bool, error) {
+    privateKey, created, err := loadOrCreateEd25519Key(path)
+    if err != nil {
+        return nil, false, err
+    }
+    return NewMessageSigner(privateKey), created, nil
+}
+
+// LoadMessageSigner loads an existing signing key without generating one.
+func LoadMessageSigner(path string) (*MessageSigner, error) {
+    privateKey, err := loadEd25519Key(path)
+    if err != nil {
+        return nil, err
+    }
+    return NewMessageSigner(privateKey), nil
+}
+
+func loadOrCreateEd25519Key(path string) (ed25519.PrivateKey, bool, error) {
+    if _, err := os.Stat(path); err != nil {
+        if !os.IsNotExist(err) {
+            return nil, false, fmt.Errorf("failed to read key file: %w", err)
+        }
+
+        _, privateKey, err := ed25519.GenerateKey(rand.Reader)
+        if err != nil {
+            return nil, false, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+        }
+
+        if err := saveEd25519Key(path, privateKey); err != nil {
+            return nil, false, err
+        }
+
+        return privateKey, true, nil
+    }
+
+    privateKey, err := loadEd25519Key(path)
+    return privateKey, false, err
+}
+
+func loadEd25519Key(path string) (ed25519.PrivateKey, error) {
+    keyData, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read key file: %w", err)
+    }
+
+    block, _ := pem.Decode(keyData)
+    if block == nil {
+        return nil, fmt.Errorf("failed to decode PEM block")
+    }
+
+    parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse Ed25519 key: %w", err)
+    }
+
+    privateKey, ok := parsed.(ed25519.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+    }
+
+    return privateKey, nil
+}
+
+func saveEd25519Key(path string, privateKey ed25519.PrivateKey) error {
+    keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+    if err != nil {
+        return fmt.Errorf("failed to marshal Ed25519 key: %w", err)
+    }
+
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return fmt.Errorf("failed to create key file: %w", err)
+    }
+    defer file.Close()
+
+    if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}); err != nil {
+        return fmt.Errorf("failed to write key file: %w", err)
+    }
+
+    return nil
+}
+
+func NewMessageSigner(privateKey ed25519.PrivateKey) *MessageSigner {
+    return &MessageSigner{
+        privateKey: privateKey,
+        publicKey:  privateKey.Public().(ed25519.PublicKey),
+    }
+}
+
+// Sign returns the base64url signature of the stamp, or "" without a signer.
+func (s *MessageSigner) Sign(st Signable) string {
+    if s == nil {
+        return ""
+    }
+    return base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.privateKey, st.Payload()))
+}
+
+// PublicKey returns the verification key as base64url, the form published
+// in transcripts and by SIGNKEY.
+func (s *MessageSigner) PublicKey() string {
+    if s == nil {
+        return ""
+    }
+    return base64.RawURLEncoding.EncodeToString(s.publicKey)
+}
+
+func VerifyStamp(publicKey string, st Signable, signature string) error {
+    keyBytes, err := base64.RawURLEncoding.DecodeString(publicKey)
+    if err != nil || len(keyBytes) != ed25519.PublicKeySize {
+        return fmt.Errorf("invalid signing key")
+    }
+
+    sig, err := base64.RawURLEncoding.DecodeString(signature)
+    if err != nil || len(sig) != ed25519.SignatureSize {
+        return fmt.Errorf("invalid signature encoding")
+    }
+
+    if !ed25519.Verify(ed25519.PublicKey(keyBytes), st.Payload(), sig) {
+        return fmt.Errorf("signature does not match")
+    }
+
+    return nil
+}
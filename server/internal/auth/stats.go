@@ -0,0 +1,98 @@
+package auth
+
+import (
+    "sync"
+    "time"
+)
+
+const (
+    OpRSAEncrypt = "rsa_encrypt"
+    OpRSADecrypt = "rsa_decrypt"
+    OpAESEncrypt = "aes_encrypt"
+    OpAESDecrypt = "aes_decrypt"
+    OpECDH       = "ecdh"
+)
+
+type opStats struct {
+    count      int64
+    failures   int64
+    totalNanos int64
+    maxNanos   int64
+}
+
+// CryptoStats counts crypto operations and their latencies, plus key
+// exchange failures by cause. A steady rise in failures usually means a
+// client with broken crypto or someone probing the server.
+type CryptoStats struct {
+    ops               map[string]*opStats
+    handshakeFailures map[string]int64
+    mu                sync.Mutex
+}
+
+func NewCryptoStats() *CryptoStats {
+    stats := &CryptoStats{
+        ops:               make(map[string]*opStats),
+        handshakeFailures: make(map[string]int64),
+    }
+    for _, op := range []string{OpRSAEncrypt, OpRSADecrypt, OpAESEncrypt, OpAESDecrypt, OpECDH} {
+        stats.ops[op] = &opStats{}
+    }
+    return stats
+}
+
+func (s *CryptoStats) Observe(op string, started time.Time, err error) {
+    elapsed := time.Since(started).Nanoseconds()
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    stats, ok := s.ops[op]
+    if !ok {
+        stats = &opStats{}
+        s.ops[op] = stats
+    }
+
+    stats.count++
+    stats.totalNanos += elapsed
+    if elapsed > stats.maxNanos {
+        stats.maxNanos = elapsed
+    }
+    if err != nil {
+        stats.failures++
+    }
+}
+
+func (s *CryptoStats) HandshakeFailure(cause string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.handshakeFailures[cause]++
+}
+
+func (s *CryptoStats) Snapshot() map[string]int64 {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    snapshot := make(map[string]int64, len(s.ops)*4+len(s.handshakeFailures))
+    for op, stats := range s.ops {
+        prefix := "crypto." + op
+        snapshot[prefix+".count"] = stats.count
+        snapshot[prefix+".failures"] = stats.failures
+        snapshot[prefix+".max_us"] = stats.maxNanos / int64(time.Microsecond)
+        if stats.count > 0 {
+            snapshot[prefix+".avg_us"] = stats.totalNanos / stats.count / int64(time.Microsecond)
+        } else {
+            snapshot[prefix+".avg_us"] = 0
+        }
+    }
+
+    var total int64
+    for cause, count := range s.handshakeFailures {
+        snapshot["crypto.handshake_failures."+cause] = count
+        total += count
+    }
+    snapshot["crypto.handshake_failures"] = total
+
+    return snapshot
+}
+
@@ -0,0 +1,409 @@
+// Package cluster lets several server processes behind a load balancer act
+// as one server. Nodes share the database, publish broadcasts to each other
+// over Redis pub/sub and keep a presence list of their sessions in Redis.
+package cluster
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+const (
+    defaultKeyPrefix        = "onyxirc"
+    defaultPresenceInterval = 10 * time.Second
+    publishQueueSize        = 4096
+    resubscribeDelay        = 2 * time.Second
+    presenceHeartbeat       = "_heartbeat"
+)
+
+// Event kinds, each a broadcast the publishing node also delivered locally.
+const (
+    KindNotice     = "notice"     // Message to every client
+    KindChannels   = "channels"   // Message to members of ChannelIDs
+    KindMessage    = "message"    // Channel PRIVMSG with Seq, SentAt and Signature
+    KindRelayed    = "relayed"    // Channel PRIVMSG from a linked server
+    KindUserNotice = "usernotice" // NOTICE text to UserID's clients
+    KindDirect     = "direct"     // Line to UserID's clients
+    KindDisconnect = "disconnect" // Message to Username's clients, then drop them
+    KindResume     = "resume"     // The session with hash Session moved to another node
+    KindChannel    = "channel"    // ChannelIDs changed in the database; none means all
+)
+
+type Event struct {
+    Node       string    `json:"node"`
+    Kind       string    `json:"kind"`
+    ChannelIDs []int64   `json:"channel_ids,omitempty"`
+    UserID     int64     `json:"user_id,omitempty"`
+    Username   string    `json:"username,omitempty"`
+    Session    string    `json:"session,omitempty"`
+    Message    string    `json:"message,omitempty"`
+    Seq        int64     `json:"seq,omitempty"`
+    MsgID      string    `json:"msgid,omitempty"`
+    SentAt     time.Time `json:"sent_at,omitempty"`
+    Signature  string    `json:"signature,omitempty"`
+}
+
+// Presence is one session connected to a node. Ref identifies the session
+// without revealing its ID, which is a resume token.
+type Presence struct {
+    Ref      string
+    UserID   int64
+    Username string
+}
+
+type Cluster struct {
+    cfg        config.ClusterConfig
+    node       string
+    prefix     string
+    interval   time.Duration
+    conn       *redisConn
+    connMu     sync.Mutex
+    sub        *redisConn
+    subMu      sync.Mutex
+    outbox     chan []byte
+    online     map[int64]int
+    nodes      map[string]int
+    presenceMu sync.RWMutex
+    shutdown   chan struct{}
+    wg         sync.WaitGroup
+}
+
+// New prepares a cluster node. namespace keeps tenants sharing one Redis
+// apart.
+func New(cfg config.ClusterConfig, namespace string) *Cluster {
+    node := cfg.NodeID
+    if node == "" {
+        hostname, _ := os.Hostname()
+        node = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+    }
+
+    prefix := cfg.KeyPrefix
+    if prefix == "" {
+        prefix = defaultKeyPrefix
+    }
+
+    interval := cfg.PresenceInterval
+    if interval <= 0 {
+        interval = defaultPresenceInterval
+    }
+
+    return &Cluster{
+        cfg:      cfg,
+        node:     node,
+        prefix:   prefix + ":" + namespace,
+        interval: interval,
+        outbox:   make(chan []byte, publishQueueSize),
+        online:   make(map[int64]int),
+        nodes:    make(map[string]int),
+        shutdown: make(chan struct{}),
+    }
+}
+
+func (c *Cluster) Node() string {
+    return c.node
+}
+
+// Start connects to Redis and begins delivering events from other nodes to
+// handle and publishing this node's sessions, as listed by presence.
+func (c *Cluster) Start(handle func(*Event), presence func() []Presence) error {
+    conn, err := dialRedis(c.cfg)
+    if err != nil {
+        return err
+    }
+    c.conn = conn
+
+    c.wg.Add(3)
+    go c.publishLoop()
+    go c.subscribeLoop(handle)
+    go c.presenceLoop(presence)
+
+    log.Printf("Cluster node %s connected to redis at %s", c.node, c.cfg.RedisAddress)
+    return nil
+}
+
+// Close stops the node and removes its presence so other nodes stop
+// counting its sessions straight away.
+func (c *Cluster) Close() {
+    close(c.shutdown)
+
+    c.subMu.Lock()
+    if c.sub != nil {
+        c.sub.close()
+    }
+    c.subMu.Unlock()
+
+    c.wg.Wait()
+
+    if _, err := c.do("DEL", c.presenceKey(c.node)); err != nil {
+        log.Printf("Failed to clear cluster presence: %v", err)
+    }
+    c.do("SREM", c.prefix+":nodes", c.node)
+
+    c.connMu.Lock()
+    if c.conn != nil {
+        c.conn.close()
+    }
+    c.connMu.Unlock()
+}
+
+// Publish queues e for the other nodes. Events are dropped, not delayed,
+// when Redis cannot keep up.
+func (c *Cluster) Publish(e *Event) {
+    e.Node = c.node
+
+    payload, err := json.Marshal(e)
+    if err != nil {
+        log.Printf("Failed to encode cluster event: %v", err)
+        return
+    }
+
+    select {
+    case c.outbox <- payload:
+    default:
+        log.Printf("Cluster publish queue full, dropping %s event", e.Kind)
+    }
+}
+
+// Online reports whether userID has a session on another node, as of the
+// last presence refresh.
+func (c *Cluster) Online(userID int64) bool {
+    c.presenceMu.RLock()
+    defer c.presenceMu.RUnlock()
+
+    return c.online[userID] > 0
+}
+
+// Nodes returns the session count of every other live node.
+func (c *Cluster) Nodes() map[string]int {
+    c.presenceMu.RLock()
+    defer c.presenceMu.RUnlock()
+
+    nodes := make(map[string]int, len(c.nodes))
+    for node, count := range c.nodes {
+        nodes[node] = count
+    }
+    return nodes
+}
+
+func (c *Cluster) eventsChannel() string {
+    return c.prefix + ":events"
+}
+
+func (c *Cluster) presenceKey(node string) string {
+    return c.prefix + ":presence:" + node
+}
+
+// do runs a command on the shared connection, redialling if the previous
+// command failed.
+func (c *Cluster) do(args ...string) (interface{}, error) {
+    c.connMu.Lock()
+    defer c.connMu.Unlock()
+
+    if c.conn == nil {
+        conn, err := dialRedis(c.cfg)
+        if err != nil {
+            return nil, err
+        }
+        c.conn = conn
+    }
+
+    reply, err := c.conn.do(args...)
+    if err != nil {
+        if _, ok := err.(redisError); !ok {
+            c.conn.close()
+            c.conn = nil
+        }
+        return nil, err
+    }
+    return reply, nil
+}
+
+func (c *Cluster) publishLoop() {
+    defer c.wg.Done()
+
+    for {
+        select {
+        case <-c.shutdown:
+            return
+        case payload := <-c.outbox:
+            if _, err := c.do("PUBLISH", c.eventsChannel(), string(payload)); err != nil {
+                log.Printf("Failed to publish cluster event: %v", err)
+            }
+        }
+    }
+}
+
+func (c *Cluster) subscribeLoop(handle func(*Event)) {
+    defer c.wg.Done()
+
+    for {
+        if err := c.subscribe(handle); err != nil {
+            log.Printf("Cluster subscription lost: %v", err)
+        }
+
+        select {
+        case <-c.shutdown:
+            return
+        case <-time.After(resubscribeDelay):
+        }
+    }
+}
+
+func (c *Cluster) subscribe(handle func(*Event)) error {
+    sub, err := dialRedis(c.cfg)
+    if err != nil {
+        return err
+    }
+
+    c.subMu.Lock()
+    select {
+    case <-c.shutdown:
+        c.subMu.Unlock()
+        sub.close()
+        return nil
+    default:
+    }
+    c.sub = sub
+    c.subMu.Unlock()
+
+    defer func() {
+        c.subMu.Lock()
+        c.sub = nil
+        c.subMu.Unlock()
+        sub.close()
+    }()
+
+    if err := sub.send("SUBSCRIBE", c.eventsChannel()); err != nil {
+        return err
+    }
+    if err := sub.writer.Flush(); err != nil {
+        return err
+    }
+
+    for {
+        reply, err := sub.receive()
+        if err != nil {
+            select {
+            case <-c.shutdown:
+                return nil
+            default:
+                return err
+            }
+        }
+
+        fields := replyStrings(reply)
+        if len(fields) != 3 || fields[0] != "message" {
+            continue
+        }
+
+        var event Event
+        if err := json.Unmarshal([]byte(fields[2]), &event); err != nil {
+            log.Printf("Ignoring malformed cluster event: %v", err)
+            continue
+        }
+        if event.Node == c.node {
+            continue
+        }
+
+        handle(&event)
+    }
+}
+
+// presenceLoop rewrites this node's session list every interval with a TTL
+// of three intervals, so a crashed node's sessions age out, and reads the
+// lists of the other nodes.
+func (c *Cluster) presenceLoop(presence func() []Presence) {
+    defer c.wg.Done()
+
+    ticker := time.NewTicker(c.interval)
+    defer ticker.Stop()
+
+    for {
+        if err := c.refreshPresence(presence()); err != nil {
+            log.Printf("Failed to refresh cluster presence: %v", err)
+        }
+
+        select {
+        case <-c.shutdown:
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (c *Cluster) refreshPresence(sessions []Presence) error {
+    key := c.presenceKey(c.node)
+    ttl := strconv.Itoa(int((3 * c.interval).Seconds()))
+
+    // The heartbeat field keeps the key alive for a node without sessions.
+    args := []string{"HSET", key, presenceHeartbeat, strconv.FormatInt(time.Now().Unix(), 10)}
+    for _, session := range sessions {
+        args = append(args, session.Ref, fmt.Sprintf("%d %s", session.UserID, session.Username))
+    }
+
+    if _, err := c.do("DEL", key); err != nil {
+        return err
+    }
+    if _, err := c.do(args...); err != nil {
+        return err
+    }
+    if _, err := c.do("EXPIRE", key, ttl); err != nil {
+        return err
+    }
+    if _, err := c.do("SADD", c.prefix+":nodes", c.node); err != nil {
+        return err
+    }
+
+    reply, err := c.do("SMEMBERS", c.prefix+":nodes")
+    if err != nil {
+        return err
+    }
+
+    online := make(map[int64]int)
+    nodes := make(map[string]int)
+    for _, node := range replyStrings(reply) {
+        if node == c.node {
+            continue
+        }
+
+        reply, err := c.do("HGETALL", c.presenceKey(node))
+        if err != nil {
+            return err
+        }
+        fields := replyStrings(reply)
+
+        if len(fields) == 0 {
+            // The key expired: the node stopped without cleaning up.
+            c.do("SREM", c.prefix+":nodes", node)
+            continue
+        }
+
+        sessions := 0
+        for i := 0; i+1 < len(fields); i += 2 {
+            if fields[i] == presenceHeartbeat {
+                continue
+            }
+            userField := strings.SplitN(fields[i+1], " ", 2)[0]
+            if userID, err := strconv.ParseInt(userField, 10, 64); err == nil {
+                online[userID]++
+                sessions++
+            }
+        }
+        nodes[node] = sessions
+    }
+
+    c.presenceMu.Lock()
+    c.online = online
+    c.nodes = nodes
+    c.presenceMu.Unlock()
+
+    return nil
+}
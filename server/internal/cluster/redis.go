@@ -0,0 +1,163 @@
+package cluster
+
+import (
+    "bufio"
+    "crypto/tls"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+const redisTimeout = 5 * time.Second
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string {
+    return "redis: " + string(e)
+}
+
+// redisConn is a minimal RESP2 client: enough for the handful of commands
+// clustering needs, without pulling in a driver.
+type redisConn struct {
+    conn   net.Conn
+    reader *bufio.Reader
+    writer *bufio.Writer
+}
+
+func dialRedis(cfg config.ClusterConfig) (*redisConn, error) {
+    dialer := &net.Dialer{Timeout: redisTimeout}
+
+    var conn net.Conn
+    var err error
+    if cfg.RedisTLS {
+        conn, err = tls.DialWithDialer(dialer, "tcp", cfg.RedisAddress, &tls.Config{MinVersion: tls.VersionTLS12})
+    } else {
+        conn, err = dialer.Dial("tcp", cfg.RedisAddress)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to redis at %s: %w", cfg.RedisAddress, err)
+    }
+
+    c := &redisConn{
+        conn:   conn,
+        reader: bufio.NewReader(conn),
+        writer: bufio.NewWriter(conn),
+    }
+
+    if cfg.RedisPassword != "" {
+        if _, err := c.do("AUTH", cfg.RedisPassword); err != nil {
+            c.close()
+            return nil, fmt.Errorf("failed to authenticate with redis: %w", err)
+        }
+    }
+
+    if cfg.RedisDB != 0 {
+        if _, err := c.do("SELECT", strconv.Itoa(cfg.RedisDB)); err != nil {
+            c.close()
+            return nil, fmt.Errorf("failed to select redis database: %w", err)
+        }
+    }
+
+    return c, nil
+}
+
+func (c *redisConn) close() {
+    c.conn.Close()
+}
+
+// do sends one command and reads its reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+    c.conn.SetDeadline(time.Now().Add(redisTimeout))
+    defer c.conn.SetDeadline(time.Time{})
+
+    if err := c.send(args...); err != nil {
+        return nil, err
+    }
+    if err := c.writer.Flush(); err != nil {
+        return nil, err
+    }
+    return c.receive()
+}
+
+func (c *redisConn) send(args ...string) error {
+    fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+    for _, arg := range args {
+        fmt.Fprintf(c.writer, "$%d\r\n", len(arg))
+        c.writer.WriteString(arg)
+        if _, err := c.writer.WriteString("\r\n"); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// receive reads one reply: a string, int64, nil, []interface{} or a
+// redisError returned as the error.
+func (c *redisConn) receive() (interface{}, error) {
+    line, err := c.reader.ReadString('\n')
+    if err != nil {
+        return nil, err
+    }
+    line = strings.TrimSuffix(line, "\r\n")
+    if line == "" {
+        return nil, fmt.Errorf("redis: empty reply")
+    }
+
+    switch line[0] {
+    case '+':
+        return line[1:], nil
+    case '-':
+        return nil, redisError(line[1:])
+    case ':':
+        return strconv.ParseInt(line[1:], 10, 64)
+    case '$':
+        size, err := strconv.Atoi(line[1:])
+        if err != nil {
+            return nil, fmt.Errorf("redis: bad bulk length %q", line)
+        }
+        if size < 0 {
+            return nil, nil
+        }
+        buf := make([]byte, size+2)
+        if _, err := io.ReadFull(c.reader, buf); err != nil {
+            return nil, err
+        }
+        return string(buf[:size]), nil
+    case '*':
+        count, err := strconv.Atoi(line[1:])
+        if err != nil {
+            return nil, fmt.Errorf("redis: bad array length %q", line)
+        }
+        if count < 0 {
+            return nil, nil
+        }
+        items := make([]interface{}, count)
+        for i := range items {
+            if items[i], err = c.receive(); err != nil {
+                if _, ok := err.(redisError); !ok {
+                    return nil, err
+                }
+            }
+        }
+        return items, nil
+    default:
+        return nil, fmt.Errorf("redis: unexpected reply %q", line)
+    }
+}
+
+func replyStrings(reply interface{}) []string {
+    items, _ := reply.([]interface{})
+    strs := make([]string, 0, len(items))
+    for _, item := range items {
+        if s, ok := item.(string); ok {
+            strs = append(strs, s)
+        }
+    }
+    return strs
+}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+)
+
+// HeaderSize is the length prefix of a frame: the payload size as a 4-byte
+// big-endian integer. The payload that follows may contain any bytes,
+// including CR, LF and NUL.
+const HeaderSize = 4
+
+// ErrFrameTooLarge is returned for a frame over the decoder's limit. The
+// oversized payload has already been skipped, so decoding can continue.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// AppendFrame appends payload to dst as one frame.
+func AppendFrame(dst, payload []byte) []byte {
+    var header [HeaderSize]byte
+    binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+    dst = append(dst, header[:]...)
+    return append(dst, payload...)
+}
+
+// Encode returns payload as a single frame.
+func Encode(payload []byte) []byte {
+    return AppendFrame(make([]byte, 0, HeaderSize+len(payload)), payload)
+}
+
+// WriteFrame writes payload to w as one frame.
+func WriteFrame(w io.Writer, payload []byte) error {
+    if uint64(len(payload)) > uint64(^uint32(0)) {
+        return fmt.Errorf("payload of %d bytes does not fit in a frame", len(payload))
+    }
+
+    if _, err := w.Write(Encode(payload)); err != nil {
+        return fmt.Errorf("failed to write frame: %w", err)
+    }
+    return nil
+}
+
+type Decoder struct {
+    r       io.Reader
+    maxSize int
+    header  [HeaderSize]byte
+}
+
+// NewDecoder reads frames from r, refusing payloads over maxSize bytes.
+func NewDecoder(r io.Reader, maxSize int) *Decoder {
+    return &Decoder{r: r, maxSize: maxSize}
+}
+
+// Decode returns the payload of the next frame. A clean end of stream
+// between frames is io.EOF; one inside a frame is io.ErrUnexpectedEOF.
+func (d *Decoder) Decode() ([]byte, error) {
+    if _, err := io.ReadFull(d.r, d.header[:]); err != nil {
+        return nil, err
+    }
+
+    size := binary.BigEndian.Uint32(d.header[:])
+    if uint64(size) > uint64(d.maxSize) {
+        if _, err := io.CopyN(io.Discard, d.r, int64(size)); err != nil {
+            return nil, io.ErrUnexpectedEOF
+        }
+        return nil, ErrFrameTooLarge
+    }
+
+    payload := make([]byte, size)
+    if _, err := io.ReadFull(d.r, payload); err != nil {
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        return nil, err
+    }
+
+    return payload, nil
+}
@@ -2,12 +2,22 @@ package config
 
 import (
     "fmt"
+    "net"
     "os"
+    "path/filepath"
+    "strconv"
+    "strings"
     "time"
 
     "gopkg.in/yaml.v3"
 )
 
+const (
+    minLineLength        = 512
+    minCloakSecretLength = 16
+    maxPasteSize         = 32768
+)
+
 type Config struct {
     Server     ServerConfig     `yaml:"server"`
     Database   DatabaseConfig   `yaml:"database"`
@@ -15,42 +25,154 @@ type Config struct {
     ThreadPool ThreadPoolConfig `yaml:"threadpool"`
     Logging    LoggingConfig    `yaml:"logging"`
     Features   FeaturesConfig   `yaml:"features"`
+    Export     ExportConfig     `yaml:"export"`
+    Inactivity InactivityConfig `yaml:"inactivity"`
+    Accounts   AccountsConfig   `yaml:"accounts"`
+    SMTP       SMTPConfig       `yaml:"smtp"`
+    Maintenance MaintenanceConfig `yaml:"maintenance"`
+    Search     SearchConfig     `yaml:"search"`
+    API        APIConfig        `yaml:"api"`
+    JoinThrottle JoinThrottleConfig `yaml:"join_throttle"`
+    Lockdown   LockdownConfig   `yaml:"lockdown"`
+    Bots       BotsConfig       `yaml:"bots"`
+    Filter     FilterConfig     `yaml:"filter"`
+    Spam       SpamConfig       `yaml:"spam"`
+    Plugins    PluginsConfig    `yaml:"plugins"`
+    Links      LinksConfig      `yaml:"links"`
+    Cluster    ClusterConfig    `yaml:"cluster"`
+    DNSBL      DNSBLConfig      `yaml:"dnsbl"`
+    Tenants    []TenantConfig   `yaml:"tenants"`
+    Include    []string             `yaml:"include"`
+    Profile    string               `yaml:"profile"`
+    Profiles   map[string]yaml.Node `yaml:"profiles"`
+}
+
+type TenantConfig struct {
+    ID         string           `yaml:"id"`
+    ServerName string           `yaml:"server_name"`
+    Listeners  []ListenerConfig `yaml:"listeners"`
+    Overrides  yaml.Node        `yaml:"overrides"`
 }
 
 type ServerConfig struct {
-    Host           string        `yaml:"host"`
-    Port           int           `yaml:"port"`
-    MaxConnections int           `yaml:"max_connections"`
-    ReadTimeout    time.Duration `yaml:"read_timeout"`
-    WriteTimeout   time.Duration `yaml:"write_timeout"`
-    ServerName     string        `yaml:"server_name"`
-    MOTD           string        `yaml:"motd"`
+    Host            string           `yaml:"host"`
+    Port            int              `yaml:"port"`
+    MaxConnections  int              `yaml:"max_connections"`
+    ReadTimeout     time.Duration    `yaml:"read_timeout"`
+    WriteTimeout    time.Duration    `yaml:"write_timeout"`
+    ServerName      string           `yaml:"server_name"`
+    MOTD            string           `yaml:"motd"`
+    DrainTimeout    time.Duration    `yaml:"drain_timeout"`
+    PingInterval    time.Duration    `yaml:"ping_interval"`
+    PingTimeout     time.Duration    `yaml:"ping_timeout"`
+    MaxMissedPongs  int              `yaml:"max_missed_pongs"`
+    MaxLineLength   int              `yaml:"max_line_length"`
+    Listeners       []ListenerConfig `yaml:"listeners"`
+    AdminSocket     string           `yaml:"admin_socket"`
+    AdminSocketMode string           `yaml:"admin_socket_mode"`
+}
+
+// ListenerConfig is one listening socket. Behind a load balancer,
+// ProxyProtocol reads the client address from a PROXY protocol header and
+// ForwardedFor (WebSocket only) from X-Forwarded-For; either requires
+// TrustedProxies and is only accepted from peers in it.
+type ListenerConfig struct {
+    Name           string   `yaml:"name"`
+    Host           string   `yaml:"host"`
+    Port           int      `yaml:"port"`
+    TLS            bool     `yaml:"tls"`
+    TLSCert        string   `yaml:"tls_cert"`
+    TLSKey         string   `yaml:"tls_key"`
+    WebSocket      bool     `yaml:"websocket"`
+    Path           string   `yaml:"path"`
+    AdminOnly      bool     `yaml:"admin_only"`
+    ProxyProtocol  bool     `yaml:"proxy_protocol"`
+    ForwardedFor   bool     `yaml:"forwarded_for"`
+    TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+func (l ListenerConfig) Address() string {
+    return fmt.Sprintf("%s:%d", l.Host, l.Port)
+}
+
+// AdminSocketPerm is the file mode of the admin socket, 0600 unless
+// admin_socket_mode gives another octal mode.
+func (s ServerConfig) AdminSocketPerm() (os.FileMode, error) {
+    if s.AdminSocketMode == "" {
+        return 0600, nil
+    }
+
+    mode, err := strconv.ParseUint(s.AdminSocketMode, 8, 32)
+    if err != nil || mode > 0777 {
+        return 0, fmt.Errorf("invalid admin_socket_mode: %s", s.AdminSocketMode)
+    }
+    return os.FileMode(mode), nil
+}
+
+func (s ServerConfig) ListenerConfigs() []ListenerConfig {
+    if len(s.Listeners) > 0 {
+        return s.Listeners
+    }
+
+    return []ListenerConfig{{
+        Name: "default",
+        Host: s.Host,
+        Port: s.Port,
+    }}
 }
 
 type DatabaseConfig struct {
-    Host            string        `yaml:"host"`
-    Port            int           `yaml:"port"`
-    Name            string        `yaml:"name"`
-    User            string        `yaml:"user"`
-    Password        string        `yaml:"password"`
-    MaxOpenConns    int           `yaml:"max_open_conns"`
-    MaxIdleConns    int           `yaml:"max_idle_conns"`
-    ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+    Driver                    string        `yaml:"driver"`
+    Path                      string        `yaml:"path"`
+    SSLMode                   string        `yaml:"ssl_mode"`
+    Host                      string        `yaml:"host"`
+    Port                      int           `yaml:"port"`
+    Name                      string        `yaml:"name"`
+    User                      string        `yaml:"user"`
+    Password                  string        `yaml:"password"`
+    MaxOpenConns              int           `yaml:"max_open_conns"`
+    MaxIdleConns              int           `yaml:"max_idle_conns"`
+    ConnMaxLifetime           time.Duration `yaml:"conn_max_lifetime"`
+    StatementCacheSize        int           `yaml:"statement_cache_size"`
+    EncryptionKey             string        `yaml:"encryption_key"`
+    EncryptionKeyPath         string        `yaml:"encryption_key_path"`
+    PreviousEncryptionKey     string        `yaml:"previous_encryption_key"`
+    PreviousEncryptionKeyPath string        `yaml:"previous_encryption_key_path"`
+    ReadReplicas              []string      `yaml:"read_replicas"`
+    ReplicaCheckInterval      time.Duration `yaml:"replica_check_interval"`
 }
 
 type SecurityConfig struct {
-    RSAKeySize             int    `yaml:"rsa_key_size"`
-    RSAPrivateKeyPath      string `yaml:"rsa_private_key_path"`
-    RSAPublicKeyPath       string `yaml:"rsa_public_key_path"`
-    AESKeySize             int    `yaml:"aes_key_size"`
-    AESMode                string `yaml:"aes_mode"`
-    SessionTimeout         int    `yaml:"session_timeout"`
-    MaxIPSuspicion         int    `yaml:"max_ip_suspicion"`
-    EnableIPTracking       bool   `yaml:"enable_ip_tracking"`
-    PasswordMinLength      int    `yaml:"password_min_length"`
-    PasswordRequireSpecial bool   `yaml:"password_require_special"`
-    MaxLoginAttempts       int    `yaml:"max_login_attempts"`
-    LoginAttemptWindow     int    `yaml:"login_attempt_window"`
+    RSAKeySize             int      `yaml:"rsa_key_size"`
+    RSAPrivateKeyPath      string   `yaml:"rsa_private_key_path"`
+    RSAPublicKeyPath       string   `yaml:"rsa_public_key_path"`
+    AESKeySize             int      `yaml:"aes_key_size"`
+    AESMode                string   `yaml:"aes_mode"`
+    SessionTimeout         int      `yaml:"session_timeout"`
+    SessionKeyRotation     int      `yaml:"session_key_rotation"`
+    MaxIPSuspicion         int      `yaml:"max_ip_suspicion"`
+    SuspicionDecayInterval int      `yaml:"suspicion_decay_interval"`
+    IPv6Prefix             int      `yaml:"ipv6_prefix"`
+    EnableIPTracking       bool     `yaml:"enable_ip_tracking"`
+    NotifyNewLogins        bool     `yaml:"notify_new_logins"`
+    PasswordMinLength      int      `yaml:"password_min_length"`
+    PasswordRequireSpecial bool     `yaml:"password_require_special"`
+    MaxLoginAttempts       int      `yaml:"max_login_attempts"`
+    LoginAttemptWindow     int      `yaml:"login_attempt_window"`
+    MaxLoginAttemptsPerIP  int      `yaml:"max_login_attempts_per_ip"`
+    KillCooldown           int      `yaml:"kill_cooldown"`
+    ReconnectWindow        int      `yaml:"reconnect_window"`
+    ReconnectBurst         int      `yaml:"reconnect_burst"`
+    ReconnectMaxDelay      int      `yaml:"reconnect_max_delay"`
+    IPAllow                []string `yaml:"ip_allow"`
+    IPDeny                 []string `yaml:"ip_deny"`
+    LockKeyMemory          bool     `yaml:"lock_key_memory"`
+    MessageSigningKeyPath  string   `yaml:"message_signing_key_path"`
+    IdentityKeyPath        string   `yaml:"identity_key_path"`
+    PreviousIdentityKeyPath string  `yaml:"previous_identity_key_path"`
+    BanEvasionAction       string   `yaml:"ban_evasion_action"`
+    BanEvasionIPDays       int      `yaml:"ban_evasion_ip_days"`
+    CloakSecret            string   `yaml:"cloak_secret"`
 }
 
 type ThreadPoolConfig struct {
@@ -71,26 +193,227 @@ type LoggingConfig struct {
 }
 
 type FeaturesConfig struct {
-    EnableMessageHistory  bool `yaml:"enable_message_history"`
-    MaxMessageHistory     int  `yaml:"max_message_history"`
-    EnableDirectMessages  bool `yaml:"enable_direct_messages"`
-    EnableFileTransfer    bool `yaml:"enable_file_transfer"`
-    MaxChannelNameLength  int  `yaml:"max_channel_name_length"`
-    MaxChannelsPerUser    int  `yaml:"max_channels_per_user"`
+    EnableMessageHistory  bool   `yaml:"enable_message_history"`
+    MaxMessageHistory     int    `yaml:"max_message_history"`
+    EnableDirectMessages  bool   `yaml:"enable_direct_messages"`
+    EnableFileTransfer    bool   `yaml:"enable_file_transfer"`
+    EnableReceipts        bool   `yaml:"enable_receipts"`
+    MaxChannelNameLength  int    `yaml:"max_channel_name_length"`
+    MaxChannelsPerUser    int    `yaml:"max_channels_per_user"`
+    ChannelAliasDays      int    `yaml:"channel_alias_days"`
+    EnablePastes          bool   `yaml:"enable_pastes"`
+    MaxPasteSize          int    `yaml:"max_paste_size"`
+    MaxSearchResults      int    `yaml:"max_search_results"`
+    RejoinOnLogin         bool   `yaml:"rejoin_on_login"`
+    AnnouncementChannel   string `yaml:"announcement_channel"`
+}
+
+type ExportConfig struct {
+    Directory   string        `yaml:"directory"`
+    HTTPListen  string        `yaml:"http_listen"`
+    BaseURL     string        `yaml:"base_url"`
+    MaxMessages int           `yaml:"max_messages"`
+    Retention   time.Duration `yaml:"retention"`
+}
+
+type InactivityConfig struct {
+    Enabled           bool          `yaml:"enabled"`
+    CheckInterval     time.Duration `yaml:"check_interval"`
+    ChannelIdleDays   int           `yaml:"channel_idle_days"`
+    ChannelGraceDays  int           `yaml:"channel_grace_days"`
+    AccountIdleMonths int           `yaml:"account_idle_months"`
+    AccountGraceDays  int           `yaml:"account_grace_days"`
+}
+
+// AccountsConfig controls user-initiated account deletion. A deleted account
+// keeps its IP history and direct messages for DeletionRetentionDays so an
+// admin can still reactivate it; after that they are purged and the username
+// is anonymized.
+type AccountsConfig struct {
+    DeletionRetentionDays int           `yaml:"deletion_retention_days"`
+    PurgeInterval         time.Duration `yaml:"purge_interval"`
+    EmailTokenTTL         time.Duration `yaml:"email_token_ttl"`
+}
+
+// SMTPConfig is the relay account email is sent through. Email
+// verification and reset by email are off while Host is empty.
+type SMTPConfig struct {
+    Host     string `yaml:"host"`
+    Port     int    `yaml:"port"`
+    Username string `yaml:"username"`
+    Password string `yaml:"password"`
+    From     string `yaml:"from"`
+}
+
+// MaintenanceConfig controls the periodic cleanup job: lifting expired bans,
+// dropping stale channel invites and pruning old login records. Zero
+// InviteExpiryDays or IPHistoryDays keeps those rows forever.
+type MaintenanceConfig struct {
+    Interval         time.Duration `yaml:"interval"`
+    InviteExpiryDays int           `yaml:"invite_expiry_days"`
+    IPHistoryDays    int           `yaml:"ip_history_days"`
+}
+
+type JoinThrottleConfig struct {
+    UserActions   int           `yaml:"user_actions"`
+    UserWindow    time.Duration `yaml:"user_window"`
+    ChannelJoins  int           `yaml:"channel_joins"`
+    ChannelWindow time.Duration `yaml:"channel_window"`
+    FloodJoins    int           `yaml:"flood_joins"`
+    FloodWindow   time.Duration `yaml:"flood_window"`
+    AutoJoins     int           `yaml:"auto_joins"`
+    AutoWindow    time.Duration `yaml:"auto_window"`
+    AutoDuration  time.Duration `yaml:"auto_duration"`
+}
+
+// LockdownConfig holds the rate limits applied to non-admins while ADMIN
+// lockdown is on. A zero count disables that limit.
+type LockdownConfig struct {
+    UserActions   int           `yaml:"user_actions"`
+    UserWindow    time.Duration `yaml:"user_window"`
+    Messages      int           `yaml:"messages"`
+    MessageWindow time.Duration `yaml:"message_window"`
+}
+
+// BotsConfig holds the message rate limit for bot accounts. It applies at
+// all times, in place of the lockdown limits. A zero count disables it.
+type BotsConfig struct {
+    Messages      int           `yaml:"messages"`
+    MessageWindow time.Duration `yaml:"message_window"`
+}
+
+// FilterConfig tunes the content filter; its rules are kept in the
+// database and managed with ADMIN filter.
+type FilterConfig struct {
+    MuteDuration time.Duration `yaml:"mute_duration"`
+}
+
+// SpamConfig holds the spam heuristics and the penalties they escalate
+// through. Each time a heuristic trips the user gets a strike: the first is
+// a warning, the second a mute for MuteDuration and any further one a ban
+// for BanDuration, or another mute when BanDuration is zero. Strikes older
+// than StrikeWindow are forgotten. A zero count disables that heuristic.
+type SpamConfig struct {
+    RepeatMessages int           `yaml:"repeat_messages"`
+    RepeatWindow   time.Duration `yaml:"repeat_window"`
+    DMTargets      int           `yaml:"dm_targets"`
+    DMWindow       time.Duration `yaml:"dm_window"`
+    Joins          int           `yaml:"joins"`
+    JoinWindow     time.Duration `yaml:"join_window"`
+    StrikeWindow   time.Duration `yaml:"strike_window"`
+    MuteDuration   time.Duration `yaml:"mute_duration"`
+    BanDuration    time.Duration `yaml:"ban_duration"`
+}
+
+// PluginsConfig chooses the server extensions to load at startup. Enabled
+// names compiled-in plugins; Paths lists Go plugin files built with
+// -buildmode=plugin.
+type PluginsConfig struct {
+    Enabled []string `yaml:"enabled"`
+    Paths   []string `yaml:"paths"`
 }
 
+// LinksConfig enables linking with other OnyxIRC servers. Listen accepts
+// inbound links (port 0 disables it); only servers named in Peers may link.
+type LinksConfig struct {
+    Listen            ListenerConfig   `yaml:"listen"`
+    Peers             []LinkPeerConfig `yaml:"peers"`
+    ReconnectInterval time.Duration    `yaml:"reconnect_interval"`
+}
+
+// LinkPeerConfig is a trusted peer server. Hosts lists the addresses or
+// networks an inbound link from it may come from; Address, if set, is
+// dialled to establish the link from this side.
+type LinkPeerConfig struct {
+    Name     string   `yaml:"name"`
+    Hosts    []string `yaml:"hosts"`
+    Address  string   `yaml:"address"`
+    Password string   `yaml:"password"`
+    TLS      bool     `yaml:"tls"`
+}
+
+// ClusterConfig runs several server processes behind a load balancer as one
+// server. The nodes share the database and exchange broadcasts and presence
+// through Redis. NodeID defaults to the hostname and process ID.
+type ClusterConfig struct {
+    Enabled          bool          `yaml:"enabled"`
+    NodeID           string        `yaml:"node_id"`
+    RedisAddress     string        `yaml:"redis_address"`
+    RedisPassword    string        `yaml:"redis_password"`
+    RedisDB          int           `yaml:"redis_db"`
+    RedisTLS         bool          `yaml:"redis_tls"`
+    KeyPrefix        string        `yaml:"key_prefix"`
+    PresenceInterval time.Duration `yaml:"presence_interval"`
+}
+
+// DNSBLConfig lists DNS blocklists checked for every connecting address
+// before registration. Timeout is the budget for all zones together; results
+// are cached per address for CacheTTL.
+type DNSBLConfig struct {
+    Zones    []DNSBLZoneConfig `yaml:"zones"`
+    Timeout  time.Duration     `yaml:"timeout"`
+    CacheTTL time.Duration     `yaml:"cache_ttl"`
+}
+
+// DNSBLZoneConfig is one blocklist. Action is reject (refuse the
+// connection), require_auth (allow logging in but not REGISTER) or tag
+// (only report the listing to admins).
+type DNSBLZoneConfig struct {
+    Zone   string `yaml:"zone"`
+    Action string `yaml:"action"`
+    Reason string `yaml:"reason"`
+}
+
+type SearchConfig struct {
+    Backend               string `yaml:"backend"`
+    IndexPath             string `yaml:"index_path"`
+    ElasticsearchURL      string `yaml:"elasticsearch_url"`
+    ElasticsearchIndex    string `yaml:"elasticsearch_index"`
+    ElasticsearchUsername string `yaml:"elasticsearch_username"`
+    ElasticsearchPassword string `yaml:"elasticsearch_password"`
+}
+
+type APIConfig struct {
+    Listen string         `yaml:"listen"`
+    Keys   []APIKeyConfig `yaml:"keys"`
+}
+
+type APIKeyConfig struct {
+    Name     string `yaml:"name"`
+    KeyHash  string `yaml:"key_hash"`
+    Username string `yaml:"username"`
+}
+
+// Load reads the YAML file at path and the files it includes, overlays the
+// selected profile, applies the ONYX_ environment variables and -set
+// overrides on top, expands ${VAR} in secrets and validates the result.
+// Each layer wins over the ones before it.
 func Load(path string) (*Config, error) {
-    data, err := os.ReadFile(path)
-    if err != nil {
-        return nil, fmt.Errorf("failed to read config file: %w", err)
+    var cfg Config
+    if err := loadFile(path, &cfg, nil); err != nil {
+        return nil, err
     }
 
-    var cfg Config
-    if err := yaml.Unmarshal(data, &cfg); err != nil {
-        return nil, fmt.Errorf("failed to parse config file: %w", err)
+    if err := applyProfile(&cfg); err != nil {
+        return nil, err
+    }
+
+    if err := applyOverrides(&cfg); err != nil {
+        return nil, err
     }
 
     cfg.Database.Password = os.ExpandEnv(cfg.Database.Password)
+    cfg.Database.EncryptionKey = os.ExpandEnv(cfg.Database.EncryptionKey)
+    cfg.Database.PreviousEncryptionKey = os.ExpandEnv(cfg.Database.PreviousEncryptionKey)
+    for i := range cfg.Database.ReadReplicas {
+        cfg.Database.ReadReplicas[i] = os.ExpandEnv(cfg.Database.ReadReplicas[i])
+    }
+    cfg.Search.ElasticsearchPassword = os.ExpandEnv(cfg.Search.ElasticsearchPassword)
+    for i := range cfg.Links.Peers {
+        cfg.Links.Peers[i].Password = os.ExpandEnv(cfg.Links.Peers[i].Password)
+    }
+    cfg.Cluster.RedisPassword = os.ExpandEnv(cfg.Cluster.RedisPassword)
+    cfg.SMTP.Password = os.ExpandEnv(cfg.SMTP.Password)
 
     if err := cfg.Validate(); err != nil {
         return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -99,13 +422,117 @@ func Load(path string) (*Config, error) {
     return &cfg, nil
 }
 
+// ForTenant derives the configuration for a hosted network. The database is
+// always shared with the base config, the API and export HTTP listeners and
+// server links belong to the base network unless overridden, and search
+// indexes and exports are kept per tenant.
+func (c *Config) ForTenant(tenant TenantConfig) (*Config, error) {
+    cfg := *c
+    cfg.Tenants = nil
+    cfg.API.Listen = ""
+    cfg.Export.HTTPListen = ""
+    cfg.Links = LinksConfig{}
+    if cfg.Search.IndexPath != "" {
+        cfg.Search.IndexPath = filepath.Join(filepath.Dir(cfg.Search.IndexPath), tenant.ID, filepath.Base(cfg.Search.IndexPath))
+    }
+    if cfg.Search.ElasticsearchIndex != "" {
+        cfg.Search.ElasticsearchIndex += "-" + tenant.ID
+    }
+    if cfg.Export.Directory != "" {
+        cfg.Export.Directory = filepath.Join(cfg.Export.Directory, tenant.ID)
+    }
+
+    if !tenant.Overrides.IsZero() {
+        if err := tenant.Overrides.Decode(&cfg); err != nil {
+            return nil, fmt.Errorf("failed to apply overrides for tenant %s: %w", tenant.ID, err)
+        }
+    }
+
+    cfg.Database = c.Database
+    cfg.Tenants = nil
+    cfg.Server.Listeners = tenant.Listeners
+    if tenant.ServerName != "" {
+        cfg.Server.ServerName = tenant.ServerName
+    }
+
+    if err := cfg.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid configuration for tenant %s: %w", tenant.ID, err)
+    }
+
+    return &cfg, nil
+}
+
 func (c *Config) Validate() error {
-    if c.Server.Port < 1 || c.Server.Port > 65535 {
-        return fmt.Errorf("invalid server port: %d", c.Server.Port)
+    for _, listener := range c.Server.ListenerConfigs() {
+        if listener.Port < 1 || listener.Port > 65535 {
+            return fmt.Errorf("invalid port for listener %s: %d", listener.Name, listener.Port)
+        }
+
+        if listener.TLS && (listener.TLSCert == "" || listener.TLSKey == "") {
+            return fmt.Errorf("listener %s requires tls_cert and tls_key", listener.Name)
+        }
+
+        if listener.ForwardedFor && !listener.WebSocket {
+            return fmt.Errorf("listener %s: forwarded_for requires websocket", listener.Name)
+        }
+
+        if (listener.ProxyProtocol || listener.ForwardedFor) && len(listener.TrustedProxies) == 0 {
+            return fmt.Errorf("listener %s: proxy_protocol and forwarded_for require trusted_proxies, or any client could claim any address", listener.Name)
+        }
+
+        for _, entry := range listener.TrustedProxies {
+            if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+                return fmt.Errorf("listener %s: invalid address or network in trusted_proxies: %s", listener.Name, entry)
+            }
+        }
+    }
+
+    if c.Server.MaxLineLength != 0 && c.Server.MaxLineLength < minLineLength {
+        return fmt.Errorf("max_line_length must be at least %d bytes", minLineLength)
+    }
+
+    if _, err := c.Server.AdminSocketPerm(); err != nil {
+        return err
+    }
+
+    if c.Server.PingInterval > 0 && c.Server.PingTimeout > c.Server.PingInterval {
+        return fmt.Errorf("ping_timeout must not exceed ping_interval")
+    }
+
+    switch c.Database.Driver {
+    case "", "mysql", "postgres", "postgresql":
+        if c.Database.Name == "" {
+            return fmt.Errorf("database name is required")
+        }
+    case "sqlite", "sqlite3":
+        if c.Database.Path == "" {
+            return fmt.Errorf("database path is required for sqlite")
+        }
+        if len(c.Database.ReadReplicas) > 0 {
+            return fmt.Errorf("read_replicas requires mysql or postgres")
+        }
+    default:
+        return fmt.Errorf("unsupported database driver: %s", c.Database.Driver)
+    }
+
+    for i, dsn := range c.Database.ReadReplicas {
+        if strings.TrimSpace(dsn) == "" {
+            return fmt.Errorf("read replica %d has an empty dsn", i+1)
+        }
+    }
+    if c.Database.ReplicaCheckInterval < 0 {
+        return fmt.Errorf("replica_check_interval must not be negative")
     }
 
-    if c.Database.Name == "" {
-        return fmt.Errorf("database name is required")
+    if c.Database.EncryptionKey != "" && c.Database.EncryptionKeyPath != "" {
+        return fmt.Errorf("set only one of encryption_key and encryption_key_path")
+    }
+    if c.Database.PreviousEncryptionKey != "" && c.Database.PreviousEncryptionKeyPath != "" {
+        return fmt.Errorf("set only one of previous_encryption_key and previous_encryption_key_path")
+    }
+    hasPrevious := c.Database.PreviousEncryptionKey != "" || c.Database.PreviousEncryptionKeyPath != ""
+    if hasPrevious && c.Database.EncryptionKey == "" && c.Database.EncryptionKeyPath == "" {
+        return fmt.Errorf("previous_encryption_key requires encryption_key or encryption_key_path")
     }
 
     if c.Security.RSAKeySize != 2048 && c.Security.RSAKeySize != 4096 {
@@ -116,9 +543,190 @@ func (c *Config) Validate() error {
         return fmt.Errorf("AES key size must be 256")
     }
 
+    for _, entry := range append(append([]string{}, c.Security.IPAllow...), c.Security.IPDeny...) {
+        if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+            return fmt.Errorf("invalid address or network in ip_allow/ip_deny: %s", entry)
+        }
+    }
+
+    switch c.Security.BanEvasionAction {
+    case "", "off", "flag", "restrict":
+    default:
+        return fmt.Errorf("ban_evasion_action must be off, flag or restrict")
+    }
+
+    if c.Security.CloakSecret != "" && len(c.Security.CloakSecret) < minCloakSecretLength {
+        return fmt.Errorf("cloak_secret must be at least %d characters", minCloakSecretLength)
+    }
+
+    if c.Features.EnablePastes && (c.Features.MaxPasteSize < 1 || c.Features.MaxPasteSize > maxPasteSize) {
+        return fmt.Errorf("max_paste_size must be between 1 and %d bytes", maxPasteSize)
+    }
+
+    if c.Features.MaxChannelNameLength < 0 || c.Features.MaxChannelNameLength > 100 {
+        return fmt.Errorf("max_channel_name_length must be between 0 and 100")
+    }
+
+    if c.Features.MaxChannelsPerUser < 0 {
+        return fmt.Errorf("max_channels_per_user must not be negative")
+    }
+
+    if c.Features.MaxSearchResults < 0 {
+        return fmt.Errorf("max_search_results must not be negative")
+    }
+
+    if name := c.Features.AnnouncementChannel; name != "" && (!strings.HasPrefix(name, "#") || strings.ContainsAny(name, " ,:")) {
+        return fmt.Errorf("announcement_channel must be a channel name such as #news")
+    }
+
+    if c.Bots.Messages < 0 {
+        return fmt.Errorf("bots.messages must not be negative")
+    }
+
+    if c.Filter.MuteDuration < 0 {
+        return fmt.Errorf("filter.mute_duration must not be negative")
+    }
+
+    if c.Spam.RepeatMessages < 0 || c.Spam.DMTargets < 0 || c.Spam.Joins < 0 {
+        return fmt.Errorf("spam limits must not be negative")
+    }
+    if c.Spam.RepeatMessages > 0 || c.Spam.DMTargets > 0 || c.Spam.Joins > 0 {
+        if c.Spam.StrikeWindow <= 0 || c.Spam.MuteDuration <= 0 {
+            return fmt.Errorf("spam requires strike_window and mute_duration")
+        }
+    }
+    if c.Spam.BanDuration < 0 {
+        return fmt.Errorf("spam.ban_duration must not be negative")
+    }
+
+    if c.DNSBL.Timeout < 0 || c.DNSBL.CacheTTL < 0 {
+        return fmt.Errorf("dnsbl timeout and cache_ttl must not be negative")
+    }
+    for _, zone := range c.DNSBL.Zones {
+        if zone.Zone == "" || strings.ContainsAny(zone.Zone, " /:") {
+            return fmt.Errorf("dnsbl zone must be a domain name such as dnsbl.example.org")
+        }
+        switch zone.Action {
+        case "reject", "require_auth", "tag":
+        default:
+            return fmt.Errorf("dnsbl zone %s: action must be reject, require_auth or tag", zone.Zone)
+        }
+    }
+
+    if c.SMTP.Host != "" {
+        if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+            return fmt.Errorf("smtp.port must be between 1 and 65535")
+        }
+        if c.SMTP.From == "" {
+            return fmt.Errorf("smtp requires from")
+        }
+    }
+    if c.Accounts.EmailTokenTTL < 0 {
+        return fmt.Errorf("email_token_ttl must not be negative")
+    }
+
+    if c.Accounts.DeletionRetentionDays < 0 {
+        return fmt.Errorf("deletion_retention_days must not be negative")
+    }
+
+    if c.Cluster.Enabled {
+        if c.Cluster.RedisAddress == "" {
+            return fmt.Errorf("cluster requires redis_address")
+        }
+        if c.Database.Driver == "sqlite" || c.Database.Driver == "sqlite3" {
+            return fmt.Errorf("cluster nodes must share a mysql or postgres database")
+        }
+    }
+
+    if err := c.Links.validate(c.Server.ServerName); err != nil {
+        return err
+    }
+
+    if c.Maintenance.InviteExpiryDays < 0 || c.Maintenance.IPHistoryDays < 0 {
+        return fmt.Errorf("invite_expiry_days and ip_history_days must not be negative")
+    }
+
     if c.Security.MaxIPSuspicion < 1 {
         return fmt.Errorf("max IP suspicion must be at least 1")
     }
 
+    if c.Security.PreviousIdentityKeyPath != "" && c.Security.IdentityKeyPath == "" {
+        return fmt.Errorf("previous_identity_key_path requires identity_key_path")
+    }
+
+    if c.Security.SessionKeyRotation < 0 {
+        return fmt.Errorf("session_key_rotation must not be negative")
+    }
+
+    if c.Security.IPv6Prefix < 0 || c.Security.IPv6Prefix > 128 {
+        return fmt.Errorf("ipv6_prefix must be between 0 and 128")
+    }
+
+    seen := make(map[string]bool)
+    for _, tenant := range c.Tenants {
+        if tenant.ID == "" || tenant.ID == "default" {
+            return fmt.Errorf("tenant id is required and must not be \"default\"")
+        }
+        if len(tenant.ID) > 50 {
+            return fmt.Errorf("tenant id %s is longer than 50 characters", tenant.ID)
+        }
+        if seen[tenant.ID] {
+            return fmt.Errorf("duplicate tenant id: %s", tenant.ID)
+        }
+        seen[tenant.ID] = true
+
+        if len(tenant.Listeners) == 0 {
+            return fmt.Errorf("tenant %s requires at least one listener", tenant.ID)
+        }
+    }
+
+    return nil
+}
+
+func (l LinksConfig) validate(serverName string) error {
+    if len(l.Peers) == 0 {
+        return nil
+    }
+
+    if serverName == "" || strings.ContainsAny(serverName, " :") {
+        return fmt.Errorf("server_name must be set and contain no spaces or colons to link servers")
+    }
+
+    if l.Listen.Port < 0 || l.Listen.Port > 65535 {
+        return fmt.Errorf("invalid port for links listener: %d", l.Listen.Port)
+    }
+
+    if l.Listen.TLS && (l.Listen.TLSCert == "" || l.Listen.TLSKey == "") {
+        return fmt.Errorf("links listener requires tls_cert and tls_key")
+    }
+
+    seen := make(map[string]bool)
+    for _, peer := range l.Peers {
+        if peer.Name == "" || strings.ContainsAny(peer.Name, " :") {
+            return fmt.Errorf("invalid link peer name: %q", peer.Name)
+        }
+        if peer.Name == serverName {
+            return fmt.Errorf("link peer %s has this server's own name", peer.Name)
+        }
+        if seen[peer.Name] {
+            return fmt.Errorf("duplicate link peer: %s", peer.Name)
+        }
+        seen[peer.Name] = true
+
+        if peer.Password == "" || strings.ContainsAny(peer.Password, " ") {
+            return fmt.Errorf("link peer %s requires a password without spaces", peer.Name)
+        }
+
+        if peer.Address == "" && len(peer.Hosts) == 0 {
+            return fmt.Errorf("link peer %s needs an address to dial or hosts to accept from", peer.Name)
+        }
+
+        for _, host := range peer.Hosts {
+            if _, _, err := net.ParseCIDR(host); err != nil && net.ParseIP(host) == nil {
+                return fmt.Errorf("invalid address or network in hosts of link peer %s: %s", peer.Name, host)
+            }
+        }
+    }
+
     return nil
 }
@@ -0,0 +1,115 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// fileOnly are the top-level keys that shape how the files are read and so
+// cannot be overridden once they have been.
+var fileOnly = map[string]bool{"include": true, "profiles": true}
+
+// loadFile decodes the file at path into cfg on top of whatever is already
+// there, after the files it includes. Include paths are relative to the
+// including file and may be globs, matched in lexical order; a later file
+// overrides the keys it sets and keeps the rest, though a list replaces the
+// one before it rather than being appended to. chain holds the files being
+// read to catch include cycles.
+func loadFile(path string, cfg *Config, chain []string) error {
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return fmt.Errorf("failed to read config file: %w", err)
+    }
+    for _, seen := range chain {
+        if seen == abs {
+            return fmt.Errorf("config include cycle: %s -> %s", strings.Join(chain, " -> "), abs)
+        }
+    }
+    chain = append(chain, abs)
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("failed to read config file: %w", err)
+    }
+
+    var doc yaml.Node
+    if err := yaml.Unmarshal(data, &doc); err != nil {
+        return fmt.Errorf("failed to parse config file %s: %w", path, err)
+    }
+    if doc.Kind == 0 {
+        return nil
+    }
+
+    var head struct {
+        Include []string `yaml:"include"`
+    }
+    if err := doc.Decode(&head); err != nil {
+        return fmt.Errorf("failed to parse config file %s: %w", path, err)
+    }
+
+    for _, include := range head.Include {
+        if !filepath.IsAbs(include) {
+            include = filepath.Join(filepath.Dir(path), include)
+        }
+
+        matches := []string{include}
+        if strings.ContainsAny(include, "*?[") {
+            if matches, err = filepath.Glob(include); err != nil {
+                return fmt.Errorf("invalid include pattern in %s: %w", path, err)
+            }
+            sort.Strings(matches)
+        }
+
+        for _, match := range matches {
+            if err := loadFile(match, cfg, chain); err != nil {
+                return fmt.Errorf("%s: %w", path, err)
+            }
+        }
+    }
+
+    if err := doc.Decode(cfg); err != nil {
+        return fmt.Errorf("failed to parse config file %s: %w", path, err)
+    }
+    return nil
+}
+
+// applyProfile overlays the selected entry of profiles on the merged files.
+// No profile selected leaves the base settings as they are.
+func applyProfile(cfg *Config) error {
+    name := selectedProfile(cfg)
+    if name == "" {
+        return nil
+    }
+
+    overlay, ok := cfg.Profiles[name]
+    if !ok {
+        defined := make([]string, 0, len(cfg.Profiles))
+        for profile := range cfg.Profiles {
+            defined = append(defined, profile)
+        }
+        sort.Strings(defined)
+        if len(defined) == 0 {
+            return fmt.Errorf("profile %q is selected but no profiles are defined", name)
+        }
+        return fmt.Errorf("profile %q is not defined; choose one of %s", name, strings.Join(defined, ", "))
+    }
+
+    if overlay.Kind == yaml.MappingNode {
+        for i := 0; i < len(overlay.Content); i += 2 {
+            if key := overlay.Content[i].Value; fileOnly[key] || key == "profile" {
+                return fmt.Errorf("profile %s: %s cannot be set in a profile", name, key)
+            }
+        }
+    }
+
+    if err := overlay.Decode(cfg); err != nil {
+        return fmt.Errorf("failed to apply profile %s: %w", name, err)
+    }
+    cfg.Profile = name
+    return nil
+}
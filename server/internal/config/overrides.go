@@ -0,0 +1,244 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "reflect"
+    "strings"
+    "sync"
+
+    "gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override config fields.
+// The rest of the name is the field's YAML path in upper case joined by
+// underscores, e.g. ONYX_SERVER_PORT for server.port; ONYX_DB_ may stand
+// in for ONYX_DATABASE_.
+const EnvPrefix = "ONYX_"
+
+var envAliases = map[string]string{"DATABASE": "DB"}
+
+var (
+    overridesMu sync.RWMutex
+    overrides   []setting
+)
+
+type setting struct {
+    path  []string
+    value string
+}
+
+// OverrideFlag collects repeated -set path=value flags.
+type OverrideFlag []string
+
+func (f *OverrideFlag) String() string {
+    return strings.Join(*f, ",")
+}
+
+func (f *OverrideFlag) Set(value string) error {
+    if !strings.Contains(value, "=") {
+        return fmt.Errorf("expected path=value, e.g. server.port=6697")
+    }
+    *f = append(*f, value)
+    return nil
+}
+
+// SetOverrides records path=value settings, normally from -set flags, that
+// every later Load applies over the YAML file and the environment, so a
+// REHASH keeps them. Paths are YAML keys joined by dots, e.g.
+// database.host.
+func SetOverrides(settings []string) error {
+    parsed := make([]setting, 0, len(settings))
+    for _, entry := range settings {
+        key, value, found := strings.Cut(entry, "=")
+        if !found {
+            return fmt.Errorf("invalid override %q: expected path=value", entry)
+        }
+
+        path := strings.Split(strings.TrimSpace(key), ".")
+        var probe Config
+        if _, err := fieldByPath(reflect.ValueOf(&probe).Elem(), path); err != nil {
+            return fmt.Errorf("invalid override %q: %w", entry, err)
+        }
+        parsed = append(parsed, setting{path: path, value: value})
+    }
+
+    overridesMu.Lock()
+    overrides = parsed
+    overridesMu.Unlock()
+    return nil
+}
+
+// applyOverrides sets fields from ONYX_ environment variables, then from
+// the -set flags, so flags win over the environment and both win over YAML.
+func applyOverrides(cfg *Config) error {
+    if err := applyEnv(reflect.ValueOf(cfg).Elem(), nil); err != nil {
+        return err
+    }
+
+    overridesMu.RLock()
+    defer overridesMu.RUnlock()
+
+    for _, s := range overrides {
+        field, err := fieldByPath(reflect.ValueOf(cfg).Elem(), s.path)
+        if err != nil {
+            return err
+        }
+        if err := setField(field, s.value); err != nil {
+            return fmt.Errorf("invalid value for -set %s: %w", strings.Join(s.path, "."), err)
+        }
+    }
+    return nil
+}
+
+// selectedProfile is the profile named by -set profile=, ONYX_PROFILE or the
+// profile key in the files, in that order. It is resolved before the
+// profile is applied, ahead of the other overrides.
+func selectedProfile(cfg *Config) string {
+    overridesMu.RLock()
+    defer overridesMu.RUnlock()
+
+    for i := len(overrides) - 1; i >= 0; i-- {
+        if len(overrides[i].path) == 1 && overrides[i].path[0] == "profile" {
+            return overrides[i].value
+        }
+    }
+    if name, ok := os.LookupEnv(EnvPrefix + "PROFILE"); ok {
+        return name
+    }
+    return cfg.Profile
+}
+
+func applyEnv(v reflect.Value, path []string) error {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        key := yamlKey(t.Field(i))
+        if key == "" {
+            continue
+        }
+
+        if len(path) == 0 && fileOnly[key] {
+            continue
+        }
+
+        field := v.Field(i)
+        fieldPath := append(append([]string{}, path...), key)
+        if field.Kind() == reflect.Struct && field.Type() != nodeType {
+            if err := applyEnv(field, fieldPath); err != nil {
+                return err
+            }
+            continue
+        }
+        if !overridable(field.Type()) {
+            continue
+        }
+
+        for _, name := range envNames(fieldPath) {
+            value, ok := os.LookupEnv(name)
+            if !ok {
+                continue
+            }
+            if err := setField(field, value); err != nil {
+                return fmt.Errorf("invalid value for %s: %w", name, err)
+            }
+            break
+        }
+    }
+    return nil
+}
+
+// envNames lists the variables for a field, the full name first.
+func envNames(path []string) []string {
+    upper := make([]string, len(path))
+    for i, key := range path {
+        upper[i] = strings.ToUpper(key)
+    }
+
+    names := []string{EnvPrefix + strings.Join(upper, "_")}
+    if alias, ok := envAliases[upper[0]]; ok {
+        upper[0] = alias
+        names = append(names, EnvPrefix+strings.Join(upper, "_"))
+    }
+    return names
+}
+
+func fieldByPath(v reflect.Value, path []string) (reflect.Value, error) {
+    if fileOnly[path[0]] {
+        return reflect.Value{}, fmt.Errorf("%s can only be set in the config file", path[0])
+    }
+
+    for depth, key := range path {
+        if v.Kind() != reflect.Struct || v.Type() == nodeType {
+            return reflect.Value{}, fmt.Errorf("%s is not a section", strings.Join(path[:depth], "."))
+        }
+
+        next := reflect.Value{}
+        for i := 0; i < v.NumField(); i++ {
+            if yamlKey(v.Type().Field(i)) == key {
+                next = v.Field(i)
+                break
+            }
+        }
+        if !next.IsValid() {
+            return reflect.Value{}, fmt.Errorf("unknown config field %s", strings.Join(path[:depth+1], "."))
+        }
+        v = next
+    }
+
+    if !overridable(v.Type()) {
+        return reflect.Value{}, fmt.Errorf("%s cannot be set from the command line or environment", strings.Join(path, "."))
+    }
+    return v, nil
+}
+
+var nodeType = reflect.TypeOf(yaml.Node{})
+
+// overridable reports whether a field holds a single value or a list of
+// strings. Lists of sections such as listeners and tenants, and raw YAML,
+// can only be set in the file.
+func overridable(t reflect.Type) bool {
+    switch t.Kind() {
+    case reflect.Struct, reflect.Map, reflect.Ptr, reflect.Interface:
+        return false
+    case reflect.Slice:
+        return t.Elem().Kind() == reflect.String
+    }
+    return true
+}
+
+func yamlKey(field reflect.StructField) string {
+    if !field.IsExported() {
+        return ""
+    }
+    key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+    if key == "-" {
+        return ""
+    }
+    return key
+}
+
+// setField parses value as YAML would for the field, so durations take the
+// same form as in the file. String lists are comma-separated.
+func setField(field reflect.Value, value string) error {
+    switch field.Kind() {
+    case reflect.String:
+        field.SetString(value)
+        return nil
+    case reflect.Slice:
+        var list []string
+        for _, item := range strings.Split(value, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                list = append(list, item)
+            }
+        }
+        field.Set(reflect.ValueOf(list))
+        return nil
+    }
+
+    parsed := reflect.New(field.Type())
+    if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+        return fmt.Errorf("cannot parse %q as %s", value, field.Type())
+    }
+    field.Set(parsed.Elem())
+    return nil
+}
@@ -0,0 +1,163 @@
+package console
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+)
+
+type Completer func(line string) []string
+
+type Reader struct {
+    in       io.Reader
+    out      io.Writer
+    prompt   string
+    complete Completer
+    buffered *bufio.Reader
+    restore  func()
+}
+
+// NewReader reads lines from in. Completion and line editing are only
+// available when in is a terminal; other input, such as a socket, is read
+// line by line.
+func NewReader(in io.Reader, out io.Writer, prompt string, complete Completer) *Reader {
+    r := &Reader{
+        in:       in,
+        out:      out,
+        prompt:   prompt,
+        complete: complete,
+        buffered: bufio.NewReader(in),
+    }
+
+    if f, ok := in.(*os.File); ok {
+        if restore, err := enableCbreak(int(f.Fd())); err == nil {
+            r.restore = restore
+        }
+    }
+
+    return r
+}
+
+func IsTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r *Reader) Close() {
+    if r.restore != nil {
+        r.restore()
+        r.restore = nil
+    }
+}
+
+func (r *Reader) ReadLine() (string, error) {
+    fmt.Fprint(r.out, r.prompt)
+
+    if r.restore == nil {
+        line, err := r.buffered.ReadString('\n')
+        if err != nil && line == "" {
+            return "", err
+        }
+        return strings.TrimRight(line, "\r\n"), nil
+    }
+
+    var line []rune
+    for {
+        ch, _, err := r.buffered.ReadRune()
+        if err != nil {
+            return "", err
+        }
+
+        switch ch {
+        case '\r', '\n':
+            fmt.Fprint(r.out, "\n")
+            return string(line), nil
+        case 4:
+            if len(line) == 0 {
+                fmt.Fprint(r.out, "\n")
+                return "", io.EOF
+            }
+        case 127, '\b':
+            if len(line) > 0 {
+                line = line[:len(line)-1]
+                fmt.Fprint(r.out, "\b \b")
+            }
+        case 21:
+            line = line[:0]
+            fmt.Fprintf(r.out, "\r\033[K%s", r.prompt)
+        case '\t':
+            line = r.completeLine(line)
+        case 27:
+            r.skipEscape()
+        default:
+            if ch >= ' ' {
+                line = append(line, ch)
+                fmt.Fprint(r.out, string(ch))
+            }
+        }
+    }
+}
+
+func (r *Reader) skipEscape() {
+    next, _, err := r.buffered.ReadRune()
+    if err != nil || next != '[' {
+        return
+    }
+
+    for {
+        ch, _, err := r.buffered.ReadRune()
+        if err != nil || (ch >= '@' && ch <= '~') {
+            return
+        }
+    }
+}
+
+func (r *Reader) completeLine(line []rune) []rune {
+    if r.complete == nil {
+        return line
+    }
+
+    current := string(line)
+    start := strings.LastIndex(current, " ") + 1
+    word := current[start:]
+
+    var matches []string
+    for _, candidate := range r.complete(current) {
+        if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(word)) {
+            matches = append(matches, candidate)
+        }
+    }
+
+    switch len(matches) {
+    case 0:
+        return line
+    case 1:
+        completed := current[:start] + matches[0] + " "
+        fmt.Fprintf(r.out, "\r\033[K%s%s", r.prompt, completed)
+        return []rune(completed)
+    default:
+        sort.Strings(matches)
+        prefix := commonPrefix(matches)
+        if len(prefix) > len(word) {
+            current = current[:start] + prefix
+        }
+        fmt.Fprintf(r.out, "\n%s\n%s%s", strings.Join(matches, "  "), r.prompt, current)
+        return []rune(current)
+    }
+}
+
+func commonPrefix(values []string) string {
+    prefix := values[0]
+    for _, value := range values[1:] {
+        for !strings.HasPrefix(value, prefix) {
+            prefix = prefix[:len(prefix)-1]
+        }
+    }
+    return prefix
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package console
+
+import (
+    "syscall"
+    "unsafe"
+)
+
+func getTermios(fd int) (*syscall.Termios, error) {
+    termios := &syscall.Termios{}
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TCGETS), uintptr(unsafe.Pointer(termios)))
+    if errno != 0 {
+        return nil, errno
+    }
+    return termios, nil
+}
+
+func setTermios(fd int, termios *syscall.Termios) error {
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(termios)))
+    if errno != 0 {
+        return errno
+    }
+    return nil
+}
+
+func enableCbreak(fd int) (func(), error) {
+    original, err := getTermios(fd)
+    if err != nil {
+        return nil, err
+    }
+
+    cbreak := *original
+    cbreak.Lflag &^= syscall.ICANON | syscall.ECHO
+    cbreak.Cc[syscall.VMIN] = 1
+    cbreak.Cc[syscall.VTIME] = 0
+
+    if err := setTermios(fd, &cbreak); err != nil {
+        return nil, err
+    }
+
+    return func() {
+        setTermios(fd, original)
+    }, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package console
+
+import "errors"
+
+func enableCbreak(fd int) (func(), error) {
+    return nil, errors.New("line editing is not supported on this platform")
+}
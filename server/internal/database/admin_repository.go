@@ -3,6 +3,7 @@ package database
 import (
     "database/sql"
     "fmt"
+    "strings"
     "time"
 
     "github.com/onyxirc/server/internal/models"
@@ -16,6 +17,17 @@ func NewAdminRepository(db *DB) *AdminRepository {
     return &AdminRepository{db: db}
 }
 
+// AutoActor is the admin ID of actions the server takes on its own, such as
+// spam penalties. They are stored with a NULL admin and listed as "auto".
+const AutoActor int64 = 0
+
+func actorID(adminID int64) *int64 {
+    if adminID == AutoActor {
+        return nil
+    }
+    return &adminID
+}
+
 func (r *AdminRepository) LogAction(adminID int64, actionType string, targetUserID, targetChannelID *int64, details string) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -25,7 +37,7 @@ func (r *AdminRepository) LogAction(adminID int64, actionType string, targetUser
         VALUES (?, ?, ?, ?, ?)
     `
 
-    _, err := r.db.ExecContext(ctx, query, adminID, actionType, targetUserID, targetChannelID, details)
+    _, err := r.db.ExecContext(ctx, query, actorID(adminID), actionType, targetUserID, targetChannelID, details)
     if err != nil {
         return fmt.Errorf("failed to log admin action: %w", err)
     }
@@ -33,18 +45,67 @@ func (r *AdminRepository) LogAction(adminID int64, actionType string, targetUser
     return nil
 }
 
+// AdminLogFilter narrows an admin action log search. Zero fields match
+// everything; Automatic matches only actions with no admin.
+type AdminLogFilter struct {
+    AdminID      int64
+    Automatic    bool
+    ActionType   string
+    TargetUserID int64
+    From         time.Time
+    To           time.Time
+    Limit        int
+    Offset       int
+}
+
 func (r *AdminRepository) GetAdminActionLog(limit, offset int) ([]*models.AdminActionLog, error) {
+    return r.SearchAdminActionLog(AdminLogFilter{Limit: limit, Offset: offset})
+}
+
+func (r *AdminRepository) SearchAdminActionLog(filter AdminLogFilter) ([]*models.AdminActionLog, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
+    conditions := []string{"COALESCE(u.tenant_id, t.tenant_id) = ?"}
+    args := []interface{}{r.db.Tenant()}
+
+    if filter.AdminID != 0 {
+        conditions = append(conditions, "l.admin_id = ?")
+        args = append(args, filter.AdminID)
+    }
+    if filter.Automatic {
+        conditions = append(conditions, "l.admin_id IS NULL")
+    }
+    if filter.ActionType != "" {
+        conditions = append(conditions, "l.action_type = ?")
+        args = append(args, filter.ActionType)
+    }
+    if filter.TargetUserID != 0 {
+        conditions = append(conditions, "l.target_user_id = ?")
+        args = append(args, filter.TargetUserID)
+    }
+    if !filter.From.IsZero() {
+        conditions = append(conditions, "l.performed_at >= ?")
+        args = append(args, filter.From)
+    }
+    if !filter.To.IsZero() {
+        conditions = append(conditions, "l.performed_at <= ?")
+        args = append(args, filter.To)
+    }
+
     query := `
-        SELECT log_id, admin_id, action_type, target_user_id, target_channel_id, action_details, performed_at
-        FROM admin_action_log
-        ORDER BY performed_at DESC
+        SELECT l.log_id, COALESCE(l.admin_id, 0), COALESCE(u.username, 'auto'), l.action_type, l.target_user_id, t.username,
+               l.target_channel_id, l.action_details, l.performed_at
+        FROM admin_action_log l
+        LEFT JOIN users u ON u.user_id = l.admin_id
+        LEFT JOIN users t ON t.user_id = l.target_user_id
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        ORDER BY l.performed_at DESC, l.log_id DESC
         LIMIT ? OFFSET ?
     `
+    args = append(args, filter.Limit, filter.Offset)
 
-    rows, err := r.db.QueryContext(ctx, query, limit, offset)
+    rows, err := r.db.QueryContext(ctx, query, args...)
     if err != nil {
         return nil, fmt.Errorf("failed to get admin action log: %w", err)
     }
@@ -56,8 +117,10 @@ func (r *AdminRepository) GetAdminActionLog(limit, offset int) ([]*models.AdminA
         err := rows.Scan(
             &log.LogID,
             &log.AdminID,
+            &log.AdminUsername,
             &log.ActionType,
             &log.TargetUserID,
+            &log.TargetUsername,
             &log.TargetChannelID,
             &log.ActionDetails,
             &log.PerformedAt,
@@ -86,12 +149,17 @@ func (r *AdminRepository) BanUser(userID, bannedBy int64, reason string, duratio
         VALUES (?, ?, ?, ?)
     `
 
-    _, err := r.db.ExecContext(ctx, query, userID, bannedBy, reason, expiresAt)
-    if err != nil {
-        return fmt.Errorf("failed to ban user: %w", err)
-    }
+    // The ban and the deactivation it implies succeed or fail together.
+    return r.db.WithTx(func(tx *DB) error {
+        if _, err := tx.ExecContext(ctx, query, userID, actorID(bannedBy), reason, expiresAt); err != nil {
+            return fmt.Errorf("failed to ban user: %w", err)
+        }
 
-    return nil
+        if err := NewUserRepository(tx).SetActiveStatus(userID, false); err != nil {
+            return fmt.Errorf("failed to deactivate user: %w", err)
+        }
+        return nil
+    })
 }
 
 func (r *AdminRepository) UnbanUser(userID int64) error {
@@ -100,12 +168,16 @@ func (r *AdminRepository) UnbanUser(userID int64) error {
 
     query := `UPDATE user_bans SET is_active = FALSE WHERE user_id = ? AND is_active = TRUE`
 
-    _, err := r.db.ExecContext(ctx, query, userID)
-    if err != nil {
-        return fmt.Errorf("failed to unban user: %w", err)
-    }
+    return r.db.WithTx(func(tx *DB) error {
+        if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+            return fmt.Errorf("failed to unban user: %w", err)
+        }
 
-    return nil
+        if err := NewUserRepository(tx).SetActiveStatus(userID, true); err != nil {
+            return fmt.Errorf("failed to reactivate user: %w", err)
+        }
+        return nil
+    })
 }
 
 func (r *AdminRepository) IsUserBanned(userID int64) (bool, error) {
@@ -116,11 +188,11 @@ func (r *AdminRepository) IsUserBanned(userID int64) (bool, error) {
         SELECT COUNT(*) FROM user_bans
         WHERE user_id = ?
           AND is_active = TRUE
-          AND (expires_at IS NULL OR expires_at > NOW())
+          AND (expires_at IS NULL OR expires_at > ?)
     `
 
     var count int
-    err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+    err := r.db.QueryRowContext(ctx, query, userID, time.Now()).Scan(&count)
     if err != nil {
         return false, fmt.Errorf("failed to check ban status: %w", err)
     }
@@ -128,30 +200,19 @@ func (r *AdminRepository) IsUserBanned(userID int64) (bool, error) {
     return count > 0, nil
 }
 
-func (r *AdminRepository) GetActiveBans() ([]*models.UserBan, error) {
-    ctx, cancel := contextWithTimeout(defaultTimeout)
-    defer cancel()
-
-    query := `
-        SELECT ban_id, user_id, banned_by, reason, banned_at, expires_at, is_active
-        FROM user_bans
-        WHERE is_active = TRUE
-        ORDER BY banned_at DESC
-    `
-
-    rows, err := r.db.QueryContext(ctx, query)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get active bans: %w", err)
-    }
-    defer rows.Close()
+const banColumns = `b.ban_id, b.user_id, u.username, COALESCE(b.banned_by, 0), COALESCE(a.username, 'auto'),
+            b.reason, b.banned_at, b.expires_at, b.is_active`
 
+func scanBans(rows *sql.Rows) ([]*models.UserBan, error) {
     var bans []*models.UserBan
     for rows.Next() {
         ban := &models.UserBan{}
         err := rows.Scan(
             &ban.BanID,
             &ban.UserID,
+            &ban.Username,
             &ban.BannedBy,
+            &ban.BannedByName,
             &ban.Reason,
             &ban.BannedAt,
             &ban.ExpiresAt,
@@ -163,7 +224,94 @@ func (r *AdminRepository) GetActiveBans() ([]*models.UserBan, error) {
         bans = append(bans, ban)
     }
 
-    return bans, nil
+    return bans, rows.Err()
+}
+
+func (r *AdminRepository) GetActiveBans() ([]*models.UserBan, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT ` + banColumns + `
+        FROM user_bans b
+        JOIN users u ON u.user_id = b.user_id
+        LEFT JOIN users a ON a.user_id = b.banned_by
+        WHERE b.is_active = TRUE AND u.tenant_id = ?
+        ORDER BY b.banned_at DESC
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant())
+    if err != nil {
+        return nil, fmt.Errorf("failed to get active bans: %w", err)
+    }
+    defer rows.Close()
+
+    return scanBans(rows)
+}
+
+// GetUserBans returns every ban placed on userID, active or not, newest
+// first.
+func (r *AdminRepository) GetUserBans(userID int64) ([]*models.UserBan, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT ` + banColumns + `
+        FROM user_bans b
+        JOIN users u ON u.user_id = b.user_id
+        LEFT JOIN users a ON a.user_id = b.banned_by
+        WHERE b.user_id = ?
+        ORDER BY b.banned_at DESC, b.ban_id DESC
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get user bans: %w", err)
+    }
+    defer rows.Close()
+
+    return scanBans(rows)
+}
+
+// GetExpiredBans returns temporary bans that have run out but are still
+// marked active.
+func (r *AdminRepository) GetExpiredBans() ([]*models.UserBan, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT ` + banColumns + `
+        FROM user_bans b
+        JOIN users u ON u.user_id = b.user_id
+        LEFT JOIN users a ON a.user_id = b.banned_by
+        WHERE b.is_active = TRUE
+          AND b.expires_at IS NOT NULL
+          AND b.expires_at <= ?
+          AND u.tenant_id = ?
+        ORDER BY b.expires_at
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, time.Now(), r.db.Tenant())
+    if err != nil {
+        return nil, fmt.Errorf("failed to get expired bans: %w", err)
+    }
+    defer rows.Close()
+
+    return scanBans(rows)
+}
+
+func (r *AdminRepository) ExpireBan(banID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE user_bans SET is_active = FALSE WHERE ban_id = ?`
+
+    _, err := r.db.ExecContext(ctx, query, banID)
+    if err != nil {
+        return fmt.Errorf("failed to expire ban: %w", err)
+    }
+
+    return nil
 }
 
 func (r *AdminRepository) GetServerConfig(key string) (string, error) {
@@ -189,19 +337,78 @@ func (r *AdminRepository) SetServerConfig(key, value, description string, update
     defer cancel()
 
     query := `
-        INSERT INTO server_config (config_key, config_value, description, updated_by)
-        VALUES (?, ?, ?, ?)
-        ON DUPLICATE KEY UPDATE
-            config_value = VALUES(config_value),
-            description = VALUES(description),
-            updated_by = VALUES(updated_by),
-            updated_at = CURRENT_TIMESTAMP
-    `
+        INSERT INTO server_config (config_key, config_value, description, updated_by, updated_at)
+        VALUES (?, ?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("config_key", "config_value", "description", "updated_by", "updated_at")
 
-    _, err := r.db.ExecContext(ctx, query, key, value, description, updatedBy)
+    _, err := r.db.ExecContext(ctx, query, key, value, description, updatedBy, time.Now())
     if err != nil {
         return fmt.Errorf("failed to set config: %w", err)
     }
 
     return nil
 }
+
+// Lockdown state is kept per tenant in server_config; "" means no lockdown.
+func lockdownConfigKey(tenant string) string {
+    return "security.lockdown." + tenant
+}
+
+func (r *AdminRepository) GetLockdown() (string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT config_value FROM server_config WHERE config_key = ?`
+
+    var value string
+    err := r.db.QueryRowContext(ctx, query, lockdownConfigKey(r.db.Tenant())).Scan(&value)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to get lockdown state: %w", err)
+    }
+
+    return value, nil
+}
+
+func (r *AdminRepository) SetLockdown(state string, updatedBy int64) error {
+    return r.SetServerConfig(lockdownConfigKey(r.db.Tenant()), state, "Emergency lockdown state", &updatedBy)
+}
+
+// Runtime overrides made with ADMIN config are kept per tenant in
+// server_config and applied over the config file at startup.
+func tunableConfigPrefix(tenant string) string {
+    return "tunable." + tenant + "."
+}
+
+func (r *AdminRepository) GetTunables() (map[string]string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    prefix := tunableConfigPrefix(r.db.Tenant())
+    query := `SELECT config_key, config_value FROM server_config WHERE config_key LIKE ?`
+
+    rows, err := r.db.QueryContext(ctx, query, prefix+"%")
+    if err != nil {
+        return nil, fmt.Errorf("failed to get runtime config: %w", err)
+    }
+    defer rows.Close()
+
+    tunables := make(map[string]string)
+    for rows.Next() {
+        var key, value string
+        if err := rows.Scan(&key, &value); err != nil {
+            return nil, fmt.Errorf("failed to scan runtime config: %w", err)
+        }
+        if strings.HasPrefix(key, prefix) {
+            tunables[strings.TrimPrefix(key, prefix)] = value
+        }
+    }
+
+    return tunables, nil
+}
+
+func (r *AdminRepository) SetTunable(name, value string, updatedBy int64) error {
+    return r.SetServerConfig(tunableConfigPrefix(r.db.Tenant())+name, value, "Runtime override set with ADMIN config", &updatedBy)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+)
+
+// BotKeyRepository stores the API keys bot accounts log in with. Only a
+// SHA-256 of each key is kept; a key is shown once, when it is issued.
+type BotKeyRepository struct {
+    db *DB
+}
+
+func NewBotKeyRepository(db *DB) *BotKeyRepository {
+    return &BotKeyRepository{db: db}
+}
+
+// Replace revokes the bot's current keys and stores a new one.
+func (r *BotKeyRepository) Replace(userID int64, keyHash string, createdBy int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    now := time.Now()
+
+    return r.db.WithTx(func(tx *DB) error {
+        revoke := `UPDATE bot_api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+        if _, err := tx.ExecContext(ctx, revoke, now, userID); err != nil {
+            return fmt.Errorf("failed to revoke bot keys: %w", err)
+        }
+
+        insert := `INSERT INTO bot_api_keys (user_id, key_hash, created_by, created_at) VALUES (?, ?, ?, ?)`
+        if _, err := tx.ExecContext(ctx, insert, userID, keyHash, createdBy, now); err != nil {
+            return fmt.Errorf("failed to store bot key: %w", err)
+        }
+
+        return nil
+    })
+}
+
+// Use reports whether keyHash is a live key of the bot, recording the use
+// if it is.
+func (r *BotKeyRepository) Use(userID int64, keyHash string) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT key_id FROM bot_api_keys WHERE user_id = ? AND key_hash = ? AND revoked_at IS NULL`
+
+    var keyID int64
+    err := r.db.QueryRowContext(ctx, query, userID, keyHash).Scan(&keyID)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to check bot key: %w", err)
+    }
+
+    if _, err := r.db.ExecContext(ctx, `UPDATE bot_api_keys SET last_used_at = ? WHERE key_id = ?`, time.Now(), keyID); err != nil {
+        return false, fmt.Errorf("failed to record bot key use: %w", err)
+    }
+
+    return true, nil
+}
+
+// LastUsed returns when the bot's live key was last used, or nil if it
+// has no live key or the key was never used.
+func (r *BotKeyRepository) LastUsed(userID int64) (*time.Time, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT last_used_at FROM bot_api_keys WHERE user_id = ? AND revoked_at IS NULL`
+
+    var lastUsed *time.Time
+    err := r.db.QueryRowContext(ctx, query, userID).Scan(&lastUsed)
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get bot key: %w", err)
+    }
+
+    return lastUsed, nil
+}
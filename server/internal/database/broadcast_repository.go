@@ -0,0 +1,133 @@
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type BroadcastRepository struct {
+    db *DB
+}
+
+func NewBroadcastRepository(db *DB) *BroadcastRepository {
+    return &BroadcastRepository{db: db}
+}
+
+func (r *BroadcastRepository) Create(createdBy int64, message string, runAt time.Time, interval time.Duration) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO scheduled_broadcasts (tenant_id, created_by, message, next_run_at, interval_seconds, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    broadcastID, err := r.db.InsertContext(ctx, "broadcast_id", query, r.db.Tenant(), createdBy, message, runAt,
+        int(interval/time.Second), time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to schedule broadcast: %w", err)
+    }
+
+    return broadcastID, nil
+}
+
+// List returns the scheduled broadcasts that are due by before, or all of
+// them when before is zero, soonest first.
+func (r *BroadcastRepository) List(before time.Time) ([]*models.ScheduledBroadcast, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT b.broadcast_id, b.created_by, u.username, b.message, b.next_run_at, b.interval_seconds, b.runs, b.created_at
+        FROM scheduled_broadcasts b
+        JOIN users u ON u.user_id = b.created_by
+        WHERE b.tenant_id = ?
+    `
+    args := []interface{}{r.db.Tenant()}
+    if !before.IsZero() {
+        query += " AND b.next_run_at <= ?"
+        args = append(args, before)
+    }
+    query += " ORDER BY b.next_run_at, b.broadcast_id"
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list scheduled broadcasts: %w", err)
+    }
+    defer rows.Close()
+
+    var broadcasts []*models.ScheduledBroadcast
+    for rows.Next() {
+        broadcast := &models.ScheduledBroadcast{}
+        var intervalSeconds int
+        err := rows.Scan(
+            &broadcast.BroadcastID,
+            &broadcast.CreatedBy,
+            &broadcast.CreatorName,
+            &broadcast.Message,
+            &broadcast.NextRunAt,
+            &intervalSeconds,
+            &broadcast.Runs,
+            &broadcast.CreatedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan scheduled broadcast: %w", err)
+        }
+        broadcast.Interval = time.Duration(intervalSeconds) * time.Second
+        broadcasts = append(broadcasts, broadcast)
+    }
+
+    return broadcasts, nil
+}
+
+// Claim takes the run of broadcast that was read with broadcast.Runs,
+// moving it on to next or, for a one-off, deleting it. It reports false
+// when another node has already taken that run or the broadcast was
+// cancelled.
+func (r *BroadcastRepository) Claim(broadcast *models.ScheduledBroadcast, next time.Time) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM scheduled_broadcasts WHERE broadcast_id = ? AND tenant_id = ? AND runs = ?`
+    args := []interface{}{broadcast.BroadcastID, r.db.Tenant(), broadcast.Runs}
+    if broadcast.Interval > 0 {
+        query = `
+            UPDATE scheduled_broadcasts SET next_run_at = ?, runs = runs + 1
+            WHERE broadcast_id = ? AND tenant_id = ? AND runs = ?
+        `
+        args = append([]interface{}{next}, args...)
+    }
+
+    result, err := r.db.ExecContext(ctx, query, args...)
+    if err != nil {
+        return false, fmt.Errorf("failed to claim scheduled broadcast: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to claim scheduled broadcast: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+func (r *BroadcastRepository) Delete(broadcastID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM scheduled_broadcasts WHERE broadcast_id = ? AND tenant_id = ?`
+
+    result, err := r.db.ExecContext(ctx, query, broadcastID, r.db.Tenant())
+    if err != nil {
+        return false, fmt.Errorf("failed to delete scheduled broadcast: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to delete scheduled broadcast: %w", err)
+    }
+
+    return affected > 0, nil
+}
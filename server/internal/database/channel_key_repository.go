@@ -0,0 +1,53 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+)
+
+type ChannelKeyRepository struct {
+    db *DB
+}
+
+func NewChannelKeyRepository(db *DB) *ChannelKeyRepository {
+    return &ChannelKeyRepository{db: db}
+}
+
+func (r *ChannelKeyRepository) Get(channelID int64) (string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT encrypted_key FROM channel_keys WHERE channel_id = ?`
+
+    var encryptedKey string
+    err := r.db.QueryRowContext(ctx, query, channelID).Scan(&encryptedKey)
+    if err == sql.ErrNoRows {
+        return "", fmt.Errorf("channel key not found: %w", err)
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to get channel key: %w", err)
+    }
+
+    return encryptedKey, nil
+}
+
+// Create stores a channel's first key. A key already stored, by another
+// node or a concurrent caller, is kept: replacing it would make the history
+// encrypted under it unreadable. Callers read the key back with Get.
+func (r *ChannelKeyRepository) Create(channelID int64, encryptedKey string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO channel_keys (channel_id, encrypted_key, created_at)
+        VALUES (?, ?, ?)
+    ` + r.db.Dialect().OnConflictIgnore("channel_id")
+
+    _, err := r.db.ExecContext(ctx, query, channelID, encryptedKey, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to save channel key: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type ChannelModeRepository struct {
+    db *DB
+}
+
+func NewChannelModeRepository(db *DB) *ChannelModeRepository {
+    return &ChannelModeRepository{db: db}
+}
+
+// Get returns the modes of a channel; channels that never had a mode set
+// get the zero value.
+func (r *ChannelModeRepository) Get(channelID int64) (*models.ChannelModes, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT announce, moderated, invite_only, key_hash, member_limit FROM channel_modes WHERE channel_id = ?`
+
+    modes := &models.ChannelModes{}
+    err := r.db.QueryRowContext(ctx, query, channelID).Scan(&modes.Announce, &modes.Moderated, &modes.InviteOnly, &modes.KeyHash, &modes.MemberLimit)
+    if err == sql.ErrNoRows {
+        return modes, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel modes: %w", err)
+    }
+
+    return modes, nil
+}
+
+func (r *ChannelModeRepository) Set(channelID int64, modes *models.ChannelModes) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO channel_modes (channel_id, announce, moderated, invite_only, key_hash, member_limit, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("channel_id", "announce", "moderated", "invite_only", "key_hash", "member_limit", "updated_at")
+
+    _, err := r.db.ExecContext(ctx, query, channelID, modes.Announce, modes.Moderated, modes.InviteOnly, modes.KeyHash, modes.MemberLimit, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to set channel modes: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelModeRepository) AddInvite(channelID, userID, invitedBy int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO channel_invites (channel_id, user_id, invited_by, created_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("channel_id, user_id", "invited_by", "created_at")
+
+    _, err := r.db.ExecContext(ctx, query, channelID, userID, invitedBy, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to store invite: %w", err)
+    }
+
+    return nil
+}
+
+// ConsumeInvite removes a pending invite and reports whether there was one.
+func (r *ChannelModeRepository) ConsumeInvite(channelID, userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM channel_invites WHERE channel_id = ? AND user_id = ?`
+
+    result, err := r.db.ExecContext(ctx, query, channelID, userID)
+    if err != nil {
+        return false, fmt.Errorf("failed to check invite: %w", err)
+    }
+
+    removed, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to check invite: %w", err)
+    }
+
+    return removed > 0, nil
+}
+
+// DeleteInvitesBefore drops pending invites created before cutoff.
+func (r *ChannelModeRepository) DeleteInvitesBefore(cutoff time.Time) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        DELETE FROM channel_invites
+        WHERE created_at < ?
+          AND channel_id IN (SELECT channel_id FROM channels WHERE tenant_id = ?)
+    `
+
+    result, err := r.db.ExecContext(ctx, query, cutoff, r.db.Tenant())
+    if err != nil {
+        return 0, fmt.Errorf("failed to expire invites: %w", err)
+    }
+
+    return result.RowsAffected()
+}
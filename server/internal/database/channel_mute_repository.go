@@ -0,0 +1,78 @@
+package database
+
+import (
+    "fmt"
+    "time"
+)
+
+type ChannelMuteRepository struct {
+    db *DB
+}
+
+func NewChannelMuteRepository(db *DB) *ChannelMuteRepository {
+    return &ChannelMuteRepository{db: db}
+}
+
+func (r *ChannelMuteRepository) Mute(userID, channelID int64, until *time.Time) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO channel_mutes (user_id, channel_id, muted_until, created_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("user_id, channel_id", "muted_until", "created_at")
+
+    _, err := r.db.ExecContext(ctx, query, userID, channelID, until, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to mute channel: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelMuteRepository) Unmute(userID, channelID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM channel_mutes WHERE user_id = ? AND channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, userID, channelID)
+    if err != nil {
+        return fmt.Errorf("failed to unmute channel: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelMuteRepository) GetActive(userID int64) (map[int64]time.Time, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT channel_id, muted_until
+        FROM channel_mutes
+        WHERE user_id = ? AND (muted_until IS NULL OR muted_until > ?)
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID, time.Now())
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel mutes: %w", err)
+    }
+    defer rows.Close()
+
+    mutes := make(map[int64]time.Time)
+    for rows.Next() {
+        var channelID int64
+        var mutedUntil *time.Time
+        if err := rows.Scan(&channelID, &mutedUntil); err != nil {
+            return nil, fmt.Errorf("failed to scan channel mute: %w", err)
+        }
+
+        if mutedUntil != nil {
+            mutes[channelID] = *mutedUntil
+        } else {
+            mutes[channelID] = time.Time{}
+        }
+    }
+
+    return mutes, nil
+}
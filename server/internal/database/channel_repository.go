@@ -1,12 +1,19 @@
 package database
 
 import (
+    "context"
     "database/sql"
+    "errors"
     "fmt"
+    "time"
 
     "github.com/onyxirc/server/internal/models"
 )
 
+// ErrLastOwner is returned by LeaveChannel when the owner tries to leave a
+// channel that still has other members.
+var ErrLastOwner = errors.New("channel owner must transfer ownership before leaving")
+
 type ChannelRepository struct {
     db *DB
 }
@@ -20,22 +27,26 @@ func (r *ChannelRepository) Create(channelName string, createdBy int64, isPrivat
     defer cancel()
 
     query := `
-        INSERT INTO channels (channel_name, created_by, is_private)
-        VALUES (?, ?, ?)
+        INSERT INTO channels (tenant_id, channel_name, created_by, is_private)
+        VALUES (?, ?, ?, ?)
     `
 
-    result, err := r.db.ExecContext(ctx, query, channelName, createdBy, isPrivate)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create channel: %w", err)
-    }
+    // A channel must never exist without its owner.
+    var channelID int64
+    err := r.db.WithTx(func(tx *DB) error {
+        var err error
+        channelID, err = tx.InsertContext(ctx, "channel_id", query, tx.Tenant(), channelName, createdBy, isPrivate)
+        if err != nil {
+            return fmt.Errorf("failed to create channel: %w", err)
+        }
 
-    channelID, err := result.LastInsertId()
+        if err := NewChannelRepository(tx).AddMember(channelID, createdBy, "owner"); err != nil {
+            return fmt.Errorf("failed to add creator as owner: %w", err)
+        }
+        return nil
+    })
     if err != nil {
-        return nil, fmt.Errorf("failed to get channel ID: %w", err)
-    }
-
-    if err := r.AddMember(channelID, createdBy, "owner"); err != nil {
-        return nil, fmt.Errorf("failed to add creator as owner: %w", err)
+        return nil, err
     }
 
     return r.GetByID(channelID)
@@ -46,13 +57,13 @@ func (r *ChannelRepository) GetByID(channelID int64) (*models.Channel, error) {
     defer cancel()
 
     query := `
-        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members
+        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members, is_archived
         FROM channels
-        WHERE channel_id = ?
+        WHERE channel_id = ? AND tenant_id = ?
     `
 
     channel := &models.Channel{}
-    err := r.db.QueryRowContext(ctx, query, channelID).Scan(
+    err := r.db.QueryRowContext(ctx, query, channelID, r.db.Tenant()).Scan(
         &channel.ChannelID,
         &channel.ChannelName,
         &channel.CreatedBy,
@@ -60,6 +71,7 @@ func (r *ChannelRepository) GetByID(channelID int64) (*models.Channel, error) {
         &channel.Topic,
         &channel.IsPrivate,
         &channel.MaxMembers,
+        &channel.IsArchived,
     )
 
     if err == sql.ErrNoRows {
@@ -73,17 +85,37 @@ func (r *ChannelRepository) GetByID(channelID int64) (*models.Channel, error) {
 }
 
 func (r *ChannelRepository) GetByName(channelName string) (*models.Channel, error) {
+    // A replica may not have the channel yet if it was just created; a miss
+    // there is confirmed against the primary so JOIN does not try to create
+    // it a second time.
+    reader := r.db.Reader()
+    channel, err := r.getByName(reader, channelName)
+    if err == sql.ErrNoRows && reader != r.db {
+        channel, err = r.getByName(r.db, channelName)
+    }
+
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("channel not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel: %w", err)
+    }
+
+    return channel, nil
+}
+
+func (r *ChannelRepository) getByName(db *DB, channelName string) (*models.Channel, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
     query := `
-        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members
+        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members, is_archived
         FROM channels
-        WHERE channel_name = ?
+        WHERE channel_name = ? AND tenant_id = ?
     `
 
     channel := &models.Channel{}
-    err := r.db.QueryRowContext(ctx, query, channelName).Scan(
+    err := db.QueryRowContext(ctx, query, channelName, r.db.Tenant()).Scan(
         &channel.ChannelID,
         &channel.ChannelName,
         &channel.CreatedBy,
@@ -91,13 +123,10 @@ func (r *ChannelRepository) GetByName(channelName string) (*models.Channel, erro
         &channel.Topic,
         &channel.IsPrivate,
         &channel.MaxMembers,
+        &channel.IsArchived,
     )
-
-    if err == sql.ErrNoRows {
-        return nil, fmt.Errorf("channel not found")
-    }
     if err != nil {
-        return nil, fmt.Errorf("failed to get channel: %w", err)
+        return nil, err
     }
 
     return channel, nil
@@ -108,13 +137,13 @@ func (r *ChannelRepository) List() ([]*models.Channel, error) {
     defer cancel()
 
     query := `
-        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members
+        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members, is_archived
         FROM channels
-        WHERE is_private = FALSE
+        WHERE is_private = FALSE AND is_archived = FALSE AND tenant_id = ?
         ORDER BY channel_name
     `
 
-    rows, err := r.db.QueryContext(ctx, query)
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant())
     if err != nil {
         return nil, fmt.Errorf("failed to list channels: %w", err)
     }
@@ -131,6 +160,7 @@ func (r *ChannelRepository) List() ([]*models.Channel, error) {
             &channel.Topic,
             &channel.IsPrivate,
             &channel.MaxMembers,
+            &channel.IsArchived,
         )
         if err != nil {
             return nil, fmt.Errorf("failed to scan channel: %w", err)
@@ -158,6 +188,94 @@ func (r *ChannelRepository) AddMember(channelID, userID int64, role string) erro
     return nil
 }
 
+// JoinMember adds userID to the channel and returns the role it was given.
+// The first member of a channel without an owner becomes its owner, so a
+// channel always regains one. The channel row is locked for the length of
+// the transaction so a concurrent LeaveChannel cannot interleave.
+func (r *ChannelRepository) JoinMember(channelID, userID int64) (string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    role := "member"
+    err := r.db.WithTx(func(tx *DB) error {
+        if err := lockChannel(ctx, tx, channelID); err != nil {
+            return err
+        }
+
+        var owners int
+        query := `SELECT COUNT(*) FROM channel_members WHERE channel_id = ? AND role = 'owner'`
+        if err := tx.QueryRowContext(ctx, query, channelID).Scan(&owners); err != nil {
+            return fmt.Errorf("failed to count owners: %w", err)
+        }
+        if owners == 0 {
+            role = "owner"
+        }
+
+        query = `INSERT INTO channel_members (channel_id, user_id, role) VALUES (?, ?, ?)`
+        if _, err := tx.ExecContext(ctx, query, channelID, userID, role); err != nil {
+            return fmt.Errorf("failed to add member: %w", err)
+        }
+        return nil
+    })
+    if err != nil {
+        return "", err
+    }
+
+    return role, nil
+}
+
+// LeaveChannel removes userID from the channel. An owner may only leave once
+// no other member remains; otherwise it returns ErrLastOwner. The role check
+// and the removal share one transaction with the channel row locked, so a
+// JOIN cannot land in between and leave the newcomer without an owner.
+func (r *ChannelRepository) LeaveChannel(channelID, userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    return r.db.WithTx(func(tx *DB) error {
+        if err := lockChannel(ctx, tx, channelID); err != nil {
+            return err
+        }
+
+        var role string
+        query := `SELECT role FROM channel_members WHERE channel_id = ? AND user_id = ?`
+        err := tx.QueryRowContext(ctx, query, channelID, userID).Scan(&role)
+        if err == sql.ErrNoRows {
+            return fmt.Errorf("not a member")
+        }
+        if err != nil {
+            return fmt.Errorf("failed to get role: %w", err)
+        }
+
+        if role == "owner" {
+            var others int
+            query = `SELECT COUNT(*) FROM channel_members WHERE channel_id = ? AND user_id <> ?`
+            if err := tx.QueryRowContext(ctx, query, channelID, userID).Scan(&others); err != nil {
+                return fmt.Errorf("failed to count members: %w", err)
+            }
+            if others > 0 {
+                return ErrLastOwner
+            }
+        }
+
+        query = `DELETE FROM channel_members WHERE channel_id = ? AND user_id = ?`
+        if _, err := tx.ExecContext(ctx, query, channelID, userID); err != nil {
+            return fmt.Errorf("failed to remove member: %w", err)
+        }
+        return nil
+    })
+}
+
+// lockChannel takes a write lock on the channel row with a no-op update,
+// which every supported driver honours inside a transaction.
+func lockChannel(ctx context.Context, tx *DB, channelID int64) error {
+    query := `UPDATE channels SET channel_id = channel_id WHERE channel_id = ?`
+    if _, err := tx.ExecContext(ctx, query, channelID); err != nil {
+        return fmt.Errorf("failed to lock channel: %w", err)
+    }
+    return nil
+}
+
 func (r *ChannelRepository) RemoveMember(channelID, userID int64) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -171,6 +289,9 @@ func (r *ChannelRepository) RemoveMember(channelID, userID int64) error {
     return nil
 }
 
+// GetMembers always reads from the primary. The channel manager caches the
+// result to authorize PRIVMSG and MODE, and a lagging replica could bring
+// back a member who was just kicked until the next invalidation.
 func (r *ChannelRepository) GetMembers(channelID int64) ([]*models.ChannelMember, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -239,6 +360,66 @@ func (r *ChannelRepository) GetMemberRole(channelID, userID int64) (string, erro
     return role, nil
 }
 
+func (r *ChannelRepository) SetMemberRole(channelID, userID int64, role string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channel_members SET role = ? WHERE channel_id = ? AND user_id = ?`
+    result, err := r.db.ExecContext(ctx, query, role, channelID, userID)
+    if err != nil {
+        return fmt.Errorf("failed to set member role: %w", err)
+    }
+
+    if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+        return fmt.Errorf("user is not a member of the channel")
+    }
+
+    return nil
+}
+
+// TransferOwnership makes toUserID the owner and steps fromUserID down to
+// moderator in one transaction, so the channel always has an owner. It
+// fails unless fromUserID is the owner and toUserID a member.
+func (r *ChannelRepository) TransferOwnership(channelID, fromUserID, toUserID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    return r.db.WithTx(func(tx *DB) error {
+        query := `UPDATE channel_members SET role = 'moderator' WHERE channel_id = ? AND user_id = ? AND role = 'owner'`
+        result, err := tx.ExecContext(ctx, query, channelID, fromUserID)
+        if err != nil {
+            return fmt.Errorf("failed to step down owner: %w", err)
+        }
+        if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+            return fmt.Errorf("user is not the owner of the channel")
+        }
+
+        query = `UPDATE channel_members SET role = 'owner' WHERE channel_id = ? AND user_id = ?`
+        result, err = tx.ExecContext(ctx, query, channelID, toUserID)
+        if err != nil {
+            return fmt.Errorf("failed to set owner: %w", err)
+        }
+        if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+            return fmt.Errorf("user is not a member of the channel")
+        }
+
+        return nil
+    })
+}
+
+func (r *ChannelRepository) CountMembers(channelID int64) (int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var count int
+    err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM channel_members WHERE channel_id = ?`, channelID).Scan(&count)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count members: %w", err)
+    }
+
+    return count, nil
+}
+
 func (r *ChannelRepository) UpdateTopic(channelID int64, topic string) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -252,15 +433,324 @@ func (r *ChannelRepository) UpdateTopic(channelID int64, topic string) error {
     return nil
 }
 
-func (r *ChannelRepository) Delete(channelID int64) error {
+func (r *ChannelRepository) CountUserChannels(userID int64) (int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT COUNT(*) FROM channel_members WHERE user_id = ?`
+    var count int
+    err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count user channels: %w", err)
+    }
+
+    return count, nil
+}
+
+func (r *ChannelRepository) GetUserChannels(userID int64) ([]*models.Channel, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
-    query := `DELETE FROM channels WHERE channel_id = ?`
-    _, err := r.db.ExecContext(ctx, query, channelID)
+    query := `
+        SELECT c.channel_id, c.channel_name, c.created_by, c.created_at, c.topic, c.is_private, c.max_members, c.is_archived
+        FROM channels c
+        JOIN channel_members cm ON cm.channel_id = c.channel_id
+        WHERE cm.user_id = ?
+        ORDER BY cm.joined_at
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID)
     if err != nil {
-        return fmt.Errorf("failed to delete channel: %w", err)
+        return nil, fmt.Errorf("failed to get user channels: %w", err)
+    }
+    defer rows.Close()
+
+    var channels []*models.Channel
+    for rows.Next() {
+        channel := &models.Channel{}
+        err := rows.Scan(
+            &channel.ChannelID,
+            &channel.ChannelName,
+            &channel.CreatedBy,
+            &channel.CreatedAt,
+            &channel.Topic,
+            &channel.IsPrivate,
+            &channel.MaxMembers,
+            &channel.IsArchived,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan channel: %w", err)
+        }
+        channels = append(channels, channel)
+    }
+
+    return channels, nil
+}
+
+func (r *ChannelRepository) TouchActivity(channelID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channels SET last_activity_at = ?, idle_notified_at = NULL WHERE channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, time.Now(), channelID)
+    if err != nil {
+        return fmt.Errorf("failed to update channel activity: %w", err)
     }
 
     return nil
 }
+
+func (r *ChannelRepository) GetIdleChannels(idleSince time.Time) ([]*models.Channel, error) {
+    return r.queryChannels(`
+        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members, is_archived
+        FROM channels
+        WHERE tenant_id = ?
+          AND is_archived = FALSE
+          AND idle_notified_at IS NULL
+          AND COALESCE(last_activity_at, created_at) < ?
+    `, r.db.Tenant(), idleSince)
+}
+
+func (r *ChannelRepository) GetChannelsPendingArchive(notifiedBefore time.Time) ([]*models.Channel, error) {
+    return r.queryChannels(`
+        SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members, is_archived
+        FROM channels
+        WHERE tenant_id = ?
+          AND is_archived = FALSE
+          AND idle_notified_at IS NOT NULL
+          AND idle_notified_at < ?
+    `, r.db.Tenant(), notifiedBefore)
+}
+
+func (r *ChannelRepository) queryChannels(query string, args ...interface{}) ([]*models.Channel, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query channels: %w", err)
+    }
+    defer rows.Close()
+
+    var channels []*models.Channel
+    for rows.Next() {
+        channel := &models.Channel{}
+        err := rows.Scan(
+            &channel.ChannelID,
+            &channel.ChannelName,
+            &channel.CreatedBy,
+            &channel.CreatedAt,
+            &channel.Topic,
+            &channel.IsPrivate,
+            &channel.MaxMembers,
+            &channel.IsArchived,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan channel: %w", err)
+        }
+        channels = append(channels, channel)
+    }
+
+    return channels, nil
+}
+
+func (r *ChannelRepository) MarkIdleNotified(channelID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channels SET idle_notified_at = ? WHERE channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, time.Now(), channelID)
+    if err != nil {
+        return fmt.Errorf("failed to mark channel idle: %w", err)
+    }
+
+    return nil
+}
+
+// Archive takes a channel out of use without deleting it. Channels are never
+// hard-deleted: members and message history are kept for audit and for
+// Restore.
+func (r *ChannelRepository) Archive(channelID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channels SET is_archived = TRUE, archived_at = ? WHERE channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, time.Now(), channelID)
+    if err != nil {
+        return fmt.Errorf("failed to archive channel: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelRepository) Restore(channelID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE channels
+        SET is_archived = FALSE, archived_at = NULL, idle_notified_at = NULL, last_activity_at = ?
+        WHERE channel_id = ?
+    `
+    _, err := r.db.ExecContext(ctx, query, time.Now(), channelID)
+    if err != nil {
+        return fmt.Errorf("failed to restore channel: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelRepository) GetJoinThrottle(channelID int64) (int, int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT join_throttle_joins, join_throttle_seconds FROM channels WHERE channel_id = ?`
+
+    var joins, seconds int
+    err := r.db.QueryRowContext(ctx, query, channelID).Scan(&joins, &seconds)
+    if err == sql.ErrNoRows {
+        return 0, 0, fmt.Errorf("channel not found")
+    }
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to get join throttle: %w", err)
+    }
+
+    return joins, seconds, nil
+}
+
+func (r *ChannelRepository) SetJoinThrottle(channelID int64, joins, seconds int) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channels SET join_throttle_joins = ?, join_throttle_seconds = ? WHERE channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, joins, seconds, channelID)
+    if err != nil {
+        return fmt.Errorf("failed to set join throttle: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ChannelRepository) GetForward(channelID int64) (*int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT forward_channel_id FROM channels WHERE channel_id = ?`
+
+    var forward sql.NullInt64
+    err := r.db.QueryRowContext(ctx, query, channelID).Scan(&forward)
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("channel not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel forward: %w", err)
+    }
+
+    if !forward.Valid {
+        return nil, nil
+    }
+    return &forward.Int64, nil
+}
+
+func (r *ChannelRepository) SetForward(channelID int64, targetID *int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE channels SET forward_channel_id = ? WHERE channel_id = ?`
+    _, err := r.db.ExecContext(ctx, query, targetID, channelID)
+    if err != nil {
+        return fmt.Errorf("failed to set channel forward: %w", err)
+    }
+
+    return nil
+}
+
+// Rename changes the channel name and records the old name as an alias in one
+// transaction, so the old name never resolves to nothing.
+func (r *ChannelRepository) Rename(channelID int64, oldName, newName string, aliasExpires *time.Time) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    return r.db.WithTx(func(tx *DB) error {
+        query := `UPDATE channels SET channel_name = ? WHERE channel_id = ? AND tenant_id = ?`
+        if _, err := tx.ExecContext(ctx, query, newName, channelID, tx.Tenant()); err != nil {
+            return fmt.Errorf("failed to rename channel: %w", err)
+        }
+
+        query = `
+            INSERT INTO channel_aliases (tenant_id, alias_name, channel_id, expires_at, created_at)
+            VALUES (?, ?, ?, ?, ?)
+        ` + tx.Dialect().OnConflictUpdate("tenant_id, alias_name", "channel_id", "expires_at", "created_at")
+        if _, err := tx.ExecContext(ctx, query, tx.Tenant(), oldName, channelID, aliasExpires, time.Now()); err != nil {
+            return fmt.Errorf("failed to record channel alias: %w", err)
+        }
+
+        return nil
+    })
+}
+
+func (r *ChannelRepository) ResolveAlias(aliasName string) (*models.Channel, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT channel_id FROM channel_aliases
+        WHERE tenant_id = ? AND alias_name = ? AND (expires_at IS NULL OR expires_at > ?)
+    `
+
+    var channelID int64
+    err := r.db.QueryRowContext(ctx, query, r.db.Tenant(), aliasName, time.Now()).Scan(&channelID)
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("channel alias not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to resolve channel alias: %w", err)
+    }
+
+    return r.GetByID(channelID)
+}
+
+// NextSeq advances the channel's last_seq by one and returns the new value.
+// The row is locked by the update until the transaction ends, so servers
+// sharing the database never get the same number.
+func (r *ChannelRepository) NextSeq(channelID int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var seq int64
+    err := r.db.WithTx(func(tx *DB) error {
+        result, err := tx.ExecContext(ctx, `UPDATE channels SET last_seq = last_seq + 1 WHERE channel_id = ?`, channelID)
+        if err != nil {
+            return fmt.Errorf("failed to advance channel sequence: %w", err)
+        }
+        if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+            return fmt.Errorf("channel not found")
+        }
+
+        if err := tx.QueryRowContext(ctx, `SELECT last_seq FROM channels WHERE channel_id = ?`, channelID).Scan(&seq); err != nil {
+            return fmt.Errorf("failed to get channel sequence: %w", err)
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, err
+    }
+
+    return seq, nil
+}
+
+func (r *ChannelRepository) GetLastSeq(channelID int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var lastSeq int64
+    err := r.db.QueryRowContext(ctx, `SELECT last_seq FROM channels WHERE channel_id = ?`, channelID).Scan(&lastSeq)
+    if err == sql.ErrNoRows {
+        return 0, fmt.Errorf("channel not found")
+    }
+    if err != nil {
+        return 0, fmt.Errorf("failed to get channel sequence: %w", err)
+    }
+
+    return lastSeq, nil
+}
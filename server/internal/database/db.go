@@ -1,6 +1,7 @@
 package database
 
 import (
+    "context"
     "database/sql"
     "fmt"
     "time"
@@ -9,37 +10,116 @@ import (
     "github.com/onyxirc/server/internal/config"
 )
 
+const DefaultTenant = "default"
+
 type DB struct {
     *sql.DB
+    tx      *sql.Tx
+    stmts   *stmtCache
+    dialect Dialect
+    tenant  string
+    shared  bool
+    storage *StorageCipher
+    replicas *replicaSet
+}
+
+// queryer is the part of *sql.DB and *sql.Tx that repositories use.
+type queryer interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+    Query(query string, args ...interface{}) (*sql.Rows, error)
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+    QueryRow(query string, args ...interface{}) *sql.Row
+    QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 func NewConnection(cfg config.DatabaseConfig) (*DB, error) {
-    
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-        cfg.User,
-        cfg.Password,
-        cfg.Host,
-        cfg.Port,
-        cfg.Name,
-    )
-
-    db, err := sql.Open("mysql", dsn)
+    dialect, err := ParseDialect(cfg.Driver)
+    if err != nil {
+        return nil, err
+    }
+
+    if !driverRegistered(dialect.driverName()) {
+        return nil, fmt.Errorf("database driver %s is not compiled in; rebuild with -tags %s", dialect, dialect.buildTag())
+    }
+
+    db, err := sql.Open(dialect.driverName(), dialect.dsn(cfg))
     if err != nil {
         return nil, fmt.Errorf("failed to open database: %w", err)
     }
 
-    db.SetMaxOpenConns(cfg.MaxOpenConns)
-    db.SetMaxIdleConns(cfg.MaxIdleConns)
+    if dialect == DialectSQLite {
+        db.SetMaxOpenConns(1)
+    } else {
+        db.SetMaxOpenConns(cfg.MaxOpenConns)
+        db.SetMaxIdleConns(cfg.MaxIdleConns)
+    }
     db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
     if err := db.Ping(); err != nil {
         return nil, fmt.Errorf("failed to ping database: %w", err)
     }
 
-    return &DB{db}, nil
+    conn := &DB{DB: db, dialect: dialect, tenant: DefaultTenant}
+    if cfg.StatementCacheSize > 0 {
+        conn.stmts = newStmtCache(cfg.StatementCacheSize)
+    }
+
+    if conn.storage, err = LoadStorageCipher(cfg); err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    if len(cfg.ReadReplicas) > 0 {
+        if conn.replicas, err = openReplicas(dialect, cfg); err != nil {
+            db.Close()
+            return nil, err
+        }
+    }
+
+    return conn, nil
+}
+
+// ForTenant returns a handle sharing the same connection pool whose
+// repositories only see rows belonging to the given tenant. Closing it leaves
+// the pool open for the other tenants.
+func (db *DB) ForTenant(tenant string) *DB {
+    scoped := *db
+    scoped.tenant = tenant
+    scoped.shared = true
+    return &scoped
+}
+
+func (db *DB) Tenant() string {
+    if db.tenant == "" {
+        return DefaultTenant
+    }
+    return db.tenant
+}
+
+func driverRegistered(name string) bool {
+    for _, driver := range sql.Drivers() {
+        if driver == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (db *DB) Dialect() Dialect {
+    return db.dialect
 }
 
 func (db *DB) Close() error {
+    if db.shared {
+        return nil
+    }
+    if db.stmts != nil {
+        db.stmts.close()
+    }
+    if db.replicas != nil {
+        db.replicas.close()
+    }
     return db.DB.Close()
 }
 
@@ -54,6 +134,92 @@ func (db *DB) BeginTx() (*sql.Tx, error) {
     return db.DB.Begin()
 }
 
+// WithTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. Repositories built on the handle passed to fn run their
+// statements in the transaction; fn must not use any other handle, or with
+// SQLite's single connection it would wait on itself. Called on a handle
+// that is already in a transaction, fn joins it.
+func (db *DB) WithTx(fn func(tx *DB) error) error {
+    if db.tx != nil {
+        return fn(db)
+    }
+
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback()
+
+    scoped := *db
+    scoped.tx = tx
+    if err := fn(&scoped); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit transaction: %w", err)
+    }
+    return nil
+}
+
+func (db *DB) conn() queryer {
+    if db.tx != nil {
+        return db.tx
+    }
+    return db.DB
+}
+
 func (db *DB) Stats() sql.DBStats {
     return db.DB.Stats()
 }
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+    return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+    query = db.dialect.Rebind(query)
+    if stmt := db.prepared(ctx, query); stmt != nil {
+        return stmt.ExecContext(ctx, args...)
+    }
+    return db.conn().ExecContext(ctx, query, args...)
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+    return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+    query = db.dialect.Rebind(query)
+    if stmt := db.prepared(ctx, query); stmt != nil {
+        return stmt.QueryContext(ctx, args...)
+    }
+    return db.conn().QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+    return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+    query = db.dialect.Rebind(query)
+    if stmt := db.prepared(ctx, query); stmt != nil {
+        return stmt.QueryRowContext(ctx, args...)
+    }
+    return db.conn().QueryRowContext(ctx, query, args...)
+}
+
+func (db *DB) InsertContext(ctx context.Context, idColumn, query string, args ...interface{}) (int64, error) {
+    if db.dialect == DialectPostgres {
+        var id int64
+        err := db.QueryRowContext(ctx, query+" RETURNING "+idColumn, args...).Scan(&id)
+        return id, err
+    }
+
+    result, err := db.ExecContext(ctx, query, args...)
+    if err != nil {
+        return 0, err
+    }
+
+    return result.LastInsertId()
+}
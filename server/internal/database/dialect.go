@@ -0,0 +1,214 @@
+package database
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+type Dialect string
+
+const (
+    DialectMySQL    Dialect = "mysql"
+    DialectPostgres Dialect = "postgres"
+    DialectSQLite   Dialect = "sqlite"
+)
+
+func ParseDialect(driver string) (Dialect, error) {
+    switch strings.ToLower(driver) {
+    case "", "mysql":
+        return DialectMySQL, nil
+    case "postgres", "postgresql":
+        return DialectPostgres, nil
+    case "sqlite", "sqlite3":
+        return DialectSQLite, nil
+    default:
+        return "", fmt.Errorf("unsupported database driver: %s", driver)
+    }
+}
+
+func (d Dialect) driverName() string {
+    return string(d)
+}
+
+func (d Dialect) buildTag() string {
+    return string(d)
+}
+
+func (d Dialect) dsn(cfg config.DatabaseConfig) string {
+    switch d {
+    case DialectPostgres:
+        sslMode := cfg.SSLMode
+        if sslMode == "" {
+            sslMode = "disable"
+        }
+        return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+            cfg.Host,
+            cfg.Port,
+            cfg.User,
+            cfg.Password,
+            cfg.Name,
+            sslMode,
+        )
+    case DialectSQLite:
+        return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", cfg.Path)
+    default:
+        return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+            cfg.User,
+            cfg.Password,
+            cfg.Host,
+            cfg.Port,
+            cfg.Name,
+        )
+    }
+}
+
+func (d Dialect) Rebind(query string) string {
+    if d != DialectPostgres {
+        return query
+    }
+
+    var b strings.Builder
+    b.Grow(len(query) + 16)
+
+    n := 0
+    inQuote := false
+    for _, ch := range query {
+        switch {
+        case ch == '\'':
+            inQuote = !inQuote
+            b.WriteRune(ch)
+        case ch == '?' && !inQuote:
+            n++
+            b.WriteString("$" + strconv.Itoa(n))
+        default:
+            b.WriteRune(ch)
+        }
+    }
+
+    return b.String()
+}
+
+func (d Dialect) OnConflictUpdate(conflictColumns string, columns ...string) string {
+    assignments := make([]string, len(columns))
+
+    if d == DialectMySQL {
+        for i, column := range columns {
+            assignments[i] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+        }
+        return "ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+    }
+
+    for i, column := range columns {
+        assignments[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+    }
+    return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", conflictColumns, strings.Join(assignments, ", "))
+}
+
+// OnConflictIgnore makes an INSERT leave an existing row with the same key
+// alone. MySQL has no DO NOTHING, so the key is assigned to itself.
+func (d Dialect) OnConflictIgnore(conflictColumn string) string {
+    if d == DialectMySQL {
+        return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s", conflictColumn, conflictColumn)
+    }
+    return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", conflictColumn)
+}
+
+var (
+    ddlTableOptions  = regexp.MustCompile(`(?s)\)\s*ENGINE=.*$`)
+    ddlComment       = regexp.MustCompile(`\s+COMMENT\s+'(?:[^']|'')*'`)
+    ddlOnUpdate      = regexp.MustCompile(`\s+ON UPDATE CURRENT_TIMESTAMP`)
+    ddlEnum          = regexp.MustCompile(`ENUM\([^)]*\)`)
+    ddlAutoIncrement = regexp.MustCompile(`BIGINT AUTO_INCREMENT PRIMARY KEY`)
+    ddlCreateTable   = regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+    ddlAlterTable    = regexp.MustCompile(`(?i)^ALTER TABLE (\w+)\s+`)
+    ddlIndex         = regexp.MustCompile(`^INDEX (\w+) (\(.*\))$`)
+    ddlUniqueKey     = regexp.MustCompile(`^UNIQUE KEY \w+ (\(.*\))$`)
+)
+
+// translateDDL covers only the MySQL DDL subset used by the schema and
+// migrations; keep new migrations within it.
+func (d Dialect) translateDDL(statement string) []string {
+    statement = strings.TrimSpace(statement)
+    if d == DialectMySQL || statement == "" {
+        return []string{statement}
+    }
+
+    statement = ddlTableOptions.ReplaceAllString(statement, ")")
+    statement = ddlComment.ReplaceAllString(statement, "")
+    statement = ddlOnUpdate.ReplaceAllString(statement, "")
+    statement = ddlEnum.ReplaceAllString(statement, "VARCHAR(20)")
+
+    if d == DialectPostgres {
+        statement = ddlAutoIncrement.ReplaceAllString(statement, "BIGSERIAL PRIMARY KEY")
+    } else {
+        statement = ddlAutoIncrement.ReplaceAllString(statement, "INTEGER PRIMARY KEY AUTOINCREMENT")
+    }
+
+    if m := ddlCreateTable.FindStringSubmatch(statement); m != nil {
+        return d.translateCreateTable(m[1], statement)
+    }
+
+    if m := ddlAlterTable.FindStringSubmatch(statement); m != nil {
+        var statements []string
+        for _, clause := range splitDefinitions(statement[len(m[0]):]) {
+            statements = append(statements, fmt.Sprintf("ALTER TABLE %s %s", m[1], clause))
+        }
+        return statements
+    }
+
+    return []string{statement}
+}
+
+func (d Dialect) translateCreateTable(table, statement string) []string {
+    open := strings.Index(statement, "(")
+    end := strings.LastIndex(statement, ")")
+    if open == -1 || end < open {
+        return []string{statement}
+    }
+
+    var columns, indexes []string
+    for _, definition := range splitDefinitions(statement[open+1 : end]) {
+        if m := ddlIndex.FindStringSubmatch(definition); m != nil {
+            indexes = append(indexes, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s %s", table, m[1], table, m[2]))
+            continue
+        }
+        if m := ddlUniqueKey.FindStringSubmatch(definition); m != nil {
+            columns = append(columns, "UNIQUE "+m[1])
+            continue
+        }
+        columns = append(columns, definition)
+    }
+
+    create := fmt.Sprintf("%s (\n    %s\n)", strings.TrimSpace(statement[:open]), strings.Join(columns, ",\n    "))
+    return append([]string{create}, indexes...)
+}
+
+func splitDefinitions(body string) []string {
+    var definitions []string
+
+    depth := 0
+    start := 0
+    for i, ch := range body {
+        switch ch {
+        case '(':
+            depth++
+        case ')':
+            depth--
+        case ',':
+            if depth == 0 {
+                definitions = append(definitions, strings.TrimSpace(body[start:i]))
+                start = i + 1
+            }
+        }
+    }
+
+    if last := strings.TrimSpace(body[start:]); last != "" {
+        definitions = append(definitions, last)
+    }
+
+    return definitions
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+const directMessagesTable = "direct_messages"
+
+type DirectMessageRepository struct {
+    db *DB
+}
+
+func NewDirectMessageRepository(db *DB) *DirectMessageRepository {
+    return &DirectMessageRepository{db: db}
+}
+
+func (r *DirectMessageRepository) Create(senderID, recipientID int64, content, messageHash string) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    content, err := r.db.sealContent(directMessagesTable, []int64{senderID, recipientID}, content)
+    if err != nil {
+        return 0, err
+    }
+
+    query := `
+        INSERT INTO direct_messages (sender_id, recipient_id, message_content, message_hash, sent_at)
+        VALUES (?, ?, ?, ?, ?)
+    `
+
+    dmID, err := r.db.InsertContext(ctx, "dm_id", query, senderID, recipientID, content, messageHash, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to store direct message: %w", err)
+    }
+
+    return dmID, nil
+}
+
+func (r *DirectMessageRepository) MarkReadFrom(recipientID, senderID int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE direct_messages SET is_read = TRUE
+        WHERE recipient_id = ? AND sender_id = ? AND is_read = FALSE AND is_deleted = FALSE
+    `
+
+    result, err := r.db.ExecContext(ctx, query, recipientID, senderID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to mark direct messages read: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// CountReceivedSince returns, per sender, how many direct messages
+// recipientID has received since the given time.
+func (r *DirectMessageRepository) CountReceivedSince(recipientID int64, since time.Time) (map[int64]int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT sender_id, COUNT(*)
+        FROM direct_messages
+        WHERE recipient_id = ? AND sent_at > ? AND is_deleted = FALSE
+        GROUP BY sender_id
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, recipientID, since)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count direct messages: %w", err)
+    }
+    defer rows.Close()
+
+    counts := make(map[int64]int)
+    for rows.Next() {
+        var senderID int64
+        var count int
+        if err := rows.Scan(&senderID, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan direct message count: %w", err)
+        }
+        counts[senderID] = count
+    }
+
+    return counts, nil
+}
+
+// HasSent reports whether senderID has ever sent recipientID a direct
+// message that was recorded.
+func (r *DirectMessageRepository) HasSent(senderID, recipientID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT COUNT(*) FROM direct_messages WHERE sender_id = ? AND recipient_id = ? AND is_deleted = FALSE`
+
+    var count int
+    if err := r.db.QueryRowContext(ctx, query, senderID, recipientID).Scan(&count); err != nil {
+        return false, fmt.Errorf("failed to check direct messages: %w", err)
+    }
+
+    return count > 0, nil
+}
+
+// ListForUser returns the most recent direct messages userID sent or
+// received, oldest first.
+func (r *DirectMessageRepository) ListForUser(userID int64, limit int) ([]*models.DirectMessage, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT dm_id, sender_id, recipient_id, message_content, message_hash, sent_at, is_read, is_deleted
+        FROM (
+            SELECT dm_id, sender_id, recipient_id, message_content, message_hash, sent_at, is_read, is_deleted
+            FROM direct_messages
+            WHERE (sender_id = ? OR recipient_id = ?) AND is_deleted = FALSE
+            ORDER BY dm_id DESC
+            LIMIT ?
+        ) recent
+        ORDER BY dm_id ASC
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID, userID, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get direct messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.DirectMessage
+    for rows.Next() {
+        message := &models.DirectMessage{}
+        err := rows.Scan(
+            &message.DMID,
+            &message.SenderID,
+            &message.RecipientID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.SentAt,
+            &message.IsRead,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan direct message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(directMessagesTable, []int64{message.SenderID, message.RecipientID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// DeleteForUser removes every direct message userID sent or received.
+func (r *DirectMessageRepository) DeleteForUser(userID int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM direct_messages WHERE sender_id = ? OR recipient_id = ?`
+
+    result, err := r.db.ExecContext(ctx, query, userID, userID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete direct messages: %w", err)
+    }
+
+    return result.RowsAffected()
+}
@@ -0,0 +1,7 @@
+//go:build postgres
+
+package database
+
+import (
+    _ "github.com/lib/pq"
+)
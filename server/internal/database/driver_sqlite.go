@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package database
+
+import (
+    _ "modernc.org/sqlite"
+)
@@ -0,0 +1,90 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+)
+
+// Email token purposes.
+const (
+    EmailTokenVerify = "verify"
+    EmailTokenReset  = "reset"
+)
+
+type EmailTokenRepository struct {
+    db *DB
+}
+
+func NewEmailTokenRepository(db *DB) *EmailTokenRepository {
+    return &EmailTokenRepository{db: db}
+}
+
+// Create stores a token for purpose, replacing any earlier one the user had
+// for it.
+func (r *EmailTokenRepository) Create(userID int64, purpose, tokenHash, email string, ttl time.Duration) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO email_tokens (user_id, purpose, token_hash, email, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("user_id, purpose", "token_hash", "email", "created_at", "expires_at")
+
+    now := time.Now()
+    _, err := r.db.ExecContext(ctx, query, userID, purpose, tokenHash, email, now, now.Add(ttl))
+    if err != nil {
+        return fmt.Errorf("failed to create email token: %w", err)
+    }
+
+    return nil
+}
+
+// Consume deletes a matching unexpired token and returns the address it
+// was sent to, or "" when there was none.
+func (r *EmailTokenRepository) Consume(userID int64, purpose, tokenHash string) (string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT email FROM email_tokens
+        WHERE user_id = ? AND purpose = ? AND token_hash = ? AND expires_at > ?
+    `
+
+    var email string
+    err := r.db.QueryRowContext(ctx, query, userID, purpose, tokenHash, time.Now()).Scan(&email)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to check email token: %w", err)
+    }
+
+    // Deleting by hash as well means only one of two concurrent uses wins.
+    result, err := r.db.ExecContext(ctx, `DELETE FROM email_tokens WHERE user_id = ? AND purpose = ? AND token_hash = ?`, userID, purpose, tokenHash)
+    if err != nil {
+        return "", fmt.Errorf("failed to consume email token: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return "", fmt.Errorf("failed to consume email token: %w", err)
+    }
+    if affected == 0 {
+        return "", nil
+    }
+
+    return email, nil
+}
+
+func (r *EmailTokenRepository) DeleteExpired() (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM email_tokens WHERE expires_at <= ?`, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete expired email tokens: %w", err)
+    }
+
+    return result.RowsAffected()
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    EvidenceIP  = "ip"
+    EvidenceKey = "key"
+)
+
+type EvasionRepository struct {
+    db *DB
+}
+
+func NewEvasionRepository(db *DB) *EvasionRepository {
+    return &EvasionRepository{db: db}
+}
+
+// BannedUsersByIP returns actively banned accounts that logged in from
+// ipAddress since the given time, other than excludeUserID.
+func (r *EvasionRepository) BannedUsersByIP(ipAddress string, since time.Time, excludeUserID int64) ([]int64, error) {
+    query := `
+        SELECT DISTINCT t.user_id
+        FROM user_ip_tracking t
+        JOIN user_bans b ON b.user_id = t.user_id
+        JOIN users u ON u.user_id = t.user_id
+        WHERE t.ip_address = ? AND t.is_successful = TRUE AND t.login_timestamp > ?
+          AND t.user_id <> ? AND u.tenant_id = ?
+          AND b.is_active = TRUE AND (b.expires_at IS NULL OR b.expires_at > ?)
+    `
+
+    return r.queryUserIDs(query, ipAddress, since, excludeUserID, r.db.Tenant(), time.Now())
+}
+
+// BannedUsersByKey returns actively banned accounts whose stored public key
+// has the given fingerprint, other than excludeUserID.
+func (r *EvasionRepository) BannedUsersByKey(fingerprint string, excludeUserID int64) ([]int64, error) {
+    query := `
+        SELECT DISTINCT k.user_id
+        FROM user_keys k
+        JOIN user_bans b ON b.user_id = k.user_id
+        JOIN users u ON u.user_id = k.user_id
+        WHERE k.fingerprint = ? AND k.user_id <> ? AND u.tenant_id = ?
+          AND b.is_active = TRUE AND (b.expires_at IS NULL OR b.expires_at > ?)
+    `
+
+    return r.queryUserIDs(query, fingerprint, excludeUserID, r.db.Tenant(), time.Now())
+}
+
+func (r *EvasionRepository) queryUserIDs(query string, args ...interface{}) ([]int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up banned accounts: %w", err)
+    }
+    defer rows.Close()
+
+    var userIDs []int64
+    for rows.Next() {
+        var userID int64
+        if err := rows.Scan(&userID); err != nil {
+            return nil, fmt.Errorf("failed to scan banned account: %w", err)
+        }
+        userIDs = append(userIDs, userID)
+    }
+
+    return userIDs, nil
+}
+
+// Record stores a flag unless the same evidence already links the two
+// accounts, and reports whether it was new.
+func (r *EvasionRepository) Record(flag *models.EvasionFlag) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var existing int64
+    err := r.db.QueryRowContext(ctx, `
+        SELECT flag_id FROM evasion_flags
+        WHERE user_id = ? AND banned_user_id = ? AND evidence_type = ? AND evidence = ?
+    `, flag.UserID, flag.BannedUserID, flag.EvidenceType, flag.Evidence).Scan(&existing)
+    if err == nil {
+        return false, nil
+    }
+    if err != sql.ErrNoRows {
+        return false, fmt.Errorf("failed to check evasion flag: %w", err)
+    }
+
+    query := `
+        INSERT INTO evasion_flags (user_id, banned_user_id, evidence_type, evidence, detected_at, restricted)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    flagID, err := r.db.InsertContext(ctx, "flag_id", query, flag.UserID, flag.BannedUserID, flag.EvidenceType, flag.Evidence, time.Now(), flag.Restricted)
+    if err != nil {
+        return false, fmt.Errorf("failed to store evasion flag: %w", err)
+    }
+    flag.FlagID = flagID
+
+    return true, nil
+}
+
+// IsRestricted reports whether userID has an unreviewed flag that restricts it.
+func (r *EvasionRepository) IsRestricted(userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT COUNT(*) FROM evasion_flags WHERE user_id = ? AND restricted = TRUE AND reviewed_at IS NULL`
+
+    var count int
+    if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+        return false, fmt.Errorf("failed to check evasion restriction: %w", err)
+    }
+
+    return count > 0, nil
+}
+
+// List returns flags for the tenant, newest first: the unreviewed ones, or
+// every flag of userID when it is non-zero.
+func (r *EvasionRepository) List(userID int64, limit int) ([]*models.EvasionFlag, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT f.flag_id, f.user_id, u.username, f.banned_user_id, b.username, f.evidence_type, f.evidence,
+               f.detected_at, f.restricted, f.reviewed_by, f.reviewed_at
+        FROM evasion_flags f
+        JOIN users u ON u.user_id = f.user_id
+        JOIN users b ON b.user_id = f.banned_user_id
+        WHERE u.tenant_id = ?
+    `
+    args := []interface{}{r.db.Tenant()}
+    if userID != 0 {
+        query += ` AND f.user_id = ?`
+        args = append(args, userID)
+    } else {
+        query += ` AND f.reviewed_at IS NULL`
+    }
+    query += ` ORDER BY f.detected_at DESC, f.flag_id DESC LIMIT ?`
+    args = append(args, limit)
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list evasion flags: %w", err)
+    }
+    defer rows.Close()
+
+    var flags []*models.EvasionFlag
+    for rows.Next() {
+        flag := &models.EvasionFlag{}
+        err := rows.Scan(
+            &flag.FlagID,
+            &flag.UserID,
+            &flag.Username,
+            &flag.BannedUserID,
+            &flag.BannedUsername,
+            &flag.EvidenceType,
+            &flag.Evidence,
+            &flag.DetectedAt,
+            &flag.Restricted,
+            &flag.ReviewedBy,
+            &flag.ReviewedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan evasion flag: %w", err)
+        }
+        flags = append(flags, flag)
+    }
+
+    return flags, nil
+}
+
+// Review marks every open flag of userID as reviewed, lifting any restriction.
+func (r *EvasionRepository) Review(userID, reviewedBy int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE evasion_flags SET reviewed_by = ?, reviewed_at = ? WHERE user_id = ? AND reviewed_at IS NULL`
+
+    result, err := r.db.ExecContext(ctx, query, reviewedBy, time.Now(), userID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to review evasion flags: %w", err)
+    }
+
+    return result.RowsAffected()
+}
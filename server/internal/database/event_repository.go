@@ -0,0 +1,117 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type EventRepository struct {
+    db *DB
+}
+
+func NewEventRepository(db *DB) *EventRepository {
+    return &EventRepository{db: db}
+}
+
+func (r *EventRepository) Append(eventType string, userID, channelID *int64, payload string) (*models.DomainEvent, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    now := time.Now()
+    query := `
+        INSERT INTO domain_events (tenant_id, event_type, user_id, channel_id, payload, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    eventID, err := r.db.InsertContext(ctx, "event_id", query, r.db.Tenant(), eventType, userID, channelID, payload, now)
+    if err != nil {
+        return nil, fmt.Errorf("failed to append event: %w", err)
+    }
+
+    return &models.DomainEvent{
+        EventID:   eventID,
+        EventType: eventType,
+        UserID:    userID,
+        ChannelID: channelID,
+        Payload:   payload,
+        CreatedAt: now,
+    }, nil
+}
+
+func (r *EventRepository) ListSince(afterID int64, limit int) ([]*models.DomainEvent, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT event_id, event_type, user_id, channel_id, payload, created_at
+        FROM domain_events
+        WHERE tenant_id = ? AND event_id > ?
+        ORDER BY event_id ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant(), afterID, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list events: %w", err)
+    }
+    defer rows.Close()
+
+    var events []*models.DomainEvent
+    for rows.Next() {
+        event := &models.DomainEvent{}
+        err := rows.Scan(
+            &event.EventID,
+            &event.EventType,
+            &event.UserID,
+            &event.ChannelID,
+            &event.Payload,
+            &event.CreatedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan event: %w", err)
+        }
+        events = append(events, event)
+    }
+
+    return events, nil
+}
+
+// GetCheckpoint returns the saved event log checkpoint, or 0 and an empty
+// state if there is none.
+func (r *EventRepository) GetCheckpoint() (int64, string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT last_event_id, state FROM event_checkpoints WHERE tenant_id = ?`
+
+    var lastEventID int64
+    var state string
+    err := r.db.QueryRowContext(ctx, query, r.db.Tenant()).Scan(&lastEventID, &state)
+    if err == sql.ErrNoRows {
+        return 0, "", nil
+    }
+    if err != nil {
+        return 0, "", fmt.Errorf("failed to get event checkpoint: %w", err)
+    }
+
+    return lastEventID, state, nil
+}
+
+func (r *EventRepository) SaveCheckpoint(lastEventID int64, state string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO event_checkpoints (tenant_id, last_event_id, state, updated_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("tenant_id", "last_event_id", "state", "updated_at")
+
+    if _, err := r.db.ExecContext(ctx, query, r.db.Tenant(), lastEventID, state, time.Now()); err != nil {
+        return fmt.Errorf("failed to save event checkpoint: %w", err)
+    }
+
+    return nil
+}
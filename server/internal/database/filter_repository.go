@@ -0,0 +1,95 @@
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type FilterRepository struct {
+    db *DB
+}
+
+func NewFilterRepository(db *DB) *FilterRepository {
+    return &FilterRepository{db: db}
+}
+
+func (r *FilterRepository) Create(rule *models.FilterRule) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO filter_rules (tenant_id, channel_id, kind, pattern, action, replacement, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+    ruleID, err := r.db.InsertContext(ctx, "rule_id", query, r.db.Tenant(), rule.ChannelID, rule.Kind,
+        rule.Pattern, rule.Action, rule.Replacement, rule.CreatedBy, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to create filter rule: %w", err)
+    }
+
+    return ruleID, nil
+}
+
+func (r *FilterRepository) Delete(ruleID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM filter_rules WHERE rule_id = ? AND tenant_id = ?`, ruleID, r.db.Tenant())
+    if err != nil {
+        return false, fmt.Errorf("failed to delete filter rule: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to delete filter rule: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+// List returns every rule in the order they were added, with the names of
+// the channels they are limited to.
+func (r *FilterRepository) List() ([]*models.FilterRule, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT f.rule_id, f.channel_id, COALESCE(c.channel_name, ''), f.kind, f.pattern, f.action,
+               f.replacement, f.created_by, f.created_at
+        FROM filter_rules f
+        LEFT JOIN channels c ON c.channel_id = f.channel_id
+        WHERE f.tenant_id = ?
+        ORDER BY f.rule_id
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant())
+    if err != nil {
+        return nil, fmt.Errorf("failed to list filter rules: %w", err)
+    }
+    defer rows.Close()
+
+    var rules []*models.FilterRule
+    for rows.Next() {
+        rule := &models.FilterRule{}
+        err := rows.Scan(
+            &rule.RuleID,
+            &rule.ChannelID,
+            &rule.ChannelName,
+            &rule.Kind,
+            &rule.Pattern,
+            &rule.Action,
+            &rule.Replacement,
+            &rule.CreatedBy,
+            &rule.CreatedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan filter rule: %w", err)
+        }
+        rules = append(rules, rule)
+    }
+
+    return rules, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type IPBanRepository struct {
+    db *DB
+}
+
+func NewIPBanRepository(db *DB) *IPBanRepository {
+    return &IPBanRepository{db: db}
+}
+
+func (r *IPBanRepository) Create(cidr string, bannedBy int64, reason string, expiresAt *time.Time) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO ip_bans (tenant_id, cidr, banned_by, reason, banned_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    _, err := r.db.ExecContext(ctx, query, r.db.Tenant(), cidr, bannedBy, reason, time.Now(), expiresAt)
+    if err != nil {
+        return fmt.Errorf("failed to ban address: %w", err)
+    }
+
+    return nil
+}
+
+func (r *IPBanRepository) Deactivate(cidr string) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE ip_bans SET is_active = FALSE WHERE tenant_id = ? AND cidr = ? AND is_active = TRUE`
+
+    result, err := r.db.ExecContext(ctx, query, r.db.Tenant(), cidr)
+    if err != nil {
+        return 0, fmt.Errorf("failed to unban address: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// DeactivateExpired clears the active flag on address bans past their
+// expiry so they drop out of the ban list.
+func (r *IPBanRepository) DeactivateExpired() (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE ip_bans SET is_active = FALSE
+        WHERE tenant_id = ? AND is_active = TRUE AND expires_at IS NOT NULL AND expires_at <= ?
+    `
+
+    result, err := r.db.ExecContext(ctx, query, r.db.Tenant(), time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to expire address bans: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+func (r *IPBanRepository) ListActive() ([]*models.IPBan, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT ban_id, cidr, banned_by, reason, banned_at, expires_at, is_active
+        FROM ip_bans
+        WHERE tenant_id = ?
+          AND is_active = TRUE
+          AND (expires_at IS NULL OR expires_at > ?)
+        ORDER BY banned_at DESC
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant(), time.Now())
+    if err != nil {
+        return nil, fmt.Errorf("failed to list address bans: %w", err)
+    }
+    defer rows.Close()
+
+    var bans []*models.IPBan
+    for rows.Next() {
+        ban := &models.IPBan{}
+        err := rows.Scan(
+            &ban.BanID,
+            &ban.CIDR,
+            &ban.BannedBy,
+            &ban.Reason,
+            &ban.BannedAt,
+            &ban.ExpiresAt,
+            &ban.IsActive,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan address ban: %w", err)
+        }
+        bans = append(bans, ban)
+    }
+
+    return bans, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type KillRepository struct {
+    db *DB
+}
+
+func NewKillRepository(db *DB) *KillRepository {
+    return &KillRepository{db: db}
+}
+
+func (r *KillRepository) Create(targetUserID, killerID int64, reason, ipAddress string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO kills (target_user_id, killer_id, reason, ip_address)
+        VALUES (?, ?, ?, ?)
+    `
+
+    var ip interface{}
+    if ipAddress != "" {
+        ip = ipAddress
+    }
+
+    _, err := r.db.ExecContext(ctx, query, targetUserID, killerID, reason, ip)
+    if err != nil {
+        return fmt.Errorf("failed to record kill: %w", err)
+    }
+
+    return nil
+}
+
+// GetRecent returns the latest kill since the given time of userID or of any
+// account in the tenant killed from ipAddress, or nil if there is none.
+func (r *KillRepository) GetRecent(userID int64, ipAddress string, since time.Time) (*models.Kill, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT k.kill_id, k.target_user_id, k.killer_id, k.reason, k.ip_address, k.killed_at
+        FROM kills k
+        JOIN users u ON u.user_id = k.target_user_id AND u.tenant_id = ?
+        WHERE (k.target_user_id = ? OR k.ip_address = ?) AND k.killed_at > ?
+        ORDER BY k.killed_at DESC
+        LIMIT 1
+    `
+
+    kill := &models.Kill{}
+    err := r.db.QueryRowContext(ctx, query, r.db.Tenant(), userID, ipAddress, since).Scan(
+        &kill.KillID,
+        &kill.TargetUserID,
+        &kill.KillerID,
+        &kill.Reason,
+        &kill.IPAddress,
+        &kill.KilledAt,
+    )
+
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get recent kill: %w", err)
+    }
+
+    return kill, nil
+}
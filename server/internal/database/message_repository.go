@@ -0,0 +1,550 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+const messagesTable = "messages"
+
+type MessageRepository struct {
+    db *DB
+}
+
+func NewMessageRepository(db *DB) *MessageRepository {
+    return &MessageRepository{db: db}
+}
+
+// Create stores a message. A seq above zero is recorded as the message's
+// position in the channel and advances the channel's last_seq. terms are the
+// message's hashed search terms, separated by spaces.
+func (r *MessageRepository) Create(channelID, userID, seq int64, content, hash, signature, terms string, sentAt time.Time) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var channelSeq interface{}
+    if seq > 0 {
+        channelSeq = seq
+    }
+
+    var stamp interface{}
+    if signature != "" {
+        stamp = signature
+    }
+
+    var searchTerms interface{}
+    if terms != "" {
+        searchTerms = terms
+    }
+
+    content, err := r.db.sealContent(messagesTable, []int64{channelID}, content)
+    if err != nil {
+        return 0, err
+    }
+
+    query := `
+        INSERT INTO messages (channel_id, user_id, message_content, message_hash, channel_seq, signature, search_terms, sent_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+    messageID, err := r.db.InsertContext(ctx, "message_id", query, channelID, userID, content, hash, channelSeq, stamp, searchTerms, sentAt)
+    if err != nil {
+        return 0, fmt.Errorf("failed to store message: %w", err)
+    }
+
+    if seq > 0 {
+        query = `UPDATE channels SET last_seq = ? WHERE channel_id = ? AND last_seq < ?`
+        if _, err := r.db.ExecContext(ctx, query, seq, channelID, seq); err != nil {
+            return messageID, fmt.Errorf("failed to advance channel sequence: %w", err)
+        }
+    }
+
+    return messageID, nil
+}
+
+func (r *MessageRepository) GetChannelHistory(channelID int64, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM (
+            SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+            FROM messages
+            WHERE channel_id = ? AND is_deleted = FALSE
+            ORDER BY message_id DESC
+            LIMIT ?
+        ) recent
+        ORDER BY message_id ASC
+    `
+
+    rows, err := r.db.Reader().QueryContext(ctx, query, channelID, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel history: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+func (r *MessageRepository) GetChannelMessagesInRange(channelID int64, from, to time.Time, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM messages
+        WHERE channel_id = ? AND is_deleted = FALSE AND sent_at >= ? AND sent_at <= ?
+        ORDER BY message_id ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.Reader().QueryContext(ctx, query, channelID, from, to, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get channel messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// ListByUser returns the most recent messages userID sent, oldest first.
+func (r *MessageRepository) ListByUser(userID int64, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM (
+            SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+            FROM messages
+            WHERE user_id = ? AND is_deleted = FALSE
+            ORDER BY message_id DESC
+            LIMIT ?
+        ) recent
+        ORDER BY message_id ASC
+    `
+
+    rows, err := r.db.Reader().QueryContext(ctx, query, userID, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get user messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+func (r *MessageRepository) ListAfter(afterID int64, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT m.message_id, m.channel_id, m.user_id, m.message_content, m.message_hash, m.channel_seq, m.signature, m.sent_at, m.is_deleted
+        FROM messages m
+        JOIN channels c ON c.channel_id = m.channel_id
+        WHERE m.message_id > ? AND m.is_deleted = FALSE AND c.tenant_id = ?
+        ORDER BY m.message_id ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, afterID, r.db.Tenant(), limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// ListWithoutMAC returns messages after afterID whose message_hash is not an
+// HMAC: bare SHA-256 hashes written by older servers, or none at all.
+func (r *MessageRepository) ListWithoutMAC(afterID int64, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT m.message_id, m.channel_id, m.user_id, m.message_content, m.message_hash, m.channel_seq, m.signature, m.sent_at, m.is_deleted
+        FROM messages m
+        JOIN channels c ON c.channel_id = m.channel_id
+        WHERE m.message_id > ? AND m.is_deleted = FALSE AND c.tenant_id = ?
+          AND (m.message_hash IS NULL OR m.message_hash NOT LIKE 'hmac:%')
+        ORDER BY m.message_id ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, afterID, r.db.Tenant(), limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list messages without a MAC: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// SetHash replaces a message's message_hash.
+func (r *MessageRepository) SetHash(messageID int64, hash string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE messages SET message_hash = ? WHERE message_id = ?`
+    if _, err := r.db.ExecContext(ctx, query, hash, messageID); err != nil {
+        return fmt.Errorf("failed to update message hash: %w", err)
+    }
+
+    return nil
+}
+
+// ListForMember returns messages in the channels userID belongs to, in send
+// order, that come after afterID and were sent after since.
+func (r *MessageRepository) ListForMember(userID, afterID int64, since time.Time, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT m.message_id, m.channel_id, m.user_id, m.message_content, m.message_hash, m.channel_seq, m.signature, m.sent_at, m.is_deleted
+        FROM messages m
+        JOIN channel_members cm ON cm.channel_id = m.channel_id
+        JOIN channels c ON c.channel_id = m.channel_id
+        WHERE cm.user_id = ? AND c.tenant_id = ? AND m.is_deleted = FALSE
+          AND m.message_id > ? AND m.sent_at > ?
+        ORDER BY m.message_id ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID, r.db.Tenant(), afterID, since, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list messages since: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+func (r *MessageRepository) GetSentAt(messageID int64) (time.Time, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var sentAt time.Time
+    err := r.db.QueryRowContext(ctx, `SELECT sent_at FROM messages WHERE message_id = ?`, messageID).Scan(&sentAt)
+    if err == sql.ErrNoRows {
+        return time.Time{}, fmt.Errorf("message not found: %d", messageID)
+    }
+    if err != nil {
+        return time.Time{}, fmt.Errorf("failed to get message: %w", err)
+    }
+
+    return sentAt, nil
+}
+
+func (r *MessageRepository) ListBySeq(channelID, fromSeq, toSeq int64, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM messages
+        WHERE channel_id = ? AND is_deleted = FALSE AND channel_seq >= ? AND channel_seq <= ?
+        ORDER BY channel_seq ASC
+        LIMIT ?
+    `
+
+    rows, err := r.db.Reader().QueryContext(ctx, query, channelID, fromSeq, toSeq, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list messages by sequence: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// SearchChannel returns a channel's messages containing every one of the
+// hashed terms, newest first. MySQL and PostgreSQL answer from a full-text
+// index on search_terms; SQLite has none and scans the channel.
+func (r *MessageRepository) SearchChannel(channelID int64, terms []string, offset, limit int) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    if len(terms) == 0 {
+        return nil, nil
+    }
+
+    var match string
+    var args []interface{}
+    args = append(args, channelID)
+
+    switch r.db.Dialect() {
+    case DialectMySQL:
+        match = "MATCH (search_terms) AGAINST (? IN BOOLEAN MODE)"
+        args = append(args, "+"+strings.Join(terms, " +"))
+    case DialectPostgres:
+        match = "to_tsvector('simple', COALESCE(search_terms, '')) @@ to_tsquery('simple', ?)"
+        args = append(args, strings.Join(terms, " & "))
+    default:
+        conditions := make([]string, 0, len(terms))
+        for _, term := range terms {
+            conditions = append(conditions, "search_terms LIKE ?")
+            args = append(args, "%"+term+"%")
+        }
+        match = strings.Join(conditions, " AND ")
+    }
+    args = append(args, limit, offset)
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM messages
+        WHERE channel_id = ? AND is_deleted = FALSE AND ` + match + `
+        ORDER BY message_id DESC
+        LIMIT ? OFFSET ?
+    `
+
+    rows, err := r.db.Reader().QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
+
+// ListByIDs returns the given messages in no particular order, skipping
+// any that are missing or deleted.
+func (r *MessageRepository) ListByIDs(messageIDs []int64) ([]*models.Message, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    if len(messageIDs) == 0 {
+        return nil, nil
+    }
+
+    placeholders := make([]string, len(messageIDs))
+    args := make([]interface{}, len(messageIDs))
+    for i, id := range messageIDs {
+        placeholders[i] = "?"
+        args[i] = id
+    }
+
+    query := `
+        SELECT message_id, channel_id, user_id, message_content, message_hash, channel_seq, signature, sent_at, is_deleted
+        FROM messages
+        WHERE message_id IN (` + strings.Join(placeholders, ", ") + `) AND is_deleted = FALSE
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get messages: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []*models.Message
+    for rows.Next() {
+        message := &models.Message{}
+        err := rows.Scan(
+            &message.MessageID,
+            &message.ChannelID,
+            &message.UserID,
+            &message.MessageContent,
+            &message.MessageHash,
+            &message.ChannelSeq,
+            &message.Signature,
+            &message.SentAt,
+            &message.IsDeleted,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan message: %w", err)
+        }
+        if message.MessageContent, err = r.db.openContent(messagesTable, []int64{message.ChannelID}, message.MessageContent); err != nil {
+            return nil, err
+        }
+        messages = append(messages, message)
+    }
+
+    return messages, nil
+}
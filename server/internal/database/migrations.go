@@ -1,55 +1,424 @@
 package database
 
 import (
+    "bufio"
+    "database/sql"
+    "embed"
     "fmt"
+    "io/fs"
     "log"
+    "path"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
 )
 
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql,
+// written in MySQL DDL and translated for the other dialects. A file named
+// NNNN_name.up.postgres.sql (or .sqlite, .mysql) replaces the generic one
+// for that dialect and is run as written. Statements end with a semicolon
+// at the end of a line; one that holds semicolons of its own, such as a
+// trigger body, goes between "-- +begin" and "-- +end" lines. The first
+// comment line of the up file is the migration's description. A migration
+// without a down file cannot be reverted.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)(?:\.(mysql|postgres|sqlite))?\.sql$`)
+
 type Migration struct {
     Version     int
     Description string
-    SQL         string
+    up          map[Dialect]string
+    down        map[Dialect]string
 }
 
-func RunMigrations(db *DB) error {
-    
-    if err := createMigrationsTable(db); err != nil {
-        return fmt.Errorf("failed to create migrations table: %w", err)
+// Reversible reports whether the migration has a down file.
+func (m Migration) Reversible() bool {
+    return len(m.down) > 0
+}
+
+// MigrationState is a migration as recorded in schema_migrations.
+type MigrationState struct {
+    Migration
+    Applied   bool
+    AppliedAt *time.Time
+    Dirty     bool
+}
+
+// LoadMigrations reads the embedded migration files, in version order.
+func LoadMigrations() ([]Migration, error) {
+    entries, err := fs.ReadDir(migrationFiles, "migrations")
+    if err != nil {
+        return nil, fmt.Errorf("failed to read migrations: %w", err)
     }
 
-    currentVersion, err := getCurrentVersion(db)
+    byVersion := make(map[int]*Migration)
+    for _, entry := range entries {
+        m := migrationFileName.FindStringSubmatch(entry.Name())
+        if m == nil {
+            return nil, fmt.Errorf("unexpected migration file name: %s", entry.Name())
+        }
+
+        version, _ := strconv.Atoi(m[1])
+        content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+        }
+
+        migration := byVersion[version]
+        if migration == nil {
+            migration = &Migration{
+                Version:     version,
+                Description: strings.ReplaceAll(m[2], "_", " "),
+                up:          make(map[Dialect]string),
+                down:        make(map[Dialect]string),
+            }
+            byVersion[version] = migration
+        }
+
+        files := migration.up
+        if m[3] == "down" {
+            files = migration.down
+        } else if description := firstComment(string(content)); description != "" {
+            migration.Description = description
+        }
+
+        dialect := Dialect(m[4])
+        if _, ok := files[dialect]; ok {
+            return nil, fmt.Errorf("duplicate migration file for version %d: %s", version, entry.Name())
+        }
+        files[dialect] = string(content)
+    }
+
+    var migrations []Migration
+    for _, migration := range byVersion {
+        if len(migration.up) == 0 {
+            return nil, fmt.Errorf("migration %d has no up file", migration.Version)
+        }
+        migrations = append(migrations, *migration)
+    }
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+    for i, migration := range migrations {
+        if migration.Version != i+1 {
+            return nil, fmt.Errorf("migration %d is missing", i+1)
+        }
+    }
+
+    return migrations, nil
+}
+
+func firstComment(content string) string {
+    line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+    if strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "-- +") {
+        return strings.TrimSpace(strings.TrimPrefix(line, "--"))
+    }
+    return ""
+}
+
+// RunMigrations applies every pending migration.
+func RunMigrations(db *DB) error {
+    _, err := MigrateUp(db, 0)
+    return err
+}
+
+// MigrateUp applies pending migrations up to and including target, or all
+// of them when target is 0. It returns how many were applied.
+func MigrateUp(db *DB, target int) (int, error) {
+    migrations, currentVersion, err := prepareMigrations(db)
     if err != nil {
-        return fmt.Errorf("failed to get current version: %w", err)
+        return 0, err
     }
 
-    migrations := []Migration{
-        {
-            Version:     1,
-            Description: "Initial schema setup",
-            SQL:         "", 
-        },
+    if currentVersion == 0 && hasBaselineSchema(db) {
+        log.Printf("Found an existing schema with no recorded migrations; marking migration 1 as applied")
+        if err := recordVersion(db, 1, false); err != nil {
+            return 0, fmt.Errorf("failed to update version: %w", err)
+        }
+        currentVersion = 1
     }
 
+    applied := 0
     for _, migration := range migrations {
         if migration.Version <= currentVersion {
             continue
         }
+        if target > 0 && migration.Version > target {
+            break
+        }
 
         log.Printf("Running migration %d: %s", migration.Version, migration.Description)
 
-        if migration.SQL != "" {
-            if _, err := db.Exec(migration.SQL); err != nil {
-                return fmt.Errorf("migration %d failed: %w", migration.Version, err)
-            }
+        if err := recordVersion(db, migration.Version, true); err != nil {
+            return applied, fmt.Errorf("failed to update version: %w", err)
         }
 
-        if err := updateVersion(db, migration.Version); err != nil {
-            return fmt.Errorf("failed to update version: %w", err)
+        if err := runStatements(db, migration.statements(db.Dialect(), migration.up)); err != nil {
+            return applied, fmt.Errorf("migration %d failed, schema left dirty: %w", migration.Version, err)
+        }
+
+        if err := markClean(db, migration.Version); err != nil {
+            return applied, fmt.Errorf("failed to update version: %w", err)
         }
 
+        applied++
         log.Printf("Migration %d completed", migration.Version)
     }
 
+    return applied, nil
+}
+
+// MigrateDown reverts applied migrations, newest first, until the schema is
+// at version target. It returns how many were reverted.
+func MigrateDown(db *DB, target int) (int, error) {
+    migrations, currentVersion, err := prepareMigrations(db)
+    if err != nil {
+        return 0, err
+    }
+
+    if target < 0 || target >= currentVersion {
+        return 0, fmt.Errorf("target version %d is not below the current version %d", target, currentVersion)
+    }
+
+    // Check the whole range first, so a rollback never stops half-way at
+    // an irreversible migration.
+    for i := currentVersion - 1; i >= target; i-- {
+        if !migrations[i].Reversible() {
+            return 0, fmt.Errorf("migration %d (%s) cannot be reverted", migrations[i].Version, migrations[i].Description)
+        }
+    }
+
+    reverted := 0
+    for i := currentVersion - 1; i >= target; i-- {
+        migration := migrations[i]
+
+        log.Printf("Reverting migration %d: %s", migration.Version, migration.Description)
+
+        if err := markDirty(db, migration.Version); err != nil {
+            return reverted, fmt.Errorf("failed to update version: %w", err)
+        }
+
+        if err := runStatements(db, migration.statements(db.Dialect(), migration.down)); err != nil {
+            return reverted, fmt.Errorf("reverting migration %d failed, schema left dirty: %w", migration.Version, err)
+        }
+
+        if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+            return reverted, fmt.Errorf("failed to update version: %w", err)
+        }
+
+        reverted++
+        log.Printf("Migration %d reverted", migration.Version)
+    }
+
+    return reverted, nil
+}
+
+// MigrationStatus lists every known migration with whether it has been
+// applied.
+func MigrationStatus(db *DB) ([]MigrationState, error) {
+    migrations, err := LoadMigrations()
+    if err != nil {
+        return nil, err
+    }
+
+    if err := createMigrationsTable(db); err != nil {
+        return nil, fmt.Errorf("failed to create migrations table: %w", err)
+    }
+
+    rows, err := db.Query("SELECT version, applied_at, dirty FROM schema_migrations")
+    if err != nil {
+        return nil, fmt.Errorf("failed to read migrations table: %w", err)
+    }
+    defer rows.Close()
+
+    recorded := make(map[int]MigrationState)
+    for rows.Next() {
+        var version int
+        var state MigrationState
+        if err := rows.Scan(&version, &state.AppliedAt, &state.Dirty); err != nil {
+            return nil, fmt.Errorf("failed to read migrations table: %w", err)
+        }
+        state.Applied = true
+        recorded[version] = state
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read migrations table: %w", err)
+    }
+
+    states := make([]MigrationState, len(migrations))
+    for i, migration := range migrations {
+        states[i] = recorded[migration.Version]
+        states[i].Migration = migration
+    }
+
+    return states, nil
+}
+
+// SchemaVersion reports the version the schema is at, the version this
+// binary migrates to, and the migration left dirty by a failed run (0 if
+// none), without creating or changing anything.
+func SchemaVersion(db *DB) (current, latest, dirty int, err error) {
+    migrations, err := LoadMigrations()
+    if err != nil {
+        return 0, 0, 0, err
+    }
+
+    err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+    if err != nil {
+        return 0, len(migrations), 0, fmt.Errorf("failed to read migrations table: %w", err)
+    }
+
+    err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations WHERE dirty = TRUE").Scan(&dirty)
+    if err != nil {
+        return 0, len(migrations), 0, fmt.Errorf("failed to read migrations table: %w", err)
+    }
+
+    return current, len(migrations), dirty, nil
+}
+
+// ForceVersion records the schema as cleanly at version without running
+// anything, for recovering from a failed migration once the schema has
+// been repaired by hand.
+func ForceVersion(db *DB, version int) error {
+    migrations, err := LoadMigrations()
+    if err != nil {
+        return err
+    }
+    if version < 0 || version > len(migrations) {
+        return fmt.Errorf("unknown migration version %d", version)
+    }
+
+    if err := createMigrationsTable(db); err != nil {
+        return fmt.Errorf("failed to create migrations table: %w", err)
+    }
+
+    if _, err := db.Exec("DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+        return fmt.Errorf("failed to update version: %w", err)
+    }
+    if _, err := db.Exec("UPDATE schema_migrations SET dirty = FALSE"); err != nil {
+        return fmt.Errorf("failed to update version: %w", err)
+    }
+
+    currentVersion, err := getCurrentVersion(db)
+    if err != nil {
+        return fmt.Errorf("failed to get current version: %w", err)
+    }
+    if version > currentVersion {
+        if err := recordVersion(db, version, false); err != nil {
+            return fmt.Errorf("failed to update version: %w", err)
+        }
+    }
+
+    return nil
+}
+
+// prepareMigrations loads the migrations and checks the recorded state. It
+// refuses to go on while a migration is marked dirty, or when the database
+// is newer than this binary.
+func prepareMigrations(db *DB) ([]Migration, int, error) {
+    migrations, err := LoadMigrations()
+    if err != nil {
+        return nil, 0, err
+    }
+
+    if err := createMigrationsTable(db); err != nil {
+        return nil, 0, fmt.Errorf("failed to create migrations table: %w", err)
+    }
+
+    var dirty int
+    err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations WHERE dirty = TRUE").Scan(&dirty)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to check migrations table: %w", err)
+    }
+    if dirty > 0 {
+        return nil, 0, fmt.Errorf("migration %d did not finish and the schema may be half-changed; repair it by hand, then run -migrate force %d (or %d if its changes were undone)",
+            dirty, dirty, dirty-1)
+    }
+
+    currentVersion, err := getCurrentVersion(db)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to get current version: %w", err)
+    }
+    if currentVersion > len(migrations) {
+        return nil, 0, fmt.Errorf("database schema is at version %d, newer than this server's %d", currentVersion, len(migrations))
+    }
+
+    return migrations, currentVersion, nil
+}
+
+// hasBaselineSchema reports whether the tables of migration 1 already
+// exist, as they do when the schema was loaded by hand before migrations
+// were tracked.
+func hasBaselineSchema(db *DB) bool {
+    var count int
+    return db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count) == nil
+}
+
+func (m Migration) statements(dialect Dialect, files map[Dialect]string) []string {
+    if content, ok := files[dialect]; ok {
+        return splitStatements(content)
+    }
+
+    var statements []string
+    for _, statement := range splitStatements(files[""]) {
+        statements = append(statements, dialect.translateDDL(statement)...)
+    }
+    return statements
+}
+
+// splitStatements breaks a migration file into statements, dropping comment
+// lines outside "-- +begin" blocks.
+func splitStatements(content string) []string {
+    var statements []string
+    var current []string
+    inBlock := false
+
+    flush := func() {
+        statement := strings.TrimSpace(strings.Join(current, "\n"))
+        statement = strings.TrimSpace(strings.TrimSuffix(statement, ";"))
+        if statement != "" {
+            statements = append(statements, statement)
+        }
+        current = nil
+    }
+
+    scanner := bufio.NewScanner(strings.NewReader(content))
+    for scanner.Scan() {
+        line := scanner.Text()
+        trimmed := strings.TrimSpace(line)
+
+        switch {
+        case trimmed == "-- +begin":
+            flush()
+            inBlock = true
+        case trimmed == "-- +end":
+            flush()
+            inBlock = false
+        case inBlock:
+            current = append(current, line)
+        case strings.HasPrefix(trimmed, "--"):
+        default:
+            current = append(current, line)
+            if strings.HasSuffix(trimmed, ";") {
+                flush()
+            }
+        }
+    }
+    flush()
+
+    return statements
+}
+
+func runStatements(db *DB, statements []string) error {
+    for _, statement := range statements {
+        if _, err := db.Exec(statement); err != nil {
+            return err
+        }
+    }
     return nil
 }
 
@@ -57,11 +426,24 @@ func createMigrationsTable(db *DB) error {
     query := `
         CREATE TABLE IF NOT EXISTS schema_migrations (
             version INT PRIMARY KEY,
-            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            dirty BOOLEAN NOT NULL DEFAULT FALSE
         )
     `
-    _, err := db.Exec(query)
-    return err
+    if _, err := db.Exec(query); err != nil {
+        return err
+    }
+
+    // Tables created before dirty tracking lack the column.
+    var dirty bool
+    err := db.QueryRow("SELECT dirty FROM schema_migrations WHERE version = 0").Scan(&dirty)
+    if err != nil && err != sql.ErrNoRows {
+        if _, err := db.Exec("ALTER TABLE schema_migrations ADD COLUMN dirty BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+            return err
+        }
+    }
+
+    return nil
 }
 
 func getCurrentVersion(db *DB) (int, error) {
@@ -73,7 +455,17 @@ func getCurrentVersion(db *DB) (int, error) {
     return version, nil
 }
 
-func updateVersion(db *DB, version int) error {
-    _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version)
+func recordVersion(db *DB, version int, dirty bool) error {
+    _, err := db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)", version, dirty)
+    return err
+}
+
+func markDirty(db *DB, version int) error {
+    _, err := db.Exec("UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", version)
+    return err
+}
+
+func markClean(db *DB, version int) error {
+    _, err := db.Exec("UPDATE schema_migrations SET dirty = FALSE WHERE version = ?", version)
     return err
 }
@@ -0,0 +1,25 @@
+-- Revert: Initial schema setup
+
+DROP TABLE IF EXISTS session_tokens;
+
+DROP TABLE IF EXISTS user_bans;
+
+DROP TABLE IF EXISTS admin_action_log;
+
+DROP TABLE IF EXISTS server_config;
+
+DROP TABLE IF EXISTS direct_messages;
+
+DROP TABLE IF EXISTS messages;
+
+DROP TABLE IF EXISTS channel_members;
+
+DROP TABLE IF EXISTS channels;
+
+DROP TABLE IF EXISTS user_security_status;
+
+DROP TABLE IF EXISTS user_ip_tracking;
+
+DROP TABLE IF EXISTS users;
+
+DROP FUNCTION IF EXISTS after_user_insert();
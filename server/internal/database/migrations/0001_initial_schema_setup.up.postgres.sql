@@ -0,0 +1,190 @@
+-- Initial schema setup
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password_hash CHAR(64) NOT NULL,
+    password_salt CHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_admin BOOLEAN DEFAULT FALSE,
+    last_login_time TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_idx_username ON users (username);
+
+CREATE INDEX IF NOT EXISTS users_idx_active_users ON users (is_active, last_login_time);
+
+CREATE TABLE IF NOT EXISTS user_ip_tracking (
+    tracking_id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    login_timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_successful BOOLEAN DEFAULT FALSE,
+    user_agent VARCHAR(255) NULL,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_ip_tracking_idx_user_login ON user_ip_tracking (user_id, login_timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS user_ip_tracking_idx_ip_address ON user_ip_tracking (ip_address);
+
+CREATE TABLE IF NOT EXISTS user_security_status (
+    user_id BIGINT PRIMARY KEY,
+    last_known_ip VARCHAR(45) NULL,
+    ip_suspicion_count INT DEFAULT 0,
+    account_locked BOOLEAN DEFAULT FALSE,
+    lock_reason VARCHAR(255) NULL,
+    locked_at TIMESTAMP NULL,
+    locked_by BIGINT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (locked_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_security_status_idx_locked_accounts ON user_security_status (account_locked, locked_at);
+
+CREATE TABLE IF NOT EXISTS channels (
+    channel_id BIGSERIAL PRIMARY KEY,
+    channel_name VARCHAR(100) NOT NULL UNIQUE,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    topic TEXT NULL,
+    is_private BOOLEAN DEFAULT FALSE,
+    max_members INT DEFAULT 1000,
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS channels_idx_channel_name ON channels (channel_name);
+
+CREATE INDEX IF NOT EXISTS channels_idx_private_channels ON channels (is_private);
+
+CREATE TABLE IF NOT EXISTS channel_members (
+    membership_id BIGSERIAL PRIMARY KEY,
+    channel_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    role VARCHAR(20) DEFAULT 'member',
+    is_muted BOOLEAN DEFAULT FALSE,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    UNIQUE (channel_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS channel_members_idx_channel_users ON channel_members (channel_id, role);
+
+CREATE INDEX IF NOT EXISTS channel_members_idx_user_channels ON channel_members (user_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    message_id BIGSERIAL PRIMARY KEY,
+    channel_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    message_content TEXT NOT NULL,
+    message_hash CHAR(64) NULL,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS messages_idx_channel_messages ON messages (channel_id, sent_at DESC);
+
+CREATE INDEX IF NOT EXISTS messages_idx_user_messages ON messages (user_id, sent_at DESC);
+
+CREATE TABLE IF NOT EXISTS direct_messages (
+    dm_id BIGSERIAL PRIMARY KEY,
+    sender_id BIGINT NOT NULL,
+    recipient_id BIGINT NOT NULL,
+    message_content TEXT NOT NULL,
+    message_hash CHAR(64) NULL,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_read BOOLEAN DEFAULT FALSE,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    FOREIGN KEY (sender_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS direct_messages_idx_recipient_messages ON direct_messages (recipient_id, is_read, sent_at DESC);
+
+CREATE INDEX IF NOT EXISTS direct_messages_idx_sender_messages ON direct_messages (sender_id, sent_at DESC);
+
+CREATE INDEX IF NOT EXISTS direct_messages_idx_conversation ON direct_messages (sender_id, recipient_id, sent_at DESC);
+
+CREATE TABLE IF NOT EXISTS server_config (
+    config_key VARCHAR(100) PRIMARY KEY,
+    config_value TEXT NOT NULL,
+    description TEXT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_by BIGINT NULL,
+    FOREIGN KEY (updated_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS admin_action_log (
+    log_id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT NOT NULL,
+    action_type VARCHAR(50) NOT NULL,
+    target_user_id BIGINT NULL,
+    target_channel_id BIGINT NULL,
+    action_details TEXT NULL,
+    performed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (target_channel_id) REFERENCES channels(channel_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS admin_action_log_idx_admin_actions ON admin_action_log (admin_id, performed_at DESC);
+
+CREATE INDEX IF NOT EXISTS admin_action_log_idx_target_user ON admin_action_log (target_user_id, performed_at DESC);
+
+CREATE TABLE IF NOT EXISTS user_bans (
+    ban_id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    banned_by BIGINT NOT NULL,
+    reason TEXT NULL,
+    banned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES users(user_id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS user_bans_idx_active_bans ON user_bans (user_id, is_active, expires_at);
+
+CREATE INDEX IF NOT EXISTS user_bans_idx_ban_expiry ON user_bans (expires_at, is_active);
+
+CREATE TABLE IF NOT EXISTS session_tokens (
+    token_id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    last_activity TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ip_address VARCHAR(45) NOT NULL,
+    is_valid BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS session_tokens_idx_user_sessions ON session_tokens (user_id, is_valid, expires_at);
+
+CREATE INDEX IF NOT EXISTS session_tokens_idx_token_lookup ON session_tokens (token_hash, is_valid);
+
+INSERT INTO server_config (config_key, config_value, description) VALUES
+    ('server.version', '1.0.0', 'Server version'),
+    ('security.max_ip_suspicion', '3', 'Maximum IP suspicion count before account lock'),
+    ('security.session_timeout_seconds', '3600', 'Session timeout in seconds'),
+    ('security.password_min_length', '8', 'Minimum password length'),
+    ('server.max_connections', '1000', 'Maximum concurrent connections'),
+    ('server.message_history_limit', '1000', 'Maximum messages to keep per channel');
+
+-- +begin
+CREATE OR REPLACE FUNCTION after_user_insert() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO user_security_status (user_id, ip_suspicion_count, account_locked)
+    VALUES (NEW.user_id, 0, FALSE);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +end
+
+CREATE TRIGGER after_user_insert AFTER INSERT ON users
+    FOR EACH ROW EXECUTE FUNCTION after_user_insert();
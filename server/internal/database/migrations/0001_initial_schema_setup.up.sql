@@ -1,14 +1,9 @@
--- OnyxIRC Database Schema
--- MySQL Database Schema for IRC Server
--- Character Set: utf8mb4 (supports full Unicode including emoji)
-
-CREATE DATABASE IF NOT EXISTS onyxirc CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
-USE onyxirc;
+-- Initial schema setup
 
 -- =======================
 -- USERS TABLE
 -- =======================
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     user_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     username VARCHAR(50) NOT NULL UNIQUE,
     password_hash CHAR(64) NOT NULL COMMENT 'SHA-256 hash (64 hex chars)',
@@ -25,7 +20,7 @@ CREATE TABLE users (
 -- =======================
 -- USER IP TRACKING TABLE
 -- =======================
-CREATE TABLE user_ip_tracking (
+CREATE TABLE IF NOT EXISTS user_ip_tracking (
     tracking_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT NOT NULL,
     ip_address VARCHAR(45) NOT NULL COMMENT 'Supports both IPv4 and IPv6',
@@ -40,7 +35,7 @@ CREATE TABLE user_ip_tracking (
 -- =======================
 -- USER SECURITY STATUS TABLE
 -- =======================
-CREATE TABLE user_security_status (
+CREATE TABLE IF NOT EXISTS user_security_status (
     user_id BIGINT PRIMARY KEY,
     last_known_ip VARCHAR(45) NULL,
     ip_suspicion_count INT DEFAULT 0,
@@ -56,7 +51,7 @@ CREATE TABLE user_security_status (
 -- =======================
 -- CHANNELS TABLE
 -- =======================
-CREATE TABLE channels (
+CREATE TABLE IF NOT EXISTS channels (
     channel_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     channel_name VARCHAR(100) NOT NULL UNIQUE,
     created_by BIGINT NOT NULL,
@@ -72,7 +67,7 @@ CREATE TABLE channels (
 -- =======================
 -- CHANNEL MEMBERS TABLE
 -- =======================
-CREATE TABLE channel_members (
+CREATE TABLE IF NOT EXISTS channel_members (
     membership_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     channel_id BIGINT NOT NULL,
     user_id BIGINT NOT NULL,
@@ -89,7 +84,7 @@ CREATE TABLE channel_members (
 -- =======================
 -- MESSAGES TABLE
 -- =======================
-CREATE TABLE messages (
+CREATE TABLE IF NOT EXISTS messages (
     message_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     channel_id BIGINT NOT NULL,
     user_id BIGINT NOT NULL,
@@ -106,7 +101,7 @@ CREATE TABLE messages (
 -- =======================
 -- DIRECT MESSAGES TABLE
 -- =======================
-CREATE TABLE direct_messages (
+CREATE TABLE IF NOT EXISTS direct_messages (
     dm_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     sender_id BIGINT NOT NULL,
     recipient_id BIGINT NOT NULL,
@@ -125,7 +120,7 @@ CREATE TABLE direct_messages (
 -- =======================
 -- SERVER CONFIG TABLE
 -- =======================
-CREATE TABLE server_config (
+CREATE TABLE IF NOT EXISTS server_config (
     config_key VARCHAR(100) PRIMARY KEY,
     config_value TEXT NOT NULL,
     description TEXT NULL,
@@ -137,7 +132,7 @@ CREATE TABLE server_config (
 -- =======================
 -- ADMIN ACTION LOG TABLE
 -- =======================
-CREATE TABLE admin_action_log (
+CREATE TABLE IF NOT EXISTS admin_action_log (
     log_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     admin_id BIGINT NOT NULL,
     action_type VARCHAR(50) NOT NULL COMMENT 'kick, ban, unlock, makeadmin, etc.',
@@ -155,7 +150,7 @@ CREATE TABLE admin_action_log (
 -- =======================
 -- USER BANS TABLE
 -- =======================
-CREATE TABLE user_bans (
+CREATE TABLE IF NOT EXISTS user_bans (
     ban_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT NOT NULL,
     banned_by BIGINT NOT NULL,
@@ -172,7 +167,7 @@ CREATE TABLE user_bans (
 -- =======================
 -- SESSION TOKENS TABLE
 -- =======================
-CREATE TABLE session_tokens (
+CREATE TABLE IF NOT EXISTS session_tokens (
     token_id BIGINT AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT NOT NULL,
     token_hash CHAR(64) NOT NULL COMMENT 'SHA-256 hash of session token',
@@ -203,50 +198,13 @@ INSERT INTO server_config (config_key, config_value, description) VALUES
 -- TRIGGERS
 -- =======================
 
--- Trigger: Auto-create security status entry when user is created
-DELIMITER //
+-- Auto-create security status entry when user is created
+-- +begin
 CREATE TRIGGER after_user_insert
 AFTER INSERT ON users
 FOR EACH ROW
 BEGIN
     INSERT INTO user_security_status (user_id, ip_suspicion_count, account_locked)
     VALUES (NEW.user_id, 0, FALSE);
-END//
-DELIMITER ;
-
--- Trigger: Clean up expired sessions periodically (called manually or via event)
-DELIMITER //
-CREATE PROCEDURE cleanup_expired_sessions()
-BEGIN
-    UPDATE session_tokens
-    SET is_valid = FALSE
-    WHERE expires_at < NOW() AND is_valid = TRUE;
-END//
-DELIMITER ;
-
--- Trigger: Auto-expire bans
-DELIMITER //
-CREATE PROCEDURE cleanup_expired_bans()
-BEGIN
-    UPDATE user_bans
-    SET is_active = FALSE
-    WHERE expires_at IS NOT NULL
-      AND expires_at < NOW()
-      AND is_active = TRUE;
-END//
-DELIMITER ;
-
--- =======================
--- EVENT SCHEDULER (Optional - requires MySQL Event Scheduler)
--- =======================
--- Enable event scheduler: SET GLOBAL event_scheduler = ON;
-
--- Event: Clean expired sessions every hour
--- CREATE EVENT IF NOT EXISTS cleanup_sessions_hourly
--- ON SCHEDULE EVERY 1 HOUR
--- DO CALL cleanup_expired_sessions();
-
--- Event: Clean expired bans every hour
--- CREATE EVENT IF NOT EXISTS cleanup_bans_hourly
--- ON SCHEDULE EVERY 1 HOUR
--- DO CALL cleanup_expired_bans();
+END;
+-- +end
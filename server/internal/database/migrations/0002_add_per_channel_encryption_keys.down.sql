@@ -0,0 +1,3 @@
+-- Revert: Add per-channel encryption keys
+
+DROP TABLE IF EXISTS channel_keys;
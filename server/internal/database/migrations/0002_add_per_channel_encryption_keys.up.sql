@@ -0,0 +1,8 @@
+-- Add per-channel encryption keys
+
+CREATE TABLE IF NOT EXISTS channel_keys (
+    channel_id BIGINT PRIMARY KEY,
+    encrypted_key TEXT NOT NULL COMMENT 'Channel AES key encrypted with the server RSA key',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add client public keys
+
+DROP TABLE IF EXISTS user_keys;
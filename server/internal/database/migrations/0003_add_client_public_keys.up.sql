@@ -0,0 +1,10 @@
+-- Add client public keys
+
+CREATE TABLE IF NOT EXISTS user_keys (
+    user_id BIGINT PRIMARY KEY,
+    public_key TEXT NOT NULL COMMENT 'Base64 DER-encoded RSA public key',
+    fingerprint CHAR(64) NOT NULL COMMENT 'SHA-256 of the DER-encoded key',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
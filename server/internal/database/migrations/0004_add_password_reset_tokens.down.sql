@@ -0,0 +1,3 @@
+-- Revert: Add password reset tokens
+
+DROP TABLE IF EXISTS password_resets;
@@ -0,0 +1,9 @@
+-- Add password reset tokens
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    user_id BIGINT PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL COMMENT 'SHA-256 hash of the reset token',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL COMMENT 'NULL for tokens that never expire',
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
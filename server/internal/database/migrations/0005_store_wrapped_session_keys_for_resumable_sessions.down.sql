@@ -0,0 +1,4 @@
+-- Revert: Store wrapped session keys for resumable sessions
+
+ALTER TABLE session_tokens
+    DROP COLUMN session_key;
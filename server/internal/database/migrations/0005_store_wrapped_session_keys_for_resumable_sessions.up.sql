@@ -0,0 +1,4 @@
+-- Store wrapped session keys for resumable sessions
+
+ALTER TABLE session_tokens
+    ADD COLUMN session_key TEXT NULL COMMENT 'Session AES key encrypted with the server RSA key';
@@ -0,0 +1,7 @@
+-- Revert: Track channel activity and archive state
+
+ALTER TABLE channels
+    DROP COLUMN last_activity_at,
+    DROP COLUMN idle_notified_at,
+    DROP COLUMN is_archived,
+    DROP COLUMN archived_at;
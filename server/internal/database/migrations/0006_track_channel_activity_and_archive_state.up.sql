@@ -0,0 +1,7 @@
+-- Track channel activity and archive state
+
+ALTER TABLE channels
+    ADD COLUMN last_activity_at TIMESTAMP NULL,
+    ADD COLUMN idle_notified_at TIMESTAMP NULL,
+    ADD COLUMN is_archived BOOLEAN DEFAULT FALSE,
+    ADD COLUMN archived_at TIMESTAMP NULL;
@@ -0,0 +1,5 @@
+-- Revert: Track inactive accounts
+
+ALTER TABLE users
+    DROP COLUMN idle_notified_at,
+    DROP COLUMN deactivated_for_inactivity;
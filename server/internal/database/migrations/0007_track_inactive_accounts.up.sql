@@ -0,0 +1,5 @@
+-- Track inactive accounts
+
+ALTER TABLE users
+    ADD COLUMN idle_notified_at TIMESTAMP NULL,
+    ADD COLUMN deactivated_for_inactivity BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Revert: Add append-only domain event log
+
+DROP TABLE IF EXISTS domain_events;
@@ -0,0 +1,12 @@
+-- Add append-only domain event log
+
+CREATE TABLE IF NOT EXISTS domain_events (
+    event_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    user_id BIGINT NULL,
+    channel_id BIGINT NULL,
+    payload TEXT NOT NULL COMMENT 'JSON-encoded event data',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_event_type (event_type),
+    INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add per-user channel mutes
+
+DROP TABLE IF EXISTS channel_mutes;
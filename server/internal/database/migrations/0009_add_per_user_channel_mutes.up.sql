@@ -0,0 +1,11 @@
+-- Add per-user channel mutes
+
+CREATE TABLE IF NOT EXISTS channel_mutes (
+    user_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    muted_until TIMESTAMP NULL COMMENT 'NULL mutes until explicitly unmuted',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, channel_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add kill tracking
+
+DROP TABLE IF EXISTS kills;
@@ -0,0 +1,14 @@
+-- Add kill tracking
+
+CREATE TABLE IF NOT EXISTS kills (
+    kill_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    target_user_id BIGINT NOT NULL,
+    killer_id BIGINT NOT NULL,
+    reason TEXT,
+    ip_address VARCHAR(45),
+    killed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_target_killed (target_user_id, killed_at),
+    INDEX idx_ip_killed (ip_address, killed_at),
+    FOREIGN KEY (target_user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (killer_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
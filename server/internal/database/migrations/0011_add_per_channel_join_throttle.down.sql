@@ -0,0 +1,5 @@
+-- Revert: Add per-channel join throttle
+
+ALTER TABLE channels
+    DROP COLUMN join_throttle_joins,
+    DROP COLUMN join_throttle_seconds;
@@ -0,0 +1,5 @@
+-- Add per-channel join throttle
+
+ALTER TABLE channels
+    ADD COLUMN join_throttle_joins INT NOT NULL DEFAULT 0,
+    ADD COLUMN join_throttle_seconds INT NOT NULL DEFAULT 0;
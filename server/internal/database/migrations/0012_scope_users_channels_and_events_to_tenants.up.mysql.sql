@@ -0,0 +1,15 @@
+-- Scope users, channels and events to tenants
+
+ALTER TABLE users
+    ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default' AFTER user_id,
+    DROP INDEX username,
+    ADD UNIQUE KEY unique_tenant_username (tenant_id, username);
+
+ALTER TABLE channels
+    ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default' AFTER channel_id,
+    DROP INDEX channel_name,
+    ADD UNIQUE KEY unique_tenant_channel (tenant_id, channel_name);
+
+ALTER TABLE domain_events
+    ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default' AFTER event_id,
+    ADD INDEX idx_tenant_events (tenant_id, event_id);
@@ -0,0 +1,17 @@
+-- Scope users, channels and events to tenants
+
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_unique_tenant_username ON users (tenant_id, username);
+
+ALTER TABLE channels ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+ALTER TABLE channels DROP CONSTRAINT IF EXISTS channels_channel_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS channels_unique_tenant_channel ON channels (tenant_id, channel_name);
+
+ALTER TABLE domain_events ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS domain_events_idx_tenant_events ON domain_events (tenant_id, event_id);
@@ -0,0 +1,81 @@
+-- Scope users, channels and events to tenants
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE users_new (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    username VARCHAR(50) NOT NULL,
+    password_hash CHAR(64) NOT NULL,
+    password_salt CHAR(32) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_admin BOOLEAN DEFAULT FALSE,
+    last_login_time TIMESTAMP NULL,
+    idle_notified_at TIMESTAMP NULL,
+    deactivated_for_inactivity BOOLEAN DEFAULT FALSE,
+    UNIQUE (tenant_id, username)
+);
+
+INSERT INTO users_new (user_id, username, password_hash, password_salt, created_at, updated_at,
+    is_active, is_admin, last_login_time, idle_notified_at, deactivated_for_inactivity)
+SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
+    is_active, is_admin, last_login_time, idle_notified_at, deactivated_for_inactivity
+FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_new RENAME TO users;
+
+CREATE INDEX IF NOT EXISTS users_idx_username ON users (username);
+
+CREATE INDEX IF NOT EXISTS users_idx_active_users ON users (is_active, last_login_time);
+
+-- +begin
+CREATE TRIGGER IF NOT EXISTS after_user_insert AFTER INSERT ON users
+FOR EACH ROW
+BEGIN
+    INSERT INTO user_security_status (user_id, ip_suspicion_count, account_locked)
+    VALUES (NEW.user_id, 0, FALSE);
+END;
+-- +end
+
+CREATE TABLE channels_new (
+    channel_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    channel_name VARCHAR(100) NOT NULL,
+    created_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    topic TEXT NULL,
+    is_private BOOLEAN DEFAULT FALSE,
+    max_members INT DEFAULT 1000,
+    last_activity_at TIMESTAMP NULL,
+    idle_notified_at TIMESTAMP NULL,
+    is_archived BOOLEAN DEFAULT FALSE,
+    archived_at TIMESTAMP NULL,
+    join_throttle_joins INT NOT NULL DEFAULT 0,
+    join_throttle_seconds INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE RESTRICT,
+    UNIQUE (tenant_id, channel_name)
+);
+
+INSERT INTO channels_new (channel_id, channel_name, created_by, created_at, topic, is_private, max_members,
+    last_activity_at, idle_notified_at, is_archived, archived_at, join_throttle_joins, join_throttle_seconds)
+SELECT channel_id, channel_name, created_by, created_at, topic, is_private, max_members,
+    last_activity_at, idle_notified_at, is_archived, archived_at, join_throttle_joins, join_throttle_seconds
+FROM channels;
+
+DROP TABLE channels;
+
+ALTER TABLE channels_new RENAME TO channels;
+
+CREATE INDEX IF NOT EXISTS channels_idx_channel_name ON channels (channel_name);
+
+CREATE INDEX IF NOT EXISTS channels_idx_private_channels ON channels (is_private);
+
+ALTER TABLE domain_events ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS domain_events_idx_tenant_events ON domain_events (tenant_id, event_id);
+
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,4 @@
+-- Revert: Add channel forwarding
+
+ALTER TABLE channels
+    DROP COLUMN forward_channel_id;
@@ -0,0 +1,4 @@
+-- Add channel forwarding
+
+ALTER TABLE channels
+    ADD COLUMN forward_channel_id BIGINT NULL COMMENT 'Channel that joins are redirected to';
@@ -0,0 +1,3 @@
+-- Revert: Add channel aliases for renamed channels
+
+DROP TABLE IF EXISTS channel_aliases;
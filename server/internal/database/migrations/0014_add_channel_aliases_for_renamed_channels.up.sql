@@ -0,0 +1,11 @@
+-- Add channel aliases for renamed channels
+
+CREATE TABLE IF NOT EXISTS channel_aliases (
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    alias_name VARCHAR(100) NOT NULL,
+    channel_id BIGINT NOT NULL,
+    expires_at TIMESTAMP NULL COMMENT 'NULL keeps the alias forever',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, alias_name),
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add server-level IP bans
+
+DROP TABLE IF EXISTS ip_bans;
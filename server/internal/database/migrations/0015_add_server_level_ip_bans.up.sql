@@ -0,0 +1,16 @@
+-- Add server-level IP bans
+
+-- +begin
+CREATE TABLE IF NOT EXISTS ip_bans (
+    ban_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    cidr VARCHAR(50) NOT NULL COMMENT 'Banned network; single addresses are stored as /32 or /128',
+    banned_by BIGINT NULL,
+    reason TEXT,
+    banned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL COMMENT 'NULL for permanent bans',
+    is_active BOOLEAN DEFAULT TRUE,
+    INDEX idx_tenant_active (tenant_id, is_active),
+    FOREIGN KEY (banned_by) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+-- +end
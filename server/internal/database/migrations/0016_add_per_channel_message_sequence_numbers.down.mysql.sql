@@ -0,0 +1,7 @@
+-- Revert: Add per-channel message sequence numbers
+
+ALTER TABLE messages
+    DROP INDEX idx_channel_seq,
+    DROP COLUMN channel_seq;
+
+ALTER TABLE channels DROP COLUMN last_seq;
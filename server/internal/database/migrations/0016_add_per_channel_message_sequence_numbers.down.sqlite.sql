@@ -0,0 +1,7 @@
+-- Revert: Add per-channel message sequence numbers
+
+DROP INDEX IF EXISTS messages_idx_channel_seq;
+
+ALTER TABLE messages DROP COLUMN channel_seq;
+
+ALTER TABLE channels DROP COLUMN last_seq;
@@ -0,0 +1,7 @@
+-- Add per-channel message sequence numbers
+
+ALTER TABLE channels ADD COLUMN last_seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE messages
+    ADD COLUMN channel_seq BIGINT NULL COMMENT 'Position of the message within its channel',
+    ADD INDEX idx_channel_seq (channel_id, channel_seq);
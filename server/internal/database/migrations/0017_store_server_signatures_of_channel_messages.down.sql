@@ -0,0 +1,4 @@
+-- Revert: Store server signatures of channel messages
+
+ALTER TABLE messages
+    DROP COLUMN signature;
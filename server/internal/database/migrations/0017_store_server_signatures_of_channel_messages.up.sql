@@ -0,0 +1,4 @@
+-- Store server signatures of channel messages
+
+ALTER TABLE messages
+    ADD COLUMN signature VARCHAR(128) NULL COMMENT 'Ed25519 provenance stamp from the relaying server';
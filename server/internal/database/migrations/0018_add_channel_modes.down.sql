@@ -0,0 +1,3 @@
+-- Revert: Add channel modes
+
+DROP TABLE IF EXISTS channel_modes;
@@ -0,0 +1,11 @@
+-- Add channel modes
+
+CREATE TABLE IF NOT EXISTS channel_modes (
+    channel_id BIGINT PRIMARY KEY,
+    moderated BOOLEAN NOT NULL DEFAULT FALSE,
+    invite_only BOOLEAN NOT NULL DEFAULT FALSE,
+    key_hash CHAR(64) NULL COMMENT 'SHA-256 of the join key (+k)',
+    member_limit INT NOT NULL DEFAULT 0 COMMENT '0 means no limit (+l)',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add channel invites
+
+DROP TABLE IF EXISTS channel_invites;
@@ -0,0 +1,3 @@
+-- Revert: Add ban evasion flags
+
+DROP TABLE IF EXISTS evasion_flags;
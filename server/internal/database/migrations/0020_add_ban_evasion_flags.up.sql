@@ -0,0 +1,18 @@
+-- Add ban evasion flags
+
+CREATE TABLE IF NOT EXISTS evasion_flags (
+    flag_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL COMMENT 'Account suspected of evading a ban',
+    banned_user_id BIGINT NOT NULL,
+    evidence_type VARCHAR(20) NOT NULL COMMENT 'ip or key',
+    evidence VARCHAR(100) NOT NULL COMMENT 'Shared address or key fingerprint',
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    restricted BOOLEAN NOT NULL DEFAULT FALSE,
+    reviewed_by BIGINT NULL,
+    reviewed_at TIMESTAMP NULL,
+    UNIQUE KEY uq_evasion_evidence (user_id, banned_user_id, evidence_type, evidence),
+    INDEX idx_evasion_user (user_id, reviewed_at),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (reviewed_by) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add pastes
+
+DROP TABLE IF EXISTS pastes;
@@ -0,0 +1,18 @@
+-- Add pastes
+
+CREATE TABLE IF NOT EXISTS pastes (
+    paste_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    channel_id BIGINT NULL,
+    recipient_id BIGINT NULL,
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    encrypted_key TEXT NOT NULL COMMENT 'Paste AES key encrypted with the server RSA key',
+    content TEXT NOT NULL COMMENT 'AES-encrypted paste body',
+    size INT NOT NULL,
+    line_count INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_pastes_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
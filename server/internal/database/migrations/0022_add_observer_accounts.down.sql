@@ -0,0 +1,3 @@
+-- Revert: Add observer accounts
+
+DROP TABLE IF EXISTS observers;
@@ -0,0 +1,3 @@
+-- Revert: Add observer channel attachments
+
+DROP TABLE IF EXISTS observer_channels;
@@ -0,0 +1,5 @@
+-- Revert: Track deleted accounts
+
+ALTER TABLE users
+    DROP COLUMN deleted_at,
+    DROP COLUMN purged_at;
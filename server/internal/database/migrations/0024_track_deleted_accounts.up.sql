@@ -0,0 +1,5 @@
+-- Track deleted accounts
+
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMP NULL,
+    ADD COLUMN purged_at TIMESTAMP NULL;
@@ -0,0 +1,3 @@
+-- Revert: Add two-factor authentication secrets
+
+DROP TABLE IF EXISTS user_2fa;
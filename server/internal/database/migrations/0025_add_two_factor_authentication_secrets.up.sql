@@ -0,0 +1,11 @@
+-- Add two-factor authentication secrets
+
+CREATE TABLE IF NOT EXISTS user_2fa (
+    user_id BIGINT PRIMARY KEY,
+    secret_encrypted TEXT NOT NULL,
+    is_enabled BOOLEAN DEFAULT FALSE,
+    last_used_step BIGINT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    enabled_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
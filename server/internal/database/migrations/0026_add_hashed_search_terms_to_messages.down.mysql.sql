@@ -0,0 +1,5 @@
+-- Revert: Add hashed search terms to messages
+
+ALTER TABLE messages
+    DROP INDEX idx_message_search,
+    DROP COLUMN search_terms;
@@ -0,0 +1,5 @@
+-- Revert: Add hashed search terms to messages
+
+DROP INDEX IF EXISTS messages_idx_search;
+
+ALTER TABLE messages DROP COLUMN search_terms;
@@ -0,0 +1,3 @@
+-- Revert: Add hashed search terms to messages
+
+ALTER TABLE messages DROP COLUMN search_terms;
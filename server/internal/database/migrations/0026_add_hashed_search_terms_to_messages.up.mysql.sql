@@ -0,0 +1,5 @@
+-- Add hashed search terms to messages
+
+ALTER TABLE messages
+    ADD COLUMN search_terms TEXT NULL COMMENT 'HMACs of the words in the message, keyed per channel',
+    ADD FULLTEXT INDEX idx_message_search (search_terms);
@@ -0,0 +1,5 @@
+-- Add hashed search terms to messages
+
+ALTER TABLE messages ADD COLUMN search_terms TEXT NULL;
+
+CREATE INDEX IF NOT EXISTS messages_idx_search ON messages USING GIN (to_tsvector('simple', COALESCE(search_terms, '')));
@@ -0,0 +1,3 @@
+-- Add hashed search terms to messages
+
+ALTER TABLE messages ADD COLUMN search_terms TEXT NULL;
@@ -0,0 +1,4 @@
+-- Revert: Add announcement channels
+
+ALTER TABLE channel_modes
+    DROP COLUMN announce;
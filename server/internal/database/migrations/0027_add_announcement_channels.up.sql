@@ -0,0 +1,4 @@
+-- Add announcement channels
+
+ALTER TABLE channel_modes
+    ADD COLUMN announce BOOLEAN NOT NULL DEFAULT FALSE COMMENT 'Only the owner and moderators may post (+A)';
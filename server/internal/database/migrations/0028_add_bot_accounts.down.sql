@@ -0,0 +1,4 @@
+-- Revert: Add bot accounts
+
+ALTER TABLE users
+    DROP COLUMN is_bot;
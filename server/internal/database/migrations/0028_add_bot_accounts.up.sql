@@ -0,0 +1,4 @@
+-- Add bot accounts
+
+ALTER TABLE users
+    ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
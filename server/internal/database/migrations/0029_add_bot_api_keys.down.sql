@@ -0,0 +1,3 @@
+-- Revert: Add bot API keys
+
+DROP TABLE IF EXISTS bot_api_keys;
@@ -0,0 +1,3 @@
+-- Revert: Add content filter rules
+
+DROP TABLE IF EXISTS filter_rules;
@@ -0,0 +1,16 @@
+-- Add content filter rules
+
+CREATE TABLE IF NOT EXISTS filter_rules (
+    rule_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    channel_id BIGINT NULL COMMENT 'NULL for rules that apply everywhere',
+    kind VARCHAR(10) NOT NULL COMMENT 'words or regex',
+    pattern TEXT NOT NULL,
+    action VARCHAR(10) NOT NULL,
+    replacement VARCHAR(100) NOT NULL DEFAULT '',
+    created_by BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_filter_tenant (tenant_id),
+    FOREIGN KEY (channel_id) REFERENCES channels(channel_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,5 @@
+-- Allow automatic admin actions and bans without an admin
+
+ALTER TABLE admin_action_log MODIFY admin_id BIGINT NULL COMMENT 'NULL for automatic actions';
+
+ALTER TABLE user_bans MODIFY banned_by BIGINT NULL COMMENT 'NULL for automatic bans';
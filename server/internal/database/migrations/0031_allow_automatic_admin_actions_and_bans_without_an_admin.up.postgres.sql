@@ -0,0 +1,5 @@
+-- Allow automatic admin actions and bans without an admin
+
+ALTER TABLE admin_action_log ALTER COLUMN admin_id DROP NOT NULL;
+
+ALTER TABLE user_bans ALTER COLUMN banned_by DROP NOT NULL;
@@ -0,0 +1,54 @@
+-- Allow automatic admin actions and bans without an admin
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE admin_action_log_new (
+    log_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_id BIGINT NULL,
+    action_type VARCHAR(50) NOT NULL,
+    target_user_id BIGINT NULL,
+    target_channel_id BIGINT NULL,
+    action_details TEXT NULL,
+    performed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (target_channel_id) REFERENCES channels(channel_id) ON DELETE SET NULL
+);
+
+INSERT INTO admin_action_log_new (log_id, admin_id, action_type, target_user_id, target_channel_id, action_details, performed_at)
+    SELECT log_id, admin_id, action_type, target_user_id, target_channel_id, action_details, performed_at
+    FROM admin_action_log;
+
+DROP TABLE admin_action_log;
+
+ALTER TABLE admin_action_log_new RENAME TO admin_action_log;
+
+CREATE INDEX IF NOT EXISTS admin_action_log_idx_admin_actions ON admin_action_log (admin_id, performed_at DESC);
+
+CREATE INDEX IF NOT EXISTS admin_action_log_idx_target_user ON admin_action_log (target_user_id, performed_at DESC);
+
+CREATE TABLE user_bans_new (
+    ban_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL,
+    banned_by BIGINT NULL,
+    reason TEXT NULL,
+    banned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES users(user_id) ON DELETE RESTRICT
+);
+
+INSERT INTO user_bans_new (ban_id, user_id, banned_by, reason, banned_at, expires_at, is_active)
+    SELECT ban_id, user_id, banned_by, reason, banned_at, expires_at, is_active
+    FROM user_bans;
+
+DROP TABLE user_bans;
+
+ALTER TABLE user_bans_new RENAME TO user_bans;
+
+CREATE INDEX IF NOT EXISTS user_bans_idx_active_bans ON user_bans (user_id, is_active, expires_at);
+
+CREATE INDEX IF NOT EXISTS user_bans_idx_ban_expiry ON user_bans (expires_at, is_active);
+
+PRAGMA foreign_keys = ON;
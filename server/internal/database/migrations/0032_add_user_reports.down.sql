@@ -0,0 +1,3 @@
+-- Revert: Add user reports
+
+DROP TABLE IF EXISTS reports;
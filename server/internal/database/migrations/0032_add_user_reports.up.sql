@@ -0,0 +1,20 @@
+-- Add user reports
+
+CREATE TABLE IF NOT EXISTS reports (
+    report_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    reporter_id BIGINT NOT NULL,
+    target_user_id BIGINT NULL,
+    target_channel_id BIGINT NULL,
+    reason TEXT NOT NULL,
+    message_ids TEXT NULL COMMENT 'Comma-separated messages.message_id values captured with the report',
+    status VARCHAR(10) NOT NULL DEFAULT 'open' COMMENT 'open, resolved or dismissed',
+    handled_by BIGINT NULL,
+    handled_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_report_status (tenant_id, status),
+    FOREIGN KEY (reporter_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (target_channel_id) REFERENCES channels(channel_id) ON DELETE SET NULL,
+    FOREIGN KEY (handled_by) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
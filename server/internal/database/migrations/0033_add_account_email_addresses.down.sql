@@ -0,0 +1,5 @@
+-- Revert: Add account email addresses
+
+ALTER TABLE users
+    DROP COLUMN email,
+    DROP COLUMN email_verified;
@@ -0,0 +1,5 @@
+-- Add account email addresses
+
+ALTER TABLE users
+    ADD COLUMN email VARCHAR(254) NULL,
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Revert: Add email verification and reset tokens
+
+DROP TABLE IF EXISTS email_tokens;
@@ -0,0 +1,12 @@
+-- Add email verification and reset tokens
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    user_id BIGINT NOT NULL,
+    purpose VARCHAR(10) NOT NULL COMMENT 'verify or reset',
+    token_hash CHAR(64) NOT NULL COMMENT 'SHA-256 hash of the emailed token',
+    email VARCHAR(254) NOT NULL COMMENT 'Address the token was sent to',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, purpose),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add scheduled broadcasts
+
+DROP TABLE IF EXISTS scheduled_broadcasts;
@@ -0,0 +1,16 @@
+-- Add scheduled broadcasts
+
+-- +begin
+CREATE TABLE IF NOT EXISTS scheduled_broadcasts (
+    broadcast_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    created_by BIGINT NOT NULL,
+    message TEXT NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    interval_seconds INT NOT NULL DEFAULT 0 COMMENT '0 for a one-off broadcast',
+    runs INT NOT NULL DEFAULT 0 COMMENT 'Times sent; guards against two nodes sending the same run',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_broadcast_due (tenant_id, next_run_at),
+    FOREIGN KEY (created_by) REFERENCES users(user_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+-- +end
@@ -0,0 +1,4 @@
+-- Revert: Track when IP suspicion last changed
+
+ALTER TABLE user_security_status
+    DROP COLUMN suspicion_updated_at;
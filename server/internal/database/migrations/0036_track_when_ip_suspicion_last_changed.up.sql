@@ -0,0 +1,4 @@
+-- Track when IP suspicion last changed
+
+ALTER TABLE user_security_status
+    ADD COLUMN suspicion_updated_at TIMESTAMP NULL;
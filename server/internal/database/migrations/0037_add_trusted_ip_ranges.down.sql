@@ -0,0 +1,3 @@
+-- Revert: Add trusted IP ranges
+
+DROP TABLE IF EXISTS user_trusted_ips;
@@ -0,0 +1,13 @@
+-- Add trusted IP ranges
+
+CREATE TABLE IF NOT EXISTS user_trusted_ips (
+    trusted_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    cidr VARCHAR(50) NOT NULL COMMENT 'Single addresses are stored as /32 or /128',
+    note VARCHAR(100) NULL,
+    added_by BIGINT NULL COMMENT 'Admin who added it; NULL when the user did',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_user_cidr (user_id, cidr),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (added_by) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Revert: Add security event log
+
+DROP TABLE IF EXISTS security_events;
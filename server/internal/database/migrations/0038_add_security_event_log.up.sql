@@ -0,0 +1,16 @@
+-- Add security event log
+
+CREATE TABLE IF NOT EXISTS security_events (
+    event_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(50) NOT NULL DEFAULT 'default',
+    event_type VARCHAR(50) NOT NULL,
+    user_id BIGINT NULL,
+    actor_id BIGINT NULL COMMENT 'Admin or user who caused the event; NULL when the server did',
+    ip_address VARCHAR(45) NULL,
+    details TEXT,
+    occurred_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_tenant_occurred (tenant_id, occurred_at),
+    INDEX idx_tenant_type (tenant_id, event_type),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (actor_id) REFERENCES users(user_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
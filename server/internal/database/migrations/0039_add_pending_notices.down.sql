@@ -0,0 +1,3 @@
+-- Revert: Add pending notices
+
+DROP TABLE IF EXISTS pending_notices;
@@ -0,0 +1,3 @@
+-- Revert: Add event log checkpoints
+
+DROP TABLE IF EXISTS event_checkpoints;
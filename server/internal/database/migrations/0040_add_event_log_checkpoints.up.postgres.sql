@@ -0,0 +1,8 @@
+-- Add event log checkpoints
+
+CREATE TABLE IF NOT EXISTS event_checkpoints (
+    tenant_id VARCHAR(50) NOT NULL PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    state TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+-- Add event log checkpoints
+
+CREATE TABLE IF NOT EXISTS event_checkpoints (
+    tenant_id VARCHAR(50) NOT NULL PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    state LONGTEXT NOT NULL COMMENT 'JSON: projection states and the IDs after last_event_id already applied',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
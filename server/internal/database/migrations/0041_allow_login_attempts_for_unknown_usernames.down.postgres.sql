@@ -0,0 +1,5 @@
+-- Revert: Allow login attempts for unknown usernames
+
+DELETE FROM user_ip_tracking WHERE user_id IS NULL;
+
+ALTER TABLE user_ip_tracking ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,28 @@
+-- Revert: Allow login attempts for unknown usernames
+
+PRAGMA foreign_keys = OFF;
+
+CREATE TABLE user_ip_tracking_new (
+    tracking_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    login_timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    is_successful BOOLEAN DEFAULT FALSE,
+    user_agent VARCHAR(255) NULL,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+INSERT INTO user_ip_tracking_new (tracking_id, user_id, ip_address, login_timestamp, is_successful, user_agent)
+    SELECT tracking_id, user_id, ip_address, login_timestamp, is_successful, user_agent
+    FROM user_ip_tracking
+    WHERE user_id IS NOT NULL;
+
+DROP TABLE user_ip_tracking;
+
+ALTER TABLE user_ip_tracking_new RENAME TO user_ip_tracking;
+
+CREATE INDEX IF NOT EXISTS user_ip_tracking_idx_user_login ON user_ip_tracking (user_id, login_timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS user_ip_tracking_idx_ip_address ON user_ip_tracking (ip_address);
+
+PRAGMA foreign_keys = ON;
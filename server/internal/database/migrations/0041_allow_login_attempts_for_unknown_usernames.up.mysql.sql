@@ -0,0 +1,3 @@
+-- Allow login attempts for unknown usernames
+
+ALTER TABLE user_ip_tracking MODIFY user_id BIGINT NULL COMMENT 'NULL for attempts on unknown usernames';
@@ -0,0 +1,3 @@
+-- Allow login attempts for unknown usernames
+
+ALTER TABLE user_ip_tracking ALTER COLUMN user_id DROP NOT NULL;
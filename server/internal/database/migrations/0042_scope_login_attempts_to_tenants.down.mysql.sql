@@ -0,0 +1,5 @@
+-- Revert: Scope login attempts to tenants
+
+ALTER TABLE user_ip_tracking
+    DROP INDEX idx_tenant_ip,
+    DROP COLUMN tenant_id;
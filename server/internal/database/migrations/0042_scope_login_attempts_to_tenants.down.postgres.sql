@@ -0,0 +1,5 @@
+-- Revert: Scope login attempts to tenants
+
+DROP INDEX IF EXISTS user_ip_tracking_idx_tenant_ip;
+
+ALTER TABLE user_ip_tracking DROP COLUMN tenant_id;
@@ -0,0 +1,9 @@
+-- Scope login attempts to tenants
+
+ALTER TABLE user_ip_tracking
+    ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default' AFTER tracking_id,
+    ADD INDEX idx_tenant_ip (tenant_id, ip_address, login_timestamp);
+
+UPDATE user_ip_tracking t
+    JOIN users u ON u.user_id = t.user_id
+    SET t.tenant_id = u.tenant_id;
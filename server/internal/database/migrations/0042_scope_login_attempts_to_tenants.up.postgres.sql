@@ -0,0 +1,9 @@
+-- Scope login attempts to tenants
+
+ALTER TABLE user_ip_tracking ADD COLUMN tenant_id VARCHAR(50) NOT NULL DEFAULT 'default';
+
+UPDATE user_ip_tracking
+    SET tenant_id = (SELECT u.tenant_id FROM users u WHERE u.user_id = user_ip_tracking.user_id)
+    WHERE user_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS user_ip_tracking_idx_tenant_ip ON user_ip_tracking (tenant_id, ip_address, login_timestamp);
@@ -0,0 +1,69 @@
+package database
+
+import (
+    "fmt"
+    "time"
+)
+
+// NoticeRepository stores notices for users who were offline when they were
+// sent, to be shown at their next login.
+type NoticeRepository struct {
+    db *DB
+}
+
+func NewNoticeRepository(db *DB) *NoticeRepository {
+    return &NoticeRepository{db: db}
+}
+
+func (r *NoticeRepository) Queue(userID int64, message string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `INSERT INTO pending_notices (user_id, message, created_at) VALUES (?, ?, ?)`
+    if _, err := r.db.ExecContext(ctx, query, userID, message, time.Now()); err != nil {
+        return fmt.Errorf("failed to queue notice: %w", err)
+    }
+
+    return nil
+}
+
+// TakePending returns the user's queued notices, oldest first, and removes
+// them.
+func (r *NoticeRepository) TakePending(userID int64) ([]string, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT notice_id, message FROM pending_notices WHERE user_id = ? ORDER BY notice_id`
+    rows, err := r.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get pending notices: %w", err)
+    }
+    defer rows.Close()
+
+    var messages []string
+    var lastID int64
+    for rows.Next() {
+        var message string
+        if err := rows.Scan(&lastID, &message); err != nil {
+            return nil, fmt.Errorf("failed to scan pending notice: %w", err)
+        }
+        messages = append(messages, message)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to get pending notices: %w", err)
+    }
+    rows.Close()
+
+    if len(messages) == 0 {
+        return nil, nil
+    }
+
+    // Only the notices read above; one queued meanwhile waits for the next
+    // login.
+    query = `DELETE FROM pending_notices WHERE user_id = ? AND notice_id <= ?`
+    if _, err := r.db.ExecContext(ctx, query, userID, lastID); err != nil {
+        return nil, fmt.Errorf("failed to clear pending notices: %w", err)
+    }
+
+    return messages, nil
+}
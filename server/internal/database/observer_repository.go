@@ -0,0 +1,143 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type ObserverRepository struct {
+    db *DB
+}
+
+func NewObserverRepository(db *DB) *ObserverRepository {
+    return &ObserverRepository{db: db}
+}
+
+func (r *ObserverRepository) Add(userID, createdBy int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `INSERT INTO observers (user_id, created_by, created_at) VALUES (?, ?, ?)`
+
+    if _, err := r.db.ExecContext(ctx, query, userID, createdBy, time.Now()); err != nil {
+        return fmt.Errorf("failed to add observer: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ObserverRepository) IsObserver(userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var found int64
+    err := r.db.QueryRowContext(ctx, `SELECT user_id FROM observers WHERE user_id = ?`, userID).Scan(&found)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to check observer: %w", err)
+    }
+
+    return true, nil
+}
+
+func (r *ObserverRepository) Attach(userID, channelID, addedBy int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO observer_channels (user_id, channel_id, added_by, created_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("user_id, channel_id", "added_by", "created_at")
+
+    if _, err := r.db.ExecContext(ctx, query, userID, channelID, addedBy, time.Now()); err != nil {
+        return fmt.Errorf("failed to attach observer: %w", err)
+    }
+
+    return nil
+}
+
+func (r *ObserverRepository) Detach(userID, channelID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM observer_channels WHERE user_id = ? AND channel_id = ?`, userID, channelID)
+    if err != nil {
+        return false, fmt.Errorf("failed to detach observer: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to detach observer: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+// ChannelIDs returns the channels the observer is attached to.
+func (r *ObserverRepository) ChannelIDs(userID int64) ([]int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    rows, err := r.db.QueryContext(ctx, `SELECT channel_id FROM observer_channels WHERE user_id = ? ORDER BY channel_id`, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list observer channels: %w", err)
+    }
+    defer rows.Close()
+
+    var channelIDs []int64
+    for rows.Next() {
+        var channelID int64
+        if err := rows.Scan(&channelID); err != nil {
+            return nil, fmt.Errorf("failed to scan observer channel: %w", err)
+        }
+        channelIDs = append(channelIDs, channelID)
+    }
+
+    return channelIDs, rows.Err()
+}
+
+func (r *ObserverRepository) List() ([]*models.Observer, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT o.user_id, u.username, o.created_at, ch.channel_name
+        FROM observers o
+        JOIN users u ON u.user_id = o.user_id
+        LEFT JOIN observer_channels oc ON oc.user_id = o.user_id
+        LEFT JOIN channels ch ON ch.channel_id = oc.channel_id
+        WHERE u.tenant_id = ?
+        ORDER BY u.username, ch.channel_name
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant())
+    if err != nil {
+        return nil, fmt.Errorf("failed to list observers: %w", err)
+    }
+    defer rows.Close()
+
+    var observers []*models.Observer
+    var current *models.Observer
+    for rows.Next() {
+        observer := &models.Observer{}
+        var channelName sql.NullString
+        if err := rows.Scan(&observer.UserID, &observer.Username, &observer.CreatedAt, &channelName); err != nil {
+            return nil, fmt.Errorf("failed to scan observer: %w", err)
+        }
+
+        if current == nil || current.UserID != observer.UserID {
+            current = observer
+            observers = append(observers, current)
+        }
+        if channelName.Valid {
+            current.Channels = append(current.Channels, channelName.String)
+        }
+    }
+
+    return observers, rows.Err()
+}
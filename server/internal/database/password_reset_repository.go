@@ -0,0 +1,88 @@
+package database
+
+import (
+    "fmt"
+    "time"
+)
+
+type PasswordResetRepository struct {
+    db *DB
+}
+
+func NewPasswordResetRepository(db *DB) *PasswordResetRepository {
+    return &PasswordResetRepository{db: db}
+}
+
+func (r *PasswordResetRepository) Create(userID int64, tokenHash string, ttl *time.Duration) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var expiresAt *time.Time
+    if ttl != nil {
+        expiry := time.Now().Add(*ttl)
+        expiresAt = &expiry
+    }
+
+    query := `
+        INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("user_id", "token_hash", "expires_at", "created_at")
+
+    _, err := r.db.ExecContext(ctx, query, userID, tokenHash, expiresAt, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to create password reset: %w", err)
+    }
+
+    return nil
+}
+
+func (r *PasswordResetRepository) IsPending(userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `SELECT COUNT(*) FROM password_resets WHERE user_id = ?`
+    var count int
+    err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+    if err != nil {
+        return false, fmt.Errorf("failed to check password reset: %w", err)
+    }
+
+    return count > 0, nil
+}
+
+func (r *PasswordResetRepository) Consume(userID int64, tokenHash string) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        DELETE FROM password_resets
+        WHERE user_id = ?
+          AND token_hash = ?
+          AND (expires_at IS NULL OR expires_at > ?)
+    `
+
+    result, err := r.db.ExecContext(ctx, query, userID, tokenHash, time.Now())
+    if err != nil {
+        return false, fmt.Errorf("failed to consume password reset: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to consume password reset: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+// Delete drops any pending reset for the user.
+func (r *PasswordResetRepository) Delete(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    _, err := r.db.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userID)
+    if err != nil {
+        return fmt.Errorf("failed to delete password reset: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type PasteRepository struct {
+    db *DB
+}
+
+func NewPasteRepository(db *DB) *PasteRepository {
+    return &PasteRepository{db: db}
+}
+
+func (r *PasteRepository) Create(paste *models.Paste) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO pastes (user_id, channel_id, recipient_id, title, encrypted_key, content, size, line_count, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+    pasteID, err := r.db.InsertContext(ctx, "paste_id", query, paste.UserID, paste.ChannelID, paste.RecipientID,
+        paste.Title, paste.EncryptedKey, paste.Content, paste.Size, paste.LineCount, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to store paste: %w", err)
+    }
+
+    paste.PasteID = pasteID
+    return pasteID, nil
+}
+
+func (r *PasteRepository) Get(pasteID int64) (*models.Paste, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT p.paste_id, p.user_id, u.username, p.channel_id, p.recipient_id, p.title,
+               p.encrypted_key, p.content, p.size, p.line_count, p.created_at
+        FROM pastes p
+        JOIN users u ON u.user_id = p.user_id
+        WHERE p.paste_id = ? AND u.tenant_id = ?
+    `
+
+    paste := &models.Paste{}
+    err := r.db.QueryRowContext(ctx, query, pasteID, r.db.Tenant()).Scan(
+        &paste.PasteID,
+        &paste.UserID,
+        &paste.Username,
+        &paste.ChannelID,
+        &paste.RecipientID,
+        &paste.Title,
+        &paste.EncryptedKey,
+        &paste.Content,
+        &paste.Size,
+        &paste.LineCount,
+        &paste.CreatedAt,
+    )
+
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("paste not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get paste: %w", err)
+    }
+
+    return paste, nil
+}
+
+func (r *PasteRepository) Delete(pasteID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    if _, err := r.db.ExecContext(ctx, `DELETE FROM pastes WHERE paste_id = ?`, pasteID); err != nil {
+        return fmt.Errorf("failed to delete paste: %w", err)
+    }
+
+    return nil
+}
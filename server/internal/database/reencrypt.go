@@ -0,0 +1,142 @@
+package database
+
+import (
+    "fmt"
+    "strings"
+)
+
+const reencryptBatchSize = 500
+
+// ReencryptResult counts the rows of one table -reencrypt-storage looked at
+// and how many it rewrote.
+type ReencryptResult struct {
+    Table     string
+    Scanned   int64
+    Rewritten int64
+}
+
+// sealedTable names a table with sealed message_content, its ID column and
+// the columns whose values make up the row key bound into each seal.
+type sealedTable struct {
+    name       string
+    idColumn   string
+    keyColumns []string
+}
+
+type sealedRow struct {
+    id      int64
+    rowKey  []int64
+    content string
+}
+
+// ReencryptStorage rewrites message content that is not sealed with the
+// current storage key: rows from before encryption was enabled and rows
+// sealed with the previous key. It covers every tenant and can be run while
+// the server is up; a row that changes in the meantime is left for the next
+// run.
+func ReencryptStorage(db *DB) ([]ReencryptResult, error) {
+    if db.storage == nil {
+        return nil, fmt.Errorf("no storage encryption key is configured")
+    }
+
+    var results []ReencryptResult
+    for _, table := range []sealedTable{
+        {messagesTable, "message_id", []string{"channel_id"}},
+        {directMessagesTable, "dm_id", []string{"sender_id", "recipient_id"}},
+    } {
+        result, err := db.reencryptTable(table)
+        if err != nil {
+            return results, err
+        }
+        results = append(results, result)
+    }
+
+    return results, nil
+}
+
+func (db *DB) reencryptTable(table sealedTable) (ReencryptResult, error) {
+    result := ReencryptResult{Table: table.name}
+
+    var afterID int64
+    for {
+        batch, err := db.sealedBatch(table, afterID)
+        if err != nil {
+            return result, err
+        }
+        if len(batch) == 0 {
+            return result, nil
+        }
+
+        for _, row := range batch {
+            result.Scanned++
+            afterID = row.id
+            if db.storage.Current(row.content) {
+                continue
+            }
+
+            rewritten, err := db.resealRow(table, row)
+            if err != nil {
+                return result, err
+            }
+            if rewritten {
+                result.Rewritten++
+            }
+        }
+    }
+}
+
+// sealedBatch reads the next rows in full before any are rewritten, since
+// with SQLite's single connection the updates would wait on the open query.
+func (db *DB) sealedBatch(table sealedTable, afterID int64) ([]sealedRow, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := fmt.Sprintf(`SELECT %s, %s, message_content FROM %s WHERE %s > ? ORDER BY %s LIMIT ?`,
+        table.idColumn, strings.Join(table.keyColumns, ", "), table.name, table.idColumn, table.idColumn)
+
+    rows, err := db.QueryContext(ctx, query, afterID, reencryptBatchSize)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %w", table.name, err)
+    }
+    defer rows.Close()
+
+    var batch []sealedRow
+    for rows.Next() {
+        row := sealedRow{rowKey: make([]int64, len(table.keyColumns))}
+        dest := []interface{}{&row.id}
+        for i := range row.rowKey {
+            dest = append(dest, &row.rowKey[i])
+        }
+        dest = append(dest, &row.content)
+        if err := rows.Scan(dest...); err != nil {
+            return nil, fmt.Errorf("failed to scan %s row: %w", table.name, err)
+        }
+        batch = append(batch, row)
+    }
+
+    return batch, rows.Err()
+}
+
+func (db *DB) resealRow(table sealedTable, row sealedRow) (bool, error) {
+    plaintext, err := db.openContent(table.name, row.rowKey, row.content)
+    if err != nil {
+        return false, fmt.Errorf("%s %d: %w", table.idColumn, row.id, err)
+    }
+
+    sealed, err := db.sealContent(table.name, row.rowKey, plaintext)
+    if err != nil {
+        return false, err
+    }
+
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := fmt.Sprintf(`UPDATE %s SET message_content = ? WHERE %s = ? AND message_content = ?`, table.name, table.idColumn)
+    result, err := db.ExecContext(ctx, query, sealed, row.id, row.content)
+    if err != nil {
+        return false, fmt.Errorf("failed to rewrite %s %d: %w", table.idColumn, row.id, err)
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "log"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+const defaultReplicaCheckInterval = 10 * time.Second
+
+// replica is one read-only connection pool. healthy is cleared when a
+// health check fails and set again once a ping succeeds, so a replica that
+// comes back rejoins the rotation without a restart.
+type replica struct {
+    db      *sql.DB
+    stmts   *stmtCache
+    healthy int32
+}
+
+// replicaSet spreads read-only queries across the configured replicas in
+// turn. Reads fall back to the primary while no replica is healthy.
+type replicaSet struct {
+    replicas []*replica
+    next     uint64
+    stop     chan struct{}
+    wg       sync.WaitGroup
+}
+
+func openReplicas(dialect Dialect, cfg config.DatabaseConfig) (*replicaSet, error) {
+    set := &replicaSet{stop: make(chan struct{})}
+    for i, dsn := range cfg.ReadReplicas {
+        db, err := sql.Open(dialect.driverName(), dsn)
+        if err != nil {
+            set.close()
+            return nil, fmt.Errorf("failed to open read replica %d: %w", i+1, err)
+        }
+        db.SetMaxOpenConns(cfg.MaxOpenConns)
+        db.SetMaxIdleConns(cfg.MaxIdleConns)
+        db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+        r := &replica{db: db}
+        if cfg.StatementCacheSize > 0 {
+            r.stmts = newStmtCache(cfg.StatementCacheSize)
+        }
+
+        // A replica that is down at startup is not fatal; the health check
+        // picks it up when it answers.
+        if err := db.Ping(); err != nil {
+            log.Printf("Read replica %d is unavailable, reading from the primary until it recovers: %v", i+1, err)
+        } else {
+            r.healthy = 1
+        }
+        set.replicas = append(set.replicas, r)
+    }
+
+    interval := cfg.ReplicaCheckInterval
+    if interval <= 0 {
+        interval = defaultReplicaCheckInterval
+    }
+    set.wg.Add(1)
+    go set.checkLoop(interval)
+
+    return set, nil
+}
+
+// pick returns the next healthy replica, or nil if there is none.
+func (s *replicaSet) pick() *replica {
+    n := uint64(len(s.replicas))
+    start := atomic.AddUint64(&s.next, 1)
+    for i := uint64(0); i < n; i++ {
+        r := s.replicas[(start+i)%n]
+        if atomic.LoadInt32(&r.healthy) == 1 {
+            return r
+        }
+    }
+    return nil
+}
+
+func (s *replicaSet) checkLoop(interval time.Duration) {
+    defer s.wg.Done()
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.stop:
+            return
+        case <-ticker.C:
+            s.check()
+        }
+    }
+}
+
+func (s *replicaSet) check() {
+    for i, r := range s.replicas {
+        ctx, cancel := contextWithTimeout(5 * time.Second)
+        err := r.db.PingContext(ctx)
+        cancel()
+
+        if err != nil {
+            if atomic.SwapInt32(&r.healthy, 0) == 1 {
+                log.Printf("Read replica %d failed its health check, reading from the others: %v", i+1, err)
+            }
+            continue
+        }
+        if atomic.SwapInt32(&r.healthy, 1) == 0 {
+            log.Printf("Read replica %d is healthy again", i+1)
+        }
+    }
+}
+
+// healthyCount reports how many replicas are currently taking reads.
+func (s *replicaSet) healthyCount() int {
+    count := 0
+    for _, r := range s.replicas {
+        if atomic.LoadInt32(&r.healthy) == 1 {
+            count++
+        }
+    }
+    return count
+}
+
+func (s *replicaSet) close() {
+    close(s.stop)
+    s.wg.Wait()
+    for _, r := range s.replicas {
+        if r.stmts != nil {
+            r.stmts.close()
+        }
+        r.db.Close()
+    }
+}
+
+// Reader returns a handle for read-only queries. With read replicas
+// configured it is backed by the next healthy replica; otherwise, inside a
+// transaction, or while every replica is down it is db itself. Replicas may
+// lag the primary, so only reads that tolerate slightly stale rows should
+// use it, never a read that must see a write the caller just made.
+func (db *DB) Reader() *DB {
+    if db.tx != nil || db.replicas == nil {
+        return db
+    }
+
+    r := db.replicas.pick()
+    if r == nil {
+        return db
+    }
+
+    scoped := *db
+    scoped.DB = r.db
+    scoped.stmts = r.stmts
+    scoped.replicas = nil
+    scoped.shared = true
+    return &scoped
+}
+
+// ReplicaStats is a snapshot of the read replicas.
+type ReplicaStats struct {
+    Configured int
+    Healthy    int
+}
+
+func (db *DB) ReplicaStats() ReplicaStats {
+    if db.replicas == nil {
+        return ReplicaStats{}
+    }
+    return ReplicaStats{
+        Configured: len(db.replicas.replicas),
+        Healthy:    db.replicas.healthyCount(),
+    }
+}
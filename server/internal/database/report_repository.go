@@ -0,0 +1,122 @@
+package database
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type ReportRepository struct {
+    db *DB
+}
+
+func NewReportRepository(db *DB) *ReportRepository {
+    return &ReportRepository{db: db}
+}
+
+func (r *ReportRepository) Create(report *models.Report) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var messageIDs []string
+    for _, id := range report.MessageIDs {
+        messageIDs = append(messageIDs, strconv.FormatInt(id, 10))
+    }
+
+    query := `
+        INSERT INTO reports (tenant_id, reporter_id, target_user_id, target_channel_id, reason, message_ids, status, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, 'open', ?)
+    `
+
+    reportID, err := r.db.InsertContext(ctx, "report_id", query, r.db.Tenant(), report.ReporterID, report.TargetUserID,
+        report.TargetChannelID, report.Reason, strings.Join(messageIDs, ","), time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to create report: %w", err)
+    }
+
+    return reportID, nil
+}
+
+// List returns reports with the given status, or every report when status
+// is empty, oldest first.
+func (r *ReportRepository) List(status string, limit int) ([]*models.Report, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT p.report_id, p.reporter_id, u.username, p.target_user_id, p.target_channel_id,
+               COALESCE(t.username, c.channel_name, ''), p.reason, COALESCE(p.message_ids, ''), p.status,
+               p.handled_by, p.handled_at, p.created_at
+        FROM reports p
+        JOIN users u ON u.user_id = p.reporter_id
+        LEFT JOIN users t ON t.user_id = p.target_user_id
+        LEFT JOIN channels c ON c.channel_id = p.target_channel_id
+        WHERE p.tenant_id = ? AND (? = '' OR p.status = ?)
+        ORDER BY p.report_id
+        LIMIT ?
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant(), status, status, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list reports: %w", err)
+    }
+    defer rows.Close()
+
+    var reports []*models.Report
+    for rows.Next() {
+        report := &models.Report{}
+        var messageIDs string
+        err := rows.Scan(
+            &report.ReportID,
+            &report.ReporterID,
+            &report.ReporterName,
+            &report.TargetUserID,
+            &report.TargetChannelID,
+            &report.TargetName,
+            &report.Reason,
+            &messageIDs,
+            &report.Status,
+            &report.HandledBy,
+            &report.HandledAt,
+            &report.CreatedAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan report: %w", err)
+        }
+        for _, field := range strings.Split(messageIDs, ",") {
+            if id, err := strconv.ParseInt(field, 10, 64); err == nil {
+                report.MessageIDs = append(report.MessageIDs, id)
+            }
+        }
+        reports = append(reports, report)
+    }
+
+    return reports, nil
+}
+
+// Close marks an open report resolved or dismissed. It reports false when
+// there is no open report with that ID.
+func (r *ReportRepository) Close(reportID int64, status string, handledBy int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE reports SET status = ?, handled_by = ?, handled_at = ?
+        WHERE report_id = ? AND tenant_id = ? AND status = 'open'
+    `
+
+    result, err := r.db.ExecContext(ctx, query, status, handledBy, time.Now(), reportID, r.db.Tenant())
+    if err != nil {
+        return false, fmt.Errorf("failed to update report: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to update report: %w", err)
+    }
+
+    return affected > 0, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
     "database/sql"
     "fmt"
+    "strings"
     "time"
 
     "github.com/onyxirc/server/internal/models"
@@ -16,16 +17,24 @@ func NewSecurityRepository(db *DB) *SecurityRepository {
     return &SecurityRepository{db: db}
 }
 
+// RecordLoginAttempt stores a login attempt from ipAddress. A userID of 0,
+// for a username that does not exist, is stored as NULL so the attempt
+// still counts towards the address's failures.
 func (r *SecurityRepository) RecordLoginAttempt(userID int64, ipAddress string, isSuccessful bool, userAgent *string) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
+    var user interface{}
+    if userID != 0 {
+        user = userID
+    }
+
     query := `
-        INSERT INTO user_ip_tracking (user_id, ip_address, is_successful, user_agent)
-        VALUES (?, ?, ?, ?)
+        INSERT INTO user_ip_tracking (tenant_id, user_id, ip_address, is_successful, user_agent, login_timestamp)
+        VALUES (?, ?, ?, ?, ?, ?)
     `
 
-    _, err := r.db.ExecContext(ctx, query, userID, ipAddress, isSuccessful, userAgent)
+    _, err := r.db.ExecContext(ctx, query, r.db.Tenant(), user, ipAddress, isSuccessful, userAgent, time.Now())
     if err != nil {
         return fmt.Errorf("failed to record login attempt: %w", err)
     }
@@ -65,6 +74,24 @@ func (r *SecurityRepository) GetSecurityStatus(userID int64) (*models.UserSecuri
     return status, nil
 }
 
+// EnsureSecurityStatus creates the user's security status row unless a
+// database trigger already has.
+func (r *SecurityRepository) EnsureSecurityStatus(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO user_security_status (user_id, ip_suspicion_count, account_locked)
+        VALUES (?, 0, FALSE)
+    ` + r.db.Dialect().OnConflictUpdate("user_id", "user_id")
+
+    if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+        return fmt.Errorf("failed to create security status: %w", err)
+    }
+
+    return nil
+}
+
 func (r *SecurityRepository) UpdateLastKnownIP(userID int64, ipAddress string) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -89,11 +116,12 @@ func (r *SecurityRepository) IncrementSuspicionCount(userID int64) (int, error)
 
     query := `
         UPDATE user_security_status
-        SET ip_suspicion_count = ip_suspicion_count + 1
+        SET ip_suspicion_count = ip_suspicion_count + 1,
+            suspicion_updated_at = ?
         WHERE user_id = ?
     `
 
-    _, err := r.db.ExecContext(ctx, query, userID)
+    _, err := r.db.ExecContext(ctx, query, time.Now(), userID)
     if err != nil {
         return 0, fmt.Errorf("failed to increment suspicion count: %w", err)
     }
@@ -150,6 +178,31 @@ func (r *SecurityRepository) DecrementSuspicionCount(userID int64) (int, error)
     return status.IPSuspicionCount, nil
 }
 
+// DecaySuspicion lowers by one the suspicion count of every unlocked account
+// in the tenant whose count last changed before the given time, restarting
+// its clock. It returns the number of accounts changed.
+func (r *SecurityRepository) DecaySuspicion(before time.Time) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE user_security_status
+        SET ip_suspicion_count = ip_suspicion_count - 1,
+            suspicion_updated_at = ?
+        WHERE ip_suspicion_count > 0
+          AND account_locked = FALSE
+          AND (suspicion_updated_at IS NULL OR suspicion_updated_at < ?)
+          AND user_id IN (SELECT user_id FROM users WHERE tenant_id = ?)
+    `
+
+    result, err := r.db.ExecContext(ctx, query, time.Now(), before, r.db.Tenant())
+    if err != nil {
+        return 0, fmt.Errorf("failed to decay suspicion counts: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
 func (r *SecurityRepository) LockAccount(userID int64, reason string, lockedBy *int64) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
@@ -276,3 +329,191 @@ func (r *SecurityRepository) GetRecentSuccessfulLogins(userID int64, limit int)
 
     return history, nil
 }
+
+// CountFailedLogins counts failed attempts for a user since the later of
+// since and the user's last successful login.
+func (r *SecurityRepository) CountFailedLogins(userID int64, since time.Time) (int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT COUNT(*) FROM user_ip_tracking f
+        WHERE f.user_id = ?
+          AND f.is_successful = FALSE
+          AND f.login_timestamp > ?
+          AND NOT EXISTS (
+              SELECT 1 FROM user_ip_tracking s
+              WHERE s.user_id = f.user_id
+                AND s.is_successful = TRUE
+                AND s.login_timestamp >= f.login_timestamp
+          )
+    `
+
+    var count int
+    err := r.db.QueryRowContext(ctx, query, userID, since).Scan(&count)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count failed logins: %w", err)
+    }
+
+    return count, nil
+}
+
+// CountFailedLoginsFromIP counts the tenant's failed logins from ipAddress
+// since the given time, including those on unknown usernames.
+func (r *SecurityRepository) CountFailedLoginsFromIP(ipAddress string, since time.Time) (int, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT COUNT(*) FROM user_ip_tracking
+        WHERE tenant_id = ? AND ip_address = ? AND is_successful = FALSE AND login_timestamp > ?
+    `
+
+    var count int
+    err := r.db.QueryRowContext(ctx, query, r.db.Tenant(), ipAddress, since).Scan(&count)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count failed logins: %w", err)
+    }
+
+    return count, nil
+}
+
+// DeleteIPHistory removes every login record for userID and forgets its last
+// known address.
+func (r *SecurityRepository) DeleteIPHistory(userID int64) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM user_ip_tracking WHERE user_id = ?`, userID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete IP history: %w", err)
+    }
+
+    if _, err := r.db.ExecContext(ctx, `UPDATE user_security_status SET last_known_ip = NULL WHERE user_id = ?`, userID); err != nil {
+        return 0, fmt.Errorf("failed to clear last known IP: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// PruneIPHistory removes login records older than before across the tenant.
+func (r *SecurityRepository) PruneIPHistory(before time.Time) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        DELETE FROM user_ip_tracking
+        WHERE login_timestamp < ? AND tenant_id = ?
+    `
+
+    result, err := r.db.ExecContext(ctx, query, before, r.db.Tenant())
+    if err != nil {
+        return 0, fmt.Errorf("failed to prune IP history: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// RecordEvent appends to the security event log. userID is the account the
+// event concerns and actorID whoever caused it; either may be nil, and an
+// empty ipAddress is stored as NULL. Events are never updated or deleted.
+func (r *SecurityRepository) RecordEvent(eventType string, userID, actorID *int64, ipAddress, details string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var address interface{}
+    if ipAddress != "" {
+        address = ipAddress
+    }
+
+    query := `
+        INSERT INTO security_events (tenant_id, event_type, user_id, actor_id, ip_address, details, occurred_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+
+    if _, err := r.db.ExecContext(ctx, query, r.db.Tenant(), eventType, userID, actorID, address, details, time.Now()); err != nil {
+        return fmt.Errorf("failed to record security event: %w", err)
+    }
+
+    return nil
+}
+
+// SecurityEventFilter narrows a security event search. Zero fields match
+// everything.
+type SecurityEventFilter struct {
+    EventType string
+    UserID    int64
+    IPAddress string
+    From      time.Time
+    To        time.Time
+    Limit     int
+}
+
+func (r *SecurityRepository) SearchEvents(filter SecurityEventFilter) ([]*models.SecurityEvent, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    conditions := []string{"e.tenant_id = ?"}
+    args := []interface{}{r.db.Tenant()}
+
+    if filter.EventType != "" {
+        conditions = append(conditions, "e.event_type = ?")
+        args = append(args, filter.EventType)
+    }
+    if filter.UserID != 0 {
+        conditions = append(conditions, "(e.user_id = ? OR e.actor_id = ?)")
+        args = append(args, filter.UserID, filter.UserID)
+    }
+    if filter.IPAddress != "" {
+        conditions = append(conditions, "e.ip_address = ?")
+        args = append(args, filter.IPAddress)
+    }
+    if !filter.From.IsZero() {
+        conditions = append(conditions, "e.occurred_at >= ?")
+        args = append(args, filter.From)
+    }
+    if !filter.To.IsZero() {
+        conditions = append(conditions, "e.occurred_at <= ?")
+        args = append(args, filter.To)
+    }
+
+    query := `
+        SELECT e.event_id, e.event_type, e.user_id, u.username, e.actor_id, a.username,
+               e.ip_address, e.details, e.occurred_at
+        FROM security_events e
+        LEFT JOIN users u ON u.user_id = e.user_id
+        LEFT JOIN users a ON a.user_id = e.actor_id
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        ORDER BY e.occurred_at DESC, e.event_id DESC
+        LIMIT ?
+    `
+    args = append(args, filter.Limit)
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get security events: %w", err)
+    }
+    defer rows.Close()
+
+    var events []*models.SecurityEvent
+    for rows.Next() {
+        event := &models.SecurityEvent{}
+        err := rows.Scan(
+            &event.EventID,
+            &event.EventType,
+            &event.UserID,
+            &event.Username,
+            &event.ActorID,
+            &event.ActorUsername,
+            &event.IPAddress,
+            &event.Details,
+            &event.OccurredAt,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan security event: %w", err)
+        }
+        events = append(events, event)
+    }
+
+    return events, nil
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type SessionRepository struct {
+    db *DB
+}
+
+func NewSessionRepository(db *DB) *SessionRepository {
+    return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(userID int64, tokenHash string, expiresAt time.Time, ipAddress string, sessionKey string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO session_tokens (user_id, token_hash, expires_at, ip_address, session_key)
+        VALUES (?, ?, ?, ?, ?)
+    `
+
+    _, err := r.db.ExecContext(ctx, query, userID, tokenHash, expiresAt, ipAddress, sessionKey)
+    if err != nil {
+        return fmt.Errorf("failed to store session: %w", err)
+    }
+
+    return nil
+}
+
+func (r *SessionRepository) GetValidByHash(tokenHash string) (*models.SessionToken, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT token_id, user_id, token_hash, created_at, expires_at, last_activity,
+               ip_address, is_valid, session_key
+        FROM session_tokens
+        WHERE token_hash = ? AND is_valid = TRUE AND expires_at > ?
+    `
+
+    token := &models.SessionToken{}
+    err := r.db.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(
+        &token.TokenID,
+        &token.UserID,
+        &token.TokenHash,
+        &token.CreatedAt,
+        &token.ExpiresAt,
+        &token.LastActivity,
+        &token.IPAddress,
+        &token.IsValid,
+        &token.SessionKey,
+    )
+
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("session not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get session: %w", err)
+    }
+
+    return token, nil
+}
+
+func (r *SessionRepository) UpdateActivity(tokenHash string, expiresAt time.Time, ipAddress string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE session_tokens
+        SET expires_at = ?, ip_address = ?, last_activity = CURRENT_TIMESTAMP
+        WHERE token_hash = ? AND is_valid = TRUE
+    `
+
+    _, err := r.db.ExecContext(ctx, query, expiresAt, ipAddress, tokenHash)
+    if err != nil {
+        return fmt.Errorf("failed to update session activity: %w", err)
+    }
+
+    return nil
+}
+
+// UpdateKey replaces the wrapped session key after a rekey, so a resumed
+// session continues with the new key.
+func (r *SessionRepository) UpdateKey(tokenHash string, sessionKey string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE session_tokens SET session_key = ? WHERE token_hash = ? AND is_valid = TRUE`
+    _, err := r.db.ExecContext(ctx, query, sessionKey, tokenHash)
+    if err != nil {
+        return fmt.Errorf("failed to update session key: %w", err)
+    }
+
+    return nil
+}
+
+// ClearKey forgets the stored session key, so the session can no longer be
+// resumed after a restart or on another node. It is used once a session
+// switches to a forward-secret key, which must not be kept at rest.
+func (r *SessionRepository) ClearKey(tokenHash string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE session_tokens SET session_key = NULL WHERE token_hash = ?`
+    _, err := r.db.ExecContext(ctx, query, tokenHash)
+    if err != nil {
+        return fmt.Errorf("failed to clear session key: %w", err)
+    }
+
+    return nil
+}
+
+func (r *SessionRepository) Invalidate(tokenHash string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE session_tokens SET is_valid = FALSE, session_key = NULL WHERE token_hash = ?`
+    _, err := r.db.ExecContext(ctx, query, tokenHash)
+    if err != nil {
+        return fmt.Errorf("failed to invalidate session: %w", err)
+    }
+
+    return nil
+}
+
+func (r *SessionRepository) InvalidateUser(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE session_tokens SET is_valid = FALSE, session_key = NULL WHERE user_id = ? AND is_valid = TRUE`
+    _, err := r.db.ExecContext(ctx, query, userID)
+    if err != nil {
+        return fmt.Errorf("failed to invalidate user sessions: %w", err)
+    }
+
+    return nil
+}
+
+func (r *SessionRepository) InvalidateExpired() (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE session_tokens
+        SET is_valid = FALSE, session_key = NULL
+        WHERE expires_at < ? AND is_valid = TRUE
+    `
+
+    result, err := r.db.ExecContext(ctx, query, time.Now())
+    if err != nil {
+        return 0, fmt.Errorf("failed to invalidate expired sessions: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+func (r *SessionRepository) DeleteUser(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    _, err := r.db.ExecContext(ctx, `DELETE FROM session_tokens WHERE user_id = ?`, userID)
+    if err != nil {
+        return fmt.Errorf("failed to delete user sessions: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+// stmtCache keeps prepared statements keyed by their (rebound) query text.
+// It stops adding statements once full rather than evicting, since a
+// statement may be in use by another goroutine; queries built at runtime
+// with a varying shape therefore just run unprepared.
+type stmtCache struct {
+    mu     sync.RWMutex
+    stmts  map[string]*sql.Stmt
+    size   int
+    hits   int64
+    misses int64
+    skips  int64
+}
+
+func newStmtCache(size int) *stmtCache {
+    return &stmtCache{stmts: make(map[string]*sql.Stmt), size: size}
+}
+
+// get returns a prepared statement for query, preparing it on first use.
+// It returns nil when the cache is full or the query cannot be prepared,
+// and the caller runs the query directly.
+func (c *stmtCache) get(ctx context.Context, db *sql.DB, query string) *sql.Stmt {
+    c.mu.RLock()
+    stmt, exists := c.stmts[query]
+    full := len(c.stmts) >= c.size
+    c.mu.RUnlock()
+
+    if exists {
+        atomic.AddInt64(&c.hits, 1)
+        return stmt
+    }
+    if full {
+        atomic.AddInt64(&c.skips, 1)
+        return nil
+    }
+
+    atomic.AddInt64(&c.misses, 1)
+
+    // Not every statement can be prepared (some DDL on MySQL); running it
+    // directly reports any real error.
+    prepared, err := db.PrepareContext(ctx, query)
+    if err != nil {
+        return nil
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if stmt, exists := c.stmts[query]; exists {
+        prepared.Close()
+        return stmt
+    }
+    if len(c.stmts) >= c.size {
+        prepared.Close()
+        return nil
+    }
+    c.stmts[query] = prepared
+    return prepared
+}
+
+func (c *stmtCache) close() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    for query, stmt := range c.stmts {
+        stmt.Close()
+        delete(c.stmts, query)
+    }
+}
+
+// StatementCacheStats is a snapshot of the prepared statement cache.
+type StatementCacheStats struct {
+    Size   int
+    Hits   int64
+    Misses int64
+    Skips  int64
+}
+
+// StatementCacheStats reports how often queries reused a prepared
+// statement. Misses are first uses; skips ran unprepared because the cache
+// was full.
+func (db *DB) StatementCacheStats() StatementCacheStats {
+    if db.stmts == nil {
+        return StatementCacheStats{}
+    }
+
+    db.stmts.mu.RLock()
+    size := len(db.stmts.stmts)
+    db.stmts.mu.RUnlock()
+
+    return StatementCacheStats{
+        Size:   size,
+        Hits:   atomic.LoadInt64(&db.stmts.hits),
+        Misses: atomic.LoadInt64(&db.stmts.misses),
+        Skips:  atomic.LoadInt64(&db.stmts.skips),
+    }
+}
+
+// cacheable limits the cache to DML. Schema changes run once, and a
+// statement prepared before a migration could outlive the shape it was
+// planned for.
+func cacheable(query string) bool {
+    fields := strings.Fields(query)
+    if len(fields) == 0 {
+        return false
+    }
+
+    switch strings.ToUpper(fields[0]) {
+    case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+        return true
+    }
+    return false
+}
+
+// prepared returns the cached statement for query, or nil if the query
+// should run directly: inside a transaction, with the cache disabled, or
+// when the cache cannot take it.
+func (db *DB) prepared(ctx context.Context, query string) *sql.Stmt {
+    if db.tx != nil || db.stmts == nil || !cacheable(query) {
+        return nil
+    }
+    return db.stmts.get(ctx, db.DB, query)
+}
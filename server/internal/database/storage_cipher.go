@@ -0,0 +1,295 @@
+package database
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+// sealedPrefix marks a column value written by a StorageCipher. The full
+// form is enc2:<key id>:<base64 nonce and ciphertext>; anything without a
+// sealed prefix is a row stored before encryption was enabled and is read
+// as is. enc1 values bound only the table name as additional data; they
+// stay readable until -reencrypt-storage rewrites them.
+const (
+    sealedPrefix       = "enc2:"
+    legacySealedPrefix = "enc1:"
+)
+
+const storageKeySize = 32
+
+// StorageCipher seals message content with the server's storage master key
+// before it reaches the database, so a dump of the messages and
+// direct_messages tables does not reveal history. The previous key, if
+// any, is only used to read rows that -reencrypt-storage has not rewritten
+// yet.
+type StorageCipher struct {
+    current  *storageKey
+    previous *storageKey
+}
+
+type storageKey struct {
+    id   string
+    aead cipher.AEAD
+}
+
+func newStorageKey(key []byte) (*storageKey, error) {
+    if len(key) != storageKeySize {
+        return nil, fmt.Errorf("storage encryption key must be %d bytes, got %d", storageKeySize, len(key))
+    }
+
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create cipher: %w", err)
+    }
+
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create GCM: %w", err)
+    }
+
+    sum := sha256.Sum256(key)
+    return &storageKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func NewStorageCipher(key, previous []byte) (*StorageCipher, error) {
+    current, err := newStorageKey(key)
+    if err != nil {
+        return nil, err
+    }
+
+    c := &StorageCipher{current: current}
+    if previous != nil {
+        if c.previous, err = newStorageKey(previous); err != nil {
+            return nil, fmt.Errorf("invalid previous storage key: %w", err)
+        }
+    }
+
+    return c, nil
+}
+
+// KeyID identifies the current master key in sealed values and logs. It is
+// a short hash of the key, not the key itself.
+func (c *StorageCipher) KeyID() string {
+    return c.current.id
+}
+
+// Seal encrypts plaintext for a row of the given table. The table name and
+// rowKey, the IDs the row is addressed by (the channel of a message, the
+// sender and recipient of a direct message), are bound as additional data,
+// so a value copied into another table or another row fails to open.
+func (c *StorageCipher) Seal(table string, rowKey []int64, plaintext string) (string, error) {
+    nonce := make([]byte, c.current.aead.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return "", fmt.Errorf("failed to generate nonce: %w", err)
+    }
+
+    sealed := c.current.aead.Seal(nonce, nonce, []byte(plaintext), storageAAD(table, rowKey))
+    return sealedPrefix + c.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open reverses Seal for the row identified by table and rowKey. Values
+// without a sealed prefix are returned unchanged.
+func (c *StorageCipher) Open(table string, rowKey []int64, value string) (string, error) {
+    keyID, data, legacy, sealed := splitSealed(value)
+    if !sealed {
+        return value, nil
+    }
+
+    var key *storageKey
+    switch {
+    case c == nil:
+        return "", fmt.Errorf("%s row is encrypted but no storage encryption key is configured", table)
+    case keyID == c.current.id:
+        key = c.current
+    case c.previous != nil && keyID == c.previous.id:
+        key = c.previous
+    default:
+        return "", fmt.Errorf("%s row is encrypted with unknown storage key %s", table, keyID)
+    }
+
+    raw, err := base64.StdEncoding.DecodeString(data)
+    if err != nil {
+        return "", fmt.Errorf("failed to decode sealed %s row: %w", table, err)
+    }
+
+    nonceSize := key.aead.NonceSize()
+    if len(raw) < nonceSize {
+        return "", fmt.Errorf("sealed %s row is too short", table)
+    }
+
+    additional := storageAAD(table, rowKey)
+    if legacy {
+        additional = []byte(table)
+    }
+
+    plaintext, err := key.aead.Open(nil, raw[:nonceSize], raw[nonceSize:], additional)
+    if err != nil {
+        return "", fmt.Errorf("failed to decrypt %s row: %w", table, err)
+    }
+
+    return string(plaintext), nil
+}
+
+// Current reports whether value is already sealed in the current format
+// with the current key.
+func (c *StorageCipher) Current(value string) bool {
+    keyID, _, legacy, sealed := splitSealed(value)
+    return sealed && !legacy && keyID == c.current.id
+}
+
+func splitSealed(value string) (keyID, data string, legacy, sealed bool) {
+    var rest string
+    switch {
+    case strings.HasPrefix(value, sealedPrefix):
+        rest = value[len(sealedPrefix):]
+    case strings.HasPrefix(value, legacySealedPrefix):
+        rest, legacy = value[len(legacySealedPrefix):], true
+    default:
+        return "", "", false, false
+    }
+
+    keyID, data, found := strings.Cut(rest, ":")
+    return keyID, data, legacy, found
+}
+
+// storageAAD is the additional data a row is sealed with:
+// <table>:<id>[:<id>...].
+func storageAAD(table string, rowKey []int64) []byte {
+    aad := []byte(table)
+    for _, id := range rowKey {
+        aad = append(aad, ':')
+        aad = strconv.AppendInt(aad, id, 10)
+    }
+    return aad
+}
+
+// LoadStorageCipher builds the cipher configured in the database section, or
+// returns nil when storage encryption is off. A key file that does not exist
+// yet is generated.
+func LoadStorageCipher(cfg config.DatabaseConfig) (*StorageCipher, error) {
+    key, err := loadStorageKey(cfg.EncryptionKey, cfg.EncryptionKeyPath, true)
+    if err != nil || key == nil {
+        return nil, err
+    }
+
+    previous, err := loadStorageKey(cfg.PreviousEncryptionKey, cfg.PreviousEncryptionKeyPath, false)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load previous storage key: %w", err)
+    }
+
+    return NewStorageCipher(key, previous)
+}
+
+// CheckStorageKeys parses the configured storage keys without generating a
+// missing key file. missing reports that encryption_key_path does not exist
+// yet and would be generated at startup.
+func CheckStorageKeys(cfg config.DatabaseConfig) (missing bool, err error) {
+    if cfg.EncryptionKey == "" && cfg.EncryptionKeyPath != "" {
+        if _, err := os.Stat(cfg.EncryptionKeyPath); os.IsNotExist(err) {
+            missing = true
+        }
+    }
+
+    var key []byte
+    if !missing {
+        if key, err = loadStorageKey(cfg.EncryptionKey, cfg.EncryptionKeyPath, false); err != nil {
+            return false, err
+        }
+    }
+
+    previous, err := loadStorageKey(cfg.PreviousEncryptionKey, cfg.PreviousEncryptionKeyPath, false)
+    if err != nil {
+        return missing, fmt.Errorf("failed to load previous storage key: %w", err)
+    }
+
+    if key != nil {
+        if _, err := NewStorageCipher(key, previous); err != nil {
+            return false, err
+        }
+    } else if previous != nil {
+        if _, err := newStorageKey(previous); err != nil {
+            return missing, fmt.Errorf("invalid previous storage key: %w", err)
+        }
+    }
+
+    return missing, nil
+}
+
+func loadStorageKey(encoded, path string, create bool) ([]byte, error) {
+    if encoded != "" {
+        return decodeStorageKey(encoded)
+    }
+    if path == "" {
+        return nil, nil
+    }
+
+    data, err := os.ReadFile(path)
+    if err == nil {
+        return decodeStorageKey(string(data))
+    }
+    if !os.IsNotExist(err) || !create {
+        return nil, fmt.Errorf("failed to read storage key file: %w", err)
+    }
+
+    key := make([]byte, storageKeySize)
+    if _, err := rand.Read(key); err != nil {
+        return nil, fmt.Errorf("failed to generate storage key: %w", err)
+    }
+
+    file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create storage key file: %w", err)
+    }
+    defer file.Close()
+
+    if _, err := file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n"); err != nil {
+        return nil, fmt.Errorf("failed to write storage key file: %w", err)
+    }
+
+    return key, nil
+}
+
+func decodeStorageKey(encoded string) ([]byte, error) {
+    key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+    if err != nil {
+        return nil, fmt.Errorf("storage key must be base64: %w", err)
+    }
+    return key, nil
+}
+
+// SetStorageCipher makes repositories on this handle, and on the tenant and
+// transaction handles derived from it, seal message content with c.
+func (db *DB) SetStorageCipher(c *StorageCipher) {
+    db.storage = c
+}
+
+func (db *DB) StorageCipher() *StorageCipher {
+    return db.storage
+}
+
+func (db *DB) sealContent(table string, rowKey []int64, plaintext string) (string, error) {
+    if db.storage == nil {
+        return plaintext, nil
+    }
+
+    sealed, err := db.storage.Seal(table, rowKey, plaintext)
+    if err != nil {
+        return "", fmt.Errorf("failed to encrypt %s row: %w", table, err)
+    }
+    return sealed, nil
+}
+
+func (db *DB) openContent(table string, rowKey []int64, value string) (string, error) {
+    return db.storage.Open(table, rowKey, value)
+}
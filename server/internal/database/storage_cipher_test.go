@@ -0,0 +1,158 @@
+package database
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/base64"
+    "io"
+    "strings"
+    "testing"
+)
+
+func testStorageKey(t *testing.T, fill byte) []byte {
+    t.Helper()
+    return bytes.Repeat([]byte{fill}, storageKeySize)
+}
+
+func newTestStorageCipher(t *testing.T, key, previous []byte) *StorageCipher {
+    t.Helper()
+    c, err := NewStorageCipher(key, previous)
+    if err != nil {
+        t.Fatalf("NewStorageCipher: %v", err)
+    }
+    return c
+}
+
+func TestStorageCipherRoundTrip(t *testing.T) {
+    c := newTestStorageCipher(t, testStorageKey(t, 1), nil)
+
+    sealed, err := c.Seal(messagesTable, []int64{42}, "hello")
+    if err != nil {
+        t.Fatalf("Seal: %v", err)
+    }
+    if !strings.HasPrefix(sealed, sealedPrefix+c.KeyID()+":") || strings.Contains(sealed, "hello") {
+        t.Fatalf("sealed value %q is not in the enc2 format", sealed)
+    }
+    if !c.Current(sealed) {
+        t.Fatal("a freshly sealed value is not current")
+    }
+
+    opened, err := c.Open(messagesTable, []int64{42}, sealed)
+    if err != nil {
+        t.Fatalf("Open: %v", err)
+    }
+    if opened != "hello" {
+        t.Fatalf("Open = %q, want %q", opened, "hello")
+    }
+
+    // Rows stored before encryption was enabled are read as they are.
+    if plain, err := c.Open(messagesTable, []int64{42}, "plain text"); err != nil || plain != "plain text" {
+        t.Fatalf("Open(plaintext) = %q, %v", plain, err)
+    }
+}
+
+func TestStorageCipherPreviousKey(t *testing.T) {
+    old := newTestStorageCipher(t, testStorageKey(t, 1), nil)
+    sealed, err := old.Seal(directMessagesTable, []int64{1, 2}, "rotated")
+    if err != nil {
+        t.Fatalf("Seal: %v", err)
+    }
+
+    c := newTestStorageCipher(t, testStorageKey(t, 2), testStorageKey(t, 1))
+    if c.Current(sealed) {
+        t.Fatal("a value sealed with the previous key is reported current")
+    }
+
+    opened, err := c.Open(directMessagesTable, []int64{1, 2}, sealed)
+    if err != nil {
+        t.Fatalf("Open with previous key: %v", err)
+    }
+    if opened != "rotated" {
+        t.Fatalf("Open = %q, want %q", opened, "rotated")
+    }
+}
+
+func TestStorageCipherUnknownKey(t *testing.T) {
+    other := newTestStorageCipher(t, testStorageKey(t, 3), nil)
+    sealed, err := other.Seal(messagesTable, []int64{7}, "secret")
+    if err != nil {
+        t.Fatalf("Seal: %v", err)
+    }
+
+    c := newTestStorageCipher(t, testStorageKey(t, 1), testStorageKey(t, 2))
+    if _, err := c.Open(messagesTable, []int64{7}, sealed); err == nil || !strings.Contains(err.Error(), "unknown storage key") {
+        t.Fatalf("Open with an unknown key ID: err = %v", err)
+    }
+}
+
+func TestStorageCipherNilOnSealedRow(t *testing.T) {
+    sealed, err := newTestStorageCipher(t, testStorageKey(t, 1), nil).Seal(messagesTable, []int64{7}, "secret")
+    if err != nil {
+        t.Fatalf("Seal: %v", err)
+    }
+
+    var c *StorageCipher
+    if _, err := c.Open(messagesTable, []int64{7}, sealed); err == nil {
+        t.Fatal("a nil cipher opened a sealed row")
+    }
+    if plain, err := c.Open(messagesTable, []int64{7}, "plain text"); err != nil || plain != "plain text" {
+        t.Fatalf("nil cipher Open(plaintext) = %q, %v", plain, err)
+    }
+}
+
+func TestStorageCipherBindsTableAndRow(t *testing.T) {
+    c := newTestStorageCipher(t, testStorageKey(t, 1), nil)
+    sealed, err := c.Seal(directMessagesTable, []int64{1, 2}, "private")
+    if err != nil {
+        t.Fatalf("Seal: %v", err)
+    }
+
+    tests := []struct {
+        name   string
+        table  string
+        rowKey []int64
+    }{
+        {name: "other table", table: messagesTable, rowKey: []int64{1, 2}},
+        {name: "other recipient", table: directMessagesTable, rowKey: []int64{1, 3}},
+        {name: "swapped sender and recipient", table: directMessagesTable, rowKey: []int64{2, 1}},
+        {name: "no row key", table: directMessagesTable},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if opened, err := c.Open(tt.table, tt.rowKey, sealed); err == nil {
+                t.Fatalf("Open succeeded: %q", opened)
+            }
+        })
+    }
+}
+
+// TestStorageCipherLegacyRows checks that enc1 values, which bound only the
+// table name, still open and are left for -reencrypt-storage to rewrite.
+func TestStorageCipherLegacyRows(t *testing.T) {
+    key := testStorageKey(t, 1)
+    c := newTestStorageCipher(t, key, nil)
+
+    nonce := make([]byte, c.current.aead.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        t.Fatalf("nonce: %v", err)
+    }
+    raw := c.current.aead.Seal(nonce, nonce, []byte("legacy"), []byte(messagesTable))
+    legacy := legacySealedPrefix + c.KeyID() + ":" + base64.StdEncoding.EncodeToString(raw)
+
+    if c.Current(legacy) {
+        t.Fatal("an enc1 value is reported current")
+    }
+
+    opened, err := c.Open(messagesTable, []int64{42}, legacy)
+    if err != nil {
+        t.Fatalf("Open(enc1): %v", err)
+    }
+    if opened != "legacy" {
+        t.Fatalf("Open = %q, want %q", opened, "legacy")
+    }
+
+    if _, err := c.Open(directMessagesTable, []int64{42}, legacy); err == nil {
+        t.Fatal("an enc1 value opened in another table")
+    }
+}
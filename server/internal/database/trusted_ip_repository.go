@@ -0,0 +1,76 @@
+package database
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type TrustedIPRepository struct {
+    db *DB
+}
+
+func NewTrustedIPRepository(db *DB) *TrustedIPRepository {
+    return &TrustedIPRepository{db: db}
+}
+
+func (r *TrustedIPRepository) Add(userID int64, cidr string, note *string, addedBy *int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO user_trusted_ips (user_id, cidr, note, added_by, created_at)
+        VALUES (?, ?, ?, ?, ?)
+    `
+
+    _, err := r.db.ExecContext(ctx, query, userID, cidr, note, addedBy, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to add trusted address: %w", err)
+    }
+
+    return nil
+}
+
+func (r *TrustedIPRepository) Remove(userID int64, cidr string) (int64, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM user_trusted_ips WHERE user_id = ? AND cidr = ?`
+
+    result, err := r.db.ExecContext(ctx, query, userID, cidr)
+    if err != nil {
+        return 0, fmt.Errorf("failed to remove trusted address: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+func (r *TrustedIPRepository) List(userID int64) ([]*models.TrustedIP, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT trusted_id, user_id, cidr, note, added_by, created_at
+        FROM user_trusted_ips
+        WHERE user_id = ?
+        ORDER BY created_at
+    `
+
+    rows, err := r.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list trusted addresses: %w", err)
+    }
+    defer rows.Close()
+
+    var trusted []*models.TrustedIP
+    for rows.Next() {
+        entry := &models.TrustedIP{}
+        if err := rows.Scan(&entry.TrustedID, &entry.UserID, &entry.CIDR, &entry.Note, &entry.AddedBy, &entry.CreatedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan trusted address: %w", err)
+        }
+        trusted = append(trusted, entry)
+    }
+
+    return trusted, rows.Err()
+}
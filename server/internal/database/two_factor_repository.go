@@ -0,0 +1,114 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type TwoFactorRepository struct {
+    db *DB
+}
+
+func NewTwoFactorRepository(db *DB) *TwoFactorRepository {
+    return &TwoFactorRepository{db: db}
+}
+
+// Get returns the 2FA record for userID, or nil if it has none.
+func (r *TwoFactorRepository) Get(userID int64) (*models.TwoFactor, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT user_id, secret_encrypted, is_enabled, last_used_step, created_at, enabled_at
+        FROM user_2fa
+        WHERE user_id = ?
+    `
+
+    record := &models.TwoFactor{}
+    err := r.db.QueryRowContext(ctx, query, userID).Scan(
+        &record.UserID,
+        &record.SecretEncrypted,
+        &record.IsEnabled,
+        &record.LastUsedStep,
+        &record.CreatedAt,
+        &record.EnabledAt,
+    )
+    if err == sql.ErrNoRows {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get 2FA status: %w", err)
+    }
+
+    return record, nil
+}
+
+// SavePending stores a new, not yet confirmed secret, replacing any earlier
+// pending one.
+func (r *TwoFactorRepository) SavePending(userID int64, secretEncrypted string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO user_2fa (user_id, secret_encrypted, is_enabled, last_used_step, created_at, enabled_at)
+        VALUES (?, ?, FALSE, 0, ?, NULL)
+    ` + r.db.Dialect().OnConflictUpdate("user_id", "secret_encrypted", "is_enabled", "last_used_step", "created_at", "enabled_at")
+
+    if _, err := r.db.ExecContext(ctx, query, userID, secretEncrypted, time.Now()); err != nil {
+        return fmt.Errorf("failed to store 2FA secret: %w", err)
+    }
+
+    return nil
+}
+
+func (r *TwoFactorRepository) Enable(userID, step int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE user_2fa SET is_enabled = TRUE, enabled_at = ?, last_used_step = ? WHERE user_id = ?`
+    if _, err := r.db.ExecContext(ctx, query, time.Now(), step, userID); err != nil {
+        return fmt.Errorf("failed to enable 2FA: %w", err)
+    }
+
+    return nil
+}
+
+// UseStep records that the code for step was accepted. It reports false if
+// that step or a later one was already used, so a code cannot be replayed.
+func (r *TwoFactorRepository) UseStep(userID, step int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE user_2fa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`
+    result, err := r.db.ExecContext(ctx, query, step, userID, step)
+    if err != nil {
+        return false, fmt.Errorf("failed to record 2FA code: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to record 2FA code: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+func (r *TwoFactorRepository) Delete(userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    result, err := r.db.ExecContext(ctx, `DELETE FROM user_2fa WHERE user_id = ?`, userID)
+    if err != nil {
+        return false, fmt.Errorf("failed to disable 2FA: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to disable 2FA: %w", err)
+    }
+
+    return affected > 0, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+    "database/sql"
+    "fmt"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type UserKeyRepository struct {
+    db *DB
+}
+
+func NewUserKeyRepository(db *DB) *UserKeyRepository {
+    return &UserKeyRepository{db: db}
+}
+
+func (r *UserKeyRepository) Get(userID int64) (*models.UserKey, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        SELECT user_id, public_key, fingerprint, created_at, updated_at
+        FROM user_keys
+        WHERE user_id = ?
+    `
+
+    key := &models.UserKey{}
+    err := r.db.QueryRowContext(ctx, query, userID).Scan(
+        &key.UserID,
+        &key.PublicKey,
+        &key.Fingerprint,
+        &key.CreatedAt,
+        &key.UpdatedAt,
+    )
+
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("public key not found: %w", err)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get public key: %w", err)
+    }
+
+    return key, nil
+}
+
+func (r *UserKeyRepository) Save(userID int64, publicKey, fingerprint string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO user_keys (user_id, public_key, fingerprint, updated_at)
+        VALUES (?, ?, ?, ?)
+    ` + r.db.Dialect().OnConflictUpdate("user_id", "public_key", "fingerprint", "updated_at")
+
+    _, err := r.db.ExecContext(ctx, query, userID, publicKey, fingerprint, time.Now())
+    if err != nil {
+        return fmt.Errorf("failed to save public key: %w", err)
+    }
+
+    return nil
+}
+
+func (r *UserKeyRepository) Delete(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `DELETE FROM user_keys WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, userID)
+    if err != nil {
+        return fmt.Errorf("failed to delete public key: %w", err)
+    }
+
+    return nil
+}
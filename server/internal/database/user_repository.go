@@ -21,36 +21,81 @@ func (r *UserRepository) Create(username, passwordHash, passwordSalt string) (*m
     defer cancel()
 
     query := `
-        INSERT INTO users (username, password_hash, password_salt, is_active, is_admin)
-        VALUES (?, ?, ?, TRUE, FALSE)
+        INSERT INTO users (tenant_id, username, password_hash, password_salt, is_active, is_admin)
+        VALUES (?, ?, ?, ?, TRUE, FALSE)
     `
 
-    result, err := r.db.ExecContext(ctx, query, username, passwordHash, passwordSalt)
+    // The security status row is created with the account; lockouts and IP
+    // tracking assume it exists.
+    var userID int64
+    err := r.db.WithTx(func(tx *DB) error {
+        var err error
+        userID, err = tx.InsertContext(ctx, "user_id", query, tx.Tenant(), username, passwordHash, passwordSalt)
+        if err != nil {
+            return fmt.Errorf("failed to create user: %w", err)
+        }
+
+        return NewSecurityRepository(tx).EnsureSecurityStatus(userID)
+    })
     if err != nil {
-        return nil, fmt.Errorf("failed to create user: %w", err)
+        return nil, err
     }
 
-    userID, err := result.LastInsertId()
+    return r.GetByID(userID)
+}
+
+// CreateBot creates a bot account. Bots log in with an API key, so the
+// password columns are left empty and no password can match them.
+func (r *UserRepository) CreateBot(username string) (*models.User, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        INSERT INTO users (tenant_id, username, password_hash, password_salt, is_active, is_admin, is_bot)
+        VALUES (?, ?, '', '', TRUE, FALSE, TRUE)
+    `
+
+    var userID int64
+    err := r.db.WithTx(func(tx *DB) error {
+        var err error
+        userID, err = tx.InsertContext(ctx, "user_id", query, tx.Tenant(), username)
+        if err != nil {
+            return fmt.Errorf("failed to create bot: %w", err)
+        }
+
+        return NewSecurityRepository(tx).EnsureSecurityStatus(userID)
+    })
     if err != nil {
-        return nil, fmt.Errorf("failed to get user ID: %w", err)
+        return nil, err
     }
 
     return r.GetByID(userID)
 }
 
+// ListBots returns every bot account, active or not.
+func (r *UserRepository) ListBots() ([]*models.User, error) {
+    return r.queryUsers(`
+        SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
+               is_active, is_admin, is_bot, last_login_time
+        FROM users
+        WHERE tenant_id = ? AND is_bot = TRUE
+        ORDER BY username
+    `, r.db.Tenant())
+}
+
 func (r *UserRepository) GetByID(userID int64) (*models.User, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
     query := `
         SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
-               is_active, is_admin, last_login_time
+               is_active, is_admin, is_bot, last_login_time
         FROM users
-        WHERE user_id = ?
+        WHERE user_id = ? AND tenant_id = ?
     `
 
     user := &models.User{}
-    err := r.db.QueryRowContext(ctx, query, userID).Scan(
+    err := r.db.QueryRowContext(ctx, query, userID, r.db.Tenant()).Scan(
         &user.UserID,
         &user.Username,
         &user.PasswordHash,
@@ -59,6 +104,7 @@ func (r *UserRepository) GetByID(userID int64) (*models.User, error) {
         &user.UpdatedAt,
         &user.IsActive,
         &user.IsAdmin,
+        &user.IsBot,
         &user.LastLoginTime,
     )
 
@@ -78,13 +124,13 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 
     query := `
         SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
-               is_active, is_admin, last_login_time
+               is_active, is_admin, is_bot, last_login_time
         FROM users
-        WHERE username = ?
+        WHERE username = ? AND tenant_id = ?
     `
 
     user := &models.User{}
-    err := r.db.QueryRowContext(ctx, query, username).Scan(
+    err := r.db.QueryRowContext(ctx, query, username, r.db.Tenant()).Scan(
         &user.UserID,
         &user.Username,
         &user.PasswordHash,
@@ -93,6 +139,7 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
         &user.UpdatedAt,
         &user.IsActive,
         &user.IsAdmin,
+        &user.IsBot,
         &user.LastLoginTime,
     )
 
@@ -110,7 +157,7 @@ func (r *UserRepository) UpdateLastLogin(userID int64) error {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
-    query := `UPDATE users SET last_login_time = ? WHERE user_id = ?`
+    query := `UPDATE users SET last_login_time = ?, idle_notified_at = NULL WHERE user_id = ?`
     _, err := r.db.ExecContext(ctx, query, time.Now(), userID)
     if err != nil {
         return fmt.Errorf("failed to update last login: %w", err)
@@ -151,13 +198,14 @@ func (r *UserRepository) List(limit, offset int) ([]*models.User, error) {
 
     query := `
         SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
-               is_active, is_admin, last_login_time
+               is_active, is_admin, is_bot, last_login_time
         FROM users
+        WHERE tenant_id = ?
         ORDER BY created_at DESC
         LIMIT ? OFFSET ?
     `
 
-    rows, err := r.db.QueryContext(ctx, query, limit, offset)
+    rows, err := r.db.QueryContext(ctx, query, r.db.Tenant(), limit, offset)
     if err != nil {
         return nil, fmt.Errorf("failed to list users: %w", err)
     }
@@ -175,6 +223,7 @@ func (r *UserRepository) List(limit, offset int) ([]*models.User, error) {
             &user.UpdatedAt,
             &user.IsActive,
             &user.IsAdmin,
+            &user.IsBot,
             &user.LastLoginTime,
         )
         if err != nil {
@@ -194,12 +243,266 @@ func (r *UserRepository) UsernameExists(username string) (bool, error) {
     ctx, cancel := contextWithTimeout(defaultTimeout)
     defer cancel()
 
-    query := `SELECT COUNT(*) FROM users WHERE username = ?`
+    query := `SELECT COUNT(*) FROM users WHERE username = ? AND tenant_id = ?`
     var count int
-    err := r.db.QueryRowContext(ctx, query, username).Scan(&count)
+    err := r.db.QueryRowContext(ctx, query, username, r.db.Tenant()).Scan(&count)
     if err != nil {
         return false, fmt.Errorf("failed to check username: %w", err)
     }
 
     return count > 0, nil
 }
+
+func (r *UserRepository) UpdateUsername(userID int64, username string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET username = ? WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, username, userID)
+    if err != nil {
+        return fmt.Errorf("failed to update username: %w", err)
+    }
+
+    return nil
+}
+
+func (r *UserRepository) UpdatePassword(userID int64, passwordHash, passwordSalt string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET password_hash = ?, password_salt = ? WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, passwordHash, passwordSalt, userID)
+    if err != nil {
+        return fmt.Errorf("failed to update password: %w", err)
+    }
+
+    return nil
+}
+
+// SetEmail stores a new, unverified email address; an empty one removes
+// it.
+func (r *UserRepository) SetEmail(userID int64, email string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var value *string
+    if email != "" {
+        value = &email
+    }
+
+    query := `UPDATE users SET email = ?, email_verified = FALSE WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, value, userID)
+    if err != nil {
+        return fmt.Errorf("failed to update email: %w", err)
+    }
+
+    return nil
+}
+
+// GetEmail returns a user's email address, empty if none is set, and
+// whether it has been verified.
+func (r *UserRepository) GetEmail(userID int64) (string, bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    var email *string
+    var verified bool
+    query := `SELECT email, email_verified FROM users WHERE user_id = ? AND tenant_id = ?`
+    err := r.db.QueryRowContext(ctx, query, userID, r.db.Tenant()).Scan(&email, &verified)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to get email: %w", err)
+    }
+
+    if email == nil {
+        return "", false, nil
+    }
+    return *email, verified, nil
+}
+
+// MarkEmailVerified verifies the user's address if it is still email, so
+// a token for an address that has since been replaced does nothing.
+func (r *UserRepository) MarkEmailVerified(userID int64, email string) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET email_verified = TRUE WHERE user_id = ? AND email = ?`
+    result, err := r.db.ExecContext(ctx, query, userID, email)
+    if err != nil {
+        return false, fmt.Errorf("failed to verify email: %w", err)
+    }
+
+    affected, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to verify email: %w", err)
+    }
+
+    return affected > 0, nil
+}
+
+func (r *UserRepository) GetIdleUsers(idleSince time.Time) ([]*models.User, error) {
+    return r.queryUsers(`
+        SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
+               is_active, is_admin, is_bot, last_login_time
+        FROM users
+        WHERE tenant_id = ?
+          AND is_active = TRUE
+          AND is_admin = FALSE
+          AND idle_notified_at IS NULL
+          AND COALESCE(last_login_time, created_at) < ?
+    `, r.db.Tenant(), idleSince)
+}
+
+func (r *UserRepository) GetUsersPendingDeactivation(notifiedBefore time.Time) ([]*models.User, error) {
+    return r.queryUsers(`
+        SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
+               is_active, is_admin, is_bot, last_login_time
+        FROM users
+        WHERE tenant_id = ?
+          AND is_active = TRUE
+          AND is_admin = FALSE
+          AND idle_notified_at IS NOT NULL
+          AND idle_notified_at < ?
+    `, r.db.Tenant(), notifiedBefore)
+}
+
+func (r *UserRepository) queryUsers(query string, args ...interface{}) ([]*models.User, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query users: %w", err)
+    }
+    defer rows.Close()
+
+    var users []*models.User
+    for rows.Next() {
+        user := &models.User{}
+        err := rows.Scan(
+            &user.UserID,
+            &user.Username,
+            &user.PasswordHash,
+            &user.PasswordSalt,
+            &user.CreatedAt,
+            &user.UpdatedAt,
+            &user.IsActive,
+            &user.IsAdmin,
+            &user.IsBot,
+            &user.LastLoginTime,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan user: %w", err)
+        }
+        users = append(users, user)
+    }
+
+    return users, nil
+}
+
+func (r *UserRepository) MarkIdleNotified(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET idle_notified_at = ? WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+    if err != nil {
+        return fmt.Errorf("failed to mark user idle: %w", err)
+    }
+
+    return nil
+}
+
+func (r *UserRepository) DeactivateForInactivity(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET is_active = FALSE, deactivated_for_inactivity = TRUE WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, userID)
+    if err != nil {
+        return fmt.Errorf("failed to deactivate user: %w", err)
+    }
+
+    return nil
+}
+
+func (r *UserRepository) Reactivate(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE users
+        SET is_active = TRUE, deactivated_for_inactivity = FALSE, idle_notified_at = NULL, deleted_at = NULL
+        WHERE user_id = ? AND purged_at IS NULL
+    `
+    _, err := r.db.ExecContext(ctx, query, userID)
+    if err != nil {
+        return fmt.Errorf("failed to reactivate user: %w", err)
+    }
+
+    return nil
+}
+
+// ReactivateAfterBan re-enables an account whose ban has expired, unless it
+// was deleted or deactivated for inactivity in the meantime.
+func (r *UserRepository) ReactivateAfterBan(userID int64) (bool, error) {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `
+        UPDATE users
+        SET is_active = TRUE
+        WHERE user_id = ? AND is_active = FALSE AND deleted_at IS NULL AND deactivated_for_inactivity = FALSE
+    `
+    result, err := r.db.ExecContext(ctx, query, userID)
+    if err != nil {
+        return false, fmt.Errorf("failed to reactivate user: %w", err)
+    }
+
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return false, fmt.Errorf("failed to reactivate user: %w", err)
+    }
+
+    return updated > 0, nil
+}
+
+func (r *UserRepository) MarkDeleted(userID int64) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET is_active = FALSE, deleted_at = ? WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+    if err != nil {
+        return fmt.Errorf("failed to delete user: %w", err)
+    }
+
+    return nil
+}
+
+func (r *UserRepository) GetUsersPendingPurge(deletedBefore time.Time) ([]*models.User, error) {
+    return r.queryUsers(`
+        SELECT user_id, username, password_hash, password_salt, created_at, updated_at,
+               is_active, is_admin, is_bot, last_login_time
+        FROM users
+        WHERE tenant_id = ?
+          AND is_active = FALSE
+          AND deleted_at IS NOT NULL
+          AND deleted_at < ?
+          AND purged_at IS NULL
+    `, r.db.Tenant(), deletedBefore)
+}
+
+// Anonymize replaces the username of a purged account, freeing the old name.
+// Messages the account sent stay attributed to the new name.
+func (r *UserRepository) Anonymize(userID int64, username string) error {
+    ctx, cancel := contextWithTimeout(defaultTimeout)
+    defer cancel()
+
+    query := `UPDATE users SET username = ?, purged_at = ? WHERE user_id = ?`
+    _, err := r.db.ExecContext(ctx, query, username, time.Now(), userID)
+    if err != nil {
+        return fmt.Errorf("failed to anonymize user: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,406 @@
+package events
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    UserRegistered = "user_registered"
+    MessageSent    = "message_sent"
+    MemberJoined   = "member_joined"
+    MemberLeft     = "member_left"
+    BanIssued      = "ban_issued"
+    ChannelRead    = "channel_read"
+)
+
+const rebuildBatchSize = 1000
+
+// settleWindow is longer than an append can take, so no event with a lower
+// ID than one read that long ago can still appear. Applied IDs are
+// remembered for twice as long, until CatchUp no longer reads them.
+const (
+    settleWindow = 20 * time.Second
+    seenWindow   = 2 * settleWindow
+)
+
+type UserRegisteredData struct {
+    Username string `json:"username"`
+}
+
+type MessageSentData struct {
+    MessageID int64 `json:"message_id,omitempty"`
+    Length    int   `json:"length"`
+}
+
+type MemberJoinedData struct {
+    Role string `json:"role"`
+}
+
+type MemberLeftData struct{}
+
+type BanIssuedData struct {
+    AdminID         int64  `json:"admin_id"`
+    Reason          string `json:"reason"`
+    DurationSeconds int    `json:"duration_seconds"`
+}
+
+type Projection interface {
+    Name() string
+    Reset()
+    Apply(event *models.DomainEvent) error
+}
+
+// Snapshotter is a Projection whose state can be saved in a checkpoint, so
+// Rebuild only replays the events after it. Checkpoints are taken only when
+// every projection is one.
+type Snapshotter interface {
+    SaveState() (json.RawMessage, error)
+    LoadState(state json.RawMessage) error
+}
+
+// checkpoint is the saved state of the projections. AppliedAfter lists the
+// events after the checkpoint's ID that are already part of it.
+type checkpoint struct {
+    AppliedAfter []int64                   `json:"applied_after,omitempty"`
+    Projections  map[string]json.RawMessage `json:"projections"`
+}
+
+// Log appends events and applies them to the projections. Events recorded
+// here are applied in ID order as their appends finish; CatchUp applies the
+// ones other cluster nodes append to the shared table.
+type Log struct {
+    eventRepo   *database.EventRepository
+    projections []Projection
+    lastEventID int64
+    appliedMax  int64
+    mu          sync.Mutex
+    saveMu      sync.Mutex
+
+    // Appends run outside mu, so they can finish out of ID order. Each is
+    // given a ticket; a finished event waits in ready until every append
+    // that was already running when it finished, and might have been given
+    // a lower ID, has finished too.
+    tickets  uint64
+    inflight map[uint64]struct{}
+    ready    []readyEvent
+
+    // seen holds the IDs applied recently, so an event is applied once even
+    // if CatchUp reads it before its own Record gets to it, or reads it
+    // again. reads are the highest IDs CatchUp has read, and when.
+    seen      map[int64]struct{}
+    seenOrder []seenEvent
+    reads     []seenEvent
+}
+
+type readyEvent struct {
+    event *models.DomainEvent
+    after uint64
+}
+
+type seenEvent struct {
+    id int64
+    at time.Time
+}
+
+func NewLog(eventRepo *database.EventRepository, projections ...Projection) *Log {
+    return &Log{
+        eventRepo:   eventRepo,
+        projections: projections,
+        inflight:    make(map[uint64]struct{}),
+        seen:        make(map[int64]struct{}),
+    }
+}
+
+func (l *Log) Record(eventType string, userID, channelID *int64, data interface{}) error {
+    if l == nil {
+        return nil
+    }
+
+    payload, err := json.Marshal(data)
+    if err != nil {
+        return fmt.Errorf("failed to encode event: %w", err)
+    }
+
+    l.mu.Lock()
+    l.tickets++
+    ticket := l.tickets
+    l.inflight[ticket] = struct{}{}
+    l.mu.Unlock()
+
+    event, err := l.eventRepo.Append(eventType, userID, channelID, string(payload))
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    delete(l.inflight, ticket)
+    if err == nil {
+        l.addReady(readyEvent{event: event, after: l.tickets})
+    }
+    l.applyReady()
+
+    return err
+}
+
+// addReady inserts a finished event into ready, which is kept in ID order.
+func (l *Log) addReady(r readyEvent) {
+    i := sort.Search(len(l.ready), func(i int) bool {
+        return l.ready[i].event.EventID > r.event.EventID
+    })
+    l.ready = append(l.ready, readyEvent{})
+    copy(l.ready[i+1:], l.ready[i:])
+    l.ready[i] = r
+}
+
+// applyReady applies finished events from the lowest ID up, stopping at the
+// first that an append still running could yet come before.
+func (l *Log) applyReady() {
+    for len(l.ready) > 0 {
+        next := l.ready[0]
+        for ticket := range l.inflight {
+            if ticket <= next.after {
+                return
+            }
+        }
+
+        l.ready[0] = readyEvent{}
+        l.ready = l.ready[1:]
+        if _, applied := l.seen[next.event.EventID]; !applied {
+            l.apply(next.event)
+            l.markSeen(next.event.EventID)
+        }
+    }
+}
+
+// markSeen records an applied ID and forgets those applied more than
+// seenWindow ago.
+func (l *Log) markSeen(id int64) {
+    now := time.Now()
+    for len(l.seenOrder) > 0 && now.Sub(l.seenOrder[0].at) > seenWindow {
+        delete(l.seen, l.seenOrder[0].id)
+        l.seenOrder = l.seenOrder[1:]
+    }
+
+    l.seen[id] = struct{}{}
+    l.seenOrder = append(l.seenOrder, seenEvent{id: id, at: now})
+}
+
+// Rebuild resets the projections to the saved checkpoint, or to nothing if
+// there is none, and replays the events after it.
+func (l *Log) Rebuild() (int, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.seen = make(map[int64]struct{})
+    l.seenOrder = nil
+    l.reads = nil
+
+    if err := l.restore(); err != nil {
+        log.Printf("Replaying the whole event log: %v", err)
+        for _, projection := range l.projections {
+            projection.Reset()
+        }
+        l.lastEventID = 0
+        l.seen = make(map[int64]struct{})
+        l.seenOrder = nil
+    }
+    l.appliedMax = l.lastEventID
+
+    replayed := 0
+    for {
+        batch, err := l.eventRepo.ListSince(l.lastEventID, rebuildBatchSize)
+        if err != nil {
+            return replayed, fmt.Errorf("failed to replay events: %w", err)
+        }
+
+        for _, event := range batch {
+            l.lastEventID = event.EventID
+            if _, ok := l.seen[event.EventID]; ok {
+                continue
+            }
+            l.apply(event)
+            replayed++
+        }
+
+        if len(batch) < rebuildBatchSize {
+            return replayed, nil
+        }
+    }
+}
+
+// restore loads the saved checkpoint into the projections. With none saved
+// it resets them and starts from the first event.
+func (l *Log) restore() error {
+    lastEventID, data, err := l.eventRepo.GetCheckpoint()
+    if err != nil {
+        return err
+    }
+
+    if data == "" {
+        for _, projection := range l.projections {
+            projection.Reset()
+        }
+        l.lastEventID = 0
+        return nil
+    }
+
+    var saved checkpoint
+    if err := json.Unmarshal([]byte(data), &saved); err != nil {
+        return fmt.Errorf("failed to decode event checkpoint: %w", err)
+    }
+
+    for _, projection := range l.projections {
+        snapshotter, ok := projection.(Snapshotter)
+        state, found := saved.Projections[projection.Name()]
+        if !ok || !found {
+            return fmt.Errorf("event checkpoint has no state for projection %s", projection.Name())
+        }
+        if err := snapshotter.LoadState(state); err != nil {
+            return fmt.Errorf("failed to restore projection %s: %w", projection.Name(), err)
+        }
+    }
+
+    l.lastEventID = lastEventID
+    for _, id := range saved.AppliedAfter {
+        l.markSeen(id)
+    }
+    log.Printf("Restored event projections from the checkpoint at event %d", lastEventID)
+    return nil
+}
+
+// Checkpoint saves the state of the projections, so the next Rebuild
+// starts from here instead of the first event.
+func (l *Log) Checkpoint() error {
+    if l == nil {
+        return nil
+    }
+
+    l.saveMu.Lock()
+    defer l.saveMu.Unlock()
+
+    lastEventID, data, err := l.snapshot()
+    if err != nil || data == nil {
+        return err
+    }
+
+    return l.eventRepo.SaveCheckpoint(lastEventID, string(data))
+}
+
+// snapshot captures the projections and the ID they are complete up to. It
+// returns no data while that cannot be told.
+func (l *Log) snapshot() (int64, []byte, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    saved := checkpoint{Projections: make(map[string]json.RawMessage, len(l.projections))}
+    for _, projection := range l.projections {
+        snapshotter, ok := projection.(Snapshotter)
+        if !ok {
+            return 0, nil, nil
+        }
+        state, err := snapshotter.SaveState()
+        if err != nil {
+            return 0, nil, fmt.Errorf("failed to save projection %s: %w", projection.Name(), err)
+        }
+        saved.Projections[projection.Name()] = state
+    }
+
+    lastEventID := l.lastEventID
+    if l.reads == nil {
+        // Without CatchUp every event is recorded here, so once none is
+        // still on its way every event up to the highest is applied.
+        if len(l.inflight) > 0 || len(l.ready) > 0 {
+            return 0, nil, nil
+        }
+        if l.appliedMax > lastEventID {
+            lastEventID = l.appliedMax
+        }
+    } else {
+        // CatchUp has applied every event up to lastEventID; the ones
+        // after it that are applied are all recent enough to be in seen.
+        for id := range l.seen {
+            if id > lastEventID {
+                saved.AppliedAfter = append(saved.AppliedAfter, id)
+            }
+        }
+        sort.Slice(saved.AppliedAfter, func(i, j int) bool { return saved.AppliedAfter[i] < saved.AppliedAfter[j] })
+    }
+
+    data, err := json.Marshal(saved)
+    if err != nil {
+        return 0, nil, fmt.Errorf("failed to encode event checkpoint: %w", err)
+    }
+    return lastEventID, data, nil
+}
+
+// CatchUp applies the events appended by other cluster nodes sharing the
+// database, and any of this node's it reads before their Record applies
+// them, and returns how many there were. An append that finishes after one
+// with a higher ID would be skipped by a plain cursor, so each read starts
+// from the highest ID read settleWindow earlier and passes over the events
+// already applied.
+func (l *Log) CatchUp() (int, error) {
+    if l == nil {
+        return 0, nil
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    for len(l.reads) > 0 && now.Sub(l.reads[0].at) > settleWindow {
+        l.lastEventID = l.reads[0].id
+        l.reads = l.reads[1:]
+    }
+
+    applied := 0
+    afterID := l.lastEventID
+    for {
+        batch, err := l.eventRepo.ListSince(afterID, rebuildBatchSize)
+        if err != nil {
+            return applied, fmt.Errorf("failed to read new events: %w", err)
+        }
+
+        for _, event := range batch {
+            afterID = event.EventID
+            if _, ok := l.seen[event.EventID]; ok {
+                continue
+            }
+            l.apply(event)
+            l.markSeen(event.EventID)
+            applied++
+        }
+
+        if len(batch) < rebuildBatchSize {
+            break
+        }
+    }
+
+    l.reads = append(l.reads, seenEvent{id: afterID, at: now})
+    return applied, nil
+}
+
+func (l *Log) apply(event *models.DomainEvent) {
+    for _, projection := range l.projections {
+        if err := projection.Apply(event); err != nil {
+            log.Printf("Projection %s failed to apply event %d: %v", projection.Name(), event.EventID, err)
+        }
+    }
+    if event.EventID > l.appliedMax {
+        l.appliedMax = event.EventID
+    }
+}
+
+func Decode(event *models.DomainEvent, v interface{}) error {
+    if err := json.Unmarshal([]byte(event.Payload), v); err != nil {
+        return fmt.Errorf("failed to decode %s event %d: %w", event.EventType, event.EventID, err)
+    }
+    return nil
+}
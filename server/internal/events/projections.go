@@ -0,0 +1,231 @@
+package events
+
+import (
+    "encoding/json"
+    "sync"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+type StatsProjection struct {
+    usersRegistered int64
+    messagesSent    int64
+    memberJoins     int64
+    bansIssued      int64
+    channelMessages map[int64]int64
+    mu              sync.RWMutex
+}
+
+func NewStatsProjection() *StatsProjection {
+    return &StatsProjection{
+        channelMessages: make(map[int64]int64),
+    }
+}
+
+func (p *StatsProjection) Name() string {
+    return "stats"
+}
+
+func (p *StatsProjection) Reset() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    p.usersRegistered = 0
+    p.messagesSent = 0
+    p.memberJoins = 0
+    p.bansIssued = 0
+    p.channelMessages = make(map[int64]int64)
+}
+
+func (p *StatsProjection) Apply(event *models.DomainEvent) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    switch event.EventType {
+    case UserRegistered:
+        p.usersRegistered++
+    case MessageSent:
+        p.messagesSent++
+        if event.ChannelID != nil {
+            p.channelMessages[*event.ChannelID]++
+        }
+    case MemberJoined:
+        p.memberJoins++
+    case BanIssued:
+        p.bansIssued++
+    }
+
+    return nil
+}
+
+func (p *StatsProjection) Snapshot() map[string]int64 {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    return map[string]int64{
+        "users_registered": p.usersRegistered,
+        "messages_sent":    p.messagesSent,
+        "member_joins":     p.memberJoins,
+        "bans_issued":      p.bansIssued,
+    }
+}
+
+type statsState struct {
+    UsersRegistered int64           `json:"users_registered"`
+    MessagesSent    int64           `json:"messages_sent"`
+    MemberJoins     int64           `json:"member_joins"`
+    BansIssued      int64           `json:"bans_issued"`
+    ChannelMessages map[int64]int64 `json:"channel_messages"`
+}
+
+func (p *StatsProjection) SaveState() (json.RawMessage, error) {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    return json.Marshal(statsState{
+        UsersRegistered: p.usersRegistered,
+        MessagesSent:    p.messagesSent,
+        MemberJoins:     p.memberJoins,
+        BansIssued:      p.bansIssued,
+        ChannelMessages: p.channelMessages,
+    })
+}
+
+func (p *StatsProjection) LoadState(data json.RawMessage) error {
+    var state statsState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return err
+    }
+    if state.ChannelMessages == nil {
+        state.ChannelMessages = make(map[int64]int64)
+    }
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    p.usersRegistered = state.UsersRegistered
+    p.messagesSent = state.MessagesSent
+    p.memberJoins = state.MemberJoins
+    p.bansIssued = state.BansIssued
+    p.channelMessages = state.ChannelMessages
+    return nil
+}
+
+func (p *StatsProjection) ChannelMessageCount(channelID int64) int64 {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    return p.channelMessages[channelID]
+}
+
+type UnreadProjection struct {
+    members map[int64]map[int64]bool
+    unread  map[int64]map[int64]int
+    mu      sync.RWMutex
+}
+
+func NewUnreadProjection() *UnreadProjection {
+    return &UnreadProjection{
+        members: make(map[int64]map[int64]bool),
+        unread:  make(map[int64]map[int64]int),
+    }
+}
+
+func (p *UnreadProjection) Name() string {
+    return "unread"
+}
+
+func (p *UnreadProjection) Reset() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    p.members = make(map[int64]map[int64]bool)
+    p.unread = make(map[int64]map[int64]int)
+}
+
+func (p *UnreadProjection) Apply(event *models.DomainEvent) error {
+    if event.UserID == nil || event.ChannelID == nil {
+        return nil
+    }
+
+    userID := *event.UserID
+    channelID := *event.ChannelID
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    switch event.EventType {
+    case MemberJoined:
+        if p.members[channelID] == nil {
+            p.members[channelID] = make(map[int64]bool)
+        }
+        p.members[channelID][userID] = true
+    case MemberLeft:
+        delete(p.members[channelID], userID)
+        if counts := p.unread[userID]; counts != nil {
+            delete(counts, channelID)
+        }
+    case ChannelRead:
+        if counts := p.unread[userID]; counts != nil {
+            delete(counts, channelID)
+        }
+    case MessageSent:
+        for memberID := range p.members[channelID] {
+            if memberID == userID {
+                continue
+            }
+            if p.unread[memberID] == nil {
+                p.unread[memberID] = make(map[int64]int)
+            }
+            p.unread[memberID][channelID]++
+        }
+        if counts := p.unread[userID]; counts != nil {
+            delete(counts, channelID)
+        }
+    }
+
+    return nil
+}
+
+func (p *UnreadProjection) Unread(userID int64) map[int64]int {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    counts := make(map[int64]int, len(p.unread[userID]))
+    for channelID, count := range p.unread[userID] {
+        counts[channelID] = count
+    }
+    return counts
+}
+
+type unreadState struct {
+    Members map[int64]map[int64]bool `json:"members"`
+    Unread  map[int64]map[int64]int  `json:"unread"`
+}
+
+func (p *UnreadProjection) SaveState() (json.RawMessage, error) {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+
+    return json.Marshal(unreadState{Members: p.members, Unread: p.unread})
+}
+
+func (p *UnreadProjection) LoadState(data json.RawMessage) error {
+    var state unreadState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return err
+    }
+    if state.Members == nil {
+        state.Members = make(map[int64]map[int64]bool)
+    }
+    if state.Unread == nil {
+        state.Unread = make(map[int64]map[int64]int)
+    }
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    p.members = state.Members
+    p.unread = state.Unread
+    return nil
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+    "encoding/json"
+    "io"
+    "time"
+)
+
+// Account is a user's own data: profile, memberships, the channel messages
+// they sent, direct message metadata and login history.
+type Account struct {
+    Username       string               `json:"username"`
+    CreatedAt      time.Time            `json:"created_at"`
+    LastLoginTime  *time.Time           `json:"last_login_time,omitempty"`
+    GeneratedAt    time.Time            `json:"generated_at"`
+    Channels       []AccountChannel     `json:"channels"`
+    Messages       []AccountMessage     `json:"messages"`
+    DirectMessages []AccountDirectEntry `json:"direct_messages"`
+    Logins         []AccountLogin       `json:"logins"`
+}
+
+type AccountChannel struct {
+    Channel string `json:"channel"`
+    Role    string `json:"role"`
+}
+
+type AccountMessage struct {
+    MessageID int64     `json:"message_id"`
+    Channel   string    `json:"channel"`
+    Content   string    `json:"content"`
+    SentAt    time.Time `json:"sent_at"`
+}
+
+// AccountDirectEntry describes one direct message. The server only keeps a
+// hash of direct message content, so that is all the export can carry.
+type AccountDirectEntry struct {
+    Direction string    `json:"direction"`
+    Peer      string    `json:"peer"`
+    Hash      string    `json:"hash,omitempty"`
+    SentAt    time.Time `json:"sent_at"`
+    Read      bool      `json:"read"`
+}
+
+type AccountLogin struct {
+    IPAddress  string    `json:"ip_address"`
+    Timestamp  time.Time `json:"timestamp"`
+    Successful bool      `json:"successful"`
+}
+
+func WriteAccount(w io.Writer, a *Account) error {
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(a)
+}
+
+func (s *Store) SaveAccount(a *Account) (string, error) {
+    return s.create(FileExtension(FormatJSON), func(w io.Writer) error {
+        return WriteAccount(w, a)
+    })
+}
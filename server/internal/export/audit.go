@@ -0,0 +1,79 @@
+package export
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+const FormatCSV = "csv"
+
+func ParseAuditFormat(format string) (string, error) {
+    switch strings.ToLower(format) {
+    case "json":
+        return FormatJSON, nil
+    case "csv":
+        return FormatCSV, nil
+    default:
+        return "", fmt.Errorf("unsupported audit export format: %s (use csv or json)", format)
+    }
+}
+
+// WriteAudit writes admin action log entries for compliance review.
+func WriteAudit(w io.Writer, entries []*models.AdminActionLog, format string) error {
+    switch format {
+    case FormatJSON:
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(map[string]interface{}{
+            "generated_at": time.Now(),
+            "entries":      entries,
+        })
+    case FormatCSV:
+        writer := csv.NewWriter(w)
+        writer.Write([]string{"log_id", "performed_at", "admin_id", "admin", "action", "target_user_id", "target", "target_channel_id", "details"})
+        for _, entry := range entries {
+            writer.Write([]string{
+                strconv.FormatInt(entry.LogID, 10),
+                entry.PerformedAt.Format(time.RFC3339),
+                strconv.FormatInt(entry.AdminID, 10),
+                entry.AdminUsername,
+                entry.ActionType,
+                optionalID(entry.TargetUserID),
+                optionalString(entry.TargetUsername),
+                optionalID(entry.TargetChannelID),
+                optionalString(entry.ActionDetails),
+            })
+        }
+        writer.Flush()
+        return writer.Error()
+    default:
+        return fmt.Errorf("unsupported audit export format: %s", format)
+    }
+}
+
+func (s *Store) SaveAudit(entries []*models.AdminActionLog, format string) (string, error) {
+    return s.create("."+format, func(w io.Writer) error {
+        return WriteAudit(w, entries, format)
+    })
+}
+
+func optionalID(id *int64) string {
+    if id == nil {
+        return ""
+    }
+    return strconv.FormatInt(*id, 10)
+}
+
+func optionalString(value *string) string {
+    if value == nil {
+        return ""
+    }
+    return *value
+}
@@ -0,0 +1,257 @@
+package export
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+)
+
+const (
+    FormatJSON = "json"
+    FormatText = "text"
+)
+
+type Entry struct {
+    MessageID int64     `json:"message_id"`
+    Seq       int64     `json:"seq,omitempty"`
+    Username  string    `json:"username"`
+    Content   string    `json:"content"`
+    SentAt    time.Time `json:"sent_at"`
+    Signature string    `json:"signature,omitempty"`
+}
+
+type Transcript struct {
+    Channel     string    `json:"channel"`
+    From        time.Time `json:"from"`
+    To          time.Time `json:"to"`
+    GeneratedAt time.Time `json:"generated_at"`
+    SigningKey  string    `json:"signing_key,omitempty"`
+    Messages    []Entry   `json:"messages"`
+}
+
+type VerifyReport struct {
+    Verified int
+    Unsigned int
+    Failed   []int64
+}
+
+// Verify checks every signed entry of a JSON transcript against key, or
+// against the key recorded in the transcript when key is empty.
+func Verify(r io.Reader, key string) (*VerifyReport, error) {
+    var t Transcript
+    if err := json.NewDecoder(r).Decode(&t); err != nil {
+        return nil, fmt.Errorf("failed to read transcript: %w", err)
+    }
+
+    if key == "" {
+        key = t.SigningKey
+    }
+    if key == "" {
+        return nil, fmt.Errorf("transcript has no signing key; pass the server's key")
+    }
+
+    report := &VerifyReport{}
+    for _, entry := range t.Messages {
+        if entry.Signature == "" {
+            report.Unsigned++
+            continue
+        }
+
+        stamp := auth.Stamp{
+            MsgID:       strconv.FormatInt(entry.Seq, 10),
+            Channel:     t.Channel,
+            Author:      entry.Username,
+            Timestamp:   entry.SentAt,
+            ContentHash: auth.HashMessage(entry.Content),
+        }
+        if err := auth.VerifyStamp(key, stamp, entry.Signature); err != nil {
+            report.Failed = append(report.Failed, entry.Seq)
+            continue
+        }
+        report.Verified++
+    }
+
+    return report, nil
+}
+
+func ParseFormat(format string) (string, error) {
+    switch strings.ToLower(format) {
+    case "json":
+        return FormatJSON, nil
+    case "text", "txt", "log":
+        return FormatText, nil
+    default:
+        return "", fmt.Errorf("unsupported export format: %s (use json or text)", format)
+    }
+}
+
+func Write(w io.Writer, t *Transcript, format string) error {
+    switch format {
+    case FormatJSON:
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(t)
+    case FormatText:
+        if _, err := fmt.Fprintf(w, "# Transcript of %s (%s - %s)\n",
+            t.Channel, t.From.Format(time.RFC3339), t.To.Format(time.RFC3339)); err != nil {
+            return err
+        }
+        for _, entry := range t.Messages {
+            if _, err := fmt.Fprintf(w, "[%s] <%s> %s\n",
+                entry.SentAt.Format("2006-01-02 15:04:05"), entry.Username, entry.Content); err != nil {
+                return err
+            }
+        }
+        return nil
+    default:
+        return fmt.Errorf("unsupported export format: %s", format)
+    }
+}
+
+func FileExtension(format string) string {
+    if format == FormatJSON {
+        return ".json"
+    }
+    return ".log"
+}
+
+type Store struct {
+    directory string
+    retention time.Duration
+}
+
+func NewStore(directory string, retention time.Duration) *Store {
+    if directory == "" {
+        directory = "exports"
+    }
+
+    return &Store{
+        directory: directory,
+        retention: retention,
+    }
+}
+
+func (s *Store) Save(t *Transcript, format string) (string, error) {
+    return s.create(FileExtension(format), func(w io.Writer) error {
+        return Write(w, t, format)
+    })
+}
+
+func (s *Store) create(extension string, write func(w io.Writer) error) (string, error) {
+    if err := os.MkdirAll(s.directory, 0700); err != nil {
+        return "", fmt.Errorf("failed to create export directory: %w", err)
+    }
+
+    token := make([]byte, 16)
+    if _, err := rand.Read(token); err != nil {
+        return "", fmt.Errorf("failed to generate export name: %w", err)
+    }
+
+    name := hex.EncodeToString(token) + extension
+
+    file, err := os.OpenFile(filepath.Join(s.directory, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil {
+        return "", fmt.Errorf("failed to create export file: %w", err)
+    }
+    defer file.Close()
+
+    if err := write(file); err != nil {
+        return "", fmt.Errorf("failed to write export: %w", err)
+    }
+
+    return name, nil
+}
+
+func (s *Store) Path(name string) (string, error) {
+    if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+        return "", fmt.Errorf("invalid export name")
+    }
+
+    path := filepath.Join(s.directory, name)
+    info, err := os.Stat(path)
+    if err != nil {
+        return "", fmt.Errorf("export not found")
+    }
+
+    if s.retention > 0 && time.Since(info.ModTime()) > s.retention {
+        return "", fmt.Errorf("export expired")
+    }
+
+    return path, nil
+}
+
+func (s *Store) Prune() (int, error) {
+    if s.retention <= 0 {
+        return 0, nil
+    }
+
+    entries, err := os.ReadDir(s.directory)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return 0, nil
+        }
+        return 0, fmt.Errorf("failed to read export directory: %w", err)
+    }
+
+    removed := 0
+    for _, entry := range entries {
+        info, err := entry.Info()
+        if err != nil || entry.IsDir() {
+            continue
+        }
+        if time.Since(info.ModTime()) > s.retention {
+            if err := os.Remove(filepath.Join(s.directory, entry.Name())); err == nil {
+                removed++
+            }
+        }
+    }
+
+    return removed, nil
+}
+
+func ParseTime(value string) (time.Time, error) {
+    layouts := []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+    for _, layout := range layouts {
+        if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+            return t, nil
+        }
+    }
+
+    return time.Time{}, fmt.Errorf("invalid time: %s (use RFC3339 or YYYY-MM-DD)", value)
+}
+
+func ParseRange(fromStr, toStr string) (time.Time, time.Time, error) {
+    from := time.Unix(0, 0)
+    to := time.Now()
+
+    if fromStr != "" {
+        t, err := ParseTime(fromStr)
+        if err != nil {
+            return from, to, err
+        }
+        from = t
+    }
+
+    if toStr != "" {
+        t, err := ParseTime(toStr)
+        if err != nil {
+            return from, to, err
+        }
+        to = t
+    }
+
+    if to.Before(from) {
+        return from, to, fmt.Errorf("end of range is before start")
+    }
+
+    return from, to, nil
+}
@@ -0,0 +1,81 @@
+package importer
+
+import (
+    "fmt"
+    "io"
+    "strings"
+)
+
+type User struct {
+    Username string `json:"username"`
+    Email    string `json:"email,omitempty"`
+    IsAdmin  bool   `json:"is_admin,omitempty"`
+}
+
+type Member struct {
+    Username string `json:"username"`
+    Role     string `json:"role"`
+}
+
+type Channel struct {
+    Name    string   `json:"name"`
+    Founder string   `json:"founder"`
+    Topic   string   `json:"topic,omitempty"`
+    Private bool     `json:"private,omitempty"`
+    Members []Member `json:"members,omitempty"`
+}
+
+type Dataset struct {
+    Users    []User    `json:"users"`
+    Channels []Channel `json:"channels"`
+}
+
+func Parse(format string, r io.Reader) (*Dataset, error) {
+    switch strings.ToLower(format) {
+    case "atheme":
+        return ParseAtheme(r)
+    case "anope":
+        return ParseAnope(r)
+    case "csv":
+        return ParseCSV(r)
+    case "json":
+        return ParseJSON(r)
+    default:
+        return nil, fmt.Errorf("unsupported import format: %s (use atheme, anope, csv or json)", format)
+    }
+}
+
+func (d *Dataset) channel(name string) *Channel {
+    for i := range d.Channels {
+        if strings.EqualFold(d.Channels[i].Name, name) {
+            return &d.Channels[i]
+        }
+    }
+
+    d.Channels = append(d.Channels, Channel{Name: name})
+    return &d.Channels[len(d.Channels)-1]
+}
+
+func (c *Channel) addMember(username, role string) {
+    for i := range c.Members {
+        if strings.EqualFold(c.Members[i].Username, username) {
+            if rolePriority(role) > rolePriority(c.Members[i].Role) {
+                c.Members[i].Role = role
+            }
+            return
+        }
+    }
+
+    c.Members = append(c.Members, Member{Username: username, Role: role})
+}
+
+func rolePriority(role string) int {
+    switch role {
+    case "owner":
+        return 2
+    case "moderator":
+        return 1
+    default:
+        return 0
+    }
+}
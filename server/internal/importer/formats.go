@@ -0,0 +1,239 @@
+package importer
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// ParseAtheme reads an Atheme flatfile database (services.db). Only accounts
+// (MU), channel registrations (MC), channel access (CA) and stored topics are
+// used; password hashes are not portable and are discarded.
+func ParseAtheme(r io.Reader) (*Dataset, error) {
+    dataset := &Dataset{}
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 {
+            continue
+        }
+
+        switch fields[0] {
+        case "MU":
+            // MU <id> <name> <pass> <email> <registered> <lastlogin> <flags> <language>
+            if len(fields) < 5 {
+                continue
+            }
+            dataset.Users = append(dataset.Users, User{Username: fields[2], Email: fields[4]})
+        case "SO":
+            // SO <account> <operclass> <flags>
+            if len(fields) < 2 {
+                continue
+            }
+            for i := range dataset.Users {
+                if strings.EqualFold(dataset.Users[i].Username, fields[1]) {
+                    dataset.Users[i].IsAdmin = true
+                }
+            }
+        case "MC":
+            // MC <name> <registered> <used> <flags> ...
+            if len(fields) < 2 {
+                continue
+            }
+            channel := dataset.channel(fields[1])
+            if len(fields) > 4 && strings.Contains(fields[4], "+p") {
+                channel.Private = true
+            }
+        case "CA":
+            // CA <channel> <account> <flags> <ts> <setter>
+            if len(fields) < 4 {
+                continue
+            }
+            channel := dataset.channel(fields[1])
+            role := athemeRole(fields[3])
+            if role == "owner" && channel.Founder == "" {
+                channel.Founder = fields[2]
+            }
+            if role != "" {
+                channel.addMember(fields[2], role)
+            }
+        case "MDC":
+            // MDC <channel> private:topic:text <topic...>
+            if len(fields) < 4 || fields[2] != "private:topic:text" {
+                continue
+            }
+            dataset.channel(fields[1]).Topic = strings.Join(fields[3:], " ")
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read atheme database: %w", err)
+    }
+
+    return dataset, nil
+}
+
+func athemeRole(flags string) string {
+    flags = strings.TrimPrefix(flags, "+")
+    switch {
+    case strings.ContainsRune(flags, 'F'):
+        return "owner"
+    case strings.ContainsRune(flags, 'o') || strings.ContainsRune(flags, 'O'):
+        return "moderator"
+    case strings.ContainsRune(flags, 'A') || strings.ContainsRune(flags, 'V') || strings.ContainsRune(flags, 'v'):
+        return "member"
+    default:
+        return ""
+    }
+}
+
+// ParseAnope reads an Anope db_flatfile database (anope.db) made of
+// OBJECT/DATA/END blocks.
+func ParseAnope(r io.Reader) (*Dataset, error) {
+    dataset := &Dataset{}
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+    objectType := ""
+    data := map[string]string{}
+
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+
+        switch {
+        case strings.HasPrefix(line, "OBJECT "):
+            objectType = strings.TrimPrefix(line, "OBJECT ")
+            data = map[string]string{}
+        case strings.HasPrefix(line, "DATA "):
+            parts := strings.SplitN(strings.TrimPrefix(line, "DATA "), " ", 2)
+            if len(parts) == 2 {
+                data[parts[0]] = parts[1]
+            } else {
+                data[parts[0]] = ""
+            }
+        case line == "END":
+            anopeObject(dataset, objectType, data)
+            objectType = ""
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read anope database: %w", err)
+    }
+
+    return dataset, nil
+}
+
+func anopeObject(dataset *Dataset, objectType string, data map[string]string) {
+    switch objectType {
+    case "NickCore":
+        if data["display"] == "" {
+            return
+        }
+        dataset.Users = append(dataset.Users, User{Username: data["display"], Email: data["email"]})
+    case "ChannelInfo":
+        if data["name"] == "" {
+            return
+        }
+        channel := dataset.channel(data["name"])
+        channel.Founder = data["founder"]
+        channel.Topic = data["last_topic"]
+        if channel.Founder != "" {
+            channel.addMember(channel.Founder, "owner")
+        }
+    case "ChanAccess":
+        if data["ci"] == "" || data["mask"] == "" {
+            return
+        }
+        role := "member"
+        if level := data["data"]; level == "QOP" || level == "SOP" || level == "AOP" {
+            role = "moderator"
+        }
+        dataset.channel(data["ci"]).addMember(data["mask"], role)
+    case "Oper":
+        for i := range dataset.Users {
+            if strings.EqualFold(dataset.Users[i].Username, data["name"]) {
+                dataset.Users[i].IsAdmin = true
+            }
+        }
+    }
+}
+
+// ParseCSV reads the generic CSV format, one record per row:
+//
+//   user,<username>[,admin]
+//   channel,<#name>,<founder>[,<topic>]
+//   member,<#name>,<username>[,<role>]
+func ParseCSV(r io.Reader) (*Dataset, error) {
+    dataset := &Dataset{}
+
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.Comment = '#'
+
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read csv: %w", err)
+    }
+
+    for i, record := range records {
+        if len(record) < 2 {
+            return nil, fmt.Errorf("csv line %d: expected at least 2 fields", i+1)
+        }
+
+        switch strings.ToLower(strings.TrimSpace(record[0])) {
+        case "user":
+            user := User{Username: strings.TrimSpace(record[1])}
+            if len(record) > 2 && strings.EqualFold(strings.TrimSpace(record[2]), "admin") {
+                user.IsAdmin = true
+            }
+            dataset.Users = append(dataset.Users, user)
+        case "channel":
+            if len(record) < 3 {
+                return nil, fmt.Errorf("csv line %d: channel requires a founder", i+1)
+            }
+            channel := dataset.channel(strings.TrimSpace(record[1]))
+            channel.Founder = strings.TrimSpace(record[2])
+            channel.addMember(channel.Founder, "owner")
+            if len(record) > 3 {
+                channel.Topic = record[3]
+            }
+        case "member":
+            if len(record) < 3 {
+                return nil, fmt.Errorf("csv line %d: member requires a username", i+1)
+            }
+            role := "member"
+            if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+                role = strings.ToLower(strings.TrimSpace(record[3]))
+            }
+            dataset.channel(strings.TrimSpace(record[1])).addMember(strings.TrimSpace(record[2]), role)
+        case "kind", "type":
+            continue
+        default:
+            return nil, fmt.Errorf("csv line %d: unknown record type %q", i+1, record[0])
+        }
+    }
+
+    return dataset, nil
+}
+
+func ParseJSON(r io.Reader) (*Dataset, error) {
+    dataset := &Dataset{}
+    if err := json.NewDecoder(r).Decode(dataset); err != nil {
+        return nil, fmt.Errorf("failed to parse json: %w", err)
+    }
+
+    for i := range dataset.Channels {
+        channel := &dataset.Channels[i]
+        if channel.Founder != "" {
+            channel.addMember(channel.Founder, "owner")
+        }
+    }
+
+    return dataset, nil
+}
@@ -0,0 +1,237 @@
+package importer
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+)
+
+type ResetToken struct {
+    Username string
+    Token    string
+}
+
+type Result struct {
+    UsersCreated    int
+    UsersSkipped    int
+    ChannelsCreated int
+    ChannelsSkipped int
+    MembersAdded    int
+    ResetTokens     []ResetToken
+}
+
+type Importer struct {
+    authService *auth.AuthService
+    userRepo    *database.UserRepository
+    channelRepo *database.ChannelRepository
+    resetTTL    *time.Duration
+    dryRun      bool
+
+    // seen holds every username read from the file so far and accepted the
+    // ones importUser created, or would create in a dry run. Both are keyed
+    // by lower-cased username.
+    seen     map[string]bool
+    accepted map[string]bool
+}
+
+func NewImporter(db *database.DB, authService *auth.AuthService, resetTTL *time.Duration, dryRun bool) *Importer {
+    return &Importer{
+        authService: authService,
+        userRepo:    database.NewUserRepository(db),
+        channelRepo: database.NewChannelRepository(db),
+        resetTTL:    resetTTL,
+        dryRun:      dryRun,
+        seen:        make(map[string]bool),
+        accepted:    make(map[string]bool),
+    }
+}
+
+func (im *Importer) Run(dataset *Dataset) (*Result, error) {
+    result := &Result{}
+
+    for _, user := range dataset.Users {
+        if err := im.importUser(user, result); err != nil {
+            log.Printf("Skipping user %s: %v", user.Username, err)
+            result.UsersSkipped++
+        }
+    }
+
+    for _, channel := range dataset.Channels {
+        if err := im.importChannel(channel, result); err != nil {
+            log.Printf("Skipping channel %s: %v", channel.Name, err)
+            result.ChannelsSkipped++
+        }
+    }
+
+    return result, nil
+}
+
+func (im *Importer) importUser(user User, result *Result) error {
+    if err := auth.ValidateUsername(user.Username); err != nil {
+        return err
+    }
+
+    key := strings.ToLower(user.Username)
+    if im.seen[key] {
+        return fmt.Errorf("duplicate username in import file")
+    }
+    im.seen[key] = true
+
+    exists, err := im.userRepo.UsernameExists(user.Username)
+    if err != nil {
+        return err
+    }
+    if exists {
+        return fmt.Errorf("username already exists")
+    }
+
+    if im.dryRun {
+        im.accepted[key] = true
+        result.UsersCreated++
+        return nil
+    }
+
+    password, err := randomPassword()
+    if err != nil {
+        return err
+    }
+
+    salt, err := auth.GenerateSalt()
+    if err != nil {
+        return err
+    }
+
+    created, err := im.userRepo.Create(user.Username, auth.HashPassword(password, salt), salt)
+    if err != nil {
+        return err
+    }
+
+    if user.IsAdmin {
+        if err := im.userRepo.SetAdminStatus(created.UserID, true); err != nil {
+            log.Printf("Failed to grant admin to %s: %v", user.Username, err)
+        }
+    }
+
+    token, err := im.authService.CreatePasswordReset(created.UserID, im.resetTTL)
+    if err != nil {
+        return err
+    }
+
+    im.accepted[key] = true
+    result.UsersCreated++
+    result.ResetTokens = append(result.ResetTokens, ResetToken{Username: created.Username, Token: token})
+
+    return nil
+}
+
+func (im *Importer) importChannel(channel Channel, result *Result) error {
+    if !strings.HasPrefix(channel.Name, "#") {
+        channel.Name = "#" + channel.Name
+    }
+
+    if channel.Founder == "" {
+        return fmt.Errorf("no founder")
+    }
+
+    if _, err := im.channelRepo.GetByName(channel.Name); err == nil {
+        return fmt.Errorf("channel already exists")
+    }
+
+    if im.dryRun {
+        return im.checkChannel(channel, result)
+    }
+
+    founder, err := im.userRepo.GetByUsername(channel.Founder)
+    if err != nil {
+        return fmt.Errorf("founder %s not found", channel.Founder)
+    }
+
+    created, err := im.channelRepo.Create(channel.Name, founder.UserID, channel.Private)
+    if err != nil {
+        return err
+    }
+    result.ChannelsCreated++
+
+    if channel.Topic != "" {
+        if err := im.channelRepo.UpdateTopic(created.ChannelID, channel.Topic); err != nil {
+            log.Printf("Failed to set topic for %s: %v", channel.Name, err)
+        }
+    }
+
+    for _, member := range channel.Members {
+        if strings.EqualFold(member.Username, channel.Founder) {
+            continue
+        }
+
+        user, err := im.userRepo.GetByUsername(member.Username)
+        if err != nil {
+            log.Printf("Skipping member %s of %s: user not found", member.Username, channel.Name)
+            continue
+        }
+
+        role := member.Role
+        if role != "owner" && role != "moderator" {
+            role = "member"
+        }
+
+        if err := im.channelRepo.AddMember(created.ChannelID, user.UserID, role); err != nil {
+            log.Printf("Failed to add %s to %s: %v", member.Username, channel.Name, err)
+            continue
+        }
+        result.MembersAdded++
+    }
+
+    return nil
+}
+
+// checkChannel counts what importChannel would create without writing. Users
+// accepted earlier in the run do not exist yet, so they count as present.
+func (im *Importer) checkChannel(channel Channel, result *Result) error {
+    exists, err := im.userExists(channel.Founder)
+    if err != nil {
+        return err
+    }
+    if !exists {
+        return fmt.Errorf("founder %s not found", channel.Founder)
+    }
+    result.ChannelsCreated++
+
+    for _, member := range channel.Members {
+        if strings.EqualFold(member.Username, channel.Founder) {
+            continue
+        }
+
+        exists, err := im.userExists(member.Username)
+        if err != nil {
+            return err
+        }
+        if !exists {
+            log.Printf("Skipping member %s of %s: user not found", member.Username, channel.Name)
+            continue
+        }
+        result.MembersAdded++
+    }
+
+    return nil
+}
+
+func (im *Importer) userExists(username string) (bool, error) {
+    if im.accepted[strings.ToLower(username)] {
+        return true, nil
+    }
+    return im.userRepo.UsernameExists(username)
+}
+
+func randomPassword() (string, error) {
+    bytes := make([]byte, 24)
+    if _, err := rand.Read(bytes); err != nil {
+        return "", fmt.Errorf("failed to generate password: %w", err)
+    }
+    return hex.EncodeToString(bytes), nil
+}
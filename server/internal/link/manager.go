@@ -0,0 +1,585 @@
+package link
+
+import (
+    "bufio"
+    "crypto/subtle"
+    "crypto/tls"
+    "fmt"
+    "log"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+const (
+    handshakeTimeout         = 30 * time.Second
+    pingInterval             = 60 * time.Second
+    readTimeout              = 3 * pingInterval
+    writeTimeout             = 10 * time.Second
+    sendQueueSize            = 4096
+    maxLineLength            = 16 * 1024
+    defaultReconnectInterval = 30 * time.Second
+)
+
+// Handler applies the network's events to the local server. Its methods
+// run with routing paused and must not call back into the Manager.
+type Handler interface {
+    // Burst describes this server's channels and users to a newly linked
+    // peer. ID and Origin are filled in by the Manager.
+    Burst() []*Message
+    // Remote applies a routed message from another server. affected holds,
+    // by channel, the remote users a SQUIT, UQUIT or UNICK touched, as they
+    // were before the change.
+    Remote(m *Message, affected map[string][]Member)
+}
+
+type peer struct {
+    name string
+    conn net.Conn
+    out  chan string
+    done chan struct{}
+    once sync.Once
+}
+
+func (p *peer) send(line string) bool {
+    select {
+    case p.out <- line:
+        return true
+    case <-p.done:
+        return false
+    default:
+        log.Printf("Link %s: send queue full, dropping link", p.name)
+        p.close()
+        return false
+    }
+}
+
+func (p *peer) close() {
+    p.once.Do(func() {
+        close(p.done)
+        p.conn.Close()
+    })
+}
+
+func (p *peer) writeLoop() {
+    writer := bufio.NewWriter(p.conn)
+    for {
+        select {
+        case <-p.done:
+            return
+        case line := <-p.out:
+            p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+            _, err := writer.WriteString(line + "\r\n")
+            if err == nil && len(p.out) == 0 {
+                err = writer.Flush()
+            }
+            if err != nil {
+                select {
+                case <-p.done:
+                default:
+                    log.Printf("Link %s: write failed: %v", p.name, err)
+                    p.close()
+                }
+                return
+            }
+        }
+    }
+}
+
+// Manager maintains this server's links and routes messages between them.
+type Manager struct {
+    name     string
+    cfg      config.LinksConfig
+    handler  Handler
+    network  *network
+    seen     *seenSet
+    peers    map[string]*peer
+    routeMu  sync.Mutex
+    counter  uint64
+    listener net.Listener
+    shutdown chan struct{}
+}
+
+func NewManager(name string, cfg config.LinksConfig, handler Handler) *Manager {
+    return &Manager{
+        name:     name,
+        cfg:      cfg,
+        handler:  handler,
+        network:  newNetwork(),
+        seen:     newSeenSet(seenCapacity),
+        peers:    make(map[string]*peer),
+        counter:  uint64(time.Now().UnixNano()),
+        shutdown: make(chan struct{}),
+    }
+}
+
+// Start accepts inbound links on listener, if not nil, and keeps a link
+// open to every peer that has an address configured.
+func (m *Manager) Start(listener net.Listener) {
+    m.listener = listener
+    if listener != nil {
+        go m.acceptLoop(listener)
+    }
+
+    for _, peerCfg := range m.cfg.Peers {
+        if peerCfg.Address != "" {
+            go m.maintain(peerCfg)
+        }
+    }
+}
+
+// Close drops every link. The rest of the network sees a netsplit.
+func (m *Manager) Close() {
+    close(m.shutdown)
+    if m.listener != nil {
+        m.listener.Close()
+    }
+
+    m.routeMu.Lock()
+    peers := make([]*peer, 0, len(m.peers))
+    for _, p := range m.peers {
+        peers = append(peers, p)
+    }
+    m.routeMu.Unlock()
+
+    for _, p := range peers {
+        p.close()
+    }
+}
+
+// Propagate sends an event about this server to the whole network.
+func (m *Manager) Propagate(command string, params ...string) {
+    m.routeMu.Lock()
+    defer m.routeMu.Unlock()
+
+    msg := m.newMessage(m.name, command, params...)
+    m.seen.add(msg.ID)
+    m.forward(msg, "")
+}
+
+// Members returns the remote users in channel.
+func (m *Manager) Members(channel string) []Member {
+    return m.network.members(channel)
+}
+
+// Lookup returns the remote users called nick; more than one server may
+// have a user of that name.
+func (m *Manager) Lookup(nick string) []Member {
+    return m.network.lookup(nick)
+}
+
+// Servers returns every other server on the network with the direct link
+// it is reached through.
+func (m *Manager) Servers() map[string]string {
+    return m.network.servers()
+}
+
+func (m *Manager) newMessage(origin, command string, params ...string) *Message {
+    id := atomic.AddUint64(&m.counter, 1)
+    return &Message{
+        ID:      m.name + "." + strconv.FormatUint(id, 36),
+        Origin:  origin,
+        Command: command,
+        Params:  params,
+    }
+}
+
+// forward sends msg to every link except the one named except. The caller
+// holds routeMu.
+func (m *Manager) forward(msg *Message, except string) {
+    line := msg.String()
+    for name, p := range m.peers {
+        if name != except {
+            p.send(line)
+        }
+    }
+}
+
+func (m *Manager) acceptLoop(listener net.Listener) {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            select {
+            case <-m.shutdown:
+                return
+            default:
+                log.Printf("Failed to accept link: %v", err)
+                continue
+            }
+        }
+
+        go m.accept(conn)
+    }
+}
+
+func (m *Manager) maintain(peerCfg config.LinkPeerConfig) {
+    interval := m.cfg.ReconnectInterval
+    if interval <= 0 {
+        interval = defaultReconnectInterval
+    }
+
+    for {
+        if _, linked := m.network.route(peerCfg.Name); !linked {
+            if err := m.dial(peerCfg); err != nil {
+                log.Printf("Link %s: %v", peerCfg.Name, err)
+            }
+        }
+
+        select {
+        case <-m.shutdown:
+            return
+        case <-time.After(interval):
+        }
+    }
+}
+
+func (m *Manager) dial(peerCfg config.LinkPeerConfig) error {
+    dialer := &net.Dialer{Timeout: handshakeTimeout}
+
+    var conn net.Conn
+    var err error
+    if peerCfg.TLS {
+        conn, err = tls.DialWithDialer(dialer, "tcp", peerCfg.Address, &tls.Config{MinVersion: tls.VersionTLS12})
+    } else {
+        conn, err = dialer.Dial("tcp", peerCfg.Address)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to connect to %s: %w", peerCfg.Address, err)
+    }
+
+    reader := bufio.NewReaderSize(conn, maxLineLength)
+    conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+    if err := m.sendHandshake(conn, peerCfg.Password); err != nil {
+        conn.Close()
+        return err
+    }
+
+    name, password, err := readHandshake(reader)
+    if err != nil {
+        conn.Close()
+        return err
+    }
+
+    if name != peerCfg.Name || !passwordMatches(password, peerCfg.Password) {
+        conn.Close()
+        return fmt.Errorf("peer at %s failed authentication", peerCfg.Address)
+    }
+
+    m.run(conn, reader, peerCfg.Name)
+    return nil
+}
+
+func (m *Manager) accept(conn net.Conn) {
+    remote := conn.RemoteAddr().String()
+    reader := bufio.NewReaderSize(conn, maxLineLength)
+    conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+    name, password, err := readHandshake(reader)
+    if err != nil {
+        log.Printf("Link from %s: %v", remote, err)
+        conn.Close()
+        return
+    }
+
+    peerCfg, ok := m.peerConfig(name)
+    if !ok || !hostAllowed(peerCfg.Hosts, conn.RemoteAddr()) || !passwordMatches(password, peerCfg.Password) {
+        log.Printf("Link from %s: refused link claiming to be %s", remote, name)
+        fmt.Fprintf(conn, "%s\r\n", (&Message{Command: cmdError, Params: []string{"Access denied"}}).String())
+        conn.Close()
+        return
+    }
+
+    if err := m.sendHandshake(conn, peerCfg.Password); err != nil {
+        conn.Close()
+        return
+    }
+
+    m.run(conn, reader, name)
+}
+
+func (m *Manager) peerConfig(name string) (config.LinkPeerConfig, bool) {
+    for _, peerCfg := range m.cfg.Peers {
+        if peerCfg.Name == name {
+            return peerCfg, true
+        }
+    }
+    return config.LinkPeerConfig{}, false
+}
+
+func (m *Manager) sendHandshake(conn net.Conn, password string) error {
+    handshake := (&Message{Command: cmdPass, Params: []string{password}}).String() + "\r\n" +
+        (&Message{Command: cmdLink, Params: []string{m.name, ProtocolVersion}}).String() + "\r\n"
+
+    if _, err := conn.Write([]byte(handshake)); err != nil {
+        return fmt.Errorf("failed to send handshake: %w", err)
+    }
+    return nil
+}
+
+// readHandshake reads the PASS and LINK lines that open every link.
+func readHandshake(reader *bufio.Reader) (string, string, error) {
+    var name, password string
+    for name == "" || password == "" {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return "", "", fmt.Errorf("handshake failed: %w", err)
+        }
+
+        msg, err := Parse(line)
+        if err != nil {
+            return "", "", fmt.Errorf("handshake failed: %w", err)
+        }
+
+        switch msg.Command {
+        case cmdPass:
+            password = msg.Param(0)
+        case cmdLink:
+            if msg.Param(1) != ProtocolVersion {
+                return "", "", fmt.Errorf("handshake failed: peer speaks protocol %q, want %s", msg.Param(1), ProtocolVersion)
+            }
+            name = msg.Param(0)
+        case cmdError:
+            return "", "", fmt.Errorf("peer refused link: %s", msg.Param(0))
+        default:
+            return "", "", fmt.Errorf("handshake failed: unexpected %s", msg.Command)
+        }
+    }
+
+    return name, password, nil
+}
+
+func passwordMatches(got, want string) bool {
+    return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func hostAllowed(hosts []string, addr net.Addr) bool {
+    host, _, err := net.SplitHostPort(addr.String())
+    if err != nil {
+        return false
+    }
+    ip := net.ParseIP(host)
+
+    for _, entry := range hosts {
+        if _, network, err := net.ParseCIDR(entry); err == nil {
+            if network.Contains(ip) {
+                return true
+            }
+        } else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// run registers an authenticated link, sends the burst and reads from it
+// until it drops.
+func (m *Manager) run(conn net.Conn, reader *bufio.Reader, name string) {
+    p := &peer{
+        name: name,
+        conn: conn,
+        out:  make(chan string, sendQueueSize),
+        done: make(chan struct{}),
+    }
+
+    if !m.register(p) {
+        fmt.Fprintf(conn, "%s\r\n", (&Message{Command: cmdError, Params: []string{"Server already linked"}}).String())
+        conn.Close()
+        log.Printf("Link %s: refused, server is already on the network", name)
+        return
+    }
+
+    conn.SetDeadline(time.Time{})
+    go p.writeLoop()
+    go m.pingLoop(p)
+
+    log.Printf("Link %s established (%s)", name, conn.RemoteAddr().String())
+
+    reason := m.readLoop(p, reader)
+    p.close()
+    m.unregister(p, reason)
+}
+
+// register adds p as a direct link, announces it to the rest of the network
+// and queues the burst for it. It refuses a server that is already linked,
+// which keeps the network a tree.
+func (m *Manager) register(p *peer) bool {
+    m.routeMu.Lock()
+    defer m.routeMu.Unlock()
+
+    select {
+    case <-m.shutdown:
+        return false
+    default:
+    }
+
+    if !m.network.addServer(p.name, p.name) {
+        return false
+    }
+    m.peers[p.name] = p
+
+    announce := m.newMessage(m.name, CmdServer, p.name)
+    m.seen.add(announce.ID)
+    m.forward(announce, p.name)
+
+    for server := range m.network.servers() {
+        if server != p.name {
+            p.send(m.newMessage(m.name, CmdServer, server).String())
+        }
+    }
+
+    for channel, members := range m.network.memberships() {
+        for _, member := range members {
+            if member.Server != p.name {
+                p.send(m.newMessage(member.Server, CmdJoin, member.Nick, channel).String())
+            }
+        }
+    }
+
+    for _, msg := range m.handler.Burst() {
+        p.send(m.newMessage(m.name, msg.Command, msg.Params...).String())
+    }
+    p.send((&Message{Command: cmdEndBurst}).String())
+
+    return true
+}
+
+// unregister removes a dropped link and every server behind it, telling
+// the local server and the rest of the network about the split.
+func (m *Manager) unregister(p *peer, reason string) {
+    m.routeMu.Lock()
+    defer m.routeMu.Unlock()
+
+    if m.peers[p.name] != p {
+        return
+    }
+    delete(m.peers, p.name)
+
+    splitReason := m.name + " " + p.name
+    for _, server := range m.network.serversVia(p.name) {
+        affected := m.network.removeServer(server)
+        squit := m.newMessage(m.name, CmdSquit, server, splitReason)
+        m.seen.add(squit.ID)
+        m.handler.Remote(squit, affected)
+        m.forward(squit, p.name)
+    }
+
+    log.Printf("Link %s lost: %s", p.name, reason)
+}
+
+func (m *Manager) pingLoop(p *peer) {
+    ticker := time.NewTicker(pingInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-p.done:
+            return
+        case <-ticker.C:
+            p.send((&Message{Command: cmdPing, Params: []string{m.name}}).String())
+        }
+    }
+}
+
+func (m *Manager) readLoop(p *peer, reader *bufio.Reader) string {
+    for {
+        p.conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return err.Error()
+        }
+
+        msg, err := Parse(line)
+        if err != nil {
+            log.Printf("Link %s: ignoring malformed line: %v", p.name, err)
+            continue
+        }
+
+        switch msg.Command {
+        case cmdPing:
+            p.send((&Message{Command: cmdPong, Params: msg.Params}).String())
+        case cmdPong:
+        case cmdEndBurst:
+            log.Printf("Link %s: burst complete", p.name)
+        case cmdError:
+            return "peer closed link: " + msg.Param(0)
+        default:
+            if msg.routed() {
+                if err := m.route(p, msg); err != nil {
+                    p.send((&Message{Command: cmdError, Params: []string{err.Error()}}).String())
+                    return err.Error()
+                }
+            }
+        }
+    }
+}
+
+// route applies a message received from p and passes it on to every other
+// link. A message is handled at most once; one whose origin is not behind
+// p is dropped.
+func (m *Manager) route(p *peer, msg *Message) error {
+    m.routeMu.Lock()
+    defer m.routeMu.Unlock()
+
+    if m.peers[p.name] != p {
+        return nil
+    }
+
+    if via, ok := m.network.route(msg.Origin); !ok || via != p.name {
+        log.Printf("Link %s: dropping %s from %s, which is not behind this link", p.name, msg.Command, msg.Origin)
+        return nil
+    }
+
+    if !m.seen.add(msg.ID) {
+        return nil
+    }
+
+    var affected map[string][]Member
+    member := Member{Nick: msg.Param(0), Server: msg.Origin}
+
+    switch msg.Command {
+    case CmdServer:
+        server := msg.Param(0)
+        if server == m.name || !m.network.addServer(server, p.name) {
+            return fmt.Errorf("server %s already linked", server)
+        }
+    case CmdSquit:
+        server := msg.Param(0)
+        if via, ok := m.network.route(server); !ok || via != p.name || server == p.name {
+            return nil
+        }
+        affected = m.network.removeServer(server)
+    case CmdJoin:
+        if !m.network.join(member, msg.Param(1)) {
+            return nil
+        }
+    case CmdPart:
+        if !m.network.part(member, msg.Param(1)) {
+            return nil
+        }
+    case CmdQuit:
+        affected = make(map[string][]Member)
+        for _, channel := range m.network.quit(member) {
+            affected[channel] = []Member{member}
+        }
+    case CmdNick:
+        if strings.ContainsAny(msg.Param(1), " :") {
+            return nil
+        }
+        affected = make(map[string][]Member)
+        for _, channel := range m.network.rename(member, msg.Param(1)) {
+            affected[channel] = []Member{member}
+        }
+    }
+
+    m.handler.Remote(msg, affected)
+    m.forward(msg, p.name)
+
+    return nil
+}
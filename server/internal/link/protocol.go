@@ -0,0 +1,118 @@
+// Package link implements the server-to-server protocol used to join
+// OnyxIRC servers into a network.
+//
+// Linked servers form a tree. Every routed message carries a network-unique
+// ID and the name of the server it describes; a server applies and forwards
+// each ID once, to every link except the one it arrived on, so a message
+// never travels in a loop even if a cycle slips past the handshake check.
+package link
+
+import (
+    "fmt"
+    "strings"
+)
+
+// ProtocolVersion is sent in the LINK handshake; peers must match.
+const ProtocolVersion = "1"
+
+// Routed commands. Each is sent as "<command> <id> <origin> <params...>".
+const (
+    CmdServer  = "SERVER" // <name>: a server has joined the network
+    CmdSquit   = "SQUIT"  // <name> :<reason>: a server has left the network
+    CmdChannel = "CHAN"   // <channel> <created-unix> :<topic>
+    CmdJoin    = "UJOIN"  // <nick> <channel>
+    CmdPart    = "UPART"  // <nick> <channel>
+    CmdQuit    = "UQUIT"  // <nick> :<reason>
+    CmdNick    = "UNICK"  // <old> <new>
+    CmdMessage = "CMSG"   // <nick> <channel> :<text>
+)
+
+// Link-local commands, never forwarded.
+const (
+    cmdPass     = "PASS"
+    cmdLink     = "LINK"
+    cmdEndBurst = "ENDBURST"
+    cmdPing     = "PING"
+    cmdPong     = "PONG"
+    cmdError    = "ERROR"
+)
+
+var routedParams = map[string]int{
+    CmdServer:  1,
+    CmdSquit:   2,
+    CmdChannel: 3,
+    CmdJoin:    2,
+    CmdPart:    2,
+    CmdQuit:    2,
+    CmdNick:    2,
+    CmdMessage: 3,
+}
+
+// Message is one line of the link protocol. ID and Origin are only set on
+// routed commands.
+type Message struct {
+    ID      string
+    Origin  string
+    Command string
+    Params  []string
+}
+
+func (m *Message) routed() bool {
+    _, ok := routedParams[m.Command]
+    return ok
+}
+
+// Param returns the i-th parameter, or "" if there are fewer.
+func (m *Message) Param(i int) string {
+    if i < len(m.Params) {
+        return m.Params[i]
+    }
+    return ""
+}
+
+// String encodes m as a line without the trailing CRLF. The last parameter
+// is sent as a trailing parameter when it needs to be.
+func (m *Message) String() string {
+    fields := []string{m.Command}
+    if m.routed() {
+        fields = append(fields, m.ID, m.Origin)
+    }
+
+    for i, param := range m.Params {
+        if i == len(m.Params)-1 && (param == "" || strings.ContainsAny(param, " ") || strings.HasPrefix(param, ":")) {
+            param = ":" + param
+        }
+        fields = append(fields, param)
+    }
+
+    return strings.Join(fields, " ")
+}
+
+// Parse decodes a line of the link protocol.
+func Parse(line string) (*Message, error) {
+    line = strings.TrimRight(line, "\r\n")
+    if line == "" {
+        return nil, fmt.Errorf("empty line")
+    }
+
+    var fields []string
+    if idx := strings.Index(line, " :"); idx != -1 {
+        fields = append(strings.Fields(line[:idx]), line[idx+2:])
+    } else {
+        fields = strings.Fields(line)
+    }
+
+    m := &Message{Command: strings.ToUpper(fields[0])}
+    fields = fields[1:]
+
+    if m.routed() {
+        if len(fields) < 2+routedParams[m.Command] {
+            return nil, fmt.Errorf("%s: not enough parameters", m.Command)
+        }
+        m.ID, m.Origin = fields[0], fields[1]
+        fields = fields[2:]
+    }
+
+    m.Params = fields
+    return m, nil
+}
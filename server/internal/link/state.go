@@ -0,0 +1,250 @@
+package link
+
+import (
+    "sort"
+    "sync"
+)
+
+const seenCapacity = 8192
+
+// Member is a user on another server of the network.
+type Member struct {
+    Nick   string
+    Server string
+}
+
+// seenSet remembers the most recent message IDs so a message that comes
+// back around is dropped instead of applied twice.
+type seenSet struct {
+    ids   map[string]struct{}
+    order []string
+    next  int
+}
+
+func newSeenSet(capacity int) *seenSet {
+    return &seenSet{
+        ids:   make(map[string]struct{}, capacity),
+        order: make([]string, capacity),
+    }
+}
+
+// add records id and reports whether it was new.
+func (s *seenSet) add(id string) bool {
+    if _, exists := s.ids[id]; exists {
+        return false
+    }
+
+    if old := s.order[s.next]; old != "" {
+        delete(s.ids, old)
+    }
+    s.order[s.next] = id
+    s.next = (s.next + 1) % len(s.order)
+    s.ids[id] = struct{}{}
+
+    return true
+}
+
+// network is this server's view of the rest of the network: which servers
+// exist, which direct link each is reached through, and which remote users
+// are in which channels.
+type network struct {
+    mu       sync.RWMutex
+    via      map[string]string
+    channels map[string]map[Member]struct{}
+}
+
+func newNetwork() *network {
+    return &network{
+        via:      make(map[string]string),
+        channels: make(map[string]map[Member]struct{}),
+    }
+}
+
+func (n *network) route(server string) (string, bool) {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    via, ok := n.via[server]
+    return via, ok
+}
+
+func (n *network) addServer(server, via string) bool {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if _, exists := n.via[server]; exists {
+        return false
+    }
+    n.via[server] = via
+    return true
+}
+
+// serversVia lists the servers reached through the direct link via,
+// including via itself.
+func (n *network) serversVia(via string) []string {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    var servers []string
+    for server, link := range n.via {
+        if link == via {
+            servers = append(servers, server)
+        }
+    }
+    sort.Strings(servers)
+    return servers
+}
+
+func (n *network) servers() map[string]string {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    servers := make(map[string]string, len(n.via))
+    for server, via := range n.via {
+        servers[server] = via
+    }
+    return servers
+}
+
+// removeServer forgets server and returns the channel memberships its
+// users held, by channel.
+func (n *network) removeServer(server string) map[string][]Member {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    delete(n.via, server)
+
+    removed := make(map[string][]Member)
+    for channel, members := range n.channels {
+        for member := range members {
+            if member.Server == server {
+                delete(members, member)
+                removed[channel] = append(removed[channel], member)
+            }
+        }
+        if len(members) == 0 {
+            delete(n.channels, channel)
+        }
+    }
+    return removed
+}
+
+func (n *network) join(member Member, channel string) bool {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if n.channels[channel] == nil {
+        n.channels[channel] = make(map[Member]struct{})
+    }
+    if _, exists := n.channels[channel][member]; exists {
+        return false
+    }
+    n.channels[channel][member] = struct{}{}
+    return true
+}
+
+func (n *network) part(member Member, channel string) bool {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    if _, exists := n.channels[channel][member]; !exists {
+        return false
+    }
+    delete(n.channels[channel], member)
+    if len(n.channels[channel]) == 0 {
+        delete(n.channels, channel)
+    }
+    return true
+}
+
+// quit removes member from every channel and returns the channels it was in.
+func (n *network) quit(member Member) []string {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    var channels []string
+    for channel, members := range n.channels {
+        if _, exists := members[member]; exists {
+            delete(members, member)
+            channels = append(channels, channel)
+        }
+        if len(members) == 0 {
+            delete(n.channels, channel)
+        }
+    }
+    sort.Strings(channels)
+    return channels
+}
+
+func (n *network) rename(member Member, nick string) []string {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    renamed := Member{Nick: nick, Server: member.Server}
+
+    var channels []string
+    for channel, members := range n.channels {
+        if _, exists := members[member]; exists {
+            delete(members, member)
+            members[renamed] = struct{}{}
+            channels = append(channels, channel)
+        }
+    }
+    sort.Strings(channels)
+    return channels
+}
+
+func (n *network) members(channel string) []Member {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    members := make([]Member, 0, len(n.channels[channel]))
+    for member := range n.channels[channel] {
+        members = append(members, member)
+    }
+    sortMembers(members)
+    return members
+}
+
+func (n *network) memberships() map[string][]Member {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    memberships := make(map[string][]Member, len(n.channels))
+    for channel, members := range n.channels {
+        for member := range members {
+            memberships[channel] = append(memberships[channel], member)
+        }
+    }
+    return memberships
+}
+
+func (n *network) lookup(nick string) []Member {
+    n.mu.RLock()
+    defer n.mu.RUnlock()
+
+    found := make(map[Member]struct{})
+    for _, members := range n.channels {
+        for member := range members {
+            if member.Nick == nick {
+                found[member] = struct{}{}
+            }
+        }
+    }
+
+    matches := make([]Member, 0, len(found))
+    for member := range found {
+        matches = append(matches, member)
+    }
+    sortMembers(matches)
+    return matches
+}
+
+func sortMembers(members []Member) {
+    sort.Slice(members, func(i, j int) bool {
+        if members[i].Nick != members[j].Nick {
+            return members[i].Nick < members[j].Nick
+        }
+        return members[i].Server < members[j].Server
+    })
+}
@@ -0,0 +1,73 @@
+// Package mail sends account email such as address verification and
+// password reset codes.
+package mail
+
+import (
+    "fmt"
+    "net"
+    netmail "net/mail"
+    "net/smtp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Mailer delivers a plain-text message. The server uses SMTP; tests and
+// embedders may supply their own.
+type Mailer interface {
+    Send(to, subject, body string) error
+}
+
+// SMTP sends through an SMTP relay, with STARTTLS when the relay offers it.
+type SMTP struct {
+    addr string
+    from string
+    auth smtp.Auth
+}
+
+// NewSMTP returns a mailer for the relay at host:port. Without a username
+// it sends unauthenticated.
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+    m := &SMTP{
+        addr: net.JoinHostPort(host, strconv.Itoa(port)),
+        from: from,
+    }
+    if username != "" {
+        m.auth = smtp.PlainAuth("", username, password, host)
+    }
+    return m
+}
+
+func (m *SMTP) Send(to, subject, body string) error {
+    if strings.ContainsAny(to+subject, "\r\n") {
+        return fmt.Errorf("invalid mail header")
+    }
+
+    var msg strings.Builder
+    fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+    fmt.Fprintf(&msg, "To: %s\r\n", to)
+    fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+    fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    msg.WriteString("MIME-Version: 1.0\r\n")
+    msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+    msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+    if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg.String())); err != nil {
+        return fmt.Errorf("failed to send mail: %w", err)
+    }
+    return nil
+}
+
+// ValidateAddress accepts a bare address such as user@example.com, without
+// a display name.
+func ValidateAddress(address string) error {
+    if len(address) > 254 {
+        return fmt.Errorf("email address is too long")
+    }
+
+    parsed, err := netmail.ParseAddress(address)
+    if err != nil || parsed.Address != address || parsed.Name != "" {
+        return fmt.Errorf("invalid email address: %s", address)
+    }
+    return nil
+}
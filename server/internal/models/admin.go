@@ -4,9 +4,11 @@ import "time"
 
 type AdminActionLog struct {
     LogID           int64      `json:"log_id"`
-    AdminID         int64      `json:"admin_id"`
+    AdminID         int64      `json:"admin_id"` // 0 for automatic actions
+    AdminUsername   string     `json:"admin_username"`
     ActionType      string     `json:"action_type"`
     TargetUserID    *int64     `json:"target_user_id,omitempty"`
+    TargetUsername  *string    `json:"target_username,omitempty"`
     TargetChannelID *int64     `json:"target_channel_id,omitempty"`
     ActionDetails   *string    `json:"action_details,omitempty"`
     PerformedAt     time.Time  `json:"performed_at"`
@@ -19,3 +21,104 @@ type ServerConfig struct {
     UpdatedAt   time.Time  `json:"updated_at"`
     UpdatedBy   *int64     `json:"updated_by,omitempty"`
 }
+
+type Kill struct {
+    KillID       int64     `json:"kill_id"`
+    TargetUserID int64     `json:"target_user_id"`
+    KillerID     int64     `json:"killer_id"`
+    Reason       *string   `json:"reason,omitempty"`
+    IPAddress    *string   `json:"ip_address,omitempty"`
+    KilledAt     time.Time `json:"killed_at"`
+}
+
+type IPBan struct {
+    BanID     int64      `json:"ban_id"`
+    CIDR      string     `json:"cidr"`
+    BannedBy  *int64     `json:"banned_by,omitempty"`
+    Reason    *string    `json:"reason,omitempty"`
+    BannedAt  time.Time  `json:"banned_at"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+    IsActive  bool       `json:"is_active"`
+}
+
+// TrustedIP is an address or network whose logins never raise an account's
+// IP suspicion. AddedBy is nil when the user added it themselves.
+type TrustedIP struct {
+    TrustedID int64     `json:"trusted_id"`
+    UserID    int64     `json:"user_id"`
+    CIDR      string    `json:"cidr"`
+    Note      *string   `json:"note,omitempty"`
+    AddedBy   *int64    `json:"added_by,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// FilterRule is a content filter rule. ChannelID is nil for a rule that
+// applies everywhere; Pattern is a comma-separated word list or a regular
+// expression, depending on Kind.
+type FilterRule struct {
+    RuleID      int64     `json:"rule_id"`
+    ChannelID   *int64    `json:"channel_id,omitempty"`
+    ChannelName string    `json:"channel_name,omitempty"`
+    Kind        string    `json:"kind"`
+    Pattern     string    `json:"pattern"`
+    Action      string    `json:"action"`
+    Replacement string    `json:"replacement,omitempty"`
+    CreatedBy   *int64    `json:"created_by,omitempty"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Report is an abuse report filed with REPORT against a user or a channel.
+// MessageIDs are the recent messages captured with it when message history
+// is on.
+type Report struct {
+    ReportID        int64      `json:"report_id"`
+    ReporterID      int64      `json:"reporter_id"`
+    ReporterName    string     `json:"reporter_name"`
+    TargetUserID    *int64     `json:"target_user_id,omitempty"`
+    TargetChannelID *int64     `json:"target_channel_id,omitempty"`
+    TargetName      string     `json:"target_name"`
+    Reason          string     `json:"reason"`
+    MessageIDs      []int64    `json:"message_ids,omitempty"`
+    Status          string     `json:"status"`
+    HandledBy       *int64     `json:"handled_by,omitempty"`
+    HandledAt       *time.Time `json:"handled_at,omitempty"`
+    CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ScheduledBroadcast is an ADMIN broadcast set to go out later, once or
+// every Interval.
+type ScheduledBroadcast struct {
+    BroadcastID int64         `json:"broadcast_id"`
+    CreatedBy   int64         `json:"created_by"`
+    CreatorName string        `json:"creator_name"`
+    Message     string        `json:"message"`
+    NextRunAt   time.Time     `json:"next_run_at"`
+    Interval    time.Duration `json:"interval"`
+    Runs        int           `json:"runs"`
+    CreatedAt   time.Time     `json:"created_at"`
+}
+
+// EvasionFlag links an account to an actively banned one through shared
+// evidence. Username and BannedUsername are filled in for reports.
+type EvasionFlag struct {
+    FlagID         int64      `json:"flag_id"`
+    UserID         int64      `json:"user_id"`
+    Username       string     `json:"username"`
+    BannedUserID   int64      `json:"banned_user_id"`
+    BannedUsername string     `json:"banned_username"`
+    EvidenceType   string     `json:"evidence_type"`
+    Evidence       string     `json:"evidence"`
+    DetectedAt     time.Time  `json:"detected_at"`
+    Restricted     bool       `json:"restricted"`
+    ReviewedBy     *int64     `json:"reviewed_by,omitempty"`
+    ReviewedAt     *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// Observer is a listen-only account attached to channels for archival. It
+// receives their traffic without being a member of them.
+type Observer struct {
+    UserID    int64     `json:"user_id"`
+    Username  string    `json:"username"`
+    Channels  []string  `json:"channels"`
+    CreatedAt time.Time `json:"created_at"`
+}
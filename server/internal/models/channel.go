@@ -10,6 +10,16 @@ type Channel struct {
     Topic       *string   `json:"topic,omitempty"`
     IsPrivate   bool      `json:"is_private"`
     MaxMembers  int       `json:"max_members"`
+    IsArchived  bool      `json:"is_archived"`
+}
+
+// ChannelModes are the MODE flags of a channel; the zero value has none set.
+type ChannelModes struct {
+    Announce    bool    `json:"announce"`
+    Moderated   bool    `json:"moderated"`
+    InviteOnly  bool    `json:"invite_only"`
+    KeyHash     *string `json:"-"`
+    MemberLimit int     `json:"member_limit"`
 }
 
 type ChannelMember struct {
@@ -27,6 +37,8 @@ type Message struct {
     UserID         int64     `json:"user_id"`
     MessageContent string    `json:"message_content"` 
     MessageHash    *string   `json:"message_hash,omitempty"`
+    ChannelSeq     *int64    `json:"channel_seq,omitempty"`
+    Signature      *string   `json:"signature,omitempty"`
     SentAt         time.Time `json:"sent_at"`
     IsDeleted      bool      `json:"is_deleted"`
 }
@@ -41,3 +53,20 @@ type DirectMessage struct {
     IsRead         bool      `json:"is_read"`
     IsDeleted      bool      `json:"is_deleted"`
 }
+
+// Paste is a multi-line text snippet shared as one object. Content holds the
+// AES ciphertext and EncryptedKey its per-paste key wrapped with the server
+// RSA key. Exactly one of ChannelID and RecipientID is set.
+type Paste struct {
+    PasteID        int64     `json:"paste_id"`
+    UserID         int64     `json:"user_id"`
+    Username       string    `json:"username"`
+    ChannelID      *int64    `json:"channel_id,omitempty"`
+    RecipientID    *int64    `json:"recipient_id,omitempty"`
+    Title          string    `json:"title"`
+    EncryptedKey   string    `json:"-"`
+    Content        string    `json:"-"`
+    Size           int       `json:"size"`
+    LineCount      int       `json:"line_count"`
+    CreatedAt      time.Time `json:"created_at"`
+}
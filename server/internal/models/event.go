@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type DomainEvent struct {
+    EventID   int64     `json:"event_id"`
+    EventType string    `json:"event_type"`
+    UserID    *int64    `json:"user_id,omitempty"`
+    ChannelID *int64    `json:"channel_id,omitempty"`
+    Payload   string    `json:"payload"`
+    CreatedAt time.Time `json:"created_at"`
+}
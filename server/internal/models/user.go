@@ -11,6 +11,7 @@ type User struct {
     UpdatedAt    time.Time `json:"updated_at"`
     IsActive     bool      `json:"is_active"`
     IsAdmin      bool      `json:"is_admin"`
+    IsBot        bool      `json:"is_bot"`
     LastLoginTime *time.Time `json:"last_login_time,omitempty"`
 }
 
@@ -33,6 +34,32 @@ type UserIPTracking struct {
     UserAgent       *string   `json:"user_agent,omitempty"`
 }
 
+// Security event types recorded in security_events.
+const (
+    SecurityEventLock              = "lock"
+    SecurityEventUnlock            = "unlock"
+    SecurityEventSuspicion         = "suspicion"
+    SecurityEventSuspicionReset    = "suspicion_reset"
+    SecurityEventLoginLockout      = "login_lockout"
+    SecurityEventDisconnect        = "disconnect"
+    SecurityEventKeyExchangeFailed = "keyexchange_failed"
+)
+
+// SecurityEvent is one entry of the append-only security event log.
+// Username and ActorUsername are nil when no user is involved or the user
+// has since been deleted.
+type SecurityEvent struct {
+    EventID       int64     `json:"event_id"`
+    EventType     string    `json:"event_type"`
+    UserID        *int64    `json:"user_id,omitempty"`
+    Username      *string   `json:"username,omitempty"`
+    ActorID       *int64    `json:"actor_id,omitempty"`
+    ActorUsername *string   `json:"actor_username,omitempty"`
+    IPAddress     *string   `json:"ip_address,omitempty"`
+    Details       *string   `json:"details,omitempty"`
+    OccurredAt    time.Time `json:"occurred_at"`
+}
+
 type SessionToken struct {
     TokenID      int64     `json:"token_id"`
     UserID       int64     `json:"user_id"`
@@ -42,14 +69,36 @@ type SessionToken struct {
     LastActivity time.Time `json:"last_activity"`
     IPAddress    string    `json:"ip_address"`
     IsValid      bool      `json:"is_valid"`
+    SessionKey   *string   `json:"-"`
 }
 
 type UserBan struct {
-    BanID     int64      `json:"ban_id"`
-    UserID    int64      `json:"user_id"`
-    BannedBy  int64      `json:"banned_by"`
-    Reason    *string    `json:"reason,omitempty"`
-    BannedAt  time.Time  `json:"banned_at"`
-    ExpiresAt *time.Time `json:"expires_at,omitempty"`
-    IsActive  bool       `json:"is_active"`
+    BanID        int64      `json:"ban_id"`
+    UserID       int64      `json:"user_id"`
+    Username     string     `json:"username"`
+    BannedBy     int64      `json:"banned_by"` // 0 for automatic bans
+    BannedByName string     `json:"banned_by_name"`
+    Reason       *string    `json:"reason,omitempty"`
+    BannedAt     time.Time  `json:"banned_at"`
+    ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+    IsActive     bool       `json:"is_active"`
+}
+
+type UserKey struct {
+    UserID      int64     `json:"user_id"`
+    PublicKey   string    `json:"public_key"`
+    Fingerprint string    `json:"fingerprint"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TwoFactor holds a user's TOTP secret, encrypted with the server RSA key.
+// A secret is pending until the user confirms it with a valid code.
+type TwoFactor struct {
+    UserID          int64      `json:"user_id"`
+    SecretEncrypted string     `json:"-"`
+    IsEnabled       bool       `json:"is_enabled"`
+    LastUsedStep    int64      `json:"-"`
+    CreatedAt       time.Time  `json:"created_at"`
+    EnabledAt       *time.Time `json:"enabled_at,omitempty"`
 }
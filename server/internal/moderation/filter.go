@@ -0,0 +1,160 @@
+// Package moderation checks message text against the content filter rules
+// admins set with ADMIN filter.
+package moderation
+
+import (
+    "fmt"
+    "log"
+    "regexp"
+    "strings"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+// Rule kinds.
+const (
+    KindWords = "words" // Comma-separated words, matched whole and case-insensitively
+    KindRegex = "regex" // Go regular expression
+)
+
+// Rule actions.
+const (
+    ActionBlock   = "block"   // Refuse the message
+    ActionReplace = "replace" // Replace each match with the rule's replacement
+    ActionWarn    = "warn"    // Deliver it, and warn the sender
+    ActionMute    = "mute"    // Refuse it and mute the sender in that channel for a while
+    ActionReport  = "report"  // Deliver it, and tell admins with the m snomask
+    ActionAllow   = "allow"   // Stop checking; lets a channel rule exempt text from global rules
+)
+
+const defaultReplacement = "***"
+
+var actions = map[string]bool{
+    ActionBlock:   true,
+    ActionReplace: true,
+    ActionWarn:    true,
+    ActionMute:    true,
+    ActionReport:  true,
+    ActionAllow:   true,
+}
+
+// Validate checks a rule's kind, action and pattern before it is stored.
+func Validate(rule *models.FilterRule) error {
+    if !actions[rule.Action] {
+        return fmt.Errorf("unknown filter action: %s", rule.Action)
+    }
+    if rule.Replacement != "" && rule.Action != ActionReplace {
+        return fmt.Errorf("only replace rules take a replacement")
+    }
+    _, err := compile(rule)
+    return err
+}
+
+func compile(rule *models.FilterRule) (*regexp.Regexp, error) {
+    switch rule.Kind {
+    case KindWords:
+        var words []string
+        for _, word := range strings.Split(rule.Pattern, ",") {
+            if word = strings.TrimSpace(word); word != "" {
+                words = append(words, regexp.QuoteMeta(word))
+            }
+        }
+        if len(words) == 0 {
+            return nil, fmt.Errorf("word list is empty")
+        }
+        return regexp.Compile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+    case KindRegex:
+        re, err := regexp.Compile(rule.Pattern)
+        if err != nil {
+            return nil, fmt.Errorf("invalid pattern: %w", err)
+        }
+        return re, nil
+    default:
+        return nil, fmt.Errorf("unknown filter kind: %s", rule.Kind)
+    }
+}
+
+type compiledRule struct {
+    rule *models.FilterRule
+    re   *regexp.Regexp
+}
+
+// Filter is a compiled, read-only set of rules.
+type Filter struct {
+    global   []compiledRule
+    channels map[int64][]compiledRule
+}
+
+// New compiles rules. A rule that no longer compiles is logged and left
+// out rather than failing the whole set.
+func New(rules []*models.FilterRule) *Filter {
+    f := &Filter{channels: make(map[int64][]compiledRule)}
+
+    for _, rule := range rules {
+        re, err := compile(rule)
+        if err != nil {
+            log.Printf("Skipping filter rule %d: %v", rule.RuleID, err)
+            continue
+        }
+
+        if rule.ChannelID == nil {
+            f.global = append(f.global, compiledRule{rule: rule, re: re})
+        } else {
+            f.channels[*rule.ChannelID] = append(f.channels[*rule.ChannelID], compiledRule{rule: rule, re: re})
+        }
+    }
+
+    return f
+}
+
+// Result is the outcome of Check. Text is the message to deliver, after
+// any replacements; Warned and Reported list the warn and report rules
+// that matched it.
+type Result struct {
+    Text     string
+    Blocked  *models.FilterRule
+    Mute     bool
+    Warned   []*models.FilterRule
+    Reported []*models.FilterRule
+}
+
+// Check runs text through the rules of channelID (0 for a direct message)
+// and then the global rules, in the order they were added. The first
+// block, mute or allow rule that matches ends the check.
+func (f *Filter) Check(channelID int64, text string) *Result {
+    result := &Result{Text: text}
+    if f == nil {
+        return result
+    }
+
+    rules := append(append([]compiledRule(nil), f.channels[channelID]...), f.global...)
+    for _, r := range rules {
+        if !r.re.MatchString(result.Text) {
+            continue
+        }
+
+        switch r.rule.Action {
+        case ActionAllow:
+            return result
+        case ActionBlock:
+            result.Blocked = r.rule
+            return result
+        case ActionMute:
+            result.Blocked = r.rule
+            result.Mute = true
+            return result
+        case ActionReplace:
+            replacement := r.rule.Replacement
+            if replacement == "" {
+                replacement = defaultReplacement
+            }
+            result.Text = r.re.ReplaceAllLiteralString(result.Text, replacement)
+        case ActionWarn:
+            result.Warned = append(result.Warned, r.rule)
+        case ActionReport:
+            result.Reported = append(result.Reported, r.rule)
+        }
+    }
+
+    return result
+}
@@ -0,0 +1,148 @@
+// Package numerics maps command failures to the numeric replies standard
+// IRC clients understand, instead of free-form ERROR lines.
+package numerics
+
+import (
+    "fmt"
+    "strings"
+)
+
+const (
+    ErrNoSuchNick        = "401"
+    ErrNoSuchChannel     = "403"
+    ErrCannotSendToChan  = "404"
+    ErrTooManyChannels   = "405"
+    ErrUnknownCommand    = "421"
+    ErrErroneusNickname  = "432"
+    ErrNicknameInUse     = "433"
+    ErrUserNotInChannel  = "441"
+    ErrNotOnChannel      = "442"
+    ErrNotRegistered     = "451"
+    ErrNeedMoreParams    = "461"
+    ErrAlreadyRegistered = "462"
+    ErrPasswdMismatch    = "464"
+    ErrChannelIsFull     = "471"
+    ErrInviteOnlyChan    = "473"
+    ErrBannedFromChan    = "474"
+    ErrBadChannelKey     = "475"
+    ErrBadChanName       = "479"
+    ErrNoPrivileges      = "481"
+    ErrChanOPrivsNeeded  = "482"
+)
+
+// Error is a command failure that is reported to the client as a numeric
+// reply. Params come between the client's nick and the trailing text.
+type Error struct {
+    Code   string
+    Params []string
+    Text   string
+}
+
+func (e *Error) Error() string {
+    if len(e.Params) == 0 {
+        return e.Text
+    }
+    return strings.Join(e.Params, " ") + ": " + e.Text
+}
+
+// Reply formats the error as sent by server to nick; nick is "*" before
+// the client has logged in.
+func (e *Error) Reply(server, nick string) string {
+    if nick == "" {
+        nick = "*"
+    }
+
+    params := ""
+    if len(e.Params) > 0 {
+        params = " " + strings.Join(e.Params, " ")
+    }
+    return fmt.Sprintf(":%s %s %s%s :%s", server, e.Code, nick, params, e.Text)
+}
+
+func New(code, text string, params ...string) *Error {
+    return &Error{Code: code, Params: params, Text: text}
+}
+
+func NoSuchNick(nick string) *Error {
+    return New(ErrNoSuchNick, "No such nick", nick)
+}
+
+func NoSuchChannel(channel string) *Error {
+    return New(ErrNoSuchChannel, "No such channel", channel)
+}
+
+func CannotSendToChan(channel, reason string) *Error {
+    return New(ErrCannotSendToChan, "Cannot send to channel ("+reason+")", channel)
+}
+
+func TooManyChannels(channel string) *Error {
+    return New(ErrTooManyChannels, "You have joined too many channels", channel)
+}
+
+func UnknownCommand(command string) *Error {
+    return New(ErrUnknownCommand, "Unknown command", command)
+}
+
+func ErroneusNickname(nick, reason string) *Error {
+    return New(ErrErroneusNickname, "Erroneous nickname ("+reason+")", nick)
+}
+
+func NicknameInUse(nick string) *Error {
+    return New(ErrNicknameInUse, "Nickname is already in use", nick)
+}
+
+func UserNotInChannel(nick, channel string) *Error {
+    return New(ErrUserNotInChannel, "They aren't on that channel", nick, channel)
+}
+
+func NotOnChannel(channel string) *Error {
+    return New(ErrNotOnChannel, "You're not on that channel", channel)
+}
+
+func NotRegistered() *Error {
+    return New(ErrNotRegistered, "You have not registered")
+}
+
+// NeedMoreParams carries the command's usage as its text, since this server
+// has commands that standard clients do not know.
+func NeedMoreParams(command, usage string) *Error {
+    return New(ErrNeedMoreParams, "Not enough parameters (usage: "+usage+")", command)
+}
+
+func AlreadyRegistered() *Error {
+    return New(ErrAlreadyRegistered, "You may not reregister")
+}
+
+func PasswdMismatch() *Error {
+    return New(ErrPasswdMismatch, "Password incorrect")
+}
+
+func ChannelIsFull(channel string) *Error {
+    return New(ErrChannelIsFull, "Cannot join channel (+l)", channel)
+}
+
+func InviteOnlyChan(channel string) *Error {
+    return New(ErrInviteOnlyChan, "Cannot join channel (+i)", channel)
+}
+
+func BannedFromChan(channel string) *Error {
+    return New(ErrBannedFromChan, "Cannot join channel (+b)", channel)
+}
+
+func BadChannelKey(channel string) *Error {
+    return New(ErrBadChannelKey, "Cannot join channel (+k)", channel)
+}
+
+// BadChanName is not in RFC 2812 but is what most servers send for a
+// channel name they refuse.
+func BadChanName(channel, reason string) *Error {
+    return New(ErrBadChanName, "Illegal channel name ("+reason+")", channel)
+}
+
+func NoPrivileges() *Error {
+    return New(ErrNoPrivileges, "Permission Denied- You're not an IRC operator")
+}
+
+func ChanOPrivsNeeded(channel string) *Error {
+    return New(ErrChanOPrivsNeeded, "You're not channel operator", channel)
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+    "fmt"
+    "log"
+    "strings"
+)
+
+// Broadcast carries out ADMIN broadcast: a notice to every user, also
+// posted to the announcement channel when one is configured so it stays
+// in that channel's history. The server always loads it, and schedules
+// broadcasts itself (ADMIN broadcast at|every|list|cancel), sending them
+// through Deliver.
+type Broadcast struct {
+    host    Host
+    channel func() string
+}
+
+// NewBroadcast takes the announcement channel as a function so that a
+// rehash changing it takes effect.
+func NewBroadcast(announcementChannel func() string) *Broadcast {
+    return &Broadcast{channel: announcementChannel}
+}
+
+func (b *Broadcast) Name() string {
+    return "broadcast"
+}
+
+func (b *Broadcast) Init(host Host) error {
+    b.host = host
+    return nil
+}
+
+func (b *Broadcast) OnCommand(event *CommandEvent) error {
+    if event.Command != "ADMIN" || len(event.Params) == 0 || !strings.EqualFold(event.Params[0], "broadcast") {
+        return nil
+    }
+
+    if len(event.Params) < 2 {
+        return fmt.Errorf("usage: ADMIN broadcast <message>")
+    }
+
+    switch strings.ToLower(event.Params[1]) {
+    case "at", "every", "list", "cancel":
+        return nil
+    }
+
+    message := strings.Join(event.Params[1:], " ")
+
+    if err := b.host.AdminAction(event.UserID, "broadcast", fmt.Sprintf("Broadcast message: %s", message)); err != nil {
+        return err
+    }
+
+    b.Deliver(event.Username, message)
+
+    log.Printf("Admin %s broadcast message: %s", event.Username, message)
+
+    return ErrHandled
+}
+
+// Deliver sends message to every user and posts it to the announcement
+// channel as username, if they are connected.
+func (b *Broadcast) Deliver(username, message string) {
+    b.host.Broadcast(message)
+
+    if channel := b.channel(); channel != "" {
+        if err := b.host.Post(username, channel, message); err != nil {
+            log.Printf("Broadcast not posted to %s: %v", channel, err)
+        }
+    }
+}
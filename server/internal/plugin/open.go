@@ -0,0 +1,31 @@
+package plugin
+
+import (
+    "fmt"
+    goplugin "plugin"
+)
+
+// Open loads a Go plugin file built with -buildmode=plugin against the
+// same server version. The file must export
+//
+//	var Plugin plugin.Plugin = ...
+//
+// Go plugins need cgo and are only supported on Linux, FreeBSD and macOS.
+func Open(path string) (Plugin, error) {
+    lib, err := goplugin.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open plugin %s: %w", path, err)
+    }
+
+    symbol, err := lib.Lookup("Plugin")
+    if err != nil {
+        return nil, fmt.Errorf("plugin %s does not export Plugin: %w", path, err)
+    }
+
+    p, ok := symbol.(*Plugin)
+    if !ok || *p == nil {
+        return nil, fmt.Errorf("plugin %s: Plugin is a %T, not a plugin.Plugin", path, symbol)
+    }
+
+    return *p, nil
+}
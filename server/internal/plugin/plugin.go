@@ -0,0 +1,252 @@
+// Package plugin lets server-side extensions inspect, change or refuse
+// events at a few hook points without forking the server. Plugins are
+// either compiled in and registered with Register, or loaded from Go
+// plugin files at startup.
+package plugin
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+)
+
+// Plugin is the base every plugin implements. It takes part in an event by
+// also implementing the matching hook interface.
+type Plugin interface {
+    Name() string
+}
+
+// Initializer is implemented by plugins that need the Host; Init is called
+// once, before any hook runs.
+type Initializer interface {
+    Init(host Host) error
+}
+
+// Host is the part of the server plugins may act on.
+type Host interface {
+    ServerName() string
+
+    // Notice sends a server NOTICE to every session of username.
+    Notice(username, text string)
+
+    // Broadcast sends a server NOTICE to every connected user.
+    Broadcast(text string)
+
+    // Post sends text to a channel as username, who must be connected to
+    // this server, with the same delivery and storage as their own
+    // PRIVMSG.
+    Post(username, channel, text string) error
+
+    // AdminAction checks that userID is an admin and records the action
+    // in the admin log.
+    AdminAction(userID int64, action, details string) error
+}
+
+// LoginEvent is a user whose credentials have been verified, or who is
+// resuming a session, before the session is attached. Refusing it refuses
+// the login or RESUME.
+type LoginEvent struct {
+    UserID    int64
+    Username  string
+    IPAddress string
+    IsAdmin   bool
+    IsBot     bool
+}
+
+// JoinEvent is a JOIN by a logged-in user. Channel may be changed.
+type JoinEvent struct {
+    UserID   int64
+    Username string
+    Channel  string
+}
+
+// MessageEvent is a PRIVMSG to a channel or a user. Text may be changed.
+type MessageEvent struct {
+    UserID   int64
+    Username string
+    Target   string
+    Text     string
+}
+
+// CommandEvent is a command line from a client, before it is dispatched.
+// UserID is 0 before login. Params may be changed; Reply sends a line back
+// to the client.
+type CommandEvent struct {
+    UserID   int64
+    Username string
+    IsAdmin  bool
+    Command  string
+    Params   []string
+    Reply    func(line string)
+}
+
+type LoginHook interface {
+    OnLogin(event *LoginEvent) error
+}
+
+type JoinHook interface {
+    OnJoin(event *JoinEvent) error
+}
+
+type MessageHook interface {
+    OnMessage(event *MessageEvent) error
+}
+
+type CommandHook interface {
+    OnCommand(event *CommandEvent) error
+}
+
+// ErrHandled is returned by OnCommand when the plugin has carried out the
+// command itself; the server then does nothing more with it. Any other
+// error refuses the event and is reported to the client.
+var ErrHandled = errors.New("handled by plugin")
+
+var (
+    registryMu sync.Mutex
+    registry   = make(map[string]Plugin)
+)
+
+// Register makes a compiled-in plugin available under its name, usually
+// from an init function. It is only run if plugins.enabled lists it.
+func Register(p Plugin) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if _, exists := registry[p.Name()]; exists {
+        panic("plugin: Register called twice for " + p.Name())
+    }
+    registry[p.Name()] = p
+}
+
+// Registered returns the names of the compiled-in plugins.
+func Registered() []string {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func registered(name string) (Plugin, bool) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    p, ok := registry[name]
+    return p, ok
+}
+
+// Manager runs the hooks of the loaded plugins in load order. The first
+// hook to return an error stops the event.
+type Manager struct {
+    plugins []Plugin
+    login   []LoginHook
+    join    []JoinHook
+    message []MessageHook
+    command []CommandHook
+}
+
+// NewManager loads builtin, then the compiled-in plugins named in enabled,
+// then the Go plugin files in paths, and initializes each with host.
+func NewManager(host Host, builtin []Plugin, enabled, paths []string) (*Manager, error) {
+    plugins := append([]Plugin(nil), builtin...)
+
+    for _, name := range enabled {
+        p, ok := registered(name)
+        if !ok {
+            return nil, fmt.Errorf("unknown plugin: %s", name)
+        }
+        plugins = append(plugins, p)
+    }
+
+    for _, path := range paths {
+        p, err := Open(path)
+        if err != nil {
+            return nil, err
+        }
+        plugins = append(plugins, p)
+    }
+
+    m := &Manager{}
+    seen := make(map[string]bool)
+    for _, p := range plugins {
+        if seen[p.Name()] {
+            return nil, fmt.Errorf("plugin %s is loaded twice", p.Name())
+        }
+        seen[p.Name()] = true
+
+        if initializer, ok := p.(Initializer); ok {
+            if err := initializer.Init(host); err != nil {
+                return nil, fmt.Errorf("failed to initialize plugin %s: %w", p.Name(), err)
+            }
+        }
+        m.add(p)
+    }
+
+    return m, nil
+}
+
+func (m *Manager) add(p Plugin) {
+    m.plugins = append(m.plugins, p)
+    if hook, ok := p.(LoginHook); ok {
+        m.login = append(m.login, hook)
+    }
+    if hook, ok := p.(JoinHook); ok {
+        m.join = append(m.join, hook)
+    }
+    if hook, ok := p.(MessageHook); ok {
+        m.message = append(m.message, hook)
+    }
+    if hook, ok := p.(CommandHook); ok {
+        m.command = append(m.command, hook)
+    }
+}
+
+// Names returns the loaded plugins in load order.
+func (m *Manager) Names() []string {
+    names := make([]string, len(m.plugins))
+    for i, p := range m.plugins {
+        names[i] = p.Name()
+    }
+    return names
+}
+
+func (m *Manager) OnLogin(event *LoginEvent) error {
+    for _, hook := range m.login {
+        if err := hook.OnLogin(event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (m *Manager) OnJoin(event *JoinEvent) error {
+    for _, hook := range m.join {
+        if err := hook.OnJoin(event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (m *Manager) OnMessage(event *MessageEvent) error {
+    for _, hook := range m.message {
+        if err := hook.OnMessage(event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (m *Manager) OnCommand(event *CommandEvent) error {
+    for _, hook := range m.command {
+        if err := hook.OnCommand(event); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+)
+
+type ElasticsearchIndex struct {
+    baseURL  string
+    index    string
+    username string
+    password string
+    client   *http.Client
+}
+
+func NewElasticsearchIndex(baseURL, index, username, password string) (*ElasticsearchIndex, error) {
+    if baseURL == "" {
+        return nil, fmt.Errorf("elasticsearch_url is required for the elasticsearch backend")
+    }
+    if index == "" {
+        index = "onyxirc-messages"
+    }
+
+    return &ElasticsearchIndex{
+        baseURL:  strings.TrimRight(baseURL, "/"),
+        index:    index,
+        username: username,
+        password: password,
+        client:   &http.Client{Timeout: 10 * time.Second},
+    }, nil
+}
+
+func (es *ElasticsearchIndex) Index(doc Document) error {
+    path := fmt.Sprintf("/%s/_doc/%d", es.index, doc.MessageID)
+    return es.do(http.MethodPut, path, doc, nil)
+}
+
+func (es *ElasticsearchIndex) Delete(messageID int64) error {
+    path := fmt.Sprintf("/%s/_doc/%d", es.index, messageID)
+    err := es.do(http.MethodDelete, path, nil, nil)
+    if isNotFound(err) {
+        return nil
+    }
+    return err
+}
+
+func (es *ElasticsearchIndex) Search(query Query) ([]Hit, error) {
+    if len(query.Terms) == 0 {
+        return nil, fmt.Errorf("empty search query")
+    }
+
+    limit := query.Limit
+    if limit <= 0 {
+        limit = 50
+    }
+
+    boolQuery := map[string]interface{}{
+        "must": map[string]interface{}{
+            "match": map[string]interface{}{
+                "terms": map[string]interface{}{
+                    "query":    strings.Join(query.Terms, " "),
+                    "operator": "and",
+                },
+            },
+        },
+    }
+    if len(query.ChannelIDs) > 0 {
+        boolQuery["filter"] = []interface{}{
+            map[string]interface{}{
+                "terms": map[string]interface{}{"channel_id": query.ChannelIDs},
+            },
+        }
+    }
+
+    request := map[string]interface{}{
+        "size":    limit,
+        "query":   map[string]interface{}{"bool": boolQuery},
+        "_source": []string{"message_id", "channel_id", "user_id", "sent_at"},
+    }
+
+    var response struct {
+        Hits struct {
+            Hits []struct {
+                Score  float64  `json:"_score"`
+                Source Document `json:"_source"`
+            } `json:"hits"`
+        } `json:"hits"`
+    }
+
+    if err := es.do(http.MethodPost, fmt.Sprintf("/%s/_search", es.index), request, &response); err != nil {
+        return nil, err
+    }
+
+    hits := make([]Hit, 0, len(response.Hits.Hits))
+    for _, hit := range response.Hits.Hits {
+        hits = append(hits, Hit{
+            MessageID: hit.Source.MessageID,
+            ChannelID: hit.Source.ChannelID,
+            UserID:    hit.Source.UserID,
+            SentAt:    hit.Source.SentAt,
+            Score:     hit.Score,
+        })
+    }
+
+    return hits, nil
+}
+
+func (es *ElasticsearchIndex) Reset() error {
+    err := es.do(http.MethodDelete, "/"+es.index, nil, nil)
+    if isNotFound(err) {
+        return nil
+    }
+    return err
+}
+
+func (es *ElasticsearchIndex) Flush() error {
+    err := es.do(http.MethodPost, fmt.Sprintf("/%s/_refresh", es.index), nil, nil)
+    if isNotFound(err) {
+        return nil
+    }
+    return err
+}
+
+func (es *ElasticsearchIndex) Close() error {
+    es.client.CloseIdleConnections()
+    return nil
+}
+
+type statusError struct {
+    status int
+    body   string
+}
+
+func (e *statusError) Error() string {
+    return fmt.Sprintf("elasticsearch returned %d: %s", e.status, e.body)
+}
+
+func isNotFound(err error) bool {
+    statusErr, ok := err.(*statusError)
+    return ok && statusErr.status == http.StatusNotFound
+}
+
+func (es *ElasticsearchIndex) do(method, path string, body, result interface{}) error {
+    var reader io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return fmt.Errorf("failed to encode request: %w", err)
+        }
+        reader = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequest(method, es.baseURL+path, reader)
+    if err != nil {
+        return fmt.Errorf("failed to build request: %w", err)
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if es.username != "" {
+        req.SetBasicAuth(es.username, es.password)
+    }
+
+    resp, err := es.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("elasticsearch request failed: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return &statusError{status: resp.StatusCode, body: string(data)}
+    }
+
+    if result != nil {
+        if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+            return fmt.Errorf("failed to decode elasticsearch response: %w", err)
+        }
+    }
+
+    return nil
+}
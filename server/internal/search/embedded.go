@@ -0,0 +1,247 @@
+package search
+
+import (
+    "encoding/gob"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+)
+
+// embeddedIndexVersion is written at the head of the index file. Files
+// without it predate keyed terms and hold the words of messages in the clear.
+const embeddedIndexVersion = 2
+
+type embeddedIndexFile struct {
+    Version int
+    Docs    map[int64]*embeddedDocument
+}
+
+type embeddedDocument struct {
+    ChannelID int64
+    UserID    int64
+    SentAt    time.Time
+    Terms     map[string]int
+}
+
+type EmbeddedIndex struct {
+    path     string
+    docs     map[int64]*embeddedDocument
+    postings map[string]map[int64]int
+    mu       sync.RWMutex
+}
+
+func OpenEmbeddedIndex(path string) (*EmbeddedIndex, error) {
+    if path == "" {
+        path = "data/search.idx"
+    }
+
+    idx := &EmbeddedIndex{
+        path:     path,
+        docs:     make(map[int64]*embeddedDocument),
+        postings: make(map[string]map[int64]int),
+    }
+
+    docs, err := loadEmbeddedIndex(path)
+    if err != nil {
+        return nil, err
+    }
+    if docs != nil {
+        idx.docs = docs
+    }
+
+    for messageID, doc := range idx.docs {
+        idx.addPostings(messageID, doc)
+    }
+
+    return idx, nil
+}
+
+// loadEmbeddedIndex reads the index file at path, if there is one. A file
+// in the old plaintext format is removed rather than loaded, leaving the
+// index empty until it is rebuilt with -reindex.
+func loadEmbeddedIndex(path string) (map[int64]*embeddedDocument, error) {
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open search index: %w", err)
+    }
+    defer file.Close()
+
+    var stored embeddedIndexFile
+    if err := gob.NewDecoder(file).Decode(&stored); err == nil && stored.Version == embeddedIndexVersion {
+        return stored.Docs, nil
+    }
+
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return nil, fmt.Errorf("failed to read search index: %w", err)
+    }
+    var legacy map[int64]*embeddedDocument
+    if err := gob.NewDecoder(file).Decode(&legacy); err != nil {
+        return nil, fmt.Errorf("failed to load search index: %w", err)
+    }
+
+    log.Printf("Removing search index %s: it holds message words in the clear; rebuild it with -reindex", path)
+    if err := os.Remove(path); err != nil {
+        return nil, fmt.Errorf("failed to remove plaintext search index: %w", err)
+    }
+    return nil, nil
+}
+
+func (idx *EmbeddedIndex) Index(doc Document) error {
+    terms := make(map[string]int)
+    for _, term := range doc.Terms {
+        terms[term]++
+    }
+
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+
+    idx.removeLocked(doc.MessageID)
+
+    entry := &embeddedDocument{
+        ChannelID: doc.ChannelID,
+        UserID:    doc.UserID,
+        SentAt:    doc.SentAt,
+        Terms:     terms,
+    }
+    idx.docs[doc.MessageID] = entry
+    idx.addPostings(doc.MessageID, entry)
+
+    return nil
+}
+
+func (idx *EmbeddedIndex) Delete(messageID int64) error {
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+
+    idx.removeLocked(messageID)
+    return nil
+}
+
+func (idx *EmbeddedIndex) Search(query Query) ([]Hit, error) {
+    terms := query.Terms
+    if len(terms) == 0 {
+        return nil, fmt.Errorf("empty search query")
+    }
+
+    idx.mu.RLock()
+    defer idx.mu.RUnlock()
+
+    total := float64(len(idx.docs))
+    scores := make(map[int64]float64)
+
+    for i, term := range terms {
+        postings := idx.postings[term]
+        idf := math.Log(1 + total/float64(len(postings)+1))
+
+        next := make(map[int64]float64)
+        for messageID, tf := range postings {
+            if i > 0 {
+                if _, matched := scores[messageID]; !matched {
+                    continue
+                }
+            }
+            if !channelAllowed(query.ChannelIDs, idx.docs[messageID].ChannelID) {
+                continue
+            }
+            next[messageID] = scores[messageID] + float64(tf)*idf
+        }
+        scores = next
+    }
+
+    hits := make([]Hit, 0, len(scores))
+    for messageID, score := range scores {
+        doc := idx.docs[messageID]
+        hits = append(hits, Hit{
+            MessageID: messageID,
+            ChannelID: doc.ChannelID,
+            UserID:    doc.UserID,
+            SentAt:    doc.SentAt,
+            Score:     score,
+        })
+    }
+
+    sort.Slice(hits, func(i, j int) bool {
+        if hits[i].Score != hits[j].Score {
+            return hits[i].Score > hits[j].Score
+        }
+        return hits[i].SentAt.After(hits[j].SentAt)
+    })
+
+    if query.Limit > 0 && len(hits) > query.Limit {
+        hits = hits[:query.Limit]
+    }
+
+    return hits, nil
+}
+
+func (idx *EmbeddedIndex) Reset() error {
+    idx.mu.Lock()
+    defer idx.mu.Unlock()
+
+    idx.docs = make(map[int64]*embeddedDocument)
+    idx.postings = make(map[string]map[int64]int)
+    return nil
+}
+
+func (idx *EmbeddedIndex) Flush() error {
+    idx.mu.RLock()
+    defer idx.mu.RUnlock()
+
+    if err := os.MkdirAll(filepath.Dir(idx.path), 0700); err != nil {
+        return fmt.Errorf("failed to create index directory: %w", err)
+    }
+
+    tmpPath := idx.path + ".tmp"
+    file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+    if err != nil {
+        return fmt.Errorf("failed to write search index: %w", err)
+    }
+
+    if err := gob.NewEncoder(file).Encode(embeddedIndexFile{Version: embeddedIndexVersion, Docs: idx.docs}); err != nil {
+        file.Close()
+        return fmt.Errorf("failed to encode search index: %w", err)
+    }
+
+    if err := file.Close(); err != nil {
+        return fmt.Errorf("failed to write search index: %w", err)
+    }
+
+    return os.Rename(tmpPath, idx.path)
+}
+
+func (idx *EmbeddedIndex) Close() error {
+    return idx.Flush()
+}
+
+func (idx *EmbeddedIndex) addPostings(messageID int64, doc *embeddedDocument) {
+    for term, tf := range doc.Terms {
+        if idx.postings[term] == nil {
+            idx.postings[term] = make(map[int64]int)
+        }
+        idx.postings[term][messageID] = tf
+    }
+}
+
+func (idx *EmbeddedIndex) removeLocked(messageID int64) {
+    doc, exists := idx.docs[messageID]
+    if !exists {
+        return
+    }
+
+    for term := range doc.Terms {
+        delete(idx.postings[term], messageID)
+        if len(idx.postings[term]) == 0 {
+            delete(idx.postings, term)
+        }
+    }
+    delete(idx.docs, messageID)
+}
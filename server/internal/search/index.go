@@ -0,0 +1,83 @@
+package search
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+const (
+    BackendEmbedded      = "embedded"
+    BackendElasticsearch = "elasticsearch"
+)
+
+// Document is a message as the index sees it. Terms are the message's words
+// already keyed per channel (see security.ChannelKeyManager.HashTerms), one
+// entry per occurrence, so no backend ever holds the text in the clear.
+type Document struct {
+    MessageID int64     `json:"message_id"`
+    ChannelID int64     `json:"channel_id"`
+    UserID    int64     `json:"user_id"`
+    Terms     []string  `json:"terms"`
+    SentAt    time.Time `json:"sent_at"`
+}
+
+// Query matches documents holding every one of Terms, keyed the same way as
+// the documents of the channels searched.
+type Query struct {
+    Terms      []string
+    ChannelIDs []int64
+    Limit      int
+}
+
+type Hit struct {
+    MessageID int64
+    ChannelID int64
+    UserID    int64
+    SentAt    time.Time
+    Score     float64
+}
+
+type Index interface {
+    Index(doc Document) error
+    Delete(messageID int64) error
+    Search(query Query) ([]Hit, error)
+    Reset() error
+    Flush() error
+    Close() error
+}
+
+func Open(cfg config.SearchConfig) (Index, error) {
+    switch strings.ToLower(cfg.Backend) {
+    case "", "none":
+        return nil, nil
+    case BackendEmbedded:
+        return OpenEmbeddedIndex(cfg.IndexPath)
+    case BackendElasticsearch:
+        return NewElasticsearchIndex(cfg.ElasticsearchURL, cfg.ElasticsearchIndex, cfg.ElasticsearchUsername, cfg.ElasticsearchPassword)
+    default:
+        return nil, fmt.Errorf("unknown search backend: %s", cfg.Backend)
+    }
+}
+
+func Tokenize(text string) []string {
+    return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+}
+
+func channelAllowed(channelIDs []int64, channelID int64) bool {
+    if len(channelIDs) == 0 {
+        return true
+    }
+
+    for _, id := range channelIDs {
+        if id == channelID {
+            return true
+        }
+    }
+    return false
+}
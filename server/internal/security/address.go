@@ -0,0 +1,45 @@
+package security
+
+import (
+    "net"
+    "strings"
+)
+
+// DefaultIPv6Prefix is how much of an IPv6 address identifies a client for
+// IP tracking. Hosts usually get a /64 and rotate addresses within it.
+const DefaultIPv6Prefix = 64
+
+// NormalizeIP returns an address in canonical form, with any brackets or
+// port removed and IPv4-mapped IPv6 addresses written as IPv4. Values that
+// are not addresses are returned unchanged.
+func NormalizeIP(address string) string {
+    if host, _, err := net.SplitHostPort(address); err == nil {
+        address = host
+    }
+
+    ip := net.ParseIP(strings.Trim(address, "[]"))
+    if ip == nil {
+        return address
+    }
+    return ip.String()
+}
+
+// SameNetwork reports whether two addresses belong to the same client: equal
+// IPv4 addresses, or IPv6 addresses sharing their first v6Prefix bits.
+func SameNetwork(a, b string, v6Prefix int) bool {
+    ipA := net.ParseIP(NormalizeIP(a))
+    ipB := net.ParseIP(NormalizeIP(b))
+    if ipA == nil || ipB == nil {
+        return a == b
+    }
+
+    if ipA.To4() != nil || ipB.To4() != nil {
+        return ipA.Equal(ipB)
+    }
+
+    if v6Prefix <= 0 || v6Prefix > 128 {
+        v6Prefix = DefaultIPv6Prefix
+    }
+    mask := net.CIDRMask(v6Prefix, 128)
+    return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
@@ -0,0 +1,154 @@
+package security
+
+import (
+    "crypto/hmac"
+    "crypto/rsa"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sync"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+)
+
+type ChannelKeyManager struct {
+    keyRepo       *database.ChannelKeyRepository
+    cryptoManager *auth.CryptoManager
+    keySize       int
+    keys          map[int64][]byte
+    mu            sync.Mutex
+}
+
+func NewChannelKeyManager(keyRepo *database.ChannelKeyRepository, cryptoManager *auth.CryptoManager, keySize int) *ChannelKeyManager {
+    return &ChannelKeyManager{
+        keyRepo:       keyRepo,
+        cryptoManager: cryptoManager,
+        keySize:       keySize,
+        keys:          make(map[int64][]byte),
+    }
+}
+
+// GetKey returns the channel's key, creating it on first use. A key is
+// generated only when none is stored; any other lookup error is returned,
+// since generating a key over an unreadable one would lose the history
+// encrypted with it. The database and RSA work runs outside the lock.
+func (m *ChannelKeyManager) GetKey(channelID int64) ([]byte, error) {
+    m.mu.Lock()
+    key, exists := m.keys[channelID]
+    m.mu.Unlock()
+    if exists {
+        return key, nil
+    }
+
+    encryptedKey, err := m.keyRepo.Get(channelID)
+    if errors.Is(err, sql.ErrNoRows) {
+        encryptedKey, err = m.createKey(channelID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    key, err = m.cryptoManager.DecryptWithPrivateKey(encryptedKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unwrap channel key: %w", err)
+    }
+
+    m.mu.Lock()
+    m.keys[channelID] = key
+    m.mu.Unlock()
+    return key, nil
+}
+
+// createKey stores a new key unless one appeared meanwhile and returns
+// whichever key won, so nodes racing on a new channel agree on one key.
+func (m *ChannelKeyManager) createKey(channelID int64) (string, error) {
+    key, err := m.cryptoManager.GenerateSessionKey(m.keySize)
+    if err != nil {
+        return "", fmt.Errorf("failed to generate channel key: %w", err)
+    }
+
+    wrapped, err := auth.EncryptWithPublicKey(m.cryptoManager.GetPublicKey(), key)
+    if err != nil {
+        return "", fmt.Errorf("failed to wrap channel key: %w", err)
+    }
+
+    if err := m.keyRepo.Create(channelID, wrapped); err != nil {
+        return "", err
+    }
+
+    return m.keyRepo.Get(channelID)
+}
+
+func (m *ChannelKeyManager) EncryptMessage(channelID int64, message string) (string, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return "", err
+    }
+
+    return m.cryptoManager.EncryptMessage(key, message)
+}
+
+func (m *ChannelKeyManager) DecryptMessage(channelID int64, encryptedMessage string) (string, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return "", err
+    }
+
+    return m.cryptoManager.DecryptMessage(key, encryptedMessage)
+}
+
+func (m *ChannelKeyManager) WrapKeyFor(channelID int64, publicKey *rsa.PublicKey) (string, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return "", err
+    }
+
+    return m.cryptoManager.EncryptSessionKey(publicKey, key)
+}
+
+// searchTermSize is how many bytes of each term's HMAC are kept.
+const searchTermSize = 16
+
+// HashTerms keys each search term with a key derived from the channel's,
+// so stored messages can be matched against a query without keeping their
+// words in the clear. The same word hashes differently in every channel.
+func (m *ChannelKeyManager) HashTerms(channelID int64, terms []string) ([]string, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return nil, err
+    }
+
+    termKey := auth.DeriveKey(key, "onyxirc-search-terms")
+
+    hashed := make([]string, 0, len(terms))
+    for _, term := range terms {
+        mac := hmac.New(sha256.New, termKey)
+        mac.Write([]byte(term))
+        hashed = append(hashed, hex.EncodeToString(mac.Sum(nil)[:searchTermSize]))
+    }
+    return hashed, nil
+}
+
+// MACMessage returns the message_hash stored with a channel message, an
+// HMAC under a key derived from the channel's. History replay checks it
+// with VerifyMessage, so a row rewritten in the database is not replayed.
+func (m *ChannelKeyManager) MACMessage(channelID int64, message string) (string, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return "", err
+    }
+
+    return auth.MACMessage(auth.DeriveKey(key, "onyxirc-message-mac"), message), nil
+}
+
+func (m *ChannelKeyManager) VerifyMessage(channelID int64, message, stored string) (bool, error) {
+    key, err := m.GetKey(channelID)
+    if err != nil {
+        return false, err
+    }
+
+    return auth.VerifyMessageMAC(auth.DeriveKey(key, "onyxirc-message-mac"), message, stored), nil
+}
@@ -0,0 +1,20 @@
+package security
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+)
+
+// CloakHost replaces an address with a keyed hash such as
+// "3F2A19C0.8D41E7B2.51C0A9FE.IP". The same address always cloaks to the
+// same host, so bans and ignores keep working, but without the secret the
+// address cannot be recovered by hashing candidate IPs.
+func CloakHost(secret, ipAddress string) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(NormalizeIP(ipAddress)))
+    sum := strings.ToUpper(hex.EncodeToString(mac.Sum(nil)))
+
+    return sum[0:8] + "." + sum[8:16] + "." + sum[16:24] + ".IP"
+}
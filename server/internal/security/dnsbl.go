@@ -0,0 +1,174 @@
+package security
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    defaultDNSBLTimeout  = 2 * time.Second
+    defaultDNSBLCacheTTL = time.Hour
+)
+
+// DNSBLZone is a DNS blocklist and what to do with addresses listed on it.
+type DNSBLZone struct {
+    Zone   string
+    Action string
+    Reason string
+}
+
+// DNSBLChecker looks connecting addresses up in DNS blocklists. All zones
+// are queried at once within a shared timeout; a zone that does not answer
+// in time counts as not listing the address.
+type DNSBLChecker struct {
+    zones     []DNSBLZone
+    timeout   time.Duration
+    ttl       time.Duration
+    lookup    func(ctx context.Context, host string) ([]string, error)
+    mu        sync.Mutex
+    cache     map[string]dnsblCacheEntry
+    lastPrune time.Time
+}
+
+type dnsblCacheEntry struct {
+    listings  []DNSBLZone
+    expiresAt time.Time
+}
+
+func NewDNSBLChecker(zones []DNSBLZone, timeout, cacheTTL time.Duration) *DNSBLChecker {
+    if timeout <= 0 {
+        timeout = defaultDNSBLTimeout
+    }
+    if cacheTTL <= 0 {
+        cacheTTL = defaultDNSBLCacheTTL
+    }
+
+    return &DNSBLChecker{
+        zones:     zones,
+        timeout:   timeout,
+        ttl:       cacheTTL,
+        lookup:    net.DefaultResolver.LookupHost,
+        cache:     make(map[string]dnsblCacheEntry),
+        lastPrune: time.Now(),
+    }
+}
+
+// Check returns the zones listing address. Loopback, private and other
+// non-public addresses are never looked up.
+func (c *DNSBLChecker) Check(address string) []DNSBLZone {
+    if c == nil || len(c.zones) == 0 {
+        return nil
+    }
+
+    ip := net.ParseIP(NormalizeIP(address))
+    if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+        return nil
+    }
+    key := ip.String()
+
+    now := time.Now()
+    c.mu.Lock()
+    c.prune(now)
+    if entry, exists := c.cache[key]; exists && now.Before(entry.expiresAt) {
+        c.mu.Unlock()
+        return entry.listings
+    }
+    c.mu.Unlock()
+
+    listings, complete := c.query(ip)
+
+    // A zone that timed out may still list the address, so only results
+    // every zone answered for are cached.
+    if complete {
+        c.mu.Lock()
+        c.cache[key] = dnsblCacheEntry{listings: listings, expiresAt: now.Add(c.ttl)}
+        c.mu.Unlock()
+    }
+
+    return listings
+}
+
+func (c *DNSBLChecker) query(ip net.IP) ([]DNSBLZone, bool) {
+    ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+    defer cancel()
+
+    name := reverseName(ip)
+    listed := make([]bool, len(c.zones))
+    failed := make([]bool, len(c.zones))
+
+    var wg sync.WaitGroup
+    for i, zone := range c.zones {
+        wg.Add(1)
+        go func(i int, zone DNSBLZone) {
+            defer wg.Done()
+
+            addrs, err := c.lookup(ctx, name+"."+strings.TrimSuffix(zone.Zone, "."))
+            if err != nil {
+                var dnsErr *net.DNSError
+                failed[i] = !errors.As(err, &dnsErr) || !dnsErr.IsNotFound
+                return
+            }
+            listed[i] = isListingAnswer(addrs)
+        }(i, zone)
+    }
+    wg.Wait()
+
+    var listings []DNSBLZone
+    complete := true
+    for i, zone := range c.zones {
+        if listed[i] {
+            listings = append(listings, zone)
+        }
+        if failed[i] {
+            complete = false
+        }
+    }
+    return listings, complete
+}
+
+// isListingAnswer reports whether a blocklist answer lists the address.
+// Zones answer with 127.0.0.x; anything else (such as a wildcard from a
+// hijacking resolver) is ignored.
+func isListingAnswer(addrs []string) bool {
+    for _, addr := range addrs {
+        ip := net.ParseIP(addr).To4()
+        if ip != nil && ip[0] == 127 {
+            return true
+        }
+    }
+    return false
+}
+
+// reverseName returns the blocklist query label for an address: the octets
+// of an IPv4 address or the nibbles of an IPv6 address, in reverse order.
+func reverseName(ip net.IP) string {
+    if v4 := ip.To4(); v4 != nil {
+        return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+    }
+
+    const hexDigits = "0123456789abcdef"
+    v6 := ip.To16()
+    labels := make([]string, 0, 32)
+    for i := len(v6) - 1; i >= 0; i-- {
+        labels = append(labels, string(hexDigits[v6[i]&0x0F]), string(hexDigits[v6[i]>>4]))
+    }
+    return strings.Join(labels, ".")
+}
+
+func (c *DNSBLChecker) prune(now time.Time) {
+    if now.Sub(c.lastPrune) < c.ttl {
+        return
+    }
+    c.lastPrune = now
+
+    for key, entry := range c.cache {
+        if !now.Before(entry.expiresAt) {
+            delete(c.cache, key)
+        }
+    }
+}
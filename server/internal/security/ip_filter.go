@@ -0,0 +1,149 @@
+package security
+
+import (
+    "fmt"
+    "net"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+// IPFilter decides whether a connecting address may talk to the server.
+// Static allow entries from the config always win, so operators cannot ban
+// themselves out; static deny entries and the ip_bans table refuse.
+type IPFilter struct {
+    mu    sync.RWMutex
+    allow []*net.IPNet
+    deny  []*net.IPNet
+    bans  []ipBanEntry
+}
+
+type ipBanEntry struct {
+    network   *net.IPNet
+    reason    string
+    expiresAt *time.Time
+}
+
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+    filter := &IPFilter{}
+    if err := filter.SetStatic(allow, deny); err != nil {
+        return nil, err
+    }
+    return filter, nil
+}
+
+// ParseCIDR accepts either a network in CIDR notation or a bare address,
+// which is treated as a single-host network.
+func ParseCIDR(value string) (*net.IPNet, error) {
+    value = strings.TrimSpace(value)
+
+    if strings.Contains(value, "/") {
+        _, network, err := net.ParseCIDR(value)
+        if err != nil {
+            return nil, fmt.Errorf("invalid network %q: %w", value, err)
+        }
+        return network, nil
+    }
+
+    ip := net.ParseIP(value)
+    if ip == nil {
+        return nil, fmt.Errorf("invalid address %q", value)
+    }
+
+    if v4 := ip.To4(); v4 != nil {
+        return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+    }
+    return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+    networks := make([]*net.IPNet, 0, len(values))
+    for _, value := range values {
+        network, err := ParseCIDR(value)
+        if err != nil {
+            return nil, err
+        }
+        networks = append(networks, network)
+    }
+    return networks, nil
+}
+
+func (f *IPFilter) SetStatic(allow, deny []string) error {
+    allowNets, err := parseNetworks(allow)
+    if err != nil {
+        return fmt.Errorf("ip_allow: %w", err)
+    }
+
+    denyNets, err := parseNetworks(deny)
+    if err != nil {
+        return fmt.Errorf("ip_deny: %w", err)
+    }
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    f.allow = allowNets
+    f.deny = denyNets
+    return nil
+}
+
+func (f *IPFilter) SetBans(bans []*models.IPBan) {
+    entries := make([]ipBanEntry, 0, len(bans))
+    for _, ban := range bans {
+        network, err := ParseCIDR(ban.CIDR)
+        if err != nil {
+            continue
+        }
+
+        entry := ipBanEntry{network: network, expiresAt: ban.ExpiresAt}
+        if ban.Reason != nil {
+            entry.reason = *ban.Reason
+        }
+        entries = append(entries, entry)
+    }
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    f.bans = entries
+}
+
+// Check reports whether address may connect, and if not, why.
+func (f *IPFilter) Check(address string) (bool, string) {
+    ip := net.ParseIP(NormalizeIP(address))
+    if ip == nil {
+        return true, ""
+    }
+
+    f.mu.RLock()
+    defer f.mu.RUnlock()
+
+    for _, network := range f.allow {
+        if network.Contains(ip) {
+            return true, ""
+        }
+    }
+
+    for _, network := range f.deny {
+        if network.Contains(ip) {
+            return false, "Your address is not permitted on this server"
+        }
+    }
+
+    now := time.Now()
+    for _, ban := range f.bans {
+        if ban.expiresAt != nil && now.After(*ban.expiresAt) {
+            continue
+        }
+        if ban.network.Contains(ip) {
+            if ban.reason == "" {
+                return false, "Your address is banned"
+            }
+            return false, "Your address is banned: " + ban.reason
+        }
+    }
+
+    return true, ""
+}
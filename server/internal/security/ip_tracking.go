@@ -3,27 +3,67 @@ package security
 import (
     "fmt"
     "log"
+    "net"
+    "sync/atomic"
 
     "github.com/onyxirc/server/internal/database"
     "github.com/onyxirc/server/internal/models"
 )
 
+// newAddressHistory is how many earlier successful logins IsNewAddress
+// compares against.
+const newAddressHistory = 20
+
+// MaxTrustedIPs is how many trusted addresses or networks an account may
+// have.
+const MaxTrustedIPs = 20
+
+const maxTrustedIPNote = 100
+
 type IPTrackingService struct {
     securityRepo   *database.SecurityRepository
-    maxSuspicion   int
+    trustedIPRepo  *database.TrustedIPRepository
+    maxSuspicion   int64
+    ipv6Prefix     int64
     enableTracking bool
 }
 
-func NewIPTrackingService(securityRepo *database.SecurityRepository, maxSuspicion int, enableTracking bool) *IPTrackingService {
+func NewIPTrackingService(securityRepo *database.SecurityRepository, trustedIPRepo *database.TrustedIPRepository, maxSuspicion int, enableTracking bool) *IPTrackingService {
     return &IPTrackingService{
         securityRepo:   securityRepo,
-        maxSuspicion:   maxSuspicion,
+        trustedIPRepo:  trustedIPRepo,
+        maxSuspicion:   int64(maxSuspicion),
+        ipv6Prefix:     DefaultIPv6Prefix,
         enableTracking: enableTracking,
     }
 }
 
+// SetMaxSuspicion changes how many IP changes are tolerated before an
+// account is locked, for ADMIN config.
+func (s *IPTrackingService) SetMaxSuspicion(maxSuspicion int) {
+    atomic.StoreInt64(&s.maxSuspicion, int64(maxSuspicion))
+}
+
+// SetIPv6Prefix changes how many leading bits of an IPv6 address must match
+// for a login to count as coming from the same place; 0 restores the
+// default of 64.
+func (s *IPTrackingService) SetIPv6Prefix(bits int) {
+    if bits <= 0 || bits > 128 {
+        bits = DefaultIPv6Prefix
+    }
+    atomic.StoreInt64(&s.ipv6Prefix, int64(bits))
+}
+
+func (s *IPTrackingService) sameAddress(a, b string) bool {
+    return SameNetwork(a, b, int(atomic.LoadInt64(&s.ipv6Prefix)))
+}
+
 func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) error {
     if !s.enableTracking {
+        // Locks placed with ACCOUNT LOCK or by an admin still apply.
+        if locked, err := s.securityRepo.IsAccountLocked(userID); err == nil && locked {
+            return fmt.Errorf("account is locked")
+        }
         return nil
     }
 
@@ -47,7 +87,14 @@ func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) erro
         return nil
     }
 
-    if *status.LastKnownIP != currentIP {
+    changed := !s.sameAddress(*status.LastKnownIP, currentIP)
+
+    if changed && s.isTrusted(userID, currentIP) {
+        log.Printf("IP change for user %d to trusted address %s", userID, currentIP)
+        if err := s.securityRepo.UpdateLastKnownIP(userID, currentIP); err != nil {
+            log.Printf("Warning: failed to update last known IP: %v", err)
+        }
+    } else if changed {
         log.Printf("IP change detected for user %d: %s -> %s", userID, *status.LastKnownIP, currentIP)
 
         newCount, err := s.securityRepo.IncrementSuspicionCount(userID)
@@ -55,9 +102,12 @@ func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) erro
             return fmt.Errorf("failed to increment suspicion count: %w", err)
         }
 
-        log.Printf("IP suspicion count for user %d: %d/%d", userID, newCount, s.maxSuspicion)
+        maxSuspicion := int(atomic.LoadInt64(&s.maxSuspicion))
+        log.Printf("IP suspicion count for user %d: %d/%d", userID, newCount, maxSuspicion)
+        s.recordEvent(models.SecurityEventSuspicion, userID, nil, currentIP,
+            fmt.Sprintf("Address changed from %s; suspicion %d/%d", *status.LastKnownIP, newCount, maxSuspicion))
 
-        if newCount > s.maxSuspicion {
+        if newCount > maxSuspicion {
 
             reason := fmt.Sprintf("Too many IP address changes (%d)", newCount)
             if err := s.securityRepo.LockAccount(userID, reason, nil); err != nil {
@@ -65,6 +115,7 @@ func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) erro
             }
 
             log.Printf("Account locked for user %d due to IP suspicion", userID)
+            s.recordEvent(models.SecurityEventLock, userID, nil, currentIP, reason)
             return fmt.Errorf("account locked due to suspicious activity: too many IP address changes")
         }
 
@@ -81,12 +132,14 @@ func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) erro
                 log.Printf("Warning: failed to get recent logins: %v", err)
             } else if len(recentLogins) >= 2 {
                 // Check if both recent logins are from the same IP (current IP)
-                if recentLogins[0].IPAddress == currentIP && recentLogins[1].IPAddress == currentIP {
+                if s.sameAddress(recentLogins[0].IPAddress, currentIP) && s.sameAddress(recentLogins[1].IPAddress, currentIP) {
                     newCount, err := s.securityRepo.DecrementSuspicionCount(userID)
                     if err != nil {
                         log.Printf("Warning: failed to decrement suspicion count: %v", err)
                     } else {
                         log.Printf("IP suspicion count decremented for user %d: %d (consecutive logins from same IP)", userID, newCount)
+                        s.recordEvent(models.SecurityEventSuspicion, userID, nil, currentIP,
+                            fmt.Sprintf("Suspicion lowered to %d after consecutive logins from the same address", newCount))
                     }
                 }
             }
@@ -96,12 +149,134 @@ func (s *IPTrackingService) CheckIPAndTrack(userID int64, currentIP string) erro
     return nil
 }
 
+// isTrusted reports whether ipAddress falls in one of the user's trusted
+// networks. Lookup failures count as untrusted.
+func (s *IPTrackingService) isTrusted(userID int64, ipAddress string) bool {
+    ip := net.ParseIP(NormalizeIP(ipAddress))
+    if ip == nil {
+        return false
+    }
+
+    trusted, err := s.trustedIPRepo.List(userID)
+    if err != nil {
+        log.Printf("Warning: failed to load trusted addresses: %v", err)
+        return false
+    }
+
+    for _, entry := range trusted {
+        if network, err := ParseCIDR(entry.CIDR); err == nil && network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// TrustIP adds an address or network to the user's trusted list, returning
+// it in normalised CIDR form. addedBy is the admin adding it for the user,
+// or nil.
+func (s *IPTrackingService) TrustIP(userID int64, value string, note string, addedBy *int64) (string, error) {
+    network, err := ParseCIDR(value)
+    if err != nil {
+        return "", err
+    }
+    cidr := network.String()
+
+    trusted, err := s.trustedIPRepo.List(userID)
+    if err != nil {
+        return "", err
+    }
+    for _, entry := range trusted {
+        if entry.CIDR == cidr {
+            return "", fmt.Errorf("%s is already trusted", cidr)
+        }
+    }
+    if len(trusted) >= MaxTrustedIPs {
+        return "", fmt.Errorf("at most %d trusted addresses are allowed", MaxTrustedIPs)
+    }
+
+    if len(note) > maxTrustedIPNote {
+        return "", fmt.Errorf("note must be at most %d characters", maxTrustedIPNote)
+    }
+
+    var notePtr *string
+    if note != "" {
+        notePtr = &note
+    }
+
+    if err := s.trustedIPRepo.Add(userID, cidr, notePtr, addedBy); err != nil {
+        return "", err
+    }
+    return cidr, nil
+}
+
+// UntrustIP removes an address or network from the user's trusted list.
+func (s *IPTrackingService) UntrustIP(userID int64, value string) (string, error) {
+    network, err := ParseCIDR(value)
+    if err != nil {
+        return "", err
+    }
+    cidr := network.String()
+
+    removed, err := s.trustedIPRepo.Remove(userID, cidr)
+    if err != nil {
+        return "", err
+    }
+    if removed == 0 {
+        return "", fmt.Errorf("%s is not trusted", cidr)
+    }
+    return cidr, nil
+}
+
+func (s *IPTrackingService) ListTrustedIPs(userID int64) ([]*models.TrustedIP, error) {
+    return s.trustedIPRepo.List(userID)
+}
+
+// IsNewAddress reports whether ipAddress is missing from the user's recent
+// successful logins. The login being completed has already been recorded,
+// so one match is expected; a user's first login is never reported.
+func (s *IPTrackingService) IsNewAddress(userID int64, ipAddress string) (bool, error) {
+    logins, err := s.securityRepo.GetRecentSuccessfulLogins(userID, newAddressHistory+1)
+    if err != nil {
+        return false, err
+    }
+
+    current := false
+    for _, login := range logins {
+        if !s.sameAddress(login.IPAddress, ipAddress) {
+            continue
+        }
+        if current {
+            return false, nil
+        }
+        current = true
+    }
+
+    return len(logins) > 1, nil
+}
+
+// LockAccount locks an account until an admin unlocks it. lockedBy is nil
+// for locks the server places itself.
+func (s *IPTrackingService) LockAccount(userID int64, reason string, lockedBy *int64) error {
+    if err := s.securityRepo.EnsureSecurityStatus(userID); err != nil {
+        return err
+    }
+
+    if err := s.securityRepo.LockAccount(userID, reason, lockedBy); err != nil {
+        return err
+    }
+
+    log.Printf("Account locked for user %d: %s", userID, reason)
+    s.recordEvent(models.SecurityEventLock, userID, lockedBy, "", reason)
+    return nil
+}
+
 func (s *IPTrackingService) UnlockAccount(userID int64) error {
     if err := s.securityRepo.UnlockAccount(userID); err != nil {
         return fmt.Errorf("failed to unlock account: %w", err)
     }
 
     log.Printf("Account unlocked for user %d", userID)
+    s.recordEvent(models.SecurityEventUnlock, userID, nil, "", "")
     return nil
 }
 
@@ -111,6 +286,7 @@ func (s *IPTrackingService) ResetSuspicionCount(userID int64) error {
     }
 
     log.Printf("IP suspicion count reset for user %d", userID)
+    s.recordEvent(models.SecurityEventSuspicionReset, userID, nil, "", "")
     return nil
 }
 
@@ -132,5 +308,14 @@ func (s *IPTrackingService) ManualLock(userID int64, reason string, adminID int6
     }
 
     log.Printf("Account manually locked for user %d by admin %d: %s", userID, adminID, reason)
+    s.recordEvent(models.SecurityEventLock, userID, &adminID, "", reason)
     return nil
 }
+
+// recordEvent adds to the security event log. A failure to record does not
+// undo the change it describes.
+func (s *IPTrackingService) recordEvent(eventType string, userID int64, actorID *int64, ipAddress, details string) {
+    if err := s.securityRepo.RecordEvent(eventType, &userID, actorID, ipAddress, details); err != nil {
+        log.Printf("Warning: %v", err)
+    }
+}
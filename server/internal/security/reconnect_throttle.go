@@ -0,0 +1,126 @@
+package security
+
+import (
+    "sync"
+    "time"
+)
+
+type ReconnectThrottle struct {
+    mu        sync.Mutex
+    window    time.Duration
+    burst     int
+    maxDelay  time.Duration
+    entries   map[string]*reconnectEntry
+    lastPrune time.Time
+}
+
+type reconnectEntry struct {
+    windowStart  time.Time
+    count        int
+    strikes      int
+    blockedUntil time.Time
+}
+
+func NewReconnectThrottle(window time.Duration, burst int, maxDelay time.Duration) *ReconnectThrottle {
+    if maxDelay <= 0 {
+        maxDelay = window
+    }
+
+    return &ReconnectThrottle{
+        window:    window,
+        burst:     burst,
+        maxDelay:  maxDelay,
+        entries:   make(map[string]*reconnectEntry),
+        lastPrune: time.Now(),
+    }
+}
+
+func (t *ReconnectThrottle) enabled() bool {
+    return t != nil && t.window > 0 && t.burst > 0
+}
+
+func (t *ReconnectThrottle) Attempt(key string) time.Duration {
+    if !t.enabled() {
+        return 0
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    t.prune(now)
+
+    entry := t.entry(key, now)
+    if now.Before(entry.blockedUntil) {
+        entry.count++
+        if entry.count > t.burst {
+            return t.block(entry, now)
+        }
+        return entry.blockedUntil.Sub(now)
+    }
+
+    if now.Sub(entry.windowStart) > t.window {
+        entry.windowStart = now
+        entry.count = 0
+        if now.After(entry.blockedUntil.Add(t.window)) {
+            entry.strikes = 0
+        }
+    }
+
+    entry.count++
+    if entry.count <= t.burst {
+        return 0
+    }
+
+    return t.block(entry, now)
+}
+
+func (t *ReconnectThrottle) Penalize(key string) time.Duration {
+    if !t.enabled() {
+        return 0
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    return t.block(t.entry(key, now), now)
+}
+
+func (t *ReconnectThrottle) entry(key string, now time.Time) *reconnectEntry {
+    entry, exists := t.entries[key]
+    if !exists {
+        entry = &reconnectEntry{windowStart: now}
+        t.entries[key] = entry
+    }
+    return entry
+}
+
+func (t *ReconnectThrottle) block(entry *reconnectEntry, now time.Time) time.Duration {
+    entry.strikes++
+
+    delay := t.maxDelay
+    if entry.strikes < 32 {
+        if d := time.Second << uint(entry.strikes); d < delay {
+            delay = d
+        }
+    }
+
+    entry.blockedUntil = now.Add(delay)
+    entry.windowStart = entry.blockedUntil
+    entry.count = 0
+    return delay
+}
+
+func (t *ReconnectThrottle) prune(now time.Time) {
+    if now.Sub(t.lastPrune) < t.window {
+        return
+    }
+    t.lastPrune = now
+
+    for key, entry := range t.entries {
+        if now.After(entry.blockedUntil.Add(t.window)) && now.Sub(entry.windowStart) > t.window {
+            delete(t.entries, key)
+        }
+    }
+}
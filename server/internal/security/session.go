@@ -4,22 +4,27 @@ import (
     "crypto/rand"
     "encoding/hex"
     "fmt"
+    "log"
     "sync"
     "time"
 
     "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
     "github.com/onyxirc/server/internal/models"
 )
 
+const sessionPersistInterval = time.Minute
+
 type Session struct {
     SessionID    string
     UserID       int64
     User         *models.User
     IPAddress    string
-    SessionKey   []byte 
+    SessionKey   *auth.KeyBuffer
     CreatedAt    time.Time
     LastActivity time.Time
     ExpiresAt    time.Time
+    persistedAt  time.Time
 }
 
 type SessionManager struct {
@@ -27,13 +32,19 @@ type SessionManager struct {
     userSessions   map[int64][]string  
     mu             sync.RWMutex
     sessionTimeout time.Duration
+    sessionRepo    *database.SessionRepository
+    cryptoManager  *auth.CryptoManager
+    lockKeys       bool
 }
 
-func NewSessionManager(sessionTimeout time.Duration) *SessionManager {
+func NewSessionManager(sessionTimeout time.Duration, sessionRepo *database.SessionRepository, cryptoManager *auth.CryptoManager, lockKeys bool) *SessionManager {
     sm := &SessionManager{
         sessions:       make(map[string]*Session),
         userSessions:   make(map[int64][]string),
         sessionTimeout: sessionTimeout,
+        sessionRepo:    sessionRepo,
+        cryptoManager:  cryptoManager,
+        lockKeys:       lockKeys,
     }
 
     go sm.cleanupExpiredSessions()
@@ -56,7 +67,7 @@ func (sm *SessionManager) CreateSession(user *models.User, ipAddress string, ses
         UserID:       user.UserID,
         User:         user,
         IPAddress:    ipAddress,
-        SessionKey:   sessionKey,
+        SessionKey:   auth.NewKeyBuffer(sessionKey, sm.lockKeys),
         CreatedAt:    now,
         LastActivity: now,
         ExpiresAt:    now.Add(sm.sessionTimeout),
@@ -69,9 +80,122 @@ func (sm *SessionManager) CreateSession(user *models.User, ipAddress string, ses
     }
     sm.userSessions[user.UserID] = append(sm.userSessions[user.UserID], sessionID)
 
+    sm.persistSession(session)
+
     return session, nil
 }
 
+func (sm *SessionManager) persistSession(session *Session) {
+    if sm.sessionRepo == nil {
+        return
+    }
+
+    wrappedKey, err := auth.EncryptWithPublicKey(sm.cryptoManager.GetPublicKey(), session.SessionKey.Bytes())
+    if err != nil {
+        log.Printf("Warning: failed to wrap session key: %v", err)
+        return
+    }
+
+    if err := sm.sessionRepo.Create(session.UserID, GetSessionHash(session.SessionID), session.ExpiresAt, session.IPAddress, wrappedKey); err != nil {
+        log.Printf("Warning: failed to persist session: %v", err)
+        return
+    }
+
+    session.persistedAt = time.Now()
+}
+
+func (sm *SessionManager) ResumeSession(sessionID, ipAddress string) (*Session, error) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    now := time.Now()
+
+    session, exists := sm.sessions[sessionID]
+    if exists && now.After(session.ExpiresAt) {
+        return nil, fmt.Errorf("session expired")
+    }
+
+    if !exists {
+        if sm.sessionRepo == nil {
+            return nil, fmt.Errorf("session not found")
+        }
+
+        token, err := sm.sessionRepo.GetValidByHash(GetSessionHash(sessionID))
+        if err != nil {
+            return nil, err
+        }
+
+        if token.SessionKey == nil {
+            return nil, fmt.Errorf("session cannot be resumed")
+        }
+
+        sessionKey, err := sm.cryptoManager.DecryptWithPrivateKey(*token.SessionKey)
+        if err != nil {
+            return nil, fmt.Errorf("failed to restore session key: %w", err)
+        }
+
+        session = &Session{
+            SessionID:   sessionID,
+            UserID:      token.UserID,
+            IPAddress:   token.IPAddress,
+            SessionKey:  auth.NewKeyBuffer(sessionKey, sm.lockKeys),
+            CreatedAt:   token.CreatedAt,
+            persistedAt: now,
+        }
+
+        sm.sessions[sessionID] = session
+        sm.userSessions[token.UserID] = append(sm.userSessions[token.UserID], sessionID)
+    }
+
+    session.IPAddress = ipAddress
+    session.LastActivity = now
+    session.ExpiresAt = now.Add(sm.sessionTimeout)
+
+    if sm.sessionRepo != nil {
+        if err := sm.sessionRepo.UpdateActivity(GetSessionHash(sessionID), session.ExpiresAt, ipAddress); err != nil {
+            log.Printf("Warning: failed to update session activity: %v", err)
+        }
+        session.persistedAt = now
+    }
+
+    return session, nil
+}
+
+// RotateKey gives a session a new key and returns it along with the one it
+// replaces, which the caller destroys once it is no longer needed. A key
+// from an ECDH exchange is forwardSecret: it is not stored wrapped with the
+// RSA key, since the RSA key and a database dump would then recover it, and
+// the stored key of the session is dropped instead. Such a session can only
+// be resumed on this process while it still holds the session in memory.
+func (sm *SessionManager) RotateKey(sessionID string, sessionKey []byte, forwardSecret bool) (current, previous *auth.KeyBuffer, err error) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    session, exists := sm.sessions[sessionID]
+    if !exists {
+        auth.Zero(sessionKey)
+        return nil, nil, fmt.Errorf("session not found")
+    }
+
+    previous = session.SessionKey
+    session.SessionKey = auth.NewKeyBuffer(sessionKey, sm.lockKeys)
+
+    if sm.sessionRepo != nil && forwardSecret {
+        if err := sm.sessionRepo.ClearKey(GetSessionHash(sessionID)); err != nil {
+            log.Printf("Warning: failed to clear stored session key: %v", err)
+        }
+    } else if sm.sessionRepo != nil {
+        wrappedKey, err := auth.EncryptWithPublicKey(sm.cryptoManager.GetPublicKey(), session.SessionKey.Bytes())
+        if err != nil {
+            log.Printf("Warning: failed to wrap session key: %v", err)
+        } else if err := sm.sessionRepo.UpdateKey(GetSessionHash(sessionID), wrappedKey); err != nil {
+            log.Printf("Warning: failed to persist session key: %v", err)
+        }
+    }
+
+    return session.SessionKey, previous, nil
+}
+
 func (sm *SessionManager) GetSession(sessionID string) (*Session, error) {
     sm.mu.RLock()
     defer sm.mu.RUnlock()
@@ -101,6 +225,13 @@ func (sm *SessionManager) UpdateActivity(sessionID string) error {
     session.LastActivity = now
     session.ExpiresAt = now.Add(sm.sessionTimeout)
 
+    if sm.sessionRepo != nil && now.Sub(session.persistedAt) >= sessionPersistInterval {
+        session.persistedAt = now
+        if err := sm.sessionRepo.UpdateActivity(GetSessionHash(sessionID), session.ExpiresAt, session.IPAddress); err != nil {
+            log.Printf("Warning: failed to update session activity: %v", err)
+        }
+    }
+
     return nil
 }
 
@@ -114,6 +245,7 @@ func (sm *SessionManager) DestroySession(sessionID string) error {
     }
 
     delete(sm.sessions, sessionID)
+    session.SessionKey.Destroy()
 
     userSessions := sm.userSessions[session.UserID]
     for i, sid := range userSessions {
@@ -127,6 +259,12 @@ func (sm *SessionManager) DestroySession(sessionID string) error {
         delete(sm.userSessions, session.UserID)
     }
 
+    if sm.sessionRepo != nil {
+        if err := sm.sessionRepo.Invalidate(GetSessionHash(sessionID)); err != nil {
+            log.Printf("Warning: failed to invalidate session: %v", err)
+        }
+    }
+
     return nil
 }
 
@@ -134,12 +272,21 @@ func (sm *SessionManager) DestroyUserSessions(userID int64) error {
     sm.mu.Lock()
     defer sm.mu.Unlock()
 
+    if sm.sessionRepo != nil {
+        if err := sm.sessionRepo.InvalidateUser(userID); err != nil {
+            log.Printf("Warning: failed to invalidate user sessions: %v", err)
+        }
+    }
+
     sessionIDs, exists := sm.userSessions[userID]
     if !exists {
         return nil 
     }
 
     for _, sessionID := range sessionIDs {
+        if session, exists := sm.sessions[sessionID]; exists {
+            session.SessionKey.Destroy()
+        }
         delete(sm.sessions, sessionID)
     }
 
@@ -148,6 +295,8 @@ func (sm *SessionManager) DestroyUserSessions(userID int64) error {
     return nil
 }
 
+// GetUserSessions returns copies of a user's live sessions, so their
+// activity times can be read without holding the manager's lock.
 func (sm *SessionManager) GetUserSessions(userID int64) []*Session {
     sm.mu.RLock()
     defer sm.mu.RUnlock()
@@ -160,13 +309,53 @@ func (sm *SessionManager) GetUserSessions(userID int64) []*Session {
     sessions := make([]*Session, 0, len(sessionIDs))
     for _, sessionID := range sessionIDs {
         if session, exists := sm.sessions[sessionID]; exists {
-            sessions = append(sessions, session)
+            snapshot := *session
+            sessions = append(sessions, &snapshot)
         }
     }
 
     return sessions
 }
 
+// Flush writes activity that UpdateActivity has not yet persisted, so every
+// live session can be resumed after a restart. It returns the number written.
+func (sm *SessionManager) Flush() int {
+    if sm.sessionRepo == nil {
+        return 0
+    }
+
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    now := time.Now()
+    flushed := 0
+    for sessionID, session := range sm.sessions {
+        if now.After(session.ExpiresAt) || !session.LastActivity.After(session.persistedAt) {
+            continue
+        }
+
+        if err := sm.sessionRepo.UpdateActivity(GetSessionHash(sessionID), session.ExpiresAt, session.IPAddress); err != nil {
+            log.Printf("Warning: failed to persist session activity: %v", err)
+            continue
+        }
+        session.persistedAt = now
+        flushed++
+    }
+
+    return flushed
+}
+
+// WipeKeys destroys the key material of every in-memory session. Persisted
+// sessions keep their wrapped keys and can still be resumed after a restart.
+func (sm *SessionManager) WipeKeys() {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    for _, session := range sm.sessions {
+        session.SessionKey.Destroy()
+    }
+}
+
 func (sm *SessionManager) GetActiveSessionCount() int {
     sm.mu.RLock()
     defer sm.mu.RUnlock()
@@ -193,6 +382,7 @@ func (sm *SessionManager) cleanupExpiredSessions() {
         for _, sessionID := range expiredSessions {
             session := sm.sessions[sessionID]
             delete(sm.sessions, sessionID)
+            session.SessionKey.Destroy()
 
             userSessions := sm.userSessions[session.UserID]
             for i, sid := range userSessions {
@@ -212,6 +402,12 @@ func (sm *SessionManager) cleanupExpiredSessions() {
         }
 
         sm.mu.Unlock()
+
+        if sm.sessionRepo != nil {
+            if _, err := sm.sessionRepo.InvalidateExpired(); err != nil {
+                log.Printf("Warning: failed to invalidate expired sessions: %v", err)
+            }
+        }
     }
 }
 
@@ -0,0 +1,311 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const (
+    defaultDeletionRetentionDays = 30
+    defaultPurgeInterval         = 6 * time.Hour
+)
+
+func (c *Client) handleAccount(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: ACCOUNT <DELETE <password>|EXPORT|LOCK>")
+    }
+
+    switch strings.ToUpper(parts[1]) {
+    case "DELETE":
+        return c.handleAccountDelete(parts[2:])
+    case "EXPORT":
+        return c.handleAccountExport()
+    case "LOCK":
+        return c.handleAccountLock()
+    default:
+        return fmt.Errorf("usage: ACCOUNT <DELETE <password>|EXPORT|LOCK>")
+    }
+}
+
+// handleAccountDelete soft-deletes the caller's account and ends every
+// session it has. IP history and direct messages are purged once the
+// retention window has passed.
+func (c *Client) handleAccountDelete(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ACCOUNT DELETE <password>")
+    }
+
+    if err := c.server.authService.DeleteAccount(c.user.UserID, args[0]); err != nil {
+        return err
+    }
+
+    user := c.user
+    notice := fmt.Sprintf(":%s NOTICE %s :Your account has been deleted. Login history and direct messages will be purged in %d days",
+        c.server.config.Server.ServerName, user.Username, c.server.deletionRetentionDays())
+
+    for _, client := range c.server.clientsForUser(user.UserID) {
+        client.Send(notice)
+        client.Send("ERROR :Account deleted")
+        client.endSession = true
+        go client.Disconnect()
+    }
+    c.server.sessionManager.DestroyUserSessions(user.UserID)
+
+    log.Printf("User %s (ID: %d) deleted their account", user.Username, user.UserID)
+
+    return nil
+}
+
+// handleAccountLock lets a user who sees a login they do not recognise
+// lock their own account and end every session it has, including this one.
+// Only an admin can unlock it again.
+func (c *Client) handleAccountLock() error {
+    user := c.user
+    reason := fmt.Sprintf("Locked by the account owner from %s", c.GetIPAddress())
+
+    if err := c.server.ipTrackingService.LockAccount(user.UserID, reason, &user.UserID); err != nil {
+        return err
+    }
+    c.server.adminService.RecordAutoAction("lock", user.UserID, fmt.Sprintf("%s locked their own account from %s", user.Username, c.GetIPAddress()))
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Your account is locked and all of its sessions have been ended. Contact an administrator to unlock it",
+        c.server.config.Server.ServerName, user.Username))
+
+    c.server.disconnectUser(user.Username, "ERROR :Account locked by its owner")
+    c.server.sessionManager.DestroyUserSessions(user.UserID)
+
+    log.Printf("User %s (ID: %d) locked their account", user.Username, user.UserID)
+
+    return nil
+}
+
+func (c *Client) handleAccountExport() error {
+    serverName := c.server.config.Server.ServerName
+    user := c.user
+
+    jobID := fmt.Sprintf("account-export-%d-%d", user.UserID, time.Now().UnixNano())
+
+    err := c.server.workerPool.SubmitPriority(jobID, threadpool.PriorityLow, func() error {
+        if _, err := c.server.exportStore.Prune(); err != nil {
+            log.Printf("Failed to prune old exports: %v", err)
+        }
+
+        account, err := c.server.buildAccountExport(user)
+        if err == nil {
+            var name string
+            name, err = c.server.exportStore.SaveAccount(account)
+            if err == nil {
+                log.Printf("User %s exported their account data", user.Username)
+                c.Send(fmt.Sprintf(":%s NOTICE %s :Account export ready: %s", serverName, user.Username, c.server.exportLocation(name)))
+                return nil
+            }
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Account export failed: %v", serverName, user.Username, err))
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("failed to queue export: %w", err)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Account export queued", serverName, user.Username))
+
+    return nil
+}
+
+func (s *Server) buildAccountExport(user *models.User) (*export.Account, error) {
+    limit := s.config.Export.MaxMessages
+    if limit <= 0 {
+        limit = s.config.Features.MaxMessageHistory
+    }
+
+    account := &export.Account{
+        Username:       user.Username,
+        CreatedAt:      user.CreatedAt,
+        LastLoginTime:  user.LastLoginTime,
+        GeneratedAt:    time.Now(),
+        Channels:       []export.AccountChannel{},
+        Messages:       []export.AccountMessage{},
+        DirectMessages: []export.AccountDirectEntry{},
+        Logins:         []export.AccountLogin{},
+    }
+
+    channelRepo := database.NewChannelRepository(s.db)
+    channels, err := channelRepo.GetUserChannels(user.UserID)
+    if err != nil {
+        return nil, err
+    }
+    for _, channel := range channels {
+        role, err := channelRepo.GetMemberRole(channel.ChannelID, user.UserID)
+        if err != nil {
+            role = "member"
+        }
+        account.Channels = append(account.Channels, export.AccountChannel{Channel: channel.ChannelName, Role: role})
+    }
+
+    messages, err := database.NewMessageRepository(s.db).ListByUser(user.UserID, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    channelNames := make(map[int64]string)
+    for _, message := range messages {
+        name, exists := channelNames[message.ChannelID]
+        if !exists {
+            name = "unknown"
+            if channel, err := channelRepo.GetByID(message.ChannelID); err == nil {
+                name = channel.ChannelName
+            }
+            channelNames[message.ChannelID] = name
+        }
+
+        content, err := s.channelKeys.DecryptMessage(message.ChannelID, message.MessageContent)
+        if err != nil {
+            log.Printf("Failed to decrypt message %d for account export: %v", message.MessageID, err)
+            continue
+        }
+
+        account.Messages = append(account.Messages, export.AccountMessage{
+            MessageID: message.MessageID,
+            Channel:   name,
+            Content:   content,
+            SentAt:    message.SentAt,
+        })
+    }
+
+    directMessages, err := database.NewDirectMessageRepository(s.db).ListForUser(user.UserID, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    usernames := make(map[int64]string)
+    for _, message := range directMessages {
+        direction, peerID := "sent", message.RecipientID
+        if message.RecipientID == user.UserID {
+            direction, peerID = "received", message.SenderID
+        }
+
+        peer, exists := usernames[peerID]
+        if !exists {
+            peer = "unknown"
+            if other, err := s.authService.GetUserByID(peerID); err == nil {
+                peer = other.Username
+            }
+            usernames[peerID] = peer
+        }
+
+        entry := export.AccountDirectEntry{
+            Direction: direction,
+            Peer:      peer,
+            SentAt:    message.SentAt,
+            Read:      message.IsRead,
+        }
+        if message.MessageHash != nil {
+            entry.Hash = *message.MessageHash
+        }
+        account.DirectMessages = append(account.DirectMessages, entry)
+    }
+
+    logins, err := database.NewSecurityRepository(s.db).GetLoginHistory(user.UserID, limit)
+    if err != nil {
+        return nil, err
+    }
+    for _, login := range logins {
+        account.Logins = append(account.Logins, export.AccountLogin{
+            IPAddress:  login.IPAddress,
+            Timestamp:  login.LoginTimestamp,
+            Successful: login.IsSuccessful,
+        })
+    }
+
+    return account, nil
+}
+
+func (s *Server) deletionRetentionDays() int {
+    if days := s.config.Accounts.DeletionRetentionDays; days > 0 {
+        return days
+    }
+    return defaultDeletionRetentionDays
+}
+
+func (s *Server) runAccountPurges() {
+    interval := s.config.Accounts.PurgeInterval
+    if interval <= 0 {
+        interval = defaultPurgeInterval
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            err := s.workerPool.SubmitPriority("account-purge", threadpool.PriorityLow, func() error {
+                purged, err := s.purgeDeletedAccounts()
+                if err != nil {
+                    log.Printf("Account purge failed: %v", err)
+                }
+                if purged > 0 {
+                    log.Printf("Account purge: %d deleted accounts purged", purged)
+                }
+                return err
+            })
+            if err != nil {
+                log.Printf("Failed to queue account purge: %v", err)
+            }
+        }
+    }
+}
+
+// purgeDeletedAccounts removes the IP history, direct messages and stored
+// sessions of accounts deleted more than the retention window ago, then
+// renames them to deleted-<id>. Channel messages stay, under the new name.
+func (s *Server) purgeDeletedAccounts() (int, error) {
+    userRepo := database.NewUserRepository(s.db)
+    securityRepo := database.NewSecurityRepository(s.db)
+    dmRepo := database.NewDirectMessageRepository(s.db)
+    sessionRepo := database.NewSessionRepository(s.db)
+
+    pending, err := userRepo.GetUsersPendingPurge(time.Now().AddDate(0, 0, -s.deletionRetentionDays()))
+    if err != nil {
+        return 0, fmt.Errorf("failed to load accounts pending purge: %w", err)
+    }
+
+    purged := 0
+    for _, user := range pending {
+        if _, err := securityRepo.DeleteIPHistory(user.UserID); err != nil {
+            log.Printf("Failed to purge IP history of %s: %v", user.Username, err)
+            continue
+        }
+        if _, err := dmRepo.DeleteForUser(user.UserID); err != nil {
+            log.Printf("Failed to purge direct messages of %s: %v", user.Username, err)
+            continue
+        }
+        if err := sessionRepo.DeleteUser(user.UserID); err != nil {
+            log.Printf("Failed to purge sessions of %s: %v", user.Username, err)
+            continue
+        }
+        if err := userRepo.Anonymize(user.UserID, fmt.Sprintf("deleted-%d", user.UserID)); err != nil {
+            log.Printf("Failed to anonymize %s: %v", user.Username, err)
+            continue
+        }
+
+        purged++
+        log.Printf("Purged deleted account %s (ID: %d)", user.Username, user.UserID)
+    }
+
+    return purged, nil
+}
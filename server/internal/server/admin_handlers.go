@@ -3,9 +3,21 @@ package server
 import (
     "fmt"
     "log"
+    "sort"
+    "strconv"
     "strings"
+    "time"
 
     "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const (
+    defaultAdminLogLimit = 10
+    maxAdminLogExport    = 10000
 )
 
 func (c *Client) handleAdminCommand(parts []string) error {
@@ -26,8 +38,24 @@ func (c *Client) handleAdminCommand(parts []string) error {
         return c.handleAdminBan(parts[2:])
     case "unban":
         return c.handleAdminUnban(parts[2:])
+    case "bans":
+        return c.handleAdminBans(parts[2:])
+    case "baninfo":
+        return c.handleAdminBanInfo(parts[2:])
+    case "ipban":
+        return c.handleAdminIPBan(parts[2:])
+    case "ipunban":
+        return c.handleAdminIPUnban(parts[2:])
+    case "ipbans":
+        return c.handleAdminIPBans(parts[2:])
     case "unlock":
         return c.handleAdminUnlock(parts[2:])
+    case "reactivate":
+        return c.handleAdminReactivate(parts[2:])
+    case "archivechannel":
+        return c.handleAdminArchiveChannel(parts[2:])
+    case "restorechannel":
+        return c.handleAdminRestoreChannel(parts[2:])
     case "makeadmin":
         return c.handleAdminMakeAdmin(parts[2:])
     case "removeadmin":
@@ -38,6 +66,34 @@ func (c *Client) handleAdminCommand(parts []string) error {
         return c.handleAdminStats(parts[2:])
     case "log":
         return c.handleAdminLog(parts[2:])
+    case "security":
+        return c.handleAdminSecurity(parts[2:])
+    case "shutdown":
+        return c.handleAdminStop(parts[2:], false)
+    case "restart":
+        return c.handleAdminStop(parts[2:], true)
+    case "lockdown":
+        return c.handleAdminLockdown(parts[2:])
+    case "evasion":
+        return c.handleAdminEvasion(parts[2:])
+    case "observer":
+        return c.handleAdminObserver(parts[2:])
+    case "bot":
+        return c.handleAdminBot(parts[2:])
+    case "filter":
+        return c.handleAdminFilter(parts[2:])
+    case "reports":
+        return c.handleAdminReports(parts[2:])
+    case "who":
+        return c.handleAdminWho(parts[2:])
+    case "killsession":
+        return c.handleAdminKillSession(parts[2:])
+    case "config":
+        return c.handleAdminConfig(parts[2:])
+    case "disable2fa":
+        return c.handleAdminDisable2FA(parts[2:])
+    case "trustip":
+        return c.handleAdminTrustIP(parts[2:])
     default:
         return fmt.Errorf("unknown admin command: %s", subcommand)
     }
@@ -55,15 +111,7 @@ func (c *Client) handleAdminKick(args []string) error {
         return err
     }
 
-    c.server.clientsMu.RLock()
-    for _, client := range c.server.clients {
-        if client.user != nil && client.user.Username == username {
-            client.Send(fmt.Sprintf("ERROR :Kicked by admin: %s", reason))
-            go client.Disconnect()
-            break
-        }
-    }
-    c.server.clientsMu.RUnlock()
+    c.server.EnforceKick(username, reason)
 
     c.Send(fmt.Sprintf(":%s NOTICE %s :User %s has been kicked", c.server.config.Server.ServerName, c.user.Username, username))
     log.Printf("Admin %s kicked user %s: %s", c.user.Username, username, reason)
@@ -73,7 +121,7 @@ func (c *Client) handleAdminKick(args []string) error {
 
 func (c *Client) handleAdminBan(args []string) error {
     if len(args) < 3 {
-        return fmt.Errorf("usage: ADMIN ban <username> <duration_seconds> <reason>")
+        return fmt.Errorf("usage: ADMIN ban <username> <duration> <reason>")
     }
 
     username := args[0]
@@ -89,19 +137,11 @@ func (c *Client) handleAdminBan(args []string) error {
         return err
     }
 
-    c.server.clientsMu.RLock()
-    for _, client := range c.server.clients {
-        if client.user != nil && client.user.Username == username {
-            client.Send(fmt.Sprintf("ERROR :Banned by admin: %s", reason))
-            go client.Disconnect()
-            break
-        }
-    }
-    c.server.clientsMu.RUnlock()
+    c.server.EnforceBan(c.user.UserID, username, reason, durationSeconds)
 
     banType := "permanently"
     if durationSeconds > 0 {
-        banType = fmt.Sprintf("for %d seconds", durationSeconds)
+        banType = "for " + admin.FormatDuration(durationSeconds)
     }
 
     c.Send(fmt.Sprintf(":%s NOTICE %s :User %s has been banned %s", c.server.config.Server.ServerName, c.user.Username, username, banType))
@@ -127,6 +167,74 @@ func (c *Client) handleAdminUnban(args []string) error {
     return nil
 }
 
+func (c *Client) handleAdminBans(args []string) error {
+    bans, err := c.server.adminService.ListBans(c.user.UserID)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Bans (%d) ===", serverName, c.user.Username, len(bans)))
+
+    for _, ban := range bans {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s by %s, %s: %s", serverName, c.user.Username,
+            ban.Username, ban.BannedByName, banRemaining(ban), banReason(ban)))
+    }
+
+    return nil
+}
+
+func (c *Client) handleAdminBanInfo(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN baninfo <username>")
+    }
+
+    target, bans, err := c.server.adminService.BanHistory(c.user.UserID, args[0])
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Bans for %s (%d) ===", serverName, c.user.Username, target.Username, len(bans)))
+
+    for _, ban := range bans {
+        length := "permanent"
+        if ban.ExpiresAt != nil {
+            length = admin.FormatDuration(int(ban.ExpiresAt.Sub(ban.BannedAt).Round(time.Second).Seconds()))
+        }
+
+        status := "lifted"
+        if ban.IsActive {
+            status = banRemaining(ban)
+        } else if ban.ExpiresAt != nil && !ban.ExpiresAt.After(time.Now()) {
+            status = "expired"
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :#%d %s by %s, %s, %s: %s", serverName, c.user.Username,
+            ban.BanID, ban.BannedAt.Format(time.RFC3339), ban.BannedByName, length, status, banReason(ban)))
+    }
+
+    return nil
+}
+
+func banRemaining(ban *models.UserBan) string {
+    if ban.ExpiresAt == nil {
+        return "permanent"
+    }
+    remaining := time.Until(*ban.ExpiresAt)
+    if remaining <= 0 {
+        return "expired"
+    }
+    return admin.FormatDuration(int(remaining.Round(time.Second).Seconds())) + " left"
+}
+
+func banReason(ban *models.UserBan) string {
+    if ban.Reason == nil || *ban.Reason == "" {
+        return "(no reason)"
+    }
+    return *ban.Reason
+}
+
 func (c *Client) handleAdminUnlock(args []string) error {
     if len(args) < 1 {
         return fmt.Errorf("usage: ADMIN unlock <username>")
@@ -144,6 +252,65 @@ func (c *Client) handleAdminUnlock(args []string) error {
     return nil
 }
 
+func (c *Client) handleAdminReactivate(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN reactivate <username>")
+    }
+
+    username := args[0]
+
+    if err := c.server.adminService.ReactivateUser(c.user.UserID, username); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :User %s has been reactivated", c.server.config.Server.ServerName, c.user.Username, username))
+    log.Printf("Admin %s reactivated user %s", c.user.Username, username)
+
+    return nil
+}
+
+func (c *Client) handleAdminArchiveChannel(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN archivechannel <channel>")
+    }
+
+    channelName := args[0]
+
+    if err := c.server.adminService.ArchiveChannel(c.user.UserID, channelName); err != nil {
+        return err
+    }
+    if channel, err := database.NewChannelRepository(c.server.db).GetByName(channelName); err == nil {
+        c.server.BroadcastToChannel(channel.ChannelID, fmt.Sprintf(":%s NOTICE %s :Channel archived by %s; its history is kept",
+            c.server.config.Server.ServerName, channelName, c.user.Username), "")
+        c.server.archivedChannel(channel.ChannelID)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Channel %s has been archived", c.server.config.Server.ServerName, c.user.Username, channelName))
+    log.Printf("Admin %s archived channel %s", c.user.Username, channelName)
+
+    return nil
+}
+
+func (c *Client) handleAdminRestoreChannel(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN restorechannel <channel>")
+    }
+
+    channelName := args[0]
+
+    if err := c.server.adminService.RestoreChannel(c.user.UserID, channelName); err != nil {
+        return err
+    }
+    if channel, err := database.NewChannelRepository(c.server.db).GetByName(channelName); err == nil {
+        c.server.restoredChannel(channel.ChannelID)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Channel %s has been restored", c.server.config.Server.ServerName, c.user.Username, channelName))
+    log.Printf("Admin %s restored channel %s", c.user.Username, channelName)
+
+    return nil
+}
+
 func (c *Client) handleAdminMakeAdmin(args []string) error {
     if len(args) < 1 {
         return fmt.Errorf("usage: ADMIN makeadmin <username>")
@@ -188,70 +355,228 @@ func (c *Client) handleAdminRemoveAdmin(args []string) error {
     return nil
 }
 
-func (c *Client) handleAdminBroadcast(args []string) error {
-    if len(args) < 1 {
-        return fmt.Errorf("usage: ADMIN broadcast <message>")
+func (c *Client) handleAdminStats(args []string) error {
+    stats, err := c.server.adminService.GetServerStats(c.user.UserID)
+    if err != nil {
+        return err
     }
 
-    message := strings.Join(args, " ")
+    serverName := c.server.config.Server.ServerName
+    var lines []string
+    notice := func(format string, values ...interface{}) {
+        lines = append(lines, fmt.Sprintf(":%s NOTICE %s :", serverName, c.user.Username)+fmt.Sprintf(format, values...))
+    }
 
-    if err := c.server.adminService.BroadcastMessage(c.user.UserID, message); err != nil {
-        return err
+    notice("=== Server Statistics ===")
+
+    for key, value := range stats {
+        notice("%s: %v", key, value)
+    }
+
+    notice("active_connections: %d", c.server.GetActiveClientCount())
+    notice("active_sessions: %d", c.server.sessionManager.GetActiveSessionCount())
+
+    if c.server.links != nil {
+        notice("linked_servers: %s", c.server.linkedServers())
+    }
+
+    if c.server.cluster != nil {
+        notice("cluster_nodes: %s", c.server.clusterNodes())
     }
 
-    broadcastMsg := fmt.Sprintf(":%s NOTICE * :[BROADCAST] %s", c.server.config.Server.ServerName, message)
+    metrics := c.server.Metrics()
+    keys := make([]string, 0, len(metrics))
+    for key := range metrics {
+        // Per-command metrics are summarised one line per command below.
+        if strings.HasPrefix(key, "command.") {
+            continue
+        }
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
 
-    c.server.clientsMu.RLock()
-    for _, client := range c.server.clients {
-        client.Send(broadcastMsg)
+    for _, key := range keys {
+        notice("%s: %d", key, metrics[key])
     }
-    c.server.clientsMu.RUnlock()
 
-    log.Printf("Admin %s broadcast message: %s", c.user.Username, message)
+    for key, value := range c.server.eventStats.Snapshot() {
+        notice("events.%s: %d", key, value)
+    }
+
+    notice("=== Commands (percentiles over the last %d minutes) ===", commandWindowSlots)
+    for _, summary := range c.server.commandMetrics.Summaries() {
+        notice("%s: count=%d errors=%d avg=%s p50=%s p99=%s max=%s", summary.Command, summary.Count, summary.Errors,
+            summary.Avg.Round(time.Microsecond), summary.P50, summary.P99, summary.Max.Round(time.Microsecond))
+    }
+
+    c.SendBatch(lines)
 
     return nil
 }
 
-func (c *Client) handleAdminStats(args []string) error {
-    stats, err := c.server.adminService.GetServerStats(c.user.UserID)
+// handleAdminLog shows recent admin actions. Filters are key:value tokens
+// (admin:<username|auto> action:<type> target:<username> from:<time> to:<time>);
+// export:csv or export:json writes the matches to a file instead.
+func (c *Client) handleAdminLog(args []string) error {
+    filter := database.AdminLogFilter{Limit: defaultAdminLogLimit}
+    limitSet := false
+    format := ""
+
+    for _, arg := range args {
+        key, value, found := strings.Cut(arg, ":")
+        if !found {
+            limit, err := strconv.Atoi(arg)
+            if err != nil || limit <= 0 {
+                return fmt.Errorf("usage: ADMIN log [limit] [admin:<user|auto>] [action:<type>] [target:<user>] [from:<time>] [to:<time>] [export:csv|json]")
+            }
+            filter.Limit = limit
+            limitSet = true
+            continue
+        }
+
+        var err error
+        switch strings.ToLower(key) {
+        case "admin":
+            if strings.EqualFold(value, "auto") {
+                filter.Automatic = true
+                break
+            }
+            filter.AdminID, err = c.server.lookupUserID(value)
+        case "target":
+            filter.TargetUserID, err = c.server.lookupUserID(value)
+        case "action":
+            filter.ActionType = value
+        case "from":
+            filter.From, err = export.ParseTime(value)
+        case "to":
+            filter.To, err = export.ParseTime(value)
+        case "export":
+            format, err = export.ParseAuditFormat(value)
+        default:
+            err = fmt.Errorf("unknown log filter: %s", key)
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    if format != "" && !limitSet {
+        filter.Limit = maxAdminLogExport
+    }
+    if filter.Limit > maxAdminLogExport {
+        filter.Limit = maxAdminLogExport
+    }
+
+    logs, err := c.server.adminService.SearchAdminLog(c.user.UserID, filter)
     if err != nil {
         return err
     }
 
-    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Server Statistics ===", c.server.config.Server.ServerName, c.user.Username))
+    serverName := c.server.config.Server.ServerName
 
-    for key, value := range stats {
-        c.Send(fmt.Sprintf(":%s NOTICE %s :%s: %v", c.server.config.Server.ServerName, c.user.Username, key, value))
+    if format != "" {
+        return c.exportAdminLog(logs, format)
     }
 
-    c.Send(fmt.Sprintf(":%s NOTICE %s :active_connections: %d", c.server.config.Server.ServerName, c.user.Username, c.server.GetActiveClientCount()))
-    c.Send(fmt.Sprintf(":%s NOTICE %s :active_sessions: %d", c.server.config.Server.ServerName, c.user.Username, c.server.sessionManager.GetActiveSessionCount()))
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Admin Action Log (%d entries) ===", serverName, c.user.Username, len(logs)))
+
+    for _, entry := range logs {
+        target := ""
+        if entry.TargetUsername != nil {
+            target = " -> " + *entry.TargetUsername
+        }
+        details := ""
+        if entry.ActionDetails != nil {
+            details = " - " + *entry.ActionDetails
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :[%s] %s: %s%s%s",
+            serverName,
+            c.user.Username,
+            entry.PerformedAt.Format("2006-01-02 15:04:05"),
+            entry.AdminUsername,
+            entry.ActionType,
+            target,
+            details))
+    }
 
     return nil
 }
 
-func (c *Client) handleAdminLog(args []string) error {
-    limit := 10
+func (c *Client) exportAdminLog(logs []*models.AdminActionLog, format string) error {
+    serverName := c.server.config.Server.ServerName
+    username := c.user.Username
+
+    jobID := fmt.Sprintf("audit-export-%d-%d", c.user.UserID, time.Now().UnixNano())
+
+    err := c.server.workerPool.SubmitPriority(jobID, threadpool.PriorityLow, func() error {
+        name, err := c.server.exportStore.SaveAudit(logs, format)
+        if err != nil {
+            c.Send(fmt.Sprintf(":%s NOTICE %s :Admin log export failed: %v", serverName, username, err))
+            return err
+        }
+
+        log.Printf("Admin %s exported %d admin log entries", username, len(logs))
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Admin log export ready (%d entries): %s", serverName, username, len(logs), c.server.exportLocation(name)))
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to queue export: %w", err)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Admin log export of %d entries queued", serverName, username, len(logs)))
+    return nil
+}
+
+func (s *Server) lookupUserID(username string) (int64, error) {
+    user, err := s.authService.GetUserByUsername(username)
+    if err != nil {
+        return 0, fmt.Errorf("user not found: %s", username)
+    }
+    return user.UserID, nil
+}
+
+func (c *Client) handleAdminStop(args []string, restart bool) error {
+    if err := c.server.requireProcessControl(); err != nil {
+        return err
+    }
+
+    if len(args) > 0 && strings.EqualFold(args[0], "cancel") {
+        if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+            return err
+        }
+        if err := c.server.CancelStop(); err != nil {
+            return err
+        }
+
+        log.Printf("Admin %s cancelled the scheduled shutdown", c.user.Username)
+        return nil
+    }
+
+    delayStr := ""
     if len(args) > 0 {
-        fmt.Sscanf(args[0], "%d", &limit)
+        delayStr = args[0]
     }
 
-    logs, err := c.server.adminService.GetAdminLog(c.user.UserID, limit, 0)
+    delaySeconds, err := admin.ParseDuration(delayStr)
     if err != nil {
         return err
     }
 
-    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Admin Action Log (last %d) ===", c.server.config.Server.ServerName, c.user.Username, limit))
+    if err := c.server.adminService.RequestStop(c.user.UserID, restart, delaySeconds); err != nil {
+        return err
+    }
 
-    for _, log := range logs {
-        c.Send(fmt.Sprintf(":%s NOTICE %s :[%s] Admin ID %d: %s - %s",
-            c.server.config.Server.ServerName,
-            c.user.Username,
-            log.PerformedAt.Format("2006-01-02 15:04:05"),
-            log.AdminID,
-            log.ActionType,
-            *log.ActionDetails))
+    if err := c.server.ScheduleStop(time.Duration(delaySeconds)*time.Second, restart); err != nil {
+        return err
+    }
+
+    action := "shutdown"
+    if restart {
+        action = "restart"
     }
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Server %s scheduled in %ds", c.server.config.Server.ServerName, c.user.Username, action, delaySeconds))
+    log.Printf("Admin %s scheduled server %s in %ds", c.user.Username, action, delaySeconds)
 
     return nil
 }
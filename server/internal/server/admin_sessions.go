@@ -0,0 +1,157 @@
+package server
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "path"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+const sessionRefLength = 12
+
+// sessionRef is the handle ADMIN who shows for a session. Session IDs are
+// resume tokens, so admins see a hash of them instead.
+func sessionRef(sessionID string) string {
+    sum := sha256.Sum256([]byte(sessionID))
+    return hex.EncodeToString(sum[:])[:sessionRefLength]
+}
+
+func (s *Server) authenticatedClients() []*Client {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    clients := make([]*Client, 0, len(s.clients))
+    for _, client := range s.clients {
+        if client.user != nil {
+            clients = append(clients, client)
+        }
+    }
+    return clients
+}
+
+// handleAdminWho lists connected sessions, optionally only those whose
+// username matches a glob pattern.
+func (c *Client) handleAdminWho(args []string) error {
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    pattern := "*"
+    if len(args) > 0 {
+        pattern = strings.ToLower(args[0])
+    }
+    if _, err := path.Match(pattern, ""); err != nil {
+        return fmt.Errorf("invalid pattern: %s", args[0])
+    }
+
+    var clients []*Client
+    for _, client := range c.server.authenticatedClients() {
+        if matched, _ := path.Match(pattern, strings.ToLower(client.Username())); matched {
+            clients = append(clients, client)
+        }
+    }
+
+    sort.Slice(clients, func(i, j int) bool {
+        if clients[i].Username() != clients[j].Username() {
+            return clients[i].Username() < clients[j].Username()
+        }
+        return clients[i].connectedAt.Before(clients[j].connectedAt)
+    })
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Connected sessions (%d) ===", serverName, c.user.Username, len(clients)))
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+    channelNames := make(map[int64]string)
+
+    for _, client := range clients {
+        var names []string
+        for _, channelID := range client.GetChannels() {
+            name, exists := channelNames[channelID]
+            if !exists {
+                name = fmt.Sprintf("#%d", channelID)
+                if channel, err := channelRepo.GetByID(channelID); err == nil {
+                    name = channel.ChannelName
+                }
+                channelNames[channelID] = name
+            }
+            names = append(names, name)
+        }
+        channels := "-"
+        if len(names) > 0 {
+            channels = strings.Join(names, ",")
+        }
+
+        sessionAge := time.Since(client.connectedAt)
+        if client.session != nil {
+            sessionAge = time.Since(client.session.CreatedAt)
+        }
+
+        flags := ""
+        if client.user.IsAdmin {
+            flags += " [admin]"
+        }
+        if client.observer {
+            flags += " [observer]"
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s session %s from %s, session age %s, connected %s, idle %s, channels %s%s",
+            serverName, c.user.Username,
+            client.Username(),
+            sessionRef(client.SessionID),
+            client.GetIPAddress(),
+            sessionAge.Round(time.Second),
+            time.Since(client.connectedAt).Round(time.Second),
+            client.IdleDuration().Round(time.Second),
+            channels,
+            flags))
+    }
+
+    return nil
+}
+
+// handleAdminKillSession ends a single session, identified by the reference
+// from ADMIN who or the full session ID, leaving the user's other
+// connections alone. The session cannot be resumed.
+func (c *Client) handleAdminKillSession(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN killsession <session> [reason]")
+    }
+
+    ref := strings.ToLower(args[0])
+    reason := "Session terminated by admin"
+    if len(args) > 1 {
+        reason = strings.Join(args[1:], " ")
+    }
+
+    var target *Client
+    for _, client := range c.server.authenticatedClients() {
+        if client.SessionID == args[0] || sessionRef(client.SessionID) == ref {
+            target = client
+            break
+        }
+    }
+    if target == nil {
+        return fmt.Errorf("no connected session %s", args[0])
+    }
+
+    if err := c.server.adminService.KillSession(c.user.UserID, target.user, sessionRef(target.SessionID)); err != nil {
+        return err
+    }
+
+    target.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", target.Host(), reason))
+    c.server.recordDisconnect(target, &c.user.UserID, "Session terminated: "+reason)
+    target.endSession = true
+    go target.Disconnect()
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Terminated session %s of %s", c.server.config.Server.ServerName, c.user.Username, sessionRef(target.SessionID), target.Username()))
+    log.Printf("Admin %s terminated session %s of %s: %s", c.user.Username, sessionRef(target.SessionID), target.Username(), reason)
+
+    return nil
+}
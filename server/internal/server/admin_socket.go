@@ -0,0 +1,117 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "net"
+    "os"
+    "sync"
+)
+
+// AdminSocket serves the console commands on a Unix domain socket. There is
+// no login: whoever can open the socket file is trusted, so access is
+// controlled with its file mode and the permissions of its directory.
+type AdminSocket struct {
+    server     *Server
+    path       string
+    configPath string
+    stop       func()
+    listener   net.Listener
+
+    connsMu sync.Mutex
+    conns   map[net.Conn]struct{}
+}
+
+func NewAdminSocket(s *Server, path string, mode os.FileMode, configPath string, stop func()) (*AdminSocket, error) {
+    if err := removeStaleSocket(path); err != nil {
+        return nil, err
+    }
+
+    listener, err := net.Listen("unix", path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to listen on admin socket: %w", err)
+    }
+
+    if err := os.Chmod(path, mode); err != nil {
+        listener.Close()
+        return nil, fmt.Errorf("failed to set admin socket mode: %w", err)
+    }
+
+    return &AdminSocket{
+        server:     s,
+        path:       path,
+        configPath: configPath,
+        stop:       stop,
+        listener:   listener,
+        conns:      make(map[net.Conn]struct{}),
+    }, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a server that did
+// not shut down cleanly, refusing to touch other files or a socket that
+// still accepts connections.
+func removeStaleSocket(path string) error {
+    info, err := os.Lstat(path)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to check admin socket: %w", err)
+    }
+
+    if info.Mode()&os.ModeSocket == 0 {
+        return fmt.Errorf("admin socket path %s exists and is not a socket", path)
+    }
+
+    if conn, err := net.Dial("unix", path); err == nil {
+        conn.Close()
+        return fmt.Errorf("admin socket %s is in use by another process", path)
+    }
+
+    return os.Remove(path)
+}
+
+func (a *AdminSocket) Start() {
+    log.Printf("Admin socket listening on %s", a.path)
+
+    go func() {
+        for {
+            conn, err := a.listener.Accept()
+            if err != nil {
+                return
+            }
+            go a.serve(conn)
+        }
+    }()
+}
+
+func (a *AdminSocket) serve(conn net.Conn) {
+    a.connsMu.Lock()
+    a.conns[conn] = struct{}{}
+    a.connsMu.Unlock()
+
+    defer func() {
+        a.connsMu.Lock()
+        delete(a.conns, conn)
+        a.connsMu.Unlock()
+        conn.Close()
+    }()
+
+    log.Printf("Admin socket session opened")
+    NewConsole(a.server, conn, conn, a.configPath, a.stop).Run()
+    log.Printf("Admin socket session closed")
+}
+
+// Close stops accepting connections, ends open sessions and removes the
+// socket file.
+func (a *AdminSocket) Close() error {
+    err := a.listener.Close()
+
+    a.connsMu.Lock()
+    for conn := range a.conns {
+        conn.Close()
+    }
+    a.connsMu.Unlock()
+
+    return err
+}
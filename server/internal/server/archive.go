@@ -0,0 +1,112 @@
+package server
+
+import (
+    "fmt"
+    "log"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+// handleArchive takes a channel out of use: it leaves LIST and can no longer
+// be joined or spoken in, but its members and history are kept. UNARCHIVE
+// brings it back. Only the owner or an admin may do either.
+func (c *Client) handleArchive(parts []string) error {
+    return c.setArchived("ARCHIVE", parts, true)
+}
+
+func (c *Client) handleUnarchive(parts []string) error {
+    return c.setArchived("UNARCHIVE", parts, false)
+}
+
+func (c *Client) setArchived(command string, parts []string, archive bool) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams(command, command+" <channel>")
+    }
+
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    role, err := channelRepo.GetMemberRole(channel.ChannelID, c.user.UserID)
+    owner := err == nil && role == "owner"
+
+    switch {
+    case !owner && !c.user.IsAdmin:
+        return numerics.ChanOPrivsNeeded(channelName)
+    case archive && channel.IsArchived:
+        return fmt.Errorf("channel %s is already archived", channelName)
+    case !archive && !channel.IsArchived:
+        return fmt.Errorf("channel %s is not archived", channelName)
+    }
+
+    // Admins acting on a channel they do not own go through the admin
+    // service, so the action is in the admin log.
+    switch {
+    case owner && archive:
+        err = channelRepo.Archive(channel.ChannelID)
+    case owner:
+        err = channelRepo.Restore(channel.ChannelID)
+    case archive:
+        err = c.server.adminService.ArchiveChannel(c.user.UserID, channelName)
+    default:
+        err = c.server.adminService.RestoreChannel(c.user.UserID, channelName)
+    }
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    if archive {
+        c.server.BroadcastToChannel(channel.ChannelID, fmt.Sprintf(":%s NOTICE %s :Channel archived by %s; its history is kept",
+            serverName, channelName, c.user.Username), "")
+        c.server.archivedChannel(channel.ChannelID)
+    } else {
+        c.server.restoredChannel(channel.ChannelID)
+    }
+
+    state := "restored"
+    if archive {
+        state = "archived"
+    }
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Channel %s has been %s", serverName, c.user.Username, channelName, state))
+    log.Printf("User %s %s channel %s", c.user.Username, state, channelName)
+
+    return nil
+}
+
+// archivedChannel stops delivering an archived channel to the clients
+// connected here. Their memberships stay in the database.
+func (s *Server) archivedChannel(channelID int64) {
+    s.invalidateChannel(channelID)
+
+    for _, client := range s.membersOf([]int64{channelID}, "") {
+        client.LeaveChannel(channelID)
+    }
+}
+
+// restoredChannel puts the connected members of a restored channel back in
+// it.
+func (s *Server) restoredChannel(channelID int64) {
+    s.invalidateChannel(channelID)
+
+    members, err := database.NewChannelRepository(s.db).GetMembers(channelID)
+    if err != nil {
+        log.Printf("Failed to reattach members of restored channel %d: %v", channelID, err)
+        return
+    }
+
+    for _, member := range members {
+        for _, client := range s.clientsForUser(member.UserID) {
+            client.JoinChannel(channelID)
+        }
+    }
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/models"
+)
+
+type BenchmarkOptions struct {
+    Clients  int
+    Channels int
+    Senders  int
+    Messages int
+}
+
+type BenchmarkReport struct {
+    Clients          int
+    Channels         int
+    MessagesSent     int
+    Deliveries       int64
+    Duration         time.Duration
+    MessagesPerSec   float64
+    DeliveriesPerSec float64
+    P50Latency       time.Duration
+    P99Latency       time.Duration
+    MaxLatency       time.Duration
+}
+
+func (r *BenchmarkReport) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "clients:        %d\n", r.Clients)
+    fmt.Fprintf(&b, "channels:       %d\n", r.Channels)
+    fmt.Fprintf(&b, "messages sent:  %d\n", r.MessagesSent)
+    fmt.Fprintf(&b, "deliveries:     %d\n", r.Deliveries)
+    fmt.Fprintf(&b, "duration:       %s\n", r.Duration)
+    fmt.Fprintf(&b, "msgs/sec:       %.0f\n", r.MessagesPerSec)
+    fmt.Fprintf(&b, "deliveries/sec: %.0f\n", r.DeliveriesPerSec)
+    fmt.Fprintf(&b, "p50 latency:    %s\n", r.P50Latency)
+    fmt.Fprintf(&b, "p99 latency:    %s\n", r.P99Latency)
+    fmt.Fprintf(&b, "max latency:    %s\n", r.MaxLatency)
+    return b.String()
+}
+
+// RunBenchmark measures channel fan-out in isolation: clients are connected
+// over in-memory pipes, storage is a no-op and no crypto is initialised.
+func RunBenchmark(cfg *config.Config, opts BenchmarkOptions) (*BenchmarkReport, error) {
+    if opts.Clients < 1 || opts.Channels < 1 || opts.Senders < 1 || opts.Messages < 1 {
+        return nil, fmt.Errorf("benchmark options must all be positive")
+    }
+    if opts.Senders > opts.Clients {
+        opts.Senders = opts.Clients
+    }
+
+    s := newBenchmarkServer(cfg)
+
+    var deliveries int64
+    var latenciesMu sync.Mutex
+    latencies := make([]time.Duration, 0, opts.Messages*opts.Clients/opts.Channels)
+
+    var readers sync.WaitGroup
+    clients := make([]*Client, opts.Clients)
+
+    for i := 0; i < opts.Clients; i++ {
+        serverConn, clientConn := net.Pipe()
+
+        client := newBenchmarkClient(s, serverConn, i)
+        client.JoinChannel(int64(i%opts.Channels + 1))
+        s.AddClient(client)
+        clients[i] = client
+
+        readers.Add(1)
+        go func(conn net.Conn) {
+            defer readers.Done()
+            local := make([]time.Duration, 0, 1024)
+            scanner := bufio.NewScanner(conn)
+            for scanner.Scan() {
+                sentAt, ok := parseBenchmarkStamp(scanner.Text())
+                if !ok {
+                    continue
+                }
+                local = append(local, time.Since(sentAt))
+                atomic.AddInt64(&deliveries, 1)
+            }
+            latenciesMu.Lock()
+            latencies = append(latencies, local...)
+            latenciesMu.Unlock()
+        }(clientConn)
+    }
+
+    start := time.Now()
+
+    var senders sync.WaitGroup
+    perSender := opts.Messages / opts.Senders
+    for i := 0; i < opts.Senders; i++ {
+        senders.Add(1)
+        go func(sender *Client) {
+            defer senders.Done()
+            channelID := sender.GetChannels()[0]
+            channelName := fmt.Sprintf("#bench%d", channelID)
+            for n := 0; n < perSender; n++ {
+                sender.relayChannelMessage(channelID, channelName, fmt.Sprintf("bench %d", time.Now().UnixNano()))
+            }
+        }(clients[i])
+    }
+    senders.Wait()
+
+    duration := time.Since(start)
+
+    for _, client := range clients {
+        client.conn.Close()
+    }
+    readers.Wait()
+
+    report := &BenchmarkReport{
+        Clients:      opts.Clients,
+        Channels:     opts.Channels,
+        MessagesSent: perSender * opts.Senders,
+        Deliveries:   deliveries,
+        Duration:     duration,
+    }
+
+    if duration > 0 {
+        report.MessagesPerSec = float64(report.MessagesSent) / duration.Seconds()
+        report.DeliveriesPerSec = float64(deliveries) / duration.Seconds()
+    }
+
+    if len(latencies) > 0 {
+        sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+        report.P50Latency = percentile(latencies, 0.50)
+        report.P99Latency = percentile(latencies, 0.99)
+        report.MaxLatency = latencies[len(latencies)-1]
+    }
+
+    return report, nil
+}
+
+// newBenchmarkServer is a server with no database, crypto or worker pool,
+// enough to deliver channel messages.
+func newBenchmarkServer(cfg *config.Config) *Server {
+    return &Server{
+        config:         cfg,
+        clients:        make(map[string]*Client),
+        clientsByUser:  make(map[int64]map[string]*Client),
+        userIDs:        make(map[string]int64),
+        channelMembers: make(map[int64]map[*Client]struct{}),
+        commandMetrics: newCommandMetrics(),
+        messageStore:   noopMessageStore{},
+        shutdown:       make(chan struct{}),
+    }
+}
+
+func newBenchmarkClient(s *Server, conn net.Conn, i int) *Client {
+    client := NewClient(conn, s)
+    client.user = &models.User{UserID: int64(i + 1), Username: fmt.Sprintf("bench%d", i)}
+    client.authenticated = true
+    client.SessionID = fmt.Sprintf("bench-session-%d", i)
+    return client
+}
+
+func parseBenchmarkStamp(line string) (time.Time, bool) {
+    idx := strings.LastIndex(line, ":bench ")
+    if idx == -1 {
+        return time.Time{}, false
+    }
+
+    nanos, err := strconv.ParseInt(line[idx+len(":bench "):], 10, 64)
+    if err != nil {
+        return time.Time{}, false
+    }
+
+    return time.Unix(0, nanos), true
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+    idx := int(float64(len(sorted)-1) * p)
+    return sorted[idx]
+}
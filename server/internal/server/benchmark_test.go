@@ -0,0 +1,228 @@
+package server
+
+import (
+    "bytes"
+    "crypto/ecdh"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "fmt"
+    "io"
+    "net"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/codec"
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const benchLine = "@time=2024-01-01T00:00:00.000Z;msgid=42 :alice!alice@example.org PRIVMSG #general :the quick brown fox jumps over the lazy dog"
+
+func BenchmarkParseMessage(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        parseMessage(benchLine, true)
+    }
+}
+
+func BenchmarkParseFields(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        parseMessage(benchLine, false)
+    }
+}
+
+func BenchmarkCodecFrame(b *testing.B) {
+    b.ReportAllocs()
+    payload := []byte(benchLine)
+    for i := 0; i < b.N; i++ {
+        frames := codec.NewDecoder(bytes.NewReader(codec.Encode(payload)), 4096)
+        if _, err := frames.Decode(); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+// BenchmarkEnvelope seals and opens ENCRYPTED envelopes under HKDF-derived
+// session keys in each AES mode.
+func BenchmarkEnvelope(b *testing.B) {
+    for _, mode := range []string{"GCM", "CBC"} {
+        mode := mode
+        b.Run(strings.ToLower(mode)+"-seal", func(b *testing.B) {
+            cm, keys := benchSessionKeys(b, mode)
+            defer keys.Destroy()
+
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                if _, err := cm.SealFrame(keys, benchLine); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+        b.Run(strings.ToLower(mode)+"-open", func(b *testing.B) {
+            cm, keys := benchSessionKeys(b, mode)
+            defer keys.Destroy()
+
+            frame, err := cm.SealFrame(keys, benchLine)
+            if err != nil {
+                b.Fatal(err)
+            }
+
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                if _, err := cm.OpenFrame(keys, frame); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+func benchSessionKeys(b *testing.B, mode string) (*auth.CryptoManager, *auth.SessionKeys) {
+    secret := make([]byte, 32)
+    if _, err := rand.Read(secret); err != nil {
+        b.Fatal(err)
+    }
+
+    keys, err := auth.DeriveSessionKeys(secret, false)
+    if err != nil {
+        b.Fatal(err)
+    }
+    return auth.NewCryptoManager(nil, mode), keys
+}
+
+func BenchmarkSign(b *testing.B) {
+    _, signingKey, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        b.Fatal(err)
+    }
+    signer := auth.NewMessageSigner(signingKey)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        signer.Sign(auth.Stamp{
+            MsgID:       seqMsgID(int64(i)),
+            Channel:     "#general",
+            Author:      "alice",
+            Timestamp:   time.Now(),
+            ContentHash: fmt.Sprintf("%x", sha256.Sum256([]byte(benchLine))),
+        })
+    }
+}
+
+func BenchmarkMessageMAC(b *testing.B) {
+    macKey := make([]byte, 32)
+    if _, err := rand.Read(macKey); err != nil {
+        b.Fatal(err)
+    }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        auth.MACMessage(macKey, benchLine)
+    }
+}
+
+// exchangeKey is generated on first use: the benchmark function runs
+// several times, and most runs do not include ECDH.
+var exchangeKey *auth.RSAKeyPair
+
+func BenchmarkECDHSessionKey(b *testing.B) {
+    if exchangeKey == nil {
+        keyPair, err := auth.GenerateRSAKeyPair(2048)
+        if err != nil {
+            b.Fatal(err)
+        }
+        exchangeKey = keyPair
+    }
+    cm := auth.NewCryptoManager(exchangeKey, "GCM")
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        b.StopTimer()
+        key, err := ecdh.X25519().GenerateKey(rand.Reader)
+        if err != nil {
+            b.Fatal(err)
+        }
+        clientPublic := base64.StdEncoding.EncodeToString(key.PublicKey().Bytes())
+        b.StartTimer()
+
+        exchange, err := cm.ECDHSessionKey(clientPublic, 256, nil)
+        if err != nil {
+            b.Fatal(err)
+        }
+        auth.Zero(exchange.SessionKey)
+    }
+}
+
+// BenchmarkFanOut broadcasts one line per iteration to a channel of
+// members clients while connected clients are online.
+func BenchmarkFanOut(b *testing.B) {
+    for _, size := range []struct{ members, connected int }{
+        {10, 10},
+        {10, 1000},
+        {100, 100},
+        {1000, 1000},
+    } {
+        size := size
+        name := fmt.Sprintf("%d", size.members)
+        if size.connected != size.members {
+            name = fmt.Sprintf("%d-of-%d", size.members, size.connected)
+        }
+        b.Run(name, func(b *testing.B) {
+            benchmarkFanOut(b, size.members, size.connected, false)
+        })
+    }
+    b.Run("1000-pooled", func(b *testing.B) {
+        benchmarkFanOut(b, 1000, 1000, true)
+    })
+}
+
+// benchmarkFanOut runs one fan-out size. With pooled set the server fans
+// out through a worker pool sized as in the sample configuration.
+func benchmarkFanOut(b *testing.B, members, connected int, pooled bool) {
+    cfg := &config.Config{}
+    cfg.Server.ServerName = "bench.onyxirc"
+
+    s := newBenchmarkServer(cfg)
+    if pooled {
+        s.workerPool = threadpool.NewWorkerPool(20, 2000, 100, time.Minute)
+        s.workerPool.Start()
+        defer s.workerPool.Shutdown()
+    }
+
+    conns := make([]net.Conn, 0, connected)
+    defer func() {
+        for _, conn := range conns {
+            conn.Close()
+        }
+    }()
+
+    for i := 0; i < connected; i++ {
+        serverConn, clientConn := net.Pipe()
+        conns = append(conns, serverConn)
+        go io.Copy(io.Discard, clientConn)
+
+        client := newBenchmarkClient(s, serverConn, i)
+        s.AddClient(client)
+        if i < members {
+            client.JoinChannel(1)
+        } else {
+            client.JoinChannel(int64(2 + i%10))
+        }
+    }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.broadcastToChannelLocal(1, benchLine, "")
+    }
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+// botReply is RPL_WHOISBOT, sent in WHOIS and after NAMES for each bot so
+// clients can tell bots from people.
+func botReply(serverName, nick, bot string) string {
+    return fmt.Sprintf(":%s 335 %s %s :is a bot", serverName, nick, bot)
+}
+
+func (c *Client) checkBotMessageRate() error {
+    limits := c.server.config.Bots
+    if wait := c.server.botLimits.allow(c.server.botLimits.messages, c.user.UserID, limits.Messages, limits.MessageWindow); wait > 0 {
+        return fmt.Errorf("bot message rate limit exceeded, try again in %s", wait.Round(time.Second))
+    }
+    return nil
+}
+
+func (c *Client) handleAdminBot(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN bot <create|key|list> ...")
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    switch strings.ToLower(args[0]) {
+    case "create", "key":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ADMIN bot %s <username>", strings.ToLower(args[0]))
+        }
+
+        create := strings.ToLower(args[0]) == "create"
+        issue := c.server.adminService.RotateBotKey
+        if create {
+            issue = c.server.adminService.CreateBot
+        }
+
+        user, key, err := issue(c.user.UserID, args[1])
+        if err != nil {
+            return err
+        }
+
+        if create {
+            c.Send(fmt.Sprintf(":%s NOTICE %s :Created bot %s", serverName, c.user.Username, user.Username))
+            log.Printf("Admin %s created bot %s", c.user.Username, user.Username)
+        } else {
+            log.Printf("Admin %s issued a new API key for bot %s", c.user.Username, user.Username)
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :API key for %s (shown once, log in with LOGIN %s <key>): %s",
+            serverName, c.user.Username, user.Username, user.Username, key))
+        return nil
+    case "list":
+        bots, err := c.server.adminService.ListBots(c.user.UserID)
+        if err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :=== Bots (%d) ===", serverName, c.user.Username, len(bots)))
+        for _, bot := range bots {
+            online := "offline"
+            if len(c.server.clientsForUser(bot.UserID)) > 0 {
+                online = "online"
+            }
+            if !bot.IsActive {
+                online = "inactive"
+            }
+            lastUsed := "never"
+            if bot.KeyLastUsed != nil {
+                lastUsed = bot.KeyLastUsed.Format(time.RFC3339)
+            }
+            c.Send(fmt.Sprintf(":%s NOTICE %s :%s [%s] since %s, key last used %s", serverName, c.user.Username,
+                bot.Username, online, bot.CreatedAt.Format(time.RFC3339), lastUsed))
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown bot subcommand: %s", args[0])
+    }
+}
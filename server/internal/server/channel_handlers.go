@@ -1,41 +1,109 @@
 package server
 
 import (
+    "errors"
     "fmt"
     "log"
+    "strconv"
+    "time"
 
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/cluster"
     "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/events"
+    "github.com/onyxirc/server/internal/link"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+    "github.com/onyxirc/server/internal/plugin"
 )
 
-func (c *Client) handleJoinComplete(channelName string) error {
+func (c *Client) handleJoinComplete(channelName, key string) error {
     channelRepo := database.NewChannelRepository(c.server.db)
+    channels := c.server.channels
 
-    channel, err := channelRepo.GetByName(channelName)
+    channel, err := channels.GetByName(channelName)
     if err != nil {
-        
-        channel, err = channelRepo.Create(channelName, c.user.UserID, false)
+        if renamed, aliasErr := channelRepo.ResolveAlias(channelName); aliasErr == nil {
+            c.Send(fmt.Sprintf(":%s 470 %s %s %s :Channel has been renamed",
+                c.server.config.Server.ServerName, c.user.Username, channelName, renamed.ChannelName))
+            return c.handleJoinComplete(renamed.ChannelName, key)
+        }
+
+        if c.lockedDown() {
+            return fmt.Errorf("channel creation is frozen while the network is in lockdown")
+        }
+
+        if err := c.checkEvasionRestriction(); err != nil {
+            return err
+        }
+
+        if err := c.server.validateChannelName(channelName); err != nil {
+            return err
+        }
+
+        if err := c.checkChannelLimit(channelRepo, channelName); err != nil {
+            return err
+        }
+
+        channel, err = channels.Create(channelName, c.user.UserID, false)
         if err != nil {
             return fmt.Errorf("failed to create channel: %w", err)
         }
         log.Printf("Channel %s created by user %s", channelName, c.user.Username)
+
+        c.server.propagate(link.CmdChannel, channelName, strconv.FormatInt(channel.CreatedAt.Unix(), 10), "")
+
+        c.server.recordEvent(events.MemberJoined, &c.user.UserID, &channel.ChannelID, events.MemberJoinedData{Role: "owner"})
+    } else if !c.forwardExempt(channelRepo, channel.ChannelID) {
+        chain, err := forwardChain(channelRepo, channel)
+        if err != nil {
+            log.Printf("Forwarding loop detected starting at channel %s", channelName)
+            return err
+        }
+        if len(chain) > 0 {
+            target := chain[len(chain)-1]
+            c.Send(fmt.Sprintf(":%s 470 %s %s %s :Forwarding to another channel",
+                c.server.config.Server.ServerName, c.user.Username, channelName, target.ChannelName))
+            return c.handleJoinComplete(target.ChannelName, "")
+        }
     }
 
-    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    if channel.IsArchived {
+        return numerics.New(numerics.ErrNoSuchChannel, "Channel is archived", channelName)
+    }
+
+    if err := c.checkChannelJoinThrottle(channel.ChannelID, channelName); err != nil {
+        return err
+    }
+
+    isMember, err := channels.IsMember(channel.ChannelID, c.user.UserID)
     if err != nil {
         return fmt.Errorf("failed to check membership: %w", err)
     }
 
     if !isMember {
-        
-        if err := channelRepo.AddMember(channel.ChannelID, c.user.UserID, "member"); err != nil {
+        if err := c.checkChannelLimit(channelRepo, channelName); err != nil {
+            return err
+        }
+
+        if err := c.checkJoinModes(channel, channelName, key); err != nil {
+            return err
+        }
+
+        role, err := channels.JoinMember(channel.ChannelID, c.user.UserID)
+        if err != nil {
             return fmt.Errorf("failed to join channel: %w", err)
         }
+
+        c.server.recordEvent(events.MemberJoined, &c.user.UserID, &channel.ChannelID, events.MemberJoinedData{Role: role})
     }
 
     c.JoinChannel(channel.ChannelID)
 
     c.Send(fmt.Sprintf(":%s!%s@%s JOIN :%s",
-        c.user.Username, c.user.Username, c.GetIPAddress(), channelName))
+        c.user.Username, c.user.Username, c.Host(), channelName))
+
+    c.sendChannelKey(channel.ChannelID, channelName)
 
     if channel.Topic != nil {
         c.Send(fmt.Sprintf(":%s 332 %s %s :%s",
@@ -45,6 +113,7 @@ func (c *Client) handleJoinComplete(channelName string) error {
     members, err := channelRepo.GetMembers(channel.ChannelID)
     if err == nil {
         usernames := []string{}
+        awayReplies := []string{}
         for _, member := range members {
             user, err := c.server.authService.GetUserByID(member.UserID)
             if err == nil {
@@ -55,54 +124,94 @@ func (c *Client) handleJoinComplete(channelName string) error {
                     prefix = "+"
                 }
                 usernames = append(usernames, prefix+user.Username)
+
+                if awayMessage, away := c.server.awayMessage(user.UserID); away {
+                    awayReplies = append(awayReplies, fmt.Sprintf(":%s 301 %s %s :%s",
+                        c.server.config.Server.ServerName, c.user.Username, user.Username, awayMessage))
+                }
+                if user.IsBot {
+                    awayReplies = append(awayReplies, botReply(c.server.config.Server.ServerName, c.user.Username, user.Username))
+                }
             }
         }
 
+        usernames = append(usernames, remoteNames(c.server.remoteMembers(channelName))...)
+
+        var lines []string
         if len(usernames) > 0 {
-            c.Send(fmt.Sprintf(":%s 353 %s = %s :%s",
+            lines = append(lines, fmt.Sprintf(":%s 353 %s = %s :%s",
                 c.server.config.Server.ServerName, c.user.Username, channelName,
                 joinStrings(usernames, " ")))
         }
 
-        c.Send(fmt.Sprintf(":%s 366 %s %s :End of NAMES list",
+        lines = append(lines, fmt.Sprintf(":%s 366 %s %s :End of NAMES list",
             c.server.config.Server.ServerName, c.user.Username, channelName))
+
+        c.SendBatch(append(lines, awayReplies...))
     }
 
     joinMsg := fmt.Sprintf(":%s!%s@%s JOIN :%s",
-        c.user.Username, c.user.Username, c.GetIPAddress(), channelName)
+        c.user.Username, c.user.Username, c.Host(), channelName)
     c.server.BroadcastToChannel(channel.ChannelID, joinMsg, c.SessionID)
+    c.server.propagate(link.CmdJoin, c.user.Username, channelName)
 
     log.Printf("User %s joined channel %s", c.user.Username, channelName)
 
     return nil
 }
 
+// checkChannelLimit enforces features.max_channels_per_user before the
+// client joins or creates another channel. Admins are not limited.
+func (c *Client) checkChannelLimit(channelRepo *database.ChannelRepository, channelName string) error {
+    limit := c.server.config.Features.MaxChannelsPerUser
+    if limit <= 0 || c.user.IsAdmin {
+        return nil
+    }
+
+    count, err := channelRepo.CountUserChannels(c.user.UserID)
+    if err != nil {
+        return err
+    }
+    if count >= limit {
+        return numerics.TooManyChannels(channelName)
+    }
+    return nil
+}
+
 func (c *Client) handlePartComplete(channelName string) error {
-    channelRepo := database.NewChannelRepository(c.server.db)
+    channels := c.server.channels
 
-    channel, err := channelRepo.GetByName(channelName)
+    channel, err := channels.GetByName(channelName)
     if err != nil {
-        return fmt.Errorf("channel not found: %s", channelName)
+        return numerics.NoSuchChannel(channelName)
     }
 
-    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    isMember, err := channels.IsMember(channel.ChannelID, c.user.UserID)
     if err != nil {
         return fmt.Errorf("failed to check membership: %w", err)
     }
 
     if !isMember {
-        return fmt.Errorf("you are not in channel %s", channelName)
+        return numerics.NotOnChannel(channelName)
+    }
+
+    // The last owner may only leave an otherwise empty channel; the check
+    // and the removal run in one transaction.
+    if err := channels.LeaveChannel(channel.ChannelID, c.user.UserID); err != nil {
+        if errors.Is(err, database.ErrLastOwner) {
+            return fmt.Errorf("you own %s; transfer ownership with OWNER before leaving", channelName)
+        }
+        return fmt.Errorf("failed to leave channel: %w", err)
     }
 
     partMsg := fmt.Sprintf(":%s!%s@%s PART :%s",
-        c.user.Username, c.user.Username, c.GetIPAddress(), channelName)
+        c.user.Username, c.user.Username, c.Host(), channelName)
     c.server.BroadcastToChannel(channel.ChannelID, partMsg, "")
 
-    if err := channelRepo.RemoveMember(channel.ChannelID, c.user.UserID); err != nil {
-        return fmt.Errorf("failed to leave channel: %w", err)
-    }
+    c.server.recordEvent(events.MemberLeft, &c.user.UserID, &channel.ChannelID, events.MemberLeftData{})
 
     c.LeaveChannel(channel.ChannelID)
+    c.server.propagate(link.CmdPart, c.user.Username, channelName)
 
     c.Send(partMsg)
 
@@ -112,7 +221,16 @@ func (c *Client) handlePartComplete(channelName string) error {
 }
 
 func (c *Client) handlePrivMsgComplete(target, message string) error {
-    
+    if err := c.checkSpamMessage(target, message); err != nil {
+        return err
+    }
+
+    event := &plugin.MessageEvent{UserID: c.user.UserID, Username: c.user.Username, Target: target, Text: message}
+    if err := c.server.plugins.OnMessage(event); err != nil {
+        return err
+    }
+    message = event.Text
+
     if target[0] == '#' {
         return c.sendChannelMessage(target, message)
     }
@@ -121,28 +239,48 @@ func (c *Client) handlePrivMsgComplete(target, message string) error {
 }
 
 func (c *Client) sendChannelMessage(channelName, message string) error {
-    channelRepo := database.NewChannelRepository(c.server.db)
+    if isFileTransfer(message) {
+        if err := c.server.requireFeature(featureFileTransfer); err != nil {
+            return err
+        }
+    }
 
-    channel, err := channelRepo.GetByName(channelName)
+    channels := c.server.channels
+
+    channel, err := channels.GetByName(channelName)
     if err != nil {
-        return fmt.Errorf("channel not found: %s", channelName)
+        return numerics.NoSuchChannel(channelName)
     }
 
-    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    isMember, err := channels.IsMember(channel.ChannelID, c.user.UserID)
     if err != nil {
         return fmt.Errorf("failed to check membership: %w", err)
     }
 
     if !isMember {
-        return fmt.Errorf("cannot send to channel %s: not a member", channelName)
+        return numerics.CannotSendToChan(channelName, "not a member")
     }
 
-    msg := fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s",
-        c.user.Username, c.user.Username, c.GetIPAddress(), channelName, message)
+    if channel.IsArchived {
+        return numerics.CannotSendToChan(channelName, "archived")
+    }
 
-    c.server.BroadcastToChannel(channel.ChannelID, msg, c.SessionID)
+    if err := c.checkEvasionRestriction(); err != nil {
+        return err
+    }
 
-    c.Send(msg)
+    if err := c.checkModerated(channel.ChannelID, channelName); err != nil {
+        return err
+    }
+
+    message, err = c.applyContentFilter(channel.ChannelID, channelName, message)
+    if err != nil {
+        return err
+    }
+
+    for _, chunk := range splitMessage(message, c.messageBudget("PRIVMSG", channelName)) {
+        c.relayChannelMessage(channel.ChannelID, channelName, chunk)
+    }
 
     log.Printf("User %s sent message to channel %s: %s", c.user.Username, channelName, message)
 
@@ -150,29 +288,64 @@ func (c *Client) sendChannelMessage(channelName, message string) error {
 }
 
 func (c *Client) sendDirectMessage(targetUsername, message string) error {
-    
+    if err := c.server.requireFeature(featureDirectMessages); err != nil {
+        return err
+    }
+
+    if isFileTransfer(message) {
+        if err := c.server.requireFeature(featureFileTransfer); err != nil {
+            return err
+        }
+    }
+
     targetUser, err := c.server.authService.GetUserByUsername(targetUsername)
     if err != nil {
-        return fmt.Errorf("user not found: %s", targetUsername)
+        return numerics.NoSuchNick(targetUsername)
     }
 
-    var targetClient *Client
-    c.server.clientsMu.RLock()
-    for _, client := range c.server.clients {
-        if client.user != nil && client.user.UserID == targetUser.UserID {
-            targetClient = client
-            break
+    if !targetUser.IsAdmin {
+        if err := c.checkEvasionRestriction(); err != nil {
+            return err
         }
     }
-    c.server.clientsMu.RUnlock()
 
-    msg := fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s",
-        c.user.Username, c.user.Username, c.GetIPAddress(), targetUsername, message)
+    if err := c.checkLockdownContact(targetUser.UserID, targetUser.IsAdmin); err != nil {
+        return err
+    }
 
-    if targetClient != nil {
-        
-        targetClient.Send(msg)
+    message, err = c.applyContentFilter(0, targetUser.Username, message)
+    if err != nil {
+        return err
+    }
+
+    // Every session of the target gets the message, as with notices.
+    if targetClients := c.server.clientsForUser(targetUser.UserID); len(targetClients) > 0 {
+        for _, chunk := range splitMessage(message, c.messageBudget("PRIVMSG", targetUsername)) {
+            line := fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s",
+                c.user.Username, c.user.Username, c.Host(), targetUsername, chunk)
+            msgID, sentAt := newMsgID(), time.Now()
+            for _, targetClient := range targetClients {
+                targetClient.Send(targetClient.withMessageTags(msgID, sentAt, line))
+            }
+            c.recordDirectMessage(targetUser.UserID, chunk)
+        }
+
+        if awayMessage, away := c.server.awayMessage(targetUser.UserID); away {
+            c.Send(fmt.Sprintf(":%s 301 %s %s :%s", c.server.config.Server.ServerName, c.user.Username, targetUser.Username, awayMessage))
+        }
         log.Printf("User %s sent DM to %s: %s", c.user.Username, targetUsername, message)
+    } else if c.server.cluster != nil && c.server.cluster.Online(targetUser.UserID) {
+        for _, chunk := range splitMessage(message, c.messageBudget("PRIVMSG", targetUsername)) {
+            c.server.publish(&cluster.Event{
+                Kind:    cluster.KindDirect,
+                UserID:  targetUser.UserID,
+                Message: fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s", c.user.Username, c.user.Username, c.Host(), targetUsername, chunk),
+                MsgID:   newMsgID(),
+                SentAt:  time.Now(),
+            })
+            c.recordDirectMessage(targetUser.UserID, chunk)
+        }
+        log.Printf("User %s sent DM to %s on another node: %s", c.user.Username, targetUsername, message)
     } else {
         
         log.Printf("User %s sent DM to offline user %s: %s", c.user.Username, targetUsername, message)
@@ -182,6 +355,281 @@ func (c *Client) sendDirectMessage(targetUsername, message string) error {
     return nil
 }
 
+func (c *Client) handleMuteChan(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("MUTECHAN", "MUTECHAN <channel> [duration]")
+    }
+
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    var until time.Time
+    var untilPtr *time.Time
+    if len(parts) > 2 {
+        seconds, err := admin.ParseDuration(parts[2])
+        if err != nil {
+            return err
+        }
+        if seconds > 0 {
+            until = time.Now().Add(time.Duration(seconds) * time.Second)
+            untilPtr = &until
+        }
+    }
+
+    if err := database.NewChannelMuteRepository(c.server.db).Mute(c.user.UserID, channel.ChannelID, untilPtr); err != nil {
+        return err
+    }
+
+    for _, client := range c.server.clientsForUser(c.user.UserID) {
+        client.setChannelMute(channel.ChannelID, until)
+    }
+
+    if untilPtr != nil {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Muted %s until %s", c.server.config.Server.ServerName, c.user.Username, channelName, until.Format(time.RFC3339)))
+    } else {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Muted %s until you UNMUTECHAN it", c.server.config.Server.ServerName, c.user.Username, channelName))
+    }
+
+    return nil
+}
+
+func (c *Client) handleUnmuteChan(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("UNMUTECHAN", "UNMUTECHAN <channel>")
+    }
+
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    if err := database.NewChannelMuteRepository(c.server.db).Unmute(c.user.UserID, channel.ChannelID); err != nil {
+        return err
+    }
+
+    for _, client := range c.server.clientsForUser(c.user.UserID) {
+        client.clearChannelMute(channel.ChannelID)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Unmuted %s", c.server.config.Server.ServerName, c.user.Username, channelName))
+
+    return nil
+}
+
+// handleMarkRead clears the caller's unread count for a channel, for
+// clients that showed its messages without asking for HISTORY.
+func (c *Client) handleMarkRead(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("MARKREAD", "MARKREAD <channel>")
+    }
+
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    if err != nil {
+        return fmt.Errorf("failed to check membership: %w", err)
+    }
+    if !isMember {
+        return numerics.NotOnChannel(channelName)
+    }
+
+    c.markRead(channel.ChannelID)
+    return nil
+}
+
+// markRead records that the user has seen a channel's latest messages.
+func (c *Client) markRead(channelID int64) {
+    if c.observer {
+        return
+    }
+    c.server.recordEvent(events.ChannelRead, &c.user.UserID, &channelID, struct{}{})
+}
+
+func (c *Client) loadChannelMutes() {
+    mutes, err := database.NewChannelMuteRepository(c.server.db).GetActive(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to load channel mutes for %s: %v", c.user.Username, err)
+        return
+    }
+
+    for channelID, until := range mutes {
+        c.setChannelMute(channelID, until)
+    }
+}
+
+func (c *Client) sendChannelKey(channelID int64, channelName string) {
+    if c.publicKey == nil {
+        return
+    }
+
+    wrappedKey, err := c.server.channelKeys.WrapKeyFor(channelID, c.publicKey)
+    if err != nil {
+        log.Printf("Failed to wrap channel key for %s in %s: %v", c.user.Username, channelName, err)
+        return
+    }
+
+    c.Send(fmt.Sprintf("CHANKEY %s :%s", channelName, wrappedKey))
+}
+
+// relayChannelMessage sends message to a channel as c. Plugins call it for a
+// session from their own goroutine, so the username is read with Username.
+func (c *Client) relayChannelMessage(channelID int64, channelName, message string) {
+    username := c.Username()
+    msg := fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s",
+        username, username, c.Host(), channelName, message)
+    sessionID := c.SessionID
+    userID := c.user.UserID
+
+    c.server.channelActivity.Touch(channelID)
+
+    // Delivery and storage each run in order per channel on the worker pool,
+    // so a slow recipient or database never stalls the sender's read loop.
+    c.server.channelSeqs.Assign(channelID, func(seq int64) {
+        // Whole seconds, so the stored sent_at matches what was signed.
+        sentAt := time.Now().Truncate(time.Second)
+        signature := c.server.signChannelMessage(channelName, username, seq, sentAt, message)
+
+        c.server.submitOrdered(fmt.Sprintf("deliver-%d", channelID), "deliver", func() error {
+            c.server.deliverChannelMessage(channelID, msg, seq, sentAt, signature, sessionID)
+            c.Send(c.withTags(seq, sentAt, signature, msg))
+            c.server.propagate(link.CmdMessage, username, channelName, message)
+            return nil
+        })
+
+        c.server.submitOrdered(fmt.Sprintf("store-%d", channelID), "store", func() error {
+            c.server.persistChannelMessage(channelID, userID, seq, message, signature, sentAt)
+            return nil
+        })
+    })
+}
+
+func (s *Server) persistChannelMessage(channelID, userID, seq int64, message, signature string, sentAt time.Time) {
+    var messageID int64
+    if s.config.Features.EnableMessageHistory {
+        id, err := s.messageStore.StoreChannelMessage(channelID, userID, seq, message, signature, sentAt)
+        if err != nil {
+            log.Printf("Failed to store message for channel %d: %v", channelID, err)
+        }
+        messageID = id
+    }
+
+    s.indexMessage(messageID, channelID, userID, message)
+
+    s.recordEvent(events.MessageSent, &userID, &channelID, events.MessageSentData{
+        MessageID: messageID,
+        Length:    len(message),
+    })
+}
+
+func (c *Client) sendChannelHistory(channelName string, limit int) error {
+    if err := c.server.requireFeature(featureHistory); err != nil {
+        return err
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    if err != nil {
+        return fmt.Errorf("failed to check membership: %w", err)
+    }
+
+    if !isMember {
+        return numerics.NotOnChannel(channelName)
+    }
+
+    messageRepo := database.NewMessageRepository(c.server.db)
+    messages, err := messageRepo.GetChannelHistory(channel.ChannelID, limit)
+    if err != nil {
+        return err
+    }
+
+    usernames := make(map[int64]string)
+    lines := make([]string, 0, len(messages)+1)
+    for _, message := range messages {
+        content, ok := c.server.readStoredMessage(message, channelName)
+        if !ok {
+            continue
+        }
+
+        lines = append(lines, c.withStoredTags(message, fmt.Sprintf(":%s HISTORY %s %s %d :%s",
+            c.server.config.Server.ServerName, channelName, c.server.cachedUsername(usernames, message.UserID), message.SentAt.Unix(), content)))
+    }
+
+    lines = append(lines, fmt.Sprintf(":%s NOTICE %s :End of history for %s",
+        c.server.config.Server.ServerName, c.user.Username, channelName))
+    c.SendBatch(lines)
+
+    // The history ends with the newest message, so the channel is read.
+    c.markRead(channel.ChannelID)
+
+    return nil
+}
+
+// readStoredMessage decrypts a stored channel message and checks it against
+// its MAC. Messages that fail either step, or have no MAC, are logged and
+// skipped; upgradeMessageMACs gives older messages one at startup.
+func (s *Server) readStoredMessage(message *models.Message, channelName string) (string, bool) {
+    content, err := s.channelKeys.DecryptMessage(message.ChannelID, message.MessageContent)
+    if err != nil {
+        log.Printf("Failed to decrypt message %d in %s: %v", message.MessageID, channelName, err)
+        return "", false
+    }
+
+    valid := false
+    if message.MessageHash != nil {
+        valid, err = s.channelKeys.VerifyMessage(message.ChannelID, content, *message.MessageHash)
+    }
+    if err != nil || !valid {
+        log.Printf("Integrity check failed for message %d in %s", message.MessageID, channelName)
+        return "", false
+    }
+
+    return content, true
+}
+
+func (s *Server) cachedUsername(usernames map[int64]string, userID int64) string {
+    username, exists := usernames[userID]
+    if !exists {
+        username = "unknown"
+        if user, err := s.authService.GetUserByID(userID); err == nil {
+            username = user.Username
+        }
+        usernames[userID] = username
+    }
+    return username
+}
+
 func joinStrings(strs []string, sep string) string {
     if len(strs) == 0 {
         return ""
@@ -0,0 +1,386 @@
+package server
+
+import (
+    "fmt"
+    "sync"
+
+    "github.com/onyxirc/server/internal/cluster"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+// ChannelManager caches channels, their members' roles and their modes so
+// that routing a message needs no database round trip. Writes go through
+// the database first and then update the cache; anything changed behind
+// its back (a rename, an admin restore, another cluster node) must call
+// Invalidate.
+type ChannelManager struct {
+    repo     *database.ChannelRepository
+    modeRepo *database.ChannelModeRepository
+    mu       sync.RWMutex
+    byName   map[string]int64
+    channels map[int64]*cachedChannel
+    changed  func(channelID int64)
+}
+
+type cachedChannel struct {
+    channel *models.Channel
+    names   []string
+    members map[int64]string
+    modes   *models.ChannelModes
+    version int
+}
+
+func NewChannelManager(db *database.DB) *ChannelManager {
+    return &ChannelManager{
+        repo:     database.NewChannelRepository(db),
+        modeRepo: database.NewChannelModeRepository(db),
+        byName:   make(map[string]int64),
+        channels: make(map[int64]*cachedChannel),
+    }
+}
+
+// OnChange registers fn to be called after every write, so other holders
+// of a cache (cluster nodes) can drop the channel.
+func (m *ChannelManager) OnChange(fn func(channelID int64)) {
+    m.changed = fn
+}
+
+func (m *ChannelManager) notify(channelID int64) {
+    if m.changed != nil {
+        m.changed(channelID)
+    }
+}
+
+// GetByName returns a copy of the channel; callers may not modify the
+// cache through it.
+func (m *ChannelManager) GetByName(channelName string) (*models.Channel, error) {
+    m.mu.RLock()
+    channelID, exists := m.byName[channelName]
+    var entry *cachedChannel
+    if exists {
+        entry = m.channels[channelID]
+    }
+    m.mu.RUnlock()
+
+    if entry != nil {
+        channel := *entry.channel
+        return &channel, nil
+    }
+
+    channel, err := m.repo.GetByName(channelName)
+    if err != nil {
+        return nil, err
+    }
+
+    m.store(channelName, channel)
+
+    copied := *channel
+    return &copied, nil
+}
+
+func (m *ChannelManager) GetByID(channelID int64) (*models.Channel, error) {
+    m.mu.RLock()
+    entry := m.channels[channelID]
+    m.mu.RUnlock()
+
+    if entry != nil {
+        channel := *entry.channel
+        return &channel, nil
+    }
+
+    channel, err := m.repo.GetByID(channelID)
+    if err != nil {
+        return nil, err
+    }
+
+    m.store(channel.ChannelName, channel)
+
+    copied := *channel
+    return &copied, nil
+}
+
+func (m *ChannelManager) store(name string, channel *models.Channel) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    entry, exists := m.channels[channel.ChannelID]
+    if !exists {
+        entry = &cachedChannel{channel: channel}
+        m.channels[channel.ChannelID] = entry
+    }
+
+    if _, known := m.byName[name]; !known {
+        m.byName[name] = channel.ChannelID
+        entry.names = append(entry.names, name)
+    }
+}
+
+// entry returns the cached channel with its members loaded. A write that
+// lands while the members are read bumps the version, and the stale list
+// is read again rather than cached.
+func (m *ChannelManager) entry(channelID int64) (*cachedChannel, error) {
+    for {
+        m.mu.RLock()
+        entry := m.channels[channelID]
+        loaded := entry != nil && entry.members != nil
+        version := 0
+        if entry != nil {
+            version = entry.version
+        }
+        m.mu.RUnlock()
+
+        if loaded {
+            return entry, nil
+        }
+
+        if entry == nil {
+            if _, err := m.GetByID(channelID); err != nil {
+                return nil, err
+            }
+            continue
+        }
+
+        members, err := m.repo.GetMembers(channelID)
+        if err != nil {
+            return nil, err
+        }
+
+        roles := make(map[int64]string, len(members))
+        for _, member := range members {
+            roles[member.UserID] = member.Role
+        }
+
+        m.mu.Lock()
+        current := m.channels[channelID]
+        if current == entry && entry.version == version && entry.members == nil {
+            entry.members = roles
+        }
+        m.mu.Unlock()
+    }
+}
+
+func (m *ChannelManager) IsMember(channelID, userID int64) (bool, error) {
+    entry, err := m.entry(channelID)
+    if err != nil {
+        return false, fmt.Errorf("failed to check membership: %w", err)
+    }
+
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    _, member := entry.members[userID]
+    return member, nil
+}
+
+func (m *ChannelManager) GetMemberRole(channelID, userID int64) (string, error) {
+    entry, err := m.entry(channelID)
+    if err != nil {
+        return "", fmt.Errorf("failed to get role: %w", err)
+    }
+
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    role, member := entry.members[userID]
+    if !member {
+        return "", fmt.Errorf("not a member")
+    }
+    return role, nil
+}
+
+// Modes returns a copy of the channel's modes.
+func (m *ChannelManager) Modes(channelID int64) (*models.ChannelModes, error) {
+    m.mu.RLock()
+    entry := m.channels[channelID]
+    var cached *models.ChannelModes
+    version := 0
+    if entry != nil {
+        cached = entry.modes
+        version = entry.version
+    }
+    m.mu.RUnlock()
+
+    if cached != nil {
+        modes := *cached
+        return &modes, nil
+    }
+
+    modes, err := m.modeRepo.Get(channelID)
+    if err != nil {
+        return nil, err
+    }
+
+    m.mu.Lock()
+    if current := m.channels[channelID]; current != nil && current == entry && entry.version == version {
+        stored := *modes
+        current.modes = &stored
+    }
+    m.mu.Unlock()
+
+    return modes, nil
+}
+
+func (m *ChannelManager) Create(channelName string, createdBy int64, isPrivate bool) (*models.Channel, error) {
+    channel, err := m.repo.Create(channelName, createdBy, isPrivate)
+    if err != nil {
+        return nil, err
+    }
+
+    m.store(channelName, channel)
+
+    m.mu.Lock()
+    if entry := m.channels[channel.ChannelID]; entry != nil {
+        entry.members = map[int64]string{createdBy: "owner"}
+    }
+    m.mu.Unlock()
+
+    m.notify(channel.ChannelID)
+
+    copied := *channel
+    return &copied, nil
+}
+
+func (m *ChannelManager) AddMember(channelID, userID int64, role string) error {
+    if err := m.repo.AddMember(channelID, userID, role); err != nil {
+        return err
+    }
+
+    m.setMember(channelID, userID, role)
+    m.notify(channelID)
+    return nil
+}
+
+// JoinMember adds userID through ChannelRepository.JoinMember and returns
+// the role it was given.
+func (m *ChannelManager) JoinMember(channelID, userID int64) (string, error) {
+    role, err := m.repo.JoinMember(channelID, userID)
+    if err != nil {
+        return "", err
+    }
+
+    m.setMember(channelID, userID, role)
+    m.notify(channelID)
+    return role, nil
+}
+
+// LeaveChannel removes userID through ChannelRepository.LeaveChannel.
+func (m *ChannelManager) LeaveChannel(channelID, userID int64) error {
+    if err := m.repo.LeaveChannel(channelID, userID); err != nil {
+        return err
+    }
+
+    m.forgetMember(channelID, userID)
+    return nil
+}
+
+func (m *ChannelManager) RemoveMember(channelID, userID int64) error {
+    if err := m.repo.RemoveMember(channelID, userID); err != nil {
+        return err
+    }
+
+    m.forgetMember(channelID, userID)
+    return nil
+}
+
+func (m *ChannelManager) forgetMember(channelID, userID int64) {
+    m.mu.Lock()
+    if entry := m.channels[channelID]; entry != nil {
+        entry.version++
+        if entry.members != nil {
+            delete(entry.members, userID)
+        }
+    }
+    m.mu.Unlock()
+
+    m.notify(channelID)
+}
+
+func (m *ChannelManager) SetMemberRole(channelID, userID int64, role string) error {
+    if err := m.repo.SetMemberRole(channelID, userID, role); err != nil {
+        return err
+    }
+
+    m.setMember(channelID, userID, role)
+    m.notify(channelID)
+    return nil
+}
+
+func (m *ChannelManager) TransferOwnership(channelID, fromUserID, toUserID int64) error {
+    if err := m.repo.TransferOwnership(channelID, fromUserID, toUserID); err != nil {
+        return err
+    }
+
+    m.setMember(channelID, fromUserID, "moderator")
+    m.setMember(channelID, toUserID, "owner")
+    m.notify(channelID)
+    return nil
+}
+
+func (m *ChannelManager) setMember(channelID, userID int64, role string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if entry := m.channels[channelID]; entry != nil {
+        entry.version++
+        if entry.members != nil {
+            entry.members[userID] = role
+        }
+    }
+}
+
+func (m *ChannelManager) SetModes(channelID int64, modes *models.ChannelModes) error {
+    if err := m.modeRepo.Set(channelID, modes); err != nil {
+        return err
+    }
+
+    m.mu.Lock()
+    if entry := m.channels[channelID]; entry != nil {
+        entry.version++
+        stored := *modes
+        entry.modes = &stored
+    }
+    m.mu.Unlock()
+
+    m.notify(channelID)
+    return nil
+}
+
+// Invalidate drops everything cached about a channel; the next lookup
+// reads it from the database again.
+func (m *ChannelManager) Invalidate(channelID int64) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    entry, exists := m.channels[channelID]
+    if !exists {
+        return
+    }
+
+    for _, name := range entry.names {
+        delete(m.byName, name)
+    }
+    delete(m.channels, channelID)
+}
+
+// Flush drops the whole cache, for bulk changes such as the inactivity
+// sweep archiving channels.
+func (m *ChannelManager) Flush() {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.byName = make(map[string]int64)
+    m.channels = make(map[int64]*cachedChannel)
+}
+
+// invalidateChannel drops a channel changed outside the ChannelManager from
+// this node's cache and the other nodes'.
+func (s *Server) invalidateChannel(channelID int64) {
+    s.channels.Invalidate(channelID)
+    s.publish(&cluster.Event{Kind: cluster.KindChannel, ChannelIDs: []int64{channelID}})
+}
+
+func (s *Server) flushChannels() {
+    s.channels.Flush()
+    s.publish(&cluster.Event{Kind: cluster.KindChannel})
+}
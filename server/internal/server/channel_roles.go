@@ -0,0 +1,130 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+// roleTarget looks up the channel and the member whose role a command
+// changes, along with the member's current role.
+func (c *Client) roleTarget(command string, parts []string) (*models.Channel, *models.User, string, error) {
+    if len(parts) < 3 {
+        return nil, nil, "", numerics.NeedMoreParams(command, command+" <channel> <nick>")
+    }
+
+    channelName := parts[1]
+    nick := parts[2]
+    channels := c.server.channels
+
+    channel, err := channels.GetByName(channelName)
+    if err != nil {
+        return nil, nil, "", numerics.NoSuchChannel(channelName)
+    }
+
+    target, err := c.server.authService.GetUserByUsername(nick)
+    if err != nil {
+        return nil, nil, "", numerics.NoSuchNick(nick)
+    }
+
+    role, err := channels.GetMemberRole(channel.ChannelID, target.UserID)
+    if err != nil {
+        return nil, nil, "", numerics.UserNotInChannel(nick, channelName)
+    }
+
+    return channel, target, role, nil
+}
+
+// handleOp makes a member a moderator, the same as MODE +v. Only the owner
+// or an admin may do it.
+func (c *Client) handleOp(parts []string) error {
+    return c.setModerator("OP", parts, true)
+}
+
+// handleDeop returns a moderator to an ordinary member. The owner cannot
+// be demoted; ownership has to be handed on with OWNER instead.
+func (c *Client) handleDeop(parts []string) error {
+    return c.setModerator("DEOP", parts, false)
+}
+
+func (c *Client) setModerator(command string, parts []string, promote bool) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    channel, target, role, err := c.roleTarget(command, parts)
+    if err != nil {
+        return err
+    }
+
+    if !c.user.IsAdmin {
+        own, err := c.server.channels.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil || own != "owner" {
+            return numerics.ChanOPrivsNeeded(channel.ChannelName)
+        }
+    }
+
+    if role == "owner" {
+        return fmt.Errorf("%s owns %s; transfer ownership with OWNER instead", target.Username, channel.ChannelName)
+    }
+
+    newRole, sign := "member", "-"
+    if promote {
+        newRole, sign = "moderator", "+"
+    }
+    if role == newRole {
+        return nil
+    }
+
+    if err := c.server.channels.SetMemberRole(channel.ChannelID, target.UserID, newRole); err != nil {
+        return err
+    }
+
+    c.broadcastRoleChange(channel, sign+"v "+target.Username)
+    log.Printf("User %s set %s to %s in %s", c.user.Username, target.Username, newRole, channel.ChannelName)
+
+    return nil
+}
+
+// handleOwner hands ownership of a channel to another member. Only the
+// owner can do this, and steps down to moderator.
+func (c *Client) handleOwner(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    channel, target, role, err := c.roleTarget("OWNER", parts)
+    if err != nil {
+        return err
+    }
+
+    own, err := c.server.channels.GetMemberRole(channel.ChannelID, c.user.UserID)
+    if err != nil || own != "owner" {
+        return numerics.ChanOPrivsNeeded(channel.ChannelName)
+    }
+
+    if role == "owner" {
+        return nil
+    }
+
+    if err := c.server.channels.TransferOwnership(channel.ChannelID, c.user.UserID, target.UserID); err != nil {
+        return fmt.Errorf("failed to transfer ownership: %w", err)
+    }
+
+    c.broadcastRoleChange(channel, strings.Join([]string{"+o-o+v", target.Username, c.user.Username, c.user.Username}, " "))
+    log.Printf("User %s transferred ownership of %s to %s", c.user.Username, channel.ChannelName, target.Username)
+
+    return nil
+}
+
+func (c *Client) broadcastRoleChange(channel *models.Channel, change string) {
+    modeMsg := fmt.Sprintf(":%s!%s@%s MODE %s %s",
+        c.user.Username, c.user.Username, c.Host(), channel.ChannelName, change)
+    c.server.BroadcastToChannel(channel.ChannelID, modeMsg, "")
+    if !c.IsInChannel(channel.ChannelID) {
+        c.Send(modeMsg)
+    }
+}
@@ -2,14 +2,21 @@ package server
 
 import (
     "bufio"
+    "crypto/rsa"
+    "errors"
     "fmt"
+    "io"
     "log"
     "net"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
 
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/codec"
     "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
     "github.com/onyxirc/server/internal/security"
 )
 
@@ -19,24 +26,73 @@ type Client struct {
     session      *security.Session
     SessionID    string
     user         *models.User
+    pendingUsername string
+    usernameMu   sync.RWMutex
     authenticated bool
-    sessionKey   []byte 
+    sessionKey   *auth.KeyBuffer
+    keys         *auth.SessionKeys
+    previousKeys *auth.SessionKeys
+    previousKeyUntil time.Time
+    keyRotatedAt time.Time
+    rekeyRequestedAt time.Time
+    keyMu        sync.Mutex
+    publicKey    *rsa.PublicKey
+    publicKeyFingerprint string
+    publicKeyUnknown bool
     channels     []int64
+    mutedChannels map[int64]time.Time
     channelsMu   sync.RWMutex
     writer       *bufio.Writer
+    out          *countingWriter
+    writeBroken  bool
     writerMu     sync.Mutex
+    writeTimeouts int
     disconnect   chan struct{}
     once         sync.Once
+    endSession   bool
+    adminOnly    bool
+    connectedAt  time.Time
+    lastActive   int64
+    enabledCaps  []string
+    awayMessage  string
+    awayMu       sync.RWMutex
+    snomasks     map[rune]bool
+    snomaskMu    sync.RWMutex
+    typingSent   map[int64]time.Time
+    evasionRestricted int32
+    dnsblListings []security.DNSBLZone
+    userModes    map[rune]bool
+    userModeMu   sync.RWMutex
+    pendingPaste *pasteUpload
+    observer     bool
+    observerSeq  int64
+    observerMu   sync.Mutex
+    keyExchanged bool
+    framed       int32
+    protoVersion int32
+    wireEncrypted int32
+    unwrapping   bool
+    pendingLogin *pendingLogin
+    pingSent     int64
+    missedPongs  int32
 }
 
 func NewClient(conn net.Conn, server *Server) *Client {
+    out := &countingWriter{w: conn}
     return &Client{
         conn:          conn,
         server:        server,
         authenticated: false,
         channels:      []int64{},
-        writer:        bufio.NewWriter(conn),
+        mutedChannels: make(map[int64]time.Time),
+        snomasks:      make(map[rune]bool),
+        userModes:     make(map[rune]bool),
+        typingSent:    make(map[int64]time.Time),
+        writer:        bufio.NewWriter(out),
+        out:           out,
         disconnect:    make(chan struct{}),
+        connectedAt:   time.Now(),
+        lastActive:    time.Now().UnixNano(),
     }
 }
 
@@ -53,79 +109,370 @@ func (c *Client) Handle() {
         return
     }
     c.Send(fmt.Sprintf("PUBKEY :%s", string(publicKeyPEM)))
+    c.sendIdentity()
 
-    scanner := bufio.NewScanner(c.conn)
-    for scanner.Scan() {
-        line := scanner.Text()
-        line = strings.TrimSpace(line)
+    c.sendISupport()
+
+    go c.keepalive()
+
+    reader := bufio.NewReaderSize(c.conn, c.server.maxLineLength())
+    frames := codec.NewDecoder(reader, c.server.maxLineLength())
+    for {
+        line, err := c.readCommand(reader, frames)
+        if err == errLineTooLong || err == codec.ErrFrameTooLarge {
+            c.Send(fmt.Sprintf("ERROR :Input line too long (max %d bytes)", c.server.maxLineLength()))
+            continue
+        }
+        if err != nil {
+            if err != io.EOF {
+                log.Printf("Read error: %v", err)
+            }
+            break
+        }
 
         if line == "" {
             continue
         }
 
         c.conn.SetReadDeadline(time.Now().Add(c.server.config.Server.ReadTimeout))
+        c.markAlive()
+
+        if c.authenticated {
+            c.server.sessionManager.UpdateActivity(c.SessionID)
+        }
 
         if err := c.processCommand(line); err != nil {
             log.Printf("Error processing command: %v", err)
-            c.Send(fmt.Sprintf("ERROR :%v", err))
+            c.sendError(err)
 
             if strings.Contains(err.Error(), "account locked") {
                 return
             }
         }
-    }
 
-    if err := scanner.Err(); err != nil {
-        log.Printf("Scanner error: %v", err)
+        c.rotateKeyIfDue()
     }
 }
 
 func (c *Client) processCommand(line string) error {
-    parts := strings.Fields(line)
+    c.applyPendingRename()
+
+    parts := c.splitCommand(line)
     if len(parts) == 0 {
         return nil
     }
 
     command := strings.ToUpper(parts[0])
 
+    started := time.Now()
+    err := c.dispatchCommand(command, parts)
+    c.server.commandMetrics.Observe(command, time.Since(started), err)
+    return err
+}
+
+func (c *Client) dispatchCommand(command string, parts []string) error {
+    if command != "PING" && command != "PONG" {
+        atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+    }
+
+    if err := c.checkObserverCommand(command); err != nil {
+        return err
+    }
+
+    if err := c.checkWireEncryption(command); err != nil {
+        return err
+    }
+
+    parts, handled, err := c.runCommandHooks(command, parts)
+    if err != nil || handled {
+        return err
+    }
+
     switch command {
+    case "CAP":
+        return c.handleCap(parts)
+    case "PROTOVER":
+        return c.handleProtover(parts)
     case "REGISTER":
         return c.handleRegister(parts)
     case "LOGIN":
         return c.handleLogin(parts)
+    case "ACCOUNT":
+        return c.handleAccount(parts)
+    case "SESSIONS":
+        return c.handleSessions(parts)
+    case "LOGINHISTORY":
+        return c.handleLoginHistory(parts)
+    case "TRUSTIP":
+        return c.handleTrustIP(parts)
+    case "AUTH":
+        return c.handleAuth(parts)
+    case "ENABLE2FA":
+        return c.handleEnable2FA(parts)
+    case "VERIFY2FA":
+        return c.handleVerify2FA(parts)
+    case "DISABLE2FA":
+        return c.handleDisable2FA(parts)
+    case "RESETPASS":
+        return c.handleResetPass(parts)
+    case "FORGOTPASS":
+        return c.handleForgotPass(parts)
+    case "SETEMAIL":
+        return c.handleSetEmail(parts)
+    case "VERIFYEMAIL":
+        return c.handleVerifyEmail(parts)
+    case "RESUME":
+        return c.handleResume(parts)
+    case "NICK":
+        return c.handleNick(parts)
+    case "WHOIS":
+        return c.handleWhois(parts)
+    case "WHO":
+        return c.handleWho(parts)
+    case "TYPING":
+        return c.handleTyping(parts)
+    case "READ":
+        return c.handleRead(parts)
+    case "AWAY":
+        return c.handleAway(parts)
     case "KEYEXCHANGE":
         return c.handleKeyExchange(parts)
+    case "REKEY":
+        return c.handleRekey(parts)
+    case "FINGERPRINT":
+        return c.handleFingerprint(parts)
+    case "PUBKEY":
+        return c.handlePubKey(parts)
     case "JOIN":
         return c.handleJoin(parts)
+    case "MODE":
+        return c.handleMode(parts)
+    case "INVITE":
+        return c.handleInvite(parts)
+    case "OP":
+        return c.handleOp(parts)
+    case "DEOP":
+        return c.handleDeop(parts)
+    case "OWNER":
+        return c.handleOwner(parts)
     case "PART":
         return c.handlePart(parts)
+    case "JOINTHROTTLE":
+        return c.handleJoinThrottle(parts)
+    case "REPORT":
+        return c.handleReport(parts)
+    case "ARCHIVE":
+        return c.handleArchive(parts)
+    case "UNARCHIVE":
+        return c.handleUnarchive(parts)
+    case "RENAME":
+        return c.handleRename(parts)
+    case "FORWARD":
+        return c.handleForward(parts)
+    case "MUTECHAN":
+        return c.handleMuteChan(parts)
+    case "UNMUTECHAN":
+        return c.handleUnmuteChan(parts)
+    case "MARKREAD":
+        return c.handleMarkRead(parts)
     case "PRIVMSG":
         return c.handlePrivMsg(parts)
+    case "HISTORY":
+        return c.handleHistory(parts)
+    case "SEARCH":
+        return c.handleSearch(parts)
+    case "RESEND":
+        return c.handleResend(parts)
+    case "SINCE":
+        return c.handleSince(parts)
+    case "EXPORT":
+        return c.handleExport(parts)
     case "QUIT":
         return c.handleQuit(parts)
     case "PING":
         return c.handlePing(parts)
+    case "PASTE":
+        return c.handlePaste(parts)
+    case "GETPASTE":
+        return c.handleGetPaste(parts)
+    case "FRAMING":
+        return c.handleFraming(parts)
+    case "ENCRYPTION":
+        return c.handleEncryption(parts)
+    case "ENCRYPTED":
+        return c.handleEncrypted(parts)
+    case "SIGNKEY":
+        return c.handleSignKey(parts)
     case "PONG":
         return nil 
+    case "KILL":
+        return c.handleKill(parts)
+    case "SNOMASK":
+        return c.handleSnomask(parts)
     case "ADMIN":
         return c.handleAdminCommand(parts)
     default:
-        return fmt.Errorf("unknown command: %s", command)
+        return numerics.UnknownCommand(command)
     }
 }
 
+// sendError reports a failed command, as a numeric reply if the handler
+// gave one and as an ERROR line otherwise.
+func (c *Client) sendError(err error) {
+    var numeric *numerics.Error
+    if !errors.As(err, &numeric) {
+        c.Send(fmt.Sprintf("ERROR :%v", err))
+        return
+    }
+
+    nick := "*"
+    if c.authenticated {
+        nick = c.user.Username
+    }
+    c.Send(numeric.Reply(c.server.config.Server.ServerName, nick))
+}
+
 func (c *Client) Send(message string) {
     c.writerMu.Lock()
     defer c.writerMu.Unlock()
 
-    if _, err := c.writer.WriteString(message + "\r\n"); err != nil {
-        log.Printf("Failed to write to client: %v", err)
+    if !c.beginWrite() {
+        return
+    }
+
+    if err := c.writeLine(message); err != nil {
+        c.handleWriteError(err)
         return
     }
 
+    c.writeTimeouts = 0
+}
+
+// SendBatch sends a multi-line reply with a single flush, so a history
+// replay or NAMES list costs a few writes instead of one per line. Lines
+// are never interleaved with other output. WebSocket clients still get one
+// message per line.
+func (c *Client) SendBatch(messages []string) {
+    if len(messages) == 0 {
+        return
+    }
+
+    c.writerMu.Lock()
+    defer c.writerMu.Unlock()
+
+    if !c.beginWrite() {
+        return
+    }
+
+    _, perLine := c.conn.(*websocketConn)
+    for _, message := range messages {
+        var err error
+        if perLine {
+            err = c.writeLine(message)
+        } else {
+            err = c.bufferLine(message)
+        }
+        if err != nil {
+            c.handleWriteError(err)
+            return
+        }
+    }
+
     if err := c.writer.Flush(); err != nil {
-        log.Printf("Failed to flush writer: %v", err)
+        c.handleWriteError(err)
+        return
+    }
+
+    c.writeTimeouts = 0
+}
+
+// writeLine writes and flushes one line. The caller holds writerMu.
+func (c *Client) writeLine(message string) error {
+    if err := c.bufferLine(message); err != nil {
+        return err
+    }
+    return c.writer.Flush()
+}
+
+// bufferLine writes one line to the buffered writer in the connection's
+// current wire format: the protocol version shim, then the ENCRYPTED
+// envelope, then binary framing or CRLF. The caller holds writerMu and
+// flushes.
+func (c *Client) bufferLine(message string) error {
+    line := c.outbound(message)
+
+    if c.isWireEncrypted() {
+        sealed, err := c.sealLine(line)
+        if err != nil {
+            return err
+        }
+        line = sealed
+    }
+
+    if c.isFramed() {
+        return codec.WriteFrame(c.writer, []byte(line))
+    }
+    _, err := c.writer.WriteString(line + "\r\n")
+    return err
+}
+
+// countingWriter counts the bytes that reach the connection.
+type countingWriter struct {
+    w       io.Writer
+    written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+    n, err := w.w.Write(p)
+    w.written += int64(n)
+    return n, err
+}
+
+// beginWrite sets the write deadline and starts counting the bytes written,
+// so handleWriteError can tell whether any reached the client. It reports
+// false once a write has failed part way, as nothing more may be sent. The
+// caller holds writerMu, and the writer is empty: every write ends with a
+// flush.
+func (c *Client) beginWrite() bool {
+    if c.writeBroken {
+        return false
     }
+    if timeout := c.server.config.Server.WriteTimeout; timeout > 0 {
+        c.conn.SetWriteDeadline(time.Now().Add(timeout))
+    }
+    c.out.written = 0
+    return true
+}
+
+// handleWriteError deals with a failed write. A timeout before any byte was
+// written drops the unsent lines and keeps the client, up to
+// maxWriteTimeouts in a row; anything else disconnects it, since the client
+// may have received part of a line and the stream can no longer be parsed.
+func (c *Client) handleWriteError(err error) {
+    partial := c.out.written > 0
+    c.writer.Reset(c.out)
+
+    if netErr, ok := err.(net.Error); ok && netErr.Timeout() && !partial {
+        atomic.AddInt64(&c.server.writeMetrics.timeouts, 1)
+        c.writeTimeouts++
+
+        if c.writeTimeouts < maxWriteTimeouts {
+            log.Printf("Write to %s timed out (%d/%d)", c.conn.RemoteAddr().String(), c.writeTimeouts, maxWriteTimeouts)
+            return
+        }
+
+        atomic.AddInt64(&c.server.writeMetrics.stalledDisconnects, 1)
+        log.Printf("Dropping stalled client %s after %d write timeouts", c.conn.RemoteAddr().String(), c.writeTimeouts)
+    } else if partial {
+        c.writeBroken = true
+        atomic.AddInt64(&c.server.writeMetrics.errors, 1)
+        log.Printf("Dropping client %s after a partial write: %v", c.conn.RemoteAddr().String(), err)
+    } else {
+        atomic.AddInt64(&c.server.writeMetrics.errors, 1)
+        log.Printf("Failed to write to client: %v", err)
+    }
+
+    go c.Disconnect()
 }
 
 func (c *Client) Disconnect() {
@@ -134,32 +481,38 @@ func (c *Client) Disconnect() {
 
         if c.authenticated && c.SessionID != "" {
             
-            c.server.RemoveClient(c.SessionID)
+            c.server.detachClient(c)
+            c.server.propagateQuit(c, "Client disconnected")
 
-            c.server.sessionManager.DestroySession(c.SessionID)
+            if c.endSession {
+                c.server.sessionManager.DestroySession(c.SessionID)
+            }
         }
 
+        c.expirePreviousKey(true)
+        c.keys.Destroy()
+
         c.conn.Close()
     })
 }
 
 func (c *Client) GetIPAddress() string {
-    addr := c.conn.RemoteAddr().String()
-    
-    if idx := strings.LastIndex(addr, ":"); idx != -1 {
-        return addr[:idx]
-    }
-    return addr
+    return security.NormalizeIP(c.conn.RemoteAddr().String())
 }
 
 func (c *Client) requireAuth() error {
     if !c.authenticated {
-        return fmt.Errorf("not authenticated")
+        return numerics.NotRegistered()
     }
     return nil
 }
 
+// JoinChannel and LeaveChannel also update the server's member set for the
+// channel. Both the list and the set change under clientsMu, taken before
+// channelsMu as indexClient does, so neither can miss a change to the other.
 func (c *Client) JoinChannel(channelID int64) {
+    c.server.clientsMu.Lock()
+    defer c.server.clientsMu.Unlock()
     c.channelsMu.Lock()
     defer c.channelsMu.Unlock()
 
@@ -168,17 +521,20 @@ func (c *Client) JoinChannel(channelID int64) {
             return
         }
     }
-
     c.channels = append(c.channels, channelID)
+    c.server.addChannelMember(channelID, c)
 }
 
 func (c *Client) LeaveChannel(channelID int64) {
+    c.server.clientsMu.Lock()
+    defer c.server.clientsMu.Unlock()
     c.channelsMu.Lock()
     defer c.channelsMu.Unlock()
 
     for i, cid := range c.channels {
         if cid == channelID {
             c.channels = append(c.channels[:i], c.channels[i+1:]...)
+            c.server.unindexChannelMember(channelID, c)
             return
         }
     }
@@ -195,3 +551,93 @@ func (c *Client) IsInChannel(channelID int64) bool {
     }
     return false
 }
+
+func (c *Client) GetChannels() []int64 {
+    c.channelsMu.RLock()
+    defer c.channelsMu.RUnlock()
+
+    channels := make([]int64, len(c.channels))
+    copy(channels, c.channels)
+    return channels
+}
+
+func (c *Client) IdleDuration() time.Duration {
+    return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActive)))
+}
+
+// Username returns the client's username for other goroutines, including a
+// rename that the client has not picked up yet. The client's own goroutine
+// may read c.user.Username directly, since only it ever writes the field.
+func (c *Client) Username() string {
+    c.usernameMu.RLock()
+    defer c.usernameMu.RUnlock()
+
+    if c.pendingUsername != "" {
+        return c.pendingUsername
+    }
+    return c.user.Username
+}
+
+// setUsername renames the client. It must run on the client's own goroutine.
+func (c *Client) setUsername(username string) {
+    c.usernameMu.Lock()
+    defer c.usernameMu.Unlock()
+
+    c.user.Username = username
+    if c.session != nil && c.session.User != nil {
+        c.session.User.Username = username
+    }
+    c.pendingUsername = ""
+}
+
+// queueRename records a rename made by another session of the same user,
+// for the client to apply on its own goroutine before its next command.
+func (c *Client) queueRename(username string) {
+    c.usernameMu.Lock()
+    defer c.usernameMu.Unlock()
+
+    if c.user.Username != username {
+        c.pendingUsername = username
+    } else {
+        c.pendingUsername = ""
+    }
+}
+
+func (c *Client) applyPendingRename() {
+    c.usernameMu.RLock()
+    pending := c.pendingUsername
+    c.usernameMu.RUnlock()
+
+    if pending != "" {
+        c.setUsername(pending)
+    }
+}
+
+func (c *Client) AwayMessage() (string, bool) {
+    c.awayMu.RLock()
+    defer c.awayMu.RUnlock()
+
+    return c.awayMessage, c.awayMessage != ""
+}
+
+func (c *Client) IsChannelMuted(channelID int64) bool {
+    c.channelsMu.RLock()
+    defer c.channelsMu.RUnlock()
+
+    until, muted := c.mutedChannels[channelID]
+    return muted && (until.IsZero() || time.Now().Before(until))
+}
+
+func (c *Client) setChannelMute(channelID int64, until time.Time) {
+    c.channelsMu.Lock()
+    defer c.channelsMu.Unlock()
+
+    c.mutedChannels[channelID] = until
+}
+
+func (c *Client) clearChannelMute(channelID int64) {
+    c.channelsMu.Lock()
+    defer c.channelsMu.Unlock()
+
+    delete(c.mutedChannels, channelID)
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/cluster"
+    "github.com/onyxirc/server/internal/security"
+)
+
+const eventTailInterval = 2 * time.Second
+
+func (s *Server) startCluster() error {
+    if !s.config.Cluster.Enabled {
+        return nil
+    }
+
+    c := cluster.New(s.config.Cluster, s.db.Tenant())
+    if err := c.Start(s.applyClusterEvent, s.clusterPresence); err != nil {
+        return fmt.Errorf("failed to join cluster: %w", err)
+    }
+    s.cluster = c
+
+    // Other nodes cache channels too; a write here makes their copy stale.
+    s.channels.OnChange(func(channelID int64) {
+        s.publish(&cluster.Event{Kind: cluster.KindChannel, ChannelIDs: []int64{channelID}})
+    })
+
+    go s.tailEvents()
+
+    return nil
+}
+
+// tailEvents applies the domain events other nodes append to the shared log,
+// so every node's projections see every event.
+func (s *Server) tailEvents() {
+    ticker := time.NewTicker(eventTailInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            if _, err := s.events.CatchUp(); err != nil {
+                log.Printf("Failed to apply events from other nodes: %v", err)
+            }
+        }
+    }
+}
+
+// publish sends a broadcast this node has already delivered to its own
+// clients on to the other nodes, if clustering is enabled.
+func (s *Server) publish(event *cluster.Event) {
+    if s.cluster != nil {
+        s.cluster.Publish(event)
+    }
+}
+
+func (s *Server) clusterPresence() []cluster.Presence {
+    clients := s.authenticatedClients()
+
+    sessions := make([]cluster.Presence, 0, len(clients))
+    for _, client := range clients {
+        if client.observer {
+            continue
+        }
+        sessions = append(sessions, cluster.Presence{
+            Ref:      sessionRef(client.SessionID),
+            UserID:   client.user.UserID,
+            Username: client.Username(),
+        })
+    }
+    return sessions
+}
+
+// applyClusterEvent delivers a broadcast from another node to the clients
+// connected here. It only uses the local variants, so events are never
+// published again.
+func (s *Server) applyClusterEvent(event *cluster.Event) {
+    switch event.Kind {
+    case cluster.KindNotice:
+        s.broadcastNoticeLocal(event.Message)
+    case cluster.KindChannels:
+        s.broadcastToChannelsLocal(event.ChannelIDs, event.Message, "")
+    case cluster.KindMessage:
+        for _, channelID := range event.ChannelIDs {
+            s.deliverChannelMessageLocal(channelID, event.Message, event.Seq, event.SentAt, event.Signature, "")
+        }
+    case cluster.KindRelayed:
+        for _, channelID := range event.ChannelIDs {
+            s.deliverRelayedLocal(channelID, event.Message)
+        }
+    case cluster.KindUserNotice:
+        s.noticeUserLocal(event.UserID, event.Message)
+    case cluster.KindDirect:
+        for _, client := range s.clientsForUser(event.UserID) {
+            client.Send(client.withMessageTags(event.MsgID, event.SentAt, event.Message))
+        }
+    case cluster.KindDisconnect:
+        s.disconnectUserLocal(event.Username, event.Message)
+    case cluster.KindResume:
+        s.detachResumedSession(event.Session)
+    case cluster.KindChannel:
+        if len(event.ChannelIDs) == 0 {
+            s.channels.Flush()
+        }
+        for _, channelID := range event.ChannelIDs {
+            s.channels.Invalidate(channelID)
+        }
+    default:
+        log.Printf("Ignoring cluster event of unknown kind %q from %s", event.Kind, event.Node)
+    }
+}
+
+// detachResumedSession drops the local connection of a session that was
+// resumed on another node.
+func (s *Server) detachResumedSession(sessionHash string) {
+    for _, client := range s.authenticatedClients() {
+        if security.GetSessionHash(client.SessionID) == sessionHash {
+            client.Send("ERROR :Session resumed from another connection")
+            go client.Disconnect()
+        }
+    }
+}
+
+// userOnline reports whether userID has a session on this node or, when
+// clustered, on any other.
+func (s *Server) userOnline(userID int64) bool {
+    if len(s.clientsForUser(userID)) > 0 {
+        return true
+    }
+    return s.cluster != nil && s.cluster.Online(userID)
+}
+
+func (s *Server) clusterNodes() string {
+    nodes := []string{fmt.Sprintf("%s (this node, %d sessions)", s.cluster.Node(), len(s.clusterPresence()))}
+
+    var others []string
+    for node, sessions := range s.cluster.Nodes() {
+        others = append(others, fmt.Sprintf("%s (%d sessions)", node, sessions))
+    }
+    sort.Strings(others)
+
+    return strings.Join(append(nodes, others...), ", ")
+}
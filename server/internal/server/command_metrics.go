@@ -0,0 +1,206 @@
+package server
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+const (
+    // commandWindowSlots one-minute histograms make up the window the
+    // latency percentiles are taken over, so a spike shows up within a
+    // minute and is not averaged away by hours of normal traffic.
+    commandWindowSlots = 5
+
+    // maxTrackedCommands caps the distinct names recorded; commands past it
+    // (only possible through plugins) are counted as OTHER. Commands the
+    // server does not know are counted as UNKNOWN.
+    maxTrackedCommands = 128
+)
+
+// latencyBuckets are the upper bounds of the histogram buckets. A
+// percentile is reported as the bound of the bucket it falls in.
+var latencyBuckets = [...]time.Duration{
+    50 * time.Microsecond,
+    100 * time.Microsecond,
+    250 * time.Microsecond,
+    500 * time.Microsecond,
+    time.Millisecond,
+    2500 * time.Microsecond,
+    5 * time.Millisecond,
+    10 * time.Millisecond,
+    25 * time.Millisecond,
+    50 * time.Millisecond,
+    100 * time.Millisecond,
+    250 * time.Millisecond,
+    500 * time.Millisecond,
+    time.Second,
+    2500 * time.Millisecond,
+    5 * time.Second,
+    10 * time.Second,
+}
+
+type latencyHistogram struct {
+    minute  int64
+    buckets [len(latencyBuckets) + 1]int64
+}
+
+type commandStat struct {
+    count      int64
+    errors     int64
+    totalNanos int64
+    maxNanos   int64
+    window     [commandWindowSlots]latencyHistogram
+}
+
+// CommandSummary is one command's counters and its latency over the last
+// few minutes.
+type CommandSummary struct {
+    Command string
+    Count   int64
+    Errors  int64
+    Avg     time.Duration
+    Max     time.Duration
+    P50     time.Duration
+    P99     time.Duration
+}
+
+// commandMetrics records how long each client command took to handle and
+// whether it failed. Counts, averages and maxima cover the server's
+// lifetime; percentiles cover the last commandWindowSlots minutes.
+type commandMetrics struct {
+    commands map[string]*commandStat
+    mu       sync.Mutex
+}
+
+func newCommandMetrics() *commandMetrics {
+    return &commandMetrics{commands: make(map[string]*commandStat)}
+}
+
+func (m *commandMetrics) Observe(command string, elapsed time.Duration, err error) {
+    var numeric *numerics.Error
+    if errors.As(err, &numeric) && numeric.Code == numerics.ErrUnknownCommand {
+        command = "UNKNOWN"
+    }
+
+    minute := time.Now().Unix() / 60
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    stat, ok := m.commands[command]
+    if !ok {
+        if len(m.commands) >= maxTrackedCommands {
+            command = "OTHER"
+            stat = m.commands[command]
+        }
+        if stat == nil {
+            stat = &commandStat{}
+            m.commands[command] = stat
+        }
+    }
+
+    stat.count++
+    stat.totalNanos += elapsed.Nanoseconds()
+    if elapsed.Nanoseconds() > stat.maxNanos {
+        stat.maxNanos = elapsed.Nanoseconds()
+    }
+    if err != nil {
+        stat.errors++
+    }
+
+    slot := &stat.window[minute%commandWindowSlots]
+    if slot.minute != minute {
+        *slot = latencyHistogram{minute: minute}
+    }
+    slot.buckets[bucketFor(elapsed)]++
+}
+
+func bucketFor(elapsed time.Duration) int {
+    return sort.Search(len(latencyBuckets), func(i int) bool { return elapsed <= latencyBuckets[i] })
+}
+
+// Summaries returns every recorded command, busiest first.
+func (m *commandMetrics) Summaries() []CommandSummary {
+    minute := time.Now().Unix() / 60
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    summaries := make([]CommandSummary, 0, len(m.commands))
+    for command, stat := range m.commands {
+        var merged [len(latencyBuckets) + 1]int64
+        var windowCount int64
+        for _, slot := range stat.window {
+            if minute-slot.minute >= commandWindowSlots {
+                continue
+            }
+            for i, n := range slot.buckets {
+                merged[i] += n
+                windowCount += n
+            }
+        }
+
+        summary := CommandSummary{
+            Command: command,
+            Count:   stat.count,
+            Errors:  stat.errors,
+            Avg:     time.Duration(stat.totalNanos / stat.count),
+            Max:     time.Duration(stat.maxNanos),
+            P50:     percentileBucket(merged[:], windowCount, 0.50, time.Duration(stat.maxNanos)),
+            P99:     percentileBucket(merged[:], windowCount, 0.99, time.Duration(stat.maxNanos)),
+        }
+        summaries = append(summaries, summary)
+    }
+
+    sort.Slice(summaries, func(i, j int) bool {
+        if summaries[i].Count != summaries[j].Count {
+            return summaries[i].Count > summaries[j].Count
+        }
+        return summaries[i].Command < summaries[j].Command
+    })
+    return summaries
+}
+
+// percentileBucket is the upper bound of the bucket holding the p-th
+// sample, capped at the maximum seen. The overflow bucket has no bound and
+// reports the maximum.
+func percentileBucket(buckets []int64, total int64, p float64, max time.Duration) time.Duration {
+    if total == 0 {
+        return 0
+    }
+
+    rank := int64(float64(total-1)*p) + 1
+    var seen int64
+    for i, n := range buckets {
+        seen += n
+        if seen < rank {
+            continue
+        }
+        if i < len(latencyBuckets) && latencyBuckets[i] < max {
+            return latencyBuckets[i]
+        }
+        break
+    }
+    return max
+}
+
+// Snapshot flattens the summaries into metrics keys such as
+// command.privmsg.p99_us.
+func (m *commandMetrics) Snapshot() map[string]int64 {
+    snapshot := make(map[string]int64)
+    for _, summary := range m.Summaries() {
+        prefix := "command." + strings.ToLower(summary.Command)
+        snapshot[prefix+".count"] = summary.Count
+        snapshot[prefix+".errors"] = summary.Errors
+        snapshot[prefix+".avg_us"] = summary.Avg.Microseconds()
+        snapshot[prefix+".max_us"] = summary.Max.Microseconds()
+        snapshot[prefix+".p50_us"] = summary.P50.Microseconds()
+        snapshot[prefix+".p99_us"] = summary.P99.Microseconds()
+    }
+    return snapshot
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/console"
+    "github.com/onyxirc/server/internal/database"
+)
+
+var consoleCommands = []string{"help", "stats", "users", "broadcast", "kick", "rehash", "shutdown", "restart"}
+
+type Console struct {
+    server      *Server
+    reader      *console.Reader
+    out         io.Writer
+    configPath  string
+    stop        func()
+    interactive bool
+}
+
+// NewConsole reads commands from in. On a terminal it shows a prompt and
+// completes names; otherwise, as on the admin socket, it reads plain lines
+// and writes only command output.
+func NewConsole(s *Server, in io.Reader, out io.Writer, configPath string, stop func()) *Console {
+    c := &Console{
+        server:     s,
+        out:        out,
+        configPath: configPath,
+        stop:       stop,
+    }
+
+    prompt := ""
+    if f, ok := in.(*os.File); ok && console.IsTerminal(f) {
+        c.interactive = true
+        prompt = "onyxirc> "
+    }
+    c.reader = console.NewReader(in, out, prompt, c.complete)
+    return c
+}
+
+func (c *Console) Run() {
+    if c.interactive {
+        fmt.Fprintln(c.out, "OnyxIRC console ready; type \"help\" for commands")
+    }
+
+    for {
+        line, err := c.reader.ReadLine()
+        if err != nil {
+            if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+                log.Printf("Console read error: %v", err)
+            }
+            return
+        }
+
+        parts := strings.Fields(line)
+        if len(parts) == 0 {
+            continue
+        }
+
+        if err := c.execute(parts); err != nil {
+            fmt.Fprintf(c.out, "error: %v\n", err)
+        }
+    }
+}
+
+func (c *Console) Close() {
+    c.reader.Close()
+}
+
+func (c *Console) execute(parts []string) error {
+    switch strings.ToLower(parts[0]) {
+    case "help":
+        fmt.Fprintln(c.out, "stats                      show server statistics")
+        fmt.Fprintln(c.out, "users                      list connected users")
+        fmt.Fprintln(c.out, "broadcast <message>        send a notice to every client")
+        fmt.Fprintln(c.out, "kick <username> <reason>   disconnect a user")
+        fmt.Fprintln(c.out, "rehash                     reload features, join_throttle, lockdown, kill_cooldown, login limits and ip_allow/ip_deny from the config file")
+        fmt.Fprintln(c.out, "shutdown [delay|cancel]    stop the server, now or after a countdown")
+        fmt.Fprintln(c.out, "restart [delay]            stop the server with the restart exit code")
+        return nil
+    case "stats":
+        return c.stats()
+    case "users":
+        for _, username := range c.server.connectedUsernames() {
+            fmt.Fprintln(c.out, username)
+        }
+        return nil
+    case "broadcast":
+        if len(parts) < 2 {
+            return fmt.Errorf("usage: broadcast <message>")
+        }
+        message := strings.Join(parts[1:], " ")
+        c.server.BroadcastNotice(message)
+        log.Printf("Console broadcast message: %s", message)
+        return nil
+    case "kick":
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: kick <username> <reason>")
+        }
+        reason := strings.Join(parts[2:], " ")
+        c.server.EnforceKick(parts[1], reason)
+        log.Printf("Console kicked user %s: %s", parts[1], reason)
+        return nil
+    case "rehash":
+        if err := c.server.Rehash(c.configPath); err != nil {
+            return err
+        }
+        fmt.Fprintf(c.out, "Reloaded %s\n", c.configPath)
+        return nil
+    case "shutdown", "restart":
+        restart := strings.ToLower(parts[0]) == "restart"
+        if len(parts) > 1 && strings.EqualFold(parts[1], "cancel") {
+            return c.server.CancelStop()
+        }
+        if len(parts) == 1 && !restart {
+            c.stop()
+            return nil
+        }
+
+        delayStr := ""
+        if len(parts) > 1 {
+            delayStr = parts[1]
+        }
+        delaySeconds, err := admin.ParseDuration(delayStr)
+        if err != nil {
+            return err
+        }
+        return c.server.ScheduleStop(time.Duration(delaySeconds)*time.Second, restart)
+    default:
+        return fmt.Errorf("unknown command: %s", parts[0])
+    }
+}
+
+func (c *Console) stats() error {
+    stats := c.server.adminService.Stats()
+    stats["active_connections"] = c.server.GetActiveClientCount()
+    stats["active_sessions"] = c.server.sessionManager.GetActiveSessionCount()
+    for key, value := range c.server.Metrics() {
+        stats[key] = value
+    }
+    for key, value := range c.server.eventStats.Snapshot() {
+        stats["events."+key] = value
+    }
+
+    keys := make([]string, 0, len(stats))
+    for key := range stats {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        fmt.Fprintf(c.out, "%s: %v\n", key, stats[key])
+    }
+    return nil
+}
+
+func (c *Console) complete(line string) []string {
+    words := strings.Fields(line)
+    if len(words) == 0 || (len(words) == 1 && !strings.HasSuffix(line, " ")) {
+        return consoleCommands
+    }
+
+    word := ""
+    if !strings.HasSuffix(line, " ") {
+        word = words[len(words)-1]
+    }
+
+    if strings.HasPrefix(word, "#") {
+        return c.server.channelNames()
+    }
+
+    return c.server.connectedUsernames()
+}
+
+func (s *Server) connectedUsernames() []string {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    seen := make(map[string]bool)
+    var usernames []string
+    for _, client := range s.clients {
+        if client.user != nil && !seen[client.Username()] {
+            seen[client.Username()] = true
+            usernames = append(usernames, client.Username())
+        }
+    }
+
+    sort.Strings(usernames)
+    return usernames
+}
+
+func (s *Server) channelNames() []string {
+    channels, err := database.NewChannelRepository(s.db).List()
+    if err != nil {
+        return nil
+    }
+
+    names := make([]string, 0, len(channels))
+    for _, channel := range channels {
+        names = append(names, channel.ChannelName)
+    }
+    return names
+}
+
+func (s *Server) Rehash(path string) error {
+    cfg, err := config.Load(path)
+    if err != nil {
+        return err
+    }
+
+    s.config.Features = cfg.Features
+    s.config.JoinThrottle = cfg.JoinThrottle
+    s.config.Lockdown = cfg.Lockdown
+    s.config.Bots = cfg.Bots
+    s.config.Filter = cfg.Filter
+    s.config.Spam = cfg.Spam
+    s.config.Security.KillCooldown = cfg.Security.KillCooldown
+    if err := s.ipFilter.SetStatic(cfg.Security.IPAllow, cfg.Security.IPDeny); err != nil {
+        return err
+    }
+    s.config.Security.IPAllow = cfg.Security.IPAllow
+    s.config.Security.IPDeny = cfg.Security.IPDeny
+    if dropped := s.disconnectAddress(); dropped > 0 {
+        log.Printf("Dropped %d connections now refused by ip_deny", dropped)
+    }
+    s.joinThrottle.SetConfig(cfg.JoinThrottle)
+    s.authService.SetLoginLimits(
+        cfg.Security.MaxLoginAttempts,
+        cfg.Security.MaxLoginAttemptsPerIP,
+        time.Duration(cfg.Security.LoginAttemptWindow)*time.Second,
+    )
+
+    if err := s.loadTunables(); err != nil {
+        log.Printf("Failed to reapply runtime config after rehash: %v", err)
+    }
+
+    log.Printf("Configuration reloaded from %s", path)
+    return nil
+}
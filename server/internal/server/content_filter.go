@@ -0,0 +1,275 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/moderation"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+type filterMuteKey struct {
+    userID    int64
+    channelID int64
+}
+
+// contentFilter holds the compiled ADMIN filter rules and the mutes they
+// have handed out. Mutes are kept in memory only and end on restart.
+type contentFilter struct {
+    mu     sync.RWMutex
+    filter *moderation.Filter
+    mutes  map[filterMuteKey]time.Time
+}
+
+func newContentFilter() *contentFilter {
+    return &contentFilter{mutes: make(map[filterMuteKey]time.Time)}
+}
+
+func (f *contentFilter) set(filter *moderation.Filter) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    f.filter = filter
+}
+
+func (f *contentFilter) check(channelID int64, text string) *moderation.Result {
+    f.mu.RLock()
+    defer f.mu.RUnlock()
+
+    return f.filter.Check(channelID, text)
+}
+
+func (f *contentFilter) mute(key filterMuteKey, until time.Time) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    f.mutes[key] = until
+}
+
+func (f *contentFilter) mutedFor(key filterMuteKey) time.Duration {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    until, ok := f.mutes[key]
+    if !ok {
+        return 0
+    }
+    if remaining := time.Until(until); remaining > 0 {
+        return remaining
+    }
+    delete(f.mutes, key)
+    return 0
+}
+
+func (s *Server) reloadFilters() error {
+    rules, err := database.NewFilterRepository(s.db).List()
+    if err != nil {
+        return fmt.Errorf("failed to load filter rules: %w", err)
+    }
+
+    s.contentFilter.set(moderation.New(rules))
+    return nil
+}
+
+// applyContentFilter runs an outgoing message through the filter rules and
+// returns the text to deliver. channelID is 0 for a direct message. Admins
+// are not filtered.
+func (c *Client) applyContentFilter(channelID int64, target, message string) (string, error) {
+    if c.user.IsAdmin {
+        return message, nil
+    }
+
+    refuse := func(reason string) error {
+        if channelID != 0 {
+            return numerics.CannotSendToChan(target, reason)
+        }
+        return fmt.Errorf("message to %s %s", target, reason)
+    }
+
+    key := filterMuteKey{userID: c.user.UserID, channelID: channelID}
+    if remaining := c.server.contentFilter.mutedFor(key); remaining > 0 {
+        return "", refuse(fmt.Sprintf("muted by content filter for %s", remaining.Round(time.Second)))
+    }
+
+    result := c.server.contentFilter.check(channelID, message)
+
+    for _, rule := range result.Warned {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Your message to %s matched content filter rule %d; please keep it civil",
+            c.server.config.Server.ServerName, c.user.Username, target, rule.RuleID))
+    }
+
+    for _, rule := range result.Reported {
+        c.server.serverNotice('m', fmt.Sprintf("Filter rule %d matched %s in %s: %s", rule.RuleID, c.user.Username, target, message))
+    }
+
+    if result.Blocked == nil {
+        return result.Text, nil
+    }
+
+    if result.Mute && c.server.config.Filter.MuteDuration > 0 {
+        duration := c.server.config.Filter.MuteDuration
+        c.server.contentFilter.mute(key, time.Now().Add(duration))
+        c.server.serverNotice('m', fmt.Sprintf("Filter rule %d muted %s in %s for %s: %s", result.Blocked.RuleID, c.user.Username, target, duration, message))
+        log.Printf("Content filter rule %d muted %s in %s for %s", result.Blocked.RuleID, c.user.Username, target, duration)
+        return "", refuse(fmt.Sprintf("muted by content filter for %s", duration))
+    }
+
+    return "", refuse("blocked by content filter")
+}
+
+func (c *Client) handleAdminFilter(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN filter add|del|list|test")
+    }
+
+    switch strings.ToLower(args[0]) {
+    case "add":
+        return c.handleAdminFilterAdd(args[1:])
+    case "del":
+        return c.handleAdminFilterDel(args[1:])
+    case "list":
+        return c.handleAdminFilterList(args[1:])
+    case "test":
+        return c.handleAdminFilterTest(args[1:])
+    default:
+        return fmt.Errorf("unknown filter subcommand: %s", args[0])
+    }
+}
+
+func (c *Client) handleAdminFilterAdd(args []string) error {
+    if len(args) < 4 {
+        return fmt.Errorf("usage: ADMIN filter add <global|#channel> <block|replace|warn|mute|report|allow> <words|regex> <pattern> [replacement]")
+    }
+
+    channelName := args[0]
+    if strings.EqualFold(channelName, "global") {
+        channelName = ""
+    }
+
+    rule := &models.FilterRule{
+        Action:  strings.ToLower(args[1]),
+        Kind:    strings.ToLower(args[2]),
+        Pattern: args[3],
+    }
+    if len(args) > 4 {
+        rule.Replacement = strings.Join(args[4:], " ")
+    }
+
+    ruleID, err := c.server.adminService.AddFilterRule(c.user.UserID, channelName, rule)
+    if err != nil {
+        return err
+    }
+
+    if err := c.server.reloadFilters(); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Added filter rule %d", c.server.config.Server.ServerName, c.user.Username, ruleID))
+    log.Printf("Admin %s added filter rule %d: %s %s %s", c.user.Username, ruleID, rule.Action, rule.Kind, rule.Pattern)
+
+    return nil
+}
+
+func (c *Client) handleAdminFilterDel(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN filter del <id>")
+    }
+
+    ruleID, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid rule id: %s", args[0])
+    }
+
+    if err := c.server.adminService.DeleteFilterRule(c.user.UserID, ruleID); err != nil {
+        return err
+    }
+
+    if err := c.server.reloadFilters(); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Deleted filter rule %d", c.server.config.Server.ServerName, c.user.Username, ruleID))
+    log.Printf("Admin %s deleted filter rule %d", c.user.Username, ruleID)
+
+    return nil
+}
+
+func (c *Client) handleAdminFilterList(args []string) error {
+    rules, err := c.server.adminService.ListFilterRules(c.user.UserID)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    shown := 0
+    for _, rule := range rules {
+        scope := "global"
+        if rule.ChannelID != nil {
+            scope = rule.ChannelName
+        }
+        if len(args) > 0 && !strings.EqualFold(scope, args[0]) {
+            continue
+        }
+
+        line := fmt.Sprintf("%d %s %s %s %s", rule.RuleID, scope, rule.Action, rule.Kind, rule.Pattern)
+        if rule.Replacement != "" {
+            line += " -> " + rule.Replacement
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s", serverName, c.user.Username, line))
+        shown++
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :%d filter rules", serverName, c.user.Username, shown))
+    return nil
+}
+
+// handleAdminFilterTest shows what the filter would do with a message
+// without sending it.
+func (c *Client) handleAdminFilterTest(args []string) error {
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    var channelID int64
+    target := "a direct message"
+    if len(args) > 0 && strings.HasPrefix(args[0], "#") {
+        channel, err := c.server.channels.GetByName(args[0])
+        if err != nil {
+            return numerics.NoSuchChannel(args[0])
+        }
+        channelID, target = channel.ChannelID, channel.ChannelName
+        args = args[1:]
+    }
+
+    if len(args) == 0 {
+        return fmt.Errorf("usage: ADMIN filter test [#channel] <text>")
+    }
+    text := strings.TrimPrefix(strings.Join(args, " "), ":")
+
+    result := c.server.contentFilter.check(channelID, text)
+
+    var outcome string
+    switch {
+    case result.Mute:
+        outcome = fmt.Sprintf("muted by rule %d", result.Blocked.RuleID)
+    case result.Blocked != nil:
+        outcome = fmt.Sprintf("blocked by rule %d", result.Blocked.RuleID)
+    default:
+        outcome = "delivered as: " + result.Text
+    }
+    for _, rule := range result.Warned {
+        outcome += fmt.Sprintf(" (warned by rule %d)", rule.RuleID)
+    }
+    for _, rule := range result.Reported {
+        outcome += fmt.Sprintf(" (reported by rule %d)", rule.RuleID)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :In %s, %s", c.server.config.Server.ServerName, c.user.Username, target, outcome))
+    return nil
+}
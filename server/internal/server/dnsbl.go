@@ -0,0 +1,76 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/security"
+)
+
+func newDNSBLChecker(cfg config.DNSBLConfig) *security.DNSBLChecker {
+    zones := make([]security.DNSBLZone, 0, len(cfg.Zones))
+    for _, zone := range cfg.Zones {
+        zones = append(zones, security.DNSBLZone{Zone: zone.Zone, Action: zone.Action, Reason: zone.Reason})
+    }
+    return security.NewDNSBLChecker(zones, cfg.Timeout, cfg.CacheTTL)
+}
+
+// checkDNSBL looks the client's address up in the configured blocklists
+// before registration. Listings are announced on snomask d; if any zone
+// listing the address rejects, it returns false and the connection is
+// refused. Otherwise the listings are kept on the client for REGISTER and
+// WHOIS.
+func (s *Server) checkDNSBL(client *Client, lc config.ListenerConfig) bool {
+    ipAddress := client.GetIPAddress()
+    listings := s.dnsbl.Check(ipAddress)
+    if len(listings) == 0 {
+        return true
+    }
+
+    zones := make([]string, 0, len(listings))
+    var rejected *security.DNSBLZone
+    for i, listing := range listings {
+        zones = append(zones, listing.Zone)
+        if listing.Action == "reject" && rejected == nil {
+            rejected = &listings[i]
+        }
+    }
+
+    if rejected != nil {
+        reason := rejected.Reason
+        if reason == "" {
+            reason = fmt.Sprintf("Your address is listed on %s", rejected.Zone)
+        }
+
+        message := fmt.Sprintf("Refused connection from %s on %s: listed on %s", ipAddress, lc.Name, strings.Join(zones, ", "))
+        s.serverNotice('d', message)
+        log.Print(message)
+
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", ipAddress, reason))
+        return false
+    }
+
+    client.dnsblListings = listings
+
+    message := fmt.Sprintf("Connection from %s on %s is listed on %s", ipAddress, lc.Name, strings.Join(zones, ", "))
+    if client.dnsblRequiresAuth() {
+        message += " (registration refused)"
+    }
+    s.serverNotice('d', message)
+    log.Print(message)
+
+    return true
+}
+
+// dnsblRequiresAuth reports whether a zone listing the client's address only
+// allows logging in to existing accounts.
+func (c *Client) dnsblRequiresAuth() bool {
+    for _, listing := range c.dnsblListings {
+        if listing.Action == "require_auth" {
+            return true
+        }
+    }
+    return false
+}
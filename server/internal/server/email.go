@@ -0,0 +1,165 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/numerics"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const (
+    defaultEmailTokenTTL = time.Hour
+    emailLimit           = 3
+    emailWindow          = time.Hour
+)
+
+func (s *Server) emailTokenTTL() time.Duration {
+    if ttl := s.config.Accounts.EmailTokenTTL; ttl > 0 {
+        return ttl
+    }
+    return defaultEmailTokenTTL
+}
+
+func (s *Server) requireMailer() error {
+    if s.mailer == nil {
+        return fmt.Errorf("email is not enabled on this server")
+    }
+    return nil
+}
+
+// sendMail hands a message to the mailer on the worker pool, so a slow
+// relay does not hold up the client.
+func (s *Server) sendMail(to, subject, body string) {
+    err := s.workerPool.SubmitPriority("mail", threadpool.PriorityLow, func() error {
+        if err := s.mailer.Send(to, subject, body); err != nil {
+            log.Printf("Failed to send %q to %s: %v", subject, to, err)
+            return err
+        }
+        return nil
+    })
+    if err != nil {
+        log.Printf("Failed to queue mail to %s: %v", to, err)
+    }
+}
+
+// sendVerification sets a new email address for userID and mails it a
+// verification code.
+func (s *Server) sendVerification(userID int64, username, email string) error {
+    token, err := s.authService.SetEmail(userID, email, s.emailTokenTTL())
+    if err != nil {
+        return err
+    }
+
+    s.sendMail(email, "Verify your email address", fmt.Sprintf(
+        "Your verification code for %s on %s is:\n\n%s\n\nSend VERIFYEMAIL %s within %s to confirm this address.\n",
+        username, s.config.Server.ServerName, token, token, s.emailTokenTTL()))
+    return nil
+}
+
+// handleSetEmail sets or, with *, removes the caller's email address. A new
+// address must be confirmed with VERIFYEMAIL before it can be used to reset
+// the password.
+func (c *Client) handleSetEmail(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("SETEMAIL", "SETEMAIL <email|*>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    if parts[1] == "*" {
+        if _, err := c.server.authService.SetEmail(c.user.UserID, "", 0); err != nil {
+            return err
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Email address removed", serverName, c.user.Username))
+        log.Printf("User %s removed their email address", c.user.Username)
+        return nil
+    }
+
+    if err := c.server.requireMailer(); err != nil {
+        return err
+    }
+
+    if wait := c.server.emailLimits.allow(c.server.emailLimits.actions, c.user.UserID, emailLimit, emailWindow); wait > 0 {
+        return fmt.Errorf("too many email requests; try again in %s", wait.Round(time.Second))
+    }
+
+    email := parts[1]
+    if err := c.server.sendVerification(c.user.UserID, c.user.Username, email); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :A verification code has been sent to %s; confirm it with VERIFYEMAIL <code>", serverName, c.user.Username, email))
+    log.Printf("User %s set their email address", c.user.Username)
+
+    return nil
+}
+
+func (c *Client) handleVerifyEmail(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("VERIFYEMAIL", "VERIFYEMAIL <code>")
+    }
+
+    email, err := c.server.authService.VerifyEmail(c.user.UserID, parts[1])
+    if err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Email address %s verified", c.server.config.Server.ServerName, c.user.Username, email))
+    log.Printf("User %s verified their email address", c.user.Username)
+
+    return nil
+}
+
+// handleForgotPass mails a password reset code to the account's verified
+// address, to be used with RESETPASS. The reply is the same whether or not
+// one was sent, so it cannot be used to probe accounts.
+func (c *Client) handleForgotPass(parts []string) error {
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("FORGOTPASS", "FORGOTPASS <username>")
+    }
+
+    if err := c.server.requireMailer(); err != nil {
+        return err
+    }
+
+    username := parts[1]
+    reply := fmt.Sprintf(":%s NOTICE * :If %s has a verified email address, a reset code has been sent to it. Use RESETPASS <username> <code> <new_password_hash>",
+        c.server.config.Server.ServerName, username)
+
+    user, err := c.server.authService.GetUserByUsername(username)
+    if err != nil {
+        c.Send(reply)
+        return nil
+    }
+
+    if wait := c.server.emailLimits.allow(c.server.emailLimits.actions, user.UserID, emailLimit, emailWindow); wait > 0 {
+        c.Send(reply)
+        return nil
+    }
+
+    user, email, token, err := c.server.authService.CreateEmailReset(username, c.server.emailTokenTTL())
+    if err != nil {
+        log.Printf("No reset email sent for %s: %v", username, err)
+        c.Send(reply)
+        return nil
+    }
+
+    c.server.sendMail(email, "Password reset", fmt.Sprintf(
+        "A password reset was requested for %s on %s from %s.\n\nYour reset code is:\n\n%s\n\nSend RESETPASS %s %s <new password> within %s. If you did not ask for this, ignore this message; your password has not changed.\n",
+        user.Username, c.server.config.Server.ServerName, c.GetIPAddress(), token, user.Username, token, c.server.emailTokenTTL()))
+
+    c.Send(reply)
+    log.Printf("Password reset email requested for %s from %s", user.Username, c.GetIPAddress())
+
+    return nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+    "encoding/base64"
+    "fmt"
+    "log"
+    "strings"
+    "sync/atomic"
+)
+
+// envelopeCommands may still be sent in the clear while wire encryption is
+// on: the envelope itself and connection keepalives.
+var envelopeCommands = map[string]bool{
+    "ENCRYPTED": true,
+    "PING":      true,
+    "PONG":      true,
+    "QUIT":      true,
+}
+
+func (c *Client) isWireEncrypted() bool {
+    return atomic.LoadInt32(&c.wireEncrypted) == 1
+}
+
+func (c *Client) checkWireEncryption(command string) error {
+    if !c.isWireEncrypted() || c.unwrapping || envelopeCommands[command] {
+        return nil
+    }
+    return fmt.Errorf("wire encryption is on: send %s inside ENCRYPTED", command)
+}
+
+// sealLine wraps an outbound line in an ENCRYPTED envelope under the
+// client's encryption key. With binary framing the ciphertext is sent raw
+// instead of base64-encoded.
+func (c *Client) sealLine(line string) (string, error) {
+    ciphertext, err := c.server.cryptoManager.SealFrame(c.keys, line)
+    if err != nil {
+        return "", err
+    }
+
+    if c.isFramed() {
+        raw, err := base64.StdEncoding.DecodeString(ciphertext)
+        if err != nil {
+            return "", err
+        }
+        ciphertext = string(raw)
+    }
+
+    return "ENCRYPTED :" + ciphertext, nil
+}
+
+// syncWebSocketFrames makes a WebSocket connection send binary frames while
+// it is framed or wire encrypted, and text frames otherwise.
+func (c *Client) syncWebSocketFrames() {
+    if ws, ok := c.conn.(*websocketConn); ok {
+        ws.setBinary(c.isFramed() || c.isWireEncrypted())
+    }
+}
+
+// handleEncryption turns the ENCRYPTED envelope on or off for everything the
+// server sends. The confirmation is always sent in the clear. While it is
+// on, commands other than ENCRYPTED, PING, PONG and QUIT must arrive
+// wrapped.
+func (c *Client) handleEncryption(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: ENCRYPTION <ON|OFF>")
+    }
+
+    if !c.keyExchanged {
+        return fmt.Errorf("wire encryption requires a completed KEYEXCHANGE")
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    switch strings.ToUpper(parts[1]) {
+    case "ON":
+        if c.isWireEncrypted() {
+            return fmt.Errorf("wire encryption is already on")
+        }
+
+        c.writerMu.Lock()
+        if !c.beginWrite() {
+            c.writerMu.Unlock()
+            return nil
+        }
+        err := c.writeLine(fmt.Sprintf(":%s ENCRYPTION ON", serverName))
+        if err == nil {
+            atomic.StoreInt32(&c.wireEncrypted, 1)
+            c.syncWebSocketFrames()
+        } else {
+            c.handleWriteError(err)
+        }
+        c.writerMu.Unlock()
+
+        if err != nil {
+            return nil
+        }
+        log.Printf("User %s enabled wire encryption", c.user.Username)
+    case "OFF":
+        if !c.isWireEncrypted() {
+            return fmt.Errorf("wire encryption is not on")
+        }
+
+        atomic.StoreInt32(&c.wireEncrypted, 0)
+        c.syncWebSocketFrames()
+        c.Send(fmt.Sprintf(":%s ENCRYPTION OFF", serverName))
+        log.Printf("User %s disabled wire encryption", c.user.Username)
+    default:
+        return fmt.Errorf("usage: ENCRYPTION <ON|OFF>")
+    }
+
+    return nil
+}
+
+// handleEncrypted decrypts a command sealed with the session key and runs
+// it as if it had been sent directly. Anything it relays is re-encrypted
+// for each recipient with their own session key, or sent in the clear to
+// recipients without wire encryption.
+func (c *Client) handleEncrypted(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: ENCRYPTED <ciphertext>")
+    }
+
+    if !c.keyExchanged {
+        return fmt.Errorf("ENCRYPTED requires a completed KEYEXCHANGE")
+    }
+
+    if c.unwrapping {
+        return fmt.Errorf("nested ENCRYPTED envelopes are not allowed")
+    }
+
+    ciphertext := strings.TrimPrefix(strings.Join(parts[1:], " "), ":")
+    if c.isFramed() {
+        ciphertext = base64.StdEncoding.EncodeToString([]byte(ciphertext))
+    }
+
+    line, err := c.server.cryptoManager.OpenFrame(c.keys, ciphertext)
+    if err != nil {
+        line, err = c.decryptWithPreviousKey(ciphertext, err)
+    }
+    if err != nil {
+        return fmt.Errorf("invalid ENCRYPTED envelope: %w", err)
+    }
+
+    line = strings.TrimSpace(line)
+    if line == "" {
+        return nil
+    }
+
+    c.unwrapping = true
+    defer func() { c.unwrapping = false }()
+
+    return c.processCommand(line)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    defaultEvasionIPDays = 30
+    evasionReportLimit   = 50
+)
+
+func (s *Server) evasionAction() string {
+    switch s.config.Security.BanEvasionAction {
+    case "flag", "restrict":
+        return s.config.Security.BanEvasionAction
+    default:
+        return ""
+    }
+}
+
+// checkBanEvasion links user to actively banned accounts that logged in from
+// the same address or use the same public key. New links are flagged for
+// review, announced on snomask e and, with ban_evasion_action: restrict,
+// restrict the account until an admin clears it.
+func (s *Server) checkBanEvasion(user *models.User, ipAddress, fingerprint string) {
+    action := s.evasionAction()
+    if action == "" || user.IsAdmin {
+        return
+    }
+
+    repo := database.NewEvasionRepository(s.db)
+
+    days := s.config.Security.BanEvasionIPDays
+    if days <= 0 {
+        days = defaultEvasionIPDays
+    }
+
+    var flags []*models.EvasionFlag
+    byIP, err := repo.BannedUsersByIP(ipAddress, time.Now().AddDate(0, 0, -days), user.UserID)
+    if err != nil {
+        log.Printf("Ban evasion check failed for %s: %v", user.Username, err)
+    }
+    for _, bannedID := range byIP {
+        flags = append(flags, &models.EvasionFlag{UserID: user.UserID, BannedUserID: bannedID, EvidenceType: database.EvidenceIP, Evidence: ipAddress})
+    }
+
+    if fingerprint != "" {
+        byKey, err := repo.BannedUsersByKey(fingerprint, user.UserID)
+        if err != nil {
+            log.Printf("Ban evasion check failed for %s: %v", user.Username, err)
+        }
+        for _, bannedID := range byKey {
+            flags = append(flags, &models.EvasionFlag{UserID: user.UserID, BannedUserID: bannedID, EvidenceType: database.EvidenceKey, Evidence: fingerprint})
+        }
+    }
+
+    restricted := false
+    for _, flag := range flags {
+        flag.Restricted = action == "restrict"
+
+        created, err := repo.Record(flag)
+        if err != nil {
+            log.Printf("Failed to record ban evasion flag for %s: %v", user.Username, err)
+            continue
+        }
+        if !created {
+            continue
+        }
+
+        bannedName := strconv.FormatInt(flag.BannedUserID, 10)
+        if banned, err := s.authService.GetUserByID(flag.BannedUserID); err == nil {
+            bannedName = banned.Username
+        }
+
+        message := fmt.Sprintf("Possible ban evasion: %s shares %s %s with banned account %s", user.Username, flag.EvidenceType, flag.Evidence, bannedName)
+        if flag.Restricted {
+            message += " (restricted)"
+            restricted = true
+        }
+        s.serverNotice('e', message)
+        log.Print(message)
+    }
+
+    if restricted {
+        for _, client := range s.clientsForUser(user.UserID) {
+            client.setEvasionRestricted(true)
+        }
+    }
+}
+
+func (c *Client) setEvasionRestricted(restricted bool) {
+    var value int32
+    if restricted {
+        value = 1
+    }
+    atomic.StoreInt32(&c.evasionRestricted, value)
+}
+
+func (c *Client) loadEvasionRestriction() {
+    restricted, err := database.NewEvasionRepository(c.server.db).IsRestricted(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to load evasion restriction for %s: %v", c.user.Username, err)
+        return
+    }
+    c.setEvasionRestricted(restricted)
+}
+
+func (c *Client) checkEvasionRestriction() error {
+    if atomic.LoadInt32(&c.evasionRestricted) == 0 {
+        return nil
+    }
+    return fmt.Errorf("your account is restricted pending admin review")
+}
+
+func (c *Client) handleAdminEvasion(args []string) error {
+    serverName := c.server.config.Server.ServerName
+
+    if len(args) > 0 && strings.EqualFold(args[0], "clear") {
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ADMIN evasion clear <username>")
+        }
+
+        user, cleared, err := c.server.adminService.ClearEvasion(c.user.UserID, args[1])
+        if err != nil {
+            return err
+        }
+
+        for _, client := range c.server.clientsForUser(user.UserID) {
+            client.setEvasionRestricted(false)
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Cleared %d evasion flags for %s", serverName, c.user.Username, cleared, user.Username))
+        log.Printf("Admin %s cleared ban evasion flags for %s", c.user.Username, user.Username)
+        return nil
+    }
+
+    username := ""
+    if len(args) > 0 {
+        username = args[0]
+    }
+
+    flags, err := c.server.adminService.EvasionReport(c.user.UserID, username, evasionReportLimit)
+    if err != nil {
+        return err
+    }
+
+    title := "Open ban evasion flags"
+    if username != "" {
+        title = "Ban evasion flags for " + username
+    }
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== %s (%d) ===", serverName, c.user.Username, title, len(flags)))
+
+    for _, flag := range flags {
+        status := "open"
+        if flag.ReviewedAt != nil {
+            status = "reviewed " + flag.ReviewedAt.Format(time.RFC3339)
+        } else if flag.Restricted {
+            status = "restricted"
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s -> banned %s via %s %s at %s [%s]", serverName, c.user.Username,
+            flag.Username, flag.BannedUsername, flag.EvidenceType, flag.Evidence, flag.DetectedAt.Format(time.RFC3339), status))
+    }
+
+    return nil
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+func (c *Client) handleExport(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: EXPORT <channel> <json|text> [from] [to]")
+    }
+
+    channelName := parts[1]
+
+    format, err := export.ParseFormat(parts[2])
+    if err != nil {
+        return err
+    }
+
+    fromStr, toStr := "", ""
+    if len(parts) > 3 {
+        fromStr = parts[3]
+    }
+    if len(parts) > 4 {
+        toStr = parts[4]
+    }
+
+    from, to, err := export.ParseRange(fromStr, toStr)
+    if err != nil {
+        return err
+    }
+
+    channel, err := c.server.authorizeExport(c.user, channelName)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    username := c.user.Username
+
+    err = c.server.queueExport(c.user, channel, format, from, to, func(name string, err error) {
+        if err != nil {
+            c.Send(fmt.Sprintf(":%s NOTICE %s :Export of %s failed: %v", serverName, username, channelName, err))
+            return
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Export of %s ready: %s", serverName, username, channelName, c.server.exportLocation(name)))
+    })
+    if err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Export of %s queued", serverName, username, channelName))
+
+    return nil
+}
+
+func (s *Server) authorizeExport(user *models.User, channelName string) (*models.Channel, error) {
+    if err := s.requireFeature(featureHistory); err != nil {
+        return nil, err
+    }
+
+    channelRepo := database.NewChannelRepository(s.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return nil, fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    if user.IsAdmin {
+        return channel, nil
+    }
+
+    role, err := channelRepo.GetMemberRole(channel.ChannelID, user.UserID)
+    if err != nil || role != "owner" {
+        return nil, fmt.Errorf("permission denied: only the channel owner or an admin can export %s", channelName)
+    }
+
+    return channel, nil
+}
+
+func (s *Server) queueExport(requester *models.User, channel *models.Channel, format string, from, to time.Time, done func(name string, err error)) error {
+    jobID := fmt.Sprintf("export-%d-%d", channel.ChannelID, time.Now().UnixNano())
+
+    err := s.workerPool.SubmitPriority(jobID, threadpool.PriorityLow, func() error {
+        if _, err := s.exportStore.Prune(); err != nil {
+            log.Printf("Failed to prune old exports: %v", err)
+        }
+
+        transcript, err := s.buildTranscript(channel, from, to)
+        if err != nil {
+            done("", err)
+            return err
+        }
+
+        name, err := s.exportStore.Save(transcript, format)
+        if err != nil {
+            done("", err)
+            return err
+        }
+
+        log.Printf("User %s exported %d messages from %s", requester.Username, len(transcript.Messages), channel.ChannelName)
+        done(name, nil)
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to queue export: %w", err)
+    }
+
+    return nil
+}
+
+func (s *Server) buildTranscript(channel *models.Channel, from, to time.Time) (*export.Transcript, error) {
+    limit := s.config.Export.MaxMessages
+    if limit <= 0 {
+        limit = s.config.Features.MaxMessageHistory
+    }
+
+    messageRepo := database.NewMessageRepository(s.db)
+    messages, err := messageRepo.GetChannelMessagesInRange(channel.ChannelID, from, to, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    transcript := &export.Transcript{
+        Channel:     channel.ChannelName,
+        From:        from,
+        To:          to,
+        GeneratedAt: time.Now(),
+        SigningKey:  s.signer.PublicKey(),
+        Messages:    make([]export.Entry, 0, len(messages)),
+    }
+
+    usernames := make(map[int64]string)
+    for _, message := range messages {
+        content, err := s.channelKeys.DecryptMessage(channel.ChannelID, message.MessageContent)
+        if err != nil {
+            log.Printf("Failed to decrypt message %d in %s: %v", message.MessageID, channel.ChannelName, err)
+            continue
+        }
+
+        username, exists := usernames[message.UserID]
+        if !exists {
+            username = "unknown"
+            if user, err := s.authService.GetUserByID(message.UserID); err == nil {
+                username = user.Username
+            }
+            usernames[message.UserID] = username
+        }
+
+        transcript.Messages = append(transcript.Messages, export.Entry{
+            MessageID: message.MessageID,
+            Seq:       messageSeq(message),
+            Username:  username,
+            Content:   content,
+            SentAt:    message.SentAt,
+            Signature: messageSignature(message),
+        })
+    }
+
+    return transcript, nil
+}
+
+func (s *Server) exportLocation(name string) string {
+    if s.config.Export.HTTPListen != "" && s.config.Export.BaseURL != "" {
+        return strings.TrimRight(s.config.Export.BaseURL, "/") + "/exports/" + name
+    }
+
+    path, err := s.exportStore.Path(name)
+    if err != nil {
+        return name
+    }
+    return path
+}
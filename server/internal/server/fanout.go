@@ -0,0 +1,135 @@
+package server
+
+import (
+    "fmt"
+    "sync"
+    "sync/atomic"
+
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+// fanoutBatchSize is how many members one fan-out task writes to. Smaller
+// channels are written to inline.
+const fanoutBatchSize = 64
+
+// addChannelMember indexes a client that joined a channel. A client that is
+// not connected yet is indexed by AddClient instead. The caller holds
+// clientsMu for writing.
+func (s *Server) addChannelMember(channelID int64, client *Client) {
+    if s.clients[client.SessionID] == client {
+        s.indexChannelMember(channelID, client)
+    }
+}
+
+// indexChannelMember and unindexChannelMember expect clientsMu held for
+// writing.
+func (s *Server) indexChannelMember(channelID int64, client *Client) {
+    members, exists := s.channelMembers[channelID]
+    if !exists {
+        members = make(map[*Client]struct{})
+        s.channelMembers[channelID] = members
+    }
+    members[client] = struct{}{}
+}
+
+func (s *Server) unindexChannelMember(channelID int64, client *Client) {
+    members := s.channelMembers[channelID]
+    delete(members, client)
+    if len(members) == 0 {
+        delete(s.channelMembers, channelID)
+    }
+}
+
+// membersOf returns the local clients in any of channelIDs, each once,
+// leaving out the session excludeSessionID.
+func (s *Server) membersOf(channelIDs []int64, excludeSessionID string) []*Client {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    if len(channelIDs) == 1 {
+        members := s.channelMembers[channelIDs[0]]
+        clients := make([]*Client, 0, len(members))
+        for client := range members {
+            if client.SessionID != excludeSessionID {
+                clients = append(clients, client)
+            }
+        }
+        return clients
+    }
+
+    seen := make(map[*Client]struct{})
+    var clients []*Client
+    for _, channelID := range channelIDs {
+        for client := range s.channelMembers[channelID] {
+            if _, dup := seen[client]; dup || client.SessionID == excludeSessionID {
+                continue
+            }
+            seen[client] = struct{}{}
+            clients = append(clients, client)
+        }
+    }
+    return clients
+}
+
+type fanoutBatch struct {
+    clients []*Client
+    claimed int32
+}
+
+// fanOut calls send for every client. Large sets are split into batches
+// that run on the worker pool, so one slow connection only holds up its
+// own batch. Batches the pool has not started, including any it had no
+// room for, run in the caller, so a saturated pool slows broadcasts down
+// instead of queueing them. fanOut returns once every client has been
+// written to, which keeps the lines each client receives in the order they
+// were broadcast.
+func (s *Server) fanOut(clients []*Client, send func(*Client)) {
+    if s.workerPool == nil || len(clients) <= fanoutBatchSize {
+        for _, client := range clients {
+            send(client)
+        }
+        return
+    }
+
+    var batches []*fanoutBatch
+    for start := 0; start < len(clients); start += fanoutBatchSize {
+        end := start + fanoutBatchSize
+        if end > len(clients) {
+            end = len(clients)
+        }
+        batches = append(batches, &fanoutBatch{clients: clients[start:end]})
+    }
+
+    var wg sync.WaitGroup
+    wg.Add(len(batches))
+    run := func(batch *fanoutBatch) {
+        if !atomic.CompareAndSwapInt32(&batch.claimed, 0, 1) {
+            return
+        }
+        defer wg.Done()
+        for _, client := range batch.clients {
+            send(client)
+        }
+    }
+
+    // The first batch is always the caller's.
+    for i, batch := range batches[1:] {
+        batch := batch
+        job := threadpool.Job{
+            ID:       fmt.Sprintf("fanout-%d", i+1),
+            Priority: threadpool.PriorityHigh,
+            Task: func() error {
+                run(batch)
+                return nil
+            },
+        }
+        if !s.workerPool.TrySubmit(job) {
+            break
+        }
+    }
+
+    for _, batch := range batches {
+        run(batch)
+    }
+    wg.Wait()
+}
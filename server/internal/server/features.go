@@ -0,0 +1,156 @@
+package server
+
+import (
+    "fmt"
+    "strings"
+)
+
+const (
+    featureHistory        = "history"
+    featureDirectMessages = "direct-messages"
+    featureFileTransfer   = "file-transfer"
+    featureReceipts       = "receipts"
+    featureSequence       = "seq"
+    featureSigning        = "sig"
+    featurePaste          = "paste"
+    featureSearch         = "search"
+
+    capabilityPrefix = "onyxirc/"
+)
+
+func (s *Server) featureEnabled(feature string) bool {
+    switch feature {
+    case featureHistory:
+        return s.config.Features.EnableMessageHistory
+    case featureDirectMessages:
+        return s.config.Features.EnableDirectMessages
+    case featureFileTransfer:
+        return s.config.Features.EnableFileTransfer
+    case featureReceipts:
+        return s.config.Features.EnableReceipts
+    case featureSequence:
+        return s.config.Features.EnableMessageHistory
+    case featureSigning:
+        return s.signer != nil
+    case featurePaste:
+        return s.config.Features.EnablePastes
+    case featureSearch:
+        return s.config.Features.EnableMessageHistory && s.config.Features.MaxSearchResults > 0
+    default:
+        return false
+    }
+}
+
+func (s *Server) requireFeature(feature string) error {
+    if !s.featureEnabled(feature) {
+        return fmt.Errorf("feature disabled: %s", feature)
+    }
+    return nil
+}
+
+func (s *Server) enabledFeatures() []string {
+    var features []string
+    for _, feature := range []string{featureHistory, featureDirectMessages, featureFileTransfer, featureReceipts, featureSequence, featureSigning, featurePaste, featureSearch} {
+        if s.featureEnabled(feature) {
+            features = append(features, feature)
+        }
+    }
+    return features
+}
+
+func (s *Server) capabilities() []string {
+    var caps []string
+    for _, feature := range s.enabledFeatures() {
+        caps = append(caps, capabilityPrefix+feature)
+    }
+    return append(caps, capMessageTags, capServerTime)
+}
+
+func isFileTransfer(message string) bool {
+    return strings.HasPrefix(message, "\x01DCC ")
+}
+
+func (c *Client) sendISupport() {
+    features := c.server.config.Features
+    nick := "*"
+    if c.user != nil {
+        nick = c.user.Username
+    }
+
+    tokens := []string{
+        "NETWORK=" + c.server.config.Server.ServerName,
+        "CHANTYPES=#",
+        "BOT=B",
+    }
+    if features.MaxChannelNameLength > 0 {
+        tokens = append(tokens, fmt.Sprintf("CHANNELLEN=%d", features.MaxChannelNameLength))
+    }
+    if features.MaxChannelsPerUser > 0 {
+        tokens = append(tokens, fmt.Sprintf("CHANLIMIT=#:%d", features.MaxChannelsPerUser))
+    }
+    if features.EnableMessageHistory && features.MaxMessageHistory > 0 {
+        tokens = append(tokens, fmt.Sprintf("CHATHISTORY=%d", features.MaxMessageHistory))
+    }
+    if _, ok := c.conn.(*websocketConn); !ok && c.protocol().binaryFraming {
+        tokens = append(tokens, "FRAMING=BINARY")
+    }
+    if c.protocol().ecdhOnly {
+        tokens = append(tokens, "KEYEXCHANGE=ECDH")
+    }
+    tokens = append(tokens, "PROTOVER="+protocolRange())
+    tokens = append(tokens, "FEATURES="+strings.Join(c.server.enabledFeatures(), ","))
+
+    c.Send(fmt.Sprintf(":%s 005 %s %s :are supported by this server", c.server.config.Server.ServerName, nick, strings.Join(tokens, " ")))
+}
+
+func (c *Client) handleCap(parts []string) error {
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: CAP <LS|LIST|REQ|END> [args]")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    nick := "*"
+    if c.user != nil {
+        nick = c.user.Username
+    }
+
+    switch strings.ToUpper(parts[1]) {
+    case "LS":
+        c.Send(fmt.Sprintf(":%s CAP %s LS :%s", serverName, nick, strings.Join(c.capabilities(), " ")))
+    case "LIST":
+        c.Send(fmt.Sprintf(":%s CAP %s LIST :%s", serverName, nick, strings.Join(c.enabledCaps, " ")))
+    case "REQ":
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: CAP REQ :<capabilities>")
+        }
+
+        requested := strings.Fields(strings.TrimPrefix(strings.Join(parts[2:], " "), ":"))
+        for _, capability := range requested {
+            if !c.offersCapability(capability) {
+                c.Send(fmt.Sprintf(":%s CAP %s NAK :%s", serverName, nick, strings.Join(requested, " ")))
+                return nil
+            }
+        }
+
+        for _, capability := range requested {
+            if !c.hasCap(capability) {
+                c.enabledCaps = append(c.enabledCaps, capability)
+            }
+        }
+        c.Send(fmt.Sprintf(":%s CAP %s ACK :%s", serverName, nick, strings.Join(requested, " ")))
+    case "END":
+    default:
+        return fmt.Errorf("unknown CAP subcommand: %s", parts[1])
+    }
+
+    return nil
+}
+
+func (c *Client) hasCap(capability string) bool {
+    for _, enabled := range c.enabledCaps {
+        if enabled == capability {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const maxForwardHops = 8
+
+// forwardChain returns the channels reached by following forwards from
+// channel, in order. Targets that no longer exist end the chain early.
+func forwardChain(channelRepo *database.ChannelRepository, channel *models.Channel) ([]*models.Channel, error) {
+    visited := map[int64]bool{channel.ChannelID: true}
+    var chain []*models.Channel
+    current := channel
+
+    for {
+        targetID, err := channelRepo.GetForward(current.ChannelID)
+        if err != nil {
+            return nil, err
+        }
+        if targetID == nil {
+            return chain, nil
+        }
+
+        if visited[*targetID] || len(chain) >= maxForwardHops {
+            return nil, fmt.Errorf("cannot join %s: channel forwarding loop", channel.ChannelName)
+        }
+        visited[*targetID] = true
+
+        target, err := channelRepo.GetByID(*targetID)
+        if err != nil {
+            return chain, nil
+        }
+        chain = append(chain, target)
+        current = target
+    }
+}
+
+func (c *Client) forwardExempt(channelRepo *database.ChannelRepository, channelID int64) bool {
+    if c.user.IsAdmin {
+        return true
+    }
+
+    role, err := channelRepo.GetMemberRole(channelID, c.user.UserID)
+    return err == nil && role == "owner"
+}
+
+func (c *Client) handleForward(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: FORWARD <channel> [<target>|off]")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    if len(parts) < 3 {
+        targetID, err := channelRepo.GetForward(channel.ChannelID)
+        if err != nil {
+            return err
+        }
+
+        target := "off"
+        if targetID != nil {
+            if forward, err := channelRepo.GetByID(*targetID); err == nil {
+                target = forward.ChannelName
+            }
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Forward for %s: %s", serverName, c.user.Username, channelName, target))
+        return nil
+    }
+
+    if !c.user.IsAdmin {
+        role, err := channelRepo.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil || role != "owner" {
+            return fmt.Errorf("permission denied: only the channel owner or an admin can change the forward of %s", channelName)
+        }
+    }
+
+    if strings.EqualFold(parts[2], "off") {
+        if err := channelRepo.SetForward(channel.ChannelID, nil); err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Forward for %s removed", serverName, c.user.Username, channelName))
+        log.Printf("User %s removed the forward of %s", c.user.Username, channelName)
+        return nil
+    }
+
+    target, err := channelRepo.GetByName(parts[2])
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", parts[2])
+    }
+
+    if target.ChannelID == channel.ChannelID {
+        return fmt.Errorf("cannot forward %s to itself", channelName)
+    }
+
+    chain, err := forwardChain(channelRepo, target)
+    if err != nil {
+        return err
+    }
+    for _, next := range chain {
+        if next.ChannelID == channel.ChannelID {
+            return fmt.Errorf("cannot forward %s to %s: forwarding loop", channelName, target.ChannelName)
+        }
+    }
+
+    if err := channelRepo.SetForward(channel.ChannelID, &target.ChannelID); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Joins to %s are now forwarded to %s", serverName, c.user.Username, channelName, target.ChannelName))
+    log.Printf("User %s forwarded %s to %s", c.user.Username, channelName, target.ChannelName)
+
+    return nil
+}
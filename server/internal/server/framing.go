@@ -0,0 +1,86 @@
+package server
+
+import (
+    "bufio"
+    "fmt"
+    "log"
+    "strings"
+    "sync/atomic"
+
+    "github.com/onyxirc/server/internal/codec"
+)
+
+func (c *Client) isFramed() bool {
+    return atomic.LoadInt32(&c.framed) == 1
+}
+
+// handleFraming switches the connection from CRLF-delimited lines to
+// length-prefixed frames (see codec), so payloads such as ciphertext can
+// carry arbitrary bytes. The confirmation is the last text line.
+func (c *Client) handleFraming(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 || strings.ToUpper(parts[1]) != "BINARY" {
+        return fmt.Errorf("usage: FRAMING BINARY")
+    }
+
+    if !c.protocol().binaryFraming {
+        return fmt.Errorf("binary framing is not available in protocol version %d", c.protocol().number)
+    }
+
+    if !c.keyExchanged {
+        return fmt.Errorf("binary framing requires a completed KEYEXCHANGE")
+    }
+
+    if _, ok := c.conn.(*websocketConn); ok {
+        return fmt.Errorf("websocket connections are already framed")
+    }
+
+    if c.isFramed() {
+        return fmt.Errorf("binary framing is already enabled")
+    }
+
+    c.startFraming(fmt.Sprintf(":%s FRAMING BINARY", c.server.config.Server.ServerName))
+    log.Printf("User %s switched to binary framing", c.user.Username)
+
+    return nil
+}
+
+// startFraming writes confirm as a CRLF line and switches output to frames
+// while holding the writer, so no other line can slip in between.
+func (c *Client) startFraming(confirm string) {
+    c.writerMu.Lock()
+    defer c.writerMu.Unlock()
+
+    if !c.beginWrite() {
+        return
+    }
+    if err := c.writeLine(confirm); err != nil {
+        c.handleWriteError(err)
+        return
+    }
+
+    atomic.StoreInt32(&c.framed, 1)
+    c.syncWebSocketFrames()
+}
+
+// readCommand reads the next command as a text line or, once framing is
+// enabled, as a frame from the same buffered reader.
+func (c *Client) readCommand(reader *bufio.Reader, frames *codec.Decoder) (string, error) {
+    if c.isFramed() {
+        payload, err := frames.Decode()
+        return string(payload), err
+    }
+
+    line, err := readLine(reader)
+    return strings.TrimSpace(line), err
+}
+
+// splitCommand splits a command into parameters, dropping any message tags
+// and source prefix. In framed mode a trailing parameter (after " :") is
+// kept verbatim as the last element, since it may hold arbitrary bytes.
+func (c *Client) splitCommand(line string) []string {
+    return parseMessage(line, c.isFramed()).params
+}
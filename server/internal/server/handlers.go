@@ -1,34 +1,101 @@
 package server
 
 import (
+    "database/sql"
     "encoding/base64"
+    "errors"
     "fmt"
     "log"
+    "strconv"
     "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/cluster"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/events"
+    "github.com/onyxirc/server/internal/link"
+    "github.com/onyxirc/server/internal/mail"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+    "github.com/onyxirc/server/internal/plugin"
+    "github.com/onyxirc/server/internal/security"
 )
 
 func (c *Client) handleRegister(parts []string) error {
     if len(parts) < 3 {
-        return fmt.Errorf("usage: REGISTER <username> <password_hash>")
+        return numerics.NeedMoreParams("REGISTER", "REGISTER <username> <password_hash> [email]")
+    }
+
+    if c.adminOnly {
+        return fmt.Errorf("registration is not available on this port")
+    }
+
+    if c.server.currentLockdown() != nil {
+        return fmt.Errorf("registration is disabled while the network is in lockdown")
+    }
+
+    if c.dnsblRequiresAuth() {
+        return fmt.Errorf("registration is not available from your address; log in to an existing account instead")
     }
 
     username := parts[1]
     passwordHash := parts[2]
 
+    email := ""
+    if len(parts) > 3 {
+        email = parts[3]
+        if err := c.server.requireMailer(); err != nil {
+            return fmt.Errorf("registration failed: %w", err)
+        }
+        if err := mail.ValidateAddress(email); err != nil {
+            return fmt.Errorf("registration failed: %w", err)
+        }
+    }
+
     user, err := c.server.authService.Register(username, passwordHash)
     if err != nil {
         return fmt.Errorf("registration failed: %w", err)
     }
 
+    if email != "" {
+        if err := c.server.sendVerification(user.UserID, user.Username, email); err != nil {
+            log.Printf("Failed to set email for new user %s: %v", user.Username, err)
+        } else {
+            c.Send(fmt.Sprintf(":%s NOTICE * :A verification code has been sent to %s; confirm it with VERIFYEMAIL <code> after logging in", c.server.config.Server.ServerName, email))
+        }
+    }
+
+    c.server.recordEvent(events.UserRegistered, &user.UserID, nil, events.UserRegisteredData{Username: user.Username})
+
+    c.server.checkBanEvasion(user, c.GetIPAddress(), "")
+
     c.Send(fmt.Sprintf(":%s NOTICE * :Registration successful. Please login.", c.server.config.Server.ServerName))
     log.Printf("User registered: %s (ID: %d)", user.Username, user.UserID)
 
     return nil
 }
 
+func (c *Client) handleResetPass(parts []string) error {
+    if len(parts) < 4 {
+        return numerics.NeedMoreParams("RESETPASS", "RESETPASS <username> <reset_token> <new_password_hash>")
+    }
+
+    username := parts[1]
+
+    if err := c.server.authService.ResetPassword(username, parts[2], parts[3]); err != nil {
+        return fmt.Errorf("password reset failed: %w", err)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE * :Password updated. Please login.", c.server.config.Server.ServerName))
+    log.Printf("Password reset completed for user %s", username)
+
+    return nil
+}
+
 func (c *Client) handleLogin(parts []string) error {
     if len(parts) < 3 {
-        return fmt.Errorf("usage: LOGIN <username> <password_hash>")
+        return numerics.NeedMoreParams("LOGIN", "LOGIN <username> <password_hash>")
     }
 
     username := parts[1]
@@ -37,10 +104,37 @@ func (c *Client) handleLogin(parts []string) error {
 
     user, err := c.server.authService.Login(username, passwordHash, ipAddress)
     if err != nil {
+        var lockout *auth.LockoutError
+        if errors.As(err, &lockout) && lockout.Started {
+            log.Printf("Login lockout for %s %s after repeated failures from %s", lockout.Scope, lockout.Target, ipAddress)
+            c.server.serverNotice('l', fmt.Sprintf("Login lockout for %s %s after repeated failed attempts (last from %s)", lockout.Scope, lockout.Target, ipAddress))
+        }
+        if errors.Is(err, auth.ErrInvalidCredentials) {
+            return numerics.PasswdMismatch()
+        }
         return fmt.Errorf("login failed: %w", err)
     }
 
-    if err := c.server.ipTrackingService.CheckIPAndTrack(user.UserID, ipAddress); err != nil {
+    if c.adminOnly && !user.IsAdmin {
+        return fmt.Errorf("login failed: this port is restricted to administrators")
+    }
+
+    required, err := c.server.twoFactorRequired(user.UserID)
+    if err != nil {
+        return fmt.Errorf("login failed: %w", err)
+    }
+    if required {
+        c.requestSecondFactor(user, ipAddress)
+        return nil
+    }
+
+    return c.completeLogin(user, ipAddress)
+}
+
+// completeLogin creates the session for a user whose credentials, including
+// any second factor, have been verified.
+func (c *Client) completeLogin(user *models.User, ipAddress string) error {
+    if err := c.admitUser(user, ipAddress); err != nil {
         return fmt.Errorf("login blocked: %w", err)
     }
 
@@ -51,38 +145,405 @@ func (c *Client) handleLogin(parts []string) error {
 
     session, err := c.server.sessionManager.CreateSession(user, ipAddress, sessionKey)
     if err != nil {
+        auth.Zero(sessionKey)
         return fmt.Errorf("failed to create session: %w", err)
     }
 
+    if err := c.setSessionKey(session.SessionKey); err != nil {
+        c.server.sessionManager.DestroySession(session.SessionID)
+        return err
+    }
+
     c.user = user
     c.authenticated = true
     c.session = session
     c.SessionID = session.SessionID
-    c.sessionKey = sessionKey
+
+    c.loadPublicKey()
+    c.loadChannelMutes()
+
+    c.server.checkBanEvasion(user, ipAddress, c.publicKeyFingerprint)
+    c.loadEvasionRestriction()
+    c.initUserModes()
+    c.loadObserver()
 
     c.server.AddClient(c)
+    c.server.notifyNewLogin(user, ipAddress, c)
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Login successful. Session ID: %s", c.server.config.Server.ServerName, user.Username, session.SessionID))
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Please exchange encryption keys using KEYEXCHANGE", c.server.config.Server.ServerName, user.Username))
 
-    c.Send(fmt.Sprintf(":%s NOTICE %s :Login successful. Session ID: %s", c.server.config.Server.ServerName, username, session.SessionID))
-    c.Send(fmt.Sprintf(":%s NOTICE %s :Please exchange encryption keys using KEYEXCHANGE", c.server.config.Server.ServerName, username))
+    c.sendMOTD()
+    restored := c.restoreChannels(c.server.config.Features.RejoinOnLogin)
+    c.sendUnreadCounts()
+    c.sendPendingNotices()
 
-    log.Printf("User logged in: %s (ID: %d) from %s", user.Username, user.UserID, ipAddress)
+    log.Printf("User logged in: %s (ID: %d) from %s (%d channels)", user.Username, user.UserID, ipAddress, restored)
 
     return nil
 }
 
+// admitUser runs the checks every way of authenticating goes through, LOGIN
+// and RESUME alike, once the user's identity is known: the kill cooldown,
+// the reconnect throttle, IP tracking and the plugins' OnLogin hooks.
+func (c *Client) admitUser(user *models.User, ipAddress string) error {
+    if err := c.checkKillCooldown(user.UserID, ipAddress); err != nil {
+        return err
+    }
+
+    if err := c.checkReconnectThrottle(user.UserID); err != nil {
+        return err
+    }
+
+    // Bots are expected to connect from wherever they are deployed, so
+    // address changes do not count against them.
+    if !user.IsBot {
+        if err := c.server.ipTrackingService.CheckIPAndTrack(user.UserID, ipAddress); err != nil {
+            return err
+        }
+    }
+
+    return c.server.plugins.OnLogin(&plugin.LoginEvent{
+        UserID:    user.UserID,
+        Username:  user.Username,
+        IPAddress: ipAddress,
+        IsAdmin:   user.IsAdmin,
+        IsBot:     user.IsBot,
+    })
+}
+
+func (c *Client) sendMOTD() {
+    motd := strings.TrimSpace(c.server.config.Server.MOTD)
+    if motd == "" {
+        return
+    }
+
+    serverName := c.server.config.Server.ServerName
+    lines := []string{fmt.Sprintf(":%s 375 %s :- %s Message of the day -", serverName, c.user.Username, serverName)}
+    for _, line := range strings.Split(motd, "\n") {
+        lines = append(lines, fmt.Sprintf(":%s 372 %s :- %s", serverName, c.user.Username, strings.TrimRight(line, "\r")))
+    }
+    lines = append(lines, fmt.Sprintf(":%s 376 %s :End of /MOTD command", serverName, c.user.Username))
+    c.SendBatch(lines)
+}
+
+func (c *Client) sendUnreadCounts() {
+    counts := c.server.unreadCounts.Unread(c.user.UserID)
+    if len(counts) == 0 {
+        return
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+    for channelID, count := range counts {
+        channel, err := channelRepo.GetByID(channelID)
+        if err != nil {
+            continue
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%d unread messages in %s",
+            c.server.config.Server.ServerName, c.user.Username, count, channel.ChannelName))
+    }
+}
+
+// sendPendingNotices shows the notices queued while the user was offline.
+func (c *Client) sendPendingNotices() {
+    notices, err := database.NewNoticeRepository(c.server.db).TakePending(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to load pending notices for %s: %v", c.user.Username, err)
+        return
+    }
+
+    for _, notice := range notices {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s", c.server.config.Server.ServerName, c.user.Username, notice))
+    }
+}
+
+func (c *Client) handleResume(parts []string) error {
+    if c.authenticated {
+        return numerics.AlreadyRegistered()
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("RESUME", "RESUME <session_id>")
+    }
+
+    sessionID := parts[1]
+    ipAddress := c.GetIPAddress()
+
+    session, err := c.server.sessionManager.ResumeSession(sessionID, ipAddress)
+    if err != nil {
+        return fmt.Errorf("resume failed: %w", err)
+    }
+
+    user, err := c.server.authService.GetUserByID(session.UserID)
+    if err != nil {
+        c.server.sessionManager.DestroySession(sessionID)
+        return fmt.Errorf("resume failed: %w", err)
+    }
+
+    if !user.IsActive {
+        c.server.sessionManager.DestroySession(sessionID)
+        return fmt.Errorf("resume failed: account is inactive")
+    }
+
+    if c.adminOnly && !user.IsAdmin {
+        return fmt.Errorf("resume failed: this port is restricted to administrators")
+    }
+
+    if err := c.admitUser(user, ipAddress); err != nil {
+        // Reconnecting too fast is worth another try later; anything else
+        // ends the session.
+        if !errors.Is(err, errReconnectTooFast) {
+            c.server.sessionManager.DestroySession(sessionID)
+        }
+        return fmt.Errorf("resume blocked: %w", err)
+    }
+
+    session.User = user
+
+    if err := c.setSessionKey(session.SessionKey); err != nil {
+        return fmt.Errorf("resume failed: %w", err)
+    }
+
+    c.user = user
+    c.authenticated = true
+    c.session = session
+    c.SessionID = session.SessionID
+
+    c.loadPublicKey()
+    c.loadChannelMutes()
+    c.loadEvasionRestriction()
+    c.initUserModes()
+    c.loadObserver()
+
+    previous, attached := c.server.GetClient(sessionID)
+
+    c.server.AddClient(c)
+    c.server.notifyNewLogin(user, ipAddress, c)
+
+    if attached && previous != c {
+        previous.Send("ERROR :Session resumed from another connection")
+        go previous.Disconnect()
+    }
+    c.server.publish(&cluster.Event{Kind: cluster.KindResume, Session: security.GetSessionHash(sessionID)})
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Session resumed. Session ID: %s", c.server.config.Server.ServerName, user.Username, session.SessionID))
+
+    restored := c.restoreChannels(true)
+    c.sendPendingNotices()
+
+    log.Printf("User %s resumed session from %s (%d channels)", user.Username, ipAddress, restored)
+
+    return nil
+}
+
+// restoreChannels puts the client back in the channels it is a member of,
+// which persist across connections, and returns how many there were. With
+// announce set the client is sent a JOIN, topic and channel key for each,
+// as if it had just joined.
+func (c *Client) restoreChannels(announce bool) int {
+    channels, err := database.NewChannelRepository(c.server.db).GetUserChannels(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to restore channels for %s: %v", c.user.Username, err)
+        return 0
+    }
+
+    restored := 0
+    for _, channel := range channels {
+        if channel.IsArchived {
+            continue
+        }
+
+        c.JoinChannel(channel.ChannelID)
+        restored++
+
+        if announce {
+            c.Send(fmt.Sprintf(":%s!%s@%s JOIN :%s", c.user.Username, c.user.Username, c.Host(), channel.ChannelName))
+            if channel.Topic != nil {
+                c.Send(fmt.Sprintf(":%s 332 %s %s :%s", c.server.config.Server.ServerName, c.user.Username, channel.ChannelName, *channel.Topic))
+            }
+            c.sendChannelKey(channel.ChannelID, channel.ChannelName)
+        }
+        if !c.observer {
+            c.server.propagate(link.CmdJoin, c.user.Username, channel.ChannelName)
+        }
+    }
+
+    return restored
+}
+
+func (c *Client) handshakeFailure(cause string) {
+    c.server.cryptoManager.Stats().HandshakeFailure(cause)
+    log.Printf("Key exchange failure (%s) from %s", cause, c.GetIPAddress())
+
+    // Before LOGIN anyone can fail an exchange, so only those of logged-in
+    // users are worth keeping.
+    if c.user != nil {
+        c.server.recordSecurityEvent(models.SecurityEventKeyExchangeFailed, &c.user.UserID, nil, c.GetIPAddress(), cause)
+    }
+}
+
 func (c *Client) handleKeyExchange(parts []string) error {
     if err := c.requireAuth(); err != nil {
+        c.handshakeFailure("unauthenticated")
         return err
     }
 
-    if len(parts) < 2 {
-        return fmt.Errorf("usage: KEYEXCHANGE <encrypted_session_key>")
+    mode := "AUTO"
+    if len(parts) > 1 {
+        mode = strings.ToUpper(parts[1])
+    }
+
+    if mode != "AUTO" && mode != "RSA" && mode != "PLAIN" && mode != "ECDH" {
+        c.handshakeFailure("bad_mode")
+        return fmt.Errorf("usage: KEYEXCHANGE [RSA|PLAIN|ECDH <public key>]")
+    }
+
+    if c.protocol().ecdhOnly != (mode == "ECDH") {
+        if mode == "ECDH" {
+            c.handshakeFailure("ecdh_unavailable")
+            return fmt.Errorf("KEYEXCHANGE ECDH requires protocol version 3; negotiate it with PROTOVER before LOGIN")
+        }
+        c.handshakeFailure("ecdh_required")
+        return fmt.Errorf("protocol version %d only allows KEYEXCHANGE ECDH <public key>", c.protocol().number)
+    }
+
+    if mode == "ECDH" {
+        if len(parts) < 3 {
+            c.handshakeFailure("bad_mode")
+            return fmt.Errorf("usage: KEYEXCHANGE ECDH <public key>")
+        }
+        return c.exchangeECDH(parts[2], "SESSIONKEY", "by ECDH")
     }
 
-    sessionKeyB64 := base64.StdEncoding.EncodeToString(c.sessionKey)
+    sessionKey := c.sessionKey.Bytes()
+    if sessionKey == nil {
+        c.handshakeFailure("no_session_key")
+        return fmt.Errorf("key exchange failed: session key is no longer available")
+    }
+
+    if c.publicKey == nil && c.publicKeyUnknown {
+        c.loadPublicKey()
+        if c.publicKeyUnknown {
+            c.handshakeFailure("key_lookup_failed")
+            return fmt.Errorf("key exchange failed: could not check for a registered public key, try again")
+        }
+    }
+
+    if c.publicKey != nil {
+        if mode == "PLAIN" {
+            c.handshakeFailure("plain_refused")
+            return fmt.Errorf("unencrypted key exchange refused: a public key is on file for %s", c.user.Username)
+        }
+
+        encryptedKey, err := c.server.cryptoManager.EncryptSessionKey(c.publicKey, sessionKey)
+        if err != nil {
+            c.handshakeFailure("rsa_encrypt")
+            return fmt.Errorf("key exchange failed: %w", err)
+        }
+
+        c.Send(fmt.Sprintf("SESSIONKEY RSA :%s", encryptedKey))
+        c.keyExchanged = true
+        c.keyRotatedAt = time.Now()
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Key exchange complete. Session key encrypted to key %s.", c.server.config.Server.ServerName, c.user.Username, c.publicKeyFingerprint))
+
+        return nil
+    }
+
+    if mode == "RSA" {
+        c.handshakeFailure("no_public_key")
+        return fmt.Errorf("no public key on file: upload one with PUBKEY first")
+    }
+
+    sessionKeyB64 := base64.StdEncoding.EncodeToString(sessionKey)
 
     c.Send(fmt.Sprintf("SESSIONKEY :%s", sessionKeyB64))
-    c.Send(fmt.Sprintf(":%s NOTICE %s :Key exchange complete. All messages will be encrypted.", c.server.config.Server.ServerName, c.user.Username))
+    c.keyExchanged = true
+    c.keyRotatedAt = time.Now()
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Key exchange complete (unencrypted). Register a key with PUBKEY to protect future exchanges.", c.server.config.Server.ServerName, c.user.Username))
+
+    return nil
+}
+
+// loadPublicKey reads the user's registered public key. If the lookup
+// fails for any reason other than there being no key, the key state is
+// marked unknown so the session key is never sent unencrypted to a user who
+// may have one on file.
+func (c *Client) loadPublicKey() {
+    keyRepo := database.NewUserKeyRepository(c.server.db)
+
+    key, err := keyRepo.Get(c.user.UserID)
+    if errors.Is(err, sql.ErrNoRows) {
+        c.publicKeyUnknown = false
+        return
+    }
+    if err != nil {
+        log.Printf("Failed to load public key for user %s: %v", c.user.Username, err)
+        c.publicKeyUnknown = true
+        return
+    }
+    c.publicKeyUnknown = false
+
+    publicKey, err := auth.ParsePublicKey(key.PublicKey)
+    if err != nil {
+        log.Printf("Stored public key for user %s is invalid: %v", c.user.Username, err)
+        return
+    }
+
+    c.publicKey = publicKey
+    c.publicKeyFingerprint = key.Fingerprint
+}
+
+func (c *Client) handlePubKey(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("PUBKEY", "PUBKEY <base64_public_key>")
+    }
+
+    publicKey, err := auth.ParsePublicKey(strings.TrimPrefix(parts[1], ":"))
+    if err != nil {
+        c.handshakeFailure("invalid_public_key")
+        return fmt.Errorf("invalid public key: %w", err)
+    }
+
+    encoded, err := auth.EncodePublicKey(publicKey)
+    if err != nil {
+        return fmt.Errorf("invalid public key: %w", err)
+    }
+
+    fingerprint, err := auth.PublicKeyFingerprint(publicKey)
+    if err != nil {
+        return fmt.Errorf("invalid public key: %w", err)
+    }
+
+    keyRepo := database.NewUserKeyRepository(c.server.db)
+    if err := keyRepo.Save(c.user.UserID, encoded, fingerprint); err != nil {
+        return err
+    }
+
+    if c.publicKeyFingerprint != "" && c.publicKeyFingerprint != fingerprint {
+        log.Printf("User %s replaced public key %s with %s", c.user.Username, c.publicKeyFingerprint, fingerprint)
+    }
+
+    c.publicKey = publicKey
+    c.publicKeyFingerprint = fingerprint
+    c.publicKeyUnknown = false
+
+    c.server.checkBanEvasion(c.user, c.GetIPAddress(), fingerprint)
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Public key registered (fingerprint %s)", c.server.config.Server.ServerName, c.user.Username, fingerprint))
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+    for _, channelID := range c.GetChannels() {
+        channel, err := channelRepo.GetByID(channelID)
+        if err != nil {
+            continue
+        }
+        c.sendChannelKey(channel.ChannelID, channel.ChannelName)
+    }
 
     return nil
 }
@@ -93,11 +554,32 @@ func (c *Client) handleJoin(parts []string) error {
     }
 
     if len(parts) < 2 {
-        return fmt.Errorf("usage: JOIN <channel>")
+        return numerics.NeedMoreParams("JOIN", "JOIN <channel> [key]")
     }
 
-    channelName := parts[1]
-    return c.handleJoinComplete(channelName)
+    if err := c.checkJoinPartRate(); err != nil {
+        return err
+    }
+
+    if err := c.checkLockdownActionRate(); err != nil {
+        return err
+    }
+
+    if err := c.checkSpamJoin(); err != nil {
+        return err
+    }
+
+    key := ""
+    if len(parts) > 2 {
+        key = parts[2]
+    }
+
+    event := &plugin.JoinEvent{UserID: c.user.UserID, Username: c.user.Username, Channel: parts[1]}
+    if err := c.server.plugins.OnJoin(event); err != nil {
+        return err
+    }
+
+    return c.handleJoinComplete(event.Channel, key)
 }
 
 func (c *Client) handlePart(parts []string) error {
@@ -106,7 +588,15 @@ func (c *Client) handlePart(parts []string) error {
     }
 
     if len(parts) < 2 {
-        return fmt.Errorf("usage: PART <channel>")
+        return numerics.NeedMoreParams("PART", "PART <channel>")
+    }
+
+    if err := c.checkJoinPartRate(); err != nil {
+        return err
+    }
+
+    if err := c.checkLockdownActionRate(); err != nil {
+        return err
     }
 
     channelName := parts[1]
@@ -119,7 +609,7 @@ func (c *Client) handlePrivMsg(parts []string) error {
     }
 
     if len(parts) < 3 {
-        return fmt.Errorf("usage: PRIVMSG <target> :<message>")
+        return numerics.NeedMoreParams("PRIVMSG", "PRIVMSG <target> :<message>")
     }
 
     target := parts[1]
@@ -129,9 +619,73 @@ func (c *Client) handlePrivMsg(parts []string) error {
         message = message[1:]
     }
 
+    if err := c.checkLockdownMessageRate(); err != nil {
+        return err
+    }
+
     return c.handlePrivMsgComplete(target, message)
 }
 
+func (c *Client) handleHistory(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("HISTORY", "HISTORY <channel> [limit]")
+    }
+
+    limit := c.server.config.Features.MaxMessageHistory
+    if len(parts) > 2 {
+        n, err := strconv.Atoi(parts[2])
+        if err != nil || n < 1 {
+            return fmt.Errorf("invalid history limit: %s", parts[2])
+        }
+        if n < limit {
+            limit = n
+        }
+    }
+
+    return c.sendChannelHistory(parts[1], limit)
+}
+
+func (c *Client) handleNick(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return numerics.NeedMoreParams("NICK", "NICK <new_username>")
+    }
+
+    newUsername := strings.TrimPrefix(parts[1], ":")
+    oldUsername := c.user.Username
+
+    if err := auth.ValidateUsername(newUsername); err != nil {
+        return numerics.ErroneusNickname(newUsername, err.Error())
+    }
+
+    if err := c.server.authService.ChangeUsername(c.user.UserID, oldUsername, newUsername); err != nil {
+        if errors.Is(err, auth.ErrUsernameTaken) {
+            return numerics.NicknameInUse(newUsername)
+        }
+        return fmt.Errorf("nick change failed: %w", err)
+    }
+
+    nickMsg := fmt.Sprintf(":%s!%s@%s NICK :%s", oldUsername, oldUsername, c.Host(), newUsername)
+
+    c.setUsername(newUsername)
+    c.server.renameUser(c.user.UserID, oldUsername, newUsername)
+
+    c.server.BroadcastToChannels(c.GetChannels(), nickMsg, c.SessionID)
+    c.Send(nickMsg)
+    c.server.propagate(link.CmdNick, oldUsername, newUsername)
+
+    log.Printf("User %s changed nick to %s", oldUsername, newUsername)
+
+    return nil
+}
+
 func (c *Client) handleQuit(parts []string) error {
     message := "Client quit"
     if len(parts) > 1 {
@@ -143,6 +697,8 @@ func (c *Client) handleQuit(parts []string) error {
 
     c.Send(fmt.Sprintf("ERROR :Closing connection: %s", message))
 
+    c.endSession = true
+
     if c.authenticated {
         log.Printf("User %s quit: %s", c.user.Username, message)
     }
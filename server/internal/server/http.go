@@ -0,0 +1,138 @@
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+)
+
+func (s *Server) startHTTP() {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/exports/", s.handleHTTPExportDownload)
+    mux.HandleFunc("/api/channels/", s.handleHTTPChannelExport)
+
+    s.httpServer = &http.Server{
+        Addr:         s.config.Export.HTTPListen,
+        Handler:      mux,
+        ReadTimeout:  s.config.Server.ReadTimeout,
+        WriteTimeout: s.config.Server.WriteTimeout,
+    }
+
+    go func() {
+        log.Printf("HTTP endpoint listening on %s", s.config.Export.HTTPListen)
+        if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Printf("HTTP server error: %v", err)
+        }
+    }()
+}
+
+func (s *Server) authenticateHTTP(r *http.Request) (*models.User, error) {
+    header := r.Header.Get("Authorization")
+    if !strings.HasPrefix(header, "Bearer ") {
+        return nil, fmt.Errorf("missing bearer token")
+    }
+
+    session, err := s.sessionManager.GetSession(strings.TrimPrefix(header, "Bearer "))
+    if err != nil {
+        return nil, err
+    }
+
+    return s.authService.GetUserByID(session.UserID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+    writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleHTTPExportDownload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+        return
+    }
+
+    path, err := s.exportStore.Path(strings.TrimPrefix(r.URL.Path, "/exports/"))
+    if err != nil {
+        writeJSONError(w, http.StatusNotFound, err)
+        return
+    }
+
+    w.Header().Set("Content-Disposition", "attachment")
+    http.ServeFile(w, r, path)
+}
+
+// POST /api/channels/<name>/export?format=json&from=...&to=...
+func (s *Server) handleHTTPChannelExport(w http.ResponseWriter, r *http.Request) {
+    rest := strings.TrimPrefix(r.URL.Path, "/api/channels/")
+    if !strings.HasSuffix(rest, "/export") {
+        writeJSONError(w, http.StatusNotFound, fmt.Errorf("not found"))
+        return
+    }
+
+    if r.Method != http.MethodPost {
+        writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+        return
+    }
+
+    user, err := s.authenticateHTTP(r)
+    if err != nil {
+        writeJSONError(w, http.StatusUnauthorized, err)
+        return
+    }
+
+    channelName := strings.TrimSuffix(rest, "/export")
+    if !strings.HasPrefix(channelName, "#") {
+        channelName = "#" + channelName
+    }
+
+    query := r.URL.Query()
+    formatStr := query.Get("format")
+    if formatStr == "" {
+        formatStr = export.FormatJSON
+    }
+
+    format, err := export.ParseFormat(formatStr)
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    from, to, err := export.ParseRange(query.Get("from"), query.Get("to"))
+    if err != nil {
+        writeJSONError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    channel, err := s.authorizeExport(user, channelName)
+    if err != nil {
+        writeJSONError(w, http.StatusForbidden, err)
+        return
+    }
+
+    err = s.queueExport(user, channel, format, from, to, func(name string, err error) {
+        if err != nil {
+            s.noticeUser(user.UserID, fmt.Sprintf("Export of %s failed: %v", channelName, err))
+            return
+        }
+        s.noticeUser(user.UserID, fmt.Sprintf("Export of %s ready: %s", channelName, s.exportLocation(name)))
+    })
+    if err != nil {
+        writeJSONError(w, http.StatusServiceUnavailable, err)
+        return
+    }
+
+    writeJSON(w, http.StatusAccepted, map[string]string{
+        "status":  "queued",
+        "channel": channelName,
+    })
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+    "fmt"
+    "log"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/config"
+)
+
+// serverIdentity is the long-term identity key clients pin, together with
+// the lines that introduce it on every connection. They only depend on keys
+// loaded at startup, so they are signed once.
+type serverIdentity struct {
+    key            *auth.ServerIdentity
+    previous       *auth.ServerIdentity
+    rsaFingerprint string
+    greeting       []string
+}
+
+func initializeIdentity(cfg *config.Config, cryptoManager *auth.CryptoManager) (*serverIdentity, error) {
+    if cfg.Security.IdentityKeyPath == "" {
+        return nil, nil
+    }
+
+    key, created, err := auth.LoadOrCreateIdentity(cfg.Security.IdentityKeyPath)
+    if err != nil {
+        return nil, err
+    }
+    if created {
+        log.Printf("Generated new server identity key, fingerprint %s", key.Fingerprint())
+    } else {
+        log.Printf("Server identity key loaded, fingerprint %s", key.Fingerprint())
+    }
+
+    rsaFingerprint, err := auth.PublicKeyFingerprint(cryptoManager.GetPublicKey())
+    if err != nil {
+        return nil, err
+    }
+
+    serverName := cfg.Server.ServerName
+    identity := &serverIdentity{
+        key:            key,
+        rsaFingerprint: rsaFingerprint,
+        greeting: []string{
+            fmt.Sprintf("IDENTITY KEY %s %s :%s", key.PublicKey(), rsaFingerprint, key.Sign(serverName, auth.IdentityPurposeRSA, rsaFingerprint)),
+        },
+    }
+
+    if path := cfg.Security.PreviousIdentityKeyPath; path != "" {
+        previous, err := auth.LoadIdentity(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to load previous identity key: %w", err)
+        }
+        identity.previous = previous
+        identity.greeting = append(identity.greeting, fmt.Sprintf("IDENTITY PREVIOUS %s :%s",
+            previous.PublicKey(), previous.Sign(serverName, auth.IdentityPurposeRotation, key.PublicKey())))
+        log.Printf("Previous identity key %s vouches for %s", previous.Fingerprint(), key.Fingerprint())
+    }
+
+    return identity, nil
+}
+
+// sendIdentity follows PUBKEY with the identity key and its signature over
+// the RSA key's fingerprint. After a rotation the retired key also vouches
+// for the new one, so clients that pinned it can move the pin instead of
+// warning about a changed key.
+func (c *Client) sendIdentity() {
+    if c.server.identity == nil {
+        return
+    }
+
+    for _, line := range c.server.identity.greeting {
+        c.Send(line)
+    }
+}
+
+// identityTag signs the public halves of an X25519 exchange with the
+// identity key, as an onyxirc/idsig tag for the SESSIONKEY or REKEY line.
+func (s *Server) identityTag(clientPublic, serverPublic string) string {
+    if s.identity == nil {
+        return ""
+    }
+
+    return "@onyxirc/idsig=" + s.identity.key.Sign(s.config.Server.ServerName, auth.IdentityPurposeECDH, clientPublic, serverPublic) + " "
+}
+
+// handleFingerprint lists the fingerprints of the server's keys, so users
+// can compare them with ones published out of band. It works before LOGIN.
+func (c *Client) handleFingerprint(parts []string) error {
+    serverName := c.server.config.Server.ServerName
+
+    identity := c.server.identity
+    if identity == nil {
+        rsaFingerprint, err := auth.PublicKeyFingerprint(c.server.cryptoManager.GetPublicKey())
+        if err != nil {
+            return err
+        }
+        c.Send(fmt.Sprintf(":%s FINGERPRINT RSA %s", serverName, rsaFingerprint))
+        return nil
+    }
+
+    c.Send(fmt.Sprintf(":%s FINGERPRINT IDENTITY %s :%s", serverName, identity.key.Fingerprint(), identity.key.PublicKey()))
+    c.Send(fmt.Sprintf(":%s FINGERPRINT RSA %s", serverName, identity.rsaFingerprint))
+    if identity.previous != nil {
+        c.Send(fmt.Sprintf(":%s FINGERPRINT PREVIOUS %s :%s", serverName, identity.previous.Fingerprint(), identity.previous.PublicKey()))
+    }
+
+    return nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const channelActivityInterval = 5 * time.Minute
+
+type channelActivityTracker struct {
+    channelRepo *database.ChannelRepository
+    lastTouch   map[int64]time.Time
+    mu          sync.Mutex
+}
+
+func newChannelActivityTracker(db *database.DB) *channelActivityTracker {
+    return &channelActivityTracker{
+        channelRepo: database.NewChannelRepository(db),
+        lastTouch:   make(map[int64]time.Time),
+    }
+}
+
+func (t *channelActivityTracker) Touch(channelID int64) {
+    if t == nil {
+        return
+    }
+
+    t.mu.Lock()
+    if last, exists := t.lastTouch[channelID]; exists && time.Since(last) < channelActivityInterval {
+        t.mu.Unlock()
+        return
+    }
+    t.lastTouch[channelID] = time.Now()
+    t.mu.Unlock()
+
+    if err := t.channelRepo.TouchActivity(channelID); err != nil {
+        log.Printf("Failed to record activity for channel %d: %v", channelID, err)
+    }
+}
+
+func (s *Server) runInactivitySweeps() {
+    interval := s.config.Inactivity.CheckInterval
+    if interval <= 0 {
+        interval = 6 * time.Hour
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            err := s.workerPool.SubmitPriority("inactivity-sweep", threadpool.PriorityLow, func() error {
+                report, err := s.inactivityPolicy.Sweep(s.warnInactive)
+                if err != nil {
+                    log.Printf("Inactivity sweep failed: %v", err)
+                }
+                if report.ChannelsArchived > 0 {
+                    s.flushChannels()
+                }
+                log.Printf("Inactivity sweep: %d channels notified, %d archived, %d accounts notified, %d deactivated",
+                    report.ChannelsNotified, report.ChannelsArchived, report.AccountsNotified, report.AccountsDeactivated)
+                return err
+            })
+            if err != nil {
+                log.Printf("Failed to queue inactivity sweep: %v", err)
+            }
+        }
+    }
+}
+
+// warnInactive delivers an inactivity warning so that the user sees it even
+// if they are offline: as a NOTICE to their sessions on this node or, if
+// there are none, as a pending notice shown at their next login, and by
+// mail to a verified address. It returns an error only if the notice could
+// not be stored.
+func (s *Server) warnInactive(userID int64, message string) error {
+    if s.mailer != nil {
+        if email, err := s.authService.VerifiedEmail(userID); err != nil {
+            log.Printf("Failed to look up email of user %d: %v", userID, err)
+        } else if email != "" {
+            s.sendMail(email, fmt.Sprintf("Inactivity on %s", s.config.Server.ServerName), message+"\n")
+        }
+    }
+
+    if len(s.clientsForUser(userID)) > 0 {
+        s.noticeUserLocal(userID, message)
+        return nil
+    }
+    return database.NewNoticeRepository(s.db).Queue(userID, message)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "net"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/security"
+)
+
+func (s *Server) reloadIPBans() error {
+    bans, err := database.NewIPBanRepository(s.db).ListActive()
+    if err != nil {
+        return fmt.Errorf("failed to load IP bans: %w", err)
+    }
+
+    s.ipFilter.SetBans(bans)
+    return nil
+}
+
+// disconnectAddress drops every connected client whose address the filter
+// now refuses and returns how many were dropped.
+func (s *Server) disconnectAddress() int {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    dropped := 0
+    for _, client := range s.clients {
+        allowed, reason := s.ipFilter.Check(client.GetIPAddress())
+        if allowed {
+            continue
+        }
+
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", client.GetIPAddress(), reason))
+        s.recordDisconnect(client, nil, reason)
+        client.endSession = true
+        go client.Disconnect()
+        dropped++
+    }
+
+    return dropped
+}
+
+func (c *Client) handleAdminIPBan(args []string) error {
+    if len(args) < 3 {
+        return fmt.Errorf("usage: ADMIN ipban <address|cidr> <duration> <reason>")
+    }
+
+    durationSeconds, err := admin.ParseDuration(args[1])
+    if err != nil {
+        return err
+    }
+    reason := strings.Join(args[2:], " ")
+
+    if network, err := security.ParseCIDR(args[0]); err == nil {
+        if network.Contains(net.ParseIP(c.GetIPAddress())) {
+            return fmt.Errorf("refusing to ban %s: it contains your own address", network.String())
+        }
+    }
+
+    cidr, err := c.server.adminService.BanIP(c.user.UserID, args[0], reason, durationSeconds)
+    if err != nil {
+        return err
+    }
+
+    if err := c.server.reloadIPBans(); err != nil {
+        return err
+    }
+    dropped := c.server.disconnectAddress()
+
+    banType := "permanently"
+    if durationSeconds > 0 {
+        banType = fmt.Sprintf("for %d seconds", durationSeconds)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Address %s has been banned %s (%d connections dropped)", c.server.config.Server.ServerName, c.user.Username, cidr, banType, dropped))
+    log.Printf("Admin %s banned address %s %s: %s", c.user.Username, cidr, banType, reason)
+
+    return nil
+}
+
+func (c *Client) handleAdminIPUnban(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN ipunban <address|cidr>")
+    }
+
+    cidr, err := c.server.adminService.UnbanIP(c.user.UserID, args[0])
+    if err != nil {
+        return err
+    }
+
+    if err := c.server.reloadIPBans(); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Address %s has been unbanned", c.server.config.Server.ServerName, c.user.Username, cidr))
+    log.Printf("Admin %s unbanned address %s", c.user.Username, cidr)
+
+    return nil
+}
+
+func (c *Client) handleAdminIPBans(args []string) error {
+    bans, err := c.server.adminService.ListIPBans(c.user.UserID)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== IP Bans (%d) ===", serverName, c.user.Username, len(bans)))
+
+    for _, ban := range bans {
+        expires := "never"
+        if ban.ExpiresAt != nil {
+            expires = ban.ExpiresAt.Format(time.RFC3339)
+        }
+
+        reason := ""
+        if ban.Reason != nil {
+            reason = *ban.Reason
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s (expires %s): %s", serverName, c.user.Username, ban.CIDR, expires, reason))
+    }
+
+    return nil
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+)
+
+type joinLimit struct {
+    joins  int
+    window time.Duration
+}
+
+func (l joinLimit) enabled() bool {
+    return l.joins > 0 && l.window > 0
+}
+
+func (l joinLimit) String() string {
+    if !l.enabled() {
+        return "off"
+    }
+    return fmt.Sprintf("%d:%d", l.joins, int(l.window/time.Second))
+}
+
+type joinThrottle struct {
+    mu           sync.Mutex
+    config       config.JoinThrottleConfig
+    channelRepo  *database.ChannelRepository
+    userActions  map[int64][]time.Time
+    channelJoins map[int64][]time.Time
+    joinAttempts map[int64][]time.Time
+    limits       map[int64]joinLimit
+    autoUntil    map[int64]time.Time
+    lastSweep    time.Time
+}
+
+func newJoinThrottle(db *database.DB, cfg config.JoinThrottleConfig) *joinThrottle {
+    return &joinThrottle{
+        config:       cfg,
+        channelRepo:  database.NewChannelRepository(db),
+        userActions:  make(map[int64][]time.Time),
+        channelJoins: make(map[int64][]time.Time),
+        joinAttempts: make(map[int64][]time.Time),
+        limits:       make(map[int64]joinLimit),
+        autoUntil:    make(map[int64]time.Time),
+        lastSweep:    time.Now(),
+    }
+}
+
+func (t *joinThrottle) AllowUserAction(userID int64) time.Duration {
+    if t == nil {
+        return 0
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if t.config.UserActions <= 0 || t.config.UserWindow <= 0 {
+        return 0
+    }
+
+    now := time.Now()
+    t.sweep(now)
+
+    actions := pruneBefore(t.userActions[userID], now.Add(-t.config.UserWindow))
+    if len(actions) >= t.config.UserActions {
+        t.userActions[userID] = actions
+        return actions[0].Add(t.config.UserWindow).Sub(now)
+    }
+
+    t.userActions[userID] = append(actions, now)
+    return 0
+}
+
+func (t *joinThrottle) AllowJoin(channelID int64) (time.Duration, bool) {
+    if t == nil {
+        return 0, false
+    }
+
+    limit := t.channelLimit(channelID)
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    t.sweep(now)
+
+    floodStarted := false
+    autoActive := now.Before(t.autoUntil[channelID])
+
+    if t.config.FloodJoins > 0 && t.config.FloodWindow > 0 {
+        attempts := append(pruneBefore(t.joinAttempts[channelID], now.Add(-t.config.FloodWindow)), now)
+        t.joinAttempts[channelID] = attempts
+
+        if len(attempts) > t.config.FloodJoins && !autoActive && t.config.AutoDuration > 0 {
+            t.autoUntil[channelID] = now.Add(t.config.AutoDuration)
+            autoActive = true
+            floodStarted = true
+        }
+    }
+
+    if autoActive {
+        limit = joinLimit{joins: t.config.AutoJoins, window: t.config.AutoWindow}
+    }
+
+    if !limit.enabled() {
+        return 0, floodStarted
+    }
+
+    joins := pruneBefore(t.channelJoins[channelID], now.Add(-limit.window))
+    if len(joins) >= limit.joins {
+        t.channelJoins[channelID] = joins
+        return joins[0].Add(limit.window).Sub(now), floodStarted
+    }
+
+    t.channelJoins[channelID] = append(joins, now)
+    return 0, floodStarted
+}
+
+func (t *joinThrottle) AutoLimit() joinLimit {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    return joinLimit{joins: t.config.AutoJoins, window: t.config.AutoWindow}
+}
+
+func (t *joinThrottle) SetConfig(cfg config.JoinThrottleConfig) {
+    if t == nil {
+        return
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.config = cfg
+    t.limits = make(map[int64]joinLimit)
+}
+
+func (t *joinThrottle) channelLimit(channelID int64) joinLimit {
+    t.mu.Lock()
+    limit, cached := t.limits[channelID]
+    t.mu.Unlock()
+
+    if cached {
+        return limit
+    }
+
+    t.mu.Lock()
+    limit = joinLimit{joins: t.config.ChannelJoins, window: t.config.ChannelWindow}
+    t.mu.Unlock()
+
+    joins, seconds, err := t.channelRepo.GetJoinThrottle(channelID)
+    if err != nil {
+        log.Printf("Failed to load join throttle for channel %d: %v", channelID, err)
+        return limit
+    }
+    if joins > 0 && seconds > 0 {
+        limit = joinLimit{joins: joins, window: time.Duration(seconds) * time.Second}
+    }
+
+    t.mu.Lock()
+    t.limits[channelID] = limit
+    t.mu.Unlock()
+
+    return limit
+}
+
+func (t *joinThrottle) SetChannelLimit(channelID int64, limit joinLimit) error {
+    seconds := int(limit.window / time.Second)
+    if err := t.channelRepo.SetJoinThrottle(channelID, limit.joins, seconds); err != nil {
+        return err
+    }
+
+    t.mu.Lock()
+    delete(t.limits, channelID)
+    t.mu.Unlock()
+
+    return nil
+}
+
+func (t *joinThrottle) sweep(now time.Time) {
+    if now.Sub(t.lastSweep) < time.Minute {
+        return
+    }
+    t.lastSweep = now
+
+    for userID, actions := range t.userActions {
+        if len(pruneBefore(actions, now.Add(-t.config.UserWindow))) == 0 {
+            delete(t.userActions, userID)
+        }
+    }
+
+    for channelID, joins := range t.channelJoins {
+        if len(joins) == 0 || now.Sub(joins[len(joins)-1]) > time.Hour {
+            delete(t.channelJoins, channelID)
+        }
+    }
+
+    for channelID, attempts := range t.joinAttempts {
+        if len(pruneBefore(attempts, now.Add(-t.config.FloodWindow))) == 0 {
+            delete(t.joinAttempts, channelID)
+        }
+    }
+
+    for channelID, until := range t.autoUntil {
+        if now.After(until) {
+            delete(t.autoUntil, channelID)
+        }
+    }
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+    i := 0
+    for i < len(times) && times[i].Before(cutoff) {
+        i++
+    }
+    return times[i:]
+}
+
+func (c *Client) checkJoinPartRate() error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    if wait := c.server.joinThrottle.AllowUserAction(c.user.UserID); wait > 0 {
+        return fmt.Errorf("join/part rate limit exceeded; try again in %s", wait.Round(time.Second))
+    }
+    return nil
+}
+
+func (c *Client) checkChannelJoinThrottle(channelID int64, channelName string) error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    wait, floodStarted := c.server.joinThrottle.AllowJoin(channelID)
+
+    if floodStarted {
+        limit := c.server.joinThrottle.AutoLimit()
+        duration := c.server.config.JoinThrottle.AutoDuration
+
+        c.server.BroadcastToChannel(channelID, fmt.Sprintf(":%s NOTICE %s :Join flood detected; join throttle %s enabled for %s",
+            c.server.config.Server.ServerName, channelName, limit, duration), "")
+        c.server.serverNotice('f', fmt.Sprintf("Join flood detected on %s; join throttle %s enabled for %s",
+            channelName, limit, duration))
+        log.Printf("Join flood detected on channel %s; throttling joins for %s", channelName, duration)
+    }
+
+    if wait > 0 {
+        return fmt.Errorf("channel %s is throttling joins; try again in %s", channelName, wait.Round(time.Second))
+    }
+    return nil
+}
+
+func (c *Client) handleJoinThrottle(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: JOINTHROTTLE <channel> [<joins>:<seconds>|off]")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    channelName := parts[1]
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    if len(parts) < 3 {
+        limit := c.server.joinThrottle.channelLimit(channel.ChannelID)
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Join throttle for %s: %s", serverName, c.user.Username, channelName, limit))
+        return nil
+    }
+
+    if !c.user.IsAdmin {
+        role, err := channelRepo.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil || role != "owner" {
+            return fmt.Errorf("permission denied: only the channel owner or an admin can change the join throttle of %s", channelName)
+        }
+    }
+
+    limit, err := parseJoinLimit(parts[2])
+    if err != nil {
+        return err
+    }
+
+    if err := c.server.joinThrottle.SetChannelLimit(channel.ChannelID, limit); err != nil {
+        return err
+    }
+
+    if limit.enabled() {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Join throttle for %s set to %s", serverName, c.user.Username, channelName, limit))
+    } else {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Join throttle for %s reset to the server default", serverName, c.user.Username, channelName))
+    }
+    log.Printf("User %s set join throttle of %s to %s", c.user.Username, channelName, limit)
+
+    return nil
+}
+
+func parseJoinLimit(value string) (joinLimit, error) {
+    if strings.EqualFold(value, "off") {
+        return joinLimit{}, nil
+    }
+
+    joinsStr, secondsStr, found := strings.Cut(value, ":")
+    if !found {
+        return joinLimit{}, fmt.Errorf("invalid join throttle %q: expected <joins>:<seconds> or off", value)
+    }
+
+    joins, err := strconv.Atoi(joinsStr)
+    if err != nil || joins < 1 {
+        return joinLimit{}, fmt.Errorf("invalid join count: %s", joinsStr)
+    }
+
+    seconds, err := strconv.Atoi(secondsStr)
+    if err != nil || seconds < 1 {
+        return joinLimit{}, fmt.Errorf("invalid join throttle window: %s", secondsStr)
+    }
+
+    return joinLimit{joins: joins, window: time.Duration(seconds) * time.Second}, nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "sync/atomic"
+    "time"
+)
+
+const defaultMaxMissedPongs = 2
+
+// keepalive sends a PING every ping_interval and drops the client once
+// max_missed_pongs of them in a row went unanswered for ping_timeout. Any
+// line from the client counts as an answer, so a busy client is never
+// dropped for a PONG lost behind its own traffic.
+func (c *Client) keepalive() {
+    cfg := c.server.config.Server
+    if cfg.PingInterval <= 0 {
+        return
+    }
+
+    timeout := cfg.PingTimeout
+    if timeout <= 0 {
+        timeout = cfg.PingInterval
+    }
+    maxMissed := int32(cfg.MaxMissedPongs)
+    if maxMissed <= 0 {
+        maxMissed = defaultMaxMissedPongs
+    }
+
+    ticker := time.NewTicker(cfg.PingInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-c.disconnect:
+            return
+        case <-ticker.C:
+        }
+
+        if sent := atomic.LoadInt64(&c.pingSent); sent != 0 && time.Since(time.Unix(0, sent)) >= timeout {
+            if atomic.AddInt32(&c.missedPongs, 1) >= maxMissed {
+                elapsed := time.Duration(maxMissed) * cfg.PingInterval
+                log.Printf("Ping timeout for %s after %s", c.GetIPAddress(), elapsed)
+                c.Send(fmt.Sprintf("ERROR :Closing Link: %s (Ping timeout: %d seconds)", c.GetIPAddress(), int(elapsed.Seconds())))
+                c.Disconnect()
+                return
+            }
+        }
+
+        atomic.StoreInt64(&c.pingSent, time.Now().UnixNano())
+        c.Send(fmt.Sprintf("PING :%s", c.server.config.Server.ServerName))
+    }
+}
+
+// markAlive clears any outstanding PING when the client sends a line.
+func (c *Client) markAlive() {
+    atomic.StoreInt64(&c.pingSent, 0)
+    atomic.StoreInt32(&c.missedPongs, 0)
+}
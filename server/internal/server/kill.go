@@ -0,0 +1,175 @@
+package server
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+)
+
+var snomaskDescriptions = map[rune]string{
+    'k': "kills",
+    'f': "join floods",
+    'l': "login lockouts",
+    'e': "ban evasion",
+    'n': "server links",
+    'm': "content filter",
+    's': "spam penalties",
+    'd': "DNSBL listings",
+}
+
+func (c *Client) handleKill(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: KILL <nick> <reason>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    nick := parts[1]
+    reason := strings.TrimPrefix(strings.Join(parts[2:], " "), ":")
+
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    target, err := c.server.authService.GetUserByUsername(nick)
+    if err != nil {
+        c.Send(fmt.Sprintf(":%s 401 %s %s :No such nick", serverName, c.user.Username, nick))
+        return nil
+    }
+
+    sessions := c.server.clientsForUser(target.UserID)
+    if len(sessions) == 0 {
+        c.Send(fmt.Sprintf(":%s 401 %s %s :No such nick", serverName, c.user.Username, nick))
+        return nil
+    }
+
+    ipAddress := sessions[0].GetIPAddress()
+
+    if _, err := c.server.adminService.KillUser(c.user.UserID, target.Username, reason, ipAddress); err != nil {
+        return err
+    }
+
+    for _, session := range sessions {
+        session.Send(fmt.Sprintf(":%s!%s@%s KILL %s :%s", c.user.Username, c.user.Username, serverName, target.Username, reason))
+        session.Send(fmt.Sprintf("ERROR :Closing Link: %s (Killed by %s (%s))", session.GetIPAddress(), c.user.Username, reason))
+        c.server.penalizeReconnect(session)
+        c.server.recordDisconnect(session, &c.user.UserID, "Killed: "+reason)
+        session.endSession = true
+        go session.Disconnect()
+    }
+
+    c.server.serverNotice('k', fmt.Sprintf("Received KILL message for %s (%s) from %s: %s",
+        target.Username, ipAddress, c.user.Username, reason))
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :User %s has been killed", serverName, c.user.Username, target.Username))
+    log.Printf("Admin %s killed user %s (%s): %s", c.user.Username, target.Username, ipAddress, reason)
+
+    return nil
+}
+
+func (c *Client) handleSnomask(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    if len(parts) < 2 {
+        c.Send(fmt.Sprintf(":%s 008 %s +%s :Server notice mask", serverName, c.user.Username, c.Snomasks()))
+        return nil
+    }
+
+    adding := true
+    for _, mask := range parts[1] {
+        switch mask {
+        case '+':
+            adding = true
+        case '-':
+            adding = false
+        default:
+            if _, ok := snomaskDescriptions[mask]; !ok {
+                return fmt.Errorf("unknown snomask: %c", mask)
+            }
+            c.setSnomask(mask, adding)
+        }
+    }
+
+    c.Send(fmt.Sprintf(":%s 008 %s +%s :Server notice mask", serverName, c.user.Username, c.Snomasks()))
+    return nil
+}
+
+func (c *Client) Snomasks() string {
+    c.snomaskMu.RLock()
+    defer c.snomaskMu.RUnlock()
+
+    var masks []rune
+    for mask := range snomaskDescriptions {
+        if c.snomasks[mask] {
+            masks = append(masks, mask)
+        }
+    }
+    return string(masks)
+}
+
+func (c *Client) hasSnomask(mask rune) bool {
+    c.snomaskMu.RLock()
+    defer c.snomaskMu.RUnlock()
+
+    return c.snomasks[mask]
+}
+
+func (c *Client) setSnomask(mask rune, enabled bool) {
+    c.snomaskMu.Lock()
+    defer c.snomaskMu.Unlock()
+
+    if enabled {
+        c.snomasks[mask] = true
+    } else {
+        delete(c.snomasks, mask)
+    }
+}
+
+func (s *Server) serverNotice(mask rune, message string) {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    for _, client := range s.clients {
+        if client.user != nil && client.hasSnomask(mask) {
+            client.Send(fmt.Sprintf(":%s NOTICE %s :*** Notice -- %s", s.config.Server.ServerName, client.Username(), message))
+        }
+    }
+}
+
+var errReconnectTooFast = errors.New("reconnecting too fast")
+
+func (c *Client) checkReconnectThrottle(userID int64) error {
+    if delay := c.server.reconnectThrottle.Attempt(fmt.Sprintf("user:%d", userID)); delay > 0 {
+        return fmt.Errorf("%w; try again in %s", errReconnectTooFast, delay.Round(time.Second))
+    }
+    return nil
+}
+
+func (c *Client) checkKillCooldown(userID int64, ipAddress string) error {
+    cooldown := time.Duration(c.server.config.Security.KillCooldown) * time.Second
+
+    kill, err := c.server.adminService.RecentKill(userID, ipAddress, cooldown)
+    if err != nil {
+        log.Printf("Failed to check kill cooldown for user %d: %v", userID, err)
+        return nil
+    }
+    if kill == nil {
+        return nil
+    }
+
+    remaining := time.Until(kill.KilledAt.Add(cooldown)).Round(time.Second)
+    return fmt.Errorf("killed by an operator; try again in %s", remaining)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "unicode/utf8"
+)
+
+const (
+    // ircLineLimit is the RFC 1459 limit for one line, including CRLF.
+    // Message tags do not count towards it.
+    ircLineLimit = 512
+
+    defaultMaxLineLength = 8192
+
+    // minMessageChunk keeps splitting useful when a long nick, host and
+    // target leave little room in a 512-byte line.
+    minMessageChunk = 64
+)
+
+var errLineTooLong = errors.New("input line too long")
+
+func (s *Server) maxLineLength() int {
+    if s.config.Server.MaxLineLength > 0 {
+        return s.config.Server.MaxLineLength
+    }
+    return defaultMaxLineLength
+}
+
+// readLine reads one line from reader, whose buffer size is the maximum line
+// length. An overlong line is discarded up to its newline and reported as
+// errLineTooLong, so the connection survives it. A final line without a
+// newline is still returned before io.EOF.
+func readLine(reader *bufio.Reader) (string, error) {
+    line, err := reader.ReadSlice('\n')
+    if err == io.EOF && len(line) > 0 {
+        return string(line), nil
+    }
+    if err != bufio.ErrBufferFull {
+        return string(line), err
+    }
+
+    for err == bufio.ErrBufferFull {
+        _, err = reader.ReadSlice('\n')
+    }
+    if err != nil {
+        return "", err
+    }
+    return "", errLineTooLong
+}
+
+// messageBudget is how many bytes of text fit in one relayed
+// ":nick!user@host <command> <target> :text" line. Plugins call it for a
+// session from their own goroutine.
+func (c *Client) messageBudget(command, target string) int {
+    username := c.Username()
+    overhead := len(fmt.Sprintf(":%s!%s@%s %s %s :\r\n", username, username, c.Host(), command, target))
+    if budget := ircLineLimit - overhead; budget > minMessageChunk {
+        return budget
+    }
+    return minMessageChunk
+}
+
+// splitMessage breaks message into chunks of at most limit bytes. It splits
+// at the last space in the second half of a chunk where possible, and never
+// inside a UTF-8 sequence.
+func splitMessage(message string, limit int) []string {
+    var chunks []string
+
+    for len(message) > limit {
+        cut := limit
+        for cut > 0 && !utf8.RuneStart(message[cut]) {
+            cut--
+        }
+        if cut == 0 {
+            cut = limit
+        }
+
+        if space := strings.LastIndexByte(message[:cut], ' '); space > cut/2 {
+            chunks = append(chunks, message[:space])
+            message = message[space+1:]
+            continue
+        }
+
+        chunks = append(chunks, message[:cut])
+        message = message[cut:]
+    }
+
+    return append(chunks, message)
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "net"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/cluster"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/link"
+)
+
+// linkHandler applies events from linked servers to local clients.
+type linkHandler struct {
+    server *Server
+}
+
+func (s *Server) startLinks() error {
+    if len(s.config.Links.Peers) == 0 {
+        return nil
+    }
+
+    var listener net.Listener
+    if lc := s.config.Links.Listen; lc.Port > 0 {
+        lc.Name = "links"
+        lc.WebSocket = false
+
+        var err error
+        listener, err = openListener(lc)
+        if err != nil {
+            return fmt.Errorf("failed to start links listener: %w", err)
+        }
+        log.Printf("Accepting server links on %s", lc.Address())
+    }
+
+    s.links = link.NewManager(s.config.Server.ServerName, s.config.Links, &linkHandler{server: s})
+    s.links.Start(listener)
+
+    return nil
+}
+
+// propagate announces a local event to linked servers, if there are any.
+func (s *Server) propagate(command string, params ...string) {
+    if s.links != nil {
+        s.links.Propagate(command, params...)
+    }
+}
+
+func (s *Server) remoteMembers(channelName string) []link.Member {
+    if s.links == nil {
+        return nil
+    }
+    return s.links.Members(channelName)
+}
+
+func (s *Server) remoteUsers(nick string) []link.Member {
+    if s.links == nil {
+        return nil
+    }
+    return s.links.Lookup(nick)
+}
+
+// propagateQuit tells the network that a user has left this server once
+// their last client is gone.
+func (s *Server) propagateQuit(client *Client, reason string) {
+    if s.links == nil || client.user == nil || client.observer {
+        return
+    }
+    if len(s.clientsForUser(client.user.UserID)) > 0 {
+        return
+    }
+    s.propagate(link.CmdQuit, client.Username(), reason)
+}
+
+func remoteHostmask(member link.Member) string {
+    return fmt.Sprintf("%s!%s@%s", member.Nick, member.Nick, member.Server)
+}
+
+// Burst lists every channel with a connected member and who is in it.
+func (h *linkHandler) Burst() []*link.Message {
+    s := h.server
+    channelRepo := database.NewChannelRepository(s.db)
+
+    channels := make(map[int64]*channelBurst)
+    var order []int64
+
+    for _, client := range s.authenticatedClients() {
+        if client.observer {
+            continue
+        }
+
+        for _, channelID := range client.GetChannels() {
+            burst, exists := channels[channelID]
+            if !exists {
+                channel, err := channelRepo.GetByID(channelID)
+                if err != nil {
+                    continue
+                }
+                burst = &channelBurst{channel: channel.ChannelName, created: channel.CreatedAt, members: make(map[string]bool)}
+                if channel.Topic != nil {
+                    burst.topic = *channel.Topic
+                }
+                channels[channelID] = burst
+                order = append(order, channelID)
+            }
+            burst.members[client.Username()] = true
+        }
+    }
+
+    var messages []*link.Message
+    for _, channelID := range order {
+        burst := channels[channelID]
+        messages = append(messages, &link.Message{
+            Command: link.CmdChannel,
+            Params:  []string{burst.channel, strconv.FormatInt(burst.created.Unix(), 10), burst.topic},
+        })
+        for username := range burst.members {
+            messages = append(messages, &link.Message{Command: link.CmdJoin, Params: []string{username, burst.channel}})
+        }
+    }
+
+    return messages
+}
+
+type channelBurst struct {
+    channel string
+    created time.Time
+    topic   string
+    members map[string]bool
+}
+
+func (h *linkHandler) Remote(m *link.Message, affected map[string][]link.Member) {
+    s := h.server
+    member := link.Member{Nick: m.Param(0), Server: m.Origin}
+
+    switch m.Command {
+    case link.CmdServer:
+        s.serverNotice('n', fmt.Sprintf("Server %s joined the network (via %s)", m.Param(0), m.Origin))
+    case link.CmdSquit:
+        s.serverNotice('n', fmt.Sprintf("Server %s left the network (%s)", m.Param(0), m.Param(1)))
+        h.broadcastDepartures(affected, func(member link.Member) string {
+            return fmt.Sprintf(":%s QUIT :%s", remoteHostmask(member), m.Param(1))
+        })
+    case link.CmdChannel:
+        h.syncChannel(m.Origin, m.Param(0), m.Param(1), m.Param(2))
+    case link.CmdJoin:
+        h.broadcast(m.Param(1), fmt.Sprintf(":%s JOIN :%s", remoteHostmask(member), m.Param(1)), false)
+    case link.CmdPart:
+        h.broadcast(m.Param(1), fmt.Sprintf(":%s PART :%s", remoteHostmask(member), m.Param(1)), false)
+    case link.CmdQuit:
+        h.broadcastDepartures(affected, func(member link.Member) string {
+            return fmt.Sprintf(":%s QUIT :%s", remoteHostmask(member), m.Param(1))
+        })
+    case link.CmdNick:
+        h.broadcastDepartures(affected, func(member link.Member) string {
+            return fmt.Sprintf(":%s NICK :%s", remoteHostmask(member), m.Param(1))
+        })
+    case link.CmdMessage:
+        h.broadcast(m.Param(1), fmt.Sprintf(":%s PRIVMSG %s :%s", remoteHostmask(member), m.Param(1), m.Param(2)), true)
+    }
+}
+
+// broadcast sends line to the local members of channelName. Messages skip
+// clients that muted the channel, as local messages do.
+func (h *linkHandler) broadcast(channelName, line string, message bool) {
+    s := h.server
+
+    channel, err := database.NewChannelRepository(s.db).GetByName(channelName)
+    if err != nil {
+        return
+    }
+
+    if !message {
+        s.BroadcastToChannel(channel.ChannelID, line, "")
+        return
+    }
+
+    s.deliverRelayedLocal(channel.ChannelID, line)
+    s.publish(&cluster.Event{Kind: cluster.KindRelayed, ChannelIDs: []int64{channel.ChannelID}, Message: line})
+}
+
+func (s *Server) deliverRelayedLocal(channelID int64, line string) {
+    s.fanOut(s.membersOf([]int64{channelID}, ""), func(client *Client) {
+        if !client.IsChannelMuted(channelID) {
+            client.deliver(line)
+        }
+    })
+}
+
+// broadcastDepartures sends one line per affected remote user to every
+// local client sharing a channel with them, once per client.
+func (h *linkHandler) broadcastDepartures(affected map[string][]link.Member, line func(link.Member) string) {
+    s := h.server
+    channelRepo := database.NewChannelRepository(s.db)
+
+    channelsOf := make(map[link.Member][]int64)
+    for channelName, members := range affected {
+        channel, err := channelRepo.GetByName(channelName)
+        if err != nil {
+            continue
+        }
+        for _, member := range members {
+            channelsOf[member] = append(channelsOf[member], channel.ChannelID)
+        }
+    }
+
+    for member, channelIDs := range channelsOf {
+        s.BroadcastToChannels(channelIDs, line(member), "")
+    }
+}
+
+// syncChannel merges a remote channel's topic. As in the classic TS rule
+// the older channel wins: its topic replaces a newer channel's, and a
+// channel without a topic takes any remote one. Channels that do not exist
+// here are created on the first local JOIN, not by the link.
+func (h *linkHandler) syncChannel(origin, channelName, created, topic string) {
+    s := h.server
+    if topic == "" {
+        return
+    }
+
+    createdUnix, err := strconv.ParseInt(created, 10, 64)
+    if err != nil {
+        return
+    }
+
+    channelRepo := database.NewChannelRepository(s.db)
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return
+    }
+
+    if channel.Topic != nil && (*channel.Topic == topic || createdUnix >= channel.CreatedAt.Unix()) {
+        return
+    }
+
+    if err := channelRepo.UpdateTopic(channel.ChannelID, topic); err != nil {
+        log.Printf("Failed to merge topic of %s from %s: %v", channelName, origin, err)
+        return
+    }
+    s.invalidateChannel(channel.ChannelID)
+
+    s.BroadcastToChannel(channel.ChannelID, fmt.Sprintf(":%s TOPIC %s :%s", origin, channelName, topic), "")
+}
+
+func (c *Client) remoteWhoReply(channelName string, member link.Member) string {
+    return fmt.Sprintf(":%s 352 %s %s %s %s %s %s H :1 %s",
+        c.server.config.Server.ServerName, c.user.Username, channelName, member.Nick,
+        member.Server, member.Server, member.Nick, member.Nick)
+}
+
+func remoteNames(members []link.Member) []string {
+    names := make([]string, 0, len(members))
+    for _, member := range members {
+        names = append(names, member.Nick)
+    }
+    return names
+}
+
+func (s *Server) linkedServers() string {
+    if s.links == nil {
+        return ""
+    }
+
+    var servers []string
+    for server, via := range s.links.Servers() {
+        if server == via {
+            servers = append(servers, server)
+        } else {
+            servers = append(servers, fmt.Sprintf("%s (via %s)", server, via))
+        }
+    }
+    sort.Strings(servers)
+    return strings.Join(servers, ", ")
+}
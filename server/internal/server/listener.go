@@ -0,0 +1,66 @@
+package server
+
+import (
+    "crypto/tls"
+    "fmt"
+    "log"
+    "net"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+func openListener(lc config.ListenerConfig) (net.Listener, error) {
+    listener, err := net.Listen("tcp", lc.Address())
+    if err != nil {
+        return nil, fmt.Errorf("failed to listen on %s: %w", lc.Address(), err)
+    }
+
+    trusted, err := parseTrustedProxies(lc.TrustedProxies)
+    if err != nil {
+        listener.Close()
+        return nil, fmt.Errorf("invalid trusted_proxies: %w", err)
+    }
+
+    if lc.ProxyProtocol {
+        listener = &proxyListener{Listener: listener, trusted: trusted}
+    }
+
+    if lc.TLS {
+        cert, err := tls.LoadX509KeyPair(lc.TLSCert, lc.TLSKey)
+        if err != nil {
+            listener.Close()
+            return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+        }
+
+        listener = tls.NewListener(listener, &tls.Config{
+            Certificates: []tls.Certificate{cert},
+            MinVersion:   tls.VersionTLS12,
+        })
+    }
+
+    if lc.WebSocket {
+        listener = newWebSocketListener(listener, lc.Path, lc.ForwardedFor, trusted)
+    }
+
+    return listener, nil
+}
+
+func (s *Server) acceptLoop(listener net.Listener, lc config.ListenerConfig) {
+    defer s.wg.Done()
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            select {
+            case <-s.shutdown:
+                return
+            default:
+                log.Printf("Failed to accept connection on %s: %v", lc.Name, err)
+                continue
+            }
+        }
+
+        s.wg.Add(1)
+        go s.handleConnection(conn, lc)
+    }
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+// lockdownState is the emergency brake. While it is set, non-admins cannot
+// register or create channels, are held to the lockdown rate limits and may
+// only send direct messages to their contacts.
+type lockdownState struct {
+    Since  time.Time `json:"since"`
+    By     string    `json:"by"`
+    Reason string    `json:"reason"`
+}
+
+type lockdownLimiter struct {
+    mu       sync.Mutex
+    actions  map[int64][]time.Time
+    messages map[int64][]time.Time
+}
+
+func newLockdownLimiter() *lockdownLimiter {
+    return &lockdownLimiter{
+        actions:  make(map[int64][]time.Time),
+        messages: make(map[int64][]time.Time),
+    }
+}
+
+// allow records an event for userID and returns how long to wait if it
+// would exceed limit events per window.
+func (l *lockdownLimiter) allow(events map[int64][]time.Time, userID int64, limit int, window time.Duration) time.Duration {
+    if limit <= 0 || window <= 0 {
+        return 0
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    now := time.Now()
+    recent := pruneBefore(events[userID], now.Add(-window))
+    if len(recent) >= limit {
+        events[userID] = recent
+        return recent[0].Add(window).Sub(now)
+    }
+
+    events[userID] = append(recent, now)
+    return 0
+}
+
+func (l *lockdownLimiter) reset() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.actions = make(map[int64][]time.Time)
+    l.messages = make(map[int64][]time.Time)
+}
+
+func (s *Server) loadLockdown() error {
+    value, err := s.adminService.GetLockdown()
+    if err != nil {
+        return fmt.Errorf("failed to load lockdown state: %w", err)
+    }
+    if value == "" {
+        return nil
+    }
+
+    var state lockdownState
+    if err := json.Unmarshal([]byte(value), &state); err != nil {
+        return fmt.Errorf("failed to parse lockdown state: %w", err)
+    }
+
+    s.lockdownMu.Lock()
+    s.lockdown = &state
+    s.lockdownMu.Unlock()
+
+    log.Printf("Network is in lockdown since %s (by %s): %s", state.Since.Format(time.RFC3339), state.By, state.Reason)
+    return nil
+}
+
+func (s *Server) currentLockdown() *lockdownState {
+    s.lockdownMu.RLock()
+    defer s.lockdownMu.RUnlock()
+    return s.lockdown
+}
+
+func (s *Server) setLockdown(state *lockdownState) {
+    s.lockdownMu.Lock()
+    s.lockdown = state
+    s.lockdownMu.Unlock()
+
+    s.lockdownLimits.reset()
+}
+
+// lockedDown reports whether the lockdown applies to this client; admins are
+// never restricted by it.
+func (c *Client) lockedDown() bool {
+    if c.server.currentLockdown() == nil {
+        return false
+    }
+    return c.user == nil || !c.user.IsAdmin
+}
+
+func (c *Client) checkLockdownActionRate() error {
+    if !c.lockedDown() {
+        return nil
+    }
+
+    limits := c.server.config.Lockdown
+    if wait := c.server.lockdownLimits.allow(c.server.lockdownLimits.actions, c.user.UserID, limits.UserActions, limits.UserWindow); wait > 0 {
+        return fmt.Errorf("network is in lockdown; join/part rate limit exceeded, try again in %s", wait.Round(time.Second))
+    }
+    return nil
+}
+
+// checkLockdownMessageRate applies the lockdown message limit, or for a bot
+// its own limit, which holds whether or not the network is in lockdown.
+func (c *Client) checkLockdownMessageRate() error {
+    if c.user.IsBot {
+        return c.checkBotMessageRate()
+    }
+
+    if !c.lockedDown() {
+        return nil
+    }
+
+    limits := c.server.config.Lockdown
+    if wait := c.server.lockdownLimits.allow(c.server.lockdownLimits.messages, c.user.UserID, limits.Messages, limits.MessageWindow); wait > 0 {
+        return fmt.Errorf("network is in lockdown; message rate limit exceeded, try again in %s", wait.Round(time.Second))
+    }
+    return nil
+}
+
+// checkLockdownContact allows a direct message during lockdown only to a
+// contact: an admin, someone sharing a channel with the sender, or someone
+// who has messaged the sender before.
+func (c *Client) checkLockdownContact(targetID int64, targetIsAdmin bool) error {
+    if !c.lockedDown() || targetIsAdmin || targetID == c.user.UserID {
+        return nil
+    }
+
+    channels, err := database.NewChannelRepository(c.server.db).GetUserChannels(targetID)
+    if err == nil {
+        for _, channel := range channels {
+            if c.IsInChannel(channel.ChannelID) {
+                return nil
+            }
+        }
+    }
+
+    if replied, err := database.NewDirectMessageRepository(c.server.db).HasSent(targetID, c.user.UserID); err == nil && replied {
+        return nil
+    }
+
+    return fmt.Errorf("network is in lockdown; direct messages are limited to your contacts")
+}
+
+func (c *Client) handleAdminLockdown(args []string) error {
+    serverName := c.server.config.Server.ServerName
+
+    action := "status"
+    if len(args) > 0 {
+        action = strings.ToLower(args[0])
+    }
+
+    switch action {
+    case "status":
+        if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+            return err
+        }
+
+        state := c.server.currentLockdown()
+        if state == nil {
+            c.Send(fmt.Sprintf(":%s NOTICE %s :Lockdown is off", serverName, c.user.Username))
+            return nil
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Lockdown is on since %s (by %s, %s ago): %s", serverName, c.user.Username,
+            state.Since.Format(time.RFC3339), state.By, time.Since(state.Since).Round(time.Second), state.Reason))
+        return nil
+    case "on":
+        if c.server.currentLockdown() != nil {
+            return fmt.Errorf("lockdown is already on")
+        }
+
+        reason := strings.TrimPrefix(strings.Join(args[1:], " "), ":")
+        if reason == "" {
+            reason = "no reason given"
+        }
+
+        state := &lockdownState{Since: time.Now(), By: c.user.Username, Reason: reason}
+        encoded, err := json.Marshal(state)
+        if err != nil {
+            return fmt.Errorf("failed to encode lockdown state: %w", err)
+        }
+
+        limits := c.server.config.Lockdown
+        details := fmt.Sprintf("Enabled lockdown: %s (actions %d/%s, messages %d/%s)",
+            reason, limits.UserActions, limits.UserWindow, limits.Messages, limits.MessageWindow)
+        if err := c.server.adminService.SetLockdown(c.user.UserID, string(encoded), details); err != nil {
+            return err
+        }
+
+        c.server.setLockdown(state)
+
+        c.server.BroadcastNotice("The network is in lockdown: registration and channel creation are disabled and direct messages are limited to contacts")
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Lockdown enabled", serverName, c.user.Username))
+        log.Printf("Admin %s enabled lockdown: %s", c.user.Username, reason)
+        return nil
+    case "off":
+        state := c.server.currentLockdown()
+        if state == nil {
+            return fmt.Errorf("lockdown is not on")
+        }
+
+        details := fmt.Sprintf("Lifted lockdown enabled by %s at %s (%s)", state.By, state.Since.Format(time.RFC3339), state.Reason)
+        if err := c.server.adminService.SetLockdown(c.user.UserID, "", details); err != nil {
+            return err
+        }
+
+        c.server.setLockdown(nil)
+
+        c.server.BroadcastNotice("The network lockdown has been lifted")
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Lockdown lifted after %s", serverName, c.user.Username, time.Since(state.Since).Round(time.Second)))
+        log.Printf("Admin %s lifted lockdown", c.user.Username)
+        return nil
+    default:
+        return fmt.Errorf("usage: ADMIN lockdown [on [reason]|off|status]")
+    }
+}
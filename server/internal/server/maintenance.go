@@ -0,0 +1,141 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const defaultMaintenanceInterval = 15 * time.Minute
+
+type maintenanceReport struct {
+    BansExpired      int
+    AccountsRestored int
+    IPBansExpired    int64
+    InvitesExpired   int64
+    IPRecordsPruned  int64
+    SuspicionDecayed int64
+}
+
+func (s *Server) runMaintenance() {
+    interval := s.config.Maintenance.Interval
+    if interval <= 0 {
+        interval = defaultMaintenanceInterval
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            err := s.workerPool.SubmitPriority("maintenance", threadpool.PriorityLow, func() error {
+                report, err := s.performMaintenance()
+                if err != nil {
+                    log.Printf("Maintenance failed: %v", err)
+                }
+                if report.BansExpired > 0 || report.IPBansExpired > 0 || report.InvitesExpired > 0 || report.IPRecordsPruned > 0 || report.SuspicionDecayed > 0 {
+                    log.Printf("Maintenance: %d bans expired (%d accounts restored), %d address bans expired, %d invites dropped, %d login records pruned, %d suspicion counts decayed",
+                        report.BansExpired, report.AccountsRestored, report.IPBansExpired, report.InvitesExpired, report.IPRecordsPruned, report.SuspicionDecayed)
+                }
+                return err
+            })
+            if err != nil {
+                log.Printf("Failed to queue maintenance: %v", err)
+            }
+        }
+    }
+}
+
+// performMaintenance lifts temporary bans whose time is up and reactivates
+// the accounts they disabled, then drops stale invites, login records and
+// email codes, and lets IP suspicion counts decay.
+// Each step runs even if an earlier one failed; the first error is returned.
+func (s *Server) performMaintenance() (maintenanceReport, error) {
+    var report maintenanceReport
+    var firstErr error
+    record := func(err error) {
+        if err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+
+    record(s.expireUserBans(&report))
+
+    expired, err := database.NewIPBanRepository(s.db).DeactivateExpired()
+    record(err)
+    if expired > 0 {
+        report.IPBansExpired = expired
+        record(s.reloadIPBans())
+    }
+
+    record(s.reloadFilters())
+
+    if days := s.config.Maintenance.InviteExpiryDays; days > 0 {
+        dropped, err := database.NewChannelModeRepository(s.db).DeleteInvitesBefore(time.Now().AddDate(0, 0, -days))
+        record(err)
+        report.InvitesExpired = dropped
+    }
+
+    if days := s.config.Maintenance.IPHistoryDays; days > 0 {
+        if days < s.config.Security.BanEvasionIPDays {
+            days = s.config.Security.BanEvasionIPDays
+        }
+        pruned, err := database.NewSecurityRepository(s.db).PruneIPHistory(time.Now().AddDate(0, 0, -days))
+        record(err)
+        report.IPRecordsPruned = pruned
+    }
+
+    if seconds := s.config.Security.SuspicionDecayInterval; seconds > 0 {
+        decayed, err := database.NewSecurityRepository(s.db).DecaySuspicion(time.Now().Add(-time.Duration(seconds) * time.Second))
+        record(err)
+        report.SuspicionDecayed = decayed
+    }
+
+    _, err = database.NewEmailTokenRepository(s.db).DeleteExpired()
+    record(err)
+
+    return report, firstErr
+}
+
+func (s *Server) expireUserBans(report *maintenanceReport) error {
+    adminRepo := database.NewAdminRepository(s.db)
+    userRepo := database.NewUserRepository(s.db)
+
+    bans, err := adminRepo.GetExpiredBans()
+    if err != nil {
+        return err
+    }
+
+    for _, ban := range bans {
+        if err := adminRepo.ExpireBan(ban.BanID); err != nil {
+            return err
+        }
+        report.BansExpired++
+
+        stillBanned, err := adminRepo.IsUserBanned(ban.UserID)
+        if err != nil {
+            return err
+        }
+        if stillBanned {
+            continue
+        }
+
+        restored, err := userRepo.ReactivateAfterBan(ban.UserID)
+        if err != nil {
+            return fmt.Errorf("failed to restore user %d after ban expiry: %w", ban.UserID, err)
+        }
+        if !restored {
+            continue
+        }
+        report.AccountsRestored++
+        log.Printf("Ban %d on user %d expired; account reactivated", ban.BanID, ban.UserID)
+    }
+
+    return nil
+}
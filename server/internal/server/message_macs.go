@@ -0,0 +1,56 @@
+package server
+
+import (
+    "log"
+    "strings"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+)
+
+const messageMACBatchSize = 500
+
+// upgradeMessageMACs replaces the bare SHA-256 hashes older servers stored
+// with channel messages by MACs, so history replay can require one. A
+// message whose content no longer matches its old hash keeps it, and is
+// never replayed.
+func (s *Server) upgradeMessageMACs() (int, error) {
+    messageRepo := database.NewMessageRepository(s.db)
+
+    var lastID int64
+    upgraded := 0
+    for {
+        batch, err := messageRepo.ListWithoutMAC(lastID, messageMACBatchSize)
+        if err != nil {
+            return upgraded, err
+        }
+
+        for _, message := range batch {
+            lastID = message.MessageID
+
+            content, err := s.channelKeys.DecryptMessage(message.ChannelID, message.MessageContent)
+            if err != nil {
+                log.Printf("Skipping message %d during MAC upgrade: %v", message.MessageID, err)
+                continue
+            }
+
+            if message.MessageHash != nil && !auth.VerifyMessageHash(content, strings.TrimSpace(*message.MessageHash)) {
+                log.Printf("Integrity check failed for message %d; leaving its hash as it is", message.MessageID)
+                continue
+            }
+
+            mac, err := s.channelKeys.MACMessage(message.ChannelID, content)
+            if err != nil {
+                return upgraded, err
+            }
+            if err := messageRepo.SetHash(message.MessageID, mac); err != nil {
+                return upgraded, err
+            }
+            upgraded++
+        }
+
+        if len(batch) < messageMACBatchSize {
+            return upgraded, nil
+        }
+    }
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/search"
+    "github.com/onyxirc/server/internal/security"
+)
+
+type MessageStore interface {
+    StoreChannelMessage(channelID, userID, seq int64, message, signature string, sentAt time.Time) (int64, error)
+}
+
+type databaseMessageStore struct {
+    messageRepo *database.MessageRepository
+    channelKeys *security.ChannelKeyManager
+}
+
+func newDatabaseMessageStore(db *database.DB, channelKeys *security.ChannelKeyManager) *databaseMessageStore {
+    return &databaseMessageStore{
+        messageRepo: database.NewMessageRepository(db),
+        channelKeys: channelKeys,
+    }
+}
+
+func (s *databaseMessageStore) StoreChannelMessage(channelID, userID, seq int64, message, signature string, sentAt time.Time) (int64, error) {
+    encrypted, err := s.channelKeys.EncryptMessage(channelID, message)
+    if err != nil {
+        return 0, err
+    }
+
+    terms, err := s.channelKeys.HashTerms(channelID, searchTerms(message))
+    if err != nil {
+        return 0, err
+    }
+
+    mac, err := s.channelKeys.MACMessage(channelID, message)
+    if err != nil {
+        return 0, err
+    }
+
+    return s.messageRepo.Create(channelID, userID, seq, encrypted, mac, signature, strings.Join(terms, " "), sentAt)
+}
+
+// searchTerms returns the distinct words of a message, as SEARCH matches them.
+func searchTerms(text string) []string {
+    seen := make(map[string]bool)
+    var terms []string
+    for _, token := range search.Tokenize(text) {
+        if !seen[token] {
+            seen[token] = true
+            terms = append(terms, token)
+        }
+    }
+    return terms
+}
+
+type noopMessageStore struct{}
+
+func (noopMessageStore) StoreChannelMessage(channelID, userID, seq int64, message, signature string, sentAt time.Time) (int64, error) {
+    return 0, nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+    "sync/atomic"
+)
+
+const maxWriteTimeouts = 3
+
+type writeMetrics struct {
+    timeouts           int64
+    errors             int64
+    stalledDisconnects int64
+}
+
+func (s *Server) Metrics() map[string]int64 {
+    metrics := map[string]int64{
+        "write.timeouts":            atomic.LoadInt64(&s.writeMetrics.timeouts),
+        "write.errors":              atomic.LoadInt64(&s.writeMetrics.errors),
+        "write.stalled_disconnects": atomic.LoadInt64(&s.writeMetrics.stalledDisconnects),
+    }
+
+    for key, value := range s.cryptoManager.Stats().Snapshot() {
+        metrics[key] = value
+    }
+
+    for key, value := range s.commandMetrics.Snapshot() {
+        metrics[key] = value
+    }
+
+    if s.db != nil && s.config.Database.StatementCacheSize > 0 {
+        stmts := s.db.StatementCacheStats()
+        metrics["db.stmt_cache.size"] = int64(stmts.Size)
+        metrics["db.stmt_cache.hits"] = stmts.Hits
+        metrics["db.stmt_cache.misses"] = stmts.Misses
+        metrics["db.stmt_cache.skips"] = stmts.Skips
+    }
+
+    if s.db != nil && len(s.config.Database.ReadReplicas) > 0 {
+        replicas := s.db.ReplicaStats()
+        metrics["db.replicas.configured"] = int64(replicas.Configured)
+        metrics["db.replicas.healthy"] = int64(replicas.Healthy)
+    }
+
+    if s.workerPool != nil {
+        for key, value := range s.workerPool.GetStats() {
+            switch v := value.(type) {
+            case int:
+                metrics["pool."+key] = int64(v)
+            case int64:
+                metrics["pool."+key] = v
+            case float64:
+                metrics["pool."+key] = int64(v)
+            }
+        }
+    }
+
+    return metrics
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+const maxChannelKeyLength = 23
+
+// formatChannelModes renders modes as a MODE string such as "+ikl 50". The
+// key itself is only stored hashed, so +k carries no parameter.
+func formatChannelModes(modes *models.ChannelModes) string {
+    flags := "+"
+    var params []string
+
+    if modes.Announce {
+        flags += "A"
+    }
+    if modes.InviteOnly {
+        flags += "i"
+    }
+    if modes.KeyHash != nil {
+        flags += "k"
+    }
+    if modes.MemberLimit > 0 {
+        flags += "l"
+        params = append(params, strconv.Itoa(modes.MemberLimit))
+    }
+    if modes.Moderated {
+        flags += "m"
+    }
+
+    return strings.TrimSpace(flags + " " + strings.Join(params, " "))
+}
+
+type modeChange struct {
+    flags  string
+    params []string
+    sign   rune
+}
+
+func (m *modeChange) add(sign, mode rune, param string) {
+    if sign != m.sign {
+        m.flags += string(sign)
+        m.sign = sign
+    }
+    m.flags += string(mode)
+    if param != "" {
+        m.params = append(m.params, param)
+    }
+}
+
+func (m *modeChange) String() string {
+    return strings.TrimSpace(m.flags + " " + strings.Join(m.params, " "))
+}
+
+type voiceChange struct {
+    user  *models.User
+    voice bool
+}
+
+func (c *Client) handleMode(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: MODE <channel|nick> [<+|-modes> [params...]]")
+    }
+
+    if !strings.HasPrefix(parts[1], "#") {
+        return c.handleUserMode(parts[1], parts[2:])
+    }
+
+    return c.handleChannelMode(parts[1], parts[2:])
+}
+
+func (c *Client) handleChannelMode(channelName string, args []string) error {
+    serverName := c.server.config.Server.ServerName
+    channels := c.server.channels
+
+    channel, err := channels.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    modes, err := channels.Modes(channel.ChannelID)
+    if err != nil {
+        return err
+    }
+
+    if len(args) == 0 {
+        c.Send(fmt.Sprintf(":%s 324 %s %s %s", serverName, c.user.Username, channel.ChannelName, formatChannelModes(modes)))
+        return nil
+    }
+
+    if !c.user.IsAdmin {
+        role, err := channels.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil || role != "owner" {
+            return fmt.Errorf("permission denied: only the channel owner or an admin can change the modes of %s", channelName)
+        }
+    }
+
+    params := args[1:]
+    nextParam := func(mode rune) (string, error) {
+        if len(params) == 0 {
+            return "", fmt.Errorf("mode %c requires a parameter", mode)
+        }
+        param := params[0]
+        params = params[1:]
+        return param, nil
+    }
+
+    var change modeChange
+    var voices []voiceChange
+    modesChanged := false
+    sign := '+'
+
+    for _, mode := range args[0] {
+        switch mode {
+        case '+', '-':
+            sign = mode
+            continue
+        case 'A':
+            modes.Announce = sign == '+'
+            change.add(sign, mode, "")
+        case 'm':
+            modes.Moderated = sign == '+'
+            change.add(sign, mode, "")
+        case 'i':
+            modes.InviteOnly = sign == '+'
+            change.add(sign, mode, "")
+        case 'k':
+            if sign == '+' {
+                key, err := nextParam(mode)
+                if err != nil {
+                    return err
+                }
+                if len(key) > maxChannelKeyLength {
+                    return fmt.Errorf("channel key is longer than %d characters", maxChannelKeyLength)
+                }
+                keyHash := auth.HashSHA256(key)
+                modes.KeyHash = &keyHash
+            } else {
+                modes.KeyHash = nil
+            }
+            change.add(sign, mode, "")
+        case 'l':
+            if sign == '+' {
+                param, err := nextParam(mode)
+                if err != nil {
+                    return err
+                }
+                limit, err := strconv.Atoi(param)
+                if err != nil || limit < 1 {
+                    return fmt.Errorf("invalid member limit: %s", param)
+                }
+                modes.MemberLimit = limit
+                change.add(sign, mode, param)
+            } else {
+                modes.MemberLimit = 0
+                change.add(sign, mode, "")
+            }
+        case 'v':
+            nick, err := nextParam(mode)
+            if err != nil {
+                return err
+            }
+            target, err := c.server.authService.GetUserByUsername(nick)
+            if err != nil {
+                return fmt.Errorf("user not found: %s", nick)
+            }
+            role, err := channels.GetMemberRole(channel.ChannelID, target.UserID)
+            if err != nil {
+                return fmt.Errorf("%s is not a member of %s", nick, channelName)
+            }
+            if role == "owner" {
+                return fmt.Errorf("cannot change the voice of the owner of %s", channelName)
+            }
+            voices = append(voices, voiceChange{user: target, voice: sign == '+'})
+            change.add(sign, mode, target.Username)
+            continue
+        default:
+            return fmt.Errorf("unknown channel mode: %c", mode)
+        }
+        modesChanged = true
+    }
+
+    if change.flags == "" {
+        return nil
+    }
+
+    if modesChanged {
+        if err := channels.SetModes(channel.ChannelID, modes); err != nil {
+            return err
+        }
+    }
+
+    for _, voice := range voices {
+        role := "member"
+        if voice.voice {
+            role = "moderator"
+        }
+        if err := channels.SetMemberRole(channel.ChannelID, voice.user.UserID, role); err != nil {
+            return err
+        }
+    }
+
+    modeMsg := fmt.Sprintf(":%s!%s@%s MODE %s %s",
+        c.user.Username, c.user.Username, c.Host(), channel.ChannelName, change.String())
+    c.server.BroadcastToChannel(channel.ChannelID, modeMsg, "")
+    if !c.IsInChannel(channel.ChannelID) {
+        c.Send(modeMsg)
+    }
+
+    log.Printf("User %s set mode %s on %s", c.user.Username, change.String(), channel.ChannelName)
+
+    return nil
+}
+
+// checkJoinModes enforces +i, +k and +l for a user who is not yet a member.
+// A pending invite lets the user past all three; admins are never stopped.
+func (c *Client) checkJoinModes(channel *models.Channel, channelName, key string) error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    modes, err := c.server.channels.Modes(channel.ChannelID)
+    if err != nil {
+        return err
+    }
+    if !modes.InviteOnly && modes.KeyHash == nil && modes.MemberLimit == 0 {
+        return nil
+    }
+
+    invited, err := database.NewChannelModeRepository(c.server.db).ConsumeInvite(channel.ChannelID, c.user.UserID)
+    if err != nil {
+        return err
+    }
+    if invited {
+        return nil
+    }
+
+    if modes.InviteOnly {
+        return numerics.InviteOnlyChan(channelName)
+    }
+
+    if modes.KeyHash != nil && auth.HashSHA256(key) != *modes.KeyHash {
+        return numerics.BadChannelKey(channelName)
+    }
+
+    if modes.MemberLimit > 0 {
+        count, err := database.NewChannelRepository(c.server.db).CountMembers(channel.ChannelID)
+        if err != nil {
+            return err
+        }
+        if count >= modes.MemberLimit {
+            return numerics.ChannelIsFull(channelName)
+        }
+    }
+
+    return nil
+}
+
+// checkModerated stops members without voice from speaking in a +m
+// channel, and everyone but the owner and moderators from posting in a +A
+// announcement channel. Both come down to the same roles; admins may
+// always speak.
+func (c *Client) checkModerated(channelID int64, channelName string) error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    modes, err := c.server.channels.Modes(channelID)
+    if err != nil {
+        return err
+    }
+    if !modes.Moderated && !modes.Announce {
+        return nil
+    }
+
+    role, err := c.server.channels.GetMemberRole(channelID, c.user.UserID)
+    if err == nil && (role == "owner" || role == "moderator") {
+        return nil
+    }
+
+    if modes.Announce {
+        return numerics.CannotSendToChan(channelName, "+A, announcements only")
+    }
+    return numerics.CannotSendToChan(channelName, "+m")
+}
+
+func (c *Client) handleInvite(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: INVITE <nick> <channel>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    nick := parts[1]
+    channelName := parts[2]
+    channelRepo := database.NewChannelRepository(c.server.db)
+    modeRepo := database.NewChannelModeRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    target, err := c.server.authService.GetUserByUsername(nick)
+    if err != nil {
+        return fmt.Errorf("user not found: %s", nick)
+    }
+
+    if !c.user.IsAdmin {
+        role, err := channelRepo.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil {
+            return fmt.Errorf("cannot invite to %s: not a member", channelName)
+        }
+
+        modes, err := modeRepo.Get(channel.ChannelID)
+        if err != nil {
+            return err
+        }
+        if modes.InviteOnly && role != "owner" && role != "moderator" {
+            return fmt.Errorf("permission denied: only the owner or voiced members can invite to %s", channelName)
+        }
+    }
+
+    if isMember, err := channelRepo.IsMember(channel.ChannelID, target.UserID); err == nil && isMember {
+        return fmt.Errorf("%s is already on %s", target.Username, channelName)
+    }
+
+    if err := modeRepo.AddInvite(channel.ChannelID, target.UserID, c.user.UserID); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s 341 %s %s %s", serverName, c.user.Username, target.Username, channel.ChannelName))
+
+    inviteMsg := fmt.Sprintf(":%s!%s@%s INVITE %s :%s",
+        c.user.Username, c.user.Username, c.Host(), target.Username, channel.ChannelName)
+    for _, client := range c.server.clientsForUser(target.UserID) {
+        client.Send(inviteMsg)
+    }
+
+    log.Printf("User %s invited %s to %s", c.user.Username, target.Username, channel.ChannelName)
+
+    return nil
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+)
+
+// notifyNewLogin warns a user about a login or RESUME from an address
+// missing from their recent login history: a NOTICE on their other connected sessions
+// and, when mail is enabled, a message to their verified email address.
+// Both say how to lock the account at once.
+func (s *Server) notifyNewLogin(user *models.User, ipAddress string, current *Client) {
+    if !s.config.Security.NotifyNewLogins || user.IsBot {
+        return
+    }
+
+    isNew, err := s.ipTrackingService.IsNewAddress(user.UserID, ipAddress)
+    if err != nil {
+        log.Printf("Failed to check login history of %s: %v", user.Username, err)
+        return
+    }
+    if !isNew {
+        return
+    }
+
+    serverName := s.config.Server.ServerName
+    when := time.Now().UTC().Format(time.RFC3339)
+
+    for _, client := range s.clientsForUser(user.UserID) {
+        if client == current {
+            continue
+        }
+        client.Send(fmt.Sprintf(":%s NOTICE %s :New login to your account from %s at %s. If this was not you, send ACCOUNT LOCK to lock the account and end every session, then contact an administrator",
+            serverName, user.Username, ipAddress, when))
+    }
+
+    if s.mailer != nil {
+        email, err := s.authService.VerifiedEmail(user.UserID)
+        if err != nil {
+            log.Printf("Failed to look up email of %s: %v", user.Username, err)
+        } else if email != "" {
+            s.sendMail(email, "New login to your account", fmt.Sprintf(
+                "Your account %s on %s was logged in to from a new address, %s, at %s.\n\nIf this was you, there is nothing to do. Otherwise, connect and send ACCOUNT LOCK to lock the account and end every session, then contact an administrator.\n",
+                user.Username, serverName, ipAddress, when))
+        }
+    }
+
+    log.Printf("New login address for %s: %s", user.Username, ipAddress)
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+)
+
+// observerCommands are the only commands an observer may send once logged
+// in; everything else would make it visible or let it speak.
+var observerCommands = map[string]bool{
+    "CAP":         true,
+    "FRAMING":     true,
+    "ENCRYPTION":  true,
+    "ENCRYPTED":   true,
+    "KEYEXCHANGE": true,
+    "REKEY":       true,
+    "FINGERPRINT": true,
+    "PUBKEY":      true,
+    "SIGNKEY":     true,
+    "PING":        true,
+    "PONG":        true,
+    "QUIT":        true,
+}
+
+func (c *Client) checkObserverCommand(command string) error {
+    if !c.observer || observerCommands[command] {
+        return nil
+    }
+    return fmt.Errorf("observers are listen-only: %s is not allowed", command)
+}
+
+// loadObserver attaches an observer account to its channels. Attachment is
+// in memory only, so the observer is never listed in NAMES or WHO and does
+// not count towards +l. It is given the seq and sig capabilities so that
+// channel messages arrive with their provenance stamps.
+func (c *Client) loadObserver() {
+    repo := database.NewObserverRepository(c.server.db)
+
+    isObserver, err := repo.IsObserver(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to check observer status for %s: %v", c.user.Username, err)
+        return
+    }
+    if !isObserver {
+        return
+    }
+
+    c.observer = true
+    for _, feature := range []string{featureSequence, featureSigning} {
+        if c.offersCapability(capabilityPrefix+feature) && !c.hasCap(capabilityPrefix+feature) {
+            c.enabledCaps = append(c.enabledCaps, capabilityPrefix+feature)
+        }
+    }
+
+    channelIDs, err := repo.ChannelIDs(c.user.UserID)
+    if err != nil {
+        log.Printf("Failed to load observer channels for %s: %v", c.user.Username, err)
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+    var names []string
+    for _, channelID := range channelIDs {
+        c.JoinChannel(channelID)
+        if channel, err := channelRepo.GetByID(channelID); err == nil {
+            names = append(names, channel.ChannelName)
+        }
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Observer session (listen-only), observing %d channels: %s",
+        c.server.config.Server.ServerName, c.user.Username, len(names), strings.Join(names, " ")))
+    log.Printf("Observer %s attached to %d channels", c.user.Username, len(names))
+}
+
+// deliver sends a line relayed from a channel. Observers get it as part of
+// their stamped event stream.
+func (c *Client) deliver(line string) {
+    if c.observer {
+        c.sendObserved(line)
+        return
+    }
+    c.Send(line)
+}
+
+// sendObserved numbers and signs each line sent to an observer. The
+// signature covers the line as it would be sent without the onyxirc/oseq,
+// onyxirc/otime and onyxirc/osig tags; it is omitted when the server has
+// no signing key.
+func (c *Client) sendObserved(line string) {
+    c.observerMu.Lock()
+    defer c.observerMu.Unlock()
+
+    seq := atomic.AddInt64(&c.observerSeq, 1)
+    now := time.Now()
+
+    tags := []string{
+        fmt.Sprintf("onyxirc/oseq=%d", seq),
+        fmt.Sprintf("onyxirc/otime=%d", now.Unix()),
+    }
+    signature := c.server.signer.Sign(auth.EventStamp{
+        Observer:  c.Username(),
+        Seq:       seq,
+        Timestamp: now,
+        LineHash:  auth.HashMessage(line),
+    })
+    if signature != "" {
+        tags = append(tags, "onyxirc/osig="+signature)
+    }
+
+    c.Send(prefixTags(tags, line))
+}
+
+func (c *Client) handleAdminObserver(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN observer <create|add|attach|detach|list> ...")
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    switch strings.ToLower(args[0]) {
+    case "create":
+        if len(args) < 3 {
+            return fmt.Errorf("usage: ADMIN observer create <username> <password>")
+        }
+        if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+            return err
+        }
+        if _, err := c.server.authService.Register(args[1], args[2]); err != nil {
+            return fmt.Errorf("failed to create observer account: %w", err)
+        }
+        fallthrough
+    case "add":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ADMIN observer add <username>")
+        }
+
+        user, err := c.server.adminService.AddObserver(c.user.UserID, args[1])
+        if err != nil {
+            return err
+        }
+
+        for _, client := range c.server.clientsForUser(user.UserID) {
+            client.Send("ERROR :Account converted to an observer; please log in again")
+            go client.Disconnect()
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s is now an observer", serverName, c.user.Username, user.Username))
+        log.Printf("Admin %s made %s an observer", c.user.Username, user.Username)
+        return nil
+    case "attach", "detach":
+        if len(args) < 3 {
+            return fmt.Errorf("usage: ADMIN observer %s <username> <channel>", strings.ToLower(args[0]))
+        }
+
+        attach := strings.ToLower(args[0]) == "attach"
+        adminService := c.server.adminService
+        changeObserver := adminService.DetachObserver
+        if attach {
+            changeObserver = adminService.AttachObserver
+        }
+
+        user, channel, err := changeObserver(c.user.UserID, args[1], args[2])
+        if err != nil {
+            return err
+        }
+
+        for _, client := range c.server.clientsForUser(user.UserID) {
+            if !client.observer {
+                continue
+            }
+            if attach {
+                client.JoinChannel(channel.ChannelID)
+                client.Send(fmt.Sprintf(":%s NOTICE %s :Now observing %s", serverName, user.Username, channel.ChannelName))
+            } else {
+                client.LeaveChannel(channel.ChannelID)
+                client.Send(fmt.Sprintf(":%s NOTICE %s :No longer observing %s", serverName, user.Username, channel.ChannelName))
+            }
+        }
+
+        verb := "detached from"
+        if attach {
+            verb = "attached to"
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Observer %s %s %s", serverName, c.user.Username, user.Username, verb, channel.ChannelName))
+        log.Printf("Admin %s %s observer %s %s", c.user.Username, strings.ToLower(args[0]), user.Username, channel.ChannelName)
+        return nil
+    case "list":
+        observers, err := c.server.adminService.ListObservers(c.user.UserID)
+        if err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :=== Observers (%d) ===", serverName, c.user.Username, len(observers)))
+        for _, observer := range observers {
+            online := "offline"
+            if len(c.server.clientsForUser(observer.UserID)) > 0 {
+                online = "online"
+            }
+            channels := strings.Join(observer.Channels, " ")
+            if channels == "" {
+                channels = "(no channels)"
+            }
+            c.Send(fmt.Sprintf(":%s NOTICE %s :%s [%s] since %s: %s", serverName, c.user.Username,
+                observer.Username, online, observer.CreatedAt.Format(time.RFC3339), channels))
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown observer subcommand: %s", args[0])
+    }
+}
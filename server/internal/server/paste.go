@@ -0,0 +1,288 @@
+package server
+
+import (
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    maxPasteTitleLength = 200
+    // pasteChunkSize is the number of raw bytes per PASTE DATA line sent by
+    // GETPASTE, 400 characters once base64-encoded.
+    pasteChunkSize = 300
+)
+
+// pasteUpload collects a paste between PASTE BEGIN and PASTE END. The body
+// arrives as base64 chunks so tabs, leading colons and blank lines survive
+// the line protocol unchanged.
+type pasteUpload struct {
+    target string
+    title  string
+    data   bytes.Buffer
+}
+
+func (c *Client) handlePaste(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featurePaste); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: PASTE <BEGIN <target> [:title]|DATA <base64>|END|ABORT>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+
+    switch strings.ToUpper(parts[1]) {
+    case "BEGIN":
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: PASTE BEGIN <target> [:title]")
+        }
+
+        title := strings.TrimPrefix(strings.Join(parts[3:], " "), ":")
+        if len(title) > maxPasteTitleLength {
+            return fmt.Errorf("paste title is longer than %d characters", maxPasteTitleLength)
+        }
+
+        c.pendingPaste = &pasteUpload{target: parts[2], title: title}
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Paste to %s started; send PASTE DATA <base64> lines, then PASTE END", serverName, c.user.Username, parts[2]))
+        return nil
+    case "DATA":
+        upload := c.pendingPaste
+        if upload == nil {
+            return fmt.Errorf("no paste in progress; start one with PASTE BEGIN")
+        }
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: PASTE DATA <base64>")
+        }
+
+        chunk, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(parts[2], ":"))
+        if err != nil {
+            c.pendingPaste = nil
+            return fmt.Errorf("paste aborted: invalid base64 chunk")
+        }
+
+        if limit := c.server.config.Features.MaxPasteSize; upload.data.Len()+len(chunk) > limit {
+            c.pendingPaste = nil
+            return fmt.Errorf("paste aborted: larger than %d bytes", limit)
+        }
+
+        upload.data.Write(chunk)
+        return nil
+    case "END":
+        upload := c.pendingPaste
+        if upload == nil {
+            return fmt.Errorf("no paste in progress; start one with PASTE BEGIN")
+        }
+        c.pendingPaste = nil
+
+        return c.finishPaste(upload)
+    case "ABORT":
+        c.pendingPaste = nil
+        return nil
+    default:
+        return fmt.Errorf("unknown PASTE subcommand: %s", parts[1])
+    }
+}
+
+// finishPaste stores the paste and delivers a reference to it as an ordinary
+// PRIVMSG, so channel membership, +m, lockdown and DM rules all apply. The
+// paste is removed again if the reference cannot be delivered.
+func (c *Client) finishPaste(upload *pasteUpload) error {
+    content := upload.data.String()
+    if content == "" {
+        return fmt.Errorf("paste is empty")
+    }
+    if !utf8.ValidString(content) {
+        return fmt.Errorf("paste is not valid UTF-8 text")
+    }
+
+    if err := c.checkLockdownMessageRate(); err != nil {
+        return err
+    }
+
+    paste := &models.Paste{
+        UserID:    c.user.UserID,
+        Title:     upload.title,
+        Size:      len(content),
+        LineCount: strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1,
+    }
+
+    if strings.HasPrefix(upload.target, "#") {
+        channel, err := database.NewChannelRepository(c.server.db).GetByName(upload.target)
+        if err != nil {
+            return fmt.Errorf("channel not found: %s", upload.target)
+        }
+        paste.ChannelID = &channel.ChannelID
+    } else {
+        recipient, err := c.server.authService.GetUserByUsername(upload.target)
+        if err != nil {
+            return fmt.Errorf("user not found: %s", upload.target)
+        }
+        paste.RecipientID = &recipient.UserID
+    }
+
+    if err := c.server.sealPaste(paste, content); err != nil {
+        return err
+    }
+
+    repo := database.NewPasteRepository(c.server.db)
+    pasteID, err := repo.Create(paste)
+    if err != nil {
+        return err
+    }
+
+    title := paste.Title
+    if title == "" {
+        title = "untitled"
+    }
+    reference := fmt.Sprintf("[paste %d: %s, %d lines, %d bytes] GETPASTE %d", pasteID, title, paste.LineCount, paste.Size, pasteID)
+
+    if err := c.handlePrivMsgComplete(upload.target, reference); err != nil {
+        if deleteErr := repo.Delete(pasteID); deleteErr != nil {
+            log.Printf("Failed to remove undelivered paste %d: %v", pasteID, deleteErr)
+        }
+        return err
+    }
+
+    log.Printf("User %s shared paste %d (%d bytes) with %s", c.user.Username, pasteID, paste.Size, upload.target)
+
+    return nil
+}
+
+// sealPaste encrypts content under a fresh AES key that is stored wrapped
+// with the server RSA key, like channel keys.
+func (s *Server) sealPaste(paste *models.Paste, content string) error {
+    key, err := s.cryptoManager.GenerateSessionKey(s.config.Security.AESKeySize)
+    if err != nil {
+        return fmt.Errorf("failed to generate paste key: %w", err)
+    }
+    defer auth.Zero(key)
+
+    wrapped, err := s.cryptoManager.EncryptSessionKey(s.cryptoManager.GetPublicKey(), key)
+    if err != nil {
+        return fmt.Errorf("failed to wrap paste key: %w", err)
+    }
+
+    encrypted, err := s.cryptoManager.EncryptMessage(key, content)
+    if err != nil {
+        return fmt.Errorf("failed to encrypt paste: %w", err)
+    }
+
+    paste.EncryptedKey = wrapped
+    paste.Content = encrypted
+    return nil
+}
+
+func (s *Server) openPaste(paste *models.Paste) (string, error) {
+    key, err := s.cryptoManager.DecryptSessionKey(paste.EncryptedKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to unwrap paste key: %w", err)
+    }
+    defer auth.Zero(key)
+
+    content, err := s.cryptoManager.DecryptMessage(key, paste.Content)
+    if err != nil {
+        return "", fmt.Errorf("failed to decrypt paste: %w", err)
+    }
+
+    return content, nil
+}
+
+func (c *Client) handleGetPaste(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featurePaste); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: GETPASTE <id>")
+    }
+
+    pasteID, err := strconv.ParseInt(parts[1], 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid paste id: %s", parts[1])
+    }
+
+    paste, err := database.NewPasteRepository(c.server.db).Get(pasteID)
+    if err != nil {
+        return err
+    }
+
+    target, err := c.pasteTarget(paste)
+    if err != nil {
+        return err
+    }
+
+    content, err := c.server.openPaste(paste)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s PASTE %d BEGIN %s %s %d %d :%s", serverName, paste.PasteID,
+        paste.Username, target, paste.CreatedAt.Unix(), paste.Size, paste.Title))
+
+    for offset := 0; offset < len(content); offset += pasteChunkSize {
+        end := offset + pasteChunkSize
+        if end > len(content) {
+            end = len(content)
+        }
+        c.Send(fmt.Sprintf(":%s PASTE %d DATA %s", serverName, paste.PasteID, base64.StdEncoding.EncodeToString([]byte(content[offset:end]))))
+    }
+
+    c.Send(fmt.Sprintf(":%s PASTE %d END", serverName, paste.PasteID))
+
+    return nil
+}
+
+// pasteTarget returns the channel or nick the paste was shared with, if the
+// client may read it: the author, the recipient of a direct paste, current
+// members of the channel, and admins.
+func (c *Client) pasteTarget(paste *models.Paste) (string, error) {
+    denied := fmt.Errorf("paste %d is not shared with you", paste.PasteID)
+
+    if paste.ChannelID != nil {
+        channelRepo := database.NewChannelRepository(c.server.db)
+        channel, err := channelRepo.GetByID(*paste.ChannelID)
+        if err != nil {
+            return "", err
+        }
+
+        if paste.UserID != c.user.UserID && !c.user.IsAdmin {
+            if isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID); err != nil || !isMember {
+                return "", denied
+            }
+        }
+        return channel.ChannelName, nil
+    }
+
+    if paste.RecipientID == nil {
+        return "", denied
+    }
+
+    if paste.UserID != c.user.UserID && *paste.RecipientID != c.user.UserID && !c.user.IsAdmin {
+        return "", denied
+    }
+
+    recipient, err := c.server.authService.GetUserByID(*paste.RecipientID)
+    if err != nil {
+        return "", err
+    }
+    return recipient.Username, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+    "fmt"
+
+    "github.com/onyxirc/server/internal/numerics"
+    "github.com/onyxirc/server/internal/plugin"
+)
+
+// pluginHost is the server as plugins see it.
+type pluginHost struct {
+    server *Server
+}
+
+func (h *pluginHost) ServerName() string {
+    return h.server.config.Server.ServerName
+}
+
+func (h *pluginHost) Notice(username, text string) {
+    userID, err := h.server.authService.GetUserByUsername(username)
+    if err != nil {
+        return
+    }
+
+    notice := fmt.Sprintf(":%s NOTICE %s :%s", h.ServerName(), username, text)
+    for _, client := range h.server.clientsForUser(userID.UserID) {
+        client.Send(notice)
+    }
+}
+
+func (h *pluginHost) Broadcast(text string) {
+    h.server.BroadcastNotice(text)
+}
+
+func (h *pluginHost) Post(username, channelName, text string) error {
+    user, err := h.server.authService.GetUserByUsername(username)
+    if err != nil {
+        return numerics.NoSuchNick(username)
+    }
+
+    sessions := h.server.clientsForUser(user.UserID)
+    if len(sessions) == 0 {
+        return fmt.Errorf("%s is not connected to this server", username)
+    }
+
+    channel, err := h.server.channels.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+    if channel.IsArchived {
+        return numerics.CannotSendToChan(channel.ChannelName, "archived")
+    }
+
+    client := sessions[0]
+    for _, chunk := range splitMessage(text, client.messageBudget("PRIVMSG", channel.ChannelName)) {
+        client.relayChannelMessage(channel.ChannelID, channel.ChannelName, chunk)
+    }
+    return nil
+}
+
+func (h *pluginHost) AdminAction(userID int64, action, details string) error {
+    if userID == 0 {
+        return numerics.NotRegistered()
+    }
+    return h.server.adminService.RecordAction(userID, action, details)
+}
+
+// runCommandHooks passes a command line through the plugins' OnCommand
+// hooks, which may rewrite its parameters. It reports whether a plugin
+// carried out the command itself.
+func (c *Client) runCommandHooks(command string, parts []string) ([]string, bool, error) {
+    event := &plugin.CommandEvent{
+        Command: command,
+        Params:  parts[1:],
+        Reply:   c.Send,
+    }
+    if c.authenticated {
+        event.UserID = c.user.UserID
+        event.Username = c.user.Username
+        event.IsAdmin = c.user.IsAdmin
+    }
+
+    err := c.server.plugins.OnCommand(event)
+    if err == plugin.ErrHandled {
+        return parts, true, nil
+    }
+    if err != nil {
+        return parts, false, err
+    }
+
+    return append([]string{parts[0]}, event.Params...), false, nil
+}
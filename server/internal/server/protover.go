@@ -0,0 +1,157 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync/atomic"
+)
+
+// protocolVersion describes the wire format of one protocol version. New
+// wire-format changes get a new version with its own flags, and every
+// behaviour that differs between versions checks them, so clients keep the
+// format they negotiated.
+type protocolVersion struct {
+    number        int
+    messageTags   bool
+    binaryFraming bool
+    ecdhOnly      bool
+}
+
+var protocolVersions = []protocolVersion{
+    // 1: plain CRLF lines without message tags.
+    {number: 1},
+    // 2: message tags for requested capabilities and FRAMING BINARY.
+    {number: 2, messageTags: true, binaryFraming: true},
+    // 3: keys are only exchanged with KEYEXCHANGE ECDH, for forward secrecy.
+    {number: 3, messageTags: true, binaryFraming: true, ecdhOnly: true},
+}
+
+// defaultProtocolVersion is assumed for clients that never send PROTOVER.
+// It is the protocol as it was when PROTOVER was introduced and must not
+// change, or clients that predate PROTOVER would break.
+const defaultProtocolVersion = 2
+
+// tagCapabilities only add message tags, so they are not offered to clients
+// on a version without tags.
+var tagCapabilities = map[string]bool{
+    featureSequence: true,
+    featureSigning:  true,
+    capMessageTags:  true,
+    capServerTime:   true,
+}
+
+func protocolVersionFor(number int) (protocolVersion, bool) {
+    for _, version := range protocolVersions {
+        if version.number == number {
+            return version, true
+        }
+    }
+    return protocolVersion{}, false
+}
+
+func (c *Client) protocol() protocolVersion {
+    number := int(atomic.LoadInt32(&c.protoVersion))
+    if number == 0 {
+        number = defaultProtocolVersion
+    }
+
+    version, _ := protocolVersionFor(number)
+    return version
+}
+
+// outbound applies the client's protocol version to a line about to be
+// written.
+func (c *Client) outbound(line string) string {
+    if !c.protocol().messageTags && strings.HasPrefix(line, "@") {
+        if space := strings.IndexByte(line, ' '); space >= 0 {
+            return line[space+1:]
+        }
+    }
+    return line
+}
+
+// capabilities returns the server capabilities offered to this client.
+func (c *Client) capabilities() []string {
+    var caps []string
+    for _, capability := range c.server.capabilities() {
+        if tagCapabilities[strings.TrimPrefix(capability, capabilityPrefix)] && !c.protocol().messageTags {
+            continue
+        }
+        caps = append(caps, capability)
+    }
+    return caps
+}
+
+func (c *Client) offersCapability(capability string) bool {
+    for _, offered := range c.capabilities() {
+        if offered == capability {
+            return true
+        }
+    }
+    return false
+}
+
+func protocolRange() string {
+    return fmt.Sprintf("%d-%d", protocolVersions[0].number, protocolVersions[len(protocolVersions)-1].number)
+}
+
+// handleProtover agrees on the highest protocol version both sides support.
+// It must be sent before LOGIN or RESUME.
+func (c *Client) handleProtover(parts []string) error {
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: PROTOVER <min> [max]")
+    }
+
+    if c.authenticated {
+        return fmt.Errorf("PROTOVER must be sent before LOGIN or RESUME")
+    }
+
+    low, err := strconv.Atoi(parts[1])
+    if err != nil || low < 1 {
+        return fmt.Errorf("invalid protocol version: %s", parts[1])
+    }
+
+    high := low
+    if len(parts) > 2 {
+        high, err = strconv.Atoi(parts[2])
+        if err != nil || high < low {
+            return fmt.Errorf("invalid protocol version: %s", parts[2])
+        }
+    }
+
+    var agreed *protocolVersion
+    for i := range protocolVersions {
+        if protocolVersions[i].number >= low && protocolVersions[i].number <= high {
+            agreed = &protocolVersions[i]
+        }
+    }
+    if agreed == nil {
+        return fmt.Errorf("no common protocol version: server supports %s", protocolRange())
+    }
+
+    atomic.StoreInt32(&c.protoVersion, int32(agreed.number))
+
+    var features []string
+    if agreed.messageTags {
+        features = append(features, "tags")
+    }
+    if agreed.binaryFraming {
+        features = append(features, "framing")
+    }
+    if agreed.ecdhOnly {
+        features = append(features, "ecdh")
+    }
+
+    if len(features) == 0 {
+        features = append(features, "plain")
+    }
+
+    c.Send(fmt.Sprintf(":%s PROTOVER %d :%s", c.server.config.Server.ServerName, agreed.number, strings.Join(features, " ")))
+    c.sendISupport()
+
+    log.Printf("Client %s negotiated protocol version %d", c.conn.RemoteAddr().String(), agreed.number)
+
+    return nil
+}
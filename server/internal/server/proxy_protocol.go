@@ -0,0 +1,192 @@
+package server
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/security"
+)
+
+const (
+    proxyHeaderTimeout = 5 * time.Second
+    proxyV1MaxLength   = 107
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// trustedProxies holds the networks a listener accepts client addresses
+// from. An empty list trusts no peer; config validation requires a list
+// wherever proxy_protocol or forwarded_for is set.
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(entries []string) (trustedProxies, error) {
+    var networks trustedProxies
+    for _, entry := range entries {
+        network, err := security.ParseCIDR(entry)
+        if err != nil {
+            return nil, err
+        }
+        networks = append(networks, network)
+    }
+    return networks, nil
+}
+
+func (t trustedProxies) allows(addr net.Addr) bool {
+    host, _, err := net.SplitHostPort(addr.String())
+    if err != nil {
+        host = addr.String()
+    }
+    ip := net.ParseIP(host)
+    if ip == nil {
+        return false
+    }
+
+    for _, network := range t {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// proxyListener expects every connection to start with a PROXY protocol
+// v1 or v2 header, as sent by HAProxy or nginx, and reports the client
+// address it carries as the connection's remote address.
+type proxyListener struct {
+    net.Listener
+    trusted trustedProxies
+}
+
+func (pl *proxyListener) Accept() (net.Conn, error) {
+    conn, err := pl.Listener.Accept()
+    if err != nil {
+        return nil, err
+    }
+    return &proxyConn{Conn: conn, trusted: pl.trusted}, nil
+}
+
+// proxyConn reads the header on first use rather than in Accept, so a slow
+// peer only holds up its own connection. If the header is missing or
+// malformed every read fails and the connection is dropped.
+type proxyConn struct {
+    net.Conn
+    trusted trustedProxies
+    once    sync.Once
+    reader  *bufio.Reader
+    remote  net.Addr
+    err     error
+}
+
+func (pc *proxyConn) Read(p []byte) (int, error) {
+    pc.once.Do(pc.readHeader)
+    if pc.err != nil {
+        return 0, pc.err
+    }
+    return pc.reader.Read(p)
+}
+
+func (pc *proxyConn) RemoteAddr() net.Addr {
+    pc.once.Do(pc.readHeader)
+    if pc.remote != nil {
+        return pc.remote
+    }
+    return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) readHeader() {
+    if !pc.trusted.allows(pc.Conn.RemoteAddr()) {
+        pc.err = fmt.Errorf("PROXY header not accepted from %s", pc.Conn.RemoteAddr())
+        return
+    }
+
+    pc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+    defer pc.Conn.SetReadDeadline(time.Time{})
+
+    pc.reader = bufio.NewReader(pc.Conn)
+
+    start, err := pc.reader.Peek(len(proxyV2Signature))
+    if err != nil {
+        pc.err = fmt.Errorf("failed to read PROXY header: %w", err)
+        return
+    }
+
+    switch {
+    case bytes.Equal(start, proxyV2Signature):
+        pc.remote, pc.err = readProxyV2(pc.reader)
+    case bytes.HasPrefix(start, []byte("PROXY ")):
+        pc.remote, pc.err = readProxyV1(pc.reader)
+    default:
+        pc.err = fmt.Errorf("missing PROXY header from %s", pc.Conn.RemoteAddr())
+    }
+}
+
+// readProxyV1 parses "PROXY TCP4|TCP6 <src> <dst> <sport> <dport>\r\n".
+// For "PROXY UNKNOWN" it returns a nil address, keeping the peer's own.
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+    line, err := reader.ReadSlice('\n')
+    if err != nil || len(line) > proxyV1MaxLength {
+        return nil, fmt.Errorf("invalid PROXY v1 header")
+    }
+
+    fields := strings.Fields(strings.TrimRight(string(line), "\r\n"))
+    if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+        return nil, nil
+    }
+    if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+        return nil, fmt.Errorf("invalid PROXY v1 header")
+    }
+
+    ip := net.ParseIP(fields[2])
+    port, err := strconv.Atoi(fields[4])
+    if ip == nil || err != nil || port < 0 || port > 65535 {
+        return nil, fmt.Errorf("invalid PROXY v1 source address")
+    }
+
+    return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses the binary header. LOCAL commands (health checks) and
+// address families other than TCP over IPv4 or IPv6 return a nil address.
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+    header := make([]byte, 16)
+    if _, err := io.ReadFull(reader, header); err != nil {
+        return nil, fmt.Errorf("invalid PROXY v2 header")
+    }
+
+    version, command := header[12]>>4, header[12]&0x0F
+    if version != 2 || command > 1 {
+        return nil, fmt.Errorf("unsupported PROXY v2 version or command")
+    }
+
+    body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+    if _, err := io.ReadFull(reader, body); err != nil {
+        return nil, fmt.Errorf("truncated PROXY v2 header")
+    }
+
+    if command == 0 {
+        return nil, nil
+    }
+
+    switch header[13] >> 4 {
+    case 1:
+        if len(body) < 12 {
+            return nil, fmt.Errorf("truncated PROXY v2 address")
+        }
+        return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+    case 2:
+        if len(body) < 36 {
+            return nil, fmt.Errorf("truncated PROXY v2 address")
+        }
+        return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+    default:
+        return nil, nil
+    }
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+)
+
+const typingRelayInterval = 3 * time.Second
+
+var typingStates = map[string]bool{"active": true, "paused": true, "done": true}
+
+func (c *Client) handleTyping(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featureReceipts); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: TYPING <username> <active|paused|done>")
+    }
+
+    state := strings.ToLower(strings.TrimPrefix(parts[2], ":"))
+    if !typingStates[state] {
+        return fmt.Errorf("invalid typing state: %s", parts[2])
+    }
+
+    targetUser, err := c.server.authService.GetUserByUsername(parts[1])
+    if err != nil {
+        return fmt.Errorf("user not found: %s", parts[1])
+    }
+
+    if state == "active" {
+        if last, ok := c.typingSent[targetUser.UserID]; ok && time.Since(last) < typingRelayInterval {
+            return nil
+        }
+        c.typingSent[targetUser.UserID] = time.Now()
+    } else {
+        delete(c.typingSent, targetUser.UserID)
+    }
+
+    c.sendReceipt(targetUser.UserID, fmt.Sprintf(":%s!%s@%s TYPING %s %s",
+        c.user.Username, c.user.Username, c.Host(), targetUser.Username, state))
+
+    return nil
+}
+
+func (c *Client) handleRead(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featureReceipts); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: READ <username>")
+    }
+
+    sender, err := c.server.authService.GetUserByUsername(parts[1])
+    if err != nil {
+        return fmt.Errorf("user not found: %s", parts[1])
+    }
+
+    marked, err := database.NewDirectMessageRepository(c.server.db).MarkReadFrom(c.user.UserID, sender.UserID)
+    if err != nil {
+        return err
+    }
+
+    if marked > 0 {
+        c.sendReceipt(sender.UserID, fmt.Sprintf(":%s!%s@%s READ %s %d",
+            c.user.Username, c.user.Username, c.Host(), sender.Username, marked))
+    }
+
+    return nil
+}
+
+// recordDirectMessage keeps the delivery and read state of a DM for receipts.
+// Only a MAC of the message is stored, never its content, so the database
+// alone cannot be used to confirm a guess at what was said.
+func (c *Client) recordDirectMessage(recipientID int64, message string) {
+    if !c.server.featureEnabled(featureReceipts) {
+        return
+    }
+
+    repo := database.NewDirectMessageRepository(c.server.db)
+    if _, err := repo.Create(c.user.UserID, recipientID, "", auth.MACMessage(c.server.cryptoManager.DeriveServerKey("onyxirc-dm-mac"), message)); err != nil {
+        log.Printf("Failed to record direct message from %s: %v", c.user.Username, err)
+    }
+}
+
+func (c *Client) sendReceipt(userID int64, message string) {
+    for _, client := range c.server.clientsForUser(userID) {
+        if client.hasCap(capabilityPrefix + featureReceipts) {
+            client.Send(message)
+        }
+    }
+}
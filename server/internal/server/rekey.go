@@ -0,0 +1,254 @@
+package server
+
+import (
+    "encoding/base64"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+)
+
+const (
+    // rekeyOverlap is how long envelopes sealed with the previous session
+    // keys are still accepted, for lines the client sent before it read the
+    // new key.
+    rekeyOverlap = 30 * time.Second
+
+    // rekeyMinInterval limits how often a client may ask for a new key.
+    rekeyMinInterval = 10 * time.Second
+)
+
+func (c *Client) handleRekey(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if !c.keyExchanged {
+        return fmt.Errorf("REKEY requires a completed KEYEXCHANGE")
+    }
+
+    ecdhOnly := c.protocol().ecdhOnly
+    if ecdhOnly && (len(parts) < 3 || strings.ToUpper(parts[1]) != "ECDH") {
+        return fmt.Errorf("usage: REKEY ECDH <public key>")
+    }
+
+    requested := c.rekeyRequestedAt.After(c.keyRotatedAt)
+    if wait := rekeyMinInterval - time.Since(c.keyRotatedAt); wait > 0 && !requested {
+        return fmt.Errorf("session key was rotated recently; try again in %s", wait.Round(time.Second))
+    }
+
+    if ecdhOnly {
+        return c.exchangeECDH(parts[2], "REKEY", "on request")
+    }
+    return c.rotateSessionKey("on request")
+}
+
+// rotateKeyIfDue rotates the session key once security.session_key_rotation
+// seconds have passed since the last exchange, and forgets the previous key
+// when its overlap is over. It runs between commands on the client's own
+// goroutine, so a client that only answers PINGs is still rotated. The
+// server cannot start an X25519 exchange on its own, so ECDH clients are
+// sent REKEY REQUEST and answer with REKEY ECDH.
+func (c *Client) rotateKeyIfDue() {
+    c.expirePreviousKey(false)
+
+    interval := time.Duration(c.server.config.Security.SessionKeyRotation) * time.Second
+    if interval <= 0 || !c.authenticated || !c.keyExchanged {
+        return
+    }
+    if time.Since(c.keyRotatedAt) < interval {
+        return
+    }
+
+    if c.protocol().ecdhOnly {
+        if time.Since(c.rekeyRequestedAt) >= interval {
+            c.rekeyRequestedAt = time.Now()
+            c.Send("REKEY REQUEST")
+        }
+        return
+    }
+
+    if err := c.rotateSessionKey("on schedule"); err != nil {
+        log.Printf("Failed to rotate session key for %s: %v", c.user.Username, err)
+    }
+}
+
+// rotateSessionKey delivers a new random session key the way KEYEXCHANGE
+// did, encrypted to the client's public key when one is on file.
+func (c *Client) rotateSessionKey(cause string) error {
+    newKey, err := c.server.cryptoManager.GenerateSessionKey(c.server.config.Security.AESKeySize)
+    if err != nil {
+        return fmt.Errorf("failed to generate session key: %w", err)
+    }
+
+    if c.publicKey == nil && c.publicKeyUnknown {
+        auth.Zero(newKey)
+        return fmt.Errorf("rekey failed: could not check for a registered public key")
+    }
+
+    var line string
+    if c.publicKey != nil {
+        encryptedKey, err := c.server.cryptoManager.EncryptSessionKey(c.publicKey, newKey)
+        if err != nil {
+            auth.Zero(newKey)
+            return fmt.Errorf("rekey failed: %w", err)
+        }
+        line = fmt.Sprintf("REKEY RSA :%s", encryptedKey)
+    } else {
+        line = fmt.Sprintf("REKEY :%s", base64.StdEncoding.EncodeToString(newKey))
+    }
+
+    installed, err := c.installSessionKey(line, newKey, false)
+    if err != nil || !installed {
+        return err
+    }
+
+    c.sendRekeyNotice(cause)
+    return nil
+}
+
+// exchangeECDH answers a client's X25519 public key with the server's and
+// switches to the derived key. reply is SESSIONKEY for KEYEXCHANGE and
+// REKEY for REKEY, which also mixes in the current session's rekey key;
+// with an identity key the reply carries its signature over both public
+// keys.
+func (c *Client) exchangeECDH(clientPublic, reply, cause string) error {
+    var rekeyKey []byte
+    if reply == "REKEY" {
+        rekeyKey = c.keys.Rekey.Bytes()
+    }
+
+    exchange, err := c.server.cryptoManager.ECDHSessionKey(clientPublic, c.server.config.Security.AESKeySize, rekeyKey)
+    if err != nil {
+        c.handshakeFailure("ecdh")
+        return fmt.Errorf("key exchange failed: %w", err)
+    }
+
+    line := fmt.Sprintf("%s%s ECDH %s :%s", c.server.identityTag(exchange.ClientPublic, exchange.ServerPublic), reply, exchange.ServerPublic, exchange.Signature)
+    installed, err := c.installSessionKey(line, exchange.SessionKey, true)
+    if err != nil || !installed {
+        return err
+    }
+
+    if reply == "SESSIONKEY" {
+        c.keyExchanged = true
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Key exchange complete (ECDH). The session key was never sent over the wire.",
+            c.server.config.Server.ServerName, c.user.Username))
+        return nil
+    }
+
+    c.sendRekeyNotice(cause)
+    return nil
+}
+
+// installSessionKey writes line, which delivers newKey to the client, and
+// swaps the session keys under writerMu, so with wire encryption on the
+// line itself is the last one sealed with the old keys and every later line
+// uses the new ones. It reports false if the line could not be written.
+// forwardSecret keys, from ECDH, are never stored; see RotateKey.
+func (c *Client) installSessionKey(line string, newKey []byte, forwardSecret bool) (bool, error) {
+    keys, err := c.deriveSessionKeys(newKey)
+    if err != nil {
+        auth.Zero(newKey)
+        return false, fmt.Errorf("rekey failed: %w", err)
+    }
+
+    c.writerMu.Lock()
+    if !c.beginWrite() {
+        auth.Zero(newKey)
+        keys.Destroy()
+        c.writerMu.Unlock()
+        return false, nil
+    }
+    if err := c.writeLine(line); err != nil {
+        auth.Zero(newKey)
+        keys.Destroy()
+        c.handleWriteError(err)
+        c.writerMu.Unlock()
+        return false, nil
+    }
+
+    current, previous, err := c.server.sessionManager.RotateKey(c.SessionID, newKey, forwardSecret)
+    if err != nil {
+        keys.Destroy()
+        c.writerMu.Unlock()
+        return false, fmt.Errorf("rekey failed: %w", err)
+    }
+    c.sessionKey = current
+    previousKeys := c.keys
+    c.keys = keys
+    c.writerMu.Unlock()
+
+    // Only the keys derived from the old secret are needed for the overlap.
+    previous.Destroy()
+
+    c.keyMu.Lock()
+    c.previousKeys.Destroy()
+    c.previousKeys = previousKeys
+    c.previousKeyUntil = time.Now().Add(rekeyOverlap)
+    c.keyMu.Unlock()
+
+    c.keyRotatedAt = time.Now()
+    return true, nil
+}
+
+// setSessionKey makes key the session secret at LOGIN or RESUME and derives
+// the keys used with it.
+func (c *Client) setSessionKey(key *auth.KeyBuffer) error {
+    keys, err := c.deriveSessionKeys(key.Bytes())
+    if err != nil {
+        return fmt.Errorf("failed to derive session keys: %w", err)
+    }
+
+    c.sessionKey = key
+    c.keys.Destroy()
+    c.keys = keys
+    return nil
+}
+
+// deriveSessionKeys expands a session secret into separate encryption, MAC
+// and rekey keys with HKDF on protocol version 3. Older clients encrypt
+// with the secret itself.
+func (c *Client) deriveSessionKeys(secret []byte) (*auth.SessionKeys, error) {
+    if c.protocol().ecdhOnly {
+        return auth.DeriveSessionKeys(secret, c.server.config.Security.LockKeyMemory)
+    }
+    return auth.LegacySessionKeys(secret, c.server.config.Security.LockKeyMemory), nil
+}
+
+func (c *Client) sendRekeyNotice(cause string) {
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Session key rotated; envelopes sealed with the previous key are accepted for %d more seconds",
+        c.server.config.Server.ServerName, c.user.Username, int(rekeyOverlap.Seconds())))
+    log.Printf("Rotated session key for %s %s", c.user.Username, cause)
+}
+
+// decryptWithPreviousKey retries an envelope that failed to decrypt with the
+// current keys, while the previous ones are still within their overlap.
+func (c *Client) decryptWithPreviousKey(ciphertext string, cause error) (string, error) {
+    c.keyMu.Lock()
+    defer c.keyMu.Unlock()
+
+    if c.previousKeys == nil || time.Now().After(c.previousKeyUntil) {
+        return "", cause
+    }
+
+    line, err := c.server.cryptoManager.OpenFrame(c.previousKeys, ciphertext)
+    if err != nil {
+        return "", cause
+    }
+    return line, nil
+}
+
+// expirePreviousKey destroys the keys replaced by the last rotation once
+// their overlap is over, or at once with force.
+func (c *Client) expirePreviousKey(force bool) {
+    c.keyMu.Lock()
+    defer c.keyMu.Unlock()
+
+    if c.previousKeys != nil && (force || time.Now().After(c.previousKeyUntil)) {
+        c.previousKeys.Destroy()
+        c.previousKeys = nil
+    }
+}
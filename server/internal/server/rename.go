@@ -0,0 +1,98 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+func (c *Client) handleRename(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: RENAME <channel> <new_name> [:reason]")
+    }
+
+    oldName := parts[1]
+    newName := parts[2]
+    reason := strings.TrimPrefix(strings.Join(parts[3:], " "), ":")
+
+    if err := c.server.validateChannelName(newName); err != nil {
+        return err
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(oldName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", oldName)
+    }
+
+    if !c.user.IsAdmin {
+        role, err := channelRepo.GetMemberRole(channel.ChannelID, c.user.UserID)
+        if err != nil || role != "owner" {
+            return fmt.Errorf("permission denied: only the channel owner or an admin can rename %s", oldName)
+        }
+    }
+
+    if _, err := channelRepo.GetByName(newName); err == nil {
+        return fmt.Errorf("channel %s already exists", newName)
+    }
+
+    var aliasExpires *time.Time
+    if days := c.server.config.Features.ChannelAliasDays; days > 0 {
+        expires := time.Now().AddDate(0, 0, days)
+        aliasExpires = &expires
+    }
+
+    if err := channelRepo.Rename(channel.ChannelID, channel.ChannelName, newName, aliasExpires); err != nil {
+        return err
+    }
+    c.server.invalidateChannel(channel.ChannelID)
+
+    if reason == "" {
+        reason = "Channel renamed"
+    }
+    c.server.BroadcastToChannel(channel.ChannelID, fmt.Sprintf(":%s!%s@%s RENAME %s %s :%s",
+        c.user.Username, c.user.Username, c.Host(), channel.ChannelName, newName, reason), "")
+
+    if !c.IsInChannel(channel.ChannelID) {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Channel %s renamed to %s", c.server.config.Server.ServerName, c.user.Username, channel.ChannelName, newName))
+    }
+
+    log.Printf("User %s renamed channel %s to %s", c.user.Username, channel.ChannelName, newName)
+
+    return nil
+}
+
+func (s *Server) validateChannelName(name string) error {
+    if len(name) < 2 || name[0] != '#' {
+        return numerics.BadChanName(name, "must start with #")
+    }
+
+    if !utf8.ValidString(name) || strings.IndexFunc(name, invalidChannelRune) >= 0 {
+        return numerics.BadChanName(name, "must not contain spaces, commas, colons or control characters")
+    }
+
+    maxLength := s.config.Features.MaxChannelNameLength
+    if maxLength <= 0 || maxLength > 100 {
+        maxLength = 100
+    }
+    if len(name) > maxLength {
+        return numerics.BadChanName(name, fmt.Sprintf("longer than %d characters", maxLength))
+    }
+
+    return nil
+}
+
+func invalidChannelRune(r rune) bool {
+    return r == ' ' || r == ',' || r == ':' || unicode.IsControl(r)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+const (
+    reportLimit        = 5
+    reportWindow       = 10 * time.Minute
+    reportMessageLimit = 10
+    reportListLimit    = 50
+)
+
+// handleReport files an abuse report against a user or a channel and tells
+// the admins online. With message history on, the target's most recent
+// messages are linked to the report.
+func (c *Client) handleReport(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return numerics.NeedMoreParams("REPORT", "REPORT <nick|#channel> :<reason>")
+    }
+
+    target := parts[1]
+    reason := strings.TrimPrefix(strings.Join(parts[2:], " "), ":")
+    if strings.TrimSpace(reason) == "" {
+        return numerics.NeedMoreParams("REPORT", "REPORT <nick|#channel> :<reason>")
+    }
+
+    if wait := c.server.reportLimits.allow(c.server.reportLimits.actions, c.user.UserID, reportLimit, reportWindow); wait > 0 {
+        return fmt.Errorf("too many reports; try again in %s", wait.Round(time.Second))
+    }
+
+    report := &models.Report{ReporterID: c.user.UserID, Reason: reason}
+    messageRepo := database.NewMessageRepository(c.server.db)
+    var messages []*models.Message
+    var err error
+
+    if target[0] == '#' {
+        channel, lookupErr := c.server.channels.GetByName(target)
+        if lookupErr != nil {
+            return numerics.NoSuchChannel(target)
+        }
+        report.TargetChannelID = &channel.ChannelID
+        target = channel.ChannelName
+
+        if c.server.featureEnabled(featureHistory) {
+            messages, err = messageRepo.GetChannelHistory(channel.ChannelID, reportMessageLimit)
+        }
+    } else {
+        user, lookupErr := c.server.authService.GetUserByUsername(target)
+        if lookupErr != nil {
+            return numerics.NoSuchNick(target)
+        }
+        if user.UserID == c.user.UserID {
+            return fmt.Errorf("you cannot report yourself")
+        }
+        report.TargetUserID = &user.UserID
+        target = user.Username
+
+        if c.server.featureEnabled(featureHistory) {
+            messages, err = messageRepo.ListByUser(user.UserID, reportMessageLimit)
+        }
+    }
+    if err != nil {
+        return err
+    }
+
+    for _, message := range messages {
+        report.MessageIDs = append(report.MessageIDs, message.MessageID)
+    }
+
+    reportID, err := database.NewReportRepository(c.server.db).Create(report)
+    if err != nil {
+        return err
+    }
+
+    c.server.noticeAdmins(fmt.Sprintf("New report %d from %s against %s: %s (see ADMIN reports)", reportID, c.user.Username, target, reason))
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Report %d against %s has been sent to the admins", c.server.config.Server.ServerName, c.user.Username, reportID, target))
+    log.Printf("User %s reported %s (report %d): %s", c.user.Username, target, reportID, reason)
+
+    return nil
+}
+
+// noticeAdmins sends a NOTICE to every admin connected to this server.
+func (s *Server) noticeAdmins(message string) {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    for _, client := range s.clients {
+        if client.user != nil && client.user.IsAdmin {
+            client.Send(fmt.Sprintf(":%s NOTICE %s :%s", s.config.Server.ServerName, client.Username(), message))
+        }
+    }
+}
+
+func (c *Client) handleAdminReports(args []string) error {
+    if len(args) == 0 {
+        return c.handleAdminReportsList(admin.ReportOpen)
+    }
+
+    switch strings.ToLower(args[0]) {
+    case "list":
+        status := admin.ReportOpen
+        if len(args) > 1 {
+            status = strings.ToLower(args[1])
+        }
+        if status == "all" {
+            status = ""
+        }
+        return c.handleAdminReportsList(status)
+    case "resolve":
+        return c.handleAdminReportClose(args[1:], admin.ReportResolved)
+    case "dismiss":
+        return c.handleAdminReportClose(args[1:], admin.ReportDismissed)
+    default:
+        return fmt.Errorf("usage: ADMIN reports [list [open|resolved|dismissed|all]] | resolve|dismiss <id> [note]")
+    }
+}
+
+func (c *Client) handleAdminReportsList(status string) error {
+    reports, err := c.server.adminService.ListReports(c.user.UserID, status, reportListLimit)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    title := "All Reports"
+    if status != "" {
+        title = strings.ToUpper(status[:1]) + status[1:] + " Reports"
+    }
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== %s (%d) ===", serverName, c.user.Username, title, len(reports)))
+
+    for _, report := range reports {
+        target := report.TargetName
+        if target == "" {
+            target = "(deleted)"
+        }
+
+        line := fmt.Sprintf("%d [%s] %s reported %s at %s: %s", report.ReportID, report.Status, report.ReporterName,
+            target, report.CreatedAt.Format(time.RFC3339), report.Reason)
+        if len(report.MessageIDs) > 0 {
+            ids := make([]string, len(report.MessageIDs))
+            for i, id := range report.MessageIDs {
+                ids[i] = strconv.FormatInt(id, 10)
+            }
+            line += " (messages " + strings.Join(ids, ",") + ")"
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s", serverName, c.user.Username, line))
+    }
+
+    return nil
+}
+
+func (c *Client) handleAdminReportClose(args []string, status string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN reports resolve|dismiss <id> [note]")
+    }
+
+    reportID, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid report id: %s", args[0])
+    }
+    note := strings.Join(args[1:], " ")
+
+    if err := c.server.adminService.CloseReport(c.user.UserID, reportID, status, note); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Report %d marked %s", c.server.config.Server.ServerName, c.user.Username, reportID, status))
+    log.Printf("Admin %s marked report %d %s", c.user.Username, reportID, status)
+
+    return nil
+}
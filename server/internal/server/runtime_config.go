@@ -0,0 +1,225 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+)
+
+// tunable is a setting ADMIN config can change without a restart. set
+// validates the value and applies it to the running server.
+type tunable struct {
+    description string
+    get         func(s *Server) string
+    set         func(s *Server, value string) error
+}
+
+var tunables = map[string]tunable{
+    "server.motd": {
+        description: "Message of the day sent after login",
+        get:         func(s *Server) string { return s.config.Server.MOTD },
+        set: func(s *Server, value string) error {
+            s.config.Server.MOTD = value
+            return nil
+        },
+    },
+    "security.max_ip_suspicion": intTunable("IP changes tolerated before an account is locked", 1,
+        func(cfg *config.Config) *int { return &cfg.Security.MaxIPSuspicion },
+        func(s *Server) { s.ipTrackingService.SetMaxSuspicion(s.config.Security.MaxIPSuspicion) }),
+    "security.suspicion_decay_interval": intTunable("Seconds without an IP change before suspicion drops by one (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.SuspicionDecayInterval },
+        nil),
+    "security.session_key_rotation": intTunable("Seconds after a key exchange before the session key is rotated (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.SessionKeyRotation },
+        nil),
+    "security.max_login_attempts": intTunable("Failed logins per account before a lockout (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.MaxLoginAttempts },
+        (*Server).applyLoginLimits),
+    "security.max_login_attempts_per_ip": intTunable("Failed logins per address before a lockout (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.MaxLoginAttemptsPerIP },
+        (*Server).applyLoginLimits),
+    "security.login_attempt_window": intTunable("Seconds failed logins are counted for", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.LoginAttemptWindow },
+        (*Server).applyLoginLimits),
+    "security.kill_cooldown": intTunable("Seconds a killed user or address is refused", 0,
+        func(cfg *config.Config) *int { return &cfg.Security.KillCooldown },
+        nil),
+    "join_throttle.user_actions": intTunable("JOIN/PART commands per user per user_window (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.JoinThrottle.UserActions },
+        (*Server).applyJoinThrottle),
+    "join_throttle.channel_joins": intTunable("Default joins per channel per channel_window (0 disables)", 0,
+        func(cfg *config.Config) *int { return &cfg.JoinThrottle.ChannelJoins },
+        (*Server).applyJoinThrottle),
+}
+
+func intTunable(description string, min int, field func(cfg *config.Config) *int, apply func(s *Server)) tunable {
+    return tunable{
+        description: description,
+        get:         func(s *Server) string { return strconv.Itoa(*field(s.config)) },
+        set: func(s *Server, value string) error {
+            n, err := strconv.Atoi(value)
+            if err != nil || n < min {
+                return fmt.Errorf("value must be an integer of at least %d", min)
+            }
+            *field(s.config) = n
+            if apply != nil {
+                apply(s)
+            }
+            return nil
+        },
+    }
+}
+
+func (s *Server) applyLoginLimits() {
+    s.authService.SetLoginLimits(
+        s.config.Security.MaxLoginAttempts,
+        s.config.Security.MaxLoginAttemptsPerIP,
+        time.Duration(s.config.Security.LoginAttemptWindow)*time.Second,
+    )
+}
+
+func (s *Server) applyJoinThrottle() {
+    s.joinThrottle.SetConfig(s.config.JoinThrottle)
+}
+
+// loadTunables applies the overrides stored with ADMIN config on top of the
+// config file, at startup and after a rehash.
+func (s *Server) loadTunables() error {
+    stored, err := s.adminService.GetTunables()
+    if err != nil {
+        return fmt.Errorf("failed to load runtime config: %w", err)
+    }
+
+    for name, value := range stored {
+        t, ok := tunables[name]
+        if !ok {
+            continue
+        }
+        if err := t.set(s, value); err != nil {
+            log.Printf("Ignoring stored value for %s: %v", name, err)
+        }
+    }
+
+    return nil
+}
+
+func (c *Client) handleAdminConfig(args []string) error {
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN config <list|get <key>|set <key> <value>>")
+    }
+
+    switch strings.ToLower(args[0]) {
+    case "list":
+        return c.listTunables()
+    case "get":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ADMIN config get <key>")
+        }
+        return c.getTunable(args[1])
+    case "set":
+        if len(args) < 3 {
+            return fmt.Errorf("usage: ADMIN config set <key> <value>")
+        }
+        return c.setTunable(args[1], strings.Join(args[2:], " "))
+    default:
+        return fmt.Errorf("usage: ADMIN config <list|get <key>|set <key> <value>>")
+    }
+}
+
+func (c *Client) listTunables() error {
+    stored, err := c.server.adminService.GetTunables()
+    if err != nil {
+        return err
+    }
+
+    names := make([]string, 0, len(tunables))
+    for name := range tunables {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Runtime Configuration ===", serverName, c.user.Username))
+
+    for _, name := range names {
+        source := "config file"
+        if _, ok := stored[name]; ok {
+            source = "override"
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s = %q (%s) - %s", serverName, c.user.Username,
+            name, tunables[name].get(c.server), source, tunables[name].description))
+    }
+
+    return nil
+}
+
+// getTunable shows the live value of a tunable, or the raw server_config
+// entry for any other key.
+func (c *Client) getTunable(name string) error {
+    serverName := c.server.config.Server.ServerName
+
+    if t, ok := tunables[name]; ok {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s = %q", serverName, c.user.Username, name, t.get(c.server)))
+        return nil
+    }
+
+    value, err := c.server.adminService.GetServerConfig(c.user.UserID, name)
+    if err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :%s = %q", serverName, c.user.Username, name, value))
+    return nil
+}
+
+func (c *Client) setTunable(name, value string) error {
+    previous, err := c.server.SetTunable(c.user.UserID, name, value)
+    if err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :%s set to %q", c.server.config.Server.ServerName, c.user.Username, name, value))
+    log.Printf("Admin %s set %s from %q to %q", c.user.Username, name, previous, value)
+
+    return nil
+}
+
+// Tunables returns the live value of every runtime-tunable setting.
+func (s *Server) Tunables() map[string]string {
+    values := make(map[string]string, len(tunables))
+    for name, t := range tunables {
+        values[name] = t.get(s)
+    }
+    return values
+}
+
+// SetTunable applies a new value and stores it as an override, returning
+// the value it replaced. The change is undone if it cannot be stored.
+func (s *Server) SetTunable(adminID int64, name, value string) (string, error) {
+    t, ok := tunables[name]
+    if !ok {
+        return "", fmt.Errorf("%s cannot be changed at runtime (see ADMIN config list)", name)
+    }
+
+    previous := t.get(s)
+    if err := t.set(s, value); err != nil {
+        return "", fmt.Errorf("invalid value for %s: %w", name, err)
+    }
+
+    details := fmt.Sprintf("Set %s from %q to %q", name, previous, value)
+    if err := s.adminService.SetTunable(adminID, name, value, details); err != nil {
+        t.set(s, previous)
+        return "", err
+    }
+
+    return previous, nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const broadcastCheckInterval = 30 * time.Second
+
+// runBroadcastScheduler sends scheduled broadcasts when they fall due.
+// Every node of a cluster runs it; ClaimBroadcast makes sure each run is
+// sent by only one of them.
+func (s *Server) runBroadcastScheduler() {
+    ticker := time.NewTicker(broadcastCheckInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            err := s.workerPool.SubmitPriority("broadcasts", threadpool.PriorityLow, s.sendDueBroadcasts)
+            if err != nil {
+                log.Printf("Failed to queue scheduled broadcasts: %v", err)
+            }
+        }
+    }
+}
+
+func (s *Server) sendDueBroadcasts() error {
+    due, err := s.adminService.DueBroadcasts()
+    if err != nil {
+        log.Printf("Failed to load scheduled broadcasts: %v", err)
+        return err
+    }
+
+    for _, broadcast := range due {
+        claimed, err := s.adminService.ClaimBroadcast(broadcast)
+        if err != nil {
+            log.Printf("Failed to claim scheduled broadcast %d: %v", broadcast.BroadcastID, err)
+            continue
+        }
+        if !claimed {
+            continue
+        }
+
+        s.broadcast.Deliver(broadcast.CreatorName, broadcast.Message)
+        log.Printf("Sent scheduled broadcast %d from %s: %s", broadcast.BroadcastID, broadcast.CreatorName, broadcast.Message)
+    }
+
+    return nil
+}
+
+// handleAdminBroadcast takes the scheduling forms of ADMIN broadcast; the
+// broadcast plugin sends immediate ones and leaves these to the server.
+func (c *Client) handleAdminBroadcast(args []string) error {
+    usage := fmt.Errorf("usage: ADMIN broadcast <message> | at <time> [every <interval>] <message> | every <interval> <message> | list | cancel <id>")
+    if len(args) == 0 {
+        return usage
+    }
+
+    switch strings.ToLower(args[0]) {
+    case "at":
+        if len(args) < 3 {
+            return usage
+        }
+        runAt, err := parseBroadcastTime(args[1], time.Now())
+        if err != nil {
+            return err
+        }
+        rest := args[2:]
+        var interval time.Duration
+        if strings.EqualFold(rest[0], "every") {
+            if len(rest) < 3 {
+                return usage
+            }
+            if interval, err = parseBroadcastInterval(rest[1]); err != nil {
+                return err
+            }
+            rest = rest[2:]
+        }
+        return c.scheduleBroadcast(runAt, interval, strings.Join(rest, " "))
+    case "every":
+        if len(args) < 3 {
+            return usage
+        }
+        interval, err := parseBroadcastInterval(args[1])
+        if err != nil {
+            return err
+        }
+        return c.scheduleBroadcast(time.Now().Add(interval), interval, strings.Join(args[2:], " "))
+    case "list":
+        return c.handleAdminBroadcastList()
+    case "cancel":
+        if len(args) < 2 {
+            return fmt.Errorf("usage: ADMIN broadcast cancel <id>")
+        }
+        broadcastID, err := strconv.ParseInt(args[1], 10, 64)
+        if err != nil {
+            return fmt.Errorf("invalid broadcast ID: %s", args[1])
+        }
+        if err := c.server.adminService.CancelScheduledBroadcast(c.user.UserID, broadcastID); err != nil {
+            return err
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Scheduled broadcast %d cancelled", c.server.config.Server.ServerName, c.user.Username, broadcastID))
+        log.Printf("Admin %s cancelled scheduled broadcast %d", c.user.Username, broadcastID)
+        return nil
+    default:
+        return usage
+    }
+}
+
+func (c *Client) scheduleBroadcast(runAt time.Time, interval time.Duration, message string) error {
+    broadcastID, err := c.server.adminService.ScheduleBroadcast(c.user.UserID, message, runAt, interval)
+    if err != nil {
+        return err
+    }
+
+    when := runAt.Format(time.RFC3339)
+    if interval > 0 {
+        when += ", then every " + admin.FormatDuration(int(interval/time.Second))
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Broadcast %d scheduled for %s", c.server.config.Server.ServerName, c.user.Username, broadcastID, when))
+    log.Printf("Admin %s scheduled broadcast %d for %s: %s", c.user.Username, broadcastID, when, message)
+
+    return nil
+}
+
+func (c *Client) handleAdminBroadcastList() error {
+    broadcasts, err := c.server.adminService.ListScheduledBroadcasts(c.user.UserID)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Scheduled Broadcasts (%d) ===", serverName, c.user.Username, len(broadcasts)))
+
+    for _, broadcast := range broadcasts {
+        repeat := "once"
+        if broadcast.Interval > 0 {
+            repeat = "every " + admin.FormatDuration(int(broadcast.Interval/time.Second))
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%d next %s, %s, by %s: %s", serverName, c.user.Username,
+            broadcast.BroadcastID, broadcast.NextRunAt.Local().Format(time.RFC3339), repeat, broadcast.CreatorName, broadcast.Message))
+    }
+
+    return nil
+}
+
+// parseBroadcastTime reads an RFC 3339 time, a local 2006-01-02T15:04, a
+// local 15:04 (the next time the clock shows it) or a delay such as 2h.
+func parseBroadcastTime(value string, now time.Time) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+
+    if t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local); err == nil {
+        return t, nil
+    }
+
+    if t, err := time.ParseInLocation("15:04", value, time.Local); err == nil {
+        at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+        if !at.After(now) {
+            at = at.AddDate(0, 0, 1)
+        }
+        return at, nil
+    }
+
+    if seconds, err := admin.ParseDuration(value); err == nil && seconds > 0 {
+        return now.Add(time.Duration(seconds) * time.Second), nil
+    }
+
+    return time.Time{}, fmt.Errorf("invalid broadcast time: %s (use 15:04, 2006-01-02T15:04, RFC 3339 or a delay such as 2h)", value)
+}
+
+func parseBroadcastInterval(value string) (time.Duration, error) {
+    seconds, err := admin.ParseDuration(value)
+    if err != nil || seconds <= 0 {
+        return 0, fmt.Errorf("invalid broadcast interval: %s", value)
+    }
+    return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/numerics"
+    "github.com/onyxirc/server/internal/search"
+)
+
+// handleSearch finds messages in a channel the client belongs to, at most
+// features.max_search_results at a time; the closing NOTICE gives the
+// offset of the next page.
+//
+//	SEARCH <channel> [offset] :<query>
+func (c *Client) handleSearch(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featureSearch); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return numerics.NeedMoreParams("SEARCH", "SEARCH <channel> [offset] :<query>")
+    }
+
+    channelName := parts[1]
+    words := parts[2:]
+
+    // A leading number is the offset unless it is all there is to search for.
+    offset := 0
+    if len(words) > 1 && !strings.HasPrefix(words[0], ":") {
+        if n, err := strconv.Atoi(words[0]); err == nil && n >= 0 {
+            offset = n
+            words = words[1:]
+        }
+    }
+
+    query := strings.TrimPrefix(strings.Join(words, " "), ":")
+    terms := searchTerms(query)
+    if len(terms) == 0 {
+        return fmt.Errorf("search query has no words: %s", query)
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return numerics.NoSuchChannel(channelName)
+    }
+
+    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    if err != nil {
+        return fmt.Errorf("failed to check membership: %w", err)
+    }
+    if !isMember {
+        return numerics.NotOnChannel(channelName)
+    }
+
+    limit := c.server.config.Features.MaxSearchResults
+
+    // One extra result tells whether there is another page.
+    messages, err := c.server.searchChannel(channel.ChannelID, terms, offset, limit+1)
+    if err != nil {
+        return err
+    }
+
+    more := len(messages) > limit
+    if more {
+        messages = messages[:limit]
+    }
+
+    serverName := c.server.config.Server.ServerName
+    usernames := make(map[int64]string)
+    for _, message := range messages {
+        content, ok := c.server.readStoredMessage(message, channelName)
+        if !ok {
+            continue
+        }
+
+        c.Send(c.withStoredTags(message, fmt.Sprintf(":%s SEARCH %s %s %d :%s",
+            serverName, channelName, c.server.cachedUsername(usernames, message.UserID), message.SentAt.Unix(), content)))
+    }
+
+    if more {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :End of search for %s; more results with SEARCH %s %d :%s",
+            serverName, c.user.Username, channelName, channelName, offset+limit, query))
+    } else {
+        c.Send(fmt.Sprintf(":%s NOTICE %s :End of search for %s", serverName, c.user.Username, channelName))
+    }
+
+    return nil
+}
+
+// searchChannel returns a page of a channel's messages matching every
+// term. The terms are keyed for the channel first; the configured search
+// backend is used if there is one, and its results come best match first;
+// otherwise the hashed terms stored with each message are matched in the
+// database, newest first.
+func (s *Server) searchChannel(channelID int64, terms []string, offset, limit int) ([]*models.Message, error) {
+    messageRepo := database.NewMessageRepository(s.db)
+
+    hashed, err := s.channelKeys.HashTerms(channelID, terms)
+    if err != nil {
+        return nil, fmt.Errorf("failed to search: %w", err)
+    }
+
+    if s.searchIndex == nil {
+        return messageRepo.SearchChannel(channelID, hashed, offset, limit)
+    }
+
+    hits, err := s.searchIndex.Search(search.Query{
+        Terms:      hashed,
+        ChannelIDs: []int64{channelID},
+        Limit:      offset + limit,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to search: %w", err)
+    }
+
+    if offset >= len(hits) {
+        return nil, nil
+    }
+    hits = hits[offset:]
+
+    ids := make([]int64, len(hits))
+    for i, hit := range hits {
+        ids[i] = hit.MessageID
+    }
+
+    found, err := messageRepo.ListByIDs(ids)
+    if err != nil {
+        return nil, err
+    }
+
+    byID := make(map[int64]*models.Message, len(found))
+    for _, message := range found {
+        byID[message.MessageID] = message
+    }
+
+    messages := make([]*models.Message, 0, len(found))
+    for _, id := range ids {
+        if message, exists := byID[id]; exists {
+            messages = append(messages, message)
+        }
+    }
+    return messages, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/search"
+    "github.com/onyxirc/server/internal/threadpool"
+)
+
+const searchRebuildBatchSize = 500
+
+func (s *Server) indexMessage(messageID, channelID, userID int64, content string) {
+    if s.searchIndex == nil || messageID == 0 {
+        return
+    }
+
+    sentAt := time.Now()
+
+    err := s.workerPool.SubmitPriority(fmt.Sprintf("index-%d", messageID), threadpool.PriorityLow, func() error {
+        doc, err := s.searchDocument(messageID, channelID, userID, content, sentAt)
+        if err != nil {
+            log.Printf("Failed to index message %d: %v", messageID, err)
+            return err
+        }
+        if err := s.searchIndex.Index(doc); err != nil {
+            log.Printf("Failed to index message %d: %v", messageID, err)
+            return err
+        }
+        return nil
+    })
+    if err != nil {
+        log.Printf("Failed to queue message %d for indexing: %v", messageID, err)
+    }
+}
+
+// searchDocument builds the index entry for a message. Its words are keyed
+// per channel like the terms stored with the message, so the index never
+// holds the text of channel history in the clear.
+func (s *Server) searchDocument(messageID, channelID, userID int64, content string, sentAt time.Time) (search.Document, error) {
+    terms, err := s.channelKeys.HashTerms(channelID, search.Tokenize(content))
+    if err != nil {
+        return search.Document{}, err
+    }
+
+    return search.Document{
+        MessageID: messageID,
+        ChannelID: channelID,
+        UserID:    userID,
+        Terms:     terms,
+        SentAt:    sentAt,
+    }, nil
+}
+
+func (s *Server) RebuildSearchIndex() (int, error) {
+    if s.searchIndex == nil {
+        return 0, fmt.Errorf("search index is not configured")
+    }
+
+    if err := s.searchIndex.Reset(); err != nil {
+        return 0, fmt.Errorf("failed to reset search index: %w", err)
+    }
+
+    messageRepo := database.NewMessageRepository(s.db)
+
+    var lastID int64
+    indexed := 0
+    for {
+        batch, err := messageRepo.ListAfter(lastID, searchRebuildBatchSize)
+        if err != nil {
+            return indexed, err
+        }
+
+        for _, message := range batch {
+            lastID = message.MessageID
+
+            content, err := s.channelKeys.DecryptMessage(message.ChannelID, message.MessageContent)
+            if err != nil {
+                log.Printf("Skipping message %d during reindex: %v", message.MessageID, err)
+                continue
+            }
+
+            doc, err := s.searchDocument(message.MessageID, message.ChannelID, message.UserID, content, message.SentAt)
+            if err != nil {
+                log.Printf("Skipping message %d during reindex: %v", message.MessageID, err)
+                continue
+            }
+
+            if err := s.searchIndex.Index(doc); err != nil {
+                return indexed, fmt.Errorf("failed to index message %d: %w", message.MessageID, err)
+            }
+            indexed++
+        }
+
+        if len(batch) < searchRebuildBatchSize {
+            break
+        }
+    }
+
+    if err := s.searchIndex.Flush(); err != nil {
+        return indexed, fmt.Errorf("failed to flush search index: %w", err)
+    }
+
+    return indexed, nil
+}
+
+func (s *Server) CloseSearchIndex() error {
+    if s.searchIndex == nil {
+        return nil
+    }
+    return s.searchIndex.Close()
+}
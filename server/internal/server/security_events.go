@@ -0,0 +1,113 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    defaultSecurityLogLimit = 20
+    maxSecurityLogLimit     = 500
+)
+
+// recordSecurityEvent adds to the security event log; failures are only
+// logged.
+func (s *Server) recordSecurityEvent(eventType string, userID, actorID *int64, ipAddress, details string) {
+    if err := database.NewSecurityRepository(s.db).RecordEvent(eventType, userID, actorID, ipAddress, details); err != nil {
+        log.Printf("Warning: %v", err)
+    }
+}
+
+// recordDisconnect logs a connection the server or an admin closed.
+// reason is the ERROR line sent to the client.
+func (s *Server) recordDisconnect(client *Client, actorID *int64, reason string) {
+    var userID *int64
+    if client.user != nil {
+        userID = &client.user.UserID
+    }
+
+    s.recordSecurityEvent(models.SecurityEventDisconnect, userID, actorID, client.GetIPAddress(), strings.TrimPrefix(reason, "ERROR :"))
+}
+
+// handleAdminSecurity reads the security event log. Filters are key:value
+// tokens like ADMIN log's: type:<event> user:<username> ip:<address>
+// from:<time> to:<time>.
+func (c *Client) handleAdminSecurity(args []string) error {
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    usage := fmt.Errorf("usage: ADMIN security log [limit] [type:<event>] [user:<username>] [ip:<address>] [from:<time>] [to:<time>]")
+    if len(args) < 1 || !strings.EqualFold(args[0], "log") {
+        return usage
+    }
+
+    filter := database.SecurityEventFilter{Limit: defaultSecurityLogLimit}
+    for _, arg := range args[1:] {
+        key, value, found := strings.Cut(arg, ":")
+        if !found {
+            limit, err := strconv.Atoi(arg)
+            if err != nil || limit <= 0 {
+                return usage
+            }
+            filter.Limit = limit
+            continue
+        }
+
+        var err error
+        switch strings.ToLower(key) {
+        case "type":
+            filter.EventType = strings.ToLower(value)
+        case "user":
+            filter.UserID, err = c.server.lookupUserID(value)
+        case "ip":
+            filter.IPAddress = value
+        case "from":
+            filter.From, err = export.ParseTime(value)
+        case "to":
+            filter.To, err = export.ParseTime(value)
+        default:
+            err = fmt.Errorf("unknown security log filter: %s", key)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    if filter.Limit > maxSecurityLogLimit {
+        filter.Limit = maxSecurityLogLimit
+    }
+
+    events, err := database.NewSecurityRepository(c.server.db).SearchEvents(filter)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Security Event Log (%d entries) ===", serverName, c.user.Username, len(events)))
+
+    for _, event := range events {
+        line := fmt.Sprintf("[%s] %s", event.OccurredAt.Format("2006-01-02 15:04:05"), event.EventType)
+        if event.Username != nil {
+            line += " " + *event.Username
+        }
+        if event.IPAddress != nil {
+            line += " from " + *event.IPAddress
+        }
+        if event.ActorUsername != nil && (event.Username == nil || *event.ActorUsername != *event.Username) {
+            line += " by " + *event.ActorUsername
+        }
+        if event.Details != nil && *event.Details != "" {
+            line += " - " + *event.Details
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s", serverName, c.user.Username, line))
+    }
+
+    return nil
+}
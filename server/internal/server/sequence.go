@@ -0,0 +1,192 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+// channelSequencer hands out per-channel sequence numbers. On a single
+// server the counter for a channel is loaded from channels.last_seq on first
+// use and advanced in memory; stored messages carry their number back to the
+// database. With shared set, as in a cluster, every number is allocated in
+// the database instead, so nodes never hand out the same one.
+type channelSequencer struct {
+    mu     sync.Mutex
+    db     *database.DB
+    shared bool
+    last   map[int64]int64
+}
+
+func newChannelSequencer(db *database.DB, shared bool) *channelSequencer {
+    return &channelSequencer{
+        db:     db,
+        shared: shared,
+        last:   make(map[int64]int64),
+    }
+}
+
+// Assign calls fn with the next sequence number for channelID. Calls are
+// serialised, so work queued by fn is queued in sequence order. Without a
+// sequencer, or if the counter cannot be loaded, fn gets 0.
+func (q *channelSequencer) Assign(channelID int64, fn func(seq int64)) {
+    if q == nil {
+        fn(0)
+        return
+    }
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    if q.shared {
+        seq, err := database.NewChannelRepository(q.db).NextSeq(channelID)
+        if err != nil {
+            log.Printf("Failed to allocate sequence for channel %d: %v", channelID, err)
+            seq = 0
+        }
+        fn(seq)
+        return
+    }
+
+    last, loaded := q.last[channelID]
+    if !loaded {
+        stored, err := database.NewChannelRepository(q.db).GetLastSeq(channelID)
+        if err != nil {
+            log.Printf("Failed to load sequence for channel %d: %v", channelID, err)
+            fn(0)
+            return
+        }
+        last = stored
+    }
+
+    last++
+    q.last[channelID] = last
+    fn(last)
+}
+
+// withTags prefixes line with the tags the client asked for: its seq, and
+// either the server's provenance stamp or the plain msgid and time tags,
+// which the stamp already includes.
+func (c *Client) withTags(seq int64, sentAt time.Time, signature, line string) string {
+    var tags []string
+    if seq > 0 && c.hasCap(capabilityPrefix+featureSequence) {
+        tags = append(tags, fmt.Sprintf("seq=%d", seq))
+    }
+    if stamp := c.stampTags(seq, sentAt, signature); stamp != nil {
+        tags = append(tags, stamp...)
+    } else {
+        tags = append(tags, c.messageTags(seqMsgID(seq), sentAt)...)
+    }
+
+    return prefixTags(tags, line)
+}
+
+func (c *Client) withStoredTags(message *models.Message, line string) string {
+    return c.withTags(messageSeq(message), message.SentAt, messageSignature(message), line)
+}
+
+// prefixTags adds tags to line, merging them into its tag block if it
+// already has one.
+func prefixTags(tags []string, line string) string {
+    if len(tags) == 0 {
+        return line
+    }
+    if strings.HasPrefix(line, "@") {
+        return "@" + strings.Join(tags, ";") + ";" + line[1:]
+    }
+    return "@" + strings.Join(tags, ";") + " " + line
+}
+
+func messageSeq(message *models.Message) int64 {
+    if message.ChannelSeq == nil {
+        return 0
+    }
+    return *message.ChannelSeq
+}
+
+func parseSeqRange(from, to string) (int64, int64, error) {
+    fromSeq, err := strconv.ParseInt(from, 10, 64)
+    if err != nil || fromSeq < 1 {
+        return 0, 0, fmt.Errorf("invalid sequence number: %s", from)
+    }
+
+    toSeq := fromSeq
+    if to != "" {
+        toSeq, err = strconv.ParseInt(to, 10, 64)
+        if err != nil || toSeq < fromSeq {
+            return 0, 0, fmt.Errorf("invalid sequence number: %s", to)
+        }
+    }
+
+    return fromSeq, toSeq, nil
+}
+
+func (c *Client) handleResend(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featureHistory); err != nil {
+        return err
+    }
+
+    if len(parts) < 3 {
+        return fmt.Errorf("usage: RESEND <channel> <from_seq> [to_seq]")
+    }
+
+    channelName := parts[1]
+    to := ""
+    if len(parts) > 3 {
+        to = parts[3]
+    }
+
+    fromSeq, toSeq, err := parseSeqRange(parts[2], to)
+    if err != nil {
+        return err
+    }
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+
+    channel, err := channelRepo.GetByName(channelName)
+    if err != nil {
+        return fmt.Errorf("channel not found: %s", channelName)
+    }
+
+    isMember, err := channelRepo.IsMember(channel.ChannelID, c.user.UserID)
+    if err != nil {
+        return fmt.Errorf("failed to check membership: %w", err)
+    }
+    if !isMember {
+        return fmt.Errorf("cannot read history of %s: not a member", channelName)
+    }
+
+    messages, err := database.NewMessageRepository(c.server.db).ListBySeq(channel.ChannelID, fromSeq, toSeq, c.server.config.Features.MaxMessageHistory)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    usernames := make(map[int64]string)
+    lines := make([]string, 0, len(messages)+1)
+    for _, message := range messages {
+        content, ok := c.server.readStoredMessage(message, channelName)
+        if !ok {
+            continue
+        }
+
+        tags := append([]string{fmt.Sprintf("seq=%d", messageSeq(message))}, c.stampTags(messageSeq(message), message.SentAt, messageSignature(message))...)
+        lines = append(lines, prefixTags(tags, fmt.Sprintf(":%s HISTORY %s %s %d :%s",
+            serverName, channelName, c.server.cachedUsername(usernames, message.UserID), message.SentAt.Unix(), content)))
+    }
+
+    lines = append(lines, fmt.Sprintf(":%s NOTICE %s :End of resend for %s %d-%d", serverName, c.user.Username, channelName, fromSeq, toSeq))
+    c.SendBatch(lines)
+
+    return nil
+}
@@ -4,28 +4,83 @@ import (
     "fmt"
     "log"
     "net"
+    "net/http"
+    "strings"
     "sync"
     "time"
 
     "github.com/onyxirc/server/internal/admin"
+    "github.com/onyxirc/server/internal/api"
     "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/cluster"
     "github.com/onyxirc/server/internal/config"
     "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/events"
+    "github.com/onyxirc/server/internal/export"
+    "github.com/onyxirc/server/internal/link"
+    "github.com/onyxirc/server/internal/mail"
+    "github.com/onyxirc/server/internal/plugin"
+    "github.com/onyxirc/server/internal/search"
     "github.com/onyxirc/server/internal/security"
+    "github.com/onyxirc/server/internal/threadpool"
 )
 
+const eventCheckpointInterval = 5 * time.Minute
+
 type Server struct {
     config           *config.Config
     db               *database.DB
-    listener         net.Listener
+    listeners        []net.Listener
     clients          map[string]*Client 
+    clientsByUser    map[int64]map[string]*Client
+    userIDs          map[string]int64
+    channelMembers   map[int64]map[*Client]struct{}
     clientsMu        sync.RWMutex
     authService      *auth.AuthService
     adminService     *admin.AdminService
     ipTrackingService *security.IPTrackingService
+    reconnectThrottle *security.ReconnectThrottle
+    ipFilter         *security.IPFilter
+    dnsbl            *security.DNSBLChecker
     sessionManager   *security.SessionManager
     cryptoManager    *auth.CryptoManager
+    signer           *auth.MessageSigner
+    identity         *serverIdentity
+    channelKeys      *security.ChannelKeyManager
+    messageStore     MessageStore
+    workerPool       *threadpool.WorkerPool
+    exportStore      *export.Store
+    httpServer       *http.Server
+    channels         *ChannelManager
+    channelActivity  *channelActivityTracker
+    joinThrottle     *joinThrottle
+    channelSeqs      *channelSequencer
+    inactivityPolicy *admin.InactivityPolicy
+    events           *events.Log
+    eventStats       *events.StatsProjection
+    unreadCounts     *events.UnreadProjection
+    searchIndex      search.Index
+    apiServer        *api.Server
+    links            *link.Manager
+    cluster          *cluster.Cluster
+    writeMetrics     writeMetrics
+    commandMetrics   *commandMetrics
     shutdown         chan struct{}
+    stopRequests     chan int
+    stopMu           sync.Mutex
+    pendingStop      *pendingStop
+    draining         bool
+    lockdown         *lockdownState
+    lockdownMu       sync.RWMutex
+    lockdownLimits   *lockdownLimiter
+    botLimits        *lockdownLimiter
+    contentFilter    *contentFilter
+    spam             *spamTracker
+    reportLimits     *lockdownLimiter
+    emailLimits      *lockdownLimiter
+    mailer           mail.Mailer
+    plugins          *plugin.Manager
+    broadcast        *plugin.Broadcast
     wg               sync.WaitGroup
 }
 
@@ -38,83 +93,280 @@ func New(cfg *config.Config, db *database.DB) (*Server, error) {
     authService := auth.NewAuthService(
         userRepo,
         securityRepo,
+        database.NewPasswordResetRepository(db),
+        database.NewBotKeyRepository(db),
+        database.NewEmailTokenRepository(db),
         cfg.Security.PasswordMinLength,
         cfg.Security.PasswordRequireSpecial,
     )
+    authService.SetLoginLimits(
+        cfg.Security.MaxLoginAttempts,
+        cfg.Security.MaxLoginAttemptsPerIP,
+        time.Duration(cfg.Security.LoginAttemptWindow)*time.Second,
+    )
+
+    channelRepo := database.NewChannelRepository(db)
 
     adminService := admin.NewAdminService(
         userRepo,
         adminRepo,
         securityRepo,
+        channelRepo,
+        database.NewKillRepository(db),
+        database.NewIPBanRepository(db),
+        database.NewEvasionRepository(db),
+        database.NewObserverRepository(db),
+        database.NewTwoFactorRepository(db),
+        database.NewBotKeyRepository(db),
+        database.NewFilterRepository(db),
+        database.NewReportRepository(db),
+        database.NewBroadcastRepository(db),
     )
 
+    workerPool := threadpool.NewWorkerPool(
+        cfg.ThreadPool.WorkerCount,
+        cfg.ThreadPool.QueueSize,
+        cfg.ThreadPool.MaxWorkers,
+        cfg.ThreadPool.WorkerIdleTimeout,
+    )
+    adminService.SetExecutor(workerPool)
+
     ipTrackingService := security.NewIPTrackingService(
         securityRepo,
+        database.NewTrustedIPRepository(db),
         cfg.Security.MaxIPSuspicion,
         cfg.Security.EnableIPTracking,
     )
+    ipTrackingService.SetIPv6Prefix(cfg.Security.IPv6Prefix)
+
+    ipFilter, err := security.NewIPFilter(cfg.Security.IPAllow, cfg.Security.IPDeny)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load IP lists: %w", err)
+    }
+
+    cryptoManager, err := initializeCrypto(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize crypto: %w", err)
+    }
+
+    identity, err := initializeIdentity(cfg, cryptoManager)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load identity key: %w", err)
+    }
+
+    signer, err := initializeSigner(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize message signing: %w", err)
+    }
 
     sessionManager := security.NewSessionManager(
         time.Duration(cfg.Security.SessionTimeout) * time.Second,
+        database.NewSessionRepository(db),
+        cryptoManager,
+        cfg.Security.LockKeyMemory,
     )
 
-    cryptoManager, err := initializeCrypto(cfg)
+    channelKeys := security.NewChannelKeyManager(
+        database.NewChannelKeyRepository(db),
+        cryptoManager,
+        cfg.Security.AESKeySize,
+    )
+
+    searchIndex, err := search.Open(cfg.Search)
     if err != nil {
-        return nil, fmt.Errorf("failed to initialize crypto: %w", err)
+        return nil, fmt.Errorf("failed to open search index: %w", err)
     }
 
-    return &Server{
+    eventStats := events.NewStatsProjection()
+    unreadCounts := events.NewUnreadProjection()
+
+    s := &Server{
         config:            cfg,
         db:                db,
         clients:           make(map[string]*Client),
+        clientsByUser:     make(map[int64]map[string]*Client),
+        userIDs:           make(map[string]int64),
+        channelMembers:    make(map[int64]map[*Client]struct{}),
         authService:       authService,
         adminService:      adminService,
         ipTrackingService: ipTrackingService,
+        reconnectThrottle: security.NewReconnectThrottle(
+            time.Duration(cfg.Security.ReconnectWindow)*time.Second,
+            cfg.Security.ReconnectBurst,
+            time.Duration(cfg.Security.ReconnectMaxDelay)*time.Second,
+        ),
+        ipFilter:          ipFilter,
+        dnsbl:             newDNSBLChecker(cfg.DNSBL),
         sessionManager:    sessionManager,
         cryptoManager:     cryptoManager,
+        signer:            signer,
+        identity:          identity,
+        channelKeys:       channelKeys,
+        messageStore:      newDatabaseMessageStore(db, channelKeys),
+        workerPool:        workerPool,
+        exportStore:       export.NewStore(cfg.Export.Directory, cfg.Export.Retention),
+        channels:          NewChannelManager(db),
+        channelActivity:   newChannelActivityTracker(db),
+        joinThrottle:      newJoinThrottle(db, cfg.JoinThrottle),
+        channelSeqs:       newChannelSequencer(db, cfg.Cluster.Enabled),
+        commandMetrics:    newCommandMetrics(),
+        lockdownLimits:    newLockdownLimiter(),
+        botLimits:         newLockdownLimiter(),
+        contentFilter:     newContentFilter(),
+        spam:              newSpamTracker(),
+        reportLimits:      newLockdownLimiter(),
+        emailLimits:       newLockdownLimiter(),
+        inactivityPolicy:  admin.NewInactivityPolicy(userRepo, channelRepo, cfg.Inactivity),
+        events:            events.NewLog(database.NewEventRepository(db), eventStats, unreadCounts),
+        eventStats:        eventStats,
+        unreadCounts:      unreadCounts,
+        searchIndex:       searchIndex,
         shutdown:          make(chan struct{}),
-    }, nil
+        stopRequests:      make(chan int, 1),
+    }
+
+    if smtp := cfg.SMTP; smtp.Host != "" {
+        s.mailer = mail.NewSMTP(smtp.Host, smtp.Port, smtp.Username, smtp.Password, smtp.From)
+    }
+
+    s.broadcast = plugin.NewBroadcast(func() string { return s.config.Features.AnnouncementChannel })
+    builtin := []plugin.Plugin{s.broadcast}
+    s.plugins, err = plugin.NewManager(&pluginHost{server: s}, builtin, cfg.Plugins.Enabled, cfg.Plugins.Paths)
+    if err != nil {
+        return nil, fmt.Errorf("failed to load plugins: %w", err)
+    }
+    log.Printf("Loaded plugins: %s", strings.Join(s.plugins.Names(), ", "))
+
+    return s, nil
 }
 
 func (s *Server) Start() error {
-    address := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
+    replayed, err := s.events.Rebuild()
+    if err != nil {
+        return fmt.Errorf("failed to rebuild event projections: %w", err)
+    }
+    log.Printf("Rebuilt event projections from %d events", replayed)
+    if replayed > 0 {
+        if err := s.events.Checkpoint(); err != nil {
+            log.Printf("Failed to save event checkpoint: %v", err)
+        }
+    }
 
-    listener, err := net.Listen("tcp", address)
+    upgraded, err := s.upgradeMessageMACs()
     if err != nil {
-        return fmt.Errorf("failed to start listener: %w", err)
+        return fmt.Errorf("failed to upgrade message hashes: %w", err)
+    }
+    if upgraded > 0 {
+        log.Printf("Replaced the hashes of %d messages with MACs", upgraded)
     }
 
-    s.listener = listener
-    log.Printf("Server listening on %s", address)
+    if err := s.reloadIPBans(); err != nil {
+        return err
+    }
 
-    for {
-        select {
-        case <-s.shutdown:
-            return nil
-        default:
-            conn, err := s.listener.Accept()
-            if err != nil {
-                select {
-                case <-s.shutdown:
-                    return nil
-                default:
-                    log.Printf("Failed to accept connection: %v", err)
-                    continue
-                }
-            }
+    if err := s.reloadFilters(); err != nil {
+        return err
+    }
+
+    if err := s.loadLockdown(); err != nil {
+        return err
+    }
 
-            s.wg.Add(1)
-            go s.handleConnection(conn)
+    if err := s.loadTunables(); err != nil {
+        return err
+    }
+
+    listenerConfigs := s.config.Server.ListenerConfigs()
+
+    for _, lc := range listenerConfigs {
+        listener, err := openListener(lc)
+        if err != nil {
+            s.closeListeners()
+            return fmt.Errorf("failed to start listener %s: %w", lc.Name, err)
         }
+
+        s.listeners = append(s.listeners, listener)
+        log.Printf("Server listening on %s (%s)", lc.Address(), lc.Name)
+    }
+
+    s.workerPool.Start()
+
+    if s.config.Export.HTTPListen != "" {
+        s.startHTTP()
+    }
+
+    if s.config.API.Listen != "" {
+        s.apiServer = api.NewServer(s.config, s.adminService, s.authService, s.sessionManager, s)
+        s.apiServer.Start()
     }
+
+    if s.config.Inactivity.Enabled {
+        go s.runInactivitySweeps()
+    }
+
+    go s.runEventCheckpoints()
+
+    if err := s.startLinks(); err != nil {
+        s.closeListeners()
+        return err
+    }
+
+    if err := s.startCluster(); err != nil {
+        s.closeListeners()
+        return err
+    }
+
+    go s.runAccountPurges()
+    go s.runMaintenance()
+    go s.runBroadcastScheduler()
+
+    for i, listener := range s.listeners {
+        s.wg.Add(1)
+        go s.acceptLoop(listener, listenerConfigs[i])
+    }
+
+    <-s.shutdown
+    return nil
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+func (s *Server) closeListeners() {
+    for _, listener := range s.listeners {
+        listener.Close()
+    }
+}
+
+func (s *Server) handleConnection(conn net.Conn, lc config.ListenerConfig) {
     defer s.wg.Done()
 
     client := NewClient(conn, s)
+    client.adminOnly = lc.AdminOnly
+
+    if s.isDraining() {
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (Server is shutting down)", client.GetIPAddress()))
+        conn.Close()
+        return
+    }
 
-    log.Printf("New connection from %s", conn.RemoteAddr().String())
+    if allowed, reason := s.ipFilter.Check(client.GetIPAddress()); !allowed {
+        log.Printf("Refused connection from %s on %s: %s", conn.RemoteAddr().String(), lc.Name, reason)
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", client.GetIPAddress(), reason))
+        conn.Close()
+        return
+    }
+
+    if delay := s.reconnectThrottle.Attempt("ip:" + client.GetIPAddress()); delay > 0 {
+        log.Printf("Throttled reconnect from %s on %s for %s", conn.RemoteAddr().String(), lc.Name, delay.Round(time.Second))
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (Reconnecting too fast; try again in %s)", client.GetIPAddress(), delay.Round(time.Second)))
+        conn.Close()
+        return
+    }
+
+    if !s.checkDNSBL(client, lc) {
+        conn.Close()
+        return
+    }
+
+    log.Printf("New connection from %s on %s", conn.RemoteAddr().String(), lc.Name)
 
     client.Handle()
 
@@ -125,14 +377,91 @@ func (s *Server) AddClient(client *Client) {
     s.clientsMu.Lock()
     defer s.clientsMu.Unlock()
 
+    if previous, exists := s.clients[client.SessionID]; exists {
+        s.unindexClient(previous)
+    }
     s.clients[client.SessionID] = client
+    s.indexClient(client)
 }
 
 func (s *Server) RemoveClient(sessionID string) {
     s.clientsMu.Lock()
     defer s.clientsMu.Unlock()
 
-    delete(s.clients, sessionID)
+    if client, exists := s.clients[sessionID]; exists {
+        s.unindexClient(client)
+        delete(s.clients, sessionID)
+    }
+}
+
+func (s *Server) detachClient(client *Client) {
+    s.clientsMu.Lock()
+    defer s.clientsMu.Unlock()
+
+    if current, exists := s.clients[client.SessionID]; exists && current == client {
+        s.unindexClient(client)
+        delete(s.clients, client.SessionID)
+    }
+}
+
+// indexClient and unindexClient keep clientsByUser, userIDs and
+// channelMembers in step with clients; the caller holds clientsMu for
+// writing.
+func (s *Server) indexClient(client *Client) {
+    for _, channelID := range client.GetChannels() {
+        s.indexChannelMember(channelID, client)
+    }
+
+    if client.user == nil {
+        return
+    }
+
+    sessions, exists := s.clientsByUser[client.user.UserID]
+    if !exists {
+        sessions = make(map[string]*Client)
+        s.clientsByUser[client.user.UserID] = sessions
+    }
+    sessions[client.SessionID] = client
+    s.userIDs[client.Username()] = client.user.UserID
+}
+
+func (s *Server) unindexClient(client *Client) {
+    for _, channelID := range client.GetChannels() {
+        s.unindexChannelMember(channelID, client)
+    }
+
+    if client.user == nil {
+        return
+    }
+
+    sessions := s.clientsByUser[client.user.UserID]
+    if sessions[client.SessionID] != client {
+        return
+    }
+
+    delete(sessions, client.SessionID)
+    if len(sessions) == 0 {
+        delete(s.clientsByUser, client.user.UserID)
+        delete(s.userIDs, client.Username())
+    }
+}
+
+// renameUser passes a nick change on to every session of userID, each of
+// which applies it on its own goroutine, and updates the username index.
+func (s *Server) renameUser(userID int64, oldUsername, newUsername string) {
+    s.clientsMu.Lock()
+    defer s.clientsMu.Unlock()
+
+    for _, client := range s.clientsByUser[userID] {
+        client.queueRename(newUsername)
+    }
+
+    if s.userIDs[oldUsername] == userID {
+        delete(s.userIDs, oldUsername)
+    }
+    if _, connected := s.clientsByUser[userID]; connected {
+        s.userIDs[newUsername] = userID
+    }
 }
 
 func (s *Server) GetClient(sessionID string) (*Client, bool) {
@@ -143,29 +472,205 @@ func (s *Server) GetClient(sessionID string) (*Client, bool) {
     return client, exists
 }
 
-func (s *Server) BroadcastToChannel(channelID int64, message string, excludeSessionID string) {
+func (s *Server) BroadcastNotice(message string) {
+    s.broadcastNoticeLocal(message)
+    s.publish(&cluster.Event{Kind: cluster.KindNotice, Message: message})
+}
+
+func (s *Server) broadcastNoticeLocal(message string) {
+    broadcastMsg := fmt.Sprintf(":%s NOTICE * :[BROADCAST] %s", s.config.Server.ServerName, message)
+
     s.clientsMu.RLock()
     defer s.clientsMu.RUnlock()
 
     for _, client := range s.clients {
-        if client.SessionID == excludeSessionID {
-            continue
+        client.Send(broadcastMsg)
+    }
+}
+
+func (s *Server) BroadcastToChannel(channelID int64, message string, excludeSessionID string) {
+    s.broadcastToChannelLocal(channelID, message, excludeSessionID)
+    s.publish(&cluster.Event{Kind: cluster.KindChannels, ChannelIDs: []int64{channelID}, Message: message})
+}
+
+func (s *Server) broadcastToChannelLocal(channelID int64, message string, excludeSessionID string) {
+    s.fanOut(s.membersOf([]int64{channelID}, excludeSessionID), func(client *Client) {
+        client.deliver(message)
+    })
+}
+
+func (s *Server) deliverChannelMessage(channelID int64, message string, seq int64, sentAt time.Time, signature, excludeSessionID string) {
+    s.deliverChannelMessageLocal(channelID, message, seq, sentAt, signature, excludeSessionID)
+    s.publish(&cluster.Event{
+        Kind:       cluster.KindMessage,
+        ChannelIDs: []int64{channelID},
+        Message:    message,
+        Seq:        seq,
+        SentAt:     sentAt,
+        Signature:  signature,
+    })
+}
+
+func (s *Server) deliverChannelMessageLocal(channelID int64, message string, seq int64, sentAt time.Time, signature, excludeSessionID string) {
+    s.fanOut(s.membersOf([]int64{channelID}, excludeSessionID), func(client *Client) {
+        if !client.IsChannelMuted(channelID) {
+            client.deliver(client.withTags(seq, sentAt, signature, message))
+        }
+    })
+}
+
+func (s *Server) BroadcastToChannels(channelIDs []int64, message string, excludeSessionID string) {
+    s.broadcastToChannelsLocal(channelIDs, message, excludeSessionID)
+    s.publish(&cluster.Event{Kind: cluster.KindChannels, ChannelIDs: channelIDs, Message: message})
+}
+
+func (s *Server) broadcastToChannelsLocal(channelIDs []int64, message string, excludeSessionID string) {
+    s.fanOut(s.membersOf(channelIDs, excludeSessionID), func(client *Client) {
+        client.deliver(message)
+    })
+}
+
+func (s *Server) clientsForUser(userID int64) []*Client {
+    s.clientsMu.RLock()
+    defer s.clientsMu.RUnlock()
+
+    sessions := s.clientsByUser[userID]
+    if len(sessions) == 0 {
+        return nil
+    }
+
+    clients := make([]*Client, 0, len(sessions))
+    for _, client := range sessions {
+        clients = append(clients, client)
+    }
+    return clients
+}
+
+func (s *Server) clientsForUsername(username string) []*Client {
+    s.clientsMu.RLock()
+    userID, exists := s.userIDs[username]
+    s.clientsMu.RUnlock()
+
+    if !exists {
+        return nil
+    }
+    return s.clientsForUser(userID)
+}
+
+func (s *Server) awayMessage(userID int64) (string, bool) {
+    clients := s.clientsForUser(userID)
+    if len(clients) == 0 {
+        return "", false
+    }
+
+    message := ""
+    for _, client := range clients {
+        clientMessage, away := client.AwayMessage()
+        if !away {
+            return "", false
         }
+        message = clientMessage
+    }
 
-        client.channelsMu.RLock()
-        inChannel := false
-        for _, cid := range client.channels {
-            if cid == channelID {
-                inChannel = true
-                break
+    return message, true
+}
+
+func (s *Server) noticeUser(userID int64, message string) {
+    s.noticeUserLocal(userID, message)
+    s.publish(&cluster.Event{Kind: cluster.KindUserNotice, UserID: userID, Message: message})
+}
+
+func (s *Server) noticeUserLocal(userID int64, message string) {
+    for _, client := range s.clientsForUser(userID) {
+        client.Send(fmt.Sprintf(":%s NOTICE %s :%s", s.config.Server.ServerName, client.Username(), message))
+    }
+}
+
+// runEventCheckpoints saves the event projections now and then, so a
+// restart replays only the events since the last checkpoint.
+func (s *Server) runEventCheckpoints() {
+    ticker := time.NewTicker(eventCheckpointInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-s.shutdown:
+            return
+        case <-ticker.C:
+            if err := s.events.Checkpoint(); err != nil {
+                log.Printf("Failed to save event checkpoint: %v", err)
             }
         }
-        client.channelsMu.RUnlock()
+    }
+}
 
-        if inChannel {
-            client.Send(message)
+func (s *Server) recordEvent(eventType string, userID, channelID *int64, data interface{}) {
+    if err := s.events.Record(eventType, userID, channelID, data); err != nil {
+        log.Printf("Failed to record %s event: %v", eventType, err)
+    }
+}
+
+// submitOrdered runs task on the worker pool after every earlier task with
+// the same key. Without a pool (as in the benchmark) it runs inline.
+func (s *Server) submitOrdered(key, id string, task func() error) {
+    if s.workerPool == nil {
+        if err := task(); err != nil {
+            log.Printf("Job %s failed: %v", id, err)
         }
+        return
+    }
+
+    s.workerPool.SubmitOrdered(key, threadpool.Job{ID: id, Task: task, Priority: threadpool.PriorityNormal})
+}
+
+func (s *Server) EnforceKick(username, reason string) {
+    s.disconnectUser(username, fmt.Sprintf("ERROR :Kicked by admin: %s", reason))
+}
+
+func (s *Server) EnforceBan(adminID int64, username, reason string, durationSeconds int) {
+    if target, err := s.authService.GetUserByUsername(username); err == nil {
+        s.recordEvent(events.BanIssued, &target.UserID, nil, events.BanIssuedData{
+            AdminID:         adminID,
+            Reason:          reason,
+            DurationSeconds: durationSeconds,
+        })
+    }
+
+    by := "admin"
+    if adminID == database.AutoActor {
+        by = "server"
     }
+    s.disconnectUser(username, fmt.Sprintf("ERROR :Banned by %s: %s", by, reason))
+}
+
+func (s *Server) DeliverBroadcast(username, message string) {
+    s.broadcast.Deliver(username, message)
+}
+
+func (s *Server) disconnectUser(username, message string) {
+    s.disconnectUserLocal(username, message)
+    s.publish(&cluster.Event{Kind: cluster.KindDisconnect, Username: username, Message: message})
+}
+
+func (s *Server) disconnectUserLocal(username, message string) {
+    for _, client := range s.clientsForUsername(username) {
+        client.Send(message)
+        s.penalizeReconnect(client)
+        s.recordDisconnect(client, nil, message)
+        client.endSession = true
+        go client.Disconnect()
+    }
+}
+
+func (s *Server) penalizeReconnect(client *Client) {
+    s.reconnectThrottle.Penalize("ip:" + client.GetIPAddress())
+    if client.user != nil {
+        s.reconnectThrottle.Penalize(fmt.Sprintf("user:%d", client.user.UserID))
+    }
+}
+
+func (s *Server) ActiveConnections() int {
+    return s.GetActiveClientCount()
 }
 
 func (s *Server) GetActiveClientCount() int {
@@ -180,16 +685,42 @@ func (s *Server) Shutdown() error {
 
     close(s.shutdown)
 
-    if s.listener != nil {
-        s.listener.Close()
+    s.closeListeners()
+
+    if s.httpServer != nil {
+        s.httpServer.Close()
     }
 
-    s.clientsMu.Lock()
+    if s.apiServer != nil {
+        s.apiServer.Close()
+    }
+
+    if s.links != nil {
+        s.links.Close()
+    }
+
+    if s.cluster != nil {
+        s.cluster.Close()
+    }
+
+    message := s.shutdownMessage()
+
+    s.clientsMu.RLock()
+    clients := make([]*Client, 0, len(s.clients))
     for _, client := range s.clients {
-        client.Send("ERROR :Server shutting down")
+        clients = append(clients, client)
+    }
+    s.clientsMu.RUnlock()
+
+    for _, client := range clients {
+        client.Send(message)
         client.Disconnect()
     }
-    s.clientsMu.Unlock()
+
+    drainTimeout := s.config.Server.DrainTimeout
+    if drainTimeout <= 0 {
+        drainTimeout = defaultDrainTimeout
+    }
 
     done := make(chan struct{})
     go func() {
@@ -200,10 +731,25 @@ func (s *Server) Shutdown() error {
     select {
     case <-done:
         log.Println("All connections closed gracefully")
-    case <-time.After(10 * time.Second):
+    case <-time.After(drainTimeout):
         log.Println("Shutdown timeout reached, forcing exit")
     }
 
+    s.workerPool.Shutdown()
+
+    if err := s.events.Checkpoint(); err != nil {
+        log.Printf("Failed to save event checkpoint: %v", err)
+    }
+
+    if persisted := s.sessionManager.Flush(); persisted > 0 {
+        log.Printf("Persisted %d sessions for resumption", persisted)
+    }
+    s.sessionManager.WipeKeys()
+
+    if err := s.CloseSearchIndex(); err != nil {
+        log.Printf("Error closing search index: %v", err)
+    }
+
     if err := s.db.Close(); err != nil {
         log.Printf("Error closing database: %v", err)
     }
@@ -252,3 +798,22 @@ func initializeCrypto(cfg *config.Config) (*auth.CryptoManager, error) {
 
     return cryptoManager, nil
 }
+
+func initializeSigner(cfg *config.Config) (*auth.MessageSigner, error) {
+    if cfg.Security.MessageSigningKeyPath == "" {
+        return nil, nil
+    }
+
+    signer, created, err := auth.LoadOrCreateMessageSigner(cfg.Security.MessageSigningKeyPath)
+    if err != nil {
+        return nil, err
+    }
+
+    if created {
+        log.Printf("Generated new message signing key: %s", signer.PublicKey())
+    } else {
+        log.Printf("Message signing key loaded: %s", signer.PublicKey())
+    }
+
+    return signer, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    defaultLoginHistory = 10
+    maxLoginHistory     = 50
+)
+
+// handleSessions lists the caller's own sessions, or ends one of them with
+// SESSIONS KILL. Sessions are shown by the same reference as ADMIN who.
+func (c *Client) handleSessions(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) == 1 {
+        return c.listSessions()
+    }
+
+    if strings.ToUpper(parts[1]) != "KILL" || len(parts) != 3 {
+        return fmt.Errorf("usage: SESSIONS [KILL <id>]")
+    }
+
+    return c.killOwnSession(parts[2])
+}
+
+func (c *Client) listSessions() error {
+    sessions := c.server.sessionManager.GetUserSessions(c.user.UserID)
+    sort.Slice(sessions, func(i, j int) bool {
+        return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+    })
+
+    connected := make(map[string]bool)
+    for _, client := range c.server.clientsForUser(c.user.UserID) {
+        connected[client.SessionID] = true
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Your sessions (%d) ===", serverName, c.user.Username, len(sessions)))
+
+    for _, session := range sessions {
+        state := "disconnected"
+        if session.SessionID == c.SessionID {
+            state = "current"
+        } else if connected[session.SessionID] {
+            state = "connected"
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s from %s, created %s, last active %s ago (%s)",
+            serverName, c.user.Username,
+            sessionRef(session.SessionID),
+            session.IPAddress,
+            session.CreatedAt.Format(time.RFC3339),
+            time.Since(session.LastActivity).Round(time.Second),
+            state))
+    }
+
+    return nil
+}
+
+// killOwnSession ends one of the caller's other sessions, disconnecting it
+// if it is connected. The session cannot be resumed afterwards.
+func (c *Client) killOwnSession(ref string) error {
+    var sessionID string
+    for _, session := range c.server.sessionManager.GetUserSessions(c.user.UserID) {
+        if session.SessionID == ref || sessionRef(session.SessionID) == strings.ToLower(ref) {
+            sessionID = session.SessionID
+            break
+        }
+    }
+    if sessionID == "" {
+        return fmt.Errorf("no session %s (see SESSIONS)", ref)
+    }
+    if sessionID == c.SessionID {
+        return fmt.Errorf("%s is this session; use QUIT to end it", ref)
+    }
+
+    disconnected := false
+    for _, client := range c.server.clientsForUser(c.user.UserID) {
+        if client.SessionID != sessionID {
+            continue
+        }
+        client.Send(fmt.Sprintf("ERROR :Closing Link: %s (Session ended from another connection)", client.Host()))
+        client.endSession = true
+        go client.Disconnect()
+        disconnected = true
+    }
+    if !disconnected {
+        c.server.sessionManager.DestroySession(sessionID)
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Ended session %s", c.server.config.Server.ServerName, c.user.Username, sessionRef(sessionID)))
+    log.Printf("User %s ended their session %s", c.user.Username, sessionRef(sessionID))
+
+    return nil
+}
+
+// handleLoginHistory shows the caller's most recent login attempts,
+// successful or not, with the address each came from.
+func (c *Client) handleLoginHistory(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    limit := defaultLoginHistory
+    if len(parts) > 1 {
+        n, err := strconv.Atoi(parts[1])
+        if err != nil || n < 1 {
+            return fmt.Errorf("usage: LOGINHISTORY [count]")
+        }
+        limit = n
+        if limit > maxLoginHistory {
+            limit = maxLoginHistory
+        }
+    }
+
+    history, err := c.server.ipTrackingService.GetLoginHistory(c.user.UserID, limit)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Recent logins (%d) ===", serverName, c.user.Username, len(history)))
+
+    for _, record := range history {
+        result := "failed"
+        if record.IsSuccessful {
+            result = "ok"
+        }
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s from %s: %s",
+            serverName, c.user.Username, record.LoginTimestamp.Format(time.RFC3339), record.IPAddress, result))
+    }
+
+    return nil
+}
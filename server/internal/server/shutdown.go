@@ -0,0 +1,163 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+// Exit codes let a supervisor tell an operator-requested stop from a crash,
+// which exits with 1.
+const (
+    ExitShutdown = 0
+    ExitRestart  = 75
+)
+
+const defaultDrainTimeout = 10 * time.Second
+
+var stopAnnouncements = []time.Duration{
+    30 * time.Minute,
+    10 * time.Minute,
+    5 * time.Minute,
+    time.Minute,
+    30 * time.Second,
+    10 * time.Second,
+}
+
+type pendingStop struct {
+    restart bool
+    at      time.Time
+    cancel  chan struct{}
+}
+
+func (p *pendingStop) verb() string {
+    if p.restart {
+        return "restarting"
+    }
+    return "shutting down"
+}
+
+// StopRequests delivers the exit code once a scheduled shutdown or restart
+// reaches zero.
+func (s *Server) StopRequests() <-chan int {
+    return s.stopRequests
+}
+
+// requireProcessControl rejects shutdown and restart on tenant servers: the
+// process only watches the default network's StopRequests, and one tenant
+// must not stop the others.
+func (s *Server) requireProcessControl() error {
+    if s.db.Tenant() != database.DefaultTenant {
+        return fmt.Errorf("shutdown and restart are only available on the default network")
+    }
+    return nil
+}
+
+func (s *Server) ScheduleStop(delay time.Duration, restart bool) error {
+    if err := s.requireProcessControl(); err != nil {
+        return err
+    }
+
+    s.stopMu.Lock()
+    defer s.stopMu.Unlock()
+
+    if s.pendingStop != nil {
+        return fmt.Errorf("server is already %s at %s", s.pendingStop.verb(), s.pendingStop.at.Format(time.RFC3339))
+    }
+
+    stop := &pendingStop{
+        restart: restart,
+        at:      time.Now().Add(delay),
+        cancel:  make(chan struct{}),
+    }
+    s.pendingStop = stop
+
+    go s.runStopCountdown(stop)
+
+    return nil
+}
+
+func (s *Server) CancelStop() error {
+    if err := s.requireProcessControl(); err != nil {
+        return err
+    }
+
+    s.stopMu.Lock()
+    defer s.stopMu.Unlock()
+
+    if s.pendingStop == nil {
+        return fmt.Errorf("no shutdown or restart is scheduled")
+    }
+    if s.draining {
+        return fmt.Errorf("server is already draining")
+    }
+
+    close(s.pendingStop.cancel)
+    s.pendingStop = nil
+
+    s.BroadcastNotice("Scheduled shutdown has been cancelled")
+    return nil
+}
+
+func (s *Server) runStopCountdown(stop *pendingStop) {
+    for {
+        remaining := time.Until(stop.at)
+        if remaining <= 0 {
+            break
+        }
+
+        s.BroadcastNotice(fmt.Sprintf("Server %s in %s", stop.verb(), remaining.Round(time.Second)))
+
+        next := time.Duration(0)
+        for _, mark := range stopAnnouncements {
+            if mark < remaining-time.Second {
+                next = mark
+                break
+            }
+        }
+
+        select {
+        case <-stop.cancel:
+            return
+        case <-time.After(remaining - next):
+        }
+    }
+
+    s.stopMu.Lock()
+    if s.pendingStop != stop {
+        s.stopMu.Unlock()
+        return
+    }
+    s.draining = true
+    s.stopMu.Unlock()
+
+    code := ExitShutdown
+    if stop.restart {
+        code = ExitRestart
+    }
+
+    log.Printf("Scheduled stop reached, %s", stop.verb())
+
+    select {
+    case s.stopRequests <- code:
+    default:
+    }
+}
+
+func (s *Server) isDraining() bool {
+    s.stopMu.Lock()
+    defer s.stopMu.Unlock()
+    return s.draining
+}
+
+func (s *Server) shutdownMessage() string {
+    s.stopMu.Lock()
+    defer s.stopMu.Unlock()
+
+    if s.pendingStop != nil && s.pendingStop.restart {
+        return "ERROR :Server restarting, please reconnect and RESUME your session"
+    }
+    return "ERROR :Server shutting down"
+}
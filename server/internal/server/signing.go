@@ -0,0 +1,65 @@
+package server
+
+import (
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/models"
+)
+
+// signChannelMessage stamps a relayed message with the server's signature.
+// The channel sequence number is the message ID, so messages without one
+// (sequencing unavailable) and servers without a signing key go unsigned.
+func (s *Server) signChannelMessage(channelName, author string, seq int64, sentAt time.Time, content string) string {
+    if s.signer == nil || seq <= 0 {
+        return ""
+    }
+
+    return s.signer.Sign(auth.Stamp{
+        MsgID:       strconv.FormatInt(seq, 10),
+        Channel:     channelName,
+        Author:      author,
+        Timestamp:   sentAt,
+        ContentHash: auth.HashMessage(content),
+    })
+}
+
+// stampTags returns the msgid, time and sig tags for clients that asked for
+// onyxirc/sig. Together with the channel, author and text of the line they
+// are everything needed to check the stamp. Clients that also negotiated
+// server-time get the time in its format, which names the same second.
+func (c *Client) stampTags(seq int64, sentAt time.Time, signature string) []string {
+    if signature == "" || !c.hasCap(capabilityPrefix+featureSigning) {
+        return nil
+    }
+
+    stamped := strconv.FormatInt(sentAt.Unix(), 10)
+    if c.hasCap(capServerTime) {
+        stamped = serverTime(sentAt)
+    }
+
+    return []string{
+        fmt.Sprintf("msgid=%d", seq),
+        "time=" + stamped,
+        "sig=" + signature,
+    }
+}
+
+func messageSignature(message *models.Message) string {
+    if message.Signature == nil {
+        return ""
+    }
+    return *message.Signature
+}
+
+func (c *Client) handleSignKey(parts []string) error {
+    if err := c.server.requireFeature(featureSigning); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s SIGNKEY ed25519 :%s", c.server.config.Server.ServerName, c.server.signer.PublicKey()))
+
+    return nil
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+)
+
+// parseSincePoint accepts msgid=<id>, or a timestamp as RFC 3339 or Unix
+// seconds, optionally prefixed with timestamp=.
+func parseSincePoint(value string) (int64, time.Time, error) {
+    if id, ok := strings.CutPrefix(value, "msgid="); ok {
+        messageID, err := strconv.ParseInt(id, 10, 64)
+        if err != nil || messageID < 0 {
+            return 0, time.Time{}, fmt.Errorf("invalid message ID: %s", id)
+        }
+        return messageID, time.Time{}, nil
+    }
+
+    value = strings.TrimPrefix(value, "timestamp=")
+
+    if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+        return 0, time.Unix(seconds, 0), nil
+    }
+
+    since, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        return 0, time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+    }
+    return 0, since, nil
+}
+
+func (c *Client) handleSince(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if err := c.server.requireFeature(featureHistory); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: SINCE <timestamp|msgid=<id>>")
+    }
+
+    afterID, since, err := parseSincePoint(parts[1])
+    if err != nil {
+        return err
+    }
+
+    messageRepo := database.NewMessageRepository(c.server.db)
+    if afterID > 0 {
+        since, err = messageRepo.GetSentAt(afterID)
+        if err != nil {
+            return err
+        }
+        // Messages sent in the same second as afterID are still wanted.
+        since = since.Add(-time.Second)
+    }
+
+    limit := c.server.config.Features.MaxMessageHistory
+    messages, err := messageRepo.ListForMember(c.user.UserID, afterID, since, limit)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    batch := fmt.Sprintf("since%d", time.Now().UnixNano())
+    channelRepo := database.NewChannelRepository(c.server.db)
+    channelNames := make(map[int64]string)
+    usernames := make(map[int64]string)
+
+    lines := []string{fmt.Sprintf(":%s BATCH +%s since %s", serverName, batch, parts[1])}
+
+    lastID := afterID
+    for _, message := range messages {
+        lastID = message.MessageID
+
+        channelName, exists := channelNames[message.ChannelID]
+        if !exists {
+            channel, err := channelRepo.GetByID(message.ChannelID)
+            if err != nil {
+                continue
+            }
+            channelName = channel.ChannelName
+            channelNames[message.ChannelID] = channelName
+        }
+
+        content, ok := c.server.readStoredMessage(message, channelName)
+        if !ok {
+            continue
+        }
+
+        lines = append(lines, c.withStoredTags(message, fmt.Sprintf(":%s HISTORY %s %s %d :%s",
+            serverName, channelName, c.server.cachedUsername(usernames, message.UserID), message.SentAt.Unix(), content)))
+    }
+
+    if c.server.featureEnabled(featureDirectMessages) {
+        counts, err := database.NewDirectMessageRepository(c.server.db).CountReceivedSince(c.user.UserID, since)
+        if err != nil {
+            return err
+        }
+
+        type dmCount struct {
+            sender string
+            count  int
+        }
+        summary := make([]dmCount, 0, len(counts))
+        for senderID, count := range counts {
+            summary = append(summary, dmCount{c.server.cachedUsername(usernames, senderID), count})
+        }
+        sort.Slice(summary, func(i, j int) bool { return summary[i].sender < summary[j].sender })
+
+        // DM content is never stored, so only the counts can be replayed.
+        for _, entry := range summary {
+            lines = append(lines, fmt.Sprintf(":%s NOTICE %s :%d direct message(s) from %s",
+                serverName, c.user.Username, entry.count, entry.sender))
+        }
+    }
+
+    lines = append(lines, fmt.Sprintf(":%s BATCH -%s", serverName, batch))
+
+    resume := fmt.Sprintf("msgid=%d", lastID)
+    if lastID == 0 {
+        resume = fmt.Sprintf("timestamp=%d", time.Now().Unix())
+    }
+
+    if len(messages) >= limit {
+        lines = append(lines, fmt.Sprintf(":%s NOTICE %s :Replay truncated after %d messages; continue with SINCE %s",
+            serverName, c.user.Username, len(messages), resume))
+    } else {
+        lines = append(lines, fmt.Sprintf(":%s NOTICE %s :End of replay; next time use SINCE %s",
+            serverName, c.user.Username, resume))
+    }
+    c.SendBatch(lines)
+
+    // A complete replay brings every channel in it up to date.
+    if len(messages) < limit {
+        for channelID := range channelNames {
+            c.markRead(channelID)
+        }
+    }
+
+    return nil
+}
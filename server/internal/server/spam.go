@@ -0,0 +1,262 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/onyxirc/server/internal/config"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/numerics"
+)
+
+type spamText struct {
+    text string
+    at   time.Time
+}
+
+type spamRecord struct {
+    texts      []spamText
+    dmTargets  map[string]time.Time
+    joins      []time.Time
+    strikes    []time.Time
+    mutedUntil time.Time
+    lastSeen   time.Time
+}
+
+// spamTracker keeps the recent activity each heuristic in SpamConfig looks
+// at, and the strikes and mutes it has handed out. It is kept in memory
+// only.
+type spamTracker struct {
+    mu        sync.Mutex
+    users     map[int64]*spamRecord
+    lastSweep time.Time
+}
+
+func newSpamTracker() *spamTracker {
+    return &spamTracker{
+        users:     make(map[int64]*spamRecord),
+        lastSweep: time.Now(),
+    }
+}
+
+func (t *spamTracker) record(userID int64, now time.Time) *spamRecord {
+    t.sweep(now)
+
+    r, ok := t.users[userID]
+    if !ok {
+        r = &spamRecord{dmTargets: make(map[string]time.Time)}
+        t.users[userID] = r
+    }
+    r.lastSeen = now
+    return r
+}
+
+// message records a PRIVMSG and reports whether it is one identical
+// message too many. Case and surrounding space are ignored.
+func (t *spamTracker) message(userID int64, text string, cfg config.SpamConfig) bool {
+    if cfg.RepeatMessages <= 0 || cfg.RepeatWindow <= 0 {
+        return false
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    r := t.record(userID, now)
+    text = strings.ToLower(strings.TrimSpace(text))
+
+    recent := r.texts[:0]
+    repeats := 0
+    for _, previous := range r.texts {
+        if now.Sub(previous.at) > cfg.RepeatWindow {
+            continue
+        }
+        recent = append(recent, previous)
+        if previous.text == text {
+            repeats++
+        }
+    }
+    r.texts = append(recent, spamText{text: text, at: now})
+
+    if repeats+1 > cfg.RepeatMessages {
+        r.texts = nil
+        return true
+    }
+    return false
+}
+
+// directMessage records a DM and reports whether the sender has now
+// messaged too many different users.
+func (t *spamTracker) directMessage(userID int64, target string, cfg config.SpamConfig) bool {
+    if cfg.DMTargets <= 0 || cfg.DMWindow <= 0 {
+        return false
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    r := t.record(userID, now)
+
+    for name, at := range r.dmTargets {
+        if now.Sub(at) > cfg.DMWindow {
+            delete(r.dmTargets, name)
+        }
+    }
+    r.dmTargets[strings.ToLower(target)] = now
+
+    if len(r.dmTargets) > cfg.DMTargets {
+        r.dmTargets = make(map[string]time.Time)
+        return true
+    }
+    return false
+}
+
+// join records a JOIN and reports whether it is one join too many.
+func (t *spamTracker) join(userID int64, cfg config.SpamConfig) bool {
+    if cfg.Joins <= 0 || cfg.JoinWindow <= 0 {
+        return false
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    r := t.record(userID, now)
+
+    r.joins = append(pruneBefore(r.joins, now.Add(-cfg.JoinWindow)), now)
+    if len(r.joins) > cfg.Joins {
+        r.joins = nil
+        return true
+    }
+    return false
+}
+
+// strike adds a strike and returns how many the user has within window.
+func (t *spamTracker) strike(userID int64, window time.Duration) int {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    now := time.Now()
+    r := t.record(userID, now)
+
+    r.strikes = append(pruneBefore(r.strikes, now.Add(-window)), now)
+    return len(r.strikes)
+}
+
+func (t *spamTracker) mute(userID int64, until time.Time) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.record(userID, time.Now()).mutedUntil = until
+}
+
+func (t *spamTracker) mutedFor(userID int64) time.Duration {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    r, ok := t.users[userID]
+    if !ok {
+        return 0
+    }
+    if remaining := time.Until(r.mutedUntil); remaining > 0 {
+        return remaining
+    }
+    return 0
+}
+
+// sweep drops users with no activity in the last day and no mute left.
+// The caller holds t.mu.
+func (t *spamTracker) sweep(now time.Time) {
+    if now.Sub(t.lastSweep) < time.Minute {
+        return
+    }
+    t.lastSweep = now
+
+    for userID, r := range t.users {
+        if now.Sub(r.lastSeen) > 24*time.Hour && now.After(r.mutedUntil) {
+            delete(t.users, userID)
+        }
+    }
+}
+
+// checkSpamMessage applies the spam mute and the repeated message and mass
+// DM heuristics to a PRIVMSG. Admins are exempt.
+func (c *Client) checkSpamMessage(target, text string) error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    spam := c.server.spam
+    if remaining := spam.mutedFor(c.user.UserID); remaining > 0 {
+        reason := fmt.Sprintf("muted for spam for %s", remaining.Round(time.Second))
+        if target[0] == '#' {
+            return numerics.CannotSendToChan(target, reason)
+        }
+        return fmt.Errorf("you are %s", reason)
+    }
+
+    cfg := c.server.config.Spam
+    if spam.message(c.user.UserID, text, cfg) {
+        return c.penalizeSpam("repeated identical messages")
+    }
+    if target[0] != '#' && spam.directMessage(c.user.UserID, target, cfg) {
+        return c.penalizeSpam("messaging many users at once")
+    }
+    return nil
+}
+
+func (c *Client) checkSpamJoin() error {
+    if c.user.IsAdmin {
+        return nil
+    }
+
+    if c.server.spam.join(c.user.UserID, c.server.config.Spam) {
+        return c.penalizeSpam("rapid channel joins")
+    }
+    return nil
+}
+
+// penalizeSpam gives the user a strike and escalates: a warning, then a
+// mute, then a temporary ban. Every step goes to the admin action log with
+// the "auto" actor and to admins with SNOMASK +s. It returns an error when
+// the triggering command should be refused.
+func (c *Client) penalizeSpam(reason string) error {
+    s := c.server
+    cfg := s.config.Spam
+    userID, username := c.user.UserID, c.user.Username
+
+    strikes := s.spam.strike(userID, cfg.StrikeWindow)
+
+    switch {
+    case strikes == 1:
+        c.Send(fmt.Sprintf(":%s NOTICE %s :Warning: %s looks like spam; keep it up and you will be muted",
+            s.config.Server.ServerName, username, reason))
+        s.adminService.RecordAutoAction("spam_warn", userID, fmt.Sprintf("Warned %s: %s", username, reason))
+        s.serverNotice('s', fmt.Sprintf("Spam warning for %s: %s", username, reason))
+        log.Printf("Spam warning for %s: %s", username, reason)
+        return nil
+
+    case strikes == 2 || cfg.BanDuration <= 0:
+        s.spam.mute(userID, time.Now().Add(cfg.MuteDuration))
+        c.Send(fmt.Sprintf(":%s NOTICE %s :You have been muted for %s: %s",
+            s.config.Server.ServerName, username, cfg.MuteDuration, reason))
+        s.adminService.RecordAutoAction("spam_mute", userID, fmt.Sprintf("Muted %s for %s: %s", username, cfg.MuteDuration, reason))
+        s.serverNotice('s', fmt.Sprintf("Muted %s for %s: %s", username, cfg.MuteDuration, reason))
+        log.Printf("Muted %s for spam for %s: %s", username, cfg.MuteDuration, reason)
+        return fmt.Errorf("muted for spam for %s", cfg.MuteDuration)
+
+    default:
+        banReason := "spam: " + reason
+        if err := s.adminService.AutoBan(userID, username, banReason, cfg.BanDuration); err != nil {
+            return err
+        }
+        s.EnforceBan(database.AutoActor, username, banReason, int(cfg.BanDuration/time.Second))
+        s.serverNotice('s', fmt.Sprintf("Banned %s for %s: %s", username, cfg.BanDuration, reason))
+        log.Printf("Banned %s for spam for %s: %s", username, cfg.BanDuration, reason)
+        return fmt.Errorf("banned for spam for %s", cfg.BanDuration)
+    }
+}
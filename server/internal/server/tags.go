@@ -0,0 +1,152 @@
+package server
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// IRCv3 capabilities. Unlike the onyxirc/ ones they are not features that
+// can be switched off; they are offered whenever the client's protocol
+// version has message tags.
+const (
+    capMessageTags = "message-tags"
+    capServerTime  = "server-time"
+)
+
+// serverTime formats t as the IRCv3 server-time tag wants it.
+func serverTime(t time.Time) string {
+    return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// messageTags returns the time and msgid tags of a message for a client
+// that negotiated server-time and message-tags.
+func (c *Client) messageTags(msgID string, sentAt time.Time) []string {
+    var tags []string
+    if !sentAt.IsZero() && c.hasCap(capServerTime) {
+        tags = append(tags, "time="+serverTime(sentAt))
+    }
+    if msgID != "" && c.hasCap(capMessageTags) {
+        tags = append(tags, "msgid="+msgID)
+    }
+    return tags
+}
+
+// withMessageTags prefixes line with the client's message tags.
+func (c *Client) withMessageTags(msgID string, sentAt time.Time, line string) string {
+    return prefixTags(c.messageTags(msgID, sentAt), line)
+}
+
+// seqMsgID is the msgid of a channel message: its sequence number, as in
+// the onyxirc/sig stamp.
+func seqMsgID(seq int64) string {
+    if seq <= 0 {
+        return ""
+    }
+    return strconv.FormatInt(seq, 10)
+}
+
+// newMsgID returns a msgid for a message without a sequence number, such
+// as a direct message.
+func newMsgID() string {
+    buf := make([]byte, 12)
+    if _, err := rand.Read(buf); err != nil {
+        return ""
+    }
+    return hex.EncodeToString(buf)
+}
+
+// message is a line from a client split into its parts. The command is
+// params[0], so handlers keep indexing params as they did the fields of
+// the line.
+type message struct {
+    tags   map[string]string
+    source string
+    params []string
+}
+
+// parseMessage splits off the line's tags and source. With trailing set
+// the text after " :" is a single param; otherwise the line is split on
+// whitespace and handlers join the trailing words back together.
+func parseMessage(line string, trailing bool) message {
+    var msg message
+
+    line = strings.TrimLeft(line, " ")
+    if strings.HasPrefix(line, "@") {
+        raw, rest := cutWord(line[1:])
+        msg.tags = parseTags(raw)
+        line = rest
+    }
+
+    if strings.HasPrefix(line, ":") {
+        msg.source, line = cutWord(line[1:])
+    }
+
+    if !trailing {
+        msg.params = strings.Fields(line)
+        return msg
+    }
+
+    text := ""
+    hasTrailing := false
+    if strings.HasPrefix(line, ":") {
+        text, line, hasTrailing = line[1:], "", true
+    } else if i := strings.Index(line, " :"); i >= 0 {
+        text, line, hasTrailing = line[i+2:], line[:i], true
+    }
+
+    msg.params = strings.Fields(line)
+    if hasTrailing {
+        msg.params = append(msg.params, ":"+text)
+    }
+    return msg
+}
+
+func cutWord(s string) (string, string) {
+    if i := strings.IndexByte(s, ' '); i >= 0 {
+        return s[:i], strings.TrimLeft(s[i+1:], " ")
+    }
+    return s, ""
+}
+
+func parseTags(raw string) map[string]string {
+    tags := make(map[string]string)
+    for _, tag := range strings.Split(raw, ";") {
+        if tag == "" {
+            continue
+        }
+        key, value, _ := strings.Cut(tag, "=")
+        tags[key] = unescapeTagValue(value)
+    }
+    return tags
+}
+
+var tagEscapes = map[byte]byte{':': ';', 's': ' ', '\\': '\\', 'r': '\r', 'n': '\n'}
+
+// unescapeTagValue reverses IRCv3 tag escaping. An unknown escape stands
+// for the character itself and a lone trailing backslash is dropped.
+func unescapeTagValue(value string) string {
+    if !strings.Contains(value, `\`) {
+        return value
+    }
+
+    var b strings.Builder
+    for i := 0; i < len(value); i++ {
+        if value[i] != '\\' {
+            b.WriteByte(value[i])
+            continue
+        }
+        i++
+        if i == len(value) {
+            break
+        }
+        if unescaped, ok := tagEscapes[value[i]]; ok {
+            b.WriteByte(unescaped)
+        } else {
+            b.WriteByte(value[i])
+        }
+    }
+    return b.String()
+}
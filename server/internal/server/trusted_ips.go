@@ -0,0 +1,161 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/models"
+    "github.com/onyxirc/server/internal/security"
+)
+
+// Users may not trust networks wider than these on their own; admins can.
+const (
+    minTrustedPrefixV4 = 16
+    minTrustedPrefixV6 = 32
+)
+
+// handleTrustIP manages the caller's trusted addresses: logins from them
+// never raise IP suspicion.
+func (c *Client) handleTrustIP(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: TRUSTIP <ADD <address|cidr> [note]|DEL <address|cidr>|LIST>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    tracking := c.server.ipTrackingService
+
+    switch strings.ToUpper(parts[1]) {
+    case "ADD":
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: TRUSTIP ADD <address|cidr> [note]")
+        }
+
+        network, err := security.ParseCIDR(parts[2])
+        if err != nil {
+            return err
+        }
+        ones, bits := network.Mask.Size()
+        if (bits == 32 && ones < minTrustedPrefixV4) || (bits == 128 && ones < minTrustedPrefixV6) {
+            return fmt.Errorf("%s is too wide; ask an administrator to trust networks wider than /%d (IPv4) or /%d (IPv6)",
+                network.String(), minTrustedPrefixV4, minTrustedPrefixV6)
+        }
+
+        cidr, err := tracking.TrustIP(c.user.UserID, parts[2], strings.Join(parts[3:], " "), nil)
+        if err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s is now trusted; logins from it will not count as IP changes", serverName, c.user.Username, cidr))
+        log.Printf("User %s trusted %s", c.user.Username, cidr)
+    case "DEL":
+        if len(parts) < 3 {
+            return fmt.Errorf("usage: TRUSTIP DEL <address|cidr>")
+        }
+
+        cidr, err := tracking.UntrustIP(c.user.UserID, parts[2])
+        if err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s is no longer trusted", serverName, c.user.Username, cidr))
+        log.Printf("User %s stopped trusting %s", c.user.Username, cidr)
+    case "LIST":
+        return c.listTrustedIPs(c.user)
+    default:
+        return fmt.Errorf("usage: TRUSTIP <ADD <address|cidr> [note]|DEL <address|cidr>|LIST>")
+    }
+
+    return nil
+}
+
+// handleAdminTrustIP manages another user's trusted addresses, without the
+// limit on network size. Changes are written to the admin action log.
+func (c *Client) handleAdminTrustIP(args []string) error {
+    if err := c.server.adminService.RequireAdmin(c.user.UserID); err != nil {
+        return err
+    }
+
+    if len(args) < 2 {
+        return fmt.Errorf("usage: ADMIN trustip <username> <add <address|cidr> [note]|del <address|cidr>|list>")
+    }
+
+    target, err := c.server.authService.GetUserByUsername(args[0])
+    if err != nil {
+        return fmt.Errorf("user not found: %s", args[0])
+    }
+
+    serverName := c.server.config.Server.ServerName
+    tracking := c.server.ipTrackingService
+
+    switch strings.ToLower(args[1]) {
+    case "add":
+        if len(args) < 3 {
+            return fmt.Errorf("usage: ADMIN trustip <username> add <address|cidr> [note]")
+        }
+
+        cidr, err := tracking.TrustIP(target.UserID, args[2], strings.Join(args[3:], " "), &c.user.UserID)
+        if err != nil {
+            return err
+        }
+        if err := c.server.adminService.RecordAction(c.user.UserID, "trustip", fmt.Sprintf("Trusted %s for %s", cidr, target.Username)); err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s is now trusted for %s", serverName, c.user.Username, cidr, target.Username))
+        log.Printf("Admin %s trusted %s for %s", c.user.Username, cidr, target.Username)
+    case "del":
+        if len(args) < 3 {
+            return fmt.Errorf("usage: ADMIN trustip <username> del <address|cidr>")
+        }
+
+        cidr, err := tracking.UntrustIP(target.UserID, args[2])
+        if err != nil {
+            return err
+        }
+        if err := c.server.adminService.RecordAction(c.user.UserID, "untrustip", fmt.Sprintf("Stopped trusting %s for %s", cidr, target.Username)); err != nil {
+            return err
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s is no longer trusted for %s", serverName, c.user.Username, cidr, target.Username))
+        log.Printf("Admin %s stopped trusting %s for %s", c.user.Username, cidr, target.Username)
+    case "list":
+        return c.listTrustedIPs(target)
+    default:
+        return fmt.Errorf("usage: ADMIN trustip <username> <add <address|cidr> [note]|del <address|cidr>|list>")
+    }
+
+    return nil
+}
+
+func (c *Client) listTrustedIPs(user *models.User) error {
+    trusted, err := c.server.ipTrackingService.ListTrustedIPs(user.UserID)
+    if err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    c.Send(fmt.Sprintf(":%s NOTICE %s :=== Trusted addresses of %s (%d) ===", serverName, c.user.Username, user.Username, len(trusted)))
+
+    for _, entry := range trusted {
+        source := "self"
+        if entry.AddedBy != nil {
+            source = "admin"
+        }
+
+        note := ""
+        if entry.Note != nil {
+            note = " - " + *entry.Note
+        }
+
+        c.Send(fmt.Sprintf(":%s NOTICE %s :%s (added %s by %s)%s",
+            serverName, c.user.Username, entry.CIDR, entry.CreatedAt.Format(time.RFC3339), source, note))
+    }
+
+    return nil
+}
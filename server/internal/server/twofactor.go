@@ -0,0 +1,249 @@
+package server
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/auth"
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+const (
+    secondFactorWindow      = 2 * time.Minute
+    maxSecondFactorAttempts = 3
+)
+
+// pendingLogin is a login whose password was accepted but which still
+// needs AUTH TOTP before a session is created.
+type pendingLogin struct {
+    user      *models.User
+    ipAddress string
+    expires   time.Time
+    failures  int
+}
+
+func (s *Server) twoFactorRequired(userID int64) (bool, error) {
+    record, err := database.NewTwoFactorRepository(s.db).Get(userID)
+    if err != nil {
+        return false, err
+    }
+    return record != nil && record.IsEnabled, nil
+}
+
+func (s *Server) sealTOTPSecret(secret string) (string, error) {
+    return auth.EncryptWithPublicKey(s.cryptoManager.GetPublicKey(), []byte(secret))
+}
+
+// checkTOTP verifies code against the user's stored secret and consumes its
+// time step, so the same code is not accepted twice.
+func (s *Server) checkTOTP(record *models.TwoFactor, code string) error {
+    secret, err := s.cryptoManager.DecryptWithPrivateKey(record.SecretEncrypted)
+    if err != nil {
+        return fmt.Errorf("failed to decrypt 2FA secret: %w", err)
+    }
+    defer auth.Zero(secret)
+
+    step, ok := auth.VerifyTOTP(string(secret), code, time.Now())
+    if !ok {
+        return fmt.Errorf("invalid authentication code")
+    }
+
+    if !record.IsEnabled {
+        return database.NewTwoFactorRepository(s.db).Enable(record.UserID, step)
+    }
+
+    fresh, err := database.NewTwoFactorRepository(s.db).UseStep(record.UserID, step)
+    if err != nil {
+        return err
+    }
+    if !fresh {
+        return fmt.Errorf("authentication code already used")
+    }
+
+    return nil
+}
+
+func (c *Client) requestSecondFactor(user *models.User, ipAddress string) {
+    c.pendingLogin = &pendingLogin{
+        user:      user,
+        ipAddress: ipAddress,
+        expires:   time.Now().Add(secondFactorWindow),
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Two-factor authentication required. Send AUTH TOTP <code> within %s",
+        c.server.config.Server.ServerName, user.Username, secondFactorWindow))
+}
+
+// handleAuth completes a LOGIN that is waiting for a second factor. Wrong
+// codes count as failed logins; after maxSecondFactorAttempts the pending
+// login is dropped and the client has to LOGIN again.
+func (c *Client) handleAuth(parts []string) error {
+    if c.authenticated {
+        return fmt.Errorf("already authenticated")
+    }
+
+    if len(parts) < 3 || !strings.EqualFold(parts[1], "TOTP") {
+        return fmt.Errorf("usage: AUTH TOTP <code>")
+    }
+
+    pending := c.pendingLogin
+    if pending == nil {
+        return fmt.Errorf("no login is waiting for a second factor")
+    }
+
+    if time.Now().After(pending.expires) {
+        c.pendingLogin = nil
+        return fmt.Errorf("login failed: second factor timed out, please LOGIN again")
+    }
+
+    record, err := database.NewTwoFactorRepository(c.server.db).Get(pending.user.UserID)
+    if err != nil {
+        return fmt.Errorf("login failed: %w", err)
+    }
+    if record == nil || !record.IsEnabled {
+        c.pendingLogin = nil
+        return c.completeLogin(pending.user, pending.ipAddress)
+    }
+
+    if err := c.server.checkTOTP(record, parts[2]); err != nil {
+        pending.failures++
+        if lockErr := c.server.authService.RecordSecondFactorFailure(pending.user, pending.ipAddress); lockErr != nil {
+            c.pendingLogin = nil
+            return fmt.Errorf("login failed: %w", lockErr)
+        }
+        if pending.failures >= maxSecondFactorAttempts {
+            c.pendingLogin = nil
+            return fmt.Errorf("login failed: %v; too many attempts, please LOGIN again", err)
+        }
+        return fmt.Errorf("login failed: %w", err)
+    }
+
+    c.pendingLogin = nil
+    return c.completeLogin(pending.user, pending.ipAddress)
+}
+
+// handleEnable2FA generates a new secret and sends its provisioning URI.
+// 2FA is only enforced once VERIFY2FA confirms the authenticator works.
+func (c *Client) handleEnable2FA(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    repo := database.NewTwoFactorRepository(c.server.db)
+
+    record, err := repo.Get(c.user.UserID)
+    if err != nil {
+        return err
+    }
+    if record != nil && record.IsEnabled {
+        return fmt.Errorf("two-factor authentication is already enabled")
+    }
+
+    secret, err := auth.GenerateTOTPSecret()
+    if err != nil {
+        return err
+    }
+
+    sealed, err := c.server.sealTOTPSecret(secret)
+    if err != nil {
+        return fmt.Errorf("failed to encrypt 2FA secret: %w", err)
+    }
+
+    if err := repo.SavePending(c.user.UserID, sealed); err != nil {
+        return err
+    }
+
+    serverName := c.server.config.Server.ServerName
+    uri := auth.TOTPProvisioningURI(serverName, c.user.Username, secret)
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Add this account to your authenticator app (scan the URI as a QR code or enter the secret)", serverName, c.user.Username))
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Secret: %s", serverName, c.user.Username, secret))
+    c.Send(fmt.Sprintf(":%s NOTICE %s :URI: %s", serverName, c.user.Username, uri))
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Then confirm with VERIFY2FA <code>", serverName, c.user.Username))
+
+    return nil
+}
+
+func (c *Client) handleVerify2FA(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: VERIFY2FA <code>")
+    }
+
+    record, err := database.NewTwoFactorRepository(c.server.db).Get(c.user.UserID)
+    if err != nil {
+        return err
+    }
+    if record == nil {
+        return fmt.Errorf("run ENABLE2FA first")
+    }
+    if record.IsEnabled {
+        return fmt.Errorf("two-factor authentication is already enabled")
+    }
+
+    if err := c.server.checkTOTP(record, parts[1]); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Two-factor authentication enabled", c.server.config.Server.ServerName, c.user.Username))
+    log.Printf("User %s enabled two-factor authentication", c.user.Username)
+
+    return nil
+}
+
+func (c *Client) handleDisable2FA(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: DISABLE2FA <code>")
+    }
+
+    repo := database.NewTwoFactorRepository(c.server.db)
+
+    record, err := repo.Get(c.user.UserID)
+    if err != nil {
+        return err
+    }
+    if record == nil || !record.IsEnabled {
+        return fmt.Errorf("two-factor authentication is not enabled")
+    }
+
+    if err := c.server.checkTOTP(record, parts[1]); err != nil {
+        return err
+    }
+
+    if _, err := repo.Delete(c.user.UserID); err != nil {
+        return err
+    }
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Two-factor authentication disabled", c.server.config.Server.ServerName, c.user.Username))
+    log.Printf("User %s disabled two-factor authentication", c.user.Username)
+
+    return nil
+}
+
+func (c *Client) handleAdminDisable2FA(args []string) error {
+    if len(args) < 1 {
+        return fmt.Errorf("usage: ADMIN disable2fa <username>")
+    }
+
+    user, err := c.server.adminService.DisableTwoFactor(c.user.UserID, args[0])
+    if err != nil {
+        return err
+    }
+
+    c.server.noticeUser(user.UserID, "Two-factor authentication was disabled by an administrator")
+
+    c.Send(fmt.Sprintf(":%s NOTICE %s :Two-factor authentication disabled for %s", c.server.config.Server.ServerName, c.user.Username, user.Username))
+    log.Printf("Admin %s disabled two-factor authentication for %s", c.user.Username, user.Username)
+
+    return nil
+}
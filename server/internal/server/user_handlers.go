@@ -0,0 +1,236 @@
+package server
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/onyxirc/server/internal/database"
+    "github.com/onyxirc/server/internal/models"
+)
+
+func (c *Client) handleWhois(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: WHOIS <nick>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    nick := parts[1]
+
+    target, err := c.server.authService.GetUserByUsername(nick)
+    if err != nil {
+        c.Send(fmt.Sprintf(":%s 401 %s %s :No such nick", serverName, c.user.Username, nick))
+        return nil
+    }
+
+    isAdmin, _ := c.server.adminService.IsAdmin(c.user.UserID)
+
+    sessions := c.server.clientsForUser(target.UserID)
+
+    host := "*"
+    if len(sessions) > 0 {
+        host = sessions[0].Host()
+        if isAdmin {
+            host = sessions[0].GetIPAddress()
+        }
+    }
+
+    c.Send(fmt.Sprintf(":%s 311 %s %s %s %s * :%s", serverName, c.user.Username, target.Username, target.Username, host, target.Username))
+
+    channelRepo := database.NewChannelRepository(c.server.db)
+    targetChannels, err := channelRepo.GetUserChannels(target.UserID)
+    if err == nil {
+        var common []string
+        for _, channel := range targetChannels {
+            if c.IsInChannel(channel.ChannelID) {
+                common = append(common, channel.ChannelName)
+            }
+        }
+        if len(common) > 0 {
+            c.Send(fmt.Sprintf(":%s 319 %s %s :%s", serverName, c.user.Username, target.Username, strings.Join(common, " ")))
+        }
+    }
+
+    if awayMessage, away := c.server.awayMessage(target.UserID); away {
+        c.Send(fmt.Sprintf(":%s 301 %s %s :%s", serverName, c.user.Username, target.Username, awayMessage))
+    }
+
+    if target.IsAdmin {
+        c.Send(fmt.Sprintf(":%s 313 %s %s :is a server administrator", serverName, c.user.Username, target.Username))
+    }
+
+    if target.IsBot {
+        c.Send(botReply(serverName, c.user.Username, target.Username))
+    }
+
+    accountAge := int(time.Since(target.CreatedAt).Hours() / 24)
+    c.Send(fmt.Sprintf(":%s 320 %s %s :registered %s (%d days ago)",
+        serverName, c.user.Username, target.Username, target.CreatedAt.Format("2006-01-02"), accountAge))
+
+    if len(sessions) > 0 {
+        idle := sessions[0].IdleDuration()
+        signon := sessions[0].connectedAt
+        for _, session := range sessions[1:] {
+            if sessionIdle := session.IdleDuration(); sessionIdle < idle {
+                idle = sessionIdle
+            }
+            if session.connectedAt.Before(signon) {
+                signon = session.connectedAt
+            }
+        }
+        c.Send(fmt.Sprintf(":%s 317 %s %s %d %d :seconds idle, signon time",
+            serverName, c.user.Username, target.Username, int64(idle.Seconds()), signon.Unix()))
+    } else {
+        lastSeen := "never"
+        if target.LastLoginTime != nil {
+            lastSeen = target.LastLoginTime.Format(time.RFC3339)
+        }
+        c.Send(fmt.Sprintf(":%s 320 %s %s :is offline (last login %s)", serverName, c.user.Username, target.Username, lastSeen))
+    }
+
+    if isAdmin {
+        securityRepo := database.NewSecurityRepository(c.server.db)
+        status, err := securityRepo.GetSecurityStatus(target.UserID)
+        if err == nil {
+            lastIP := "unknown"
+            if status.LastKnownIP != nil {
+                lastIP = *status.LastKnownIP
+            }
+            c.Send(fmt.Sprintf(":%s 338 %s %s %s :last known IP", serverName, c.user.Username, target.Username, lastIP))
+
+            lockStatus := "unlocked"
+            if status.AccountLocked {
+                lockStatus = "locked"
+                if status.LockReason != nil {
+                    lockStatus = fmt.Sprintf("locked (%s)", *status.LockReason)
+                }
+            }
+            c.Send(fmt.Sprintf(":%s 320 %s %s :IP suspicion count %d, account %s",
+                serverName, c.user.Username, target.Username, status.IPSuspicionCount, lockStatus))
+        }
+
+        for _, session := range sessions {
+            if len(session.dnsblListings) == 0 {
+                continue
+            }
+            zones := make([]string, 0, len(session.dnsblListings))
+            for _, listing := range session.dnsblListings {
+                zones = append(zones, listing.Zone)
+            }
+            c.Send(fmt.Sprintf(":%s 320 %s %s :connected from %s, listed on %s",
+                serverName, c.user.Username, target.Username, session.GetIPAddress(), strings.Join(zones, ", ")))
+        }
+    }
+
+    c.Send(fmt.Sprintf(":%s 318 %s %s :End of WHOIS list", serverName, c.user.Username, target.Username))
+
+    return nil
+}
+
+func (c *Client) handleAway(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    message := ""
+    if len(parts) > 1 {
+        message = strings.TrimPrefix(strings.Join(parts[1:], " "), ":")
+    }
+
+    c.awayMu.Lock()
+    c.awayMessage = message
+    c.awayMu.Unlock()
+
+    serverName := c.server.config.Server.ServerName
+    if message == "" {
+        c.Send(fmt.Sprintf(":%s 305 %s :You are no longer marked as being away", serverName, c.user.Username))
+    } else {
+        c.Send(fmt.Sprintf(":%s 306 %s :You have been marked as being away", serverName, c.user.Username))
+    }
+
+    return nil
+}
+
+func (c *Client) handleWho(parts []string) error {
+    if err := c.requireAuth(); err != nil {
+        return err
+    }
+
+    if len(parts) < 2 {
+        return fmt.Errorf("usage: WHO <channel|nick>")
+    }
+
+    serverName := c.server.config.Server.ServerName
+    mask := parts[1]
+    var lines []string
+
+    if strings.HasPrefix(mask, "#") {
+        channelRepo := database.NewChannelRepository(c.server.db)
+
+        channel, err := channelRepo.GetByName(mask)
+        if err != nil {
+            return fmt.Errorf("channel not found: %s", mask)
+        }
+
+        members, err := channelRepo.GetMembers(channel.ChannelID)
+        if err != nil {
+            return fmt.Errorf("failed to get channel members: %w", err)
+        }
+
+        for _, member := range members {
+            user, err := c.server.authService.GetUserByID(member.UserID)
+            if err != nil || !c.server.userOnline(user.UserID) {
+                continue
+            }
+
+            prefix := ""
+            if member.Role == "owner" {
+                prefix = "@"
+            } else if member.Role == "moderator" {
+                prefix = "+"
+            }
+            lines = append(lines, c.whoReply(mask, user, prefix))
+        }
+
+        for _, member := range c.server.remoteMembers(mask) {
+            lines = append(lines, c.remoteWhoReply(mask, member))
+        }
+    } else {
+        if target, err := c.server.authService.GetUserByUsername(mask); err == nil {
+            if c.server.userOnline(target.UserID) {
+                lines = append(lines, c.whoReply("*", target, ""))
+            }
+        }
+
+        for _, member := range c.server.remoteUsers(mask) {
+            lines = append(lines, c.remoteWhoReply("*", member))
+        }
+    }
+
+    lines = append(lines, fmt.Sprintf(":%s 315 %s %s :End of WHO list", serverName, c.user.Username, mask))
+    c.SendBatch(lines)
+
+    return nil
+}
+
+func (c *Client) whoReply(channelName string, user *models.User, prefix string) string {
+    username := user.Username
+    flags := "H"
+    if _, away := c.server.awayMessage(user.UserID); away {
+        flags = "G"
+    }
+    if user.IsAdmin {
+        flags += "*"
+    }
+    if user.IsBot {
+        flags += "B"
+    }
+
+    return fmt.Sprintf(":%s 352 %s %s %s * %s %s %s%s :0 %s",
+        c.server.config.Server.ServerName, c.user.Username, channelName, username,
+        c.server.config.Server.ServerName, username, flags, prefix, username)
+}
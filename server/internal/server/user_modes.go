@@ -0,0 +1,116 @@
+package server
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/onyxirc/server/internal/security"
+)
+
+// userModeDescriptions lists the user modes a client may hold. +o mirrors
+// admin status and +B bot accounts; both are set by the server, never
+// through MODE.
+var userModeDescriptions = map[rune]string{
+    'B': "bot",
+    'o': "server administrator",
+    'x': "cloaked host",
+}
+
+func (c *Client) handleUserMode(target string, args []string) error {
+    serverName := c.server.config.Server.ServerName
+
+    if !strings.EqualFold(target, c.user.Username) {
+        return fmt.Errorf("cannot view or change modes of other users")
+    }
+
+    if len(args) == 0 {
+        c.Send(fmt.Sprintf(":%s 221 %s %s", serverName, c.user.Username, c.UserModes()))
+        return nil
+    }
+
+    oldHost := c.Host()
+
+    var change modeChange
+    sign := '+'
+    for _, mode := range args[0] {
+        switch mode {
+        case '+', '-':
+            sign = mode
+            continue
+        case 'x':
+            if sign == '+' && c.server.config.Security.CloakSecret == "" {
+                return fmt.Errorf("host cloaking is not enabled on this server")
+            }
+        case 'o', 'B':
+            return fmt.Errorf("user mode %c is set by the server", mode)
+        default:
+            return fmt.Errorf("unknown user mode: %c", mode)
+        }
+
+        if c.hasUserMode(mode) != (sign == '+') {
+            c.setUserMode(mode, sign == '+')
+            change.add(sign, mode, "")
+        }
+    }
+
+    if change.flags == "" {
+        return nil
+    }
+
+    c.Send(fmt.Sprintf(":%s!%s@%s MODE %s :%s", c.user.Username, c.user.Username, oldHost, c.user.Username, change.String()))
+
+    if host := c.Host(); host != oldHost {
+        c.Send(fmt.Sprintf(":%s 396 %s %s :is now your displayed host", serverName, c.user.Username, host))
+    }
+
+    return nil
+}
+
+// initUserModes sets the modes a client starts with after login or resume.
+// Hosts are cloaked by default whenever a cloak secret is configured.
+func (c *Client) initUserModes() {
+    c.setUserMode('x', c.server.config.Security.CloakSecret != "")
+}
+
+func (c *Client) UserModes() string {
+    c.userModeMu.RLock()
+    defer c.userModeMu.RUnlock()
+
+    var modes []string
+    for mode := range userModeDescriptions {
+        if c.userModes[mode] || (mode == 'o' && c.user.IsAdmin) || (mode == 'B' && c.user.IsBot) {
+            modes = append(modes, string(mode))
+        }
+    }
+    sort.Strings(modes)
+    return "+" + strings.Join(modes, "")
+}
+
+func (c *Client) hasUserMode(mode rune) bool {
+    c.userModeMu.RLock()
+    defer c.userModeMu.RUnlock()
+
+    return c.userModes[mode]
+}
+
+func (c *Client) setUserMode(mode rune, enabled bool) {
+    c.userModeMu.Lock()
+    defer c.userModeMu.Unlock()
+
+    if enabled {
+        c.userModes[mode] = true
+    } else {
+        delete(c.userModes, mode)
+    }
+}
+
+// Host is the host shown to other users in message prefixes: the cloak
+// while +x is set, the connecting address otherwise.
+func (c *Client) Host() string {
+    secret := c.server.config.Security.CloakSecret
+    if secret != "" && c.hasUserMode('x') {
+        return security.CloakHost(secret, c.GetIPAddress())
+    }
+    return c.GetIPAddress()
+}
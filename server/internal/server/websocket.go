@@ -0,0 +1,333 @@
+package server
+
+import (
+    "bufio"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+    "unicode/utf8"
+)
+
+const (
+    websocketGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+    websocketMaxPayload = 1 << 20
+
+    // websocketHandshakeTimeout bounds how long a client may take to send
+    // the headers of its upgrade request.
+    websocketHandshakeTimeout = 10 * time.Second
+
+    websocketOpContinuation = 0x0
+    websocketOpText         = 0x1
+    websocketOpBinary       = 0x2
+    websocketOpClose        = 0x8
+    websocketOpPing         = 0x9
+    websocketOpPong         = 0xA
+)
+
+type websocketListener struct {
+    listener     net.Listener
+    server       *http.Server
+    path         string
+    forwardedFor bool
+    trusted      trustedProxies
+    conns        chan net.Conn
+    closed       chan struct{}
+    once         sync.Once
+}
+
+// newWebSocketListener serves WebSocket upgrades on path. With forwardedFor
+// the client address is taken from the X-Forwarded-For header of requests
+// that come from a trusted proxy.
+func newWebSocketListener(listener net.Listener, path string, forwardedFor bool, trusted trustedProxies) *websocketListener {
+    if path == "" {
+        path = "/"
+    }
+
+    wl := &websocketListener{
+        listener:     listener,
+        path:         path,
+        forwardedFor: forwardedFor,
+        trusted:      trusted,
+        conns:        make(chan net.Conn),
+        closed:       make(chan struct{}),
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc(path, wl.handleUpgrade)
+    wl.server = &http.Server{Handler: mux, ReadHeaderTimeout: websocketHandshakeTimeout}
+
+    go func() {
+        if err := wl.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+            log.Printf("WebSocket listener error: %v", err)
+        }
+    }()
+
+    return wl
+}
+
+func (wl *websocketListener) Accept() (net.Conn, error) {
+    select {
+    case conn := <-wl.conns:
+        return conn, nil
+    case <-wl.closed:
+        return nil, net.ErrClosed
+    }
+}
+
+func (wl *websocketListener) Close() error {
+    wl.once.Do(func() {
+        close(wl.closed)
+    })
+    return wl.server.Close()
+}
+
+func (wl *websocketListener) Addr() net.Addr {
+    return wl.listener.Addr()
+}
+
+func (wl *websocketListener) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet ||
+        !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+        !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+        http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+        return
+    }
+
+    key := r.Header.Get("Sec-WebSocket-Key")
+    if key == "" {
+        http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+        return
+    }
+
+    hijacker, ok := w.(http.Hijacker)
+    if !ok {
+        http.Error(w, "websocket not supported", http.StatusInternalServerError)
+        return
+    }
+
+    conn, rw, err := hijacker.Hijack()
+    if err != nil {
+        log.Printf("Failed to hijack websocket connection: %v", err)
+        return
+    }
+
+    hash := sha1.Sum([]byte(key + websocketGUID))
+    accept := base64.StdEncoding.EncodeToString(hash[:])
+
+    response := "HTTP/1.1 101 Switching Protocols\r\n" +
+        "Upgrade: websocket\r\n" +
+        "Connection: Upgrade\r\n" +
+        "Sec-WebSocket-Accept: " + accept + "\r\n\r\n"
+    if _, err := conn.Write([]byte(response)); err != nil {
+        conn.Close()
+        return
+    }
+
+    wsConn := &websocketConn{Conn: conn, reader: rw.Reader, remote: wl.forwardedAddr(r, conn)}
+
+    select {
+    case wl.conns <- wsConn:
+    case <-wl.closed:
+        conn.Close()
+    }
+}
+
+// forwardedAddr returns the client address a trusted proxy put last in
+// X-Forwarded-For, or nil to use the connection's own.
+func (wl *websocketListener) forwardedAddr(r *http.Request, conn net.Conn) net.Addr {
+    if !wl.forwardedFor || !wl.trusted.allows(conn.RemoteAddr()) {
+        return nil
+    }
+
+    header := r.Header.Values("X-Forwarded-For")
+    if len(header) == 0 {
+        return nil
+    }
+    hops := strings.Split(header[len(header)-1], ",")
+
+    ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+    if ip == nil {
+        return nil
+    }
+    return &net.TCPAddr{IP: ip}
+}
+
+type websocketConn struct {
+    net.Conn
+    reader  *bufio.Reader
+    remote  net.Addr
+    pending []byte
+    writeMu sync.Mutex
+    binary  int32
+}
+
+func (wc *websocketConn) RemoteAddr() net.Addr {
+    if wc.remote != nil {
+        return wc.remote
+    }
+    return wc.Conn.RemoteAddr()
+}
+
+func (wc *websocketConn) Read(p []byte) (int, error) {
+    for len(wc.pending) == 0 {
+        if err := wc.readMessage(); err != nil {
+            return 0, err
+        }
+    }
+
+    n := copy(p, wc.pending)
+    wc.pending = wc.pending[n:]
+    return n, nil
+}
+
+func (wc *websocketConn) readMessage() error {
+    var message []byte
+
+    for {
+        fin, opcode, payload, err := wc.readFrame()
+        if err != nil {
+            return err
+        }
+
+        switch opcode {
+        case websocketOpClose:
+            wc.writeFrame(websocketOpClose, nil)
+            return io.EOF
+        case websocketOpPing:
+            if err := wc.writeFrame(websocketOpPong, payload); err != nil {
+                return err
+            }
+            continue
+        case websocketOpPong:
+            continue
+        case websocketOpText, websocketOpBinary, websocketOpContinuation:
+            message = append(message, payload...)
+            if len(message) > websocketMaxPayload {
+                return fmt.Errorf("websocket message too large")
+            }
+        default:
+            return fmt.Errorf("unsupported websocket opcode: %d", opcode)
+        }
+
+        if fin {
+            break
+        }
+    }
+
+    if len(message) > 0 && message[len(message)-1] != '\n' {
+        message = append(message, '\n')
+    }
+    wc.pending = message
+
+    return nil
+}
+
+func (wc *websocketConn) readFrame() (bool, byte, []byte, error) {
+    header := make([]byte, 2)
+    if _, err := io.ReadFull(wc.reader, header); err != nil {
+        return false, 0, nil, err
+    }
+
+    fin := header[0]&0x80 != 0
+    opcode := header[0] & 0x0F
+    masked := header[1]&0x80 != 0
+    length := uint64(header[1] & 0x7F)
+
+    switch length {
+    case 126:
+        extended := make([]byte, 2)
+        if _, err := io.ReadFull(wc.reader, extended); err != nil {
+            return false, 0, nil, err
+        }
+        length = uint64(binary.BigEndian.Uint16(extended))
+    case 127:
+        extended := make([]byte, 8)
+        if _, err := io.ReadFull(wc.reader, extended); err != nil {
+            return false, 0, nil, err
+        }
+        length = binary.BigEndian.Uint64(extended)
+    }
+
+    if length > websocketMaxPayload {
+        return false, 0, nil, fmt.Errorf("websocket frame too large")
+    }
+
+    if !masked {
+        return false, 0, nil, fmt.Errorf("client websocket frames must be masked")
+    }
+
+    mask := make([]byte, 4)
+    if _, err := io.ReadFull(wc.reader, mask); err != nil {
+        return false, 0, nil, err
+    }
+
+    payload := make([]byte, length)
+    if _, err := io.ReadFull(wc.reader, payload); err != nil {
+        return false, 0, nil, err
+    }
+
+    for i := range payload {
+        payload[i] ^= mask[i%4]
+    }
+
+    return fin, opcode, payload, nil
+}
+
+// setBinary switches output to binary frames, for framed or encrypted
+// connections whose lines are not UTF-8 text. Browsers close the socket on
+// a text frame that is not valid UTF-8.
+func (wc *websocketConn) setBinary(binary bool) {
+    var value int32
+    if binary {
+        value = 1
+    }
+    atomic.StoreInt32(&wc.binary, value)
+}
+
+// Write sends p as one text frame, or as a binary frame when binary output
+// is on or p is not valid UTF-8.
+func (wc *websocketConn) Write(p []byte) (int, error) {
+    opcode := byte(websocketOpText)
+    if atomic.LoadInt32(&wc.binary) == 1 || !utf8.Valid(p) {
+        opcode = websocketOpBinary
+    }
+
+    if err := wc.writeFrame(opcode, p); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+func (wc *websocketConn) writeFrame(opcode byte, payload []byte) error {
+    wc.writeMu.Lock()
+    defer wc.writeMu.Unlock()
+
+    header := []byte{0x80 | opcode}
+    length := len(payload)
+
+    switch {
+    case length < 126:
+        header = append(header, byte(length))
+    case length <= 0xFFFF:
+        header = append(header, 126, 0, 0)
+        binary.BigEndian.PutUint16(header[2:], uint16(length))
+    default:
+        header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+        binary.BigEndian.PutUint64(header[2:], uint64(length))
+    }
+
+    if _, err := wc.Conn.Write(append(header, payload...)); err != nil {
+        return err
+    }
+
+    return nil
+}
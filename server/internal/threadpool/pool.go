@@ -1,10 +1,12 @@
 package threadpool
 
 import (
+    "container/heap"
     "context"
     "fmt"
     "log"
     "sync"
+    "sync/atomic"
     "time"
 )
 
@@ -12,16 +14,28 @@ type Job struct {
     ID       string
     Task     func() error
     Priority int 
+    ordered  bool
 }
 
 type WorkerPool struct {
     workers       int
     maxWorkers    int
-    jobQueue      chan Job
+    queue         jobQueue
+    queueMu       sync.Mutex
+    queueSeq      uint64
+    ready         chan struct{}
+    space         chan struct{}
     queueSize     int
     workerTimeout time.Duration
     activeWorkers int
     workersMu     sync.Mutex
+    submitMu      sync.RWMutex
+    closed        bool
+    ordered       map[string][]Job
+    orderedMu     sync.Mutex
+    completed     int64
+    failed        int64
+    rejected      int64
     wg            sync.WaitGroup
     ctx           context.Context
     cancel        context.CancelFunc
@@ -30,13 +44,19 @@ type WorkerPool struct {
 func NewWorkerPool(workers, queueSize, maxWorkers int, workerTimeout time.Duration) *WorkerPool {
     ctx, cancel := context.WithCancel(context.Background())
 
+    if queueSize < 1 {
+        queueSize = 1
+    }
+
     wp := &WorkerPool{
         workers:       workers,
         maxWorkers:    maxWorkers,
-        jobQueue:      make(chan Job, queueSize),
+        ready:         make(chan struct{}, queueSize),
+        space:         make(chan struct{}, 1),
         queueSize:     queueSize,
         workerTimeout: workerTimeout,
         activeWorkers: 0,
+        ordered:       make(map[string][]Job),
         ctx:           ctx,
         cancel:        cancel,
     }
@@ -79,8 +99,12 @@ func (wp *WorkerPool) startWorker(id int) {
                 log.Printf("Worker %d shutting down", workerID)
                 return
 
-            case job := <-wp.jobQueue:
-                
+            case _, ok := <-wp.ready:
+                if !ok {
+                    return
+                }
+                job := wp.dequeue()
+
                 if !idleTimer.Stop() {
                     select {
                     case <-idleTimer.C:
@@ -89,11 +113,7 @@ func (wp *WorkerPool) startWorker(id int) {
                 }
                 idleTimer.Reset(wp.workerTimeout)
 
-                if err := job.Task(); err != nil {
-                    log.Printf("Worker %d: Job %s failed: %v", workerID, job.ID, err)
-                } else {
-                    log.Printf("Worker %d: Job %s completed", workerID, job.ID)
-                }
+                wp.run(job)
 
             case <-idleTimer.C:
                 
@@ -112,14 +132,31 @@ func (wp *WorkerPool) startWorker(id int) {
     }(id)
 }
 
+func (wp *WorkerPool) run(job Job) {
+    if job.ordered {
+        // The jobs it runs are counted individually.
+        job.Task()
+        return
+    }
+
+    if err := job.Task(); err != nil {
+        atomic.AddInt64(&wp.failed, 1)
+        log.Printf("Job %s failed: %v", job.ID, err)
+        return
+    }
+    atomic.AddInt64(&wp.completed, 1)
+}
+
 func (wp *WorkerPool) Submit(job Job) error {
-    select {
-    case <-wp.ctx.Done():
+    wp.submitMu.RLock()
+    defer wp.submitMu.RUnlock()
+
+    if wp.closed {
+        atomic.AddInt64(&wp.rejected, 1)
         return fmt.Errorf("worker pool is shutting down")
-    default:
     }
 
-    queueLen := len(wp.jobQueue)
+    queueLen := wp.GetQueueLength()
     if queueLen > wp.queueSize/2 { 
         wp.workersMu.Lock()
         if wp.activeWorkers < wp.maxWorkers {
@@ -132,28 +169,132 @@ func (wp *WorkerPool) Submit(job Job) error {
         }
     }
 
+    deadline := time.NewTimer(5 * time.Second)
+    defer deadline.Stop()
+
+    for !wp.enqueue(job) {
+        select {
+        case <-wp.space:
+        case <-deadline.C:
+            atomic.AddInt64(&wp.rejected, 1)
+            return fmt.Errorf("failed to submit job: queue full")
+        }
+    }
+
+    return nil
+}
+
+// TrySubmit queues job only if there is room right now, without waiting
+// for space or spawning workers. Callers that can do the work themselves
+// use it to back off while the pool is saturated.
+func (wp *WorkerPool) TrySubmit(job Job) bool {
+    wp.submitMu.RLock()
+    defer wp.submitMu.RUnlock()
+
+    if wp.closed {
+        return false
+    }
+    return wp.enqueue(job)
+}
+
+func (wp *WorkerPool) enqueue(job Job) bool {
+    wp.queueMu.Lock()
+    defer wp.queueMu.Unlock()
+
+    if wp.queue.Len() >= wp.queueSize {
+        return false
+    }
+
+    wp.queueSeq++
+    heap.Push(&wp.queue, &queuedJob{job: job, rank: rankFor(job, time.Now()), seq: wp.queueSeq})
+
+    // One token per queued job, so this never blocks: tokens never outnumber
+    // queued jobs, which never exceed the channel's capacity.
+    wp.ready <- struct{}{}
+    return true
+}
+
+func (wp *WorkerPool) dequeue() Job {
+    wp.queueMu.Lock()
+    item := heap.Pop(&wp.queue).(*queuedJob)
+    wp.queueMu.Unlock()
+
     select {
-    case wp.jobQueue <- job:
-        return nil
-    case <-time.After(5 * time.Second):
-        return fmt.Errorf("failed to submit job: queue full")
+    case wp.space <- struct{}{}:
+    default:
+    }
+
+    return item.job
+}
+
+// SubmitOrdered runs jobs that share a key one at a time, in submission
+// order, while jobs with different keys still run in parallel. If the pool
+// cannot take the job it runs in the caller instead, so it is never lost.
+func (wp *WorkerPool) SubmitOrdered(key string, job Job) {
+    wp.orderedMu.Lock()
+    if pending, running := wp.ordered[key]; running {
+        wp.ordered[key] = append(pending, job)
+        wp.orderedMu.Unlock()
+        return
+    }
+    wp.ordered[key] = nil
+    wp.orderedMu.Unlock()
+
+    chain := Job{
+        ID:       job.ID,
+        Priority: job.Priority,
+        ordered:  true,
+        Task: func() error {
+            wp.runOrdered(key, job)
+            return nil
+        },
+    }
+
+    if err := wp.Submit(chain); err != nil {
+        wp.runOrdered(key, job)
+    }
+}
+
+func (wp *WorkerPool) runOrdered(key string, job Job) {
+    for {
+        wp.run(job)
+
+        wp.orderedMu.Lock()
+        pending := wp.ordered[key]
+        if len(pending) == 0 {
+            delete(wp.ordered, key)
+            wp.orderedMu.Unlock()
+            return
+        }
+        job = pending[0]
+        wp.ordered[key] = pending[1:]
+        wp.orderedMu.Unlock()
     }
 }
 
 func (wp *WorkerPool) SubmitTask(id string, task func() error) error {
+    return wp.SubmitPriority(id, PriorityNormal, task)
+}
+
+func (wp *WorkerPool) SubmitPriority(id string, priority int, task func() error) error {
     return wp.Submit(Job{
         ID:       id,
         Task:     task,
-        Priority: 0,
+        Priority: priority,
     })
 }
 
 func (wp *WorkerPool) Shutdown() {
     log.Println("Shutting down worker pool...")
 
-    wp.cancel()
-
-    close(wp.jobQueue)
+    wp.submitMu.Lock()
+    if wp.closed {
+        wp.submitMu.Unlock()
+        return
+    }
+    wp.closed = true
+    close(wp.ready)
+    wp.submitMu.Unlock()
 
     done := make(chan struct{})
     go func() {
@@ -167,9 +308,13 @@ func (wp *WorkerPool) Shutdown() {
     case <-time.After(10 * time.Second):
         log.Println("Worker shutdown timeout reached")
     }
+
+    wp.cancel()
 }
 
 func (wp *WorkerPool) GetStats() map[string]interface{} {
+    queueLen := wp.GetQueueLength()
+
     wp.workersMu.Lock()
     defer wp.workersMu.Unlock()
 
@@ -177,9 +322,12 @@ func (wp *WorkerPool) GetStats() map[string]interface{} {
         "active_workers": wp.activeWorkers,
         "min_workers":    wp.workers,
         "max_workers":    wp.maxWorkers,
-        "queue_length":   len(wp.jobQueue),
+        "queue_length":   queueLen,
         "queue_capacity": wp.queueSize,
-        "queue_usage":    float64(len(wp.jobQueue)) / float64(wp.queueSize) * 100,
+        "queue_usage":    float64(queueLen) / float64(wp.queueSize) * 100,
+        "jobs_completed": atomic.LoadInt64(&wp.completed),
+        "jobs_failed":    atomic.LoadInt64(&wp.failed),
+        "jobs_rejected":  atomic.LoadInt64(&wp.rejected),
     }
 }
 
@@ -190,5 +338,7 @@ func (wp *WorkerPool) GetActiveWorkerCount() int {
 }
 
 func (wp *WorkerPool) GetQueueLength() int {
-    return len(wp.jobQueue)
+    wp.queueMu.Lock()
+    defer wp.queueMu.Unlock()
+    return wp.queue.Len()
 }
@@ -0,0 +1,193 @@
+package threadpool
+
+import (
+    "container/heap"
+    "fmt"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+// queueOp submits a job at a simulated time after the start, or pops the
+// next job when id is empty.
+type queueOp struct {
+    at       time.Duration
+    id       string
+    priority int
+}
+
+func submitAt(at time.Duration, id string, priority int) queueOp {
+    return queueOp{at: at, id: id, priority: priority}
+}
+
+func popAt(at time.Duration) queueOp {
+    return queueOp{at: at}
+}
+
+// highStream submits a batch of high priority jobs at the start, then one
+// more every tick while a single worker pops one per tick, so there is
+// always high priority work waiting ahead of anything less urgent.
+func highStream(backlog, ticks int, tick time.Duration) []queueOp {
+    var ops []queueOp
+    for i := 0; i < backlog; i++ {
+        ops = append(ops, submitAt(0, fmt.Sprintf("backlog-%d", i), PriorityHigh))
+    }
+    ops = append(ops, submitAt(0, "low", PriorityLow))
+    for k := 1; k <= ticks; k++ {
+        at := time.Duration(k) * tick
+        ops = append(ops, submitAt(at, fmt.Sprintf("high-%d", k), PriorityHigh), popAt(at))
+    }
+    return ops
+}
+
+func TestJobQueueOrder(t *testing.T) {
+    start := time.Unix(1700000000, 0)
+
+    tests := []struct {
+        name string
+        ops  []queueOp
+        // drain pops whatever is left after ops.
+        drain bool
+        // want is the order the listed jobs must come out in; jobs not
+        // listed may come out anywhere around them.
+        want []string
+    }{
+        {
+            name: "same priority runs in submission order",
+            ops: []queueOp{
+                submitAt(0, "a", PriorityNormal),
+                submitAt(0, "b", PriorityNormal),
+                submitAt(time.Millisecond, "c", PriorityNormal),
+            },
+            drain: true,
+            want:  []string{"a", "b", "c"},
+        },
+        {
+            name: "high priority goes ahead of queued bulk jobs",
+            ops: []queueOp{
+                submitAt(0, "bulk-1", PriorityLow),
+                submitAt(0, "bulk-2", PriorityLow),
+                submitAt(0, "bulk-3", PriorityLow),
+                submitAt(100*time.Millisecond, "normal", PriorityNormal),
+                submitAt(200*time.Millisecond, "high", PriorityHigh),
+            },
+            drain: true,
+            want:  []string{"high", "normal", "bulk-1", "bulk-2", "bulk-3"},
+        },
+        {
+            name: "high priority does not pass a job older than the aging window",
+            ops: []queueOp{
+                submitAt(0, "low", PriorityLow),
+                submitAt(2*priorityAging+time.Millisecond, "high", PriorityHigh),
+            },
+            drain: true,
+            want:  []string{"low", "high"},
+        },
+        {
+            name: "equal aged rank keeps submission order",
+            ops: []queueOp{
+                submitAt(0, "low", PriorityLow),
+                submitAt(2*priorityAging, "high", PriorityHigh),
+            },
+            drain: true,
+            want:  []string{"low", "high"},
+        },
+        {
+            // The low job ranks level with high jobs submitted
+            // 2*priorityAging after it, so it runs once the ones queued
+            // before that point are done, while the stream goes on.
+            name: "low priority is not starved by a steady high priority stream",
+            ops:  highStream(4, 20, 500*time.Millisecond),
+            want: []string{"backlog-3", "high-7", "low", "high-8"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var q jobQueue
+            var seq uint64
+            var popped []string
+
+            for _, op := range tt.ops {
+                if op.id == "" {
+                    if q.Len() == 0 {
+                        t.Fatalf("pop at %v from an empty queue", op.at)
+                    }
+                    popped = append(popped, heap.Pop(&q).(*queuedJob).job.ID)
+                    continue
+                }
+                seq++
+                job := Job{ID: op.id, Priority: op.priority}
+                heap.Push(&q, &queuedJob{job: job, rank: rankFor(job, start.Add(op.at)), seq: seq})
+            }
+            if tt.drain {
+                for q.Len() > 0 {
+                    popped = append(popped, heap.Pop(&q).(*queuedJob).job.ID)
+                }
+            }
+
+            listed := make(map[string]bool, len(tt.want))
+            for _, id := range tt.want {
+                listed[id] = true
+            }
+            var got []string
+            for _, id := range popped {
+                if listed[id] {
+                    got = append(got, id)
+                }
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("order = %v, want %v (all popped: %v)", got, tt.want, popped)
+            }
+        })
+    }
+}
+
+func TestWorkerPoolRunsHighPriorityFirst(t *testing.T) {
+    wp := NewWorkerPool(1, 16, 1, time.Minute)
+    wp.Start()
+    defer wp.Shutdown()
+
+    // Hold the only worker so the rest queue up behind it.
+    release := make(chan struct{})
+    started := make(chan struct{})
+    if err := wp.SubmitPriority("blocker", PriorityNormal, func() error {
+        close(started)
+        <-release
+        return nil
+    }); err != nil {
+        t.Fatalf("submit blocker: %v", err)
+    }
+    <-started
+
+    var mu sync.Mutex
+    var order []string
+    var done sync.WaitGroup
+    submit := func(id string, priority int) {
+        done.Add(1)
+        err := wp.SubmitPriority(id, priority, func() error {
+            mu.Lock()
+            order = append(order, id)
+            mu.Unlock()
+            done.Done()
+            return nil
+        })
+        if err != nil {
+            t.Fatalf("submit %s: %v", id, err)
+        }
+    }
+
+    for i := 1; i <= 3; i++ {
+        submit(fmt.Sprintf("bulk-%d", i), PriorityLow)
+    }
+    submit("high", PriorityHigh)
+
+    close(release)
+    done.Wait()
+
+    want := []string{"high", "bulk-1", "bulk-2", "bulk-3"}
+    if !reflect.DeepEqual(order, want) {
+        t.Errorf("order = %v, want %v", order, want)
+    }
+}
@@ -0,0 +1,53 @@
+package threadpool
+
+import "time"
+
+const (
+    PriorityLow    = 0
+    PriorityNormal = 1
+    PriorityHigh   = 2
+)
+
+// priorityAging is how much queueing time one priority level is worth. A job
+// is ranked by its submit time minus Priority*priorityAging, so higher
+// priority work jumps ahead of lower priority work, but never ahead of a job
+// that has already waited longer than the difference. Low priority jobs are
+// delayed by at most a few seconds and cannot starve.
+const priorityAging = 2 * time.Second
+
+type queuedJob struct {
+    job  Job
+    rank int64
+    seq  uint64
+}
+
+// jobQueue is a container/heap ordered by rank, then submission order.
+type jobQueue []*queuedJob
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+    if q[i].rank != q[j].rank {
+        return q[i].rank < q[j].rank
+    }
+    return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x interface{}) {
+    *q = append(*q, x.(*queuedJob))
+}
+
+func (q *jobQueue) Pop() interface{} {
+    old := *q
+    n := len(old)
+    item := old[n-1]
+    old[n-1] = nil
+    *q = old[:n-1]
+    return item
+}
+
+func rankFor(job Job, now time.Time) int64 {
+    return now.Add(-time.Duration(job.Priority) * priorityAging).UnixNano()
+}